@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"coop.tools/backend/internal/announcements"
+	"coop.tools/backend/internal/attachments"
+	"coop.tools/backend/internal/auth"
+	"coop.tools/backend/internal/bank"
+	"coop.tools/backend/internal/budgets"
+	"coop.tools/backend/internal/capital"
+	"coop.tools/backend/internal/dues"
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/hours"
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/invoices"
+	"coop.tools/backend/internal/ledger"
+	"coop.tools/backend/internal/members"
+	"coop.tools/backend/internal/patronage"
+	"coop.tools/backend/internal/payments"
+	"coop.tools/backend/internal/proposals"
+	"coop.tools/backend/internal/rbac"
+	"coop.tools/backend/internal/reimbursements"
+	"coop.tools/backend/internal/reports"
+	"coop.tools/backend/internal/votes"
+)
+
+// Route policy: who may call each route that changes state. Mount
+// functions enforce it per route with httpmw.RequireAuth or
+// httpmw.RequirePermission; this table is the single place to review it.
+// Values are "public" (no sign-in, checked by other means), "auth" (any
+// signed-in member; handlers may narrow it to the member's own records),
+// "active" (members in good standing, not applicants or suspended
+// members), or the permission the route requires.
+var routePolicy = map[string]string{
+	// Sign-in itself, and webhooks verified by signature.
+	"POST /api/auth/dev/login":               "public",
+	"POST /api/auth/logout":                  "public",
+	"POST /api/auth/magic-link":              "public",
+	"POST /api/auth/magic-link/redeem":       "public",
+	"POST /api/auth/passkeys/login/begin":    "public",
+	"POST /api/auth/passkeys/login/finish":   "public",
+	"POST /api/payments/webhooks/{provider}": "public",
+
+	"POST /api/auth/logout-all":               "auth",
+	"POST /api/auth/passkeys/register/begin":  "auth",
+	"POST /api/auth/passkeys/register/finish": "auth",
+	"PUT /api/auth/passkeys/{id}":             "auth",
+	"DELETE /api/auth/passkeys/{id}":          "auth",
+	"POST /api/auth/session/refresh":          "auth",
+	"DELETE /api/auth/sessions/{id}":          "auth",
+	"POST /api/auth/tokens":                   "tokens.manage",
+	"DELETE /api/auth/tokens/{id}":            "tokens.manage",
+
+	"POST /api/rbac/roles":              "roles.manage",
+	"PUT /api/rbac/roles/{id}":          "roles.manage",
+	"DELETE /api/rbac/roles/{id}":       "roles.manage",
+	"POST /api/rbac/assignments":        "roles.manage",
+	"DELETE /api/rbac/assignments/{id}": "roles.manage",
+
+	"POST /api/members/":                       "members.manage",
+	"POST /api/members/{id}/status":            "members.manage",
+	"PUT /api/members/{id}/profile":            "auth",
+	"PATCH /api/members/{id}":                  "auth",
+	"DELETE /api/members/{id}":                 "members.manage",
+	"POST /api/members/{id}/email":             "auth",
+	"POST /api/members/email/confirm":          "public",
+	"POST /api/members/import":                 "members.manage",
+	"POST /api/members/import/preview":         "members.manage",
+	"POST /api/proposals/":                     "active",
+	"POST /api/proposals/{id}/close":           "proposals.manage",
+	"POST /api/proposals/{proposal_id}/votes/": "active",
+	"PUT /api/proposals/{proposal_id}/votes/":  "active",
+	"POST /api/announcements/":                 "announcements.publish",
+	"POST /api/announcements/{id}/read":        "auth",
+	"POST /api/attachments/":                   "auth",
+	"DELETE /api/attachments/{id}":             "auth",
+
+	"POST /api/ledger/":                 "auth",
+	"POST /api/ledger/import/beancount": "ledger.import",
+	"PUT /api/ledger/accounts/{type}":   "ledger.accounts",
+	"POST /api/ledger/{id}/settle":      "ledger.settle",
+
+	"POST /api/bank/statements":              "bank.reconcile",
+	"POST /api/bank/match":                   "bank.reconcile",
+	"POST /api/bank/lines/{id}/match":        "bank.reconcile",
+	"POST /api/bank/lines/{id}/unmatch":      "bank.reconcile",
+	"POST /api/bank/lines/{id}/ignore":       "bank.reconcile",
+	"POST /api/bank/lines/{id}/entry":        "bank.reconcile",
+	"POST /api/budgets/":                     "budgets.manage",
+	"POST /api/budgets/{id}/lines":           "budgets.manage",
+	"POST /api/dues/plans":                   "dues.manage",
+	"POST /api/dues/plans/{id}/enrollments":  "dues.manage",
+	"POST /api/dues/assessments/run":         "dues.manage",
+	"POST /api/fx/rates/import":              "fx.manage",
+	"PUT /api/fx/rates/{currency}/{date}":    "fx.manage",
+	"DELETE /api/fx/rates/{currency}/{date}": "fx.manage",
+	"POST /api/patronage/runs":               "patronage.manage",
+	"POST /api/patronage/runs/{id}/approve":  "patronage.manage",
+	"POST /api/patronage/runs/{id}/post":     "patronage.manage",
+
+	"POST /api/capital/members/{id}/plans":       "capital.manage",
+	"POST /api/capital/members/{id}/purchases":   "capital.manage",
+	"POST /api/capital/members/{id}/redemptions": "capital.manage",
+	"POST /api/capital/members/{id}/adjustments": "capital.manage",
+	"POST /api/capital/plans/{id}/payments":      "capital.manage",
+	"POST /api/capital/plans/{id}/cancel":        "capital.manage",
+	"POST /api/capital/retained/import":          "capital.manage",
+	"POST /api/capital/transactions/{id}/post":   "capital.manage",
+
+	"POST /api/hours/categories":              "hours.manage",
+	"PUT /api/hours/categories/{id}":          "hours.manage",
+	"POST /api/hours/entries":                 "auth",
+	"POST /api/hours/entries/import":          "auth",
+	"PUT /api/hours/entries/{id}":             "auth",
+	"DELETE /api/hours/entries/{id}":          "auth",
+	"POST /api/hours/timesheets":              "auth",
+	"POST /api/hours/timesheets/{id}/approve": "hours.manage",
+	"POST /api/hours/timesheets/{id}/reject":  "hours.manage",
+	"PUT /api/hours/rates/{memberID}":         "hours.manage",
+
+	"POST /api/invoices/":                               "invoices.manage",
+	"PUT /api/invoices/{id}":                            "invoices.manage",
+	"POST /api/invoices/{id}/send":                      "invoices.manage",
+	"POST /api/invoices/{id}/void":                      "invoices.manage",
+	"POST /api/invoices/{id}/payments":                  "invoices.manage",
+	"POST /api/invoices/{id}/payments/{paymentID}/post": "invoices.manage",
+	"POST /api/invoices/customers":                      "invoices.manage",
+	"PUT /api/invoices/customers/{id}":                  "invoices.manage",
+
+	"POST /api/payments/events/{id}/replay": "payments.manage",
+	"POST /api/payments/events/{id}/assign": "payments.manage",
+
+	"POST /api/reimbursements/":             "auth",
+	"POST /api/reimbursements/{id}/cancel":  "auth",
+	"PUT /api/reimbursements/limits/{role}": "reimbursements.limits",
+	"POST /api/reimbursements/{id}/approve": "reimbursements.approve",
+	"POST /api/reimbursements/{id}/reject":  "reimbursements.approve",
+	"POST /api/reimbursements/{id}/post":    "reimbursements.approve",
+	"POST /api/reimbursements/{id}/pay":     "reimbursements.approve",
+}
+
+// mountAll mounts every domain the way main does, with empty handlers:
+// requests that get past authorization fail on the missing dependencies,
+// which the probe below treats as reaching the handler.
+func mountAll(api chi.Router) {
+	auth.Mount(api, auth.Handlers{Links: &auth.MagicLinks{}, Passkeys: &auth.Passkeys{}, AllowDevLogin: true})
+	rbac.Mount(api, rbac.Handlers{})
+	proposals.Mount(api, proposals.Handlers{})
+	fx.Mount(api, fx.Handlers{})
+	ledger.Mount(api, ledger.Handlers{})
+	announcements.Mount(api, announcements.Handlers{})
+	members.Mount(api, members.Handlers{})
+	votes.Mount(api, votes.Handlers{})
+	dues.Mount(api, dues.Handlers{})
+	patronage.Mount(api, patronage.Handlers{})
+	hours.Mount(api, hours.Handlers{})
+	budgets.Mount(api, budgets.Handlers{})
+	reports.Mount(api, reports.Handlers{})
+	bank.Mount(api, bank.Handlers{})
+	reimbursements.Mount(api, reimbursements.Handlers{})
+	capital.Mount(api, capital.Handlers{})
+	invoices.Mount(api, invoices.Handlers{})
+	payments.Mount(api, payments.Handlers{})
+	attachments.Mount(api, attachments.Handlers{})
+}
+
+func policyRouter() http.Handler {
+	r := chi.NewRouter()
+	// Member 3 holds no permissions; member 4 is suspended.
+	r.Use(httpmw.WithAuth(httpmw.AuthConfig{DevHeader: func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+		p := httpmw.Principal{MemberID: id, Role: "member"}
+		if id == 4 {
+			p.Status = "suspended"
+		}
+		return p, id == 3 || id == 4, nil
+	}}))
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if recover() != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Route("/api", mountAll)
+	return r
+}
+
+var urlParam = regexp.MustCompile(`\{[^}]+\}`)
+
+func probe(h http.Handler, key, user string) int {
+	method, pattern, _ := strings.Cut(key, " ")
+	req := httptest.NewRequest(method, urlParam.ReplaceAllString(pattern, "1"), strings.NewReader("{}"))
+	if user != "" {
+		req.Header.Set("X-User-Id", user)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// TestRoutePolicy walks the router: every route that is not a safe read
+// must be in routePolicy, and must turn away guests and, when it needs
+// good standing or a permission, members without it.
+func TestRoutePolicy(t *testing.T) {
+	h := policyRouter()
+	seen := map[string]bool{}
+	err := chi.Walk(h.(chi.Routes), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			return nil
+		}
+		key := method + " " + route
+		seen[key] = true
+		rule, ok := routePolicy[key]
+		switch {
+		case !ok:
+			t.Errorf("%s has no entry in routePolicy", key)
+		case rule == "public":
+		case probe(h, key, "") != http.StatusUnauthorized:
+			t.Errorf("%s is reachable without signing in", key)
+		case rule == "active" && probe(h, key, "4") != http.StatusForbidden:
+			t.Errorf("%s is reachable by suspended members", key)
+		case rule != "auth" && rule != "active" && probe(h, key, "3") != http.StatusForbidden:
+			t.Errorf("%s is reachable without %s", key, rule)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, rule := range routePolicy {
+		if !seen[key] {
+			t.Errorf("routePolicy lists %s, which is not mounted", key)
+		}
+		if _, ok := httpmw.Permissions[rule]; !ok && rule != "public" && rule != "auth" && rule != "active" {
+			t.Errorf("%s: unknown permission %q", key, rule)
+		}
+	}
+}
+
+// TestRoutePolicy_MountsEveryDomain keeps mountAll in step with main.
+func TestRoutePolicy_MountsEveryDomain(t *testing.T) {
+	src, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, err := os.ReadFile("authz_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mounts := regexp.MustCompile(`(\w+)\.Mount\(api,`)
+	var missing []string
+	for _, m := range mounts.FindAllStringSubmatch(string(src), -1) {
+		if !strings.Contains(string(self), "\t"+m[1]+".Mount(api, ") {
+			missing = append(missing, m[1])
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 {
+		t.Fatalf("mountAll does not mount %v", missing)
+	}
+}
@@ -2,8 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -11,11 +16,26 @@ import (
 	"github.com/joho/godotenv"
 
 	"coop.tools/backend/internal/announcements"
+	"coop.tools/backend/internal/attachments"
+	"coop.tools/backend/internal/auth"
+	"coop.tools/backend/internal/bank"
+	"coop.tools/backend/internal/capital"
+	"coop.tools/backend/internal/budgets"
 	"coop.tools/backend/internal/db"
+	"coop.tools/backend/internal/dues"
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/hours"
 	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/invoices"
 	"coop.tools/backend/internal/members"
+	"coop.tools/backend/internal/patronage"
+	"coop.tools/backend/internal/payments"
 	"coop.tools/backend/internal/ledger"
+	"coop.tools/backend/internal/mail"
 	"coop.tools/backend/internal/proposals"
+	"coop.tools/backend/internal/rbac"
+	"coop.tools/backend/internal/reimbursements"
+	"coop.tools/backend/internal/reports"
 	"coop.tools/backend/internal/votes"
 )
 
@@ -30,6 +50,10 @@ func main() {
 	}
 	defer store.Close()
 
+	// Ledger amounts are converted into this currency for reports and exports.
+	baseCurrency := strings.ToUpper(db.Env("BASE_CURRENCY", "USD"))
+	ledger.BaseCurrency = baseCurrency
+
 	// NEW: domain-owned migrations
     if err := proposals.ApplyMigrations(ctx, store.Pool); err != nil {
         log.Fatal("proposals migrations:", err)
@@ -43,18 +67,60 @@ func main() {
     if err := members.ApplyMigrations(ctx, store.Pool); err != nil {
         log.Fatal("members migrations:", err)
     }
+    if err := auth.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("auth migrations:", err)
+    }
+    if err := rbac.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("rbac migrations:", err)
+    }
     if err := announcements.ApplyMigrations(ctx, store.Pool); err != nil {
         log.Fatal("announcements migrations:", err)
     }
+    if err := dues.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("dues migrations:", err)
+    }
+    if err := patronage.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("patronage migrations:", err)
+    }
+    if err := budgets.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("budgets migrations:", err)
+    }
+    if err := bank.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("bank migrations:", err)
+    }
+    if err := attachments.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("attachments migrations:", err)
+    }
+    if err := reimbursements.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("reimbursements migrations:", err)
+    }
+    if err := capital.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("capital migrations:", err)
+    }
+    if err := fx.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("fx migrations:", err)
+    }
+    if err := invoices.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("invoices migrations:", err)
+    }
+    if err := payments.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("payments migrations:", err)
+    }
+    if err := hours.ApplyMigrations(ctx, store.Pool); err != nil {
+        log.Fatal("hours migrations:", err)
+    }
+	if email := db.Env("ADMIN_EMAIL", ""); email != "" {
+		bootstrapAdmin(ctx, members.NewPgRepo(store.Pool), email)
+	}
 
 	corsOrigin := db.Env("CORS_ORIGIN", "http://localhost:5173")
 
 	r := chi.NewRouter()
     r.Use(cors.Handler(cors.Options{
         AllowedOrigins:   []string{corsOrigin},
-        AllowedMethods:   []string{"GET", "POST", "PUT", "OPTIONS"},
-        AllowedHeaders:   []string{"Accept", "Content-Type", "X-User-Id", "X-Idempotency-Key"},
-        AllowCredentials: false,
+        AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+        AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-User-Id", "X-Idempotency-Key"},
+        AllowCredentials: true,
         MaxAge:           300,
     }))
 
@@ -66,24 +132,107 @@ func main() {
 
 	// API
 	r.Route("/api", func(api chi.Router) {
-		// Global auth: attach Principal from X-User-Id (guest if missing)
+		// Global auth: attach Principal from the session cookie or bearer token
 		memRepo := members.NewPgRepo(store.Pool)
-		api.Use(httpmw.WithAuth(func(c context.Context, id int64) (httpmw.Principal, bool, error) {
+		rbacRepo := rbac.NewPgRepo(store.Pool)
+		fetchMember := func(c context.Context, id int64) (httpmw.Principal, bool, error) {
 			m, err := memRepo.GetByID(c, id)
 			if err != nil {
 				if err == members.ErrNotFound { return httpmw.Principal{}, false, nil }
 				return httpmw.Principal{}, false, err
 			}
-			return httpmw.Principal{MemberID: m.ID, Role: m.Role, Email: m.Email, Name: m.DisplayName}, true, nil
-		}))
+			// Roles and permissions are resolved per request, so assignments
+			// start, end and get revoked without signing anyone out.
+			// Former members cannot sign in; their sessions and tokens stop
+			// working as soon as their status changes.
+			if !members.CanSignIn(m.Status) {
+				return httpmw.Principal{}, false, nil
+			}
+			p := httpmw.Principal{MemberID: m.ID, Role: m.Role, Status: m.Status, Email: m.Email, Name: m.DisplayName}
+			// Applicants and suspended members hold no roles beyond member.
+			if m.Status != members.StatusActive {
+				p.Roles, p.Permissions = []string{"member"}, []string{}
+				return p, true, nil
+			}
+			access, err := rbacRepo.Effective(c, m.ID, m.Role, time.Now())
+			if err != nil {
+				return httpmw.Principal{}, false, err
+			}
+			p.Roles, p.Permissions = access.Roles, access.Permissions
+			return p, true, nil
+		}
+		sessions := &auth.Manager{
+			Repo:        auth.NewPgRepo(store.Pool),
+			Members:     fetchMember,
+			TTL:         envDuration("SESSION_TTL"),
+			IdleTimeout: envDuration("SESSION_IDLE_TIMEOUT"),
+			RotateEvery: envDuration("SESSION_ROTATE_EVERY"),
+			Insecure:    db.Env("SESSION_COOKIE_INSECURE", "false") == "true",
+		}
+		authCfg := httpmw.AuthConfig{Sessions: sessions, TrustedOrigins: []string{corsOrigin}}
+		// AUTH_DEV_HEADER=true trusts X-User-Id and enables POST /api/auth/dev/login.
+		// Never set it where the API is reachable by anyone else.
+		devAuth := db.Env("AUTH_DEV_HEADER", "false") == "true"
+		if devAuth {
+			log.Println("WARNING: AUTH_DEV_HEADER is on; X-User-Id is trusted without a session")
+			authCfg.DevHeader = fetchMember
+		}
+		api.Use(httpmw.WithAuth(authCfg))
+		// API tokens only reach the areas their scopes name.
+		api.Use(httpmw.AreaScopes("/api"))
+		// Magic-link sign-in; links open APP_URL/login/verify.
+		appURL := strings.TrimRight(db.Env("APP_URL", corsOrigin), "/")
+		linkSecret := []byte(db.Env("AUTH_LINK_SECRET", ""))
+		if len(linkSecret) == 0 {
+			log.Println("AUTH_LINK_SECRET not set; sign-in links will stop working on restart")
+			linkSecret = make([]byte, 32)
+			if _, err := rand.Read(linkSecret); err != nil {
+				log.Fatal("link secret:", err)
+			}
+		}
+		mailer := newMailer(devAuth)
+		links := &auth.MagicLinks{
+			Mailer: mailer,
+			FindMember: func(c context.Context, email string) (httpmw.Principal, bool, error) {
+				m, err := memRepo.GetByEmail(c, email)
+				if err == members.ErrNotFound && email != strings.ToLower(email) {
+					m, err = memRepo.GetByEmail(c, strings.ToLower(email))
+				}
+				if err != nil {
+					if err == members.ErrNotFound { return httpmw.Principal{}, false, nil }
+					return httpmw.Principal{}, false, err
+				}
+				if !members.CanSignIn(m.Status) { return httpmw.Principal{}, false, nil }
+				return httpmw.Principal{MemberID: m.ID, Role: m.Role, Status: m.Status, Email: m.Email, Name: m.DisplayName}, true, nil
+			},
+			Secret: linkSecret,
+			URL:    appURL + "/login/verify",
+		}
+		// Passkeys are bound to the app's domain (WEBAUTHN_RP_ID, default the APP_URL host).
+		rpID := db.Env("WEBAUTHN_RP_ID", "")
+		if rpID == "" {
+			u, err := url.Parse(appURL)
+			if err != nil {
+				log.Fatal("APP_URL:", err)
+			}
+			rpID = u.Hostname()
+		}
+		passkeys := &auth.Passkeys{RPID: rpID, RPName: db.Env("ORG_NAME", "Cooperative"), Origins: []string{appURL}}
+		auth.Mount(api, auth.Handlers{Sessions: sessions, Links: links, Passkeys: passkeys, AllowDevLogin: devAuth})
+		rbac.Mount(api, rbac.Handlers{Repo: rbacRepo})
+
 		// Proposals
 		propRepo := proposals.NewPgRepo(store.Pool)
 		propHandlers := proposals.Handlers{Repo: propRepo}
 		proposals.Mount(api, propHandlers)
 
+		// Exchange rates
+		fxRepo := fx.NewPgRepo(store.Pool, baseCurrency)
+		fx.Mount(api, fx.Handlers{Repo: fxRepo, Base: baseCurrency})
+
 		// Ledger
 		ledgerRepo := ledger.NewPgRepo(store.Pool)
-		ledgerHandlers := ledger.Handlers{Repo: ledgerRepo}
+		ledgerHandlers := ledger.Handlers{Repo: ledgerRepo, Rates: fxRepo}
 		ledger.Mount(api, ledgerHandlers)
 
 		// Announcements
@@ -91,14 +240,236 @@ func main() {
 		announcementsHandlers := announcements.Handlers{Repo: announcementsRepo}
 		announcements.Mount(api, announcementsHandlers)
 
-		// Members
-		membersHandlers := members.Handlers{Repo: memRepo}
+		// Members. MEMBERSHIP_APPROVAL=vote makes approving an application
+		// need a passed proposal.
+		votesRepo := votes.NewPgRepo(store.Pool)
+		membersHandlers := members.Handlers{
+			Repo:         memRepo,
+			ApprovalVote: db.Env("MEMBERSHIP_APPROVAL", "direct") == "vote",
+			ProposalPassed: func(c context.Context, id int32) (bool, *int64, error) {
+				prop, err := propRepo.Get(c, id)
+				if err == proposals.ErrNotFound { return false, nil, nil }
+				if err != nil { return false, nil, err }
+				t, err := votesRepo.GetTally(c, id)
+				if err == votes.ErrNotFound { return false, prop.MemberID, nil }
+				if err != nil { return false, nil, err }
+				return t.Outcome == "passed", prop.MemberID, nil
+			},
+			// Email changes are confirmed from APP_URL/account/email.
+			Mailer:     mailer,
+			ConfirmURL: appURL + "/account/email",
+			// Deleted members cannot sign in anyway; this also drops their
+			// sessions, passkeys and API tokens.
+			Forget: func(c context.Context, id int64) error {
+				now := time.Now()
+				if _, err := sessions.Repo.RevokeAll(c, id, now); err != nil { return err }
+				keys, err := sessions.Repo.ListPasskeys(c, id)
+				if err != nil { return err }
+				for _, k := range keys {
+					if err := sessions.Repo.RevokePasskey(c, id, k.ID, now); err != nil { return err }
+				}
+				tokens, err := sessions.Repo.ListTokens(c, auth.TokenFilters{MemberID: &id})
+				if err != nil { return err }
+				by, _ := httpmw.FromContext(c)
+				for _, t := range tokens {
+					if err := sessions.Repo.RevokeToken(c, t.ID, by.MemberID, now); err != nil { return err }
+				}
+				return nil
+			},
+		}
 		members.Mount(api, membersHandlers)
 
 		// Votes
-		votesRepo := votes.NewPgRepo(store.Pool)
 		votesHandlers := votes.Handlers{Repo: votesRepo}
 		votes.Mount(api, votesHandlers)
+
+		// Dues
+		duesRepo := dues.NewPgRepo(store.Pool)
+		duesHandlers := dues.Handlers{Repo: duesRepo, Ledger: ledgerRepo}
+		dues.Mount(api, duesHandlers)
+		// Optional background posting, e.g. DUES_SCHEDULER_INTERVAL=1h
+		if iv := db.Env("DUES_SCHEDULER_INTERVAL", ""); iv != "" {
+			d, err := time.ParseDuration(iv)
+			if err != nil {
+				log.Fatal("DUES_SCHEDULER_INTERVAL:", err)
+			}
+			dues.Scheduler{Repo: duesRepo, Ledger: ledgerRepo}.Start(ctx, d)
+		}
+
+		// Patronage
+		patronageRepo := patronage.NewPgRepo(store.Pool)
+		patronageHandlers := patronage.Handlers{Repo: patronageRepo, Ledger: ledgerRepo}
+		patronage.Mount(api, patronageHandlers)
+
+		// Hours worked, timesheet approval and labor cost (approved hours feed patronage "hours" rules)
+		hoursHandlers := hours.Handlers{Repo: hours.NewPgRepo(store.Pool), Currency: baseCurrency}
+		hours.Mount(api, hoursHandlers)
+
+		// Budgets
+		budgetsRepo := budgets.NewPgRepo(store.Pool)
+		budgetsHandlers := budgets.Handlers{Repo: budgetsRepo}
+		budgets.Mount(api, budgetsHandlers)
+
+		// Financial reports
+		reportsHandlers := reports.Handlers{Repo: reports.NewPgRepo(store.Pool), Currency: baseCurrency}
+		reports.Mount(api, reportsHandlers)
+
+		// Bank statement import and reconciliation
+		bankHandlers := bank.Handlers{Repo: bank.NewPgRepo(store.Pool), Ledger: ledgerRepo}
+		bank.Mount(api, bankHandlers)
+
+		// Expense reimbursements
+		reimbursementsRepo := reimbursements.NewPgRepo(store.Pool)
+		reimbursementsHandlers := reimbursements.Handlers{Repo: reimbursementsRepo, Ledger: ledgerRepo}
+		reimbursements.Mount(api, reimbursementsHandlers)
+
+		// Member capital accounts and share purchase plans
+		capitalHandlers := capital.Handlers{Repo: capital.NewPgRepo(store.Pool), Ledger: ledgerRepo}
+		capital.Mount(api, capitalHandlers)
+
+		// Invoicing members and external customers (ORG_* fill the printed issuer block)
+		invoicesHandlers := invoices.Handlers{
+			Repo:   invoices.NewPgRepo(store.Pool),
+			Ledger: ledgerRepo,
+			Rates:  fxRepo,
+			Issuer: invoices.Issuer{
+				Name:    db.Env("ORG_NAME", "Cooperative"),
+				Address: strings.ReplaceAll(db.Env("ORG_ADDRESS", ""), `\n`, "\n"),
+				Email:   db.Env("ORG_EMAIL", ""),
+			},
+		}
+		invoices.Mount(api, invoicesHandlers)
+
+		// Payment processor webhooks; a provider only accepts deliveries once its secret is set
+		paymentProviders := map[string]payments.Provider{}
+		if s := db.Env("PAYMENTS_STRIPE_SECRET", ""); s != "" {
+			paymentProviders["stripe"] = payments.Stripe{Secret: s}
+		}
+		if s := db.Env("PAYMENTS_HMAC_SECRET", ""); s != "" {
+			paymentProviders["hmac"] = payments.HMACJSON{Secret: s}
+		}
+		paymentsHandlers := payments.Handlers{Repo: payments.NewPgRepo(store.Pool), Ledger: ledgerRepo, Rates: fxRepo, Providers: paymentProviders}
+		payments.Mount(api, paymentsHandlers)
+
+		// Attachments (local filesystem by default, ATTACHMENTS_STORE=s3 for S3-compatible storage)
+		var blobs attachments.Store = attachments.NewLocalStore(db.Env("ATTACHMENTS_DIR", "./data/attachments"))
+		if db.Env("ATTACHMENTS_STORE", "local") == "s3" {
+			blobs = attachments.NewS3Store(
+				db.Env("S3_ENDPOINT", "https://s3.amazonaws.com"),
+				db.Env("S3_BUCKET", ""),
+				db.Env("S3_REGION", "us-east-1"),
+				db.Env("S3_ACCESS_KEY", ""),
+				db.Env("S3_SECRET_KEY", ""),
+				db.Env("S3_PATH_STYLE", "false") == "true",
+			)
+		}
+		maxBytes, err := strconv.ParseInt(db.Env("ATTACHMENTS_MAX_BYTES", "0"), 10, 64)
+		if err != nil {
+			log.Fatal("ATTACHMENTS_MAX_BYTES:", err)
+		}
+		attachmentsHandlers := attachments.Handlers{
+			Repo:     attachments.NewPgRepo(store.Pool),
+			Store:    blobs,
+			MaxBytes: maxBytes,
+			Owners: map[string]attachments.OwnerExists{
+				"ledger_entry": func(c context.Context, id int64) (bool, error) {
+					if id > math.MaxInt32 {
+						return false, nil
+					}
+					_, err := ledgerRepo.Get(c, int32(id))
+					if err == ledger.ErrNotFound {
+						return false, nil
+					}
+					return err == nil, err
+				},
+				"reimbursement": func(c context.Context, id int64) (bool, error) {
+					if id > math.MaxInt32 {
+						return false, nil
+					}
+					_, err := reimbursementsRepo.Get(c, int32(id))
+					if err == reimbursements.ErrNotFound {
+						return false, nil
+					}
+					return err == nil, err
+				},
+				"member_photo": func(c context.Context, id int64) (bool, error) {
+					_, err := memRepo.GetByID(c, id)
+					if err == members.ErrNotFound {
+						return false, nil
+					}
+					return err == nil, err
+				},
+			},
+			// Receipts are as private as the reimbursement request itself;
+			// profile photos follow the member's directory visibility.
+			Readers: map[string]attachments.OwnerReadable{
+				"reimbursement": func(c context.Context, p httpmw.Principal, id int64) (bool, error) {
+					if id > math.MaxInt32 {
+						return false, nil
+					}
+					req, err := reimbursementsRepo.Get(c, int32(id))
+					if err == reimbursements.ErrNotFound {
+						return false, nil
+					}
+					if err != nil {
+						return false, err
+					}
+					return req.MemberID == p.MemberID || p.Can("reimbursements.approve"), nil
+				},
+				"member_photo": func(c context.Context, p httpmw.Principal, id int64) (bool, error) {
+					if p.MemberID == id || p.Can("members.manage") {
+						return true, nil
+					}
+					if !p.Active() {
+						return false, nil
+					}
+					prof, err := memRepo.GetProfile(c, id)
+					if err == members.ErrNotFound {
+						return false, nil
+					}
+					return err == nil && prof.Visible("photo") == members.VisibleToMembers, err
+				},
+			},
+			// Only the member an entry is recorded against, or someone who
+			// may settle entries, attaches to a ledger entry. Receipts go on
+			// a reimbursement while it awaits a decision, and only the
+			// member may upload their own photo.
+			Writers: map[string]attachments.OwnerWritable{
+				"ledger_entry": func(c context.Context, p httpmw.Principal, id int64) (bool, error) {
+					if p.Can("ledger.settle") {
+						return true, nil
+					}
+					if id > math.MaxInt32 {
+						return false, nil
+					}
+					e, err := ledgerRepo.Get(c, int32(id))
+					if err == ledger.ErrNotFound {
+						return false, nil
+					}
+					if err != nil {
+						return false, err
+					}
+					return e.MemberID != nil && int64(*e.MemberID) == p.MemberID, nil
+				},
+				"reimbursement": func(c context.Context, p httpmw.Principal, id int64) (bool, error) {
+					if id > math.MaxInt32 {
+						return false, nil
+					}
+					req, err := reimbursementsRepo.Get(c, int32(id))
+					if err == reimbursements.ErrNotFound {
+						return false, nil
+					}
+					if err != nil {
+						return false, err
+					}
+					return req.MemberID == p.MemberID && req.Status == reimbursements.StatusSubmitted, nil
+				},
+				"member_photo": func(c context.Context, p httpmw.Principal, id int64) (bool, error) {
+					return p.MemberID == id, nil
+				},
+			},
+		}
+		attachments.Mount(api, attachmentsHandlers)
 	})
 
 	addr := ":" + db.Env("PORT", "8080")
@@ -110,3 +481,65 @@ func main() {
 	}
 	log.Fatal(s.ListenAndServe())
 }
+
+// bootstrapAdmin creates an admin with email unless a member already has
+// it. Adding members needs members.manage, so the first admin has to come
+// from somewhere other than the API.
+func bootstrapAdmin(ctx context.Context, repo members.Repo, email string) {
+	_, err := repo.GetByEmail(ctx, email)
+	if err == nil {
+		return
+	}
+	if err != members.ErrNotFound {
+		log.Fatal("ADMIN_EMAIL:", err)
+	}
+	if _, err := repo.Create(ctx, email, "Admin", "admin", members.StatusActive); err != nil {
+		log.Fatal("ADMIN_EMAIL:", err)
+	}
+	log.Printf("created admin member %s from ADMIN_EMAIL", email)
+}
+
+// envDuration parses a duration setting such as "720h"; unset is zero.
+func envDuration(key string) time.Duration {
+	v := db.Env(key, "")
+	if v == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatal(key+":", err)
+	}
+	return d
+}
+
+// newMailer picks the mailer from MAIL_DRIVER: smtp (default), file or
+// log. The file and log drivers keep mail on the server, so they are only
+// allowed alongside the development header.
+func newMailer(dev bool) mail.Mailer {
+	from := db.Env("MAIL_FROM", "Cooperative <noreply@localhost>")
+	d := db.Env("MAIL_DRIVER", "smtp")
+	if d != "smtp" && !dev {
+		log.Fatal("MAIL_DRIVER: ", d, " needs AUTH_DEV_HEADER=true; use smtp")
+	}
+	switch d {
+	case "log":
+		return mail.Log{}
+	case "file":
+		return &mail.File{Dir: db.Env("MAIL_DIR", "./data/mail"), From: from}
+	case "smtp":
+		host := db.Env("SMTP_HOST", "")
+		if host == "" {
+			log.Fatal("SMTP_HOST is required for MAIL_DRIVER=smtp")
+		}
+		return mail.SMTP{
+			Host:     host,
+			Port:     db.Env("SMTP_PORT", "587"),
+			Username: db.Env("SMTP_USERNAME", ""),
+			Password: db.Env("SMTP_PASSWORD", ""),
+			From:     from,
+		}
+	default:
+		log.Fatal("MAIL_DRIVER: unknown driver ", d)
+		return nil
+	}
+}
@@ -7,6 +7,7 @@ import (
 
     "coop.tools/backend/internal/httpmw"
     "coop.tools/backend/internal/httpx"
+    "coop.tools/backend/internal/members"
     "github.com/go-chi/chi/v5"
 )
 
@@ -14,6 +15,21 @@ type Handlers struct {
 	Repo Repo
 }
 
+// readerStatus is the membership status announcements are matched
+// against: empty for guests, active for principals loaded without one.
+func readerStatus(p httpmw.Principal) string {
+    if p.MemberID <= 0 || p.Role == "guest" { return "" }
+    if p.Status == "" { return members.StatusActive }
+    return p.Status
+}
+
+// canRead reports whether the caller may see a; publishers see every
+// announcement regardless of audience.
+func canRead(r *http.Request, a Announcement) bool {
+    p, _ := httpmw.FromContext(r.Context())
+    return p.Can("announcements.publish") || a.VisibleTo(readerStatus(p))
+}
+
 func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
     var memberID *int64
     if mid := r.URL.Query().Get("member_id"); mid != "" {
@@ -31,6 +47,9 @@ func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
         return
     } else if v != nil { filters.AuthorID = v }
     if httpx.QueryBoolTrue(r, "only_unread") { filters.OnlyUnread = true }
+    p, _ := httpmw.FromContext(r.Context())
+    filters.Status = readerStatus(p)
+    filters.AllAudiences = p.Can("announcements.publish")
 
 	// Optional pagination
     if lim, off, err := httpx.ParseLimitOffset(r, 200); err != nil {
@@ -53,7 +72,8 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
     var in struct {
         Title    string `json:"title"`
         Body     string `json:"body"`
-        Priority string `json:"priority"`
+        Priority string   `json:"priority"`
+        Audience []string `json:"audience"`
     }
     if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
@@ -71,10 +91,17 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    for _, st := range in.Audience {
+        if !members.ValidStatus(st) {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "audience must list membership statuses")
+            return
+        }
+    }
+
     // Author is the authenticated admin user
     p, _ := httpmw.FromContext(r.Context())
     authorID := p.MemberID
-    a, err := h.Repo.Create(r.Context(), in.Title, in.Body, &authorID, in.Priority)
+    a, err := h.Repo.Create(r.Context(), in.Title, in.Body, &authorID, in.Priority, in.Audience)
     if err != nil {
         httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
         return
@@ -101,6 +128,7 @@ func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
         }
     }
     a, err := h.Repo.Get(r.Context(), int32(id64), memberID)
+    if err == nil && !canRead(r, a.Announcement) { err = ErrNotFound }
     if err != nil {
         if err == ErrNotFound {
             httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
@@ -126,6 +154,17 @@ func (h Handlers) MarkRead(w http.ResponseWriter, r *http.Request) {
         httpmw.WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
         return
     }
+    m := p.MemberID
+    a, err := h.Repo.Get(r.Context(), int32(id64), &m)
+    if err == nil && !canRead(r, a.Announcement) { err = ErrNotFound }
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
     if err := h.Repo.MarkAsRead(r.Context(), int32(id64), p.MemberID); err != nil {
         if err == ErrNotFound {
             httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
@@ -134,8 +173,7 @@ func (h Handlers) MarkRead(w http.ResponseWriter, r *http.Request) {
         httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to mark read")
         return
     }
-    m := p.MemberID
-    a, err := h.Repo.Get(r.Context(), int32(id64), &m)
+    a, err = h.Repo.Get(r.Context(), int32(id64), &m)
     if err != nil {
         if err == ErrNotFound {
             httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
@@ -3,6 +3,7 @@ package announcements
 import (
     "context"
     "encoding/json"
+    "fmt"
     "net/http"
     "net/http/httptest"
     "strings"
@@ -37,6 +38,9 @@ func (m *mockRepo) List(ctx context.Context, memberID *int64, filters *ListFilte
                     include = false
                 }
             }
+			if !filters.AllAudiences && !announcement.VisibleTo(filters.Status) {
+				include = false
+			}
 			// Skip date filters in mock for simplicity
 		}
 
@@ -95,7 +99,7 @@ func (m *mockRepo) Get(ctx context.Context, id int32, memberID *int64) (Announce
 	return AnnouncementWithReadStatus{}, ErrNotFound
 }
 
-func (m *mockRepo) Create(ctx context.Context, title, body string, authorID *int64, priority string) (Announcement, error) {
+func (m *mockRepo) Create(ctx context.Context, title, body string, authorID *int64, priority string, audience []string) (Announcement, error) {
 	if m.nextID == 0 {
 		m.nextID = 1
 	}
@@ -107,6 +111,7 @@ func (m *mockRepo) Create(ctx context.Context, title, body string, authorID *int
 		Body:      body,
 		AuthorID:  authorID,
 		Priority:  priority,
+		Audience:  audience,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -155,7 +160,7 @@ func (m *mockRepo) GetUnreadCount(ctx context.Context, memberID int64) (int, err
 func setupRouter(repo Repo) *chi.Mux {
     r := chi.NewRouter()
     // Attach auth middleware for tests: any X-User-Id maps to admin
-    r.Use(httpmw.WithAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+    r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
         if id <= 0 { return httpmw.Principal{}, false, nil }
         return httpmw.Principal{MemberID: id, Role: "admin"}, true, nil
     }))
@@ -510,3 +515,58 @@ func TestHandlers_GetUnreadCount(t *testing.T) {
 		t.Fatalf("expected 400, got %d", rr.Code)
 	}
 }
+
+func TestHandlers_Audience(t *testing.T) {
+    repo := &mockRepo{
+        announcements: []Announcement{
+            {ID: 1, Title: "Open day", Body: "Everyone welcome", Priority: "normal"},
+            {ID: 2, Title: "AGM papers", Body: "Members only", Priority: "normal", Audience: []string{"active"}},
+            {ID: 3, Title: "Your application", Body: "Next steps", Priority: "normal", Audience: []string{"applicant", "pending"}},
+        },
+    }
+    statuses := map[int64]string{3: "", 4: "applicant", 5: "suspended"}
+    r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        if id == 1 { return httpmw.Principal{MemberID: 1, Role: "admin"}, true, nil }
+        st, ok := statuses[id]
+        return httpmw.Principal{MemberID: id, Role: "member", Status: st}, ok, nil
+    }))
+    Mount(r, Handlers{Repo: repo})
+
+    call := func(method, path, user string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, nil)
+        if user != "" { req.Header.Set("X-User-Id", user) }
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr
+    }
+    for user, want := range map[string][]int32{"": {1}, "1": {1, 2, 3}, "3": {1, 2}, "4": {1, 3}, "5": {1}} {
+        rr := call("GET", "/announcements", user)
+        var got []AnnouncementWithReadStatus
+        _ = json.Unmarshal(rr.Body.Bytes(), &got)
+        ids := []int32{}
+        for _, a := range got { ids = append(ids, a.ID) }
+        if fmt.Sprint(ids) != fmt.Sprint(want) {
+            t.Fatalf("user %q: expected %v, got %v", user, want, ids)
+        }
+    }
+    // hidden announcements are not found, and cannot be marked read
+    if rr := call("GET", "/announcements/2", "4"); rr.Code != http.StatusNotFound {
+        t.Fatalf("expected 404 for applicant, got %d", rr.Code)
+    }
+    if rr := call("POST", "/announcements/3/read", "3"); rr.Code != http.StatusNotFound {
+        t.Fatalf("expected 404 marking another audience's announcement, got %d", rr.Code)
+    }
+    if rr := call("GET", "/announcements/3", "4"); rr.Code != http.StatusOK {
+        t.Fatalf("expected 200, got %d", rr.Code)
+    }
+
+    // audience must name membership statuses
+    req := httptest.NewRequest("POST", "/announcements", strings.NewReader(`{"title":"T","body":"B","audience":["board"]}`))
+    req.Header.Set("X-User-Id", "1")
+    rr := httptest.NewRecorder()
+    r.ServeHTTP(rr, req)
+    if rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected 400, got %d", rr.Code)
+    }
+}
@@ -0,0 +1,5 @@
+-- backend/internal/announcements/migrations/0004_audience.sql
+-- Target announcements at membership statuses, e.g. '{active}' for members
+-- in good standing or '{applicant,pending}' for applicants. Empty means
+-- everyone, as before.
+ALTER TABLE announcements ADD COLUMN IF NOT EXISTS audience TEXT[] NOT NULL DEFAULT '{}';
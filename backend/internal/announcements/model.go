@@ -8,10 +8,27 @@ type Announcement struct {
     Body      string    `json:"body"`
     AuthorID  *int64    `json:"author_id"`
     Priority  string    `json:"priority"`
+    // Audience lists the membership statuses the announcement is for;
+    // empty means everyone, guests included.
+    Audience  []string  `json:"audience"`
     CreatedAt time.Time `json:"created_at"`
     UpdatedAt time.Time `json:"updated_at"`
 }
 
+// VisibleTo reports whether a reader with membership status (empty for
+// guests) is in the announcement's audience.
+func (a Announcement) VisibleTo(status string) bool {
+    if len(a.Audience) == 0 {
+        return true
+    }
+    for _, s := range a.Audience {
+        if s == status {
+            return true
+        }
+    }
+    return false
+}
+
 // AnnouncementRead represents a record that a given member read a given announcement.
 type AnnouncementRead struct {
     AnnouncementID int32     `json:"announcement_id"`
@@ -32,6 +49,10 @@ type ListFilters struct {
     Priority   string
     AuthorID   *int64
     OnlyUnread bool
+    // Status limits the list to announcements visible to a reader with
+    // that membership status, unless AllAudiences is set.
+    Status       string
+    AllAudiences bool
     Limit      int
     Offset     int
 }
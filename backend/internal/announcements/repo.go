@@ -14,7 +14,7 @@ var ErrNotFound = errors.New("announcement not found")
 type Repo interface {
     List(ctx context.Context, memberID *int64, filters *ListFilters) ([]AnnouncementWithReadStatus, error)
     Get(ctx context.Context, id int32, memberID *int64) (AnnouncementWithReadStatus, error)
-    Create(ctx context.Context, title, body string, authorID *int64, priority string) (Announcement, error)
+    Create(ctx context.Context, title, body string, authorID *int64, priority string, audience []string) (Announcement, error)
     MarkAsRead(ctx context.Context, announcementID int32, memberID int64) error
     GetUnreadCount(ctx context.Context, memberID int64) (int, error)
 }
@@ -29,7 +29,7 @@ func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
 
 func (r *PgRepo) List(ctx context.Context, memberID *int64, filters *ListFilters) ([]AnnouncementWithReadStatus, error) {
     query := `
-SELECT a.id, a.title, a.body, a.author_id, COALESCE(a.priority,'normal'), a.created_at, a.updated_at,
+SELECT a.id, a.title, a.body, a.author_id, COALESCE(a.priority,'normal'), a.audience, a.created_at, a.updated_at,
        (ar.read_at IS NOT NULL) AS is_read, ar.read_at
 FROM announcements a`
     args := []any{}
@@ -63,6 +63,16 @@ FROM announcements a`
             where += " a.author_id=$" + itoa(argPos)
             args = append(args, *filters.AuthorID)
         }
+        if !filters.AllAudiences {
+            if where == "" {
+                where = " WHERE"
+            } else {
+                where += " AND"
+            }
+            argPos++
+            where += " (cardinality(a.audience)=0 OR $" + itoa(argPos) + "=ANY(a.audience))"
+            args = append(args, filters.Status)
+        }
         if filters.OnlyUnread && memberID != nil {
             if where == "" {
                 where = " WHERE"
@@ -100,7 +110,7 @@ FROM announcements a`
         var createdAt, updatedAt pgtype.Timestamptz
         var authorID pgtype.Int8
         var readAt pgtype.Timestamptz
-        if err := rows.Scan(&a.ID, &a.Title, &a.Body, &authorID, &a.Priority, &createdAt, &updatedAt, &a.IsRead, &readAt); err != nil {
+        if err := rows.Scan(&a.ID, &a.Title, &a.Body, &authorID, &a.Priority, &a.Audience, &createdAt, &updatedAt, &a.IsRead, &readAt); err != nil {
             return nil, err
         }
         if authorID.Valid {
@@ -122,7 +132,7 @@ FROM announcements a`
 
 func (r *PgRepo) Get(ctx context.Context, id int32, memberID *int64) (AnnouncementWithReadStatus, error) {
 	query := `
-SELECT a.id, a.title, a.body, a.author_id, COALESCE(a.priority,'normal'), a.created_at, a.updated_at,
+SELECT a.id, a.title, a.body, a.author_id, COALESCE(a.priority,'normal'), a.audience, a.created_at, a.updated_at,
        (ar.read_at IS NOT NULL) AS is_read, ar.read_at
 FROM announcements a`
 	args := []any{id}
@@ -138,7 +148,7 @@ FROM announcements a`
     var createdAt, updatedAt pgtype.Timestamptz
     var authorID pgtype.Int8
     var readAt pgtype.Timestamptz
-    err := r.Pool.QueryRow(ctx, query, args...).Scan(&a.ID, &a.Title, &a.Body, &authorID, &a.Priority, &createdAt, &updatedAt, &a.IsRead, &readAt)
+    err := r.Pool.QueryRow(ctx, query, args...).Scan(&a.ID, &a.Title, &a.Body, &authorID, &a.Priority, &a.Audience, &createdAt, &updatedAt, &a.IsRead, &readAt)
     if err != nil {
         if err == pgx.ErrNoRows {
             return AnnouncementWithReadStatus{}, ErrNotFound
@@ -160,7 +170,7 @@ FROM announcements a`
     return a, nil
 }
 
-func (r *PgRepo) Create(ctx context.Context, title, body string, authorID *int64, priority string) (Announcement, error) {
+func (r *PgRepo) Create(ctx context.Context, title, body string, authorID *int64, priority string, audience []string) (Announcement, error) {
     var a Announcement
     var createdAt, updatedAt pgtype.Timestamptz
     var authorParam pgtype.Int8
@@ -169,10 +179,10 @@ func (r *PgRepo) Create(ctx context.Context, title, body string, authorID *int64
         authorParam.Valid = true
     }
     err := r.Pool.QueryRow(ctx, `
-INSERT INTO announcements (title, body, author_id, priority)
-VALUES ($1,$2,$3,$4)
-RETURNING id, title, body, author_id, COALESCE(priority,'normal'), created_at, updated_at
-`, title, body, authorParam, priority).Scan(&a.ID, &a.Title, &a.Body, &authorParam, &a.Priority, &createdAt, &updatedAt)
+INSERT INTO announcements (title, body, author_id, priority, audience)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING id, title, body, author_id, COALESCE(priority,'normal'), audience, created_at, updated_at
+`, title, body, authorParam, priority, audience).Scan(&a.ID, &a.Title, &a.Body, &authorParam, &a.Priority, &a.Audience, &createdAt, &updatedAt)
     if err != nil {
         return Announcement{}, err
     }
@@ -206,7 +216,9 @@ SELECT COUNT(*)
 FROM announcements a
 LEFT JOIN announcement_reads ar
   ON ar.announcement_id=a.id AND ar.member_id=$1
-WHERE ar.announcement_id IS NULL`, memberID).Scan(&count)
+WHERE ar.announcement_id IS NULL
+  AND (cardinality(a.audience)=0
+       OR (SELECT status FROM members WHERE id=$1)=ANY(a.audience))`, memberID).Scan(&count)
     if err != nil {
         return 0, err
     }
@@ -8,7 +8,7 @@ import (
 func Mount(r chi.Router, h Handlers) {
     route := func(r chi.Router) {
         r.Get("/", h.List)
-        r.With(httpmw.RequireRole("admin")).Post("/", h.Create)
+        r.With(httpmw.RequirePermission("announcements.publish")).Post("/", h.Create)
         r.Get("/{id}", h.Get)
         r.With(httpmw.RequireAuth).Post("/{id}/read", h.MarkRead)
     }
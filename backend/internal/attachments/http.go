@@ -0,0 +1,408 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// DefaultMaxBytes is the upload limit when Handlers.MaxBytes is zero.
+const DefaultMaxBytes = 10 << 20
+
+// DefaultAllowedTypes are the content types accepted when
+// Handlers.AllowedTypes is nil: receipts, invoices and scans.
+var DefaultAllowedTypes = []string{
+	"application/pdf",
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"image/heic",
+	"text/plain",
+	"text/csv",
+}
+
+// OwnerExists reports whether the record an attachment would belong to exists.
+type OwnerExists func(ctx context.Context, id int64) (bool, error)
+
+// OwnerReadable reports whether p may read the attachments of a record.
+type OwnerReadable func(ctx context.Context, p httpmw.Principal, ownerID int64) (bool, error)
+
+// OwnerWritable reports whether p may attach files to a record.
+type OwnerWritable func(ctx context.Context, p httpmw.Principal, ownerID int64) (bool, error)
+
+type Handlers struct {
+	Repo  Repo
+	Store Store
+	// Owners maps each owner_type that accepts attachments, such as
+	// "ledger_entry", to its existence check.
+	Owners map[string]OwnerExists
+	// Readers restricts who may list, read and download the attachments
+	// of an owner_type; any signed-in member may for types not listed.
+	Readers map[string]OwnerReadable
+	// Writers restricts who may upload to an owner_type; any signed-in
+	// member may for types not listed.
+	Writers      map[string]OwnerWritable
+	MaxBytes     int64
+	AllowedTypes []string
+}
+
+// Upload handles POST /api/attachments?owner_type=ledger_entry&owner_id=12.
+// The file is the "file" field of a multipart form, or the raw body with
+// ?filename= and a Content-Type header.
+func (h Handlers) Upload(w http.ResponseWriter, r *http.Request) {
+	ownerType, ownerID, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	if !h.readable(w, r, ownerType, ownerID) || !h.writable(w, r, ownerType, ownerID) {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	max := h.maxBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, max+1<<20) // allow for multipart framing
+
+	data, filename, declared, err := readUpload(r, max)
+	switch {
+	case errors.Is(err, errTooLarge):
+		httpmw.WriteJSONError(w, http.StatusRequestEntityTooLarge, "file exceeds "+strconv.FormatInt(max, 10)+" bytes")
+		return
+	case err != nil:
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "file required")
+		return
+	case len(data) == 0:
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "file is empty")
+		return
+	}
+	contentType := h.contentType(data, declared)
+	if contentType == "" {
+		httpmw.WriteJSONError(w, http.StatusUnsupportedMediaType, "file type not allowed")
+		return
+	}
+	sum := sha256.Sum256(data)
+	a := Attachment{
+		OwnerType:   ownerType,
+		OwnerID:     ownerID,
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		StorageKey:  ownerType + "/" + strconv.FormatInt(ownerID, 10) + "/" + randomHex(16),
+		UploadedBy:  &p.MemberID,
+	}
+	if err := h.Store.Put(r.Context(), a.StorageKey, bytes.NewReader(data), a.Size, a.ContentType); err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "store failed")
+		return
+	}
+	out, err := h.Repo.Create(r.Context(), a)
+	if err != nil {
+		_ = h.Store.Delete(r.Context(), a.StorageKey)
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// List handles GET /api/attachments?owner_type=ledger_entry&owner_id=12
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	ownerType, ownerID, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	if !h.readable(w, r, ownerType, ownerID) {
+		return
+	}
+	items, err := h.Repo.List(r.Context(), ownerType, ownerID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Attachment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// Get handles GET /api/attachments/{id}
+func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.attachment(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(a)
+}
+
+// Download handles GET /api/attachments/{id}/download. The body is always
+// served as an attachment with sniffing disabled so uploads cannot render
+// as pages on the API origin.
+func (h Handlers) Download(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.attachment(w, r)
+	if !ok {
+		return
+	}
+	etag := `"` + a.SHA256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body, err := h.Store.Get(r.Context(), a.StorageKey)
+	if err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "file missing from store")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "read failed")
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	_, _ = io.Copy(w, body)
+}
+
+// Delete handles DELETE /api/attachments/{id}. Only the uploader or an
+// admin may delete.
+func (h Handlers) Delete(w http.ResponseWriter, r *http.Request) {
+	a, ok := h.attachment(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if !p.Can("attachments.manage") && (a.UploadedBy == nil || *a.UploadedBy != p.MemberID) {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if err := h.Repo.Delete(r.Context(), a.ID); err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "delete failed")
+		return
+	}
+	// The row is gone first so a failed blob delete leaves an orphaned file
+	// rather than a dangling record.
+	_ = h.Store.Delete(r.Context(), a.StorageKey)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handlers) owner(w http.ResponseWriter, r *http.Request) (string, int64, bool) {
+	ownerType := r.URL.Query().Get("owner_type")
+	exists, ok := h.Owners[ownerType]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid owner_type")
+		return "", 0, false
+	}
+	ownerID, err := strconv.ParseInt(r.URL.Query().Get("owner_id"), 10, 64)
+	if err != nil || ownerID <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid owner_id")
+		return "", 0, false
+	}
+	found, err := exists(r.Context(), ownerID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "owner lookup failed")
+		return "", 0, false
+	}
+	if !found {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "owner not found")
+		return "", 0, false
+	}
+	return ownerType, ownerID, true
+}
+
+func (h Handlers) attachment(w http.ResponseWriter, r *http.Request) (Attachment, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Attachment{}, false
+	}
+	a, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Attachment{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return Attachment{}, false
+	}
+	if !h.readable(w, r, a.OwnerType, a.OwnerID) {
+		return Attachment{}, false
+	}
+	return a, true
+}
+
+// readable applies Readers, answering 404 so hidden files are not
+// distinguishable from missing ones.
+func (h Handlers) readable(w http.ResponseWriter, r *http.Request, ownerType string, ownerID int64) bool {
+	check, ok := h.Readers[ownerType]
+	if !ok {
+		return true
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	allowed, err := check(r.Context(), p, ownerID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "owner lookup failed")
+		return false
+	}
+	if !allowed {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+		return false
+	}
+	return true
+}
+
+// writable checks Writers for the caller, answering 403 when the caller may
+// see the owner but not attach to it.
+func (h Handlers) writable(w http.ResponseWriter, r *http.Request, ownerType string, ownerID int64) bool {
+	check, ok := h.Writers[ownerType]
+	if !ok {
+		return true
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	allowed, err := check(r.Context(), p, ownerID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "owner lookup failed")
+		return false
+	}
+	if !allowed {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return false
+	}
+	return true
+}
+
+func (h Handlers) maxBytes() int64 {
+	if h.MaxBytes > 0 {
+		return h.MaxBytes
+	}
+	return DefaultMaxBytes
+}
+
+// contentType returns the type to store for data, or "" if not allowed.
+// The sniffed type wins; the declared type is only used when sniffing is
+// inconclusive (generic text or binary), e.g. for CSV or HEIC files.
+func (h Handlers) contentType(data []byte, declared string) string {
+	allowed := h.AllowedTypes
+	if allowed == nil {
+		allowed = DefaultAllowedTypes
+	}
+	isAllowed := func(t string) bool {
+		for _, a := range allowed {
+			if a == t {
+				return true
+			}
+		}
+		return false
+	}
+	sniffed := baseType(http.DetectContentType(data))
+	if sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		if d := baseType(declared); d != "" && isAllowed(d) && (sniffed == "application/octet-stream" || strings.HasPrefix(d, "text/")) {
+			return d
+		}
+	}
+	if isAllowed(sniffed) {
+		return sniffed
+	}
+	return ""
+}
+
+var errTooLarge = errors.New("upload too large")
+
+// readUpload returns at most max bytes of the uploaded file.
+func readUpload(r *http.Request, max int64) ([]byte, string, string, error) {
+	read := func(src io.Reader) ([]byte, error) {
+		data, err := io.ReadAll(io.LimitReader(src, max+1))
+		if err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				return nil, errTooLarge
+			}
+			return nil, err
+		}
+		if int64(len(data)) > max {
+			return nil, errTooLarge
+		}
+		return data, nil
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		data, err := read(r.Body)
+		return data, r.URL.Query().Get("filename"), r.Header.Get("Content-Type"), err
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", "", err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, "", "", errors.New("missing file field")
+			}
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				return nil, "", "", errTooLarge
+			}
+			return nil, "", "", err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		data, err := read(part)
+		return data, part.FileName(), part.Header.Get("Content-Type"), err
+	}
+}
+
+func baseType(t string) string {
+	mt, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// cleanFilename drops any path and control characters from a client-supplied
+// filename.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || strings.TrimSpace(name) == "" {
+		return "attachment"
+	}
+	if rs := []rune(name); len(rs) > 255 {
+		name = string(rs[len(rs)-255:])
+	}
+	return name
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,364 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	items []Attachment
+}
+
+func (m *mockRepo) Create(_ context.Context, a Attachment) (Attachment, error) {
+	a.ID = int64(len(m.items) + 1)
+	a.CreatedAt = time.Now()
+	m.items = append(m.items, a)
+	return a, nil
+}
+
+func (m *mockRepo) List(_ context.Context, ownerType string, ownerID int64) ([]Attachment, error) {
+	var out []Attachment
+	for _, a := range m.items {
+		if a.ID > 0 && a.OwnerType == ownerType && a.OwnerID == ownerID {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) Get(_ context.Context, id int64) (Attachment, error) {
+	for _, a := range m.items {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return Attachment{}, ErrNotFound
+}
+
+func (m *mockRepo) Delete(_ context.Context, id int64) error {
+	for i, a := range m.items {
+		if a.ID == id {
+			m.items[i].ID = 0
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// fakeS3 is a minimal stand-in for an S3-compatible server using path-style
+// addressing. It rejects requests that are not SigV4 signed for its key.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/receipts/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := strings.TrimPrefix(r.URL.Path, "/receipts/")
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if sha256Hex(body) != r.Header.Get("X-Amz-Content-Sha256") {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[key], f.types[key] = body, r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo, store Store) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role := "member"
+		if id == 1 {
+			role = "admin"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{
+		Repo:     repo,
+		Store:    store,
+		MaxBytes: 1024,
+		Owners: map[string]OwnerExists{
+			"ledger_entry": func(_ context.Context, id int64) (bool, error) { return id == 7, nil },
+			"member_photo": func(_ context.Context, id int64) (bool, error) { return id > 0, nil },
+		},
+		// Member photos are only readable by the member themselves.
+		Readers: map[string]OwnerReadable{
+			"member_photo": func(_ context.Context, p httpmw.Principal, id int64) (bool, error) { return p.MemberID == id, nil },
+		},
+		// Ledger entry 7 belongs to member 2; admins may attach to any entry.
+		Writers: map[string]OwnerWritable{
+			"ledger_entry": func(_ context.Context, p httpmw.Principal, id int64) (bool, error) {
+				return p.MemberID == 2 || p.Can("ledger.settle"), nil
+			},
+			"member_photo": func(_ context.Context, p httpmw.Principal, id int64) (bool, error) { return p.MemberID == id, nil },
+		},
+	})
+	return r
+}
+
+func multipartBody(t *testing.T, filename, contentType string, data []byte) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("note", "ignored")
+	h := make(map[string][]string)
+	h["Content-Disposition"] = []string{`form-data; name="file"; filename="` + filename + `"`}
+	h["Content-Type"] = []string{contentType}
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(data)
+	_ = mw.Close()
+	return &buf, mw.FormDataContentType()
+}
+
+var pdf = []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\ntrailer\n%%EOF\n")
+
+// ---- Tests ----
+
+func TestStores(t *testing.T) {
+	s3 := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	stores := map[string]Store{
+		"local": NewLocalStore(t.TempDir()),
+		"s3":    NewS3Store(srv.URL, "receipts", "", "AKID", "secret", true),
+	}
+	ctx := context.Background()
+	for name, st := range stores {
+		if err := st.Put(ctx, "ledger_entry/7/abc", bytes.NewReader(pdf), int64(len(pdf)), "application/pdf"); err != nil {
+			t.Fatalf("%s: put: %v", name, err)
+		}
+		rc, err := st.Get(ctx, "ledger_entry/7/abc")
+		if err != nil {
+			t.Fatalf("%s: get: %v", name, err)
+		}
+		got, _ := io.ReadAll(rc)
+		rc.Close()
+		if !bytes.Equal(got, pdf) {
+			t.Errorf("%s: round trip mismatch", name)
+		}
+		if err := st.Delete(ctx, "ledger_entry/7/abc"); err != nil {
+			t.Fatalf("%s: delete: %v", name, err)
+		}
+		if _, err := st.Get(ctx, "ledger_entry/7/abc"); err != ErrBlobNotFound {
+			t.Errorf("%s: expected ErrBlobNotFound, got %v", name, err)
+		}
+	}
+	if s3.types["ledger_entry/7/abc"] != "application/pdf" {
+		t.Errorf("expected content type to reach s3, got %q", s3.types["ledger_entry/7/abc"])
+	}
+
+	bad := NewS3Store(srv.URL, "receipts", "", "WRONG", "secret", true)
+	if err := bad.Put(ctx, "k", bytes.NewReader(pdf), int64(len(pdf)), "application/pdf"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected 403 error, got %v", err)
+	}
+	if err := stores["local"].Put(ctx, "../escape", bytes.NewReader(pdf), 1, ""); err == nil {
+		t.Error("expected local store to reject keys outside its directory")
+	}
+}
+
+func TestHandlers_UploadDownload(t *testing.T) {
+	repo := &mockRepo{}
+	store := NewLocalStore(t.TempDir())
+	r := setupRouter(repo, store)
+
+	do := func(method, path string, body io.Reader, user, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		if user != "" {
+			req.Header.Set("X-User-Id", user)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// guests cannot upload
+	if rr := do("POST", "/attachments?owner_type=ledger_entry&owner_id=7", bytes.NewReader(pdf), "", "application/pdf"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+
+	body, ct := multipartBody(t, `receipt \"march\".pdf`, "application/octet-stream", pdf)
+	rr := do("POST", "/attachments?owner_type=ledger_entry&owner_id=7", body, "2", ct)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var a Attachment
+	_ = json.Unmarshal(rr.Body.Bytes(), &a)
+	if a.ContentType != "application/pdf" || a.Size != int64(len(pdf)) || a.Filename != `receipt "march".pdf` || a.SHA256 != sha256Hex(pdf) {
+		t.Fatalf("unexpected attachment: %+v", a)
+	}
+
+	// raw body, CSV is only recognizable by its declared type
+	rr = do("POST", "/attachments?owner_type=ledger_entry&owner_id=7&filename=..%5C..%5Citems.csv", strings.NewReader("a,b\n1,2\n"), "2", "text/csv")
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"filename":"items.csv","content_type":"text/csv"`) {
+		t.Fatalf("expected csv upload, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	for _, tc := range []struct {
+		path, ctype string
+		body        []byte
+		want        int
+	}{
+		{"/attachments?owner_type=ledger_entry&owner_id=7", "text/html", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		{"/attachments?owner_type=ledger_entry&owner_id=7", "application/pdf", bytes.Repeat([]byte("x"), 2048), http.StatusRequestEntityTooLarge},
+		{"/attachments?owner_type=ledger_entry&owner_id=7", "application/pdf", nil, http.StatusBadRequest},
+		{"/attachments?owner_type=ledger_entry&owner_id=8", "application/pdf", pdf, http.StatusNotFound},
+		{"/attachments?owner_type=proposal&owner_id=7", "application/pdf", pdf, http.StatusBadRequest},
+	} {
+		if rr := do("POST", tc.path, bytes.NewReader(tc.body), "2", tc.ctype); rr.Code != tc.want {
+			t.Errorf("%s (%s): expected %d, got %d", tc.path, tc.ctype, tc.want, rr.Code)
+		}
+	}
+
+	rr = do("GET", "/attachments?owner_type=ledger_entry&owner_id=7", nil, "3", "")
+	var list []Attachment
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(list))
+	}
+
+	rr = do("GET", "/attachments/1/download", nil, "3", "")
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), pdf) {
+		t.Fatalf("unexpected download %d", rr.Code)
+	}
+	if rr.Header().Get("Content-Type") != "application/pdf" || rr.Header().Get("X-Content-Type-Options") != "nosniff" ||
+		rr.Header().Get("Content-Disposition") != `attachment; filename="receipt \"march\".pdf"` || rr.Header().Get("ETag") != `"`+a.SHA256+`"` {
+		t.Errorf("unexpected download headers: %v", rr.Header())
+	}
+	req := httptest.NewRequest("GET", "/attachments/1/download", nil)
+	req.Header.Set("X-User-Id", "3")
+	req.Header.Set("If-None-Match", `"`+a.SHA256+`"`)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+	if rr := do("GET", "/attachments/1/download", nil, "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for guest download, got %d", rr.Code)
+	}
+
+	// only the uploader or an admin may delete
+	if rr := do("DELETE", "/attachments/1", nil, "3", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/attachments/1", nil, "2", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if _, err := store.Get(context.Background(), repo.items[0].StorageKey); err != ErrBlobNotFound {
+		t.Errorf("expected blob to be deleted, got %v", err)
+	}
+	if rr := do("GET", "/attachments/1", nil, "2", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", rr.Code)
+	}
+	if rr := do("DELETE", "/attachments/2", nil, "1", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected admin delete to succeed, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_Readers(t *testing.T) {
+	repo := &mockRepo{}
+	r := setupRouter(repo, NewLocalStore(t.TempDir()))
+	do := func(method, path, user string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("X-User-Id", user)
+		req.Header.Set("Content-Type", "application/pdf")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	rr := do("POST", "/attachments?owner_type=member_photo&owner_id=2&filename=me.pdf", "2", bytes.NewReader(pdf))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var a Attachment
+	_ = json.Unmarshal(rr.Body.Bytes(), &a)
+	id := strconv.FormatInt(a.ID, 10)
+	for _, path := range []string{"/attachments?owner_type=member_photo&owner_id=2", "/attachments/" + id, "/attachments/" + id + "/download"} {
+		if rr := do("GET", path, "2", nil); rr.Code != http.StatusOK {
+			t.Fatalf("%s by owner: expected 200, got %d", path, rr.Code)
+		}
+		if rr := do("GET", path, "3", nil); rr.Code != http.StatusNotFound {
+			t.Fatalf("%s by another member: expected 404, got %d", path, rr.Code)
+		}
+	}
+	if rr := do("DELETE", "/attachments/"+id, "3", nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_Writers(t *testing.T) {
+	repo := &mockRepo{}
+	r := setupRouter(repo, NewLocalStore(t.TempDir()))
+	do := func(path, user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewReader(pdf))
+		req.Header.Set("X-User-Id", user)
+		req.Header.Set("Content-Type", "application/pdf")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	cases := []struct {
+		path, user string
+		want       int
+	}{
+		{"/attachments?owner_type=ledger_entry&owner_id=7&filename=r.pdf", "2", http.StatusCreated},
+		{"/attachments?owner_type=ledger_entry&owner_id=7&filename=r.pdf", "3", http.StatusForbidden},
+		{"/attachments?owner_type=ledger_entry&owner_id=7&filename=r.pdf", "1", http.StatusCreated},
+		{"/attachments?owner_type=member_photo&owner_id=3&filename=me.pdf", "3", http.StatusCreated},
+		{"/attachments?owner_type=member_photo&owner_id=3&filename=me.pdf", "2", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		if rr := do(tc.path, tc.user); rr.Code != tc.want {
+			t.Errorf("%s as %s: expected %d, got %d (%s)", tc.path, tc.user, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+	if len(repo.items) != 3 {
+		t.Errorf("expected 3 stored attachments, got %d", len(repo.items))
+	}
+}
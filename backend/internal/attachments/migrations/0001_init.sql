@@ -0,0 +1,15 @@
+-- backend/internal/attachments/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS attachments (
+  id BIGSERIAL PRIMARY KEY,
+  owner_type TEXT NOT NULL,
+  owner_id BIGINT NOT NULL,
+  filename TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size_bytes BIGINT NOT NULL CHECK (size_bytes > 0),
+  sha256 TEXT NOT NULL,
+  storage_key TEXT NOT NULL UNIQUE,
+  uploaded_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS attachments_owner_idx ON attachments (owner_type, owner_id);
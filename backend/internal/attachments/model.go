@@ -0,0 +1,18 @@
+package attachments
+
+import "time"
+
+// Attachment is a file linked to a record in another domain, identified by
+// OwnerType (e.g. "ledger_entry") and OwnerID.
+type Attachment struct {
+	ID          int64     `json:"id"`
+	OwnerType   string    `json:"owner_type"`
+	OwnerID     int64     `json:"owner_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	StorageKey  string    `json:"-"`
+	UploadedBy  *int64    `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,84 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("attachment not found")
+
+type Repo interface {
+	Create(ctx context.Context, a Attachment) (Attachment, error)
+	List(ctx context.Context, ownerType string, ownerID int64) ([]Attachment, error)
+	Get(ctx context.Context, id int64) (Attachment, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const columns = `id, owner_type, owner_id, filename, content_type, size_bytes, sha256, storage_key, uploaded_by, created_at`
+
+func (r *PgRepo) Create(ctx context.Context, a Attachment) (Attachment, error) {
+	return scan(r.Pool.QueryRow(ctx, `
+INSERT INTO attachments (owner_type, owner_id, filename, content_type, size_bytes, sha256, storage_key, uploaded_by)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+RETURNING `+columns, a.OwnerType, a.OwnerID, a.Filename, a.ContentType, a.Size, a.SHA256, a.StorageKey, a.UploadedBy))
+}
+
+func (r *PgRepo) List(ctx context.Context, ownerType string, ownerID int64) ([]Attachment, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+columns+` FROM attachments WHERE owner_type=$1 AND owner_id=$2 ORDER BY id`, ownerType, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Attachment
+	for rows.Next() {
+		a, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int64) (Attachment, error) {
+	a, err := scan(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM attachments WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Attachment{}, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PgRepo) Delete(ctx context.Context, id int64) error {
+	tag, err := r.Pool.Exec(ctx, `DELETE FROM attachments WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scan(row pgx.Row) (Attachment, error) {
+	var a Attachment
+	var uploadedBy pgtype.Int8
+	if err := row.Scan(&a.ID, &a.OwnerType, &a.OwnerID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.StorageKey, &uploadedBy, &a.CreatedAt); err != nil {
+		return Attachment{}, err
+	}
+	if uploadedBy.Valid {
+		a.UploadedBy = &uploadedBy.Int64
+	}
+	return a, nil
+}
@@ -0,0 +1,18 @@
+package attachments
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequireAuth)
+		r.Get("/", h.List)
+		r.Post("/", h.Upload)
+		r.Get("/{id}", h.Get)
+		r.Get("/{id}/download", h.Download)
+		r.Delete("/{id}", h.Delete)
+	}
+	r.Route("/attachments", route)
+}
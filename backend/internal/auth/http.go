@@ -0,0 +1,750 @@
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handlers struct {
+	Sessions *Manager
+	// Links enables email magic-link sign-in; nil leaves it unmounted.
+	Links *MagicLinks
+	// Passkeys enables WebAuthn passkeys; nil leaves them unmounted.
+	Passkeys *Passkeys
+	// AllowDevLogin mounts POST /auth/dev/login, which starts a session for any
+	// member id without a credential. Development only.
+	AllowDevLogin bool
+}
+
+// Me is the signed-in member as returned by GET /api/auth/session.
+type Me struct {
+	MemberID    int64    `json:"member_id"`
+	Role        string   `json:"role"`
+	Status      string   `json:"status,omitempty"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+	Email       string   `json:"email"`
+	Name        string   `json:"name"`
+	Via         string   `json:"via"`
+	Session     *Session `json:"session"`
+}
+
+// Current handles GET /api/auth/session.
+func (h Handlers) Current(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	me := Me{MemberID: p.MemberID, Role: p.Role, Status: p.Status, Roles: p.RoleNames(), Permissions: p.GrantedPermissions(), Email: p.Email, Name: p.Name, Via: p.Via}
+	if p.SessionID > 0 {
+		s, err := h.Sessions.Repo.Get(r.Context(), p.SessionID)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load session")
+			return
+		}
+		s.Current = true
+		me.Session = &s
+	}
+	writeJSON(w, http.StatusOK, me)
+}
+
+// Refresh handles POST /api/auth/session/refresh. It rotates the current
+// session's token; the old one keeps working for a minute.
+func (h Handlers) Refresh(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	if p.SessionID == 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "not signed in with a session")
+		return
+	}
+	iss, err := h.Sessions.Refresh(r.Context(), w, p.SessionID)
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusConflict, "session was rotated or ended; retry with the new token")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to refresh session")
+		return
+	}
+	writeJSON(w, http.StatusOK, iss)
+}
+
+// Logout handles POST /api/auth/logout, ending the current session.
+func (h Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	if p.SessionID > 0 {
+		err := h.Sessions.Repo.Revoke(r.Context(), p.MemberID, p.SessionID, h.Sessions.now())
+		if err != nil && err != ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to log out")
+			return
+		}
+		h.audit(r, LoginEvent{Event: EventLogout, MemberID: &p.MemberID, Email: p.Email, SessionID: &p.SessionID})
+	}
+	h.Sessions.ClearCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll handles POST /api/auth/logout-all, ending every session of the
+// signed-in member, this one included.
+func (h Handlers) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	n, err := h.Sessions.Repo.RevokeAll(r.Context(), p.MemberID, h.Sessions.now())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to log out")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventLogoutAll, MemberID: &p.MemberID, Email: p.Email, Detail: strconv.FormatInt(n, 10) + " sessions"})
+	h.Sessions.ClearCookie(w)
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// ListSessions handles GET /api/auth/sessions: the signed-in member's
+// active sessions, most recently used first.
+func (h Handlers) ListSessions(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	now := h.Sessions.now()
+	all, err := h.Sessions.Repo.ListActive(r.Context(), p.MemberID, now)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+	out := []Session{}
+	for _, s := range all {
+		if s.Active(now, h.Sessions.idle()) {
+			s.Current = s.ID == p.SessionID
+			out = append(out, s)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/{id} for one of the
+// signed-in member's own sessions.
+func (h Handlers) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if err := h.Sessions.Repo.Revoke(r.Context(), p.MemberID, id, h.Sessions.now()); err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "session not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventSessionRevoked, MemberID: &p.MemberID, Email: p.Email, SessionID: &id})
+	if id == p.SessionID {
+		h.Sessions.ClearCookie(w)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type devLoginReq struct {
+	MemberID int64 `json:"member_id"`
+}
+
+// DevLogin handles POST /api/auth/dev/login, mounted only when AllowDevLogin is set.
+func (h Handlers) DevLogin(w http.ResponseWriter, r *http.Request) {
+	var req devLoginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.MemberID <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member_id required")
+		return
+	}
+	m, found, err := h.Sessions.Members(r.Context(), req.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load member")
+		return
+	}
+	if !found {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "member not found")
+		return
+	}
+	iss, err := h.Sessions.Issue(r.Context(), w, r, req.MemberID, MethodDev)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to start session")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventLoginSucceeded, MemberID: &req.MemberID, Email: m.Email, Method: MethodDev, SessionID: &iss.Session.ID})
+	writeJSON(w, http.StatusCreated, iss)
+}
+
+type linkReq struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+}
+
+// RequestLink handles POST /api/auth/magic-link. It always answers 202 for
+// a well-formed address so the response does not reveal who is a member;
+// only members are sent a link. Too many requests for one address or from
+// one client within the window get 429.
+func (h Handlers) RequestLink(w http.ResponseWriter, r *http.Request) {
+	var req linkReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Purpose == "" {
+		req.Purpose = PurposeLogin
+	}
+	if req.Purpose != PurposeLogin && req.Purpose != PurposeRecovery {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "purpose must be login or recovery")
+		return
+	}
+	email := normalizeEmail(req.Email)
+	if len(email) < 3 || len(email) > 254 || !strings.Contains(email, "@") || strings.ContainsAny(email, " \r\n") {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "valid email required")
+		return
+	}
+	ctx, l, now := r.Context(), h.Links, h.Sessions.now()
+	byEmail, byIP, err := h.Sessions.Repo.CountEvents(ctx, EventLinkRequested, email, clientIP(r), now.Add(-l.window()))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to check rate limit")
+		return
+	}
+	if byEmail >= l.perEmail() || byIP >= l.perIP() {
+		h.audit(r, LoginEvent{Event: EventLinkRateLimited, Email: email, Method: MethodMagicLink})
+		w.Header().Set("Retry-After", strconv.Itoa(int(l.window().Seconds())))
+		httpmw.WriteJSONError(w, http.StatusTooManyRequests, "too many sign-in link requests; try again later")
+		return
+	}
+	ev := LoginEvent{Event: EventLinkRequested, Email: email, Method: MethodMagicLink}
+	if req.Purpose == PurposeRecovery {
+		ev.Detail = PurposeRecovery
+	}
+	m, found, err := l.FindMember(ctx, strings.TrimSpace(req.Email))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to look up member")
+		return
+	}
+	var token string
+	if found {
+		var hash []byte
+		if token, hash, err = l.newToken(); err == nil {
+			_, err = h.Sessions.Repo.CreateMagicLink(ctx, MagicLink{MemberID: m.MemberID, Purpose: req.Purpose, IP: clientIP(r), CreatedAt: now, ExpiresAt: now.Add(l.ttl())}, hash)
+		}
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to create sign-in link")
+			return
+		}
+		ev.MemberID = &m.MemberID
+	} else {
+		ev.Detail = "unknown email"
+	}
+	// Recorded before sending: the rate limit counts these events.
+	if err := h.record(r, ev); err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to record login event")
+		return
+	}
+	if found {
+		if err := l.Mailer.Send(ctx, l.message(m.Email, token, req.Purpose)); err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to send sign-in link")
+			return
+		}
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "If that address belongs to a member, a sign-in link is on its way."})
+}
+
+type redeemReq struct {
+	Token string `json:"token"`
+}
+
+// RedeemLink handles POST /api/auth/magic-link/redeem: a valid, unused,
+// unexpired link starts a session and is used up. Sessions from recovery
+// links have method "recovery", telling the app to offer a new passkey.
+func (h Handlers) RedeemLink(w http.ResponseWriter, r *http.Request) {
+	var req redeemReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "token required")
+		return
+	}
+	fail := func(detail string, memberID *int64) {
+		h.audit(r, LoginEvent{Event: EventLoginFailed, MemberID: memberID, Method: MethodMagicLink, Detail: detail})
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid or expired sign-in link")
+	}
+	if !h.Links.verify(req.Token) {
+		fail("bad signature", nil)
+		return
+	}
+	ctx := r.Context()
+	link, err := h.Sessions.Repo.UseMagicLink(ctx, hashToken(req.Token), h.Sessions.now())
+	switch err {
+	case nil:
+	case ErrLinkInvalid:
+		fail("unknown link", nil)
+		return
+	case ErrLinkUsed:
+		fail("link already used", nil)
+		return
+	case ErrLinkExpired:
+		fail("link expired", nil)
+		return
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to redeem sign-in link")
+		return
+	}
+	m, found, err := h.Sessions.Members(ctx, link.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load member")
+		return
+	}
+	if !found {
+		fail("member not found", &link.MemberID)
+		return
+	}
+	method := MethodMagicLink
+	if link.Purpose == PurposeRecovery {
+		method = MethodRecovery
+	}
+	iss, err := h.Sessions.Issue(ctx, w, r, link.MemberID, method)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to start session")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventLoginSucceeded, MemberID: &link.MemberID, Email: m.Email, Method: method, SessionID: &iss.Session.ID})
+	writeJSON(w, http.StatusCreated, iss)
+}
+
+// PasskeyRegisterBegin handles POST /api/auth/passkeys/register/begin. It
+// needs a recent sign-in and returns creation options for
+// navigator.credentials.create.
+func (h Handlers) PasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	ctx, now := r.Context(), h.Sessions.now()
+	if p.Via != "header" {
+		s, err := h.Sessions.Repo.Get(ctx, p.SessionID)
+		if err != nil && err != ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load session")
+			return
+		}
+		if err == ErrNotFound || now.Sub(s.CreatedAt) > h.Passkeys.freshSignIn() {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "sign in again to add a passkey")
+			return
+		}
+	}
+	existing, err := h.Sessions.Repo.ListPasskeys(ctx, p.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list passkeys")
+		return
+	}
+	challenge, err := h.Passkeys.newChallenge(ctx, h.Sessions.Repo, CeremonyRegister, &p.MemberID, now)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to start registration")
+		return
+	}
+	var o CreationOptions
+	o.Challenge = challenge
+	o.RP.ID, o.RP.Name = h.Passkeys.RPID, h.Passkeys.RPName
+	o.User.ID, o.User.Name, o.User.DisplayName = memberHandle(p.MemberID), p.Email, p.Name
+	if o.User.DisplayName == "" {
+		o.User.DisplayName = p.Email
+	}
+	for _, alg := range []int64{AlgES256, AlgEdDSA, AlgRS256} {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, credentialParam{Type: "public-key", Alg: alg})
+	}
+	o.Timeout = h.Passkeys.timeout().Milliseconds()
+	o.Attestation = "none"
+	o.ExcludeCredentials = []credentialDescriptor{}
+	for _, pk := range existing {
+		o.ExcludeCredentials = append(o.ExcludeCredentials, credentialDescriptor{Type: "public-key", ID: pk.CredentialID, Transports: pk.Transports})
+	}
+	o.AuthenticatorSelection.ResidentKey = "required"
+	o.AuthenticatorSelection.RequireResidentKey = true
+	o.AuthenticatorSelection.UserVerification = "required"
+	writeJSON(w, http.StatusOK, map[string]CreationOptions{"publicKey": o})
+}
+
+type registerReq struct {
+	Name       string               `json:"name"`
+	Credential RegistrationResponse `json:"credential"`
+}
+
+// PasskeyRegisterFinish handles POST /api/auth/passkeys/register/finish
+// with the authenticator's response and a name for the passkey.
+func (h Handlers) PasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	var req registerReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "Passkey"
+	}
+	if len(req.Name) > 100 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name must be at most 100 characters")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	ctx := r.Context()
+	pk, err := h.Passkeys.verifyRegistration(ctx, h.Sessions.Repo, p.MemberID, req.Credential, h.Sessions.now())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "passkey registration failed: "+err.Error())
+		return
+	}
+	pk.Name = req.Name
+	pk, err = h.Sessions.Repo.CreatePasskey(ctx, pk)
+	if err == ErrDuplicate {
+		httpmw.WriteJSONError(w, http.StatusConflict, "passkey already registered")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to save passkey")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventPasskeyAdded, MemberID: &p.MemberID, Email: p.Email, Method: MethodPasskey, Detail: pk.Name, SessionID: sessionRef(p)})
+	writeJSON(w, http.StatusCreated, pk)
+}
+
+// PasskeyLoginBegin handles POST /api/auth/passkeys/login/begin, returning
+// request options for navigator.credentials.get.
+func (h Handlers) PasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	challenge, err := h.Passkeys.newChallenge(r.Context(), h.Sessions.Repo, CeremonyLogin, nil, h.Sessions.now())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	o := RequestOptions{
+		Challenge:        challenge,
+		RPID:             h.Passkeys.RPID,
+		Timeout:          h.Passkeys.timeout().Milliseconds(),
+		UserVerification: "required",
+		AllowCredentials: []credentialDescriptor{},
+	}
+	writeJSON(w, http.StatusOK, map[string]RequestOptions{"publicKey": o})
+}
+
+type assertionReq struct {
+	Credential AssertionResponse `json:"credential"`
+}
+
+// PasskeyLoginFinish handles POST /api/auth/passkeys/login/finish. A valid
+// assertion starts a session.
+func (h Handlers) PasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req assertionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	ctx, now := r.Context(), h.Sessions.now()
+	pk, err := h.Passkeys.verifyAssertion(ctx, h.Sessions.Repo, req.Credential, now)
+	if err != nil {
+		var memberID *int64
+		if pk.MemberID > 0 {
+			memberID = &pk.MemberID
+		}
+		h.audit(r, LoginEvent{Event: EventLoginFailed, MemberID: memberID, Method: MethodPasskey, Detail: err.Error()})
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "passkey sign-in failed")
+		return
+	}
+	m, found, err := h.Sessions.Members(ctx, pk.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load member")
+		return
+	}
+	if !found {
+		h.audit(r, LoginEvent{Event: EventLoginFailed, MemberID: &pk.MemberID, Method: MethodPasskey, Detail: "member not found"})
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "passkey sign-in failed")
+		return
+	}
+	if err := h.Sessions.Repo.UsePasskey(ctx, pk.ID, pk.SignCount, now); err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to update passkey")
+		return
+	}
+	iss, err := h.Sessions.Issue(ctx, w, r, pk.MemberID, MethodPasskey)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to start session")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventLoginSucceeded, MemberID: &pk.MemberID, Email: m.Email, Method: MethodPasskey, Detail: pk.Name, SessionID: &iss.Session.ID})
+	writeJSON(w, http.StatusCreated, iss)
+}
+
+// ListPasskeys handles GET /api/auth/passkeys: the member's active passkeys.
+func (h Handlers) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	items, err := h.Sessions.Repo.ListPasskeys(r.Context(), p.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list passkeys")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type renameReq struct {
+	Name string `json:"name"`
+}
+
+// RenamePasskey handles PUT /api/auth/passkeys/{id} with {"name":...}.
+func (h Handlers) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	var req renameReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	pk, err := h.Sessions.Repo.RenamePasskey(r.Context(), p.MemberID, id, req.Name)
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "passkey not found")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to rename passkey")
+		return
+	}
+	writeJSON(w, http.StatusOK, pk)
+}
+
+// RevokePasskey handles DELETE /api/auth/passkeys/{id}. The credential can
+// no longer sign in; sessions it started are left to the member to end.
+func (h Handlers) RevokePasskey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if err := h.Sessions.Repo.RevokePasskey(r.Context(), p.MemberID, id, h.Sessions.now()); err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "passkey not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to revoke passkey")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventPasskeyRevoked, MemberID: &p.MemberID, Email: p.Email, Method: MethodPasskey, Detail: strconv.FormatInt(id, 10), SessionID: sessionRef(p)})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type tokenReq struct {
+	Name          string   `json:"name"`
+	Kind          string   `json:"kind"`
+	MemberID      *int64   `json:"member_id"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreatedToken is a new API token with the secret, shown only here.
+type CreatedToken struct {
+	Token    string   `json:"token"`
+	APIToken APIToken `json:"api_token"`
+}
+
+// CreateToken handles POST /api/auth/tokens (tokens.manage). Personal
+// tokens need member_id; service tokens act as member_id or, by default,
+// the caller. The caller must hold every permission of the token's owner.
+func (h Handlers) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	}
+	switch req.Kind {
+	case TokenPersonal:
+		if req.MemberID == nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "member_id required for personal tokens")
+			return
+		}
+	case TokenService:
+		if req.MemberID == nil {
+			req.MemberID = &p.MemberID
+		}
+	default:
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "kind must be personal or service")
+		return
+	}
+	scopes, bad := normalizeScopes(req.Scopes)
+	if bad != "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "unknown scope "+strconv.Quote(bad))
+		return
+	}
+	if len(scopes) == 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "at least one scope required")
+		return
+	}
+	// Tokens cannot reach /api/auth today, but a token must never mint one
+	// that reaches further than itself.
+	for _, s := range scopes {
+		if !p.HasScope(s) {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "your token lacks scope "+strconv.Quote(s))
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > MaxTokenDays {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "expires_in_days must be between 1 and "+strconv.Itoa(MaxTokenDays))
+		return
+	}
+	ctx := r.Context()
+	owner, found, err := h.Sessions.Members(ctx, *req.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load member")
+		return
+	}
+	if !found {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member not found")
+		return
+	}
+	// A token acts with its owner's permissions, so callers may only mint
+	// tokens for members whose permissions they hold themselves.
+	for _, perm := range owner.GrantedPermissions() {
+		if !p.Can(perm) {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "you do not hold permission "+strconv.Quote(perm))
+			return
+		}
+	}
+	token, hash, prefix, err := newAPIToken()
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	now := h.Sessions.now()
+	t, err := h.Sessions.Repo.CreateToken(ctx, APIToken{
+		Name: req.Name, Kind: req.Kind, MemberID: *req.MemberID, Prefix: prefix, Scopes: scopes,
+		ExpiresAt: tokenExpiry(now, req.ExpiresInDays), CreatedBy: &p.MemberID, CreatedAt: now,
+	}, hash)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to create token")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventTokenCreated, MemberID: &t.MemberID, Email: owner.Email, Detail: t.Kind + " token " + strconv.FormatInt(t.ID, 10) + " " + strings.Join(t.Scopes, " ")})
+	writeJSON(w, http.StatusCreated, CreatedToken{Token: token, APIToken: t})
+}
+
+// ListTokens handles GET /api/auth/tokens (admin): active tokens, newest
+// first. Filters: member_id, include_revoked=true.
+func (h Handlers) ListTokens(w http.ResponseWriter, r *http.Request) {
+	id, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	items, err := h.Sessions.Repo.ListTokens(r.Context(), TokenFilters{MemberID: id, IncludeRevoked: httpx.QueryBoolTrue(r, "include_revoked")})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list tokens")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// GetToken handles GET /api/auth/tokens/{id} (admin).
+func (h Handlers) GetToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	t, err := h.Sessions.Repo.GetToken(r.Context(), id)
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load token")
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// RevokeToken handles DELETE /api/auth/tokens/{id} (admin). It takes
+// effect on the token's next request.
+func (h Handlers) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	ctx := r.Context()
+	t, err := h.Sessions.Repo.GetToken(ctx, id)
+	if err == nil {
+		err = h.Sessions.Repo.RevokeToken(ctx, id, p.MemberID, h.Sessions.now())
+	}
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to revoke token")
+		return
+	}
+	h.audit(r, LoginEvent{Event: EventTokenRevoked, MemberID: &t.MemberID, Detail: t.Kind + " token " + strconv.FormatInt(t.ID, 10)})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListEvents handles GET /api/auth/login-events (admin), newest first.
+// Filters: member_id, email, event.
+func (h Handlers) ListEvents(w http.ResponseWriter, r *http.Request) {
+	f := EventFilters{Email: normalizeEmail(r.URL.Query().Get("email")), Event: r.URL.Query().Get("event")}
+	if f.Event != "" && !ValidEvent(f.Event) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid event")
+		return
+	}
+	id, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	f.MemberID = id
+	lim, off, err := httpx.ParseLimitOffset(r, 500)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Sessions.Repo.ListEvents(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list login events")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// sessionRef is the principal's session id for an audit event, if any.
+func sessionRef(p httpmw.Principal) *int64 {
+	if p.SessionID == 0 {
+		return nil
+	}
+	return &p.SessionID
+}
+
+// record adds e to the login audit log with the request's client details.
+func (h Handlers) record(r *http.Request, e LoginEvent) error {
+	e.Email = normalizeEmail(e.Email)
+	e.IP, e.UserAgent, e.CreatedAt = clientIP(r), truncate(r.UserAgent(), 300), h.Sessions.now()
+	return h.Sessions.Repo.RecordEvent(r.Context(), e)
+}
+
+// audit records e after the outcome it describes has happened; a failure
+// is logged rather than undoing the sign-in or logout.
+func (h Handlers) audit(r *http.Request, e LoginEvent) {
+	if err := h.record(r, e); err != nil {
+		log.Printf("auth: record %s event: %v", e.Event, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
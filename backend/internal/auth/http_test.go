@@ -0,0 +1,1187 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/mail"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockSession struct {
+	Session
+	hash, prev []byte
+}
+
+type mockLink struct {
+	MagicLink
+	hash []byte
+}
+
+type mockRepo struct {
+	sessions   []*mockSession
+	links      []*mockLink
+	events     []LoginEvent
+	challenges []*mockChallenge
+	passkeys   []*Passkey
+	tokens     []*mockToken
+}
+
+type mockToken struct {
+	APIToken
+	hash []byte
+}
+
+type mockChallenge struct {
+	Challenge
+	used bool
+}
+
+func (m *mockRepo) Create(_ context.Context, s Session, hash []byte) (Session, error) {
+	s.ID = int64(len(m.sessions) + 1)
+	s.TokenIssuedAt, s.LastSeenAt = s.CreatedAt, s.CreatedAt
+	m.sessions = append(m.sessions, &mockSession{Session: s, hash: hash})
+	return s, nil
+}
+
+func (m *mockRepo) Get(_ context.Context, id int64) (Session, error) {
+	for _, s := range m.sessions {
+		if s.ID == id {
+			return s.Session, nil
+		}
+	}
+	return Session{}, ErrNotFound
+}
+
+func (m *mockRepo) ByToken(_ context.Context, hash []byte, graceSince time.Time) (Session, bool, error) {
+	for _, s := range m.sessions {
+		if bytes.Equal(s.hash, hash) {
+			return s.Session, false, nil
+		}
+		if bytes.Equal(s.prev, hash) && s.TokenIssuedAt.After(graceSince) {
+			return s.Session, true, nil
+		}
+	}
+	return Session{}, false, ErrNotFound
+}
+
+func (m *mockRepo) Touch(_ context.Context, id int64, at time.Time) error {
+	for _, s := range m.sessions {
+		if s.ID == id && s.LastSeenAt.Before(at) {
+			s.LastSeenAt = at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) Rotate(_ context.Context, id int64, issuedAt time.Time, hash []byte, at time.Time) (bool, error) {
+	for _, s := range m.sessions {
+		if s.ID == id && s.TokenIssuedAt.Equal(issuedAt) && s.RevokedAt == nil {
+			s.prev, s.hash = s.hash, hash
+			s.TokenIssuedAt, s.LastSeenAt = at, at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepo) Revoke(_ context.Context, memberID, id int64, at time.Time) error {
+	for _, s := range m.sessions {
+		if s.ID == id && s.MemberID == memberID && s.RevokedAt == nil {
+			s.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepo) RevokeAll(_ context.Context, memberID int64, at time.Time) (int64, error) {
+	var n int64
+	for _, s := range m.sessions {
+		if s.MemberID == memberID && s.RevokedAt == nil {
+			s.RevokedAt = &at
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockRepo) ListActive(_ context.Context, memberID int64, now time.Time) ([]Session, error) {
+	out := []Session{}
+	for i := len(m.sessions) - 1; i >= 0; i-- {
+		s := m.sessions[i]
+		if s.MemberID == memberID && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			out = append(out, s.Session)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) CreateMagicLink(_ context.Context, l MagicLink, hash []byte) (MagicLink, error) {
+	l.ID = int64(len(m.links) + 1)
+	m.links = append(m.links, &mockLink{MagicLink: l, hash: hash})
+	return l, nil
+}
+
+func (m *mockRepo) UseMagicLink(_ context.Context, hash []byte, now time.Time) (MagicLink, error) {
+	for _, l := range m.links {
+		if !bytes.Equal(l.hash, hash) {
+			continue
+		}
+		if l.UsedAt != nil {
+			return MagicLink{}, ErrLinkUsed
+		}
+		if !now.Before(l.ExpiresAt) {
+			return MagicLink{}, ErrLinkExpired
+		}
+		l.UsedAt = &now
+		return l.MagicLink, nil
+	}
+	return MagicLink{}, ErrLinkInvalid
+}
+
+func (m *mockRepo) RecordEvent(_ context.Context, e LoginEvent) error {
+	e.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *mockRepo) CountEvents(_ context.Context, event, email, ip string, since time.Time) (int, int, error) {
+	var byEmail, byIP int
+	for _, e := range m.events {
+		if e.Event == event && e.CreatedAt.After(since) {
+			if e.Email == email {
+				byEmail++
+			}
+			if e.IP == ip {
+				byIP++
+			}
+		}
+	}
+	return byEmail, byIP, nil
+}
+
+func (m *mockRepo) ListEvents(_ context.Context, f EventFilters) ([]LoginEvent, error) {
+	out := []LoginEvent{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		e := m.events[i]
+		if (f.Event == "" || e.Event == f.Event) && (f.Email == "" || e.Email == f.Email) && (f.MemberID == nil || (e.MemberID != nil && *e.MemberID == *f.MemberID)) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) CreateChallenge(_ context.Context, c Challenge) error {
+	m.challenges = append(m.challenges, &mockChallenge{Challenge: c})
+	return nil
+}
+
+func (m *mockRepo) UseChallenge(_ context.Context, challenge []byte, kind string, now time.Time) (Challenge, error) {
+	for _, c := range m.challenges {
+		if bytes.Equal(c.Challenge.Challenge, challenge) && c.Kind == kind && !c.used && now.Before(c.ExpiresAt) {
+			c.used = true
+			return c.Challenge, nil
+		}
+	}
+	return Challenge{}, ErrChallenge
+}
+
+func (m *mockRepo) CreatePasskey(_ context.Context, p Passkey) (Passkey, error) {
+	for _, pk := range m.passkeys {
+		if bytes.Equal(pk.CredentialID, p.CredentialID) {
+			return Passkey{}, ErrDuplicate
+		}
+	}
+	p.ID = int64(len(m.passkeys) + 1)
+	m.passkeys = append(m.passkeys, &p)
+	return p, nil
+}
+
+func (m *mockRepo) PasskeyByCredential(_ context.Context, credentialID []byte) (Passkey, error) {
+	for _, pk := range m.passkeys {
+		if bytes.Equal(pk.CredentialID, credentialID) && pk.RevokedAt == nil {
+			return *pk, nil
+		}
+	}
+	return Passkey{}, ErrNotFound
+}
+
+func (m *mockRepo) ListPasskeys(_ context.Context, memberID int64) ([]Passkey, error) {
+	out := []Passkey{}
+	for _, pk := range m.passkeys {
+		if pk.MemberID == memberID && pk.RevokedAt == nil {
+			out = append(out, *pk)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) RenamePasskey(_ context.Context, memberID, id int64, name string) (Passkey, error) {
+	for _, pk := range m.passkeys {
+		if pk.ID == id && pk.MemberID == memberID && pk.RevokedAt == nil {
+			pk.Name = name
+			return *pk, nil
+		}
+	}
+	return Passkey{}, ErrNotFound
+}
+
+func (m *mockRepo) RevokePasskey(_ context.Context, memberID, id int64, at time.Time) error {
+	for _, pk := range m.passkeys {
+		if pk.ID == id && pk.MemberID == memberID && pk.RevokedAt == nil {
+			pk.RevokedAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepo) UsePasskey(_ context.Context, id int64, signCount uint32, at time.Time) error {
+	for _, pk := range m.passkeys {
+		if pk.ID == id {
+			pk.SignCount, pk.LastUsedAt = signCount, &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) CreateToken(_ context.Context, t APIToken, hash []byte) (APIToken, error) {
+	t.ID = int64(len(m.tokens) + 1)
+	m.tokens = append(m.tokens, &mockToken{APIToken: t, hash: hash})
+	return t, nil
+}
+
+func (m *mockRepo) GetToken(_ context.Context, id int64) (APIToken, error) {
+	for _, t := range m.tokens {
+		if t.ID == id {
+			return t.APIToken, nil
+		}
+	}
+	return APIToken{}, ErrNotFound
+}
+
+func (m *mockRepo) TokenByHash(_ context.Context, hash []byte) (APIToken, error) {
+	for _, t := range m.tokens {
+		if bytes.Equal(t.hash, hash) {
+			return t.APIToken, nil
+		}
+	}
+	return APIToken{}, ErrNotFound
+}
+
+func (m *mockRepo) ListTokens(_ context.Context, f TokenFilters) ([]APIToken, error) {
+	out := []APIToken{}
+	for i := len(m.tokens) - 1; i >= 0; i-- {
+		t := m.tokens[i]
+		if (f.MemberID == nil || t.MemberID == *f.MemberID) && (f.IncludeRevoked || t.RevokedAt == nil) {
+			out = append(out, t.APIToken)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) TouchToken(_ context.Context, id int64, at time.Time, ip string) error {
+	for _, t := range m.tokens {
+		if t.ID == id {
+			t.LastUsedAt, t.LastUsedIP = &at, ip
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) RevokeToken(_ context.Context, id, by int64, at time.Time) error {
+	for _, t := range m.tokens {
+		if t.ID == id && t.RevokedAt == nil {
+			t.RevokedAt, t.RevokedBy = &at, &by
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// ---- Helpers ----
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+var emails = map[int64]string{1: "admin@example.com", 3: "ana@example.com"}
+
+func newRouter(devHeader bool) (http.Handler, *Manager, *clock) {
+	return newRouterWith(devHeader, nil)
+}
+
+func newRouterWith(devHeader bool, links *MagicLinks) (http.Handler, *Manager, *clock) {
+	passkeys := &Passkeys{RPID: "coop.example", RPName: "Coop", Origins: []string{"https://coop.example"}}
+	clk := &clock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	roles := map[int64]string{1: "admin", 3: "member"}
+	fetch := func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		return httpmw.Principal{MemberID: id, Role: role, Email: emails[id]}, ok, nil
+	}
+	mgr := &Manager{Repo: &mockRepo{}, Members: fetch, Now: clk.now}
+	cfg := httpmw.AuthConfig{Sessions: mgr, TrustedOrigins: []string{"https://coop.example"}}
+	if devHeader {
+		cfg.DevHeader = fetch
+	}
+	r := chi.NewRouter()
+	r.Use(httpmw.WithAuth(cfg))
+	Mount(r, Handlers{Sessions: mgr, Links: links, Passkeys: passkeys, AllowDevLogin: true})
+	return r, mgr, clk
+}
+
+type creds struct {
+	bearer, cookie, origin string
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string, c creds) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	}
+	if c.cookie != "" {
+		req.AddCookie(&http.Cookie{Name: httpmw.DefaultSessionCookie, Value: c.cookie})
+	}
+	if c.origin != "" {
+		req.Header.Set("Origin", c.origin)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func login(t *testing.T, h http.Handler, memberID int64) Issued {
+	t.Helper()
+	rr := do(t, h, "POST", "/auth/dev/login", `{"member_id":`+strconv.FormatInt(memberID, 10)+`}`, creds{})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("login: %d %s", rr.Code, rr.Body.String())
+	}
+	var iss Issued
+	_ = json.Unmarshal(rr.Body.Bytes(), &iss)
+	return iss
+}
+
+func sessionCookie(rr *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == httpmw.DefaultSessionCookie {
+			return c
+		}
+	}
+	return nil
+}
+
+// ---- Tests ----
+
+func TestSessions_CookieBearerAndDevHeader(t *testing.T) {
+	h, _, _ := newRouter(false)
+
+	rr := do(t, h, "POST", "/auth/dev/login", `{"member_id":1}`, creds{})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("login: %d %s", rr.Code, rr.Body.String())
+	}
+	c := sessionCookie(rr)
+	if c == nil || !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("cookie = %+v, want HttpOnly Secure SameSite=Lax", c)
+	}
+	var iss Issued
+	_ = json.Unmarshal(rr.Body.Bytes(), &iss)
+	if iss.Token != c.Value || iss.Session.MemberID != 1 {
+		t.Fatalf("issued = %+v", iss)
+	}
+	if rr := do(t, h, "POST", "/auth/dev/login", `{"member_id":99}`, creds{}); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown member: %d", rr.Code)
+	}
+
+	for _, cr := range []creds{{cookie: iss.Token}, {bearer: iss.Token}} {
+		rr := do(t, h, "GET", "/auth/session", "", cr)
+		var me Me
+		_ = json.Unmarshal(rr.Body.Bytes(), &me)
+		if rr.Code != http.StatusOK || me.MemberID != 1 || me.Role != "admin" || me.Via != "session" || me.Session == nil || !me.Session.Current {
+			t.Fatalf("session via %+v: %d %s", cr, rr.Code, rr.Body.String())
+		}
+	}
+
+	// A made-up bearer token is rejected; a stale cookie is a guest and cleared.
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: "nope"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("bad bearer: %d", rr.Code)
+	}
+	rr = do(t, h, "GET", "/auth/session", "", creds{cookie: "nope"})
+	if rr.Code != http.StatusUnauthorized || sessionCookie(rr) == nil || sessionCookie(rr).MaxAge >= 0 {
+		t.Fatalf("stale cookie: %d %v", rr.Code, rr.Result().Cookies())
+	}
+
+	// X-User-Id is refused unless the dev header mode is on.
+	req := httptest.NewRequest("GET", "/auth/session", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("X-User-Id without dev mode: %d", rr.Code)
+	}
+	dev, _, _ := newRouter(true)
+	rr = httptest.NewRecorder()
+	dev.ServeHTTP(rr, req)
+	var me Me
+	_ = json.Unmarshal(rr.Body.Bytes(), &me)
+	if rr.Code != http.StatusOK || me.MemberID != 1 || me.Via != "header" || me.Session != nil {
+		t.Fatalf("X-User-Id in dev mode: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Cookie-authenticated writes from another site are refused.
+	if rr := do(t, h, "POST", "/auth/logout-all", "", creds{cookie: iss.Token, origin: "https://evil.example"}); rr.Code != http.StatusForbidden {
+		t.Fatalf("cross-site write: %d", rr.Code)
+	}
+	if rr := do(t, h, "POST", "/auth/session/refresh", "", creds{cookie: iss.Token, origin: "https://coop.example"}); rr.Code != http.StatusOK {
+		t.Fatalf("same-site write: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSessions_RotationAndExpiry(t *testing.T) {
+	h, _, clk := newRouter(false)
+	iss := login(t, h, 3)
+
+	// Within the rotation interval the cookie is left alone.
+	clk.t = clk.t.Add(30 * time.Minute)
+	if rr := do(t, h, "GET", "/auth/session", "", creds{cookie: iss.Token}); rr.Code != http.StatusOK || sessionCookie(rr) != nil {
+		t.Fatalf("early request: %d %v", rr.Code, rr.Result().Cookies())
+	}
+
+	// After it, the cookie is rotated; the old token works for a grace minute.
+	clk.t = clk.t.Add(time.Hour)
+	rr := do(t, h, "GET", "/auth/session", "", creds{cookie: iss.Token})
+	c := sessionCookie(rr)
+	if rr.Code != http.StatusOK || c == nil || c.Value == iss.Token {
+		t.Fatalf("rotation: %d %v", rr.Code, rr.Result().Cookies())
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{cookie: iss.Token}); rr.Code != http.StatusOK {
+		t.Fatalf("old token in grace: %d", rr.Code)
+	}
+	clk.t = clk.t.Add(2 * time.Minute)
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: iss.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("old token after grace: %d", rr.Code)
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: c.Value}); rr.Code != http.StatusOK {
+		t.Fatalf("new token: %d", rr.Code)
+	}
+
+	// Bearer tokens are only rotated on request.
+	rr = do(t, h, "POST", "/auth/session/refresh", "", creds{bearer: c.Value})
+	var fresh Issued
+	_ = json.Unmarshal(rr.Body.Bytes(), &fresh)
+	if rr.Code != http.StatusOK || fresh.Token == "" || fresh.Token == c.Value {
+		t.Fatalf("refresh: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Idle for a week ends the session.
+	clk.t = clk.t.Add(DefaultIdleTimeout)
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: fresh.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("idle session: %d", rr.Code)
+	}
+
+	// A session in daily use still ends at its absolute expiry.
+	iss = login(t, h, 3)
+	for i := 0; i < 29; i++ {
+		clk.t = clk.t.Add(24 * time.Hour)
+		if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: iss.Token}); rr.Code != http.StatusOK {
+			t.Fatalf("day %d: %d", i+1, rr.Code)
+		}
+	}
+	clk.t = clk.t.Add(24 * time.Hour)
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: iss.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expired session: %d", rr.Code)
+	}
+}
+
+func TestSessions_LogoutAndLogoutEverywhere(t *testing.T) {
+	h, _, _ := newRouter(false)
+	laptop, phone, tablet := login(t, h, 3), login(t, h, 3), login(t, h, 3)
+	admin := login(t, h, 1)
+
+	rr := do(t, h, "GET", "/auth/sessions", "", creds{bearer: laptop.Token})
+	var list []Session
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list) != 3 {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body.String())
+	}
+	for _, s := range list {
+		if s.Current != (s.ID == laptop.Session.ID) {
+			t.Fatalf("current flag wrong: %+v", s)
+		}
+	}
+
+	// Members can end their own sessions only.
+	if rr := do(t, h, "DELETE", "/auth/sessions/"+strconv.FormatInt(admin.Session.ID, 10), "", creds{bearer: laptop.Token}); rr.Code != http.StatusNotFound {
+		t.Fatalf("revoke other member's session: %d", rr.Code)
+	}
+	if rr := do(t, h, "DELETE", "/auth/sessions/"+strconv.FormatInt(tablet.Session.ID, 10), "", creds{bearer: laptop.Token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke tablet: %d", rr.Code)
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: tablet.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked tablet still works: %d", rr.Code)
+	}
+
+	// Logout ends just this session and clears the cookie.
+	rr = do(t, h, "POST", "/auth/logout", "", creds{cookie: phone.Token})
+	if rr.Code != http.StatusNoContent || sessionCookie(rr) == nil || sessionCookie(rr).MaxAge >= 0 {
+		t.Fatalf("logout: %d %v", rr.Code, rr.Result().Cookies())
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: phone.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("logged out phone still works: %d", rr.Code)
+	}
+
+	// Logging out everywhere ends the rest, but not other members' sessions.
+	phone = login(t, h, 3)
+	rr = do(t, h, "POST", "/auth/logout-all", "", creds{bearer: laptop.Token})
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"revoked\":2}\n" {
+		t.Fatalf("logout-all: %d %s", rr.Code, rr.Body.String())
+	}
+	for _, tok := range []string{laptop.Token, phone.Token} {
+		if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: tok}); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("session survived logout-all: %d", rr.Code)
+		}
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: admin.Token}); rr.Code != http.StatusOK {
+		t.Fatalf("admin session ended: %d", rr.Code)
+	}
+}
+
+func newLinkRouter(t *testing.T) (http.Handler, *mockRepo, *clock, string) {
+	t.Helper()
+	dir := t.TempDir()
+	links := &MagicLinks{
+		Mailer: &mail.File{Dir: dir, From: "Coop <noreply@coop.example>"},
+		FindMember: func(_ context.Context, email string) (httpmw.Principal, bool, error) {
+			for id, e := range emails {
+				if strings.EqualFold(e, email) {
+					return httpmw.Principal{MemberID: id, Email: e}, true, nil
+				}
+			}
+			return httpmw.Principal{}, false, nil
+		},
+		Secret: []byte("test-secret"),
+		URL:    "https://coop.example/login/verify",
+	}
+	h, mgr, clk := newRouterWith(false, links)
+	return h, mgr.Repo.(*mockRepo), clk, dir
+}
+
+// sentTokens returns the link tokens in the mail written to dir, oldest first.
+func sentTokens(t *testing.T, dir string) []string {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	var out []string
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rest, ok := strings.Cut(string(b), "https://coop.example/login/verify?token=")
+		if !ok {
+			t.Fatalf("no link in %s", b)
+		}
+		tok, _, _ := strings.Cut(rest, "\r\n")
+		out = append(out, tok)
+	}
+	return out
+}
+
+func TestMagicLink_RequestAndRedeem(t *testing.T) {
+	h, repo, clk, dir := newLinkRouter(t)
+
+	// Members and strangers get the same answer; only members get mail.
+	for _, email := range []string{" Ana@Example.com ", "nobody@example.com"} {
+		rr := do(t, h, "POST", "/auth/magic-link", `{"email":"`+email+`"}`, creds{})
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("request %q: %d %s", email, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"not-an-email"}`, creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad email: %d", rr.Code)
+	}
+	toks := sentTokens(t, dir)
+	if len(toks) != 1 {
+		t.Fatalf("sent %d links, want 1", len(toks))
+	}
+	b, _ := os.ReadFile(mustGlob(t, dir))
+	if !strings.Contains(string(b), "To: ana@example.com") || !strings.Contains(string(b), "Subject: Your sign-in link") {
+		t.Fatalf("mail = %s", b)
+	}
+
+	// A tampered token is refused without a lookup.
+	if rr := do(t, h, "POST", "/auth/magic-link/redeem", `{"token":"`+toks[0]+`x"}`, creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("tampered token: %d", rr.Code)
+	}
+
+	rr := do(t, h, "POST", "/auth/magic-link/redeem", `{"token":"`+toks[0]+`"}`, creds{})
+	var iss Issued
+	_ = json.Unmarshal(rr.Body.Bytes(), &iss)
+	if rr.Code != http.StatusCreated || iss.Session.MemberID != 3 || iss.Session.Method != MethodMagicLink || sessionCookie(rr) == nil {
+		t.Fatalf("redeem: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(t, h, "GET", "/auth/session", "", creds{bearer: iss.Token}); rr.Code != http.StatusOK {
+		t.Fatalf("session from link: %d", rr.Code)
+	}
+
+	// Links work once, and not after they expire.
+	if rr := do(t, h, "POST", "/auth/magic-link/redeem", `{"token":"`+toks[0]+`"}`, creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("reused link: %d", rr.Code)
+	}
+	do(t, h, "POST", "/auth/magic-link", `{"email":"ana@example.com"}`, creds{})
+	clk.t = clk.t.Add(DefaultLinkTTL)
+	if rr := do(t, h, "POST", "/auth/magic-link/redeem", `{"token":"`+sentTokens(t, dir)[1]+`"}`, creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expired link: %d", rr.Code)
+	}
+
+	// Every step is in the audit log, visible to admins only.
+	var kinds []string
+	for _, e := range repo.events {
+		kinds = append(kinds, e.Event+":"+e.Detail)
+	}
+	want := "link_requested:,link_requested:unknown email,login_failed:bad signature,login_succeeded:,login_failed:link already used,link_requested:,login_failed:link expired"
+	if strings.Join(kinds, ",") != want {
+		t.Fatalf("events = %v", kinds)
+	}
+	if e := repo.events[0]; e.Email != "ana@example.com" || e.MemberID == nil || *e.MemberID != 3 || e.IP == "" {
+		t.Fatalf("event = %+v", e)
+	}
+	admin := login(t, h, 1)
+	member := login(t, h, 3)
+	if rr := do(t, h, "GET", "/auth/login-events?member_id=3", "", creds{bearer: member.Token}); rr.Code != http.StatusForbidden {
+		t.Fatalf("member lists events: %d", rr.Code)
+	}
+	rr = do(t, h, "GET", "/auth/login-events?event=login_failed", "", creds{bearer: admin.Token})
+	var evs []LoginEvent
+	_ = json.Unmarshal(rr.Body.Bytes(), &evs)
+	if rr.Code != http.StatusOK || len(evs) != 3 || evs[0].Detail != "link expired" {
+		t.Fatalf("list events: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestMagicLink_RateLimits(t *testing.T) {
+	h, _, clk, dir := newLinkRouter(t)
+
+	for i := 0; i < DefaultLinksPerEmail; i++ {
+		if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"ana@example.com"}`, creds{}); rr.Code != http.StatusAccepted {
+			t.Fatalf("request %d: %d", i+1, rr.Code)
+		}
+	}
+	rr := do(t, h, "POST", "/auth/magic-link", `{"email":"ANA@example.com"}`, creds{})
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "900" {
+		t.Fatalf("over email limit: %d %v", rr.Code, rr.Header())
+	}
+	if n := len(sentTokens(t, dir)); n != DefaultLinksPerEmail {
+		t.Fatalf("sent %d links, want %d", n, DefaultLinksPerEmail)
+	}
+
+	// Unknown addresses count toward the per-client limit too.
+	for i := DefaultLinksPerEmail; i < DefaultLinksPerIP; i++ {
+		if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"guess`+strconv.Itoa(i)+`@example.com"}`, creds{}); rr.Code != http.StatusAccepted {
+			t.Fatalf("request %d: %d", i+1, rr.Code)
+		}
+	}
+	if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"admin@example.com"}`, creds{}); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("over IP limit: %d", rr.Code)
+	}
+
+	// The window slides.
+	clk.t = clk.t.Add(DefaultLinkWindow)
+	if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"admin@example.com"}`, creds{}); rr.Code != http.StatusAccepted {
+		t.Fatalf("after window: %d", rr.Code)
+	}
+}
+
+func mustGlob(t *testing.T, dir string) string {
+	t.Helper()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) == 0 {
+		t.Fatal("no mail sent")
+	}
+	return files[0]
+}
+
+// ---- Software authenticator ----
+
+// cborPair keeps map entries in the order written.
+type cborPair struct {
+	k, v any
+}
+
+func cborHead(major byte, n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 256:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	}
+}
+
+func cborEncode(v any) []byte {
+	switch t := v.(type) {
+	case int:
+		if t < 0 {
+			return cborHead(1, -1-t)
+		}
+		return cborHead(0, t)
+	case []byte:
+		return append(cborHead(2, len(t)), t...)
+	case string:
+		return append(cborHead(3, len(t)), t...)
+	case []cborPair:
+		out := cborHead(5, len(t))
+		for _, p := range t {
+			out = append(append(out, cborEncode(p.k)...), cborEncode(p.v)...)
+		}
+		return out
+	}
+	panic("cbor: unsupported type")
+}
+
+// softAuthenticator is a passkey authenticator in software: an ES256 or
+// Ed25519 key with a signature counter.
+type softAuthenticator struct {
+	ec     *ecdsa.PrivateKey
+	ed     ed25519.PrivateKey
+	credID []byte
+	user   []byte
+	count  uint32
+	origin string
+}
+
+func newSoftAuthenticator(t *testing.T, alg int) *softAuthenticator {
+	t.Helper()
+	a := &softAuthenticator{credID: make([]byte, 16), origin: "https://coop.example"}
+	_, _ = rand.Read(a.credID)
+	var err error
+	if alg == AlgEdDSA {
+		_, a.ed, err = ed25519.GenerateKey(rand.Reader)
+	} else {
+		a.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	if a.ed != nil {
+		return cborEncode([]cborPair{{1, 1}, {3, AlgEdDSA}, {-1, 6}, {-2, []byte(a.ed.Public().(ed25519.PublicKey))}})
+	}
+	x, y := a.ec.X.FillBytes(make([]byte, 32)), a.ec.Y.FillBytes(make([]byte, 32))
+	return cborEncode([]cborPair{{1, 2}, {3, AlgES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+func (a *softAuthenticator) authData(rpID string, flags byte) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	out := append(h[:], flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(out[33:], a.count)
+	return out
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge []byte) []byte {
+	b, _ := json.Marshal(map[string]any{"type": typ, "challenge": base64.RawURLEncoding.EncodeToString(challenge), "origin": a.origin, "crossOrigin": false})
+	return b
+}
+
+func (a *softAuthenticator) create(o CreationOptions) RegistrationResponse {
+	a.user = o.User.ID
+	ad := a.authData(o.RP.ID, flagUserPresent|flagUserVerified|flagAttested)
+	ad = append(ad, make([]byte, 16)...) // AAGUID
+	ad = append(ad, byte(len(a.credID)>>8), byte(len(a.credID)))
+	ad = append(append(ad, a.credID...), a.coseKey()...)
+	var resp RegistrationResponse
+	resp.RawID, resp.Type = a.credID, "public-key"
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", o.Challenge)
+	resp.Response.AttestationObject = cborEncode([]cborPair{{"fmt", "none"}, {"attStmt", []cborPair{}}, {"authData", ad}})
+	resp.Response.Transports = []string{"internal"}
+	return resp
+}
+
+func (a *softAuthenticator) get(o RequestOptions) AssertionResponse {
+	a.count++
+	ad := a.authData(o.RPID, flagUserPresent|flagUserVerified)
+	cd := a.clientData("webauthn.get", o.Challenge)
+	h := sha256.Sum256(cd)
+	msg := append(append([]byte(nil), ad...), h[:]...)
+	var sig []byte
+	if a.ed != nil {
+		sig = ed25519.Sign(a.ed, msg)
+	} else {
+		d := sha256.Sum256(msg)
+		sig, _ = ecdsa.SignASN1(rand.Reader, a.ec, d[:])
+	}
+	var resp AssertionResponse
+	resp.RawID, resp.Type = a.credID, "public-key"
+	resp.Response.ClientDataJSON, resp.Response.AuthenticatorData, resp.Response.Signature, resp.Response.UserHandle = cd, ad, sig, a.user
+	return resp
+}
+
+func jsonBody(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func registerPasskey(t *testing.T, h http.Handler, token, name string, a *softAuthenticator) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := do(t, h, "POST", "/auth/passkeys/register/begin", "", creds{bearer: token})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("register begin: %d %s", rr.Code, rr.Body.String())
+	}
+	var opts struct{ PublicKey CreationOptions }
+	_ = json.Unmarshal(rr.Body.Bytes(), &opts)
+	return do(t, h, "POST", "/auth/passkeys/register/finish", jsonBody(t, map[string]any{"name": name, "credential": a.create(opts.PublicKey)}), creds{bearer: token})
+}
+
+func passkeyLogin(t *testing.T, h http.Handler, a *softAuthenticator) (*httptest.ResponseRecorder, AssertionResponse) {
+	t.Helper()
+	rr := do(t, h, "POST", "/auth/passkeys/login/begin", "", creds{})
+	var opts struct{ PublicKey RequestOptions }
+	_ = json.Unmarshal(rr.Body.Bytes(), &opts)
+	if rr.Code != http.StatusOK || opts.PublicKey.RPID != "coop.example" || len(opts.PublicKey.Challenge) != 32 {
+		t.Fatalf("login begin: %d %s", rr.Code, rr.Body.String())
+	}
+	resp := a.get(opts.PublicKey)
+	return do(t, h, "POST", "/auth/passkeys/login/finish", jsonBody(t, map[string]any{"credential": resp}), creds{}), resp
+}
+
+func TestPasskeys_RegisterSignInAndRevoke(t *testing.T) {
+	h, _, clk := newRouter(false)
+	ana := login(t, h, 3)
+	laptop, phone := newSoftAuthenticator(t, AlgES256), newSoftAuthenticator(t, AlgEdDSA)
+
+	rr := registerPasskey(t, h, ana.Token, "Laptop", laptop)
+	var pk Passkey
+	_ = json.Unmarshal(rr.Body.Bytes(), &pk)
+	if rr.Code != http.StatusCreated || pk.Name != "Laptop" || pk.Alg != AlgES256 || pk.MemberID != 3 {
+		t.Fatalf("register laptop: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := registerPasskey(t, h, ana.Token, "Phone", phone); rr.Code != http.StatusCreated {
+		t.Fatalf("register phone: %d %s", rr.Code, rr.Body.String())
+	}
+	// The same credential cannot be registered twice.
+	if rr := registerPasskey(t, h, ana.Token, "Again", laptop); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(t, h, "POST", "/auth/passkeys/register/begin", "", creds{bearer: ana.Token})
+	var opts struct{ PublicKey CreationOptions }
+	_ = json.Unmarshal(rr.Body.Bytes(), &opts)
+	if o := opts.PublicKey; len(o.ExcludeCredentials) != 2 || o.User.Name != "ana@example.com" || o.AuthenticatorSelection.UserVerification != "required" {
+		t.Fatalf("creation options: %s", rr.Body.String())
+	}
+
+	// Sign in with each passkey.
+	for _, a := range []*softAuthenticator{laptop, phone} {
+		rr, _ := passkeyLogin(t, h, a)
+		var iss Issued
+		_ = json.Unmarshal(rr.Body.Bytes(), &iss)
+		if rr.Code != http.StatusCreated || iss.Session.MemberID != 3 || iss.Session.Method != MethodPasskey {
+			t.Fatalf("passkey login: %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	rr = do(t, h, "GET", "/auth/passkeys", "", creds{bearer: ana.Token})
+	var list []Passkey
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 2 || list[0].LastUsedAt == nil || list[0].SignCount != 1 {
+		t.Fatalf("list: %s", rr.Body.String())
+	}
+
+	// Replayed assertions, clones, forged signatures and foreign origins fail.
+	_, used := passkeyLogin(t, h, laptop)
+	if rr := do(t, h, "POST", "/auth/passkeys/login/finish", jsonBody(t, map[string]any{"credential": used}), creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("replay: %d", rr.Code)
+	}
+	clone := *laptop
+	clone.count = 0
+	if rr, _ := passkeyLogin(t, h, &clone); rr.Code != http.StatusBadRequest {
+		t.Fatalf("cloned authenticator: %d", rr.Code)
+	}
+	forger := newSoftAuthenticator(t, AlgES256)
+	forger.credID, forger.user, forger.count = laptop.credID, laptop.user, 100
+	if rr, _ := passkeyLogin(t, h, forger); rr.Code != http.StatusBadRequest {
+		t.Fatalf("forged signature: %d", rr.Code)
+	}
+	phish := *phone
+	phish.origin = "https://coop.example.evil"
+	if rr, _ := passkeyLogin(t, h, &phish); rr.Code != http.StatusBadRequest {
+		t.Fatalf("foreign origin: %d", rr.Code)
+	}
+
+	// Rename and revoke; other members cannot touch them.
+	if rr := do(t, h, "PUT", "/auth/passkeys/1", `{"name":"Work laptop"}`, creds{bearer: ana.Token}); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Work laptop") {
+		t.Fatalf("rename: %d %s", rr.Code, rr.Body.String())
+	}
+	admin := login(t, h, 1)
+	if rr := do(t, h, "DELETE", "/auth/passkeys/1", "", creds{bearer: admin.Token}); rr.Code != http.StatusNotFound {
+		t.Fatalf("revoke other's passkey: %d", rr.Code)
+	}
+	if rr := do(t, h, "DELETE", "/auth/passkeys/1", "", creds{bearer: ana.Token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", rr.Code)
+	}
+	if rr, _ := passkeyLogin(t, h, laptop); rr.Code != http.StatusBadRequest {
+		t.Fatalf("revoked passkey: %d", rr.Code)
+	}
+	if rr, _ := passkeyLogin(t, h, phone); rr.Code != http.StatusCreated {
+		t.Fatalf("remaining passkey: %d", rr.Code)
+	}
+
+	// Adding a passkey needs a recent sign-in.
+	clk.t = clk.t.Add(DefaultFreshSignIn + time.Minute)
+	if rr := do(t, h, "POST", "/auth/passkeys/register/begin", "", creds{bearer: ana.Token}); rr.Code != http.StatusForbidden {
+		t.Fatalf("stale session: %d", rr.Code)
+	}
+}
+
+func TestPasskeys_RecoveryThroughMagicLink(t *testing.T) {
+	h, repo, _, dir := newLinkRouter(t)
+
+	// Ana lost her only passkey and asks for a recovery link.
+	repo.passkeys = append(repo.passkeys, &Passkey{ID: 1, MemberID: 3, CredentialID: []byte("lost"), Name: "Old phone"})
+	if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"ana@example.com","purpose":"recovery"}`, creds{}); rr.Code != http.StatusAccepted {
+		t.Fatalf("recovery request: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(t, h, "POST", "/auth/magic-link", `{"email":"ana@example.com","purpose":"reset"}`, creds{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad purpose: %d", rr.Code)
+	}
+	b, _ := os.ReadFile(mustGlob(t, dir))
+	if !strings.Contains(string(b), "Subject: Recover your account") {
+		t.Fatalf("mail = %s", b)
+	}
+	rr := do(t, h, "POST", "/auth/magic-link/redeem", `{"token":"`+sentTokens(t, dir)[0]+`"}`, creds{})
+	var iss Issued
+	_ = json.Unmarshal(rr.Body.Bytes(), &iss)
+	if rr.Code != http.StatusCreated || iss.Session.Method != MethodRecovery {
+		t.Fatalf("recovery redeem: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// She registers a new passkey, removes the lost one and signs in with the new one.
+	a := newSoftAuthenticator(t, AlgES256)
+	if rr := registerPasskey(t, h, iss.Token, "New phone", a); rr.Code != http.StatusCreated {
+		t.Fatalf("register after recovery: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(t, h, "DELETE", "/auth/passkeys/1", "", creds{bearer: iss.Token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke lost passkey: %d", rr.Code)
+	}
+	if rr, _ := passkeyLogin(t, h, a); rr.Code != http.StatusCreated {
+		t.Fatalf("login with new passkey: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// A registration challenge only works for the member it was issued to.
+	admin := login(t, h, 1)
+	rr = do(t, h, "POST", "/auth/passkeys/register/begin", "", creds{bearer: iss.Token})
+	var opts struct{ PublicKey CreationOptions }
+	_ = json.Unmarshal(rr.Body.Bytes(), &opts)
+	stolen := newSoftAuthenticator(t, AlgES256).create(opts.PublicKey)
+	if rr := do(t, h, "POST", "/auth/passkeys/register/finish", jsonBody(t, map[string]any{"credential": stolen}), creds{bearer: admin.Token}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("foreign challenge: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var kinds []string
+	for _, e := range repo.events {
+		kinds = append(kinds, e.Event+":"+e.Method)
+	}
+	want := "link_requested:magic_link,login_succeeded:recovery,passkey_added:passkey,passkey_revoked:passkey,login_succeeded:passkey,login_succeeded:dev"
+	if strings.Join(kinds, ",") != want {
+		t.Fatalf("events = %v", kinds)
+	}
+}
+
+func newTokenRouter() (http.Handler, *Manager, *clock) {
+	clk := &clock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	// Member 5 holds a custom role with tokens.manage and nothing else.
+	roles := map[int64]string{1: "admin", 3: "member", 5: "member"}
+	fetch := func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		p := httpmw.Principal{MemberID: id, Role: role, Email: emails[id]}
+		if id == 5 {
+			p.Permissions = []string{"tokens.manage"}
+		}
+		return p, ok, nil
+	}
+	mgr := &Manager{Repo: &mockRepo{}, Members: fetch, Now: clk.now}
+	r := chi.NewRouter()
+	r.Use(httpmw.WithAuth(httpmw.AuthConfig{Sessions: mgr}))
+	r.Use(httpmw.AreaScopes(""))
+	Mount(r, Handlers{Sessions: mgr, AllowDevLogin: true})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	r.Get("/ledger", ok)
+	r.Post("/ledger/7/void", ok)
+	r.Get("/proposals/4/votes", ok)
+	return r, mgr, clk
+}
+
+func mintToken(t *testing.T, h http.Handler, admin, body string) CreatedToken {
+	t.Helper()
+	rr := do(t, h, "POST", "/auth/tokens", body, creds{bearer: admin})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("mint: %d %s", rr.Code, rr.Body.String())
+	}
+	var ct CreatedToken
+	_ = json.Unmarshal(rr.Body.Bytes(), &ct)
+	return ct
+}
+
+func TestTokens_MintScopesAndRevoke(t *testing.T) {
+	h, mgr, clk := newTokenRouter()
+	admin, member := login(t, h, 1).Token, login(t, h, 3).Token
+
+	if rr := do(t, h, "POST", "/auth/tokens", `{"name":"x","kind":"service","scopes":["ledger:read"]}`, creds{bearer: member}); rr.Code != http.StatusForbidden {
+		t.Fatalf("member minted a token: %d", rr.Code)
+	}
+	for _, body := range []string{
+		`{"name":"x","kind":"personal","scopes":["ledger:read"]}`,
+		`{"name":"x","kind":"service","scopes":["auth:write"]}`,
+		`{"name":"x","kind":"service","scopes":[]}`,
+		`{"name":"x","kind":"service","scopes":["ledger:read"],"expires_in_days":400}`,
+		`{"name":"x","kind":"bot","scopes":["ledger:read"]}`,
+	} {
+		if rr := do(t, h, "POST", "/auth/tokens", body, creds{bearer: admin}); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	reader := mintToken(t, h, admin, `{"name":"Books sync","kind":"service","scopes":["ledger:read"," Proposals:read "]}`)
+	if !strings.HasPrefix(reader.Token, APITokenPrefix) || !strings.HasPrefix(reader.Token, reader.APIToken.Prefix) {
+		t.Fatalf("token %q prefix %q", reader.Token, reader.APIToken.Prefix)
+	}
+	if reader.APIToken.MemberID != 1 || strings.Join(reader.APIToken.Scopes, ",") != "ledger:read,proposals:read" {
+		t.Fatalf("service token: %+v", reader.APIToken)
+	}
+	if !reader.APIToken.ExpiresAt.Equal(clk.t.Add(DefaultTokenDays * 24 * time.Hour)) {
+		t.Fatalf("expiry: %v", reader.APIToken.ExpiresAt)
+	}
+	writer := mintToken(t, h, admin, `{"name":"Ana's script","kind":"personal","member_id":3,"scopes":["ledger:read","ledger:write"],"expires_in_days":7}`)
+	if strings.Join(writer.APIToken.Scopes, ",") != "ledger:write" {
+		t.Fatalf("write should subsume read: %v", writer.APIToken.Scopes)
+	}
+
+	// Only the hash is stored; the listing never shows the secret.
+	rr := do(t, h, "GET", "/auth/tokens?member_id=3", "", creds{bearer: admin})
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), writer.Token) || !strings.Contains(rr.Body.String(), writer.APIToken.Prefix) {
+		t.Fatalf("list: %d %s", rr.Code, rr.Body.String())
+	}
+	stored, _ := mgr.Repo.GetToken(context.Background(), writer.APIToken.ID)
+	if stored.LastUsedAt != nil {
+		t.Fatalf("unused token has last_used_at")
+	}
+
+	cases := []struct {
+		token, method, path string
+		want                int
+	}{
+		{reader.Token, "GET", "/ledger", http.StatusNoContent},
+		{reader.Token, "POST", "/ledger/7/void", http.StatusForbidden},
+		{reader.Token, "GET", "/proposals/4/votes", http.StatusNoContent},
+		{writer.Token, "GET", "/ledger", http.StatusNoContent},
+		{writer.Token, "POST", "/ledger/7/void", http.StatusNoContent},
+		{writer.Token, "GET", "/proposals/4/votes", http.StatusForbidden},
+		// Tokens never reach the auth endpoints, even an admin's.
+		{reader.Token, "GET", "/auth/session", http.StatusForbidden},
+		{reader.Token, "GET", "/auth/tokens", http.StatusForbidden},
+		// Sessions are not scoped.
+		{member, "POST", "/ledger/7/void", http.StatusNoContent},
+	}
+	for _, c := range cases {
+		if rr := do(t, h, c.method, c.path, "", creds{bearer: c.token}); rr.Code != c.want {
+			t.Fatalf("%s %s: got %d want %d %s", c.method, c.path, rr.Code, c.want, rr.Body.String())
+		}
+	}
+	// API tokens are bearer-only.
+	if rr := do(t, h, "GET", "/ledger", "", creds{cookie: writer.Token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("cookie token: %d", rr.Code)
+	}
+	stored, _ = mgr.Repo.GetToken(context.Background(), writer.APIToken.ID)
+	if stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(clk.t) || stored.LastUsedIP != "192.0.2.1" {
+		t.Fatalf("last used: %+v", stored)
+	}
+
+	// Revoked and expired tokens stop working.
+	if rr := do(t, h, "DELETE", "/auth/tokens/"+strconv.FormatInt(reader.APIToken.ID, 10), "", creds{bearer: admin}); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", rr.Code)
+	}
+	if rr := do(t, h, "DELETE", "/auth/tokens/"+strconv.FormatInt(reader.APIToken.ID, 10), "", creds{bearer: admin}); rr.Code != http.StatusNotFound {
+		t.Fatalf("revoke twice: %d", rr.Code)
+	}
+	if rr := do(t, h, "GET", "/ledger", "", creds{bearer: reader.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: %d", rr.Code)
+	}
+	clk.t = clk.t.Add(8 * 24 * time.Hour)
+	if rr := do(t, h, "GET", "/ledger", "", creds{bearer: writer.Token}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expired token: %d", rr.Code)
+	}
+	admin = login(t, h, 1).Token
+	rr = do(t, h, "GET", "/auth/tokens", "", creds{bearer: admin})
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "Books sync") {
+		t.Fatalf("revoked token listed: %s", rr.Body.String())
+	}
+	rr = do(t, h, "GET", "/auth/tokens?include_revoked=true", "", creds{bearer: admin})
+	if !strings.Contains(rr.Body.String(), "Books sync") {
+		t.Fatalf("include_revoked: %s", rr.Body.String())
+	}
+	rr = do(t, h, "GET", "/auth/login-events", "", creds{bearer: admin})
+	if !strings.Contains(rr.Body.String(), EventTokenCreated) || !strings.Contains(rr.Body.String(), EventTokenRevoked) {
+		t.Fatalf("token events not audited: %s", rr.Body.String())
+	}
+}
+
+func TestTokens_CannotMintAboveOwnPermissions(t *testing.T) {
+	h, _, _ := newTokenRouter()
+	clerk := login(t, h, 5).Token
+	for _, body := range []string{
+		`{"name":"x","kind":"personal","member_id":1,"scopes":["ledger:write"]}`,
+		`{"name":"x","kind":"service","member_id":1,"scopes":["ledger:read"]}`,
+	} {
+		rr := do(t, h, "POST", "/auth/tokens", body, creds{bearer: clerk})
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `\"*\"`) {
+			t.Fatalf("%s: expected 403 naming *, got %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+	// Tokens for members with no more access than the caller are fine.
+	mintToken(t, h, clerk, `{"name":"Ana's script","kind":"personal","member_id":3,"scopes":["ledger:read"]}`)
+	mintToken(t, h, clerk, `{"name":"Clerk bot","kind":"service","scopes":["ledger:read"]}`)
+}
+
+func TestTokens_CannotMintBroaderScopes(t *testing.T) {
+	h, mgr, _ := newTokenRouter()
+	clerk := login(t, h, 5).Token
+	narrow := mintToken(t, h, clerk, `{"name":"Reader","kind":"personal","member_id":5,"scopes":["ledger:read"]}`).Token
+
+	// Without AreaScopes in front, as if /api/auth were ever opened to
+	// tokens, the handler itself must hold the line.
+	open := chi.NewRouter()
+	open.Use(httpmw.WithAuth(httpmw.AuthConfig{Sessions: mgr}))
+	Mount(open, Handlers{Sessions: mgr})
+	for _, scopes := range []string{`["ledger:write"]`, `["members:write"]`, `["ledger:read","members:read"]`} {
+		body := `{"name":"x","kind":"personal","member_id":5,"scopes":` + scopes + `}`
+		if rr := do(t, open, "POST", "/auth/tokens", body, creds{bearer: narrow}); rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d %s", scopes, rr.Code, rr.Body.String())
+		}
+	}
+	mintToken(t, open, narrow, `{"name":"Reader 2","kind":"personal","member_id":5,"scopes":["ledger:read"]}`)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/mail"
+)
+
+// Magic link defaults.
+const (
+	DefaultLinkTTL       = 15 * time.Minute
+	DefaultLinkWindow    = 15 * time.Minute
+	DefaultLinksPerEmail = 5
+	DefaultLinksPerIP    = 20
+)
+
+// MagicLinks configures passwordless email sign-in.
+type MagicLinks struct {
+	Mailer mail.Mailer
+	// FindMember looks a member up by email address.
+	FindMember func(ctx context.Context, email string) (httpmw.Principal, bool, error)
+	// Secret signs link tokens so forged ones are refused before any
+	// lookup.
+	Secret []byte
+	// URL is the sign-in page the emailed link opens, with the token added
+	// as ?token=. The page redeems it with a POST, so mail scanners that
+	// follow links do not use it up.
+	URL string
+	// TTL is how long a link works. At most PerEmail links per address and
+	// PerIP per client address are sent in any Window. Zero values use
+	// the defaults.
+	TTL      time.Duration
+	Window   time.Duration
+	PerEmail int
+	PerIP    int
+}
+
+func (l *MagicLinks) ttl() time.Duration {
+	if l.TTL <= 0 {
+		return DefaultLinkTTL
+	}
+	return l.TTL
+}
+
+func (l *MagicLinks) window() time.Duration {
+	if l.Window <= 0 {
+		return DefaultLinkWindow
+	}
+	return l.Window
+}
+
+func (l *MagicLinks) perEmail() int {
+	if l.PerEmail <= 0 {
+		return DefaultLinksPerEmail
+	}
+	return l.PerEmail
+}
+
+func (l *MagicLinks) perIP() int {
+	if l.PerIP <= 0 {
+		return DefaultLinksPerIP
+	}
+	return l.PerIP
+}
+
+// newToken returns a signed link token, "<random>.<signature>", and the
+// hash stored for it.
+func (l *MagicLinks) newToken() (string, []byte, error) {
+	raw, _, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := raw + "." + l.sign(raw)
+	return token, hashToken(token), nil
+}
+
+// verify reports whether token carries a valid signature.
+func (l *MagicLinks) verify(token string) bool {
+	raw, sig, ok := strings.Cut(token, ".")
+	return ok && raw != "" && hmac.Equal([]byte(sig), []byte(l.sign(raw)))
+}
+
+func (l *MagicLinks) sign(raw string) string {
+	mac := hmac.New(sha256.New, l.Secret)
+	mac.Write([]byte("magic-link:" + raw))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *MagicLinks) message(to, token, purpose string) mail.Message {
+	sep := "?"
+	if strings.Contains(l.URL, "?") {
+		sep = "&"
+	}
+	link := l.URL + sep + "token=" + url.QueryEscape(token)
+	if purpose == PurposeRecovery {
+		return mail.Message{
+			To:      to,
+			Subject: "Recover your account",
+			Text: fmt.Sprintf("Open this link to sign in and set up a new passkey:\n\n%s\n\nIt works once and expires in %d minutes. Remove any passkey you no longer have from your account settings. If you did not ask for this, you can ignore this email.\n",
+				link, int(l.ttl().Minutes())),
+		}
+	}
+	return mail.Message{
+		To:      to,
+		Subject: "Your sign-in link",
+		Text: fmt.Sprintf("Open this link to sign in:\n\n%s\n\nIt works once and expires in %d minutes. If you did not ask to sign in, you can ignore this email.\n",
+			link, int(l.ttl().Minutes())),
+	}
+}
+
+func normalizeEmail(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
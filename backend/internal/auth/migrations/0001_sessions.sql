@@ -0,0 +1,20 @@
+-- backend/internal/auth/migrations/0001_sessions.sql
+-- Server-issued login sessions. Only SHA-256 hashes of tokens are stored.
+-- Tokens rotate: prev_token_hash stays valid briefly after token_issued_at
+-- so requests racing a rotation still succeed.
+CREATE TABLE IF NOT EXISTS auth_sessions (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL UNIQUE,
+  prev_token_hash BYTEA,
+  method TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  token_issued_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS auth_sessions_member_idx ON auth_sessions(member_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS auth_sessions_prev_token_idx ON auth_sessions(prev_token_hash) WHERE prev_token_hash IS NOT NULL;
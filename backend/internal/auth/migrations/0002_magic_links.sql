@@ -0,0 +1,28 @@
+-- backend/internal/auth/migrations/0002_magic_links.sql
+-- Single-use email login links, stored as token hashes, and an audit log
+-- of sign-in activity that also drives link request rate limits.
+CREATE TABLE IF NOT EXISTS auth_magic_links (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL UNIQUE,
+  ip TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS auth_login_events (
+  id BIGSERIAL PRIMARY KEY,
+  event TEXT NOT NULL,
+  member_id BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  email TEXT NOT NULL DEFAULT '',
+  method TEXT NOT NULL DEFAULT '',
+  detail TEXT NOT NULL DEFAULT '',
+  session_id BIGINT REFERENCES auth_sessions(id) ON DELETE SET NULL,
+  ip TEXT NOT NULL DEFAULT '',
+  user_agent TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS auth_login_events_email_idx ON auth_login_events(event, email, created_at);
+CREATE INDEX IF NOT EXISTS auth_login_events_ip_idx ON auth_login_events(event, ip, created_at);
+CREATE INDEX IF NOT EXISTS auth_login_events_member_idx ON auth_login_events(member_id, created_at);
@@ -0,0 +1,36 @@
+-- backend/internal/auth/migrations/0003_passkeys.sql
+-- WebAuthn passkeys: a member may register several, each with a name.
+-- Revoked credentials are kept so the audit trail still resolves them.
+CREATE TABLE IF NOT EXISTS auth_passkeys (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  credential_id BYTEA NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  alg INTEGER NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  name TEXT NOT NULL DEFAULT '',
+  transports TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  revoked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS auth_passkeys_member_idx ON auth_passkeys(member_id);
+
+-- Outstanding ceremony challenges; each is used once.
+CREATE TABLE IF NOT EXISTS auth_webauthn_challenges (
+  challenge BYTEA PRIMARY KEY,
+  kind TEXT NOT NULL CHECK (kind IN ('register','login')),
+  member_id BIGINT REFERENCES members(id) ON DELETE CASCADE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ
+);
+
+-- Recovery links sign a member in so they can register a new passkey.
+ALTER TABLE auth_magic_links ADD COLUMN IF NOT EXISTS purpose TEXT NOT NULL DEFAULT 'login';
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname='auth_magic_links_purpose_chk') THEN
+    ALTER TABLE auth_magic_links
+      ADD CONSTRAINT auth_magic_links_purpose_chk CHECK (purpose IN ('login','recovery'));
+  END IF;
+END$$;
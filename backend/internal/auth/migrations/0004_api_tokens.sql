@@ -0,0 +1,22 @@
+-- backend/internal/auth/migrations/0004_api_tokens.sql
+-- API tokens for integrations. Each acts as its member (a person for
+-- personal tokens, the accountable admin for service tokens) limited to
+-- its scopes. Only SHA-256 hashes are stored; prefix identifies a token
+-- in listings.
+CREATE TABLE IF NOT EXISTS auth_api_tokens (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL CHECK (kind IN ('personal','service')),
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  token_hash BYTEA NOT NULL UNIQUE,
+  prefix TEXT NOT NULL,
+  scopes TEXT[] NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  last_used_ip TEXT NOT NULL DEFAULT '',
+  revoked_at TIMESTAMPTZ,
+  revoked_by BIGINT REFERENCES members(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS auth_api_tokens_member_idx ON auth_api_tokens(member_id);
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// Session methods record how a session was started.
+const (
+	MethodDev       = "dev"
+	MethodMagicLink = "magic_link"
+	MethodRecovery  = "recovery"
+	MethodPasskey   = "passkey"
+)
+
+// Magic link purposes. A recovery link signs in a member who lost their
+// passkeys so they can register a new one.
+const (
+	PurposeLogin    = "login"
+	PurposeRecovery = "recovery"
+)
+
+// WebAuthn ceremony kinds.
+const (
+	CeremonyRegister = "register"
+	CeremonyLogin    = "login"
+)
+
+// Login event kinds.
+const (
+	EventLinkRequested   = "link_requested"
+	EventLinkRateLimited = "link_rate_limited"
+	EventLoginSucceeded  = "login_succeeded"
+	EventLoginFailed     = "login_failed"
+	EventLogout          = "logout"
+	EventLogoutAll       = "logout_all"
+	EventSessionRevoked  = "session_revoked"
+	EventPasskeyAdded    = "passkey_added"
+	EventPasskeyRevoked  = "passkey_revoked"
+	EventTokenCreated    = "token_created"
+	EventTokenRevoked    = "token_revoked"
+)
+
+// ValidEvent reports whether s is a login event kind.
+func ValidEvent(s string) bool {
+	switch s {
+	case EventLinkRequested, EventLinkRateLimited, EventLoginSucceeded, EventLoginFailed, EventLogout, EventLogoutAll, EventSessionRevoked,
+		EventPasskeyAdded, EventPasskeyRevoked, EventTokenCreated, EventTokenRevoked:
+		return true
+	}
+	return false
+}
+
+// Session is a member's login on one device. The token itself is only ever
+// returned once, when the session is issued or rotated.
+type Session struct {
+	ID            int64      `json:"id"`
+	MemberID      int64      `json:"member_id"`
+	Method        string     `json:"method"`
+	UserAgent     string     `json:"user_agent"`
+	IP            string     `json:"ip"`
+	CreatedAt     time.Time  `json:"created_at"`
+	TokenIssuedAt time.Time  `json:"token_issued_at"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// Active reports whether s can still authenticate at now given the idle
+// timeout (zero disables it).
+func (s Session) Active(now time.Time, idle time.Duration) bool {
+	if s.RevokedAt != nil || !now.Before(s.ExpiresAt) {
+		return false
+	}
+	return idle <= 0 || now.Sub(s.LastSeenAt) < idle
+}
+
+// Issued is a newly issued or rotated session with its token.
+type Issued struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Session   Session   `json:"session"`
+}
+
+// MagicLink is an emailed single-use login link. Its token is only in the
+// email.
+type MagicLink struct {
+	ID        int64      `json:"id"`
+	MemberID  int64      `json:"member_id"`
+	Purpose   string     `json:"purpose"`
+	IP        string     `json:"ip"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// LoginEvent is one entry in the sign-in audit log. Email is stored lower
+// case; MemberID is nil when the email matched no member.
+type LoginEvent struct {
+	ID        int64     `json:"id"`
+	Event     string    `json:"event"`
+	MemberID  *int64    `json:"member_id"`
+	Email     string    `json:"email"`
+	Method    string    `json:"method"`
+	Detail    string    `json:"detail"`
+	SessionID *int64    `json:"session_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EventFilters holds optional constraints for listing login events.
+type EventFilters struct {
+	MemberID *int64
+	Email    string
+	Event    string
+	Limit    int
+	Offset   int
+}
+
+// Passkey is a member's registered WebAuthn credential. PublicKey is the
+// COSE key from registration.
+type Passkey struct {
+	ID           int64      `json:"id"`
+	MemberID     int64      `json:"member_id"`
+	CredentialID Base64URL  `json:"credential_id"`
+	PublicKey    []byte     `json:"-"`
+	Alg          int64      `json:"alg"`
+	SignCount    uint32     `json:"sign_count"`
+	Name         string     `json:"name"`
+	Transports   []string   `json:"transports"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Challenge is an outstanding WebAuthn ceremony. MemberID is set for
+// registration; sign-in challenges are not tied to a member because the
+// passkey identifies them.
+type Challenge struct {
+	Challenge []byte
+	Kind      string
+	MemberID  *int64
+	ExpiresAt time.Time
+}
+
+// API token kinds. Personal tokens act for a member; service tokens belong
+// to an integration and act as the admin accountable for it.
+const (
+	TokenPersonal = "personal"
+	TokenService  = "service"
+)
+
+// TokenAreas are the API areas scopes can be granted on, each as
+// "area:read" or "area:write". They match the first path segment under
+// /api, so votes fall under proposals. The auth area is left out: tokens
+// cannot manage credentials.
+var TokenAreas = []string{
+	"announcements", "attachments", "bank", "budgets", "capital", "dues", "fx",
+	"hours", "invoices", "ledger", "members", "patronage", "payments",
+	"proposals", "reimbursements", "reports",
+}
+
+// ValidScope reports whether s is a grantable scope.
+func ValidScope(s string) bool {
+	area, access, ok := strings.Cut(s, ":")
+	if !ok || (access != "read" && access != "write") {
+		return false
+	}
+	for _, a := range TokenAreas {
+		if a == area {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is an integration credential. The token itself is shown once,
+// when created; Prefix identifies it afterwards.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Kind       string     `json:"kind"`
+	MemberID   int64      `json:"member_id"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	CreatedBy  *int64     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	RevokedBy  *int64     `json:"revoked_by"`
+}
+
+// Active reports whether t can authenticate at now.
+func (t APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// TokenFilters holds optional constraints for listing API tokens.
+type TokenFilters struct {
+	MemberID       *int64
+	IncludeRevoked bool
+}
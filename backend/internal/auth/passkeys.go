@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Passkey defaults.
+const (
+	DefaultCeremonyTimeout = 5 * time.Minute
+	DefaultFreshSignIn     = 15 * time.Minute
+)
+
+// Passkeys configures WebAuthn passkey sign-in.
+type Passkeys struct {
+	// RPID is the relying party id, the site's registrable domain, e.g.
+	// "coop.example". RPName is shown by the authenticator.
+	RPID   string
+	RPName string
+	// Origins are the web origins ceremonies may come from.
+	Origins []string
+	// Timeout bounds a ceremony. Adding a passkey needs a session started
+	// within FreshSignIn, so a stolen session cannot plant one. Zero
+	// values use the defaults.
+	Timeout     time.Duration
+	FreshSignIn time.Duration
+}
+
+func (k *Passkeys) timeout() time.Duration {
+	if k.Timeout <= 0 {
+		return DefaultCeremonyTimeout
+	}
+	return k.Timeout
+}
+
+func (k *Passkeys) freshSignIn() time.Duration {
+	if k.FreshSignIn <= 0 {
+		return DefaultFreshSignIn
+	}
+	return k.FreshSignIn
+}
+
+type credentialParam struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions in its JSON form,
+// for PublicKeyCredential.parseCreationOptionsFromJSON.
+type CreationOptions struct {
+	Challenge Base64URL `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          Base64URL `json:"id"`
+		Name        string    `json:"name"`
+		DisplayName string    `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []credentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey        string `json:"residentKey"`
+		RequireResidentKey bool   `json:"requireResidentKey"`
+		UserVerification   string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions in its JSON form.
+// AllowCredentials is empty: passkeys are discoverable, so the member
+// picks one without typing anything.
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+}
+
+// RegistrationResponse is a serialized PublicKeyCredential from
+// navigator.credentials.create.
+type RegistrationResponse struct {
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is a serialized PublicKeyCredential from
+// navigator.credentials.get.
+type AssertionResponse struct {
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle"`
+	} `json:"response"`
+}
+
+// memberHandle is the WebAuthn user handle for a member: their id as eight
+// big-endian bytes, which carries no personal data.
+func memberHandle(memberID int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(memberID))
+	return b
+}
+
+func (k *Passkeys) newChallenge(ctx context.Context, repo Repo, kind string, memberID *int64, now time.Time) ([]byte, error) {
+	c := make([]byte, 32)
+	if _, err := rand.Read(c); err != nil {
+		return nil, err
+	}
+	return c, repo.CreateChallenge(ctx, Challenge{Challenge: c, Kind: kind, MemberID: memberID, ExpiresAt: now.Add(k.timeout())})
+}
+
+// checkClientData verifies the ceremony type and origin and consumes the
+// challenge it answers.
+func (k *Passkeys) checkClientData(ctx context.Context, repo Repo, raw []byte, kind string, now time.Time) (Challenge, error) {
+	cd, challenge, err := parseClientData(raw)
+	if err != nil {
+		return Challenge{}, err
+	}
+	want := "webauthn.get"
+	if kind == CeremonyRegister {
+		want = "webauthn.create"
+	}
+	if cd.Type != want {
+		return Challenge{}, errors.New("wrong ceremony type")
+	}
+	if cd.CrossOrigin || !k.originAllowed(cd.Origin) {
+		return Challenge{}, errors.New("origin not allowed")
+	}
+	c, err := repo.UseChallenge(ctx, challenge, kind, now)
+	if err == ErrChallenge {
+		return Challenge{}, errors.New("unknown or expired challenge")
+	}
+	return c, err
+}
+
+func (k *Passkeys) originAllowed(origin string) bool {
+	for _, o := range k.Origins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRegistration checks a registration response for memberID and
+// returns the credential to store.
+func (k *Passkeys) verifyRegistration(ctx context.Context, repo Repo, memberID int64, resp RegistrationResponse, now time.Time) (Passkey, error) {
+	if resp.Type != "public-key" {
+		return Passkey{}, errWebAuthn
+	}
+	c, err := k.checkClientData(ctx, repo, resp.Response.ClientDataJSON, CeremonyRegister, now)
+	if err != nil {
+		return Passkey{}, err
+	}
+	if c.MemberID == nil || *c.MemberID != memberID {
+		return Passkey{}, errors.New("challenge belongs to another member")
+	}
+	ad, err := parseAttestation(resp.Response.AttestationObject)
+	if err != nil {
+		return Passkey{}, err
+	}
+	if err := ad.check(k.RPID); err != nil {
+		return Passkey{}, err
+	}
+	if ad.CredentialID == nil || string(ad.CredentialID) != string(resp.RawID) {
+		return Passkey{}, errors.New("credential id mismatch")
+	}
+	key, err := parseCOSEKey(ad.PublicKey)
+	if err != nil {
+		return Passkey{}, err
+	}
+	return Passkey{
+		MemberID:     memberID,
+		CredentialID: ad.CredentialID,
+		PublicKey:    ad.PublicKey,
+		Alg:          key.Alg,
+		SignCount:    ad.SignCount,
+		Transports:   resp.Response.Transports,
+		CreatedAt:    now,
+	}, nil
+}
+
+// verifyAssertion checks a sign-in response and returns the passkey used
+// with its new signature counter. Once the passkey is known it is returned
+// with any error too, for the audit log.
+func (k *Passkeys) verifyAssertion(ctx context.Context, repo Repo, resp AssertionResponse, now time.Time) (Passkey, error) {
+	if resp.Type != "public-key" {
+		return Passkey{}, errWebAuthn
+	}
+	if _, err := k.checkClientData(ctx, repo, resp.Response.ClientDataJSON, CeremonyLogin, now); err != nil {
+		return Passkey{}, err
+	}
+	pk, err := repo.PasskeyByCredential(ctx, resp.RawID)
+	if err == ErrNotFound {
+		return Passkey{}, errors.New("unknown or revoked passkey")
+	}
+	if err != nil {
+		return Passkey{}, err
+	}
+	if h := resp.Response.UserHandle; len(h) > 0 && string(h) != string(memberHandle(pk.MemberID)) {
+		return pk, errors.New("user handle mismatch")
+	}
+	ad, err := parseAuthData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return pk, err
+	}
+	if err := ad.check(k.RPID); err != nil {
+		return pk, err
+	}
+	key, err := parseCOSEKey(pk.PublicKey)
+	if err != nil {
+		return pk, err
+	}
+	if !key.verify(resp.Response.AuthenticatorData, resp.Response.ClientDataJSON, resp.Response.Signature) {
+		return pk, errors.New("bad signature")
+	}
+	// Authenticators that count must count up; a repeat suggests a clone.
+	if (ad.SignCount != 0 || pk.SignCount != 0) && ad.SignCount <= pk.SignCount {
+		return pk, errors.New("signature counter did not increase")
+	}
+	pk.SignCount = ad.SignCount
+	return pk, nil
+}
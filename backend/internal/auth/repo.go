@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound    = errors.New("session not found")
+	ErrLinkInvalid = errors.New("login link not found")
+	ErrLinkUsed    = errors.New("login link already used")
+	ErrLinkExpired = errors.New("login link expired")
+	ErrChallenge   = errors.New("webauthn challenge not found")
+	ErrDuplicate   = errors.New("passkey already registered")
+)
+
+type Repo interface {
+	Create(ctx context.Context, s Session, tokenHash []byte) (Session, error)
+	Get(ctx context.Context, id int64) (Session, error)
+	// ByToken finds the session whose current token hashes to hash, or
+	// whose previous token does if it was rotated after graceSince.
+	// previous reports the latter.
+	ByToken(ctx context.Context, hash []byte, graceSince time.Time) (s Session, previous bool, err error)
+	Touch(ctx context.Context, id int64, at time.Time) error
+	// Rotate replaces the token of session id if it was still issued at
+	// issuedAt; ok is false when a concurrent request rotated it first.
+	Rotate(ctx context.Context, id int64, issuedAt time.Time, newHash []byte, at time.Time) (ok bool, err error)
+	// Revoke ends one of memberID's sessions; ErrNotFound if it is not
+	// theirs or already revoked.
+	Revoke(ctx context.Context, memberID, id int64, at time.Time) error
+	RevokeAll(ctx context.Context, memberID int64, at time.Time) (int64, error)
+	ListActive(ctx context.Context, memberID int64, now time.Time) ([]Session, error)
+
+	CreateMagicLink(ctx context.Context, l MagicLink, tokenHash []byte) (MagicLink, error)
+	// UseMagicLink marks the link with this token hash used at now and
+	// returns it: ErrLinkInvalid, ErrLinkUsed or ErrLinkExpired otherwise.
+	UseMagicLink(ctx context.Context, tokenHash []byte, now time.Time) (MagicLink, error)
+
+	RecordEvent(ctx context.Context, e LoginEvent) error
+	// CountEvents counts events of one kind since a time, for an email
+	// and for an IP address.
+	CountEvents(ctx context.Context, event, email, ip string, since time.Time) (byEmail, byIP int, err error)
+	ListEvents(ctx context.Context, f EventFilters) ([]LoginEvent, error)
+
+	CreateChallenge(ctx context.Context, c Challenge) error
+	// UseChallenge consumes an unexpired challenge of the given kind;
+	// ErrChallenge if there is none.
+	UseChallenge(ctx context.Context, challenge []byte, kind string, now time.Time) (Challenge, error)
+	// CreatePasskey stores a credential; ErrDuplicate if its credential id
+	// is already registered.
+	CreatePasskey(ctx context.Context, p Passkey) (Passkey, error)
+	// PasskeyByCredential finds an unrevoked credential.
+	PasskeyByCredential(ctx context.Context, credentialID []byte) (Passkey, error)
+	ListPasskeys(ctx context.Context, memberID int64) ([]Passkey, error)
+	RenamePasskey(ctx context.Context, memberID, id int64, name string) (Passkey, error)
+	RevokePasskey(ctx context.Context, memberID, id int64, at time.Time) error
+	// UsePasskey records a sign-in with the authenticator's new counter.
+	UsePasskey(ctx context.Context, id int64, signCount uint32, at time.Time) error
+
+	CreateToken(ctx context.Context, t APIToken, tokenHash []byte) (APIToken, error)
+	GetToken(ctx context.Context, id int64) (APIToken, error)
+	TokenByHash(ctx context.Context, tokenHash []byte) (APIToken, error)
+	ListTokens(ctx context.Context, f TokenFilters) ([]APIToken, error)
+	TouchToken(ctx context.Context, id int64, at time.Time, ip string) error
+	// RevokeToken returns ErrNotFound if the token is unknown or already
+	// revoked.
+	RevokeToken(ctx context.Context, id, by int64, at time.Time) error
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const columns = `id, member_id, method, user_agent, ip, created_at, token_issued_at, last_seen_at, expires_at, revoked_at`
+
+func scanSession(row pgx.Row, extra ...any) (Session, error) {
+	var s Session
+	dest := append([]any{&s.ID, &s.MemberID, &s.Method, &s.UserAgent, &s.IP, &s.CreatedAt, &s.TokenIssuedAt, &s.LastSeenAt, &s.ExpiresAt, &s.RevokedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, ErrNotFound
+		}
+		return Session{}, err
+	}
+	return s, nil
+}
+
+func (r *PgRepo) Create(ctx context.Context, s Session, tokenHash []byte) (Session, error) {
+	return scanSession(r.Pool.QueryRow(ctx, `
+INSERT INTO auth_sessions (member_id, token_hash, method, user_agent, ip, created_at, token_issued_at, last_seen_at, expires_at)
+VALUES ($1,$2,$3,$4,$5,$6,$6,$6,$7)
+RETURNING `+columns, s.MemberID, tokenHash, s.Method, s.UserAgent, s.IP, s.CreatedAt, s.ExpiresAt))
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int64) (Session, error) {
+	return scanSession(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM auth_sessions WHERE id=$1`, id))
+}
+
+func (r *PgRepo) ByToken(ctx context.Context, hash []byte, graceSince time.Time) (Session, bool, error) {
+	var previous bool
+	s, err := scanSession(r.Pool.QueryRow(ctx, `
+SELECT `+columns+`, token_hash <> $1
+FROM auth_sessions
+WHERE token_hash = $1 OR (prev_token_hash = $1 AND token_issued_at > $2)
+LIMIT 1`, hash, graceSince), &previous)
+	return s, previous, err
+}
+
+func (r *PgRepo) Touch(ctx context.Context, id int64, at time.Time) error {
+	_, err := r.Pool.Exec(ctx, `UPDATE auth_sessions SET last_seen_at=$2 WHERE id=$1 AND last_seen_at < $2`, id, at)
+	return err
+}
+
+func (r *PgRepo) Rotate(ctx context.Context, id int64, issuedAt time.Time, newHash []byte, at time.Time) (bool, error) {
+	tag, err := r.Pool.Exec(ctx, `
+UPDATE auth_sessions
+SET prev_token_hash=token_hash, token_hash=$3, token_issued_at=$4, last_seen_at=$4
+WHERE id=$1 AND token_issued_at=$2 AND revoked_at IS NULL`, id, issuedAt, newHash, at)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgRepo) Revoke(ctx context.Context, memberID, id int64, at time.Time) error {
+	tag, err := r.Pool.Exec(ctx, `UPDATE auth_sessions SET revoked_at=$3 WHERE id=$2 AND member_id=$1 AND revoked_at IS NULL`, memberID, id, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgRepo) RevokeAll(ctx context.Context, memberID int64, at time.Time) (int64, error) {
+	tag, err := r.Pool.Exec(ctx, `UPDATE auth_sessions SET revoked_at=$2 WHERE member_id=$1 AND revoked_at IS NULL`, memberID, at)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *PgRepo) ListActive(ctx context.Context, memberID int64, now time.Time) ([]Session, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT `+columns+` FROM auth_sessions
+WHERE member_id=$1 AND revoked_at IS NULL AND expires_at > $2
+ORDER BY last_seen_at DESC, id DESC`, memberID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) CreateMagicLink(ctx context.Context, l MagicLink, tokenHash []byte) (MagicLink, error) {
+	err := r.Pool.QueryRow(ctx, `
+INSERT INTO auth_magic_links (member_id, purpose, token_hash, ip, created_at, expires_at)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id`, l.MemberID, l.Purpose, tokenHash, l.IP, l.CreatedAt, l.ExpiresAt).Scan(&l.ID)
+	return l, err
+}
+
+func (r *PgRepo) UseMagicLink(ctx context.Context, tokenHash []byte, now time.Time) (MagicLink, error) {
+	var l MagicLink
+	err := r.Pool.QueryRow(ctx, `
+UPDATE auth_magic_links SET used_at=$2
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > $2
+RETURNING id, member_id, purpose, ip, created_at, expires_at, used_at`, tokenHash, now).Scan(&l.ID, &l.MemberID, &l.Purpose, &l.IP, &l.CreatedAt, &l.ExpiresAt, &l.UsedAt)
+	if err == nil {
+		return l, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return MagicLink{}, err
+	}
+	var used *time.Time
+	err = r.Pool.QueryRow(ctx, `SELECT used_at FROM auth_magic_links WHERE token_hash=$1`, tokenHash).Scan(&used)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return MagicLink{}, ErrLinkInvalid
+	case err != nil:
+		return MagicLink{}, err
+	case used != nil:
+		return MagicLink{}, ErrLinkUsed
+	}
+	return MagicLink{}, ErrLinkExpired
+}
+
+func (r *PgRepo) RecordEvent(ctx context.Context, e LoginEvent) error {
+	_, err := r.Pool.Exec(ctx, `
+INSERT INTO auth_login_events (event, member_id, email, method, detail, session_id, ip, user_agent, created_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`, e.Event, e.MemberID, e.Email, e.Method, e.Detail, e.SessionID, e.IP, e.UserAgent, e.CreatedAt)
+	return err
+}
+
+func (r *PgRepo) CountEvents(ctx context.Context, event, email, ip string, since time.Time) (int, int, error) {
+	var byEmail, byIP int
+	err := r.Pool.QueryRow(ctx, `
+SELECT count(*) FILTER (WHERE email = $2), count(*) FILTER (WHERE ip = $3)
+FROM auth_login_events
+WHERE event = $1 AND created_at > $4 AND (email = $2 OR ip = $3)`, event, email, ip, since).Scan(&byEmail, &byIP)
+	return byEmail, byIP, err
+}
+
+func (r *PgRepo) ListEvents(ctx context.Context, f EventFilters) ([]LoginEvent, error) {
+	q := `SELECT id, event, member_id, email, method, detail, session_id, ip, user_agent, created_at
+FROM auth_login_events
+WHERE ($1::bigint IS NULL OR member_id=$1) AND ($2 = '' OR email=$2) AND ($3 = '' OR event=$3)
+ORDER BY created_at DESC, id DESC`
+	args := []any{f.MemberID, f.Email, f.Event}
+	if f.Limit > 0 {
+		q += ` LIMIT $4 OFFSET $5`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		q += ` OFFSET $4`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []LoginEvent{}
+	for rows.Next() {
+		var e LoginEvent
+		if err := rows.Scan(&e.ID, &e.Event, &e.MemberID, &e.Email, &e.Method, &e.Detail, &e.SessionID, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) CreateChallenge(ctx context.Context, c Challenge) error {
+	_, err := r.Pool.Exec(ctx, `
+INSERT INTO auth_webauthn_challenges (challenge, kind, member_id, expires_at)
+VALUES ($1,$2,$3,$4)`, c.Challenge, c.Kind, c.MemberID, c.ExpiresAt)
+	return err
+}
+
+func (r *PgRepo) UseChallenge(ctx context.Context, challenge []byte, kind string, now time.Time) (Challenge, error) {
+	c := Challenge{Challenge: challenge, Kind: kind}
+	err := r.Pool.QueryRow(ctx, `
+UPDATE auth_webauthn_challenges SET used_at=$3
+WHERE challenge=$1 AND kind=$2 AND used_at IS NULL AND expires_at > $3
+RETURNING member_id, expires_at`, challenge, kind, now).Scan(&c.MemberID, &c.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Challenge{}, ErrChallenge
+	}
+	// Old challenges are only ever read once; drop them on the way.
+	if err == nil {
+		_, err = r.Pool.Exec(ctx, `DELETE FROM auth_webauthn_challenges WHERE expires_at < $1`, now.Add(-24*time.Hour))
+	}
+	return c, err
+}
+
+const passkeyColumns = `id, member_id, credential_id, public_key, alg, sign_count, name, transports, created_at, last_used_at, revoked_at`
+
+func scanPasskey(row pgx.Row) (Passkey, error) {
+	var p Passkey
+	var transports string
+	var count int64
+	err := row.Scan(&p.ID, &p.MemberID, &p.CredentialID, &p.PublicKey, &p.Alg, &count, &p.Name, &transports, &p.CreatedAt, &p.LastUsedAt, &p.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Passkey{}, ErrNotFound
+	}
+	p.SignCount = uint32(count)
+	p.Transports = []string{}
+	if transports != "" {
+		p.Transports = strings.Split(transports, ",")
+	}
+	return p, err
+}
+
+func (r *PgRepo) CreatePasskey(ctx context.Context, p Passkey) (Passkey, error) {
+	out, err := scanPasskey(r.Pool.QueryRow(ctx, `
+INSERT INTO auth_passkeys (member_id, credential_id, public_key, alg, sign_count, name, transports, created_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+RETURNING `+passkeyColumns, p.MemberID, []byte(p.CredentialID), p.PublicKey, p.Alg, int64(p.SignCount), p.Name, strings.Join(p.Transports, ","), p.CreatedAt))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return Passkey{}, ErrDuplicate
+	}
+	return out, err
+}
+
+func (r *PgRepo) PasskeyByCredential(ctx context.Context, credentialID []byte) (Passkey, error) {
+	return scanPasskey(r.Pool.QueryRow(ctx, `SELECT `+passkeyColumns+` FROM auth_passkeys WHERE credential_id=$1 AND revoked_at IS NULL`, credentialID))
+}
+
+func (r *PgRepo) ListPasskeys(ctx context.Context, memberID int64) ([]Passkey, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+passkeyColumns+` FROM auth_passkeys WHERE member_id=$1 AND revoked_at IS NULL ORDER BY created_at, id`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Passkey{}
+	for rows.Next() {
+		p, err := scanPasskey(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) RenamePasskey(ctx context.Context, memberID, id int64, name string) (Passkey, error) {
+	return scanPasskey(r.Pool.QueryRow(ctx, `
+UPDATE auth_passkeys SET name=$3
+WHERE id=$2 AND member_id=$1 AND revoked_at IS NULL
+RETURNING `+passkeyColumns, memberID, id, name))
+}
+
+func (r *PgRepo) RevokePasskey(ctx context.Context, memberID, id int64, at time.Time) error {
+	tag, err := r.Pool.Exec(ctx, `UPDATE auth_passkeys SET revoked_at=$3 WHERE id=$2 AND member_id=$1 AND revoked_at IS NULL`, memberID, id, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgRepo) UsePasskey(ctx context.Context, id int64, signCount uint32, at time.Time) error {
+	_, err := r.Pool.Exec(ctx, `UPDATE auth_passkeys SET sign_count=$2, last_used_at=$3 WHERE id=$1`, id, int64(signCount), at)
+	return err
+}
+
+const tokenColumns = `id, name, kind, member_id, prefix, scopes, expires_at, created_by, created_at, last_used_at, last_used_ip, revoked_at, revoked_by`
+
+func scanToken(row pgx.Row) (APIToken, error) {
+	var t APIToken
+	err := row.Scan(&t.ID, &t.Name, &t.Kind, &t.MemberID, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.CreatedBy, &t.CreatedAt, &t.LastUsedAt, &t.LastUsedIP, &t.RevokedAt, &t.RevokedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIToken{}, ErrNotFound
+	}
+	return t, err
+}
+
+func (r *PgRepo) CreateToken(ctx context.Context, t APIToken, tokenHash []byte) (APIToken, error) {
+	return scanToken(r.Pool.QueryRow(ctx, `
+INSERT INTO auth_api_tokens (name, kind, member_id, token_hash, prefix, scopes, expires_at, created_by, created_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+RETURNING `+tokenColumns, t.Name, t.Kind, t.MemberID, tokenHash, t.Prefix, t.Scopes, t.ExpiresAt, t.CreatedBy, t.CreatedAt))
+}
+
+func (r *PgRepo) GetToken(ctx context.Context, id int64) (APIToken, error) {
+	return scanToken(r.Pool.QueryRow(ctx, `SELECT `+tokenColumns+` FROM auth_api_tokens WHERE id=$1`, id))
+}
+
+func (r *PgRepo) TokenByHash(ctx context.Context, tokenHash []byte) (APIToken, error) {
+	return scanToken(r.Pool.QueryRow(ctx, `SELECT `+tokenColumns+` FROM auth_api_tokens WHERE token_hash=$1`, tokenHash))
+}
+
+func (r *PgRepo) ListTokens(ctx context.Context, f TokenFilters) ([]APIToken, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT `+tokenColumns+` FROM auth_api_tokens
+WHERE ($1::bigint IS NULL OR member_id=$1) AND ($2 OR revoked_at IS NULL)
+ORDER BY created_at DESC, id DESC`, f.MemberID, f.IncludeRevoked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []APIToken{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) TouchToken(ctx context.Context, id int64, at time.Time, ip string) error {
+	_, err := r.Pool.Exec(ctx, `UPDATE auth_api_tokens SET last_used_at=$2, last_used_ip=$3 WHERE id=$1`, id, at, ip)
+	return err
+}
+
+func (r *PgRepo) RevokeToken(ctx context.Context, id, by int64, at time.Time) error {
+	tag, err := r.Pool.Exec(ctx, `UPDATE auth_api_tokens SET revoked_at=$3, revoked_by=$2 WHERE id=$1 AND revoked_at IS NULL`, id, by, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		if h.AllowDevLogin {
+			r.Post("/dev/login", h.DevLogin)
+		}
+		if h.Links != nil {
+			r.Post("/magic-link", h.RequestLink)
+			r.Post("/magic-link/redeem", h.RedeemLink)
+		}
+		if h.Passkeys != nil {
+			r.Post("/passkeys/login/begin", h.PasskeyLoginBegin)
+			r.Post("/passkeys/login/finish", h.PasskeyLoginFinish)
+			r.Group(func(r chi.Router) {
+				r.Use(httpmw.RequireAuth)
+				r.Get("/passkeys", h.ListPasskeys)
+				r.Post("/passkeys/register/begin", h.PasskeyRegisterBegin)
+				r.Post("/passkeys/register/finish", h.PasskeyRegisterFinish)
+				r.Put("/passkeys/{id}", h.RenamePasskey)
+				r.Delete("/passkeys/{id}", h.RevokePasskey)
+			})
+		}
+		// Logging out is harmless without a session; it just clears the cookie.
+		r.Post("/logout", h.Logout)
+		r.Group(func(r chi.Router) {
+			r.Use(httpmw.RequireAuth)
+			r.Get("/session", h.Current)
+			r.Post("/session/refresh", h.Refresh)
+			r.Post("/logout-all", h.LogoutAll)
+			r.Get("/sessions", h.ListSessions)
+			r.Delete("/sessions/{id}", h.RevokeSession)
+			r.With(httpmw.RequirePermission("audit.read")).Get("/login-events", h.ListEvents)
+			r.Group(func(r chi.Router) {
+				r.Use(httpmw.RequirePermission("tokens.manage"))
+				r.Post("/tokens", h.CreateToken)
+				r.Get("/tokens", h.ListTokens)
+				r.Get("/tokens/{id}", h.GetToken)
+				r.Delete("/tokens/{id}", h.RevokeToken)
+			})
+		})
+	}
+	r.Route("/auth", route)
+}
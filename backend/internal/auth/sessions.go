@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+)
+
+// Session lifetime defaults.
+const (
+	DefaultTTL         = 30 * 24 * time.Hour
+	DefaultIdleTimeout = 7 * 24 * time.Hour
+	DefaultRotateEvery = time.Hour
+)
+
+const (
+	// rotationGrace keeps a replaced token valid for requests already in
+	// flight when it was rotated.
+	rotationGrace = time.Minute
+	// touchEvery limits last_seen_at writes to one per session per minute.
+	touchEvery = time.Minute
+)
+
+// Manager issues sessions and resolves their tokens. It implements
+// httpmw.SessionResolver.
+type Manager struct {
+	Repo Repo
+	// Members loads the member a session belongs to.
+	Members httpmw.MemberFetcher
+	// TTL caps a session's total lifetime, IdleTimeout ends it after that
+	// long unused and RotateEvery is how often a cookie's token is
+	// replaced. Zero values use the defaults; a negative IdleTimeout or
+	// RotateEvery disables it.
+	TTL         time.Duration
+	IdleTimeout time.Duration
+	RotateEvery time.Duration
+	// CookieName defaults to httpmw.DefaultSessionCookie. Insecure drops
+	// the Secure attribute for plain-HTTP development setups.
+	CookieName string
+	Insecure   bool
+	// Now is the clock; nil means time.Now.
+	Now func() time.Time
+}
+
+func (m *Manager) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func (m *Manager) ttl() time.Duration {
+	if m.TTL <= 0 {
+		return DefaultTTL
+	}
+	return m.TTL
+}
+
+func (m *Manager) idle() time.Duration {
+	if m.IdleTimeout == 0 {
+		return DefaultIdleTimeout
+	}
+	return m.IdleTimeout
+}
+
+func (m *Manager) rotateEvery() time.Duration {
+	if m.RotateEvery == 0 {
+		return DefaultRotateEvery
+	}
+	return m.RotateEvery
+}
+
+func (m *Manager) cookieName() string {
+	if m.CookieName == "" {
+		return httpmw.DefaultSessionCookie
+	}
+	return m.CookieName
+}
+
+// Issue starts a new session for memberID, sets the session cookie and
+// returns the token for clients that send it as a bearer token instead.
+func (m *Manager) Issue(ctx context.Context, w http.ResponseWriter, r *http.Request, memberID int64, method string) (Issued, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return Issued{}, err
+	}
+	now := m.now()
+	s, err := m.Repo.Create(ctx, Session{
+		MemberID:  memberID,
+		Method:    method,
+		UserAgent: truncate(r.UserAgent(), 300),
+		IP:        clientIP(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.ttl()),
+	}, hash)
+	if err != nil {
+		return Issued{}, err
+	}
+	s.Current = true
+	m.setCookie(w, token, s.ExpiresAt)
+	return Issued{Token: token, ExpiresAt: s.ExpiresAt, Session: s}, nil
+}
+
+// ResolveSession implements httpmw.SessionResolver for sessions and, as
+// bearer tokens only, API tokens. Cookie tokens older than RotateEvery are
+// replaced on the way through; bearer clients rotate explicitly with
+// Refresh.
+func (m *Manager) ResolveSession(w http.ResponseWriter, r *http.Request, token string, fromCookie bool) (httpmw.Principal, bool, error) {
+	if strings.HasPrefix(token, APITokenPrefix) {
+		if fromCookie {
+			return httpmw.Principal{}, false, nil
+		}
+		return m.resolveAPIToken(r, token)
+	}
+	ctx := r.Context()
+	now := m.now()
+	s, previous, err := m.Repo.ByToken(ctx, hashToken(token), now.Add(-rotationGrace))
+	if err == ErrNotFound || (err == nil && !s.Active(now, m.idle())) {
+		if fromCookie {
+			m.ClearCookie(w)
+		}
+		return httpmw.Principal{}, false, nil
+	}
+	if err != nil {
+		return httpmw.Principal{}, false, err
+	}
+	p, found, err := m.Members(ctx, s.MemberID)
+	if err != nil || !found {
+		return httpmw.Principal{}, false, err
+	}
+	p.Via, p.SessionID = "session", s.ID
+	if fromCookie && !previous && m.rotateEvery() > 0 && now.Sub(s.TokenIssuedAt) >= m.rotateEvery() {
+		if _, err := m.rotate(ctx, w, s, now); err != nil && err != ErrNotFound {
+			return httpmw.Principal{}, false, err
+		}
+		return p, true, nil
+	}
+	if now.Sub(s.LastSeenAt) >= touchEvery {
+		if err := m.Repo.Touch(ctx, s.ID, now); err != nil {
+			return httpmw.Principal{}, false, err
+		}
+	}
+	return p, true, nil
+}
+
+// Refresh replaces the token of session id at once and returns the new one.
+func (m *Manager) Refresh(ctx context.Context, w http.ResponseWriter, id int64) (Issued, error) {
+	s, err := m.Repo.Get(ctx, id)
+	if err != nil {
+		return Issued{}, err
+	}
+	now := m.now()
+	if !s.Active(now, m.idle()) {
+		return Issued{}, ErrNotFound
+	}
+	return m.rotate(ctx, w, s, now)
+}
+
+// rotate swaps in a new token for s. When a concurrent request got there
+// first the cookie is left alone; that request's response carries the new
+// one and this request's token stays valid for the grace period.
+func (m *Manager) rotate(ctx context.Context, w http.ResponseWriter, s Session, now time.Time) (Issued, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return Issued{}, err
+	}
+	ok, err := m.Repo.Rotate(ctx, s.ID, s.TokenIssuedAt, hash, now)
+	if err != nil {
+		return Issued{}, err
+	}
+	if !ok {
+		return Issued{}, ErrNotFound
+	}
+	s.TokenIssuedAt, s.LastSeenAt, s.Current = now, now, true
+	m.setCookie(w, token, s.ExpiresAt)
+	return Issued{Token: token, ExpiresAt: s.ExpiresAt, Session: s}, nil
+}
+
+func (m *Manager) setCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   !m.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearCookie expires the session cookie in the browser.
+func (m *Manager) ClearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.cookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !m.Insecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// newToken returns a random 256-bit token and the hash stored for it.
+func newToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	return strings.ToValidUTF8(s, "")
+}
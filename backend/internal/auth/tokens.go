@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+)
+
+// APITokenPrefix starts every API token, telling them apart from session
+// tokens and making leaked ones easy to scan for.
+const APITokenPrefix = "coop_"
+
+// Token lifetimes, in days.
+const (
+	DefaultTokenDays = 90
+	MaxTokenDays     = 365
+)
+
+// newAPIToken returns a new API token, its stored hash and the prefix
+// shown in listings.
+func newAPIToken() (token string, hash []byte, prefix string, err error) {
+	raw, _, err := newToken()
+	if err != nil {
+		return "", nil, "", err
+	}
+	token = APITokenPrefix + raw
+	return token, hashToken(token), token[:len(APITokenPrefix)+6], nil
+}
+
+// resolveAPIToken is ResolveSession for API tokens.
+func (m *Manager) resolveAPIToken(r *http.Request, token string) (httpmw.Principal, bool, error) {
+	ctx, now := r.Context(), m.now()
+	t, err := m.Repo.TokenByHash(ctx, hashToken(token))
+	if err == ErrNotFound || (err == nil && !t.Active(now)) {
+		return httpmw.Principal{}, false, nil
+	}
+	if err != nil {
+		return httpmw.Principal{}, false, err
+	}
+	p, found, err := m.Members(ctx, t.MemberID)
+	if err != nil || !found {
+		return httpmw.Principal{}, false, err
+	}
+	p.Via, p.TokenID, p.Scopes = "token", t.ID, append([]string{}, t.Scopes...)
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) >= touchEvery {
+		if err := m.Repo.TouchToken(ctx, t.ID, now, clientIP(r)); err != nil {
+			return httpmw.Principal{}, false, err
+		}
+	}
+	return p, true, nil
+}
+
+// normalizeScopes trims, dedupes and sorts scopes, dropping a read scope
+// when the write scope for its area is also granted.
+func normalizeScopes(in []string) ([]string, string) {
+	set := map[string]bool{}
+	for _, s := range in {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !ValidScope(s) {
+			return nil, s
+		}
+		set[s] = true
+	}
+	out := []string{}
+	for _, a := range TokenAreas {
+		if set[a+":write"] {
+			out = append(out, a+":write")
+		} else if set[a+":read"] {
+			out = append(out, a+":read")
+		}
+	}
+	return out, ""
+}
+
+// tokenExpiry is now plus days, defaulting and capped as documented.
+func tokenExpiry(now time.Time, days int) time.Time {
+	if days <= 0 {
+		days = DefaultTokenDays
+	}
+	return now.Add(time.Duration(days) * 24 * time.Hour)
+}
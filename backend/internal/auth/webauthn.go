@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// COSE algorithms accepted for passkeys, in order of preference.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+var errWebAuthn = errors.New("invalid webauthn response")
+
+// clientData is the parsed clientDataJSON of a ceremony.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func parseClientData(raw []byte) (clientData, []byte, error) {
+	var c clientData
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return clientData{}, nil, errWebAuthn
+	}
+	challenge, err := b64(c.Challenge)
+	if err != nil || len(challenge) == 0 {
+		return clientData{}, nil, errWebAuthn
+	}
+	return c, challenge, nil
+}
+
+// authData is parsed authenticator data. CredentialID and PublicKey are
+// set only when it carries attested credential data (registration).
+type authData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthData(b []byte) (authData, error) {
+	if len(b) < 37 {
+		return authData{}, errWebAuthn
+	}
+	a := authData{RPIDHash: b[:32], Flags: b[32], SignCount: binary.BigEndian.Uint32(b[33:37])}
+	rest := b[37:]
+	if a.Flags&flagAttested != 0 {
+		if len(rest) < 18 {
+			return authData{}, errWebAuthn
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > 1023 || len(rest) < n {
+			return authData{}, errWebAuthn
+		}
+		a.CredentialID, rest = rest[:n], rest[n:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authData{}, errWebAuthn
+		}
+		a.PublicKey, rest = rest[:len(rest)-len(after)], after
+	}
+	if a.Flags&flagExtensions != 0 {
+		var err error
+		if _, rest, err = decodeCBOR(rest); err != nil {
+			return authData{}, errWebAuthn
+		}
+	}
+	if len(rest) != 0 {
+		return authData{}, errWebAuthn
+	}
+	return a, nil
+}
+
+// check verifies the relying party and that the user was present and
+// verified.
+func (a authData) check(rpID string) error {
+	want := sha256.Sum256([]byte(rpID))
+	if string(a.RPIDHash) != string(want[:]) {
+		return errors.New("wrong relying party")
+	}
+	if a.Flags&flagUserPresent == 0 || a.Flags&flagUserVerified == 0 {
+		return errors.New("user not verified")
+	}
+	return nil
+}
+
+// parseAttestation returns the authenticator data of an attestationObject.
+// Attestation statements are not verified: registration asks for "none",
+// since members bring whatever authenticator they have.
+func parseAttestation(b []byte) (authData, error) {
+	v, rest, err := decodeCBOR(b)
+	m, ok := v.(map[any]any)
+	if err != nil || !ok || len(rest) != 0 {
+		return authData{}, errWebAuthn
+	}
+	raw, ok := m["authData"].([]byte)
+	if !ok {
+		return authData{}, errWebAuthn
+	}
+	return parseAuthData(raw)
+}
+
+// coseKey is a credential public key with its COSE algorithm.
+type coseKey struct {
+	Alg int64
+	Key crypto.PublicKey
+}
+
+func parseCOSEKey(b []byte) (coseKey, error) {
+	v, _, err := decodeCBOR(b)
+	m, ok := v.(map[any]any)
+	if err != nil || !ok {
+		return coseKey{}, errWebAuthn
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+	bytesAt := func(k int64) []byte { v, _ := m[k].([]byte); return v }
+	switch {
+	case alg == AlgES256 && kty == 2:
+		crv, _ := m[int64(-1)].(int64)
+		x, y := bytesAt(-2), bytesAt(-3)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return coseKey{}, errWebAuthn
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return coseKey{}, errWebAuthn
+		}
+		return coseKey{Alg: alg, Key: pub}, nil
+	case alg == AlgEdDSA && kty == 1:
+		crv, _ := m[int64(-1)].(int64)
+		x := bytesAt(-2)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return coseKey{}, errWebAuthn
+		}
+		return coseKey{Alg: alg, Key: ed25519.PublicKey(x)}, nil
+	case alg == AlgRS256 && kty == 3:
+		n, e := bytesAt(-1), bytesAt(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return coseKey{}, errWebAuthn
+		}
+		return coseKey{Alg: alg, Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}}, nil
+	}
+	return coseKey{}, errors.New("unsupported key algorithm")
+}
+
+// verify checks an assertion signature over authenticatorData followed by
+// the SHA-256 of clientDataJSON.
+func (k coseKey) verify(authenticatorData, clientDataJSON, sig []byte) bool {
+	h := sha256.Sum256(clientDataJSON)
+	msg := append(append([]byte(nil), authenticatorData...), h[:]...)
+	switch pub := k.Key.(type) {
+	case *ecdsa.PublicKey:
+		d := sha256.Sum256(msg)
+		return ecdsa.VerifyASN1(pub, d[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, msg, sig)
+	case *rsa.PublicKey:
+		d := sha256.Sum256(msg)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, d[:], sig) == nil
+	}
+	return false
+}
+
+// Base64URL is bytes carried in JSON as unpadded base64url, the encoding
+// WebAuthn uses for binary fields.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := b64(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+// b64 decodes base64url with or without padding, as browsers send it.
+func b64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,408 @@
+package bank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxStatementBytes caps uploaded statement size.
+const maxStatementBytes = 10 << 20
+
+// LedgerPoster is the subset of ledger.Repo used to create entries from the
+// review queue.
+type LedgerPoster interface {
+	Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+// Import handles POST /api/bank/statements. The statement is the request
+// body, or the "file" field of a multipart form.
+// Query: format=ofx|qfx|csv (default: detected), account, filename,
+// date_format=mdy|dmy (CSV only; default mdy), window (matching days)
+func (h Handlers) Import(w http.ResponseWriter, r *http.Request) {
+	window, ok := matchWindow(w, r)
+	if !ok {
+		return
+	}
+	dateFormat := r.URL.Query().Get("date_format")
+	if dateFormat != "" && dateFormat != "mdy" && dateFormat != "dmy" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "date_format must be 'mdy' or 'dmy'")
+		return
+	}
+	data, filename, err := readStatement(w, r)
+	if err != nil || len(data) == 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "statement file required")
+		return
+	}
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = DetectFormat(data)
+	}
+	parsed, err := Parse(data, format, dateFormat == "dmy")
+	if err != nil {
+		if errors.Is(err, ErrUnknownFormat) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "format must be 'ofx', 'qfx', or 'csv'")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid statement: "+err.Error())
+		return
+	}
+	st := Statement{Account: parsed.Account, Format: parsed.Format, Filename: filename}
+	if a := strings.TrimSpace(r.URL.Query().Get("account")); a != "" {
+		st.Account = a
+	}
+	if p, ok := httpmw.FromContext(r.Context()); ok {
+		st.ImportedBy = &p.MemberID
+	}
+	saved, lines, err := h.Repo.Import(r.Context(), st, parsed.Lines)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "import failed")
+		return
+	}
+	matched, err := h.autoMatch(r.Context(), lines, window)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "matching failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(ImportResult{Statement: saved, Imported: len(lines), Duplicates: saved.DuplicateCount, Matched: matched})
+}
+
+// ListStatements handles GET /api/bank/statements
+func (h Handlers) ListStatements(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListStatements(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Statement{}
+	}
+	writeJSON(w, items)
+}
+
+// ListLines handles GET /api/bank/lines. The review queue is
+// ?status=unmatched.
+// Query: status, statement_id, limit, offset
+func (h Handlers) ListLines(w http.ResponseWriter, r *http.Request) {
+	f := LineFilters{Status: r.URL.Query().Get("status")}
+	if f.Status != "" && !ValidStatus(f.Status) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "status must be 'unmatched', 'matched', or 'ignored'")
+		return
+	}
+	if s := r.URL.Query().Get("statement_id"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid statement_id")
+			return
+		}
+		v32 := int32(v)
+		f.StatementID = &v32
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 500)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.ListLines(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Line{}
+	}
+	writeJSON(w, items)
+}
+
+// RunMatching handles POST /api/bank/match and retries automatic matching
+// for every unmatched line. Query: window (days, default 5)
+func (h Handlers) RunMatching(w http.ResponseWriter, r *http.Request) {
+	window, ok := matchWindow(w, r)
+	if !ok {
+		return
+	}
+	lines, err := h.Repo.ListLines(r.Context(), LineFilters{Status: StatusUnmatched})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	matched, err := h.autoMatch(r.Context(), lines, window)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "matching failed")
+		return
+	}
+	writeJSON(w, map[string]int{"matched": matched, "unmatched": len(lines) - matched})
+}
+
+// Suggestions handles GET /api/bank/lines/{id}/suggestions and lists ledger
+// entries that could match the line, best first.
+func (h Handlers) Suggestions(w http.ResponseWriter, r *http.Request) {
+	line, ok := h.line(w, r)
+	if !ok {
+		return
+	}
+	window, ok := matchWindow(w, r)
+	if !ok {
+		return
+	}
+	cands, err := h.Repo.Candidates(r.Context(), line.PostedOn.AddDate(0, 0, -window), line.PostedOn.AddDate(0, 0, window))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	type suggestion struct {
+		Candidate
+		Score int `json:"score"`
+	}
+	out := []suggestion{}
+	for _, c := range cands {
+		if s, ok := Score(line, c, window); ok {
+			out = append(out, suggestion{Candidate: c, Score: s})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	writeJSON(w, out)
+}
+
+// MatchLine handles POST /api/bank/lines/{id}/match
+// Body: {"ledger_entry_id": 12}
+func (h Handlers) MatchLine(w http.ResponseWriter, r *http.Request) {
+	id, ok := lineID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		LedgerEntryID int32 `json:"ledger_entry_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.LedgerEntryID <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "ledger_entry_id required")
+		return
+	}
+	line, err := h.Repo.SetMatch(r.Context(), id, in.LedgerEntryID)
+	h.writeLine(w, line, err)
+}
+
+// UnmatchLine handles POST /api/bank/lines/{id}/unmatch
+func (h Handlers) UnmatchLine(w http.ResponseWriter, r *http.Request) {
+	id, ok := lineID(w, r)
+	if !ok {
+		return
+	}
+	line, err := h.Repo.Unmatch(r.Context(), id)
+	h.writeLine(w, line, err)
+}
+
+// IgnoreLine handles POST /api/bank/lines/{id}/ignore
+func (h Handlers) IgnoreLine(w http.ResponseWriter, r *http.Request) {
+	id, ok := lineID(w, r)
+	if !ok {
+		return
+	}
+	line, err := h.Repo.Ignore(r.Context(), id)
+	h.writeLine(w, line, err)
+}
+
+// CreateEntry handles POST /api/bank/lines/{id}/entry. It posts an unmatched
+// line's amount to the ledger as a new entry and matches the line to it.
+// Body: {"type":"expense","description":"...","notes":"...","member_id":3}
+func (h Handlers) CreateEntry(w http.ResponseWriter, r *http.Request) {
+	line, ok := h.line(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Type        string `json:"type"`
+		Description string `json:"description"`
+		Notes       string `json:"notes"`
+		MemberID    *int32 `json:"member_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if !ledger.ValidType(in.Type) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	if line.Status != StatusUnmatched {
+		httpmw.WriteJSONError(w, http.StatusConflict, "line already reconciled")
+		return
+	}
+	desc := strings.TrimSpace(in.Description)
+	if desc == "" {
+		desc = line.Description
+	}
+	if desc == "" {
+		desc = "Bank transaction " + line.PostedOn.Format(httpx.DateLayout)
+	}
+	notes := in.Notes
+	if notes == "" {
+		notes = fmt.Sprintf("Bank line %d (%s)", line.ID, line.PostedOn.Format(httpx.DateLayout))
+	}
+	var entry ledger.LedgerEntry
+	var postErr error
+	matched, err := h.Repo.PostLine(r.Context(), line.ID, func(l Line) (int32, error) {
+		entry, _, postErr = h.Ledger.Create(r.Context(), in.Type, desc, l.Amount, in.MemberID, notes, l.PostKey())
+		return entry.ID, postErr
+	})
+	if postErr != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "ledger post failed")
+		return
+	}
+	if err != nil {
+		h.writeLine(w, matched, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"line": matched, "entry": entry})
+}
+
+// Reconciliation handles GET /api/bank/reconciliation and lists ledger
+// entries with their reconciliation status.
+// Query: from, to (YYYY-MM-DD), status=reconciled|unreconciled
+func (h Handlers) Reconciliation(w http.ResponseWriter, r *http.Request) {
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "reconciled" && status != "unreconciled" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "status must be 'reconciled' or 'unreconciled'")
+		return
+	}
+	items, err := h.Repo.Reconciliation(r.Context(), from, to, status)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	if items == nil {
+		items = []EntryStatus{}
+	}
+	writeJSON(w, items)
+}
+
+// autoMatch matches lines against unreconciled entries dated within window
+// days of the lines' posting dates.
+func (h Handlers) autoMatch(ctx context.Context, lines []Line, window int) (int, error) {
+	if len(lines) == 0 {
+		return 0, nil
+	}
+	from, to := lines[0].PostedOn, lines[0].PostedOn
+	for _, l := range lines {
+		if l.PostedOn.Before(from) {
+			from = l.PostedOn
+		}
+		if l.PostedOn.After(to) {
+			to = l.PostedOn
+		}
+	}
+	cands, err := h.Repo.Candidates(ctx, from.AddDate(0, 0, -window), to.AddDate(0, 0, window))
+	if err != nil {
+		return 0, err
+	}
+	matches := AutoMatch(lines, cands, window)
+	if len(matches) == 0 {
+		return 0, nil
+	}
+	return h.Repo.ApplyMatches(ctx, matches)
+}
+
+func (h Handlers) line(w http.ResponseWriter, r *http.Request) (Line, bool) {
+	id, ok := lineID(w, r)
+	if !ok {
+		return Line{}, false
+	}
+	line, err := h.Repo.GetLine(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Line{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return Line{}, false
+	}
+	return line, true
+}
+
+func (h Handlers) writeLine(w http.ResponseWriter, line Line, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, line)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrEntryNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "ledger entry not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "line or entry already reconciled")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+	}
+}
+
+func readStatement(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatementBytes)
+	filename := r.URL.Query().Get("filename")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, hdr, err := r.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+		defer f.Close()
+		if filename == "" {
+			filename = hdr.Filename
+		}
+		data, err := io.ReadAll(f)
+		return data, filename, err
+	}
+	data, err := io.ReadAll(r.Body)
+	return data, filename, err
+}
+
+func matchWindow(w http.ResponseWriter, r *http.Request) (int, bool) {
+	s := r.URL.Query().Get("window")
+	if s == "" {
+		return DefaultWindowDays, true
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 31 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "window must be 0-31 days")
+		return 0, false
+	}
+	return v, true
+}
+
+func lineID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
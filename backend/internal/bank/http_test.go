@@ -0,0 +1,446 @@
+package bank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+// mockRepo keeps statements, lines and the ledger entries they reconcile
+// against in memory.
+type mockRepo struct {
+	statements []Statement
+	lines      []Line
+	entries    *mockLedger
+}
+
+func (m *mockRepo) Import(_ context.Context, st Statement, parsed []ParsedLine) (Statement, []Line, error) {
+	st.ID = int32(len(m.statements) + 1)
+	var inserted []Line
+	for _, p := range parsed {
+		dup := false
+		for _, l := range m.lines {
+			if l.Account == st.Account && l.Reference == p.Reference {
+				dup = true
+			}
+		}
+		if dup {
+			continue
+		}
+		l := Line{ID: int32(len(m.lines) + 1), StatementID: st.ID, Account: st.Account, PostedOn: p.PostedOn, Amount: p.Amount, Description: p.Description, Reference: p.Reference, Status: StatusUnmatched}
+		m.lines = append(m.lines, l)
+		inserted = append(inserted, l)
+	}
+	st.LineCount, st.DuplicateCount = len(inserted), len(parsed)-len(inserted)
+	m.statements = append(m.statements, st)
+	return st, inserted, nil
+}
+
+func (m *mockRepo) ListStatements(_ context.Context) ([]Statement, error) {
+	return m.statements, nil
+}
+
+func (m *mockRepo) ListLines(_ context.Context, f LineFilters) ([]Line, error) {
+	var out []Line
+	for _, l := range m.lines {
+		if (f.Status == "" || l.Status == f.Status) && (f.StatementID == nil || l.StatementID == *f.StatementID) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetLine(_ context.Context, id int32) (Line, error) {
+	if id < 1 || int(id) > len(m.lines) {
+		return Line{}, ErrNotFound
+	}
+	return m.lines[id-1], nil
+}
+
+func (m *mockRepo) matchedLine(entryID int32) *Line {
+	for i, l := range m.lines {
+		if l.LedgerEntryID != nil && *l.LedgerEntryID == entryID {
+			return &m.lines[i]
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) Candidates(_ context.Context, from, to time.Time) ([]Candidate, error) {
+	var out []Candidate
+	for _, e := range m.entries.entries {
+		if e.CreatedAt.Before(from) || !e.CreatedAt.Before(to.AddDate(0, 0, 1)) || m.matchedLine(e.ID) != nil {
+			continue
+		}
+		out = append(out, Candidate{ID: e.ID, Amount: e.Amount, Description: e.Description, CreatedAt: e.CreatedAt})
+	}
+	return out, nil
+}
+
+func (m *mockRepo) ApplyMatches(ctx context.Context, matches []Match) (int, error) {
+	n := 0
+	for _, mt := range matches {
+		if _, err := m.SetMatch(ctx, mt.LineID, mt.LedgerEntryID); err == nil {
+			score := mt.Score
+			m.lines[mt.LineID-1].MatchScore = &score
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockRepo) SetMatch(_ context.Context, lineID, entryID int32) (Line, error) {
+	if lineID < 1 || int(lineID) > len(m.lines) {
+		return Line{}, ErrNotFound
+	}
+	if int(entryID) > len(m.entries.entries) {
+		return Line{}, ErrEntryNotFound
+	}
+	l := &m.lines[lineID-1]
+	if l.Status != StatusUnmatched || m.matchedLine(entryID) != nil {
+		return Line{}, ErrConflict
+	}
+	l.Status, l.LedgerEntryID = StatusMatched, &entryID
+	return *l, nil
+}
+
+func (m *mockRepo) PostLine(ctx context.Context, lineID int32, post func(Line) (int32, error)) (Line, error) {
+	if lineID < 1 || int(lineID) > len(m.lines) {
+		return Line{}, ErrNotFound
+	}
+	if m.lines[lineID-1].Status != StatusUnmatched {
+		return Line{}, ErrConflict
+	}
+	entryID, err := post(m.lines[lineID-1])
+	if err != nil {
+		return Line{}, err
+	}
+	return m.SetMatch(ctx, lineID, entryID)
+}
+
+func (m *mockRepo) Unmatch(_ context.Context, lineID int32) (Line, error) {
+	if lineID < 1 || int(lineID) > len(m.lines) {
+		return Line{}, ErrNotFound
+	}
+	l := &m.lines[lineID-1]
+	if l.Status == StatusUnmatched {
+		return Line{}, ErrConflict
+	}
+	l.Status, l.LedgerEntryID, l.MatchScore = StatusUnmatched, nil, nil
+	l.Unmatches++
+	return *l, nil
+}
+
+func (m *mockRepo) Ignore(_ context.Context, lineID int32) (Line, error) {
+	if lineID < 1 || int(lineID) > len(m.lines) {
+		return Line{}, ErrNotFound
+	}
+	l := &m.lines[lineID-1]
+	if l.Status != StatusUnmatched {
+		return Line{}, ErrConflict
+	}
+	l.Status = StatusIgnored
+	return *l, nil
+}
+
+func (m *mockRepo) Reconciliation(_ context.Context, _, _ *time.Time, status string) ([]EntryStatus, error) {
+	var out []EntryStatus
+	for _, e := range m.entries.entries {
+		s := EntryStatus{ID: e.ID, Type: e.Type, Amount: e.Amount, Description: e.Description, CreatedAt: e.CreatedAt, Status: "unreconciled"}
+		if l := m.matchedLine(e.ID); l != nil {
+			s.Status, s.BankLineID = "reconciled", &l.ID
+		}
+		if status == "" || s.Status == status {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// mockLedger returns the original entry for a repeated idempotency key,
+// as the ledger does.
+type mockLedger struct {
+	entries []ledger.LedgerEntry
+	keys    map[string]int
+}
+
+func (m *mockLedger) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error) {
+	if i, ok := m.keys[idempotencyKey]; ok && idempotencyKey != "" {
+		return m.entries[i], true, nil
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 1), Type: entryType, Amount: amount, Description: description, MemberID: memberID, Notes: notes, CreatedAt: time.Now()}
+	if m.keys == nil {
+		m.keys = map[string]int{}
+	}
+	m.keys[idempotencyKey] = len(m.entries)
+	m.entries = append(m.entries, e)
+	return e, false, nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo, l LedgerPoster) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role := "member"
+		if id == 1 {
+			role = "admin"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Ledger: l})
+	return r
+}
+
+func do(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", "1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+const sampleOFX = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKACCTFROM><BANKID>123<ACCTID>987654<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20250103120000[-5:EST]
+<TRNAMT>50.00
+<FITID>T1
+<NAME>ACH DEPOSIT
+<MEMO>Dues J Smith
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20250110
+<TRNAMT>-1,200.00
+<FITID>T2
+<NAME>Rent &amp; Utilities
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`
+
+// ---- Tests ----
+
+func TestParseOFX(t *testing.T) {
+	if DetectFormat([]byte(sampleOFX)) != "ofx" || DetectFormat([]byte("Date,Amount\n")) != "csv" {
+		t.Fatal("format detection failed")
+	}
+	p, err := ParseOFX([]byte(sampleOFX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Account != "987654" || len(p.Lines) != 2 {
+		t.Fatalf("unexpected parse: %+v", p)
+	}
+	l := p.Lines[0]
+	if !l.PostedOn.Equal(day(2025, 1, 3)) || l.Amount != 50 || l.Description != "ACH DEPOSIT Dues J Smith" || l.Reference != "T1" {
+		t.Errorf("unexpected first line: %+v", l)
+	}
+	if l := p.Lines[1]; l.Amount != -1200 || l.Description != "Rent & Utilities" {
+		t.Errorf("unexpected second line: %+v", l)
+	}
+	if _, err := ParseOFX([]byte("<OFX><STMTTRN><DTPOSTED>2025<TRNAMT>1</STMTTRN></OFX>")); err == nil {
+		t.Error("expected invalid DTPOSTED to fail")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	in := "Posted Date,Payee,Debit,Credit\n03/01/2025,Hardware store,\"$1,024.50\",\n04/01/2025,Member dues,,50\n04/01/2025,Member dues,,50\n"
+	p, err := ParseCSV(strings.NewReader(in), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(p.Lines))
+	}
+	if l := p.Lines[0]; !l.PostedOn.Equal(day(2025, 1, 3)) || l.Amount != -1024.5 {
+		t.Errorf("unexpected debit line: %+v", l)
+	}
+	// identical rows get distinct fingerprints
+	if p.Lines[1].Reference == p.Lines[2].Reference || !strings.HasPrefix(p.Lines[1].Reference, "csv:") {
+		t.Errorf("expected distinct references, got %q and %q", p.Lines[1].Reference, p.Lines[2].Reference)
+	}
+
+	p, err = ParseCSV(strings.NewReader("Date,Description,Amount\n2025-02-01,Refund,(12.00)\n"), false)
+	if err != nil || p.Lines[0].Amount != -12 {
+		t.Fatalf("expected parenthesized negative, got %+v %v", p, err)
+	}
+	for _, bad := range []string{"Foo,Bar\n1,2\n", "Date,Description,Amount\n31/31/2025,x,1\n", "Date,Description,Amount\n2025-01-01,x,abc\n"} {
+		if _, err := ParseCSV(strings.NewReader(bad), false); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestAutoMatch(t *testing.T) {
+	lines := []Line{
+		{ID: 1, PostedOn: day(2025, 1, 3), Amount: 50, Description: "Dues J Smith", Status: StatusUnmatched},
+		{ID: 2, PostedOn: day(2025, 1, 4), Amount: 50, Description: "Dues A Lee", Status: StatusUnmatched},
+		{ID: 3, PostedOn: day(2025, 1, 20), Amount: -80, Description: "Supplies", Status: StatusUnmatched},
+	}
+	cands := []Candidate{
+		{ID: 10, Amount: 50, Description: "Monthly dues Lee", CreatedAt: day(2025, 1, 3).Add(15 * time.Hour)},
+		{ID: 11, Amount: 50, Description: "Monthly dues Smith", CreatedAt: day(2025, 1, 2)},
+		{ID: 12, Amount: -80, Description: "Supplies", CreatedAt: day(2025, 1, 1)},
+	}
+	got := AutoMatch(lines, cands, DefaultWindowDays)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 matches, got %+v", got)
+	}
+	want := map[int32]int32{1: 11, 2: 10}
+	for _, m := range got {
+		if want[m.LineID] != m.LedgerEntryID {
+			t.Errorf("line %d matched entry %d", m.LineID, m.LedgerEntryID)
+		}
+	}
+}
+
+func TestHandlers_RepostAfterUnmatch(t *testing.T) {
+	l := &mockLedger{}
+	repo := &mockRepo{entries: l}
+	r := setupRouter(repo, l)
+	if rr := do(r, "POST", "/bank/statements", sampleOFX); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	post := func(body string) (Line, ledger.LedgerEntry) {
+		rr := do(r, "POST", "/bank/lines/1/entry", body)
+		var res struct {
+			Line  Line               `json:"line"`
+			Entry ledger.LedgerEntry `json:"entry"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &res)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+		}
+		return res.Line, res.Entry
+	}
+	_, first := post(`{"type":"income"}`)
+	if rr := do(r, "POST", "/bank/lines/1/unmatch", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for unmatch, got %d", rr.Code)
+	}
+	line, second := post(`{"type":"income","description":"Corrected"}`)
+	if second.ID == first.ID || second.Description != "Corrected" || *line.LedgerEntryID != second.ID || len(l.entries) != 2 {
+		t.Fatalf("expected a new entry on re-post, got %+v after %+v", second, first)
+	}
+}
+
+func TestHandlers_ImportAndReview(t *testing.T) {
+	l := &mockLedger{entries: []ledger.LedgerEntry{
+		{ID: 1, Type: "dues", Amount: 50, Description: "Dues J Smith", CreatedAt: day(2025, 1, 2)},
+		{ID: 2, Type: "income", Amount: 75, Description: "Workshop fees", CreatedAt: day(2025, 1, 5)},
+	}}
+	repo := &mockRepo{entries: l}
+	r := setupRouter(repo, l)
+
+	// non-admin
+	req := httptest.NewRequest("POST", "/bank/statements", strings.NewReader(sampleOFX))
+	req.Header.Set("X-User-Id", "2")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+
+	rr = do(r, "POST", "/bank/statements?filename=jan.ofx", sampleOFX)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var res ImportResult
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if res.Imported != 2 || res.Matched != 1 || res.Statement.Account != "987654" || res.Statement.Filename != "jan.ofx" {
+		t.Fatalf("unexpected import result: %+v", res)
+	}
+
+	// re-importing the same statement only records duplicates
+	rr = do(r, "POST", "/bank/statements", sampleOFX)
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if res.Imported != 0 || res.Duplicates != 2 {
+		t.Fatalf("expected duplicates on re-import, got %+v", res)
+	}
+
+	// review queue holds the rent payment
+	rr = do(r, "GET", "/bank/lines?status=unmatched", "")
+	var queue []Line
+	_ = json.Unmarshal(rr.Body.Bytes(), &queue)
+	if len(queue) != 1 || queue[0].Amount != -1200 {
+		t.Fatalf("unexpected review queue: %+v", queue)
+	}
+
+	// one-click entry creation
+	rr = do(r, "POST", "/bank/lines/2/entry", `{"type":"expense"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if e := l.entries[2]; e.Type != "expense" || e.Amount != -1200 || e.Description != "Rent & Utilities" {
+		t.Fatalf("unexpected created entry: %+v", e)
+	}
+	if rr = do(r, "POST", "/bank/lines/2/entry", `{"type":"expense"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for reconciled line, got %d", rr.Code)
+	}
+	if len(l.entries) != 3 {
+		t.Fatalf("expected no second entry for a reconciled line, got %d entries", len(l.entries))
+	}
+	if rr = do(r, "POST", "/bank/lines/2/entry", `{"type":"bogus"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad type, got %d", rr.Code)
+	}
+
+	// reconciliation status
+	rr = do(r, "GET", "/bank/reconciliation?status=unreconciled", "")
+	var open []EntryStatus
+	_ = json.Unmarshal(rr.Body.Bytes(), &open)
+	if len(open) != 1 || open[0].ID != 2 {
+		t.Fatalf("unexpected unreconciled entries: %+v", open)
+	}
+
+	// manual match after unmatching
+	if rr = do(r, "POST", "/bank/lines/1/unmatch", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr = do(r, "POST", "/bank/lines/1/match", `{"ledger_entry_id":3}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for already matched entry, got %d", rr.Code)
+	}
+	if rr = do(r, "POST", "/bank/lines/1/match", `{"ledger_entry_id":1}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr = do(r, "POST", "/bank/lines/1/ignore", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 ignoring matched line, got %d", rr.Code)
+	}
+	if rr = do(r, "POST", "/bank/lines/9/ignore", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+
+	// bad input
+	for _, tc := range []struct{ path, body string }{
+		{"/bank/statements", ""},
+		{"/bank/statements?format=xls", "x"},
+		{"/bank/statements?format=csv", "Date,Description,Amount\nnope,x,1\n"},
+		{"/bank/statements?window=90", sampleOFX},
+	} {
+		if rr = do(r, "POST", tc.path, tc.body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tc.path, rr.Code)
+		}
+	}
+}
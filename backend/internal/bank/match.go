@@ -0,0 +1,97 @@
+package bank
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultWindowDays is how far a ledger entry's date may be from the bank
+// posting date and still be considered a match.
+const DefaultWindowDays = 5
+
+// Score rates how well a ledger entry matches a bank line, or returns false
+// when they cannot match. Amounts must agree to the cent and dates must be
+// within windowDays. Closer dates and overlapping description words score
+// higher; the best possible score is 130.
+func Score(l Line, c Candidate, windowDays int) (int, bool) {
+	if math.Round(l.Amount*100) != math.Round(c.Amount*100) {
+		return 0, false
+	}
+	y, m, d := c.CreatedAt.UTC().Date()
+	entryDay := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	days := int(math.Abs(entryDay.Sub(l.PostedOn).Hours()) / 24)
+	if days > windowDays {
+		return 0, false
+	}
+	score := 100 - days*5
+	if score < 10 {
+		score = 10
+	}
+	return score + int(math.Round(30*similarity(l.Description, c.Description))), true
+}
+
+// AutoMatch pairs unmatched lines with candidate entries, best score first.
+// Each line and each entry is used at most once; ties go to the earlier line
+// and then the earlier entry so results are stable.
+func AutoMatch(lines []Line, candidates []Candidate, windowDays int) []Match {
+	var all []Match
+	for _, l := range lines {
+		if l.Status != StatusUnmatched {
+			continue
+		}
+		for _, c := range candidates {
+			if s, ok := Score(l, c, windowDays); ok {
+				all = append(all, Match{LineID: l.ID, LedgerEntryID: c.ID, Score: s})
+			}
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Score != all[j].Score {
+			return all[i].Score > all[j].Score
+		}
+		if all[i].LineID != all[j].LineID {
+			return all[i].LineID < all[j].LineID
+		}
+		return all[i].LedgerEntryID < all[j].LedgerEntryID
+	})
+	usedLine, usedEntry := map[int32]bool{}, map[int32]bool{}
+	out := []Match{}
+	for _, m := range all {
+		if usedLine[m.LineID] || usedEntry[m.LedgerEntryID] {
+			continue
+		}
+		usedLine[m.LineID], usedEntry[m.LedgerEntryID] = true, true
+		out = append(out, m)
+	}
+	return out
+}
+
+// similarity is the Jaccard index of the significant words in a and b.
+func similarity(a, b string) float64 {
+	wa, wb := words(a), words(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
+
+func words(s string) map[string]bool {
+	out := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) >= 3 {
+			out[w] = true
+		}
+	}
+	return out
+}
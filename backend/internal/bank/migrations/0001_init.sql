@@ -0,0 +1,33 @@
+-- backend/internal/bank/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS bank_statements (
+  id SERIAL PRIMARY KEY,
+  account TEXT NOT NULL DEFAULT '',
+  format TEXT NOT NULL CHECK (format IN ('ofx','csv')),
+  filename TEXT NOT NULL DEFAULT '',
+  line_count INTEGER NOT NULL DEFAULT 0,
+  duplicate_count INTEGER NOT NULL DEFAULT 0,
+  imported_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  imported_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS bank_lines (
+  id SERIAL PRIMARY KEY,
+  statement_id INTEGER NOT NULL REFERENCES bank_statements(id) ON DELETE CASCADE,
+  account TEXT NOT NULL DEFAULT '',
+  posted_on DATE NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  reference TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'unmatched' CHECK (status IN ('unmatched','matched','ignored')),
+  ledger_entry_id INTEGER REFERENCES ledger_entries(id),
+  match_score INTEGER,
+  matched_at TIMESTAMPTZ,
+  UNIQUE (account, reference),
+  CHECK (status <> 'matched' OR ledger_entry_id IS NOT NULL)
+);
+
+-- A ledger entry reconciles against at most one bank line.
+CREATE UNIQUE INDEX IF NOT EXISTS bank_lines_ledger_entry_id_uidx
+  ON bank_lines (ledger_entry_id) WHERE ledger_entry_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS bank_lines_status_idx ON bank_lines (status);
+CREATE INDEX IF NOT EXISTS bank_lines_statement_id_idx ON bank_lines (statement_id);
@@ -0,0 +1,4 @@
+-- backend/internal/bank/migrations/0002_line_unmatches.sql
+-- Counts how often a line was returned to review, so a line posted again
+-- after an unmatch gets a fresh ledger idempotency key.
+ALTER TABLE bank_lines ADD COLUMN IF NOT EXISTS unmatches INT NOT NULL DEFAULT 0;
@@ -0,0 +1,101 @@
+package bank
+
+import (
+	"fmt"
+	"time"
+)
+
+// Statement is one imported bank statement file.
+type Statement struct {
+	ID             int32     `json:"id"`
+	Account        string    `json:"account"`
+	Format         string    `json:"format"`
+	Filename       string    `json:"filename"`
+	LineCount      int       `json:"line_count"`
+	DuplicateCount int       `json:"duplicate_count"`
+	ImportedBy     *int64    `json:"imported_by"`
+	ImportedAt     time.Time `json:"imported_at"`
+}
+
+// Line is a single bank transaction from a statement. Reference is the
+// bank's transaction id (OFX FITID) or a fingerprint for CSV rows and is
+// unique per account so re-importing an overlapping statement is harmless.
+type Line struct {
+	ID            int32      `json:"id"`
+	StatementID   int32      `json:"statement_id"`
+	Account       string     `json:"account"`
+	PostedOn      time.Time  `json:"posted_on"`
+	Amount        float64    `json:"amount"`
+	Description   string     `json:"description"`
+	Reference     string     `json:"reference"`
+	Status        string     `json:"status"`
+	LedgerEntryID *int32     `json:"ledger_entry_id"`
+	MatchScore    *int       `json:"match_score"`
+	MatchedAt     *time.Time `json:"matched_at"`
+	Unmatches     int        `json:"unmatches"`
+}
+
+// PostKey is the ledger idempotency key for posting the line. It changes
+// each time the line is unmatched, so posting again after an unmatch
+// creates a new entry rather than returning the one it was taken off.
+func (l Line) PostKey() string {
+	if l.Unmatches == 0 {
+		return fmt.Sprintf("bank:%d", l.ID)
+	}
+	return fmt.Sprintf("bank:%d:%d", l.ID, l.Unmatches)
+}
+
+// Line statuses.
+const (
+	StatusUnmatched = "unmatched"
+	StatusMatched   = "matched"
+	StatusIgnored   = "ignored"
+)
+
+// ValidStatus reports whether s is a known line status.
+func ValidStatus(s string) bool {
+	return s == StatusUnmatched || s == StatusMatched || s == StatusIgnored
+}
+
+// LineFilters holds optional constraints for listing lines.
+type LineFilters struct {
+	StatementID *int32
+	Status      string
+	Limit       int
+	Offset      int
+}
+
+// Candidate is a ledger entry not yet reconciled against a bank line.
+type Candidate struct {
+	ID          int32     `json:"id"`
+	Amount      float64   `json:"amount"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Match pairs a bank line with a ledger entry.
+type Match struct {
+	LineID        int32 `json:"line_id"`
+	LedgerEntryID int32 `json:"ledger_entry_id"`
+	Score         int   `json:"score"`
+}
+
+// EntryStatus is a ledger entry with its reconciliation status.
+type EntryStatus struct {
+	ID          int32      `json:"id"`
+	Type        string     `json:"type"`
+	Amount      float64    `json:"amount"`
+	Description string     `json:"description"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"` // reconciled|unreconciled
+	BankLineID  *int32     `json:"bank_line_id"`
+	PostedOn    *time.Time `json:"posted_on"`
+}
+
+// ImportResult summarizes a statement import.
+type ImportResult struct {
+	Statement  Statement `json:"statement"`
+	Imported   int       `json:"imported"`
+	Duplicates int       `json:"duplicates"`
+	Matched    int       `json:"matched"`
+}
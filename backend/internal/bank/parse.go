@@ -0,0 +1,269 @@
+package bank
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsedLine is a bank transaction read from a statement file.
+type ParsedLine struct {
+	PostedOn    time.Time
+	Amount      float64
+	Description string
+	Reference   string
+}
+
+// Parsed is the content of a statement file.
+type Parsed struct {
+	Format  string
+	Account string
+	Lines   []ParsedLine
+}
+
+// ErrUnknownFormat is returned when a statement is neither OFX/QFX nor CSV.
+var ErrUnknownFormat = errors.New("unrecognized statement format")
+
+// DetectFormat returns "ofx" for OFX/QFX content and "csv" otherwise.
+func DetectFormat(data []byte) string {
+	head := bytes.ToUpper(data[:min(len(data), 512)])
+	if bytes.Contains(head, []byte("OFXHEADER")) || bytes.Contains(head, []byte("<OFX>")) {
+		return "ofx"
+	}
+	return "csv"
+}
+
+// Parse reads a statement in the given format ("ofx", "qfx" or "csv").
+// dayFirst selects DD/MM/YYYY over MM/DD/YYYY for slash-separated CSV dates.
+func Parse(data []byte, format string, dayFirst bool) (Parsed, error) {
+	switch format {
+	case "ofx", "qfx":
+		return ParseOFX(data)
+	case "csv":
+		return ParseCSV(bytes.NewReader(data), dayFirst)
+	}
+	return Parsed{}, ErrUnknownFormat
+}
+
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ParseOFX reads STMTTRN records from OFX 1.x (SGML) or 2.x (XML) data.
+// QFX files are OFX with extra Intuit tags, which are ignored.
+func ParseOFX(data []byte) (Parsed, error) {
+	out := Parsed{Format: "ofx"}
+	var cur map[string]string
+	finish := func() error {
+		if cur == nil {
+			return nil
+		}
+		defer func() { cur = nil }()
+		l, err := ofxLine(cur)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", len(out.Lines)+1, err)
+		}
+		out.Lines = append(out.Lines, l)
+		return nil
+	}
+	for _, m := range ofxTag.FindAllSubmatch(data, -1) {
+		closing, name := len(m[1]) > 0, strings.ToUpper(string(m[2]))
+		value := html.UnescapeString(strings.TrimSpace(string(m[3])))
+		switch {
+		case name == "STMTTRN" && closing:
+			if err := finish(); err != nil {
+				return Parsed{}, err
+			}
+		case name == "STMTTRN":
+			// SGML files may omit closing tags; a new record ends the last one.
+			if err := finish(); err != nil {
+				return Parsed{}, err
+			}
+			cur = map[string]string{}
+		case closing:
+		case name == "ACCTID" && out.Account == "":
+			out.Account = value
+		case cur != nil:
+			cur[name] = value
+		}
+	}
+	if err := finish(); err != nil {
+		return Parsed{}, err
+	}
+	if len(out.Lines) == 0 {
+		return Parsed{}, errors.New("no transactions found")
+	}
+	return out, nil
+}
+
+func ofxLine(f map[string]string) (ParsedLine, error) {
+	var l ParsedLine
+	posted := f["DTPOSTED"]
+	if len(posted) < 8 {
+		return l, fmt.Errorf("invalid DTPOSTED %q", posted)
+	}
+	d, err := time.Parse("20060102", posted[:8])
+	if err != nil {
+		return l, fmt.Errorf("invalid DTPOSTED %q", posted)
+	}
+	amt, err := parseAmount(f["TRNAMT"])
+	if err != nil || amt == 0 {
+		return l, fmt.Errorf("invalid TRNAMT %q", f["TRNAMT"])
+	}
+	l.PostedOn, l.Amount = d, amt
+	l.Description = f["NAME"]
+	if memo := f["MEMO"]; memo != "" && memo != l.Description {
+		l.Description = strings.TrimSpace(l.Description + " " + memo)
+	}
+	l.Reference = f["FITID"]
+	if l.Reference == "" {
+		l.Reference = fingerprint("ofx", l, 0)
+	}
+	return l, nil
+}
+
+// CSV header names recognized for each field, lower case.
+var (
+	csvDate        = []string{"date", "posted date", "posting date", "transaction date", "booking date"}
+	csvAmount      = []string{"amount", "transaction amount"}
+	csvDebit       = []string{"debit", "withdrawal", "withdrawals", "money out"}
+	csvCredit      = []string{"credit", "deposit", "deposits", "money in"}
+	csvDescription = []string{"description", "payee", "name", "details", "narrative", "memo"}
+	csvReference   = []string{"reference", "transaction id", "fitid", "id"}
+)
+
+// ParseCSV reads a bank CSV export with a header row. It needs a date, a
+// description and either an amount column or separate debit/credit columns.
+// Debits are stored as negative amounts regardless of their sign in the file.
+func ParseCSV(r io.Reader, dayFirst bool) (Parsed, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return Parsed{}, err
+	}
+	if len(rows) < 2 {
+		return Parsed{}, errors.New("no transactions found")
+	}
+	header := map[string]int{}
+	for i, h := range rows[0] {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if _, ok := header[h]; !ok {
+			header[h] = i
+		}
+	}
+	col := func(names []string) int {
+		for _, n := range names {
+			if i, ok := header[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	dateCol, descCol, refCol := col(csvDate), col(csvDescription), col(csvReference)
+	amtCol, debitCol, creditCol := col(csvAmount), col(csvDebit), col(csvCredit)
+	if dateCol < 0 || descCol < 0 || (amtCol < 0 && debitCol < 0 && creditCol < 0) {
+		return Parsed{}, errors.New("csv header must include date, description and amount (or debit/credit) columns")
+	}
+
+	out := Parsed{Format: "csv"}
+	seen := map[string]int{}
+	for n, row := range rows[1:] {
+		field := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if strings.Join(row, "") == "" {
+			continue
+		}
+		lineNo := n + 2
+		d, err := parseCSVDate(field(dateCol), dayFirst)
+		if err != nil {
+			return Parsed{}, fmt.Errorf("line %d: invalid date %q", lineNo, field(dateCol))
+		}
+		var amt float64
+		if amtCol >= 0 {
+			amt, err = parseAmount(field(amtCol))
+		} else {
+			var debit, credit float64
+			if debit, err = parseAmount(field(debitCol)); err == nil {
+				credit, err = parseAmount(field(creditCol))
+			}
+			amt = credit - abs(debit)
+		}
+		if err != nil {
+			return Parsed{}, fmt.Errorf("line %d: invalid amount", lineNo)
+		}
+		if amt == 0 {
+			continue
+		}
+		l := ParsedLine{PostedOn: d, Amount: amt, Description: field(descCol), Reference: field(refCol)}
+		if l.Reference == "" {
+			// Identical rows on the same day are distinguished by occurrence.
+			key := fingerprint("csv", l, 0)
+			seen[key]++
+			l.Reference = fingerprint("csv", l, seen[key])
+		}
+		out.Lines = append(out.Lines, l)
+	}
+	if len(out.Lines) == 0 {
+		return Parsed{}, errors.New("no transactions found")
+	}
+	return out, nil
+}
+
+func parseCSVDate(s string, dayFirst bool) (time.Time, error) {
+	layouts := []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "20060102"}
+	if dayFirst {
+		layouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", "02/01/06", "02.01.2006", "20060102"}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseAmount accepts currency symbols, thousands separators and
+// accounting-style parentheses for negatives. Empty strings are zero.
+func parseAmount(s string) (float64, error) {
+	s = strings.NewReplacer("$", "", "€", "", "£", "", ",", "", " ", "").Replace(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg, s = true, s[1:len(s)-1]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func fingerprint(prefix string, l ParsedLine, n int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%.2f|%s|%d", l.PostedOn.Format("2006-01-02"), l.Amount, strings.ToLower(l.Description), n)))
+	return prefix + ":" + hex.EncodeToString(sum[:8])
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,357 @@
+package bank
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound      = errors.New("bank line not found")
+	ErrEntryNotFound = errors.New("ledger entry not found")
+	ErrConflict      = errors.New("bank line or ledger entry already reconciled")
+)
+
+type Repo interface {
+	// Import stores a statement and its lines, skipping lines whose
+	// (account, reference) was already imported. It returns the inserted lines.
+	Import(ctx context.Context, st Statement, lines []ParsedLine) (Statement, []Line, error)
+	ListStatements(ctx context.Context) ([]Statement, error)
+	ListLines(ctx context.Context, f LineFilters) ([]Line, error)
+	GetLine(ctx context.Context, id int32) (Line, error)
+	// Candidates lists ledger entries dated within the inclusive range that
+	// are not yet matched to a bank line.
+	Candidates(ctx context.Context, from, to time.Time) ([]Candidate, error)
+	// ApplyMatches records automatic matches, skipping any line or entry that
+	// was reconciled in the meantime. It returns the number applied.
+	ApplyMatches(ctx context.Context, matches []Match) (int, error)
+	// SetMatch matches an unmatched line to an unreconciled entry.
+	SetMatch(ctx context.Context, lineID, entryID int32) (Line, error)
+	// PostLine locks an unmatched line while post creates its ledger entry,
+	// then matches the line to that entry, so a line is posted at most once
+	// however many requests race for it.
+	PostLine(ctx context.Context, lineID int32, post func(Line) (int32, error)) (Line, error)
+	// Unmatch returns a matched or ignored line to the review queue and
+	// counts the unmatch, giving the line a new PostKey.
+	Unmatch(ctx context.Context, lineID int32) (Line, error)
+	// Ignore removes an unmatched line from the review queue.
+	Ignore(ctx context.Context, lineID int32) (Line, error)
+	// Reconciliation lists ledger entries in the optional inclusive date range
+	// with their reconciliation status; status filters to one of
+	// "reconciled" or "unreconciled" when set.
+	Reconciliation(ctx context.Context, from, to *time.Time, status string) ([]EntryStatus, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const lineColumns = `id, statement_id, account, posted_on, amount, description, reference, status, ledger_entry_id, match_score, matched_at, unmatches`
+
+const statementColumns = `id, account, format, filename, line_count, duplicate_count, imported_by, imported_at`
+
+func (r *PgRepo) Import(ctx context.Context, st Statement, lines []ParsedLine) (Statement, []Line, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Statement{}, nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id int32
+	if err := tx.QueryRow(ctx, `
+INSERT INTO bank_statements (account, format, filename, imported_by)
+VALUES ($1,$2,$3,$4)
+RETURNING id`, st.Account, st.Format, st.Filename, st.ImportedBy).Scan(&id); err != nil {
+		return Statement{}, nil, err
+	}
+	inserted := []Line{}
+	for _, pl := range lines {
+		l, err := scanLine(tx.QueryRow(ctx, `
+INSERT INTO bank_lines (statement_id, account, posted_on, amount, description, reference)
+VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (account, reference) DO NOTHING
+RETURNING `+lineColumns, id, st.Account, pl.PostedOn, pl.Amount, pl.Description, pl.Reference))
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return Statement{}, nil, err
+		}
+		inserted = append(inserted, l)
+	}
+	out, err := scanStatement(tx.QueryRow(ctx, `
+UPDATE bank_statements SET line_count=$2, duplicate_count=$3
+WHERE id=$1
+RETURNING `+statementColumns, id, len(inserted), len(lines)-len(inserted)))
+	if err != nil {
+		return Statement{}, nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Statement{}, nil, err
+	}
+	return out, inserted, nil
+}
+
+func (r *PgRepo) ListStatements(ctx context.Context) ([]Statement, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+statementColumns+` FROM bank_statements ORDER BY imported_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Statement
+	for rows.Next() {
+		st, err := scanStatement(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) ListLines(ctx context.Context, f LineFilters) ([]Line, error) {
+	query := `SELECT ` + lineColumns + ` FROM bank_lines WHERE ($1::int IS NULL OR statement_id=$1) AND ($2 = '' OR status=$2)
+ORDER BY posted_on, id`
+	args := []any{f.StatementID, f.Status}
+	if f.Limit > 0 {
+		query += ` LIMIT $3 OFFSET $4`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $3`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Line
+	for rows.Next() {
+		l, err := scanLine(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetLine(ctx context.Context, id int32) (Line, error) {
+	l, err := scanLine(r.Pool.QueryRow(ctx, `SELECT `+lineColumns+` FROM bank_lines WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Line{}, ErrNotFound
+	}
+	return l, err
+}
+
+func (r *PgRepo) Candidates(ctx context.Context, from, to time.Time) ([]Candidate, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT e.id, e.amount::float8, e.description, e.created_at
+FROM ledger_entries e
+WHERE e.created_at >= $1 AND e.created_at < $2
+  AND NOT EXISTS (SELECT 1 FROM bank_lines b WHERE b.ledger_entry_id = e.id)
+ORDER BY e.created_at, e.id`, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Candidate
+	for rows.Next() {
+		var c Candidate
+		if err := rows.Scan(&c.ID, &c.Amount, &c.Description, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) ApplyMatches(ctx context.Context, matches []Match) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	applied := 0
+	for _, m := range matches {
+		tag, err := tx.Exec(ctx, `
+UPDATE bank_lines SET status='matched', ledger_entry_id=$2, match_score=$3, matched_at=now()
+WHERE id=$1 AND status='unmatched'
+  AND NOT EXISTS (SELECT 1 FROM bank_lines WHERE ledger_entry_id=$2)`, m.LineID, m.LedgerEntryID, m.Score)
+		if err != nil {
+			return 0, err
+		}
+		applied += int(tag.RowsAffected())
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+func (r *PgRepo) SetMatch(ctx context.Context, lineID, entryID int32) (Line, error) {
+	var exists bool
+	if err := r.Pool.QueryRow(ctx, `SELECT true FROM ledger_entries WHERE id=$1`, entryID).Scan(&exists); err != nil {
+		if err == pgx.ErrNoRows {
+			return Line{}, ErrEntryNotFound
+		}
+		return Line{}, err
+	}
+	l, err := scanLine(r.Pool.QueryRow(ctx, `
+UPDATE bank_lines SET status='matched', ledger_entry_id=$2, match_score=NULL, matched_at=now()
+WHERE id=$1 AND status='unmatched'
+  AND NOT EXISTS (SELECT 1 FROM bank_lines WHERE ledger_entry_id=$2)
+RETURNING `+lineColumns, lineID, entryID))
+	if err == pgx.ErrNoRows {
+		return Line{}, r.missingOrConflict(ctx, lineID)
+	}
+	return l, err
+}
+
+func (r *PgRepo) PostLine(ctx context.Context, lineID int32, post func(Line) (int32, error)) (Line, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Line{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	l, err := scanLine(tx.QueryRow(ctx, `SELECT `+lineColumns+` FROM bank_lines WHERE id=$1 FOR UPDATE`, lineID))
+	if err == pgx.ErrNoRows {
+		return Line{}, ErrNotFound
+	}
+	if err != nil {
+		return Line{}, err
+	}
+	if l.Status != StatusUnmatched {
+		return Line{}, ErrConflict
+	}
+	entryID, err := post(l)
+	if err != nil {
+		return Line{}, err
+	}
+	l, err = scanLine(tx.QueryRow(ctx, `
+UPDATE bank_lines SET status='matched', ledger_entry_id=$2, match_score=NULL, matched_at=now()
+WHERE id=$1 AND NOT EXISTS (SELECT 1 FROM bank_lines WHERE ledger_entry_id=$2)
+RETURNING `+lineColumns, lineID, entryID))
+	if err == pgx.ErrNoRows {
+		return Line{}, ErrConflict
+	}
+	if err != nil {
+		return Line{}, err
+	}
+	return l, tx.Commit(ctx)
+}
+
+func (r *PgRepo) Unmatch(ctx context.Context, lineID int32) (Line, error) {
+	l, err := scanLine(r.Pool.QueryRow(ctx, `
+UPDATE bank_lines SET status='unmatched', ledger_entry_id=NULL, match_score=NULL, matched_at=NULL, unmatches=unmatches+1
+WHERE id=$1 AND status <> 'unmatched'
+RETURNING `+lineColumns, lineID))
+	if err == pgx.ErrNoRows {
+		return Line{}, r.missingOrConflict(ctx, lineID)
+	}
+	return l, err
+}
+
+func (r *PgRepo) Ignore(ctx context.Context, lineID int32) (Line, error) {
+	l, err := scanLine(r.Pool.QueryRow(ctx, `
+UPDATE bank_lines SET status='ignored'
+WHERE id=$1 AND status='unmatched'
+RETURNING `+lineColumns, lineID))
+	if err == pgx.ErrNoRows {
+		return Line{}, r.missingOrConflict(ctx, lineID)
+	}
+	return l, err
+}
+
+func (r *PgRepo) Reconciliation(ctx context.Context, from, to *time.Time, status string) ([]EntryStatus, error) {
+	var toExcl *time.Time
+	if to != nil {
+		t := to.AddDate(0, 0, 1)
+		toExcl = &t
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT e.id, e.type, e.amount::float8, e.description, e.created_at, b.id, b.posted_on
+FROM ledger_entries e
+LEFT JOIN bank_lines b ON b.ledger_entry_id = e.id
+WHERE ($1::timestamptz IS NULL OR e.created_at >= $1)
+  AND ($2::timestamptz IS NULL OR e.created_at < $2)
+  AND ($3 = '' OR ($3 = 'reconciled') = (b.id IS NOT NULL))
+ORDER BY e.created_at DESC, e.id DESC`, from, toExcl, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []EntryStatus
+	for rows.Next() {
+		var s EntryStatus
+		var lineID pgtype.Int4
+		var posted pgtype.Date
+		if err := rows.Scan(&s.ID, &s.Type, &s.Amount, &s.Description, &s.CreatedAt, &lineID, &posted); err != nil {
+			return nil, err
+		}
+		s.Status = "unreconciled"
+		if lineID.Valid {
+			s.Status = "reconciled"
+			s.BankLineID = &lineID.Int32
+			t := posted.Time
+			s.PostedOn = &t
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) missingOrConflict(ctx context.Context, id int32) error {
+	var exists bool
+	if err := r.Pool.QueryRow(ctx, `SELECT true FROM bank_lines WHERE id=$1`, id).Scan(&exists); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return ErrConflict
+}
+
+func scanStatement(row pgx.Row) (Statement, error) {
+	var st Statement
+	var importedBy pgtype.Int8
+	if err := row.Scan(&st.ID, &st.Account, &st.Format, &st.Filename, &st.LineCount, &st.DuplicateCount, &importedBy, &st.ImportedAt); err != nil {
+		return Statement{}, err
+	}
+	if importedBy.Valid {
+		st.ImportedBy = &importedBy.Int64
+	}
+	return st, nil
+}
+
+func scanLine(row pgx.Row) (Line, error) {
+	var l Line
+	var posted pgtype.Date
+	var entryID, score pgtype.Int4
+	var matchedAt pgtype.Timestamptz
+	if err := row.Scan(&l.ID, &l.StatementID, &l.Account, &posted, &l.Amount, &l.Description, &l.Reference, &l.Status, &entryID, &score, &matchedAt, &l.Unmatches); err != nil {
+		return Line{}, err
+	}
+	l.PostedOn = posted.Time
+	if entryID.Valid {
+		l.LedgerEntryID = &entryID.Int32
+	}
+	if score.Valid {
+		s := int(score.Int32)
+		l.MatchScore = &s
+	}
+	if matchedAt.Valid {
+		t := matchedAt.Time
+		l.MatchedAt = &t
+	}
+	return l, nil
+}
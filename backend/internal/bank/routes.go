@@ -0,0 +1,23 @@
+package bank
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequirePermission("bank.reconcile"))
+		r.Get("/statements", h.ListStatements)
+		r.Post("/statements", h.Import)
+		r.Get("/lines", h.ListLines)
+		r.Post("/match", h.RunMatching)
+		r.Get("/lines/{id}/suggestions", h.Suggestions)
+		r.Post("/lines/{id}/match", h.MatchLine)
+		r.Post("/lines/{id}/unmatch", h.UnmatchLine)
+		r.Post("/lines/{id}/ignore", h.IgnoreLine)
+		r.Post("/lines/{id}/entry", h.CreateEntry)
+		r.Get("/reconciliation", h.Reconciliation)
+	}
+	r.Route("/bank", route)
+}
@@ -0,0 +1,217 @@
+package budgets
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handlers struct {
+	Repo Repo
+}
+
+type lineInput struct {
+	LedgerType  string  `json:"ledger_type"`
+	Account     string  `json:"account"`
+	Amount      float64 `json:"amount"`
+	PeriodStart string  `json:"period_start"`
+	PeriodEnd   string  `json:"period_end"`
+}
+
+// parse validates a line item payload; msg is the 400 message on failure.
+func (in lineInput) parse() (l LineItem, msg string) {
+	if !ledger.ValidType(in.LedgerType) {
+		return LineItem{}, "invalid ledger_type"
+	}
+	if in.Amount < 0 {
+		return LineItem{}, "amount must not be negative"
+	}
+	start, err1 := httpx.ParseDate(in.PeriodStart)
+	end, err2 := httpx.ParseDate(in.PeriodEnd)
+	if err1 != nil || err2 != nil || (start == nil) != (end == nil) || (end != nil && end.Before(*start)) {
+		return LineItem{}, "invalid line period"
+	}
+	return LineItem{LedgerType: in.LedgerType, Account: in.Account, Amount: in.Amount, PeriodStart: start, PeriodEnd: end}, ""
+}
+
+// List handles GET /api/budgets
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.List(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Budget{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// Create handles POST /api/budgets
+func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Name        string      `json:"name"`
+		PeriodStart string      `json:"period_start"`
+		PeriodEnd   string      `json:"period_end"`
+		ProposalID  *int32      `json:"proposal_id"`
+		Lines       []lineInput `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.Name == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name required")
+		return
+	}
+	start, err1 := httpx.ParseDate(in.PeriodStart)
+	end, err2 := httpx.ParseDate(in.PeriodEnd)
+	if err1 != nil || err2 != nil || start == nil || end == nil || end.Before(*start) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "valid period_start and period_end required")
+		return
+	}
+	b := Budget{Name: in.Name, PeriodStart: *start, PeriodEnd: *end, ProposalID: in.ProposalID}
+	for _, li := range in.Lines {
+		l, msg := li.parse()
+		if msg != "" {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, msg)
+			return
+		}
+		b.Lines = append(b.Lines, l)
+	}
+	created, err := h.Repo.Create(r.Context(), b)
+	if err != nil {
+		if err == ErrProposalNotFound {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "unknown proposal_id")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(created)
+}
+
+// Get handles GET /api/budgets/{id}
+func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	b, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(b)
+}
+
+// AddLine handles POST /api/budgets/{id}/lines
+func (h Handlers) AddLine(w http.ResponseWriter, r *http.Request) {
+	id, ok := budgetID(w, r)
+	if !ok {
+		return
+	}
+	var in lineInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	l, msg := in.parse()
+	if msg != "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, msg)
+		return
+	}
+	line, err := h.Repo.AddLine(r.Context(), id, l)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(line)
+}
+
+// Report handles GET /api/budgets/{id}/report
+func (h Handlers) Report(w http.ResponseWriter, r *http.Request) {
+	b, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	rep, err := BuildReport(r.Context(), h.Repo, b)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rep)
+}
+
+// ReportCSV streams the budget-vs-actual report as CSV
+func (h Handlers) ReportCSV(w http.ResponseWriter, r *http.Request) {
+	b, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	rep, err := BuildReport(r.Context(), h.Repo, b)
+	if err != nil {
+		http.Error(w, "report failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=budget-"+strconv.Itoa(int(b.ID))+".csv")
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	_ = cw.Write([]string{"ledger_type", "account", "period_start", "period_end", "budget", "actual", "variance", "percent_used"})
+	for _, l := range rep.Lines {
+		_ = cw.Write([]string{
+			l.LedgerType,
+			l.Account,
+			l.PeriodStart.Format(httpx.DateLayout),
+			l.PeriodEnd.Format(httpx.DateLayout),
+			money(l.Budget),
+			money(l.Actual),
+			money(l.Variance),
+			money(l.PercentUsed),
+		})
+	}
+	_ = cw.Write([]string{"total", "", b.PeriodStart.Format(httpx.DateLayout), b.PeriodEnd.Format(httpx.DateLayout),
+		money(rep.Budget), money(rep.Actual), money(rep.Variance), money(rep.PercentUsed)})
+}
+
+func (h Handlers) load(w http.ResponseWriter, r *http.Request) (Budget, bool) {
+	id, ok := budgetID(w, r)
+	if !ok {
+		return Budget{}, false
+	}
+	b, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Budget{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return Budget{}, false
+	}
+	return b, true
+}
+
+func budgetID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
@@ -0,0 +1,217 @@
+package budgets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	budgets  []Budget
+	actuals  map[string]float64 // ledger type -> signed actual
+	accounts map[string]string  // ledger type -> mapped account
+}
+
+func (m *mockRepo) List(_ context.Context) ([]Budget, error) {
+	return append([]Budget(nil), m.budgets...), nil
+}
+
+func (m *mockRepo) Get(_ context.Context, id int32) (Budget, error) {
+	for _, b := range m.budgets {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return Budget{}, ErrNotFound
+}
+
+func (m *mockRepo) Create(_ context.Context, b Budget) (Budget, error) {
+	if b.ProposalID != nil && *b.ProposalID == 404 {
+		return Budget{}, ErrProposalNotFound
+	}
+	b.ID = int32(len(m.budgets) + 1)
+	for i := range b.Lines {
+		b.Lines[i].ID = int32(i + 1)
+		b.Lines[i].BudgetID = b.ID
+	}
+	m.budgets = append(m.budgets, b)
+	return b, nil
+}
+
+func (m *mockRepo) AddLine(_ context.Context, budgetID int32, l LineItem) (LineItem, error) {
+	for i, b := range m.budgets {
+		if b.ID == budgetID {
+			l.ID = int32(len(b.Lines) + 1)
+			l.BudgetID = budgetID
+			m.budgets[i].Lines = append(m.budgets[i].Lines, l)
+			return l, nil
+		}
+	}
+	return LineItem{}, ErrNotFound
+}
+
+func (m *mockRepo) Actual(_ context.Context, ledgerType, account string, _, _ time.Time) (float64, error) {
+	if account != "" && !strings.EqualFold(account, m.accounts[ledgerType]) {
+		return 0, nil
+	}
+	return m.actuals[ledgerType], nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		if id <= 0 {
+			return httpmw.Principal{}, false, nil
+		}
+		return httpmw.Principal{MemberID: id, Role: "admin"}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo})
+	return r
+}
+
+// ---- Tests ----
+
+func TestHandlers_Create(t *testing.T) {
+	repo := &mockRepo{}
+	r := setupRouter(repo)
+
+	tests := []struct {
+		name           string
+		payload        string
+		userID         string
+		expectedStatus int
+	}{
+		{"valid with lines", `{"name":"FY2025","period_start":"2025-01-01","period_end":"2025-12-31","proposal_id":7,"lines":[{"ledger_type":"expense","account":"Rent","amount":12000},{"ledger_type":"income","amount":20000}]}`, "1", http.StatusCreated},
+		{"unauthenticated", `{"name":"FY2025","period_start":"2025-01-01","period_end":"2025-12-31"}`, "", http.StatusUnauthorized},
+		{"missing period", `{"name":"FY2025","period_start":"2025-01-01"}`, "1", http.StatusBadRequest},
+		{"invalid ledger type", `{"name":"FY2025","period_start":"2025-01-01","period_end":"2025-12-31","lines":[{"ledger_type":"rent","amount":1}]}`, "1", http.StatusBadRequest},
+		{"half line period", `{"name":"FY2025","period_start":"2025-01-01","period_end":"2025-12-31","lines":[{"ledger_type":"expense","amount":1,"period_start":"2025-01-01"}]}`, "1", http.StatusBadRequest},
+		{"unknown proposal", `{"name":"FY2025","period_start":"2025-01-01","period_end":"2025-12-31","proposal_id":404}`, "1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/budgets", strings.NewReader(tt.payload))
+			if tt.userID != "" {
+				req.Header.Set("X-User-Id", tt.userID)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d (%s)", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if len(repo.budgets) != 1 || len(repo.budgets[0].Lines) != 2 || *repo.budgets[0].ProposalID != 7 {
+		t.Fatalf("unexpected stored budgets: %+v", repo.budgets)
+	}
+}
+
+func TestHandlers_Report(t *testing.T) {
+	q1Start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	q1End := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	repo := &mockRepo{
+		budgets: []Budget{{
+			ID: 1, Name: "FY2025",
+			PeriodStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			PeriodEnd:   time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+			Lines: []LineItem{
+				{ID: 1, BudgetID: 1, LedgerType: "expense", Account: "Supplies", Amount: 1000},
+				{ID: 2, BudgetID: 1, LedgerType: "income", Amount: 500, PeriodStart: &q1Start, PeriodEnd: &q1End},
+			},
+		}},
+		actuals:  map[string]float64{"expense": -250, "income": 600},
+		accounts: map[string]string{"expense": "Supplies"},
+	}
+	r := setupRouter(repo)
+
+	req := httptest.NewRequest("GET", "/budgets/1/report", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var rep Report
+	if err := json.Unmarshal(rr.Body.Bytes(), &rep); err != nil {
+		t.Fatal("failed to parse json:", err)
+	}
+	if len(rep.Lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(rep.Lines))
+	}
+	if l := rep.Lines[0]; l.Actual != 250 || l.Variance != 750 || l.PercentUsed != 25 {
+		t.Errorf("unexpected expense line: %+v", l)
+	}
+	if l := rep.Lines[1]; l.Variance != -100 || l.PercentUsed != 120 || !l.PeriodEnd.Equal(q1End) {
+		t.Errorf("unexpected income line: %+v", l)
+	}
+	if rep.Budget != 1500 || rep.Actual != 850 || rep.Variance != 650 {
+		t.Errorf("unexpected totals: %+v", rep)
+	}
+
+	// CSV
+	req = httptest.NewRequest("GET", "/budgets/1/report.csv", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if lines[0] != "ledger_type,account,period_start,period_end,budget,actual,variance,percent_used" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if lines[1] != "expense,Supplies,2025-01-01,2025-12-31,1000.00,250.00,750.00,25.00" {
+		t.Errorf("unexpected first row %q", lines[1])
+	}
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], "total,") {
+		t.Errorf("expected totals row, got %v", lines)
+	}
+
+	// missing budget
+	req = httptest.NewRequest("GET", "/budgets/9/report", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestBuildReport_AccountsAndSigns(t *testing.T) {
+	repo := &mockRepo{
+		actuals:  map[string]float64{"expense": -400, "patronage": -100, "income": 50},
+		accounts: map[string]string{"expense": "Expenses"},
+	}
+	b := Budget{
+		ID: 1, Name: "FY2025",
+		PeriodStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodEnd:   time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC),
+		Lines: []LineItem{
+			{ID: 1, LedgerType: "expense", Account: "expenses", Amount: 500},
+			{ID: 2, LedgerType: "expense", Account: "Rent", Amount: 300},
+			{ID: 3, LedgerType: "patronage", Amount: 100},
+			{ID: 4, LedgerType: "income", Amount: 100},
+		},
+	}
+	rep, err := BuildReport(context.Background(), repo, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{400, 0, 100, 50}
+	for i, l := range rep.Lines {
+		if l.Actual != want[i] {
+			t.Errorf("line %d: expected actual %v, got %v", l.LineID, want[i], l.Actual)
+		}
+	}
+	if rep.Actual != 550 || rep.Variance != 450 {
+		t.Errorf("unexpected totals: %+v", rep)
+	}
+}
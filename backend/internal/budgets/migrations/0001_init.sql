@@ -0,0 +1,25 @@
+-- backend/internal/budgets/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS budgets (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL CHECK (length(trim(name)) > 0),
+  period_start DATE NOT NULL,
+  period_end DATE NOT NULL,
+  proposal_id INTEGER REFERENCES proposals(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (period_end >= period_start)
+);
+
+CREATE TABLE IF NOT EXISTS budget_lines (
+  id SERIAL PRIMARY KEY,
+  budget_id INTEGER NOT NULL REFERENCES budgets(id) ON DELETE CASCADE,
+  ledger_type TEXT NOT NULL,
+  account TEXT NOT NULL DEFAULT '',
+  amount DECIMAL(12,2) NOT NULL CHECK (amount >= 0),
+  period_start DATE,
+  period_end DATE,
+  CHECK ((period_start IS NULL) = (period_end IS NULL)),
+  CHECK (period_end IS NULL OR period_end >= period_start)
+);
+
+CREATE INDEX IF NOT EXISTS budget_lines_budget_id_idx ON budget_lines (budget_id);
+CREATE INDEX IF NOT EXISTS budgets_proposal_id_idx ON budgets (proposal_id);
@@ -0,0 +1,52 @@
+package budgets
+
+import "time"
+
+// Budget is an approved spending/income plan for a period.
+// ProposalID optionally links the proposal whose vote approved it.
+type Budget struct {
+	ID          int32      `json:"id"`
+	Name        string     `json:"name"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	ProposalID  *int32     `json:"proposal_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Lines       []LineItem `json:"lines"`
+}
+
+// LineItem budgets an amount for one ledger type (and optional account label)
+// over a period. When the line has no period of its own it uses the budget's.
+type LineItem struct {
+	ID          int32      `json:"id"`
+	BudgetID    int32      `json:"budget_id"`
+	LedgerType  string     `json:"ledger_type"`
+	Account     string     `json:"account"`
+	Amount      float64    `json:"amount"`
+	PeriodStart *time.Time `json:"period_start"`
+	PeriodEnd   *time.Time `json:"period_end"`
+}
+
+// ReportLine compares one line item with ledger actuals.
+type ReportLine struct {
+	LineID      int32     `json:"line_id"`
+	LedgerType  string    `json:"ledger_type"`
+	Account     string    `json:"account"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Budget      float64   `json:"budget"`
+	Actual      float64   `json:"actual"`
+	Variance    float64   `json:"variance"`
+	PercentUsed float64   `json:"percent_used"`
+}
+
+// Report is the budget-vs-actual view of a budget.
+type Report struct {
+	BudgetID    int32        `json:"budget_id"`
+	Name        string       `json:"name"`
+	ProposalID  *int32       `json:"proposal_id"`
+	Lines       []ReportLine `json:"lines"`
+	Budget      float64      `json:"budget"`
+	Actual      float64      `json:"actual"`
+	Variance    float64      `json:"variance"`
+	PercentUsed float64      `json:"percent_used"`
+}
@@ -0,0 +1,211 @@
+package budgets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/ledger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound         = errors.New("budget not found")
+	ErrProposalNotFound = errors.New("proposal not found")
+)
+
+type Repo interface {
+	List(ctx context.Context) ([]Budget, error)
+	Get(ctx context.Context, id int32) (Budget, error)
+	// Create inserts a budget and its lines. Returns ErrProposalNotFound when
+	// ProposalID does not reference an existing proposal.
+	Create(ctx context.Context, b Budget) (Budget, error)
+	AddLine(ctx context.Context, budgetID int32, l LineItem) (LineItem, error)
+	// Actual sums the signed amounts of ledger entries of ledgerType created
+	// within the inclusive date range. A non-empty account only matches the
+	// account the type maps to (ledger_account_mappings, else
+	// ledger.DefaultAccounts); other accounts have no entries.
+	Actual(ctx context.Context, ledgerType, account string, from, to time.Time) (float64, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+func (r *PgRepo) List(ctx context.Context) ([]Budget, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, name, period_start, period_end, proposal_id, created_at
+FROM budgets
+ORDER BY period_start DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Budget
+	for rows.Next() {
+		b, err := scanBudget(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int32) (Budget, error) {
+	b, err := scanBudget(r.Pool.QueryRow(ctx, `
+SELECT id, name, period_start, period_end, proposal_id, created_at
+FROM budgets
+WHERE id=$1`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Budget{}, ErrNotFound
+		}
+		return Budget{}, err
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, budget_id, ledger_type, account, amount, period_start, period_end
+FROM budget_lines
+WHERE budget_id=$1
+ORDER BY id`, id)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer rows.Close()
+	b.Lines = []LineItem{}
+	for rows.Next() {
+		l, err := scanLine(rows)
+		if err != nil {
+			return Budget{}, err
+		}
+		b.Lines = append(b.Lines, l)
+	}
+	return b, rows.Err()
+}
+
+func (r *PgRepo) Create(ctx context.Context, b Budget) (Budget, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Budget{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var proposalID pgtype.Int4
+	if b.ProposalID != nil {
+		proposalID = pgtype.Int4{Int32: *b.ProposalID, Valid: true}
+	}
+	created, err := scanBudget(tx.QueryRow(ctx, `
+INSERT INTO budgets (name, period_start, period_end, proposal_id)
+VALUES ($1,$2,$3,$4)
+RETURNING id, name, period_start, period_end, proposal_id, created_at
+`, b.Name, dateParam(&b.PeriodStart), dateParam(&b.PeriodEnd), proposalID))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+			return Budget{}, ErrProposalNotFound
+		}
+		return Budget{}, err
+	}
+	created.Lines = make([]LineItem, 0, len(b.Lines))
+	for _, l := range b.Lines {
+		line, err := insertLine(ctx, tx, created.ID, l)
+		if err != nil {
+			return Budget{}, err
+		}
+		created.Lines = append(created.Lines, line)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Budget{}, err
+	}
+	return created, nil
+}
+
+func (r *PgRepo) AddLine(ctx context.Context, budgetID int32, l LineItem) (LineItem, error) {
+	line, err := insertLine(ctx, r.Pool, budgetID, l)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+			return LineItem{}, ErrNotFound
+		}
+		return LineItem{}, err
+	}
+	return line, nil
+}
+
+func (r *PgRepo) Actual(ctx context.Context, ledgerType, account string, from, to time.Time) (float64, error) {
+	fallback, ok := ledger.DefaultAccounts[ledgerType]
+	if !ok {
+		fallback = ledgerType
+	}
+	var total float64
+	err := r.Pool.QueryRow(ctx, `
+SELECT COALESCE(SUM(base_amount), 0)::float8
+FROM ledger_entries
+WHERE type=$1 AND created_at >= $2 AND created_at < $3
+  AND ($4 = '' OR lower($4) = lower(COALESCE(
+        (SELECT account FROM ledger_account_mappings WHERE ledger_type=$1), $5)))`,
+		ledgerType, from, to.AddDate(0, 0, 1), strings.TrimSpace(account), fallback).Scan(&total)
+	return total, err
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertLine(ctx context.Context, q queryRower, budgetID int32, l LineItem) (LineItem, error) {
+	return scanLine(q.QueryRow(ctx, `
+INSERT INTO budget_lines (budget_id, ledger_type, account, amount, period_start, period_end)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id, budget_id, ledger_type, account, amount, period_start, period_end
+`, budgetID, l.LedgerType, l.Account, l.Amount, dateParam(l.PeriodStart), dateParam(l.PeriodEnd)))
+}
+
+func scanBudget(row pgx.Row) (Budget, error) {
+	var b Budget
+	var start, end pgtype.Date
+	var proposalID pgtype.Int4
+	var createdAt pgtype.Timestamptz
+	if err := row.Scan(&b.ID, &b.Name, &start, &end, &proposalID, &createdAt); err != nil {
+		return Budget{}, err
+	}
+	b.PeriodStart = start.Time
+	b.PeriodEnd = end.Time
+	if proposalID.Valid {
+		b.ProposalID = &proposalID.Int32
+	}
+	b.CreatedAt = createdAt.Time
+	return b, nil
+}
+
+func scanLine(row pgx.Row) (LineItem, error) {
+	var l LineItem
+	var start, end pgtype.Date
+	if err := row.Scan(&l.ID, &l.BudgetID, &l.LedgerType, &l.Account, &l.Amount, &start, &end); err != nil {
+		return LineItem{}, err
+	}
+	if start.Valid {
+		t := start.Time
+		l.PeriodStart = &t
+	}
+	if end.Valid {
+		t := end.Time
+		l.PeriodEnd = &t
+	}
+	return l, nil
+}
+
+func dateParam(t *time.Time) pgtype.Date {
+	if t == nil {
+		return pgtype.Date{}
+	}
+	return pgtype.Date{Time: *t, Valid: true}
+}
@@ -0,0 +1,63 @@
+package budgets
+
+import (
+	"context"
+	"math"
+)
+
+// BuildReport compares each line item of b with ledger actuals for the line's
+// period. Variance is budget minus actual, so a negative variance means the
+// line is over budget. Actuals are net of refunds and reversals; for types
+// that pay money out they are negated so spending reads as positive.
+func BuildReport(ctx context.Context, repo Repo, b Budget) (Report, error) {
+	rep := Report{BudgetID: b.ID, Name: b.Name, ProposalID: b.ProposalID, Lines: []ReportLine{}}
+	for _, l := range b.Lines {
+		from, to := b.PeriodStart, b.PeriodEnd
+		if l.PeriodStart != nil && l.PeriodEnd != nil {
+			from, to = *l.PeriodStart, *l.PeriodEnd
+		}
+		actual, err := repo.Actual(ctx, l.LedgerType, l.Account, from, to)
+		if err != nil {
+			return Report{}, err
+		}
+		if outflow(l.LedgerType) {
+			actual = -actual
+		}
+		line := ReportLine{
+			LineID:      l.ID,
+			LedgerType:  l.LedgerType,
+			Account:     l.Account,
+			PeriodStart: from,
+			PeriodEnd:   to,
+			Budget:      l.Amount,
+			Actual:      round2(actual),
+			Variance:    round2(l.Amount - actual),
+			PercentUsed: percent(actual, l.Amount),
+		}
+		rep.Lines = append(rep.Lines, line)
+		rep.Budget += line.Budget
+		rep.Actual += line.Actual
+	}
+	rep.Budget = round2(rep.Budget)
+	rep.Actual = round2(rep.Actual)
+	rep.Variance = round2(rep.Budget - rep.Actual)
+	rep.PercentUsed = percent(rep.Actual, rep.Budget)
+	return rep, nil
+}
+
+// outflow reports whether entries of ledgerType are recorded as negative
+// amounts because they pay money out.
+func outflow(ledgerType string) bool {
+	return ledgerType == "expense" || ledgerType == "patronage"
+}
+
+func percent(actual, budget float64) float64 {
+	if budget == 0 {
+		return 0
+	}
+	return round2(actual / budget * 100)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,18 @@
+package budgets
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Get("/", h.List)
+		r.With(httpmw.RequirePermission("budgets.manage")).Post("/", h.Create)
+		r.Get("/{id}", h.Get)
+		r.With(httpmw.RequirePermission("budgets.manage")).Post("/{id}/lines", h.AddLine)
+		r.Get("/{id}/report", h.Report)
+		r.Get("/{id}/report.csv", h.ReportCSV)
+	}
+	r.Route("/budgets", route)
+}
@@ -0,0 +1,543 @@
+package capital
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// LedgerPoster is the subset of ledger.Repo used to post cash movements.
+type LedgerPoster interface {
+	Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+// canView reports whether p may read memberID's capital account.
+func canView(p httpmw.Principal, memberID int64) bool {
+	return p.MemberID == memberID || p.Can("capital.view")
+}
+
+// ListAccounts handles GET /api/capital/accounts (admin, treasurer)
+func (h Handlers) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.Accounts(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Account{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// GetAccount handles GET /api/capital/members/{id}
+func (h Handlers) GetAccount(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.viewable(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, acct)
+}
+
+// ListTransactions handles GET /api/capital/members/{id}/transactions
+// Query: from, to (YYYY-MM-DD), limit, offset
+func (h Handlers) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.viewable(w, r)
+	if !ok {
+		return
+	}
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 500)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	items, err := h.Repo.Transactions(r.Context(), TransactionFilters{MemberID: &acct.MemberID, FromDate: from, ToDate: to, Limit: lim, Offset: off})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Transaction{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Statement handles GET /api/capital/members/{id}/statement
+// Query: from (optional), to (default today)
+func (h Handlers) Statement(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.viewable(w, r)
+	if !ok {
+		return
+	}
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	if to == nil {
+		t := today()
+		to = &t
+	}
+	if from != nil && to.Before(*from) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "to must not be before from")
+		return
+	}
+	txns, err := h.Repo.Transactions(r.Context(), TransactionFilters{MemberID: &acct.MemberID, ToDate: to})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, BuildStatement(acct, txns, from, *to))
+}
+
+// Certificate handles GET /api/capital/members/{id}/certificate. It returns
+// a plain-text share certificate for the member's current holding.
+func (h Handlers) Certificate(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.viewable(w, r)
+	if !ok {
+		return
+	}
+	if acct.Shares <= 0 {
+		httpmw.WriteJSONError(w, http.StatusConflict, "member holds no shares")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=share-certificate-%d.txt", acct.MemberID))
+	fmt.Fprintf(w, "SHARE CERTIFICATE\n\n")
+	fmt.Fprintf(w, "This certifies that %s (member #%d)\n", acct.DisplayName, acct.MemberID)
+	fmt.Fprintf(w, "holds %d member share(s) in the cooperative\n", acct.Shares)
+	fmt.Fprintf(w, "with a capital account balance of %s.\n\n", money(acct.Balance))
+	fmt.Fprintf(w, "Paid in:   %s\nRetained:  %s\nRedeemed:  %s\n\n", money(acct.PaidIn), money(acct.Retained), money(acct.Redeemed))
+	fmt.Fprintf(w, "Issued %s\n", today().Format(httpx.DateLayout))
+}
+
+// Purchase handles POST /api/capital/members/{id}/purchases (admin)
+// Body: {"shares":2,"price_per_share":50,"paid_on":"2025-03-01","note":"Buy-in"}
+func (h Handlers) Purchase(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.member(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Shares        int     `json:"shares"`
+		PricePerShare float64 `json:"price_per_share"`
+		PaidOn        string  `json:"paid_on"`
+		Note          string  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.Shares <= 0 || in.PricePerShare <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "shares and price_per_share must be positive")
+		return
+	}
+	on, ok := dateOrToday(w, in.PaidOn, "paid_on")
+	if !ok {
+		return
+	}
+	h.record(w, r, Transaction{MemberID: acct.MemberID, Kind: KindPurchase, Amount: round2(float64(in.Shares) * in.PricePerShare), Shares: in.Shares, Note: strings.TrimSpace(in.Note), OccurredOn: on})
+}
+
+// Redeem handles POST /api/capital/members/{id}/redemptions (admin). With
+// no amount the whole account and all shares are redeemed, as when a member
+// exits; a partial amount redeems no shares unless shares is given.
+// Body: {"amount":100,"shares":2,"paid_on":"2025-06-30","note":"Exit"}
+func (h Handlers) Redeem(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.member(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Amount *float64 `json:"amount"`
+		Shares *int     `json:"shares"`
+		PaidOn string   `json:"paid_on"`
+		Note   string   `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	amount, shares := acct.Balance, acct.Shares
+	if in.Amount != nil {
+		amount, shares = *in.Amount, 0
+	}
+	if in.Shares != nil {
+		shares = *in.Shares
+	}
+	if amount <= 0 || shares < 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "nothing to redeem")
+		return
+	}
+	on, ok := dateOrToday(w, in.PaidOn, "paid_on")
+	if !ok {
+		return
+	}
+	h.record(w, r, Transaction{MemberID: acct.MemberID, Kind: KindRedemption, Amount: -round2(amount), Shares: -shares, Note: strings.TrimSpace(in.Note), OccurredOn: on})
+}
+
+// Adjust handles POST /api/capital/members/{id}/adjustments (admin). It
+// corrects the account without moving cash.
+// Body: {"amount":-5,"shares":0,"occurred_on":"2025-03-01","note":"Rounding"}
+func (h Handlers) Adjust(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.member(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Amount     float64 `json:"amount"`
+		Shares     int     `json:"shares"`
+		OccurredOn string  `json:"occurred_on"`
+		Note       string  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	in.Note = strings.TrimSpace(in.Note)
+	if in.Note == "" || (in.Amount == 0 && in.Shares == 0) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "note and a non-zero amount or shares required")
+		return
+	}
+	on, ok := dateOrToday(w, in.OccurredOn, "occurred_on")
+	if !ok {
+		return
+	}
+	h.record(w, r, Transaction{MemberID: acct.MemberID, Kind: KindAdjustment, Amount: round2(in.Amount), Shares: in.Shares, Note: in.Note, OccurredOn: on})
+}
+
+// ImportRetained handles POST /api/capital/retained/import (admin). It
+// credits the retained part of a posted patronage run to members' capital
+// accounts; re-importing a run adds nothing.
+// Body: {"run_id":3}
+func (h Handlers) ImportRetained(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		RunID int32 `json:"run_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.RunID <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "run_id required")
+		return
+	}
+	n, err := h.Repo.ImportRetained(r.Context(), in.RunID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "patronage run not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "patronage run not posted")
+	case err != nil:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "import failed")
+	default:
+		writeJSON(w, http.StatusOK, map[string]int{"imported": n})
+	}
+}
+
+// PostToLedger handles POST /api/capital/transactions/{id}/post (admin). It
+// retries the ledger posting for a cash transaction whose posting failed.
+func (h Handlers) PostToLedger(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	t, err := h.Repo.GetTransaction(r.Context(), id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if !t.Posted() {
+		httpmw.WriteJSONError(w, http.StatusConflict, "transaction does not move cash")
+		return
+	}
+	if t.LedgerEntryID != nil {
+		writeJSON(w, http.StatusOK, t)
+		return
+	}
+	if t, ok := h.post(w, r, t); ok {
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// ListPlans handles GET /api/capital/members/{id}/plans
+func (h Handlers) ListPlans(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.viewable(w, r)
+	if !ok {
+		return
+	}
+	plans, err := h.Repo.ListPlans(r.Context(), acct.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	out := make([]PlanWithSchedule, 0, len(plans))
+	for _, p := range plans {
+		out = append(out, Schedule(p, today()))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// CreatePlan handles POST /api/capital/members/{id}/plans (admin)
+// Body: {"shares":10,"price_per_share":25,"installments":12,"interval_months":1,"first_due_on":"2025-04-01"}
+func (h Handlers) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	acct, ok := h.member(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Shares         int     `json:"shares"`
+		PricePerShare  float64 `json:"price_per_share"`
+		Installments   int     `json:"installments"`
+		IntervalMonths int     `json:"interval_months"`
+		FirstDueOn     string  `json:"first_due_on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.IntervalMonths == 0 {
+		in.IntervalMonths = 1
+	}
+	if in.Shares <= 0 || in.PricePerShare <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "shares and price_per_share must be positive")
+		return
+	}
+	if in.Installments < 1 || in.Installments > 120 || in.IntervalMonths < 1 || in.IntervalMonths > 12 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "installments must be 1-120 and interval_months 1-12")
+		return
+	}
+	if float64(in.Shares)*in.PricePerShare < 0.01*float64(in.Installments) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "too many installments for the plan total")
+		return
+	}
+	due, ok := dateOrToday(w, in.FirstDueOn, "first_due_on")
+	if !ok {
+		return
+	}
+	p, err := h.Repo.CreatePlan(r.Context(), Plan{MemberID: acct.MemberID, Shares: in.Shares, PricePerShare: in.PricePerShare, Installments: in.Installments, IntervalMonths: in.IntervalMonths, FirstDueOn: due})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, Schedule(p, today()))
+}
+
+// GetPlan handles GET /api/capital/plans/{id} with its installment schedule.
+func (h Handlers) GetPlan(w http.ResponseWriter, r *http.Request) {
+	p, ok := h.plan(w, r)
+	if !ok {
+		return
+	}
+	if pr, _ := httpmw.FromContext(r.Context()); !canView(pr, p.MemberID) {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	writeJSON(w, http.StatusOK, Schedule(p, today()))
+}
+
+// PayPlan handles POST /api/capital/plans/{id}/payments (admin). The final
+// payment completes the plan and issues its shares.
+// Body: {"amount":25,"paid_on":"2025-04-01","note":""}
+func (h Handlers) PayPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := planID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Amount float64 `json:"amount"`
+		PaidOn string  `json:"paid_on"`
+		Note   string  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.Amount <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+	on, ok := dateOrToday(w, in.PaidOn, "paid_on")
+	if !ok {
+		return
+	}
+	pr, _ := httpmw.FromContext(r.Context())
+	p, t, err := h.Repo.PayInstallment(r.Context(), id, Transaction{Amount: round2(in.Amount), Note: strings.TrimSpace(in.Note), OccurredOn: on, CreatedBy: &pr.MemberID})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	t, ok = h.post(w, r, t)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"plan": Schedule(p, today()), "transaction": t})
+}
+
+// CancelPlan handles POST /api/capital/plans/{id}/cancel (admin).
+// Installments already paid stay in the account; no shares are issued.
+func (h Handlers) CancelPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := planID(w, r)
+	if !ok {
+		return
+	}
+	p, err := h.Repo.CancelPlan(r.Context(), id)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Schedule(p, today()))
+}
+
+// record stores t and, for cash movements, posts it to the ledger.
+func (h Handlers) record(w http.ResponseWriter, r *http.Request, t Transaction) {
+	pr, _ := httpmw.FromContext(r.Context())
+	t.CreatedBy = &pr.MemberID
+	t, err := h.Repo.AddTransaction(r.Context(), t)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if t.Posted() {
+		var ok bool
+		if t, ok = h.post(w, r, t); !ok {
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// post creates the ledger entry for a cash transaction. The idempotency key
+// makes retries return the original entry.
+func (h Handlers) post(w http.ResponseWriter, r *http.Request, t Transaction) (Transaction, bool) {
+	mid := int32(t.MemberID)
+	id := strconv.FormatInt(t.ID, 10)
+	desc := "Member share purchase"
+	switch t.Kind {
+	case KindInstallment:
+		desc = "Member share installment"
+	case KindRedemption:
+		desc = "Member capital redemption"
+	}
+	entry, _, err := h.Ledger.Create(r.Context(), "capital", desc, t.Amount, &mid, t.Note, "capital:"+id)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "recorded but ledger post failed; retry with POST /api/capital/transactions/"+id+"/post")
+		return Transaction{}, false
+	}
+	t, err = h.Repo.SetLedgerEntry(r.Context(), t.ID, entry.ID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+		return Transaction{}, false
+	}
+	return t, true
+}
+
+// member loads the account named by the {id} URL parameter.
+func (h Handlers) member(w http.ResponseWriter, r *http.Request) (Account, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Account{}, false
+	}
+	acct, err := h.Repo.Account(r.Context(), id)
+	if err != nil {
+		writeErr(w, err)
+		return Account{}, false
+	}
+	return acct, true
+}
+
+// viewable is member restricted to the account holder and approvers.
+func (h Handlers) viewable(w http.ResponseWriter, r *http.Request) (Account, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Account{}, false
+	}
+	if p, _ := httpmw.FromContext(r.Context()); !canView(p, id) {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return Account{}, false
+	}
+	return h.member(w, r)
+}
+
+func (h Handlers) plan(w http.ResponseWriter, r *http.Request) (Plan, bool) {
+	id, ok := planID(w, r)
+	if !ok {
+		return Plan{}, false
+	}
+	p, err := h.Repo.GetPlan(r.Context(), id)
+	if err != nil {
+		writeErr(w, err)
+		return Plan{}, false
+	}
+	return p, true
+}
+
+func planID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// dateOrToday parses an optional YYYY-MM-DD body field.
+func dateOrToday(w http.ResponseWriter, s, field string) (time.Time, bool) {
+	if s == "" {
+		return today(), true
+	}
+	d, err := httpx.ParseDate(s)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid "+field)
+		return time.Time{}, false
+	}
+	return *d, true
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "plan not active")
+	case errors.Is(err, ErrInsufficient):
+		httpmw.WriteJSONError(w, http.StatusConflict, "exceeds capital account balance or shares")
+	case errors.Is(err, ErrOverpayment):
+		httpmw.WriteJSONError(w, http.StatusConflict, "payment exceeds plan balance")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+	}
+}
+
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
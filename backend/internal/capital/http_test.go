@@ -0,0 +1,367 @@
+package capital
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	names    map[int64]string
+	txns     []Transaction
+	plans    []Plan
+	retained map[int32]map[int64]float64 // posted patronage runs
+}
+
+func (m *mockRepo) account(id int64) Account {
+	a := Account{MemberID: id, DisplayName: m.names[id]}
+	for _, t := range m.txns {
+		if t.MemberID != id {
+			continue
+		}
+		a.Balance = round2(a.Balance + t.Amount)
+		a.Shares += t.Shares
+		switch t.Kind {
+		case KindPurchase, KindInstallment:
+			a.PaidIn += t.Amount
+		case KindRetained:
+			a.Retained += t.Amount
+		case KindRedemption:
+			a.Redeemed += t.Amount
+		case KindAdjustment:
+			a.Adjustments += t.Amount
+		}
+	}
+	return a
+}
+
+func (m *mockRepo) Accounts(_ context.Context) ([]Account, error) {
+	var out []Account
+	for id := range m.names {
+		if a := m.account(id); a.Balance != 0 || a.Shares != 0 {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) Account(_ context.Context, id int64) (Account, error) {
+	if _, ok := m.names[id]; !ok {
+		return Account{}, ErrNotFound
+	}
+	return m.account(id), nil
+}
+
+func (m *mockRepo) Transactions(_ context.Context, f TransactionFilters) ([]Transaction, error) {
+	var out []Transaction
+	for _, t := range m.txns {
+		if (f.MemberID == nil || t.MemberID == *f.MemberID) && (f.FromDate == nil || !t.OccurredOn.Before(*f.FromDate)) && (f.ToDate == nil || !t.OccurredOn.After(*f.ToDate)) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetTransaction(_ context.Context, id int64) (Transaction, error) {
+	if id < 1 || int(id) > len(m.txns) {
+		return Transaction{}, ErrNotFound
+	}
+	return m.txns[id-1], nil
+}
+
+func (m *mockRepo) AddTransaction(_ context.Context, t Transaction) (Transaction, error) {
+	a := m.account(t.MemberID)
+	if (t.Amount < 0 || t.Shares < 0) && (a.Balance+t.Amount < 0 || a.Shares+t.Shares < 0) {
+		return Transaction{}, ErrInsufficient
+	}
+	t.ID = int64(len(m.txns) + 1)
+	m.txns = append(m.txns, t)
+	return t, nil
+}
+
+func (m *mockRepo) SetLedgerEntry(_ context.Context, id int64, entryID int32) (Transaction, error) {
+	m.txns[id-1].LedgerEntryID = &entryID
+	return m.txns[id-1], nil
+}
+
+func (m *mockRepo) ImportRetained(_ context.Context, runID int32) (int, error) {
+	allocs, ok := m.retained[runID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	n := 0
+outer:
+	for member, amount := range allocs {
+		ref := "patronage:" + strconv.Itoa(int(runID)) + ":" + strconv.FormatInt(member, 10)
+		for _, t := range m.txns {
+			if t.Reference != nil && *t.Reference == ref {
+				continue outer
+			}
+		}
+		_, _ = m.AddTransaction(context.Background(), Transaction{MemberID: member, Kind: KindRetained, Amount: amount, Reference: &ref, OccurredOn: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)})
+		n++
+	}
+	return n, nil
+}
+
+func (m *mockRepo) paid(p Plan) Plan {
+	p.Total = round2(float64(p.Shares) * p.PricePerShare)
+	p.Paid = 0
+	for _, t := range m.txns {
+		if t.PlanID != nil && *t.PlanID == p.ID {
+			p.Paid = round2(p.Paid + t.Amount)
+		}
+	}
+	return p
+}
+
+func (m *mockRepo) CreatePlan(_ context.Context, p Plan) (Plan, error) {
+	p.ID = int32(len(m.plans) + 1)
+	p.Status = PlanActive
+	m.plans = append(m.plans, p)
+	return m.paid(p), nil
+}
+
+func (m *mockRepo) GetPlan(_ context.Context, id int32) (Plan, error) {
+	if id < 1 || int(id) > len(m.plans) {
+		return Plan{}, ErrNotFound
+	}
+	return m.paid(m.plans[id-1]), nil
+}
+
+func (m *mockRepo) ListPlans(_ context.Context, memberID int64) ([]Plan, error) {
+	var out []Plan
+	for _, p := range m.plans {
+		if p.MemberID == memberID {
+			out = append(out, m.paid(p))
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) CancelPlan(ctx context.Context, id int32) (Plan, error) {
+	p, err := m.GetPlan(ctx, id)
+	if err != nil {
+		return Plan{}, err
+	}
+	if p.Status != PlanActive {
+		return Plan{}, ErrConflict
+	}
+	m.plans[id-1].Status = PlanCancelled
+	return m.GetPlan(ctx, id)
+}
+
+func (m *mockRepo) PayInstallment(ctx context.Context, id int32, t Transaction) (Plan, Transaction, error) {
+	p, err := m.GetPlan(ctx, id)
+	if err != nil {
+		return Plan{}, Transaction{}, err
+	}
+	if p.Status != PlanActive {
+		return Plan{}, Transaction{}, ErrConflict
+	}
+	remaining := round2(p.Total - p.Paid)
+	if t.Amount > remaining {
+		return Plan{}, Transaction{}, ErrOverpayment
+	}
+	t.MemberID, t.Kind, t.PlanID = p.MemberID, KindInstallment, &p.ID
+	if t.Amount == remaining {
+		t.Shares = p.Shares
+		m.plans[id-1].Status = PlanCompleted
+	}
+	t, _ = m.AddTransaction(ctx, t)
+	p, _ = m.GetPlan(ctx, id)
+	return p, t, nil
+}
+
+type mockLedger struct {
+	entries map[string]ledger.LedgerEntry
+	fail    bool
+}
+
+func (m *mockLedger) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, key string) (ledger.LedgerEntry, bool, error) {
+	if m.fail {
+		return ledger.LedgerEntry{}, false, errors.New("db down")
+	}
+	if e, ok := m.entries[key]; ok {
+		return e, false, nil
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 100), Type: entryType, Description: description, Amount: amount, MemberID: memberID, Notes: notes}
+	m.entries[key] = e
+	return e, true, nil
+}
+
+// ---- Helper functions ----
+
+// Member 1 is an admin; 5 and 6 are members.
+func setup() (*chi.Mux, *mockRepo, *mockLedger) {
+	repo := &mockRepo{names: map[int64]string{1: "Admin", 5: "Ana", 6: "Bo"}, retained: map[int32]map[int64]float64{3: {5: 40, 6: 10}}}
+	led := &mockLedger{entries: map[string]ledger.LedgerEntry{}}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role := "member"
+		if id == 1 {
+			role = "admin"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Ledger: led})
+	return r, repo, led
+}
+
+func do(r http.Handler, method, path string, user int64, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if user != 0 {
+		req.Header.Set("X-User-Id", strconv.FormatInt(user, 10))
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestSchedule(t *testing.T) {
+	p := Plan{Shares: 1, PricePerShare: 100, Total: 100, Installments: 3, IntervalMonths: 1, FirstDueOn: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC), Paid: 40}
+	s := Schedule(p, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	if len(s.Schedule) != 3 || s.Remaining != 60 {
+		t.Fatalf("unexpected schedule: %+v", s)
+	}
+	if a := s.Schedule; a[0].Amount != 33.33 || a[2].Amount != 33.34 || a[0].Status != "paid" || a[1].Status != "partial" || a[1].Paid != 6.67 {
+		t.Fatalf("unexpected installments: %+v", a)
+	}
+	if s.Schedule[2].Status != "due" || !s.Schedule[2].DueOn.Equal(time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected last installment: %+v", s.Schedule[2])
+	}
+	s = Schedule(Plan{Total: 100, Installments: 2, IntervalMonths: 1, FirstDueOn: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC))
+	if s.Schedule[0].Status != "overdue" || s.Schedule[1].Status != "due" {
+		t.Fatalf("unexpected statuses: %+v", s.Schedule)
+	}
+}
+
+func TestHandlers_PurchaseAndRedeem(t *testing.T) {
+	r, repo, led := setup()
+
+	if rr := do(r, "POST", "/capital/members/5/purchases", 5, `{"shares":1,"price_per_share":50}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/capital/members/9/purchases", 1, `{"shares":1,"price_per_share":50}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	rr := do(r, "POST", "/capital/members/5/purchases", 1, `{"shares":2,"price_per_share":50,"paid_on":"2025-01-10","note":"Buy-in"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if e := led.entries["capital:1"]; e.Type != "capital" || e.Amount != 100 || *e.MemberID != 5 {
+		t.Fatalf("unexpected ledger entry: %+v", e)
+	}
+
+	// retained patronage is credited once and not posted to the ledger
+	for i := 0; i < 2; i++ {
+		if rr := do(r, "POST", "/capital/retained/import", 1, `{"run_id":3}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+	if rr := do(r, "POST", "/capital/retained/import", 1, `{"run_id":4}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+	if len(repo.txns) != 3 || len(led.entries) != 1 {
+		t.Fatalf("unexpected state: %d txns, %d entries", len(repo.txns), len(led.entries))
+	}
+
+	var acct Account
+	rr = do(r, "GET", "/capital/members/5", 5, "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &acct)
+	if acct.Balance != 140 || acct.Shares != 2 || acct.Retained != 40 || acct.PaidIn != 100 {
+		t.Fatalf("unexpected account: %+v", acct)
+	}
+	if rr := do(r, "GET", "/capital/members/5", 6, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another member, got %d", rr.Code)
+	}
+
+	// partial redemptions can't exceed the balance
+	if rr := do(r, "POST", "/capital/members/5/redemptions", 1, `{"amount":500}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+	// exit redeems everything
+	rr = do(r, "POST", "/capital/members/5/redemptions", 1, `{"paid_on":"2025-06-30","note":"Exit"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if e := led.entries["capital:4"]; e.Amount != -140 {
+		t.Fatalf("unexpected redemption entry: %+v", e)
+	}
+	if a := repo.account(5); a.Balance != 0 || a.Shares != 0 {
+		t.Fatalf("expected empty account, got %+v", a)
+	}
+	if rr := do(r, "GET", "/capital/members/5/certificate", 5, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without shares, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_PlanPayments(t *testing.T) {
+	r, repo, led := setup()
+
+	if rr := do(r, "POST", "/capital/members/6/plans", 1, `{"shares":2,"price_per_share":25,"installments":0}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	rr := do(r, "POST", "/capital/members/6/plans", 1, `{"shares":2,"price_per_share":25,"installments":2,"first_due_on":"2025-01-01"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "POST", "/capital/plans/1/payments", 1, `{"amount":60}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for overpayment, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/capital/plans/1/payments", 1, `{"amount":25,"paid_on":"2025-01-01"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if a := repo.account(6); a.Shares != 0 || a.Balance != 25 {
+		t.Fatalf("shares issued before plan complete: %+v", a)
+	}
+
+	// a failed posting can be retried
+	led.fail = true
+	if rr := do(r, "POST", "/capital/plans/1/payments", 1, `{"amount":25,"paid_on":"2025-02-01"}`); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	led.fail = false
+	if rr := do(r, "POST", "/capital/transactions/2/post", 1, ""); rr.Code != http.StatusOK || repo.txns[1].LedgerEntryID == nil {
+		t.Fatalf("expected retry to post, got %d", rr.Code)
+	}
+
+	var plan PlanWithSchedule
+	_ = json.Unmarshal(do(r, "GET", "/capital/plans/1", 6, "").Body.Bytes(), &plan)
+	if plan.Status != PlanCompleted || plan.Remaining != 0 || plan.Schedule[1].Status != "paid" {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if a := repo.account(6); a.Shares != 2 || a.Balance != 50 {
+		t.Fatalf("expected shares issued: %+v", a)
+	}
+	if rr := do(r, "POST", "/capital/plans/1/cancel", 1, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	// statement with running balance
+	var st Statement
+	rr = do(r, "GET", "/capital/members/6/statement?from=2025-02-01&to=2025-12-31", 6, "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &st)
+	if st.OpeningBalance != 25 || len(st.Lines) != 1 || st.Lines[0].Balance != 50 || st.ClosingShares != 2 {
+		t.Fatalf("unexpected statement: %+v", st)
+	}
+	rr = do(r, "GET", "/capital/members/6/certificate", 6, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Bo (member #6)") || !strings.Contains(rr.Body.String(), "holds 2 member share(s)") {
+		t.Fatalf("unexpected certificate %d:\n%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,37 @@
+-- backend/internal/capital/migrations/0001_init.sql
+-- Share purchase plans: a member buys shares at a fixed price, paid in equal
+-- installments. Shares are issued when the plan is fully paid.
+CREATE TABLE IF NOT EXISTS capital_plans (
+  id SERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE RESTRICT,
+  shares INTEGER NOT NULL CHECK (shares > 0),
+  price_per_share DECIMAL(12,2) NOT NULL CHECK (price_per_share > 0),
+  installments INTEGER NOT NULL CHECK (installments BETWEEN 1 AND 120),
+  interval_months INTEGER NOT NULL DEFAULT 1 CHECK (interval_months BETWEEN 1 AND 12),
+  first_due_on DATE NOT NULL,
+  status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active','completed','cancelled')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS capital_plans_member_id_idx ON capital_plans (member_id);
+
+-- Every change to a member's capital account. amount and shares are signed:
+-- redemptions are negative. reference makes imports such as retained
+-- patronage idempotent.
+CREATE TABLE IF NOT EXISTS capital_transactions (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE RESTRICT,
+  kind TEXT NOT NULL CHECK (kind IN ('purchase','installment','retained','redemption','adjustment')),
+  amount DECIMAL(12,2) NOT NULL,
+  shares INTEGER NOT NULL DEFAULT 0,
+  plan_id INTEGER REFERENCES capital_plans(id),
+  reference TEXT UNIQUE,
+  ledger_entry_id INTEGER REFERENCES ledger_entries(id),
+  note TEXT NOT NULL DEFAULT '',
+  occurred_on DATE NOT NULL,
+  created_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS capital_transactions_member_id_idx ON capital_transactions (member_id, occurred_on);
+CREATE INDEX IF NOT EXISTS capital_transactions_plan_id_idx ON capital_transactions (plan_id);
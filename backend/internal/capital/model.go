@@ -0,0 +1,118 @@
+package capital
+
+import "time"
+
+// Transaction kinds. Purchases, installments and redemptions move cash and
+// are posted to the ledger; retained patronage and adjustments are not.
+const (
+	KindPurchase    = "purchase"
+	KindInstallment = "installment"
+	KindRetained    = "retained"
+	KindRedemption  = "redemption"
+	KindAdjustment  = "adjustment"
+)
+
+// Plan statuses.
+const (
+	PlanActive    = "active"
+	PlanCompleted = "completed"
+	PlanCancelled = "cancelled"
+)
+
+// Transaction is one change to a member's capital account. Amount and
+// Shares are negative for redemptions.
+type Transaction struct {
+	ID            int64     `json:"id"`
+	MemberID      int64     `json:"member_id"`
+	Kind          string    `json:"kind"`
+	Amount        float64   `json:"amount"`
+	Shares        int       `json:"shares"`
+	PlanID        *int32    `json:"plan_id"`
+	Reference     *string   `json:"reference"`
+	LedgerEntryID *int32    `json:"ledger_entry_id"`
+	Note          string    `json:"note"`
+	OccurredOn    time.Time `json:"occurred_on"`
+	CreatedBy     *int64    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Posted reports whether the transaction moves cash and so belongs in the
+// ledger.
+func (t Transaction) Posted() bool {
+	return t.Kind == KindPurchase || t.Kind == KindInstallment || t.Kind == KindRedemption
+}
+
+// TransactionFilters holds optional constraints for listing transactions.
+// FromDate and ToDate are inclusive.
+type TransactionFilters struct {
+	MemberID *int64
+	FromDate *time.Time
+	ToDate   *time.Time
+	Limit    int
+	Offset   int
+}
+
+// Account summarizes a member's capital. Balance is the sum of all
+// transactions; the other totals break it down by kind.
+type Account struct {
+	MemberID    int64   `json:"member_id"`
+	DisplayName string  `json:"display_name"`
+	Balance     float64 `json:"balance"`
+	PaidIn      float64 `json:"paid_in"`
+	Retained    float64 `json:"retained"`
+	Redeemed    float64 `json:"redeemed"`
+	Adjustments float64 `json:"adjustments"`
+	Shares      int     `json:"shares"`
+}
+
+// Plan is a share purchase paid in equal installments. Paid is the sum of
+// its installment transactions.
+type Plan struct {
+	ID             int32     `json:"id"`
+	MemberID       int64     `json:"member_id"`
+	Shares         int       `json:"shares"`
+	PricePerShare  float64   `json:"price_per_share"`
+	Total          float64   `json:"total"`
+	Installments   int       `json:"installments"`
+	IntervalMonths int       `json:"interval_months"`
+	FirstDueOn     time.Time `json:"first_due_on"`
+	Status         string    `json:"status"`
+	Paid           float64   `json:"paid"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Installment is one scheduled payment of a plan.
+// Status is paid, partial, due or overdue.
+type Installment struct {
+	Number int       `json:"number"`
+	DueOn  time.Time `json:"due_on"`
+	Amount float64   `json:"amount"`
+	Paid   float64   `json:"paid"`
+	Status string    `json:"status"`
+}
+
+// PlanWithSchedule is a plan and its installment schedule.
+type PlanWithSchedule struct {
+	Plan
+	Remaining float64       `json:"remaining"`
+	Schedule  []Installment `json:"schedule"`
+}
+
+// StatementLine is a transaction with the running balance after it.
+type StatementLine struct {
+	Transaction
+	Balance float64 `json:"balance"`
+}
+
+// Statement is a member's capital account activity over a period.
+type Statement struct {
+	MemberID       int64           `json:"member_id"`
+	DisplayName    string          `json:"display_name"`
+	From           *time.Time      `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance float64         `json:"opening_balance"`
+	OpeningShares  int             `json:"opening_shares"`
+	Lines          []StatementLine `json:"lines"`
+	ClosingBalance float64         `json:"closing_balance"`
+	ClosingShares  int             `json:"closing_shares"`
+}
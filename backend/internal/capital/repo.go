@@ -0,0 +1,337 @@
+package capital
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("invalid state transition")
+	ErrInsufficient = errors.New("insufficient capital")
+	ErrOverpayment  = errors.New("payment exceeds plan balance")
+)
+
+type Repo interface {
+	// Accounts summarizes every member with capital activity.
+	Accounts(ctx context.Context) ([]Account, error)
+	// Account summarizes one member; ErrNotFound for unknown members.
+	Account(ctx context.Context, memberID int64) (Account, error)
+	// Transactions lists transactions oldest first.
+	Transactions(ctx context.Context, f TransactionFilters) ([]Transaction, error)
+	GetTransaction(ctx context.Context, id int64) (Transaction, error)
+	// AddTransaction records a purchase, redemption or adjustment. A
+	// transaction that would leave the member with a negative balance or
+	// share count returns ErrInsufficient.
+	AddTransaction(ctx context.Context, t Transaction) (Transaction, error)
+	SetLedgerEntry(ctx context.Context, id int64, entryID int32) (Transaction, error)
+	// ImportRetained records the retained part of each allocation of a
+	// posted patronage run. Allocations already imported are skipped.
+	ImportRetained(ctx context.Context, runID int32) (int, error)
+
+	CreatePlan(ctx context.Context, p Plan) (Plan, error)
+	GetPlan(ctx context.Context, id int32) (Plan, error)
+	ListPlans(ctx context.Context, memberID int64) ([]Plan, error)
+	// CancelPlan cancels an active plan; ErrConflict otherwise.
+	CancelPlan(ctx context.Context, id int32) (Plan, error)
+	// PayInstallment records a payment towards an active plan and completes
+	// the plan, issuing its shares, once it is fully paid.
+	PayInstallment(ctx context.Context, planID int32, t Transaction) (Plan, Transaction, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const accountQuery = `
+SELECT m.id, m.display_name,
+  COALESCE(SUM(t.amount),0)::float8,
+  COALESCE(SUM(t.amount) FILTER (WHERE t.kind IN ('purchase','installment')),0)::float8,
+  COALESCE(SUM(t.amount) FILTER (WHERE t.kind='retained'),0)::float8,
+  COALESCE(SUM(t.amount) FILTER (WHERE t.kind='redemption'),0)::float8,
+  COALESCE(SUM(t.amount) FILTER (WHERE t.kind='adjustment'),0)::float8,
+  COALESCE(SUM(t.shares),0)::int
+FROM members m
+LEFT JOIN capital_transactions t ON t.member_id=m.id`
+
+func scanAccount(row pgx.Row) (Account, error) {
+	var a Account
+	err := row.Scan(&a.MemberID, &a.DisplayName, &a.Balance, &a.PaidIn, &a.Retained, &a.Redeemed, &a.Adjustments, &a.Shares)
+	return a, err
+}
+
+func (r *PgRepo) Accounts(ctx context.Context) ([]Account, error) {
+	rows, err := r.Pool.Query(ctx, accountQuery+`
+GROUP BY m.id, m.display_name
+HAVING COUNT(t.id) > 0
+ORDER BY m.display_name, m.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Account(ctx context.Context, memberID int64) (Account, error) {
+	a, err := scanAccount(r.Pool.QueryRow(ctx, accountQuery+`
+WHERE m.id=$1
+GROUP BY m.id, m.display_name`, memberID))
+	if err == pgx.ErrNoRows {
+		return Account{}, ErrNotFound
+	}
+	return a, err
+}
+
+const txColumns = `id, member_id, kind, amount::float8, shares, plan_id, reference, ledger_entry_id, note, occurred_on, created_by, created_at`
+
+func (r *PgRepo) Transactions(ctx context.Context, f TransactionFilters) ([]Transaction, error) {
+	query := `SELECT ` + txColumns + ` FROM capital_transactions
+WHERE ($1::bigint IS NULL OR member_id=$1)
+  AND ($2::date IS NULL OR occurred_on >= $2)
+  AND ($3::date IS NULL OR occurred_on <= $3)
+ORDER BY occurred_on, id`
+	args := []any{f.MemberID, f.FromDate, f.ToDate}
+	if f.Limit > 0 {
+		query += ` LIMIT $4 OFFSET $5`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $4`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Transaction
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetTransaction(ctx context.Context, id int64) (Transaction, error) {
+	t, err := scanTransaction(r.Pool.QueryRow(ctx, `SELECT `+txColumns+` FROM capital_transactions WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Transaction{}, ErrNotFound
+	}
+	return t, err
+}
+
+// insertTx inserts t unless it would take the member's balance or share
+// count below zero.
+const insertTx = `
+INSERT INTO capital_transactions (member_id, kind, amount, shares, plan_id, reference, note, occurred_on, created_by)
+SELECT $1::bigint, $2::text, $3::numeric, $4::int, $5::int, $6::text, $7::text, $8::date, $9::bigint
+WHERE ($3::numeric >= 0 AND $4::int >= 0) OR (
+  SELECT COALESCE(SUM(amount),0) + $3::numeric >= 0 AND COALESCE(SUM(shares),0) + $4::int >= 0
+  FROM capital_transactions WHERE member_id=$1)
+RETURNING ` + txColumns
+
+func (r *PgRepo) AddTransaction(ctx context.Context, t Transaction) (Transaction, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Transaction{}, err
+	}
+	defer tx.Rollback(ctx)
+	// Serialize changes to one member's account so concurrent redemptions
+	// can't both pass the balance check.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('capital'), $1::int)`, t.MemberID); err != nil {
+		return Transaction{}, err
+	}
+	out, err := scanTransaction(tx.QueryRow(ctx, insertTx, t.MemberID, t.Kind, t.Amount, t.Shares, t.PlanID, t.Reference, t.Note, t.OccurredOn, t.CreatedBy))
+	if err == pgx.ErrNoRows {
+		return Transaction{}, ErrInsufficient
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+	return out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) SetLedgerEntry(ctx context.Context, id int64, entryID int32) (Transaction, error) {
+	t, err := scanTransaction(r.Pool.QueryRow(ctx, `UPDATE capital_transactions SET ledger_entry_id=$2 WHERE id=$1 RETURNING `+txColumns, id, entryID))
+	if err == pgx.ErrNoRows {
+		return Transaction{}, ErrNotFound
+	}
+	return t, err
+}
+
+func (r *PgRepo) ImportRetained(ctx context.Context, runID int32) (int, error) {
+	var status string
+	err := r.Pool.QueryRow(ctx, `SELECT status FROM patronage_runs WHERE id=$1`, runID).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status != "posted" {
+		return 0, ErrConflict
+	}
+	tag, err := r.Pool.Exec(ctx, `
+INSERT INTO capital_transactions (member_id, kind, amount, reference, note, occurred_on)
+SELECT a.member_id, 'retained', a.retained, 'patronage:' || a.run_id || ':' || a.member_id,
+  'Retained patronage ' || to_char(pr.period_start, 'YYYY-MM-DD') || ' to ' || to_char(pr.period_end, 'YYYY-MM-DD'),
+  COALESCE(pr.posted_at::date, pr.period_end)
+FROM patronage_allocations a
+JOIN patronage_runs pr ON pr.id=a.run_id
+WHERE a.run_id=$1 AND a.retained > 0
+ON CONFLICT (reference) DO NOTHING`, runID)
+	if err != nil {
+		return 0, err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+const planColumns = `p.id, p.member_id, p.shares, p.price_per_share::float8, p.installments, p.interval_months, p.first_due_on, p.status,
+  COALESCE((SELECT SUM(amount) FROM capital_transactions t WHERE t.plan_id=p.id),0)::float8, p.created_at`
+
+func (r *PgRepo) CreatePlan(ctx context.Context, p Plan) (Plan, error) {
+	var id int32
+	err := r.Pool.QueryRow(ctx, `
+INSERT INTO capital_plans (member_id, shares, price_per_share, installments, interval_months, first_due_on)
+VALUES ($1,$2,$3,$4,$5,$6) RETURNING id`, p.MemberID, p.Shares, p.PricePerShare, p.Installments, p.IntervalMonths, p.FirstDueOn).Scan(&id)
+	if err != nil {
+		return Plan{}, err
+	}
+	return r.GetPlan(ctx, id)
+}
+
+func (r *PgRepo) GetPlan(ctx context.Context, id int32) (Plan, error) {
+	return getPlan(ctx, r.Pool, id, "")
+}
+
+func (r *PgRepo) ListPlans(ctx context.Context, memberID int64) ([]Plan, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+planColumns+` FROM capital_plans p WHERE p.member_id=$1 ORDER BY p.created_at DESC, p.id DESC`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Plan
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) CancelPlan(ctx context.Context, id int32) (Plan, error) {
+	tag, err := r.Pool.Exec(ctx, `UPDATE capital_plans SET status='cancelled' WHERE id=$1 AND status='active'`, id)
+	if err != nil {
+		return Plan{}, err
+	}
+	p, err := r.GetPlan(ctx, id)
+	if err == nil && tag.RowsAffected() == 0 {
+		return Plan{}, ErrConflict
+	}
+	return p, err
+}
+
+func (r *PgRepo) PayInstallment(ctx context.Context, planID int32, t Transaction) (Plan, Transaction, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Plan{}, Transaction{}, err
+	}
+	defer tx.Rollback(ctx)
+	p, err := getPlan(ctx, tx, planID, " FOR UPDATE OF p")
+	if err != nil {
+		return Plan{}, Transaction{}, err
+	}
+	if p.Status != PlanActive {
+		return Plan{}, Transaction{}, ErrConflict
+	}
+	remaining := round2(p.Total - p.Paid)
+	if t.Amount > remaining {
+		return Plan{}, Transaction{}, ErrOverpayment
+	}
+	t.MemberID, t.Kind, t.PlanID, t.Shares = p.MemberID, KindInstallment, &p.ID, 0
+	completes := t.Amount == remaining
+	if completes {
+		t.Shares = p.Shares
+	}
+	out, err := scanTransaction(tx.QueryRow(ctx, insertTx, t.MemberID, t.Kind, t.Amount, t.Shares, t.PlanID, t.Reference, t.Note, t.OccurredOn, t.CreatedBy))
+	if err != nil {
+		return Plan{}, Transaction{}, err
+	}
+	if completes {
+		if _, err := tx.Exec(ctx, `UPDATE capital_plans SET status='completed' WHERE id=$1`, planID); err != nil {
+			return Plan{}, Transaction{}, err
+		}
+	}
+	if p, err = getPlan(ctx, tx, planID, ""); err != nil {
+		return Plan{}, Transaction{}, err
+	}
+	return p, out, tx.Commit(ctx)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func getPlan(ctx context.Context, q querier, id int32, lock string) (Plan, error) {
+	p, err := scanPlan(q.QueryRow(ctx, `SELECT `+planColumns+` FROM capital_plans p WHERE p.id=$1`+lock, id))
+	if err == pgx.ErrNoRows {
+		return Plan{}, ErrNotFound
+	}
+	return p, err
+}
+
+func scanPlan(row pgx.Row) (Plan, error) {
+	var p Plan
+	var due pgtype.Date
+	if err := row.Scan(&p.ID, &p.MemberID, &p.Shares, &p.PricePerShare, &p.Installments, &p.IntervalMonths, &due, &p.Status, &p.Paid, &p.CreatedAt); err != nil {
+		return Plan{}, err
+	}
+	p.FirstDueOn = due.Time
+	p.Total = round2(float64(p.Shares) * p.PricePerShare)
+	return p, nil
+}
+
+func scanTransaction(row pgx.Row) (Transaction, error) {
+	var t Transaction
+	var occurred pgtype.Date
+	var planID, entryID pgtype.Int4
+	var createdBy pgtype.Int8
+	var ref pgtype.Text
+	if err := row.Scan(&t.ID, &t.MemberID, &t.Kind, &t.Amount, &t.Shares, &planID, &ref, &entryID, &t.Note, &occurred, &createdBy, &t.CreatedAt); err != nil {
+		return Transaction{}, err
+	}
+	t.OccurredOn = occurred.Time
+	if planID.Valid {
+		t.PlanID = &planID.Int32
+	}
+	if ref.Valid {
+		t.Reference = &ref.String
+	}
+	if entryID.Valid {
+		t.LedgerEntryID = &entryID.Int32
+	}
+	if createdBy.Valid {
+		t.CreatedBy = &createdBy.Int64
+	}
+	return t, nil
+}
@@ -0,0 +1,29 @@
+package capital
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	admin := httpmw.RequirePermission("capital.manage")
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequireAuth)
+		r.With(httpmw.RequirePermission("capital.view")).Get("/accounts", h.ListAccounts)
+		r.Get("/members/{id}", h.GetAccount)
+		r.Get("/members/{id}/transactions", h.ListTransactions)
+		r.Get("/members/{id}/statement", h.Statement)
+		r.Get("/members/{id}/certificate", h.Certificate)
+		r.Get("/members/{id}/plans", h.ListPlans)
+		r.With(admin).Post("/members/{id}/plans", h.CreatePlan)
+		r.With(admin).Post("/members/{id}/purchases", h.Purchase)
+		r.With(admin).Post("/members/{id}/redemptions", h.Redeem)
+		r.With(admin).Post("/members/{id}/adjustments", h.Adjust)
+		r.Get("/plans/{id}", h.GetPlan)
+		r.With(admin).Post("/plans/{id}/payments", h.PayPlan)
+		r.With(admin).Post("/plans/{id}/cancel", h.CancelPlan)
+		r.With(admin).Post("/retained/import", h.ImportRetained)
+		r.With(admin).Post("/transactions/{id}/post", h.PostToLedger)
+	}
+	r.Route("/capital", route)
+}
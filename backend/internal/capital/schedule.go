@@ -0,0 +1,61 @@
+package capital
+
+import (
+	"math"
+	"time"
+)
+
+// Schedule splits a plan's total into equal installments, the last one
+// absorbing any rounding, and applies the amount paid so far to them in
+// order. Unpaid installments due before today are overdue.
+func Schedule(p Plan, today time.Time) PlanWithSchedule {
+	out := PlanWithSchedule{Plan: p, Remaining: round2(p.Total - p.Paid), Schedule: make([]Installment, 0, p.Installments)}
+	each := math.Floor(p.Total/float64(p.Installments)*100) / 100
+	left := p.Paid
+	for i := 0; i < p.Installments; i++ {
+		in := Installment{Number: i + 1, DueOn: p.FirstDueOn.AddDate(0, i*p.IntervalMonths, 0), Amount: each}
+		if i == p.Installments-1 {
+			in.Amount = round2(p.Total - each*float64(p.Installments-1))
+		}
+		in.Paid = round2(math.Min(left, in.Amount))
+		left = round2(left - in.Paid)
+		switch {
+		case in.Paid >= in.Amount:
+			in.Status = "paid"
+		case in.Paid > 0:
+			in.Status = "partial"
+		case in.DueOn.Before(today):
+			in.Status = "overdue"
+		default:
+			in.Status = "due"
+		}
+		out.Schedule = append(out.Schedule, in)
+	}
+	return out
+}
+
+// BuildStatement runs a balance through txns, which must be ordered by
+// date. Transactions before from make up the opening balance; those after
+// to are ignored.
+func BuildStatement(acct Account, txns []Transaction, from *time.Time, to time.Time) Statement {
+	st := Statement{MemberID: acct.MemberID, DisplayName: acct.DisplayName, From: from, To: to, Lines: []StatementLine{}}
+	balance, shares := 0.0, 0
+	for _, t := range txns {
+		if t.OccurredOn.After(to) {
+			break
+		}
+		balance = round2(balance + t.Amount)
+		shares += t.Shares
+		if from != nil && t.OccurredOn.Before(*from) {
+			st.OpeningBalance, st.OpeningShares = balance, shares
+			continue
+		}
+		st.Lines = append(st.Lines, StatementLine{Transaction: t, Balance: balance})
+	}
+	st.ClosingBalance, st.ClosingShares = balance, shares
+	return st
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,245 @@
+package dues
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+func (h Handlers) scheduler() Scheduler {
+	return Scheduler{Repo: h.Repo, Ledger: h.Ledger}
+}
+
+// ListPlans handles GET /api/dues/plans
+func (h Handlers) ListPlans(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListPlans(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Plan{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// CreatePlan handles POST /api/dues/plans
+func (h Handlers) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Name        string  `json:"name"`
+		Amount      float64 `json:"amount"`
+		Frequency   string  `json:"frequency"`
+		MemberClass string  `json:"member_class"`
+		StartDate   string  `json:"start_date"`
+		EndDate     string  `json:"end_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.Name == "" || in.StartDate == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name and start_date required")
+		return
+	}
+	if in.Amount <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+	if !ValidFrequency(in.Frequency) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "frequency must be 'monthly', 'quarterly', or 'annual'")
+		return
+	}
+	start, err := httpx.ParseDate(in.StartDate)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid start_date")
+		return
+	}
+	// Periods are anchored on the start day; days past the 28th would drift
+	// across short months.
+	if start.Day() > 28 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "start_date day must be between 1 and 28")
+		return
+	}
+	end, err := httpx.ParseDate(in.EndDate)
+	if err != nil || (end != nil && end.Before(*start)) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid end_date")
+		return
+	}
+	p, err := h.Repo.CreatePlan(r.Context(), Plan{
+		Name:        in.Name,
+		Amount:      in.Amount,
+		Frequency:   in.Frequency,
+		MemberClass: strings.TrimSpace(in.MemberClass),
+		StartDate:   *start,
+		EndDate:     end,
+	})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// GetPlan handles GET /api/dues/plans/{id}
+func (h Handlers) GetPlan(w http.ResponseWriter, r *http.Request) {
+	id, ok := planID(w, r)
+	if !ok {
+		return
+	}
+	p, err := h.Repo.GetPlan(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// ListEnrollments handles GET /api/dues/plans/{id}/enrollments
+func (h Handlers) ListEnrollments(w http.ResponseWriter, r *http.Request) {
+	id, ok := planID(w, r)
+	if !ok {
+		return
+	}
+	items, err := h.Repo.ListEnrollments(r.Context(), id)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Enrollment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// Enroll handles POST /api/dues/plans/{id}/enrollments
+func (h Handlers) Enroll(w http.ResponseWriter, r *http.Request) {
+	id, ok := planID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		MemberID  int64  `json:"member_id"`
+		StartDate string `json:"start_date"`
+		EndDate   string `json:"end_date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.MemberID <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member_id required")
+		return
+	}
+	plan, err := h.Repo.GetPlan(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	start, err := httpx.ParseDate(in.StartDate)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid start_date")
+		return
+	}
+	if start == nil {
+		start = &plan.StartDate
+	}
+	end, err := httpx.ParseDate(in.EndDate)
+	if err != nil || (end != nil && end.Before(*start)) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid end_date")
+		return
+	}
+	if plan.MemberClass != "" {
+		roles, err := h.Repo.MemberRoles(r.Context())
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+			return
+		}
+		held, ok := roles[in.MemberID]
+		if !ok {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "plan or member not found")
+			return
+		}
+		if !plan.Matches(held) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "member does not hold the plan's member_class role "+strconv.Quote(plan.MemberClass))
+			return
+		}
+	}
+	e, err := h.Repo.Enroll(r.Context(), id, in.MemberID, *start, end)
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			httpmw.WriteJSONError(w, http.StatusNotFound, "plan or member not found")
+		case ErrConflict:
+			httpmw.WriteJSONError(w, http.StatusConflict, "member already enrolled")
+		default:
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "enroll failed")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// PreviewAssessments handles GET /api/dues/assessments/preview?as_of=YYYY-MM-DD
+// It is a dry run: nothing is written to the ledger.
+func (h Handlers) PreviewAssessments(w http.ResponseWriter, r *http.Request) {
+	h.runAssessments(w, r, true)
+}
+
+// PostAssessments handles POST /api/dues/assessments/run?as_of=YYYY-MM-DD
+func (h Handlers) PostAssessments(w http.ResponseWriter, r *http.Request) {
+	h.runAssessments(w, r, false)
+}
+
+func (h Handlers) runAssessments(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	asOf, err := httpx.QueryDate(r, "as_of")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid as_of")
+		return
+	}
+	if asOf == nil {
+		now := time.Now().UTC()
+		asOf = &now
+	}
+	res, err := h.scheduler().Run(r.Context(), *asOf, dryRun)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "assessment failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func planID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
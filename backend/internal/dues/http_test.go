@@ -0,0 +1,405 @@
+package dues
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"coop.tools/backend/internal/members"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	plans       []Plan
+	enrollments []Enrollment
+	history     map[int64][]members.StatusChange
+	roles       map[int64][]string
+	ledger      *mockLedger
+}
+
+func (m *mockRepo) ListPlans(_ context.Context) ([]Plan, error) {
+	return append([]Plan(nil), m.plans...), nil
+}
+
+func (m *mockRepo) GetPlan(_ context.Context, id int32) (Plan, error) {
+	for _, p := range m.plans {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return Plan{}, ErrNotFound
+}
+
+func (m *mockRepo) CreatePlan(_ context.Context, p Plan) (Plan, error) {
+	p.ID = int32(len(m.plans) + 1)
+	m.plans = append(m.plans, p)
+	return p, nil
+}
+
+func (m *mockRepo) Enroll(_ context.Context, planID int32, memberID int64, start time.Time, end *time.Time) (Enrollment, error) {
+	for _, e := range m.enrollments {
+		if e.PlanID == planID && e.MemberID == memberID {
+			return Enrollment{}, ErrConflict
+		}
+	}
+	e := Enrollment{ID: int32(len(m.enrollments) + 1), PlanID: planID, MemberID: memberID, StartDate: start, EndDate: end}
+	m.enrollments = append(m.enrollments, e)
+	return e, nil
+}
+
+func (m *mockRepo) ListEnrollments(_ context.Context, planID int32) ([]Enrollment, error) {
+	var out []Enrollment
+	for _, e := range m.enrollments {
+		if e.PlanID == planID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) PostedKeys(_ context.Context) (map[int64]map[string]int32, error) {
+	out := map[int64]map[string]int32{}
+	if m.ledger == nil {
+		return out, nil
+	}
+	for _, e := range m.ledger.entries {
+		if out[int64(*e.MemberID)] == nil {
+			out[int64(*e.MemberID)] = map[string]int32{}
+		}
+		out[int64(*e.MemberID)][e.Notes] = e.ID
+	}
+	return out, nil
+}
+
+func (m *mockRepo) StatusHistory(_ context.Context) (map[int64][]members.StatusChange, error) {
+	return m.history, nil
+}
+
+func (m *mockRepo) MemberRoles(_ context.Context) (map[int64][]string, error) {
+	return m.roles, nil
+}
+
+// mockLedger enforces (member_id, idempotency_key) uniqueness like the real
+// table. The key is stashed in Notes so PostedKeys can read it back.
+type mockLedger struct {
+	entries []ledger.LedgerEntry
+}
+
+func (m *mockLedger) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error) {
+	for _, e := range m.entries {
+		if *e.MemberID == *memberID && e.Notes == idempotencyKey {
+			return e, true, nil
+		}
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 1), Type: entryType, Amount: amount, Description: description, MemberID: memberID, Notes: idempotencyKey}
+	m.entries = append(m.entries, e)
+	return e, false, nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo *mockRepo) *chi.Mux {
+	if repo.ledger == nil {
+		repo.ledger = &mockLedger{}
+	}
+	r := chi.NewRouter()
+	// X-User-Id 1 is an admin, anything else a plain member
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		if id <= 0 {
+			return httpmw.Principal{}, false, nil
+		}
+		role := "member"
+		if id == 1 {
+			role = "admin"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Ledger: repo.ledger})
+	return r
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+// ---- Tests ----
+
+func TestDuePeriods(t *testing.T) {
+	end := date("2025-06-01")
+	tests := []struct {
+		name string
+		plan Plan
+		enr  Enrollment
+		asOf string
+		want int
+	}{
+		{"monthly from plan start", Plan{Frequency: "monthly", StartDate: date("2025-01-01")}, Enrollment{StartDate: date("2025-01-01")}, "2025-03-15", 3},
+		{"late enrollment skips earlier periods", Plan{Frequency: "monthly", StartDate: date("2025-01-01")}, Enrollment{StartDate: date("2025-02-10")}, "2025-04-01", 2},
+		{"quarterly", Plan{Frequency: "quarterly", StartDate: date("2025-01-01")}, Enrollment{StartDate: date("2025-01-01")}, "2025-12-31", 4},
+		{"annual before start", Plan{Frequency: "annual", StartDate: date("2025-01-01")}, Enrollment{StartDate: date("2025-01-01")}, "2024-12-31", 0},
+		{"plan end date", Plan{Frequency: "monthly", StartDate: date("2025-01-01"), EndDate: &end}, Enrollment{StartDate: date("2025-01-01")}, "2025-12-31", 6},
+		{"enrollment end date", Plan{Frequency: "monthly", StartDate: date("2025-01-01")}, Enrollment{StartDate: date("2025-01-01"), EndDate: &end}, "2025-12-31", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DuePeriods(tt.plan, tt.enr, date(tt.asOf))
+			if len(got) != tt.want {
+				t.Fatalf("expected %d periods, got %d (%v)", tt.want, len(got), got)
+			}
+		})
+	}
+}
+
+func TestHandlers_CreatePlanAndEnroll(t *testing.T) {
+	repo := &mockRepo{roles: map[int64][]string{5: {"member", "worker"}, 6: {"member"}}}
+	r := setupRouter(repo)
+
+	// members cannot create plans
+	req := httptest.NewRequest("POST", "/dues/plans", strings.NewReader(`{"name":"Monthly","amount":25,"frequency":"monthly","start_date":"2025-01-01"}`))
+	req.Header.Set("X-User-Id", "2")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+
+	// invalid frequency
+	req = httptest.NewRequest("POST", "/dues/plans", strings.NewReader(`{"name":"Weekly","amount":5,"frequency":"weekly","start_date":"2025-01-01"}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	// start day that would drift
+	req = httptest.NewRequest("POST", "/dues/plans", strings.NewReader(`{"name":"Monthly","amount":25,"frequency":"monthly","start_date":"2025-01-31"}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/dues/plans", strings.NewReader(`{"name":"Monthly","amount":25,"frequency":"monthly","member_class":"worker","start_date":"2025-01-01"}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var p Plan
+	_ = json.Unmarshal(rr.Body.Bytes(), &p)
+	if p.ID != 1 || p.MemberClass != "worker" {
+		t.Fatalf("unexpected plan: %+v", p)
+	}
+
+	// enroll defaults start_date to plan start
+	req = httptest.NewRequest("POST", "/dues/plans/1/enrollments", strings.NewReader(`{"member_id":5}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var e Enrollment
+	_ = json.Unmarshal(rr.Body.Bytes(), &e)
+	if !e.StartDate.Equal(date("2025-01-01")) {
+		t.Fatalf("expected start_date=2025-01-01, got %s", e.StartDate)
+	}
+
+	// member outside the plan's class
+	req = httptest.NewRequest("POST", "/dues/plans/1/enrollments", strings.NewReader(`{"member_id":6}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || len(repo.enrollments) != 1 {
+		t.Fatalf("expected 400 for a non-worker, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	// unknown member
+	req = httptest.NewRequest("POST", "/dues/plans/1/enrollments", strings.NewReader(`{"member_id":404}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+
+	// duplicate enrollment
+	req = httptest.NewRequest("POST", "/dues/plans/1/enrollments", strings.NewReader(`{"member_id":5}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	// unknown plan
+	req = httptest.NewRequest("POST", "/dues/plans/99/enrollments", strings.NewReader(`{"member_id":5}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_PreviewAndRunAssessments(t *testing.T) {
+	repo := &mockRepo{
+		plans: []Plan{{ID: 1, Name: "Monthly", Amount: 25, Frequency: "monthly", StartDate: date("2025-01-01")}},
+		enrollments: []Enrollment{
+			{ID: 1, PlanID: 1, MemberID: 5, StartDate: date("2025-01-01")},
+			{ID: 2, PlanID: 1, MemberID: 6, StartDate: date("2025-03-01")},
+		},
+	}
+	r := setupRouter(repo)
+
+	// preview posts nothing
+	req := httptest.NewRequest("GET", "/dues/assessments/preview?as_of=2025-03-15", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var preview RunResult
+	_ = json.Unmarshal(rr.Body.Bytes(), &preview)
+	if !preview.DryRun || len(preview.Assessments) != 4 || preview.Total != 100 {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if len(repo.ledger.entries) != 0 {
+		t.Fatalf("preview must not post, got %d entries", len(repo.ledger.entries))
+	}
+
+	// run posts them
+	req = httptest.NewRequest("POST", "/dues/assessments/run?as_of=2025-03-15", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var run RunResult
+	_ = json.Unmarshal(rr.Body.Bytes(), &run)
+	if run.DryRun || len(run.Assessments) != 4 || run.Assessments[0].EntryID == nil {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+	if len(repo.ledger.entries) != 4 || repo.ledger.entries[0].Type != "dues" {
+		t.Fatalf("expected 4 dues entries, got %+v", repo.ledger.entries)
+	}
+
+	// a second run is a no-op
+	req = httptest.NewRequest("POST", "/dues/assessments/run?as_of=2025-03-15", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	_ = json.Unmarshal(rr.Body.Bytes(), &run)
+	if len(run.Assessments) != 0 || len(repo.ledger.entries) != 4 {
+		t.Fatalf("expected idempotent rerun, got %d new and %d total", len(run.Assessments), len(repo.ledger.entries))
+	}
+
+	// invalid as_of
+	req = httptest.NewRequest("GET", "/dues/assessments/preview?as_of=March", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestScheduler_SkipsInactivePeriods(t *testing.T) {
+	change := func(status, at string) members.StatusChange {
+		return members.StatusChange{ToStatus: status, EffectiveAt: date(at).Add(10 * time.Hour)}
+	}
+	repo := &mockRepo{
+		plans: []Plan{{ID: 1, Name: "Monthly", Amount: 25, Frequency: "monthly", StartDate: date("2025-01-01")}},
+		enrollments: []Enrollment{
+			{ID: 1, PlanID: 1, MemberID: 5, StartDate: date("2025-01-01")},
+			{ID: 2, PlanID: 1, MemberID: 6, StartDate: date("2025-01-01")},
+			{ID: 3, PlanID: 1, MemberID: 7, StartDate: date("2025-01-01")},
+		},
+		history: map[int64][]members.StatusChange{
+			// applied in December, approved on February 1st
+			5: {change("applicant", "2024-12-10"), change("active", "2025-02-01")},
+			// suspended over March, reinstated April 10th
+			6: {change("active", "2024-06-01"), change("suspended", "2025-02-20"), change("active", "2025-04-10")},
+			// died on April 1st; no dues from that period on
+			7: {change("active", "2024-06-01"), change("deceased", "2025-04-01")},
+		},
+	}
+	items, err := Scheduler{Repo: repo}.Outstanding(context.Background(), date("2025-05-15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[int64][]string{}
+	for _, a := range items {
+		got[a.MemberID] = append(got[a.MemberID], a.PeriodStart.Format("01-02"))
+	}
+	want := map[int64]string{5: "[02-01 03-01 04-01 05-01]", 6: "[01-01 02-01 05-01]", 7: "[01-01 02-01 03-01]"}
+	for id, w := range want {
+		if g := fmt.Sprint(got[id]); g != w {
+			t.Errorf("member %d: expected periods %s, got %s", id, w, g)
+		}
+	}
+}
+
+func TestScheduler_MatchesMemberClass(t *testing.T) {
+	repo := &mockRepo{
+		plans: []Plan{
+			{ID: 1, Name: "Worker dues", Amount: 25, Frequency: "monthly", MemberClass: "Worker", StartDate: date("2025-01-01")},
+			{ID: 2, Name: "Everyone", Amount: 5, Frequency: "annual", StartDate: date("2025-01-01")},
+		},
+		enrollments: []Enrollment{
+			{ID: 1, PlanID: 1, MemberID: 5, StartDate: date("2025-01-01")},
+			// enrolled while a worker, since moved to another class
+			{ID: 2, PlanID: 1, MemberID: 6, StartDate: date("2025-01-01")},
+			{ID: 3, PlanID: 2, MemberID: 6, StartDate: date("2025-01-01")},
+		},
+		roles: map[int64][]string{5: {"member", "worker"}, 6: {"member"}},
+	}
+	items, err := Scheduler{Repo: repo}.Outstanding(context.Background(), date("2025-01-15"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, a := range items {
+		got[fmt.Sprintf("%d:%d", a.PlanID, a.MemberID)] = true
+	}
+	if len(items) != 2 || !got["1:5"] || !got["2:6"] {
+		t.Fatalf("unexpected assessments: %+v", items)
+	}
+}
+
+// TestPgRepo_InsertArity checks that every INSERT in repo.go binds as many
+// placeholders as it names columns; the handler tests never reach Postgres.
+func TestPgRepo_InsertArity(t *testing.T) {
+	src, err := os.ReadFile("repo.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := regexp.MustCompile(`INSERT INTO \w+ \(([^)]*)\)\s*VALUES \(([^)]*)\)`).FindAllStringSubmatch(string(src), -1)
+	if len(stmts) == 0 {
+		t.Fatal("no INSERT statements found")
+	}
+	for _, m := range stmts {
+		cols := len(strings.Split(m[1], ","))
+		vals := len(strings.Split(m[2], ","))
+		if cols != vals {
+			t.Errorf("%d columns but %d values in %q", cols, vals, m[0])
+		}
+	}
+}
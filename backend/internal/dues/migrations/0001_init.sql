@@ -0,0 +1,25 @@
+-- backend/internal/dues/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS dues_plans (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  frequency TEXT NOT NULL CHECK (frequency IN ('monthly','quarterly','annual')),
+  member_class TEXT NOT NULL DEFAULT '',
+  start_date DATE NOT NULL,
+  end_date DATE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE TABLE IF NOT EXISTS dues_enrollments (
+  id SERIAL PRIMARY KEY,
+  plan_id INTEGER NOT NULL REFERENCES dues_plans(id) ON DELETE CASCADE,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  start_date DATE NOT NULL,
+  end_date DATE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (plan_id, member_id),
+  CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS dues_enrollments_member_id_idx ON dues_enrollments (member_id);
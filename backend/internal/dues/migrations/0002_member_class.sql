@@ -0,0 +1,4 @@
+-- backend/internal/dues/migrations/0002_member_class.sql
+-- Restores the plan member class on databases where an earlier build
+-- dropped it. A class limits a plan to members holding a role of that name.
+ALTER TABLE dues_plans ADD COLUMN IF NOT EXISTS member_class TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,64 @@
+package dues
+
+import (
+	"strings"
+	"time"
+)
+
+// Plan describes a recurring dues amount charged to enrolled members.
+// MemberClass, when set, limits the plan to members holding a role of that
+// name (their base role or one assigned through rbac).
+type Plan struct {
+	ID          int32      `json:"id"`
+	Name        string     `json:"name"`
+	Amount      float64    `json:"amount"`
+	Frequency   string     `json:"frequency"` // "monthly", "quarterly", "annual"
+	MemberClass string     `json:"member_class"`
+	StartDate   time.Time  `json:"start_date"`
+	EndDate     *time.Time `json:"end_date"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Matches reports whether a member holding roles belongs to p's member
+// class. Plans without a class apply to every member.
+func (p Plan) Matches(roles []string) bool {
+	if p.MemberClass == "" {
+		return true
+	}
+	for _, r := range roles {
+		if strings.EqualFold(r, p.MemberClass) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enrollment links a member to a plan for a date range.
+type Enrollment struct {
+	ID        int32      `json:"id"`
+	PlanID    int32      `json:"plan_id"`
+	MemberID  int64      `json:"member_id"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   *time.Time `json:"end_date"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Assessment is a single dues charge for one member and one plan period.
+// EntryID is set once the assessment has been posted to the ledger.
+type Assessment struct {
+	PlanID         int32     `json:"plan_id"`
+	PlanName       string    `json:"plan_name"`
+	MemberID       int64     `json:"member_id"`
+	PeriodStart    time.Time `json:"period_start"`
+	Amount         float64   `json:"amount"`
+	IdempotencyKey string    `json:"idempotency_key"`
+	EntryID        *int32    `json:"entry_id,omitempty"`
+}
+
+// RunResult summarizes a preview or posting run.
+type RunResult struct {
+	AsOf        time.Time    `json:"as_of"`
+	DryRun      bool         `json:"dry_run"`
+	Assessments []Assessment `json:"assessments"`
+	Total       float64      `json:"total"`
+}
@@ -0,0 +1,243 @@
+package dues
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"coop.tools/backend/internal/members"
+)
+
+var (
+	ErrNotFound = errors.New("dues plan not found")
+	ErrConflict = errors.New("member already enrolled in plan")
+)
+
+type Repo interface {
+	ListPlans(ctx context.Context) ([]Plan, error)
+	GetPlan(ctx context.Context, id int32) (Plan, error)
+	CreatePlan(ctx context.Context, p Plan) (Plan, error)
+	// Enroll adds a member to a plan. Returns ErrNotFound when the plan or
+	// member does not exist and ErrConflict when already enrolled.
+	Enroll(ctx context.Context, planID int32, memberID int64, start time.Time, end *time.Time) (Enrollment, error)
+	ListEnrollments(ctx context.Context, planID int32) ([]Enrollment, error)
+	// PostedKeys returns the dues idempotency keys already present in the
+	// ledger, keyed by member id.
+	PostedKeys(ctx context.Context) (map[int64]map[string]int32, error)
+	// StatusHistory returns every member's status changes, oldest first,
+	// keyed by member id.
+	StatusHistory(ctx context.Context) (map[int64][]members.StatusChange, error)
+	// MemberRoles returns every member's base role and currently assigned
+	// roles, keyed by member id, for matching plan member classes.
+	MemberRoles(ctx context.Context) (map[int64][]string, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+func (r *PgRepo) ListPlans(ctx context.Context) ([]Plan, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, name, amount, frequency, member_class, start_date, end_date, created_at
+FROM dues_plans
+ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Plan
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetPlan(ctx context.Context, id int32) (Plan, error) {
+	p, err := scanPlan(r.Pool.QueryRow(ctx, `
+SELECT id, name, amount, frequency, member_class, start_date, end_date, created_at
+FROM dues_plans
+WHERE id=$1`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Plan{}, ErrNotFound
+		}
+		return Plan{}, err
+	}
+	return p, nil
+}
+
+func (r *PgRepo) CreatePlan(ctx context.Context, p Plan) (Plan, error) {
+	return scanPlan(r.Pool.QueryRow(ctx, `
+INSERT INTO dues_plans (name, amount, frequency, member_class, start_date, end_date)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id, name, amount, frequency, member_class, start_date, end_date, created_at
+`, p.Name, p.Amount, p.Frequency, p.MemberClass, dateParam(&p.StartDate), dateParam(p.EndDate)))
+}
+
+func (r *PgRepo) Enroll(ctx context.Context, planID int32, memberID int64, start time.Time, end *time.Time) (Enrollment, error) {
+	e, err := scanEnrollment(r.Pool.QueryRow(ctx, `
+INSERT INTO dues_enrollments (plan_id, member_id, start_date, end_date)
+VALUES ($1,$2,$3,$4)
+RETURNING id, plan_id, member_id, start_date, end_date, created_at
+`, planID, memberID, dateParam(&start), dateParam(end)))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case "23505": // unique_violation
+				return Enrollment{}, ErrConflict
+			case "23503": // foreign_key_violation
+				return Enrollment{}, ErrNotFound
+			}
+		}
+		return Enrollment{}, err
+	}
+	return e, nil
+}
+
+func (r *PgRepo) ListEnrollments(ctx context.Context, planID int32) ([]Enrollment, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, plan_id, member_id, start_date, end_date, created_at
+FROM dues_enrollments
+WHERE plan_id=$1
+ORDER BY id`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Enrollment
+	for rows.Next() {
+		e, err := scanEnrollment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) PostedKeys(ctx context.Context) (map[int64]map[string]int32, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, member_id, idempotency_key
+FROM ledger_entries
+WHERE type='dues' AND member_id IS NOT NULL AND idempotency_key LIKE 'dues:%'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64]map[string]int32{}
+	for rows.Next() {
+		var id int32
+		var memberID int64
+		var key string
+		if err := rows.Scan(&id, &memberID, &key); err != nil {
+			return nil, err
+		}
+		if out[memberID] == nil {
+			out[memberID] = map[string]int32{}
+		}
+		out[memberID][key] = id
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) StatusHistory(ctx context.Context) (map[int64][]members.StatusChange, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT member_id, to_status, effective_at
+FROM member_status_changes
+ORDER BY member_id, effective_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64][]members.StatusChange{}
+	for rows.Next() {
+		var c members.StatusChange
+		if err := rows.Scan(&c.MemberID, &c.ToStatus, &c.EffectiveAt); err != nil {
+			return nil, err
+		}
+		out[c.MemberID] = append(out[c.MemberID], c)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) MemberRoles(ctx context.Context) (map[int64][]string, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT id, role FROM members
+UNION ALL
+SELECT a.member_id, ro.name
+FROM rbac_role_assignments a
+JOIN rbac_roles ro ON ro.id = a.role_id
+WHERE a.starts_at <= now() AND (a.ends_at IS NULL OR a.ends_at > now())`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var role string
+		if err := rows.Scan(&id, &role); err != nil {
+			return nil, err
+		}
+		out[id] = append(out[id], role)
+	}
+	return out, rows.Err()
+}
+
+func scanPlan(row pgx.Row) (Plan, error) {
+	var p Plan
+	var start, end pgtype.Date
+	var createdAt pgtype.Timestamptz
+	if err := row.Scan(&p.ID, &p.Name, &p.Amount, &p.Frequency, &p.MemberClass, &start, &end, &createdAt); err != nil {
+		return Plan{}, err
+	}
+	p.StartDate = start.Time
+	if end.Valid {
+		t := end.Time
+		p.EndDate = &t
+	}
+	p.CreatedAt = createdAt.Time
+	return p, nil
+}
+
+func scanEnrollment(row pgx.Row) (Enrollment, error) {
+	var e Enrollment
+	var start, end pgtype.Date
+	var createdAt pgtype.Timestamptz
+	if err := row.Scan(&e.ID, &e.PlanID, &e.MemberID, &start, &end, &createdAt); err != nil {
+		return Enrollment{}, err
+	}
+	e.StartDate = start.Time
+	if end.Valid {
+		t := end.Time
+		e.EndDate = &t
+	}
+	e.CreatedAt = createdAt.Time
+	return e, nil
+}
+
+func dateParam(t *time.Time) pgtype.Date {
+	if t == nil {
+		return pgtype.Date{}
+	}
+	return pgtype.Date{Time: *t, Valid: true}
+}
@@ -0,0 +1,19 @@
+package dues
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Get("/plans", h.ListPlans)
+		r.With(httpmw.RequirePermission("dues.manage")).Post("/plans", h.CreatePlan)
+		r.Get("/plans/{id}", h.GetPlan)
+		r.With(httpmw.RequirePermission("dues.manage")).Get("/plans/{id}/enrollments", h.ListEnrollments)
+		r.With(httpmw.RequirePermission("dues.manage")).Post("/plans/{id}/enrollments", h.Enroll)
+		r.With(httpmw.RequirePermission("dues.manage")).Get("/assessments/preview", h.PreviewAssessments)
+		r.With(httpmw.RequirePermission("dues.manage")).Post("/assessments/run", h.PostAssessments)
+	}
+	r.Route("/dues", route)
+}
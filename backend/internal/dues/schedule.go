@@ -0,0 +1,178 @@
+package dues
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"coop.tools/backend/internal/ledger"
+	"coop.tools/backend/internal/members"
+)
+
+// LedgerPoster is the subset of ledger.Repo used to post assessments.
+type LedgerPoster interface {
+	Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+// ValidFrequency reports whether f is a supported plan frequency.
+func ValidFrequency(f string) bool {
+	return f == "monthly" || f == "quarterly" || f == "annual"
+}
+
+// DuePeriods returns the period start dates owed by an enrollment up to and
+// including asOf. Periods are anchored on the plan start date; a period is
+// owed when it starts inside both the plan and the enrollment date ranges.
+func DuePeriods(p Plan, e Enrollment, asOf time.Time) []time.Time {
+	months := 0
+	switch p.Frequency {
+	case "monthly":
+		months = 1
+	case "quarterly":
+		months = 3
+	case "annual":
+		months = 12
+	default:
+		return nil
+	}
+	var out []time.Time
+	for k := 0; ; k++ {
+		period := p.StartDate.AddDate(0, k*months, 0)
+		if period.After(asOf) {
+			break
+		}
+		if p.EndDate != nil && period.After(*p.EndDate) {
+			break
+		}
+		if e.EndDate != nil && period.After(*e.EndDate) {
+			break
+		}
+		if period.Before(e.StartDate) {
+			continue
+		}
+		out = append(out, period)
+	}
+	return out
+}
+
+// ActiveForPeriod reports whether a member with the given status history
+// owes the period starting on period: they must be active at the end of
+// that day, so joining on the day counts and leaving on it does not.
+func ActiveForPeriod(history []members.StatusChange, period time.Time) bool {
+	return members.ActiveAt(history, period.AddDate(0, 0, 1).Add(-time.Nanosecond))
+}
+
+// IdempotencyKey identifies one plan period in the ledger. Together with the
+// member id it is unique in ledger_entries, which makes posting replay-safe.
+func IdempotencyKey(planID int32, period time.Time) string {
+	return fmt.Sprintf("dues:%d:%s", planID, period.Format("2006-01-02"))
+}
+
+// Scheduler computes outstanding assessments and posts them to the ledger.
+type Scheduler struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+// Outstanding lists assessments owed as of asOf that are not yet in the
+// ledger. Members only owe periods they were active for: nothing while
+// applying, suspended or after leaving. Enrollments whose member no longer
+// matches the plan's member class are skipped.
+func (s Scheduler) Outstanding(ctx context.Context, asOf time.Time) ([]Assessment, error) {
+	plans, err := s.Repo.ListPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	posted, err := s.Repo.PostedKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.Repo.StatusHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.Repo.MemberRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := []Assessment{}
+	for _, p := range plans {
+		enrollments, err := s.Repo.ListEnrollments(ctx, p.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range enrollments {
+			if !p.Matches(roles[e.MemberID]) {
+				continue
+			}
+			for _, period := range DuePeriods(p, e, asOf) {
+				key := IdempotencyKey(p.ID, period)
+				if _, ok := posted[e.MemberID][key]; ok {
+					continue
+				}
+				if !ActiveForPeriod(history[e.MemberID], period) {
+					continue
+				}
+				out = append(out, Assessment{
+					PlanID:         p.ID,
+					PlanName:       p.Name,
+					MemberID:       e.MemberID,
+					PeriodStart:    period,
+					Amount:         p.Amount,
+					IdempotencyKey: key,
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// Run computes outstanding assessments and, unless dryRun is set, posts each
+// one as a "dues" ledger entry. Posting reuses the ledger's
+// (member_id, idempotency_key) guarantee, so concurrent or repeated runs never
+// double-charge a member.
+func (s Scheduler) Run(ctx context.Context, asOf time.Time, dryRun bool) (RunResult, error) {
+	items, err := s.Outstanding(ctx, asOf)
+	if err != nil {
+		return RunResult{}, err
+	}
+	res := RunResult{AsOf: asOf, DryRun: dryRun, Assessments: []Assessment{}}
+	for _, a := range items {
+		if !dryRun {
+			mid := int32(a.MemberID)
+			desc := fmt.Sprintf("Dues: %s %s", a.PlanName, a.PeriodStart.Format("2006-01-02"))
+			e, replayed, err := s.Ledger.Create(ctx, "dues", desc, a.Amount, &mid, "", a.IdempotencyKey)
+			if err != nil {
+				return res, err
+			}
+			if replayed {
+				continue
+			}
+			id := e.ID
+			a.EntryID = &id
+		}
+		res.Assessments = append(res.Assessments, a)
+		res.Total += a.Amount
+	}
+	return res, nil
+}
+
+// Start posts outstanding assessments every interval until ctx is done.
+func (s Scheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if res, err := s.Run(ctx, time.Now().UTC(), false); err != nil {
+				log.Println("dues scheduler:", err)
+			} else if len(res.Assessments) > 0 {
+				log.Printf("dues scheduler: posted %d assessments", len(res.Assessments))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,28 @@
+package fx
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Lookuper finds the rate in effect for a currency on a date.
+type Lookuper interface {
+	Lookup(ctx context.Context, currency string, on time.Time) (Rate, error)
+}
+
+// Convert converts amount in currency into base at the latest rate on or
+// before on, rounding to cents. Amounts already in base convert at 1.
+func Convert(ctx context.Context, rates Lookuper, base string, amount float64, currency string, on time.Time) (Conversion, error) {
+	c := Conversion{Amount: amount, Currency: currency, Base: base, BaseAmount: amount, Rate: 1, RateDate: on}
+	if currency == base {
+		return c, nil
+	}
+	rate, err := rates.Lookup(ctx, currency, on)
+	if err != nil {
+		return Conversion{}, err
+	}
+	c.Rate, c.RateDate = rate.Rate, rate.Date
+	c.BaseAmount = math.Round(amount*rate.Rate*100) / 100
+	return c, nil
+}
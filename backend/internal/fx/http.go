@@ -0,0 +1,168 @@
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxImportBytes caps the size of an uploaded rates file.
+const maxImportBytes = 5 << 20
+
+type Handlers struct {
+	Repo Repo
+	Base string
+}
+
+// List handles GET /api/fx/rates
+// Query: currency, from, to (YYYY-MM-DD)
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	cur := strings.ToUpper(r.URL.Query().Get("currency"))
+	if cur != "" && !ValidCurrency(cur) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return
+	}
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	items, err := h.Repo.List(r.Context(), cur, from, to)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Rate{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"base": h.Base, "rates": items})
+}
+
+// Set handles PUT /api/fx/rates/{currency}/{date} (admin)
+// Body: {"rate":0.7342}
+func (h Handlers) Set(w http.ResponseWriter, r *http.Request) {
+	cur, on, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Rate float64 `json:"rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.Rate <= 0 || math.IsInf(in.Rate, 0) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "rate must be positive")
+		return
+	}
+	out, err := h.Repo.Set(r.Context(), Rate{Currency: cur, Date: on, Rate: in.Rate, Source: "manual"})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// Delete handles DELETE /api/fx/rates/{currency}/{date} (admin)
+func (h Handlers) Delete(w http.ResponseWriter, r *http.Request) {
+	cur, on, ok := h.key(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.Delete(r.Context(), cur, on); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "delete failed")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Import handles POST /api/fx/rates/import (admin). The body is CSV with
+// date, currency and rate columns; existing rates for the same day are
+// replaced.
+func (h Handlers) Import(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusRequestEntityTooLarge, "file too large")
+		return
+	}
+	rates, err := ParseCSV(strings.NewReader(string(body)), h.Base)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := h.Repo.Import(r.Context(), rates)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "import failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"imported": n})
+}
+
+// Convert handles GET /api/fx/convert
+// Query: amount, currency, date (default today)
+func (h Handlers) Convert(w http.ResponseWriter, r *http.Request) {
+	amount, err := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid amount")
+		return
+	}
+	cur := strings.ToUpper(r.URL.Query().Get("currency"))
+	if !ValidCurrency(cur) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return
+	}
+	on, err := httpx.QueryDate(r, "date")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return
+	}
+	if on == nil {
+		t := time.Now().UTC()
+		on = &t
+	}
+	c, err := Convert(r.Context(), h.Repo, h.Base, amount, cur, *on)
+	if err != nil {
+		if errors.Is(err, ErrNoRate) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "no exchange rate for "+cur+" on or before "+on.Format(httpx.DateLayout))
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h Handlers) key(w http.ResponseWriter, r *http.Request) (string, time.Time, bool) {
+	cur := strings.ToUpper(chi.URLParam(r, "currency"))
+	if !ValidCurrency(cur) || cur == h.Base {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return "", time.Time{}, false
+	}
+	on, err := httpx.ParseDate(chi.URLParam(r, "date"))
+	if err != nil || on == nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return "", time.Time{}, false
+	}
+	return cur, *on, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,178 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	rates map[string]Rate
+}
+
+func rateKey(currency string, on time.Time) string {
+	return currency + "|" + on.Format("2006-01-02")
+}
+
+func (m *mockRepo) List(_ context.Context, currency string, from, to *time.Time) ([]Rate, error) {
+	var out []Rate
+	for _, r := range m.rates {
+		if (currency != "" && r.Currency != currency) || (from != nil && r.Date.Before(*from)) || (to != nil && r.Date.After(*to)) {
+			continue
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date.After(out[j].Date) })
+	return out, nil
+}
+
+func (m *mockRepo) Set(_ context.Context, r Rate) (Rate, error) {
+	if m.rates == nil {
+		m.rates = map[string]Rate{}
+	}
+	m.rates[rateKey(r.Currency, r.Date)] = r
+	return r, nil
+}
+
+func (m *mockRepo) Delete(_ context.Context, currency string, on time.Time) error {
+	if _, ok := m.rates[rateKey(currency, on)]; !ok {
+		return ErrNotFound
+	}
+	delete(m.rates, rateKey(currency, on))
+	return nil
+}
+
+func (m *mockRepo) Import(ctx context.Context, rates []Rate) (int, error) {
+	for _, r := range rates {
+		_, _ = m.Set(ctx, r)
+	}
+	return len(rates), nil
+}
+
+func (m *mockRepo) Lookup(_ context.Context, currency string, on time.Time) (Rate, error) {
+	var best *Rate
+	for _, r := range m.rates {
+		if r.Currency == currency && !r.Date.After(on) && (best == nil || r.Date.After(best.Date)) {
+			r := r
+			best = &r
+		}
+	}
+	if best == nil {
+		return Rate{}, ErrNoRate
+	}
+	return *best, nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo, role string) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Base: "USD"})
+	return r
+}
+
+func do(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", "1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestParseCSV(t *testing.T) {
+	rates, err := ParseCSV(strings.NewReader("\ufeffRate,Date,Currency,Note\n1.0812,2026-01-02,eur,ECB\n1.27,2026-01-02,GBP,\n"), "USD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rates) != 2 || rates[0].Currency != "EUR" || rates[0].Rate != 1.0812 || rates[0].Source != "csv" || rates[1].Date.Day() != 2 {
+		t.Fatalf("unexpected rates: %+v", rates)
+	}
+
+	for name, in := range map[string]string{
+		"missing column": "date,currency\n2026-01-02,EUR\n",
+		"base currency":  "date,currency,rate\n2026-01-02,USD,1\n",
+		"bad rate":       "date,currency,rate\n2026-01-02,EUR,-1\n",
+		"blank date":     "date,currency,rate\n,EUR,1.1\n",
+	} {
+		if _, err := ParseCSV(strings.NewReader(in), "USD"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := ParseCSV(strings.NewReader("date,currency,rate\n2026-01-02,EUR,1.1\n2026-13-01,EUR,1.1\n"), "USD"); err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("expected line number in error, got %v", err)
+	}
+}
+
+func TestHandlers_RatesAndConvert(t *testing.T) {
+	repo := &mockRepo{}
+	admin := setupRouter(repo, "admin")
+
+	if rr := do(admin, "PUT", "/fx/rates/eur/2026-01-01", `{"rate":1.10}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(admin, "PUT", "/fx/rates/USD/2026-01-01", `{"rate":1}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for base currency, got %d", rr.Code)
+	}
+	if rr := do(admin, "PUT", "/fx/rates/EUR/2026-01-01", `{"rate":0}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for zero rate, got %d", rr.Code)
+	}
+	rr := do(admin, "POST", "/fx/rates/import", "date,currency,rate\n2026-02-01,EUR,1.20\n2026-02-01,GBP,1.30\n")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"imported":2`) {
+		t.Fatalf("unexpected import: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(admin, "POST", "/fx/rates/import", "date,currency\n"); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for bad file, got %d", rr.Code)
+	}
+
+	member := setupRouter(repo, "member")
+	if rr := do(member, "PUT", "/fx/rates/EUR/2026-03-01", `{"rate":1.2}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member, got %d", rr.Code)
+	}
+	rr = do(member, "GET", "/fx/rates?currency=EUR", "")
+	var list struct {
+		Base  string
+		Rates []Rate
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if list.Base != "USD" || len(list.Rates) != 2 || list.Rates[0].Rate != 1.20 {
+		t.Fatalf("unexpected list: %s", rr.Body.String())
+	}
+
+	// The January rate applies until the February rate takes over.
+	rr = do(member, "GET", "/fx/convert?amount=100&currency=EUR&date=2026-01-15", "")
+	var c Conversion
+	_ = json.Unmarshal(rr.Body.Bytes(), &c)
+	if rr.Code != http.StatusOK || c.BaseAmount != 110 || c.Rate != 1.10 || c.RateDate.Month() != time.January {
+		t.Fatalf("unexpected conversion: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(member, "GET", "/fx/convert?amount=100&currency=USD", "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &c)
+	if c.BaseAmount != 100 || c.Rate != 1 {
+		t.Fatalf("expected base currency to convert at 1: %s", rr.Body.String())
+	}
+	if rr := do(member, "GET", "/fx/convert?amount=100&currency=EUR&date=2025-12-31", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before the first rate, got %d", rr.Code)
+	}
+
+	if rr := do(admin, "DELETE", "/fx/rates/EUR/2026-01-01", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+	if rr := do(admin, "DELETE", "/fx/rates/EUR/2026-01-01", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,13 @@
+-- backend/internal/fx/migrations/0001_init.sql
+-- Exchange rates into a base currency: one unit of currency is worth rate
+-- units of base on rate_date. Lookups use the latest rate on or before a date.
+CREATE TABLE IF NOT EXISTS exchange_rates (
+  base TEXT NOT NULL CHECK (base ~ '^[A-Z]{3}$'),
+  currency TEXT NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+  rate_date DATE NOT NULL,
+  rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+  source TEXT NOT NULL DEFAULT 'manual' CHECK (source IN ('manual','csv')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (base, currency, rate_date),
+  CHECK (currency <> base)
+);
@@ -0,0 +1,33 @@
+package fx
+
+import (
+	"regexp"
+	"time"
+)
+
+// Rate is the value of one unit of Currency in the base currency on Date.
+type Rate struct {
+	Currency  string    `json:"currency"`
+	Date      time.Time `json:"date"`
+	Rate      float64   `json:"rate"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversion is an amount converted into the base currency with the rate
+// that was applied.
+type Conversion struct {
+	Amount     float64   `json:"amount"`
+	Currency   string    `json:"currency"`
+	Base       string    `json:"base"`
+	BaseAmount float64   `json:"base_amount"`
+	Rate       float64   `json:"rate"`
+	RateDate   time.Time `json:"rate_date"`
+}
+
+var currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ValidCurrency reports whether c looks like an ISO 4217 code.
+func ValidCurrency(c string) bool {
+	return currencyRe.MatchString(c)
+}
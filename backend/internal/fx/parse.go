@@ -0,0 +1,65 @@
+package fx
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"coop.tools/backend/internal/httpx"
+)
+
+// ParseCSV reads rates from CSV with a header row naming the date,
+// currency and rate columns in any order. Other columns are ignored. The
+// whole file is rejected on the first invalid row.
+func ParseCSV(r io.Reader, base string) ([]Rate, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	for _, name := range []string{"date", "currency", "rate"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+	var out []Rate
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i := col[name]; i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		d, err := httpx.ParseDate(field("date"))
+		if err != nil || d == nil {
+			return nil, fmt.Errorf("line %d: invalid date", line)
+		}
+		cur := strings.ToUpper(field("currency"))
+		if !ValidCurrency(cur) || cur == base {
+			return nil, fmt.Errorf("line %d: invalid currency", line)
+		}
+		rate, err := strconv.ParseFloat(field("rate"), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("line %d: invalid rate", line)
+		}
+		out = append(out, Rate{Currency: cur, Date: *d, Rate: rate, Source: "csv"})
+	}
+}
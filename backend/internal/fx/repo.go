@@ -0,0 +1,121 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound = errors.New("exchange rate not found")
+	// ErrNoRate is returned by Lookup when no rate is on file on or before
+	// the requested date.
+	ErrNoRate = errors.New("no exchange rate")
+)
+
+type Repo interface {
+	// List returns rates for the base currency, newest first. Empty currency
+	// and nil dates are unfiltered.
+	List(ctx context.Context, currency string, from, to *time.Time) ([]Rate, error)
+	// Set creates or replaces the rate for r.Currency on r.Date.
+	Set(ctx context.Context, r Rate) (Rate, error)
+	Delete(ctx context.Context, currency string, on time.Time) error
+	// Import upserts rates in one transaction and returns how many were
+	// written.
+	Import(ctx context.Context, rates []Rate) (int, error)
+	// Lookup returns the latest rate for currency on or before on.
+	Lookup(ctx context.Context, currency string, on time.Time) (Rate, error)
+}
+
+// PgRepo stores rates against Base; rates entered for another base
+// currency are not visible.
+type PgRepo struct {
+	Pool *pgxpool.Pool
+	Base string
+}
+
+func NewPgRepo(pool *pgxpool.Pool, base string) *PgRepo {
+	return &PgRepo{Pool: pool, Base: base}
+}
+
+const columns = `currency, rate_date, rate::float8, source, created_at`
+
+const upsert = `
+INSERT INTO exchange_rates (base, currency, rate_date, rate, source)
+VALUES ($1,$2,$3,$4,$5)
+ON CONFLICT (base, currency, rate_date) DO UPDATE SET rate=EXCLUDED.rate, source=EXCLUDED.source, created_at=now()
+RETURNING ` + columns
+
+func (r *PgRepo) List(ctx context.Context, currency string, from, to *time.Time) ([]Rate, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+columns+` FROM exchange_rates
+WHERE base=$1 AND ($2 = '' OR currency=$2)
+  AND ($3::date IS NULL OR rate_date >= $3)
+  AND ($4::date IS NULL OR rate_date <= $4)
+ORDER BY rate_date DESC, currency`, r.Base, currency, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Rate
+	for rows.Next() {
+		rate, err := scanRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rate)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Set(ctx context.Context, rate Rate) (Rate, error) {
+	return scanRate(r.Pool.QueryRow(ctx, upsert, r.Base, rate.Currency, rate.Date, rate.Rate, rate.Source))
+}
+
+func (r *PgRepo) Delete(ctx context.Context, currency string, on time.Time) error {
+	tag, err := r.Pool.Exec(ctx, `DELETE FROM exchange_rates WHERE base=$1 AND currency=$2 AND rate_date=$3`, r.Base, currency, on)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgRepo) Import(ctx context.Context, rates []Rate) (int, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+	for _, rate := range rates {
+		if _, err := tx.Exec(ctx, upsert, r.Base, rate.Currency, rate.Date, rate.Rate, rate.Source); err != nil {
+			return 0, err
+		}
+	}
+	return len(rates), tx.Commit(ctx)
+}
+
+func (r *PgRepo) Lookup(ctx context.Context, currency string, on time.Time) (Rate, error) {
+	rate, err := scanRate(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM exchange_rates
+WHERE base=$1 AND currency=$2 AND rate_date <= $3
+ORDER BY rate_date DESC LIMIT 1`, r.Base, currency, on))
+	if err == pgx.ErrNoRows {
+		return Rate{}, ErrNoRate
+	}
+	return rate, err
+}
+
+func scanRate(row pgx.Row) (Rate, error) {
+	var rate Rate
+	var d pgtype.Date
+	if err := row.Scan(&rate.Currency, &d, &rate.Rate, &rate.Source, &rate.CreatedAt); err != nil {
+		return Rate{}, err
+	}
+	rate.Date = d.Time
+	return rate, nil
+}
@@ -0,0 +1,18 @@
+package fx
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	admin := httpmw.RequirePermission("fx.manage")
+	route := func(r chi.Router) {
+		r.Get("/rates", h.List)
+		r.With(admin).Post("/rates/import", h.Import)
+		r.With(admin).Put("/rates/{currency}/{date}", h.Set)
+		r.With(admin).Delete("/rates/{currency}/{date}", h.Delete)
+		r.Get("/convert", h.Convert)
+	}
+	r.Route("/fx", route)
+}
@@ -0,0 +1,744 @@
+package hours
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxImportBytes caps the size of an imported timesheet file.
+const maxImportBytes = 5 << 20
+
+type Handlers struct {
+	Repo Repo
+	// Currency labels labor cost reports.
+	Currency string
+}
+
+// isAdmin reports whether p may manage other members' hours.
+func isAdmin(p httpmw.Principal) bool {
+	return p.Can("hours.manage")
+}
+
+// ListCategories handles GET /api/hours/categories.
+// Query: all=true includes inactive categories
+func (h Handlers) ListCategories(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListCategories(r.Context(), httpx.QueryBoolTrue(r, "all"))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Category{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type categoryInput struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Patronage *bool  `json:"patronage"`
+	Active    *bool  `json:"active"`
+}
+
+// CreateCategory handles POST /api/hours/categories (admin).
+// Body: {"name":"Bakery","kind":"project","patronage":true}
+func (h Handlers) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCategory(w, r)
+	if !ok {
+		return
+	}
+	out, err := h.Repo.CreateCategory(r.Context(), c)
+	writeCategory(w, http.StatusCreated, out, err)
+}
+
+// UpdateCategory handles PUT /api/hours/categories/{id} (admin). Categories
+// with hours are retired with "active":false rather than deleted.
+func (h Handlers) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	c, ok := readCategory(w, r)
+	if !ok {
+		return
+	}
+	c.ID = int32(id)
+	out, err := h.Repo.UpdateCategory(r.Context(), c)
+	writeCategory(w, http.StatusOK, out, err)
+}
+
+func readCategory(w http.ResponseWriter, r *http.Request) (Category, bool) {
+	var in categoryInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return Category{}, false
+	}
+	c := Category{Name: strings.TrimSpace(in.Name), Kind: in.Kind, Patronage: true, Active: true}
+	if c.Kind == "" {
+		c.Kind = KindCategory
+	}
+	if c.Name == "" || (c.Kind != KindCategory && c.Kind != KindProject) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name and a kind of 'category' or 'project' required")
+		return Category{}, false
+	}
+	if in.Patronage != nil {
+		c.Patronage = *in.Patronage
+	}
+	if in.Active != nil {
+		c.Active = *in.Active
+	}
+	return c, true
+}
+
+func writeCategory(w http.ResponseWriter, status int, c Category, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, status, c)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrDuplicate):
+		httpmw.WriteJSONError(w, http.StatusConflict, "category name already in use")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "save failed")
+	}
+}
+
+// ListEntries handles GET /api/hours/entries. Members only see their own
+// entries; admins see all and may filter by member_id.
+// Query: member_id, category_id, status (open|submitted|approved), from, to, limit, offset
+func (h Handlers) ListEntries(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	f := EntryFilters{Status: r.URL.Query().Get("status")}
+	if f.Status != "" && f.Status != StatusOpen && f.Status != StatusSubmitted && f.Status != StatusApproved {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	mid, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	cid, err := httpx.QueryInt64(r, "category_id")
+	if err != nil || (cid != nil && (*cid <= 0 || *cid > math.MaxInt32)) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid category_id")
+		return
+	}
+	if cid != nil {
+		c := int32(*cid)
+		f.CategoryID = &c
+	}
+	if f.From, err = httpx.QueryDate(r, "from"); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	if f.To, err = httpx.QueryDate(r, "to"); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+	f.MemberID = mid
+	if !isAdmin(p) {
+		f.MemberID = &p.MemberID
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 500)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.ListEntries(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Entry{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type entryInput struct {
+	MemberID   *int64  `json:"member_id"`
+	CategoryID int32   `json:"category_id"`
+	WorkDate   string  `json:"work_date"`
+	Hours      float64 `json:"hours"`
+	Notes      string  `json:"notes"`
+}
+
+// CreateEntry handles POST /api/hours/entries. Members log their own
+// hours; admins may log them for member_id.
+// Body: {"category_id":2,"work_date":"2025-05-06","hours":7.5,"notes":"Morning shift"}
+func (h Handlers) CreateEntry(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	var in entryInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	e, ok := h.readEntry(w, r, in)
+	if !ok {
+		return
+	}
+	e.MemberID, e.Source, e.CreatedBy = p.MemberID, "manual", &p.MemberID
+	if in.MemberID != nil && *in.MemberID != p.MemberID {
+		if !isAdmin(p) {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "only admins log hours for other members")
+			return
+		}
+		exists, err := h.Repo.MemberExists(r.Context(), *in.MemberID)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+			return
+		}
+		if !exists {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "member not found")
+			return
+		}
+		e.MemberID = *in.MemberID
+	}
+	out, err := h.Repo.CreateEntries(r.Context(), []Entry{e})
+	if err != nil {
+		writeEntryErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, out[0])
+}
+
+// UpdateEntry handles PUT /api/hours/entries/{id} for the entry's member or
+// an admin. Only open entries change; the member is kept.
+func (h Handlers) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	cur, ok := h.ownEntry(w, r)
+	if !ok {
+		return
+	}
+	var in entryInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	e, ok := h.readEntry(w, r, in)
+	if !ok {
+		return
+	}
+	e.ID = cur.ID
+	out, err := h.Repo.UpdateEntry(r.Context(), e)
+	if err != nil {
+		writeEntryErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// DeleteEntry handles DELETE /api/hours/entries/{id} for the entry's member
+// or an admin. Only open entries are deleted.
+func (h Handlers) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	cur, ok := h.ownEntry(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Repo.DeleteEntry(r.Context(), cur.ID); err != nil {
+		writeEntryErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Import handles POST /api/hours/entries/import. The CSV is the request
+// body, or the "file" field of a multipart form. Rows without a member
+// column are the caller's; rows for other members (by member_id or email)
+// need an admin. Categories are matched by name among active categories.
+// The whole file is rejected on the first invalid row.
+// Query: date_format=mdy|dmy (default mdy)
+func (h Handlers) Import(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	dateFormat := r.URL.Query().Get("date_format")
+	if dateFormat != "" && dateFormat != "mdy" && dateFormat != "dmy" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "date_format must be 'mdy' or 'dmy'")
+		return
+	}
+	data, err := readUpload(w, r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httpmw.WriteJSONError(w, http.StatusRequestEntityTooLarge, "file too large")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "csv file required")
+		return
+	}
+	rows, err := ParseCSV(strings.NewReader(string(data)), dateFormat == "dmy")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cats, err := h.Repo.ListCategories(r.Context(), false)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return
+	}
+	byName := map[string]int32{}
+	for _, c := range cats {
+		byName[strings.ToLower(c.Name)] = c.ID
+	}
+	byEmail := map[string]int64{}
+	today := time.Now().UTC()
+	entries := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		fail := func(msg string, args ...any) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, fmt.Sprintf("line %d: ", row.Line)+fmt.Sprintf(msg, args...))
+		}
+		cid, ok := byName[strings.ToLower(row.Category)]
+		if !ok {
+			fail("unknown category %q", row.Category)
+			return
+		}
+		if row.WorkDate.After(today) {
+			fail("date is in the future")
+			return
+		}
+		mid := p.MemberID
+		switch {
+		case row.MemberID != nil:
+			mid = *row.MemberID
+			if mid != p.MemberID {
+				exists, err := h.Repo.MemberExists(r.Context(), mid)
+				if err != nil {
+					httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+					return
+				}
+				if !exists {
+					fail("member %d not found", mid)
+					return
+				}
+			}
+		case row.Email != "":
+			key := strings.ToLower(row.Email)
+			id, seen := byEmail[key]
+			if !seen {
+				found, err := h.Repo.MemberByEmail(r.Context(), row.Email)
+				if err != nil {
+					httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+					return
+				}
+				if found == nil {
+					fail("no member with email %q", row.Email)
+					return
+				}
+				id = *found
+				byEmail[key] = id
+			}
+			mid = id
+		}
+		if mid != p.MemberID && !isAdmin(p) {
+			fail("hours for other members need an admin")
+			return
+		}
+		entries = append(entries, Entry{MemberID: mid, CategoryID: cid, WorkDate: row.WorkDate, Hours: row.Hours,
+			Notes: row.Notes, Source: "csv", CreatedBy: &p.MemberID})
+	}
+	out, err := h.Repo.CreateEntries(r.Context(), entries)
+	if err != nil {
+		writeEntryErr(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]int{"imported": len(out)})
+}
+
+// ListTimesheets handles GET /api/hours/timesheets. Members only see their
+// own; admins and treasurers see all and may filter by member_id.
+// Query: status, member_id, limit, offset
+func (h Handlers) ListTimesheets(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	f := TimesheetFilters{Status: r.URL.Query().Get("status")}
+	if f.Status != "" && !ValidTimesheetStatus(f.Status) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	mid, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	f.MemberID = mid
+	if !isAdmin(p) && !p.Can("hours.reports") {
+		f.MemberID = &p.MemberID
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 200)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.ListTimesheets(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Timesheet{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Submit handles POST /api/hours/timesheets, putting the caller's open
+// entries in the period on a timesheet for approval. Admins may submit for
+// member_id.
+// Body: {"period_start":"2025-05-05","period_end":"2025-05-11"}
+func (h Handlers) Submit(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	var in struct {
+		MemberID    *int64 `json:"member_id"`
+		PeriodStart string `json:"period_start"`
+		PeriodEnd   string `json:"period_end"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	start, err1 := httpx.ParseDate(in.PeriodStart)
+	end, err2 := httpx.ParseDate(in.PeriodEnd)
+	if err1 != nil || err2 != nil || start == nil || end == nil || end.Before(*start) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "valid period_start and period_end required")
+		return
+	}
+	mid := p.MemberID
+	if in.MemberID != nil && *in.MemberID != p.MemberID {
+		if !isAdmin(p) {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "only admins submit for other members")
+			return
+		}
+		mid = *in.MemberID
+	}
+	out, err := h.Repo.Submit(r.Context(), mid, *start, *end)
+	if err != nil {
+		if errors.Is(err, ErrNoEntries) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "no open entries in period")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "submit failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// GetTimesheet handles GET /api/hours/timesheets/{id} for its member, an
+// admin or a treasurer.
+func (h Handlers) GetTimesheet(w http.ResponseWriter, r *http.Request) {
+	t, ok := h.timesheet(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if t.MemberID != p.MemberID && !isAdmin(p) && !p.Can("hours.reports") {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// Approve handles POST /api/hours/timesheets/{id}/approve (admin).
+// Body (optional): {"note":"..."}
+func (h Handlers) Approve(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, StatusApproved)
+}
+
+// Reject handles POST /api/hours/timesheets/{id}/reject (admin), releasing
+// the entries for correction and resubmission.
+// Body (optional): {"note":"Missing Friday"}
+func (h Handlers) Reject(w http.ResponseWriter, r *http.Request) {
+	h.review(w, r, StatusRejected)
+}
+
+// review decides a submitted timesheet. Admins may not decide their own.
+func (h Handlers) review(w http.ResponseWriter, r *http.Request, status string) {
+	t, ok := h.timesheet(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if t.MemberID == p.MemberID {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "cannot decide your own timesheet")
+		return
+	}
+	out, err := h.Repo.Review(r.Context(), t.ID, status, p.MemberID, strings.TrimSpace(in.Note))
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, out)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "timesheet not submitted")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "review failed")
+	}
+}
+
+// ListRates handles GET /api/hours/rates (admin, treasurer).
+// Query: member_id
+func (h Handlers) ListRates(w http.ResponseWriter, r *http.Request) {
+	mid, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	items, err := h.Repo.ListRates(r.Context(), mid)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Rate{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// SetRate handles PUT /api/hours/rates/{member_id} (admin), setting the
+// member's hourly labor cost from effective_from (default today).
+// Body: {"hourly_rate":24.50,"effective_from":"2025-01-01"}
+func (h Handlers) SetRate(w http.ResponseWriter, r *http.Request) {
+	mid, err := strconv.ParseInt(chi.URLParam(r, "memberID"), 10, 64)
+	if err != nil || mid <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member id")
+		return
+	}
+	var in struct {
+		HourlyRate    *float64 `json:"hourly_rate"`
+		EffectiveFrom string   `json:"effective_from"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.HourlyRate == nil || *in.HourlyRate < 0 || math.IsInf(*in.HourlyRate, 0) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "hourly_rate must be zero or more")
+		return
+	}
+	from, err := httpx.ParseDate(in.EffectiveFrom)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid effective_from")
+		return
+	}
+	if from == nil {
+		t, _ := time.Parse(httpx.DateLayout, time.Now().UTC().Format(httpx.DateLayout))
+		from = &t
+	}
+	exists, err := h.Repo.MemberExists(r.Context(), mid)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return
+	}
+	if !exists {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "member not found")
+		return
+	}
+	out, err := h.Repo.SetRate(r.Context(), Rate{MemberID: mid, EffectiveFrom: *from, HourlyRate: round2(*in.HourlyRate)})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "save failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// Labor handles GET /api/hours/reports/labor (admin, treasurer): approved
+// hours and their cost in a period.
+// Query: from, to (default the current month), group_by=member|category (default member)
+func (h Handlers) Labor(w http.ResponseWriter, r *http.Request) {
+	rep, ok := h.labor(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// LaborCSV handles GET /api/hours/reports/labor.csv with the same query.
+func (h Handlers) LaborCSV(w http.ResponseWriter, r *http.Request) {
+	rep, ok := h.labor(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=labor-"+rep.From.Format(httpx.DateLayout)+"-"+rep.To.Format(httpx.DateLayout)+".csv")
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+	_ = cw.Write([]string{rep.GroupBy + "_id", "name", "hours", "cost", "unrated_hours"})
+	for _, row := range append(rep.Rows, rep.Totals) {
+		id := ""
+		if row.MemberID != nil {
+			id = strconv.FormatInt(*row.MemberID, 10)
+		} else if row.CategoryID != nil {
+			id = strconv.Itoa(int(*row.CategoryID))
+		}
+		_ = cw.Write([]string{id, row.Name, strconv.FormatFloat(row.Hours, 'f', 2, 64),
+			strconv.FormatFloat(row.Cost, 'f', 2, 64), strconv.FormatFloat(row.UnratedHours, 'f', 2, 64)})
+	}
+}
+
+func (h Handlers) labor(w http.ResponseWriter, r *http.Request) (LaborReport, bool) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "member"
+	}
+	if groupBy != "member" && groupBy != "category" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "group_by must be 'member' or 'category'")
+		return LaborReport{}, false
+	}
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid from or to")
+		return LaborReport{}, false
+	}
+	now := time.Now().UTC()
+	if from == nil {
+		t := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		from = &t
+	}
+	if to == nil {
+		t := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+		to = &t
+	}
+	if to.Before(*from) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "to must not precede from")
+		return LaborReport{}, false
+	}
+	rows, err := h.Repo.Labor(r.Context(), *from, *to, groupBy)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return LaborReport{}, false
+	}
+	rep := BuildLaborReport(*from, *to, groupBy, rows)
+	rep.Currency = h.Currency
+	return rep, true
+}
+
+// readEntry validates the editable fields of an entry.
+func (h Handlers) readEntry(w http.ResponseWriter, r *http.Request, in entryInput) (Entry, bool) {
+	d, err := httpx.ParseDate(in.WorkDate)
+	if err != nil || d == nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "valid work_date required")
+		return Entry{}, false
+	}
+	if d.After(time.Now().UTC()) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "work_date must not be in the future")
+		return Entry{}, false
+	}
+	hrs := round2(in.Hours)
+	if hrs <= 0 || hrs > MaxDailyHours {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, fmt.Sprintf("hours must be between 0 and %d", MaxDailyHours))
+		return Entry{}, false
+	}
+	c, err := h.Repo.GetCategory(r.Context(), in.CategoryID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "category not found")
+			return Entry{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return Entry{}, false
+	}
+	if !c.Active {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "category is inactive")
+		return Entry{}, false
+	}
+	return Entry{CategoryID: c.ID, WorkDate: *d, Hours: hrs, Notes: strings.TrimSpace(in.Notes)}, true
+}
+
+// ownEntry loads the entry named by {id} when the caller is its member or
+// an admin.
+func (h Handlers) ownEntry(w http.ResponseWriter, r *http.Request) (Entry, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Entry{}, false
+	}
+	e, err := h.Repo.GetEntry(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Entry{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return Entry{}, false
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if e.MemberID != p.MemberID && !isAdmin(p) {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return Entry{}, false
+	}
+	return e, true
+}
+
+func (h Handlers) timesheet(w http.ResponseWriter, r *http.Request) (Timesheet, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Timesheet{}, false
+	}
+	t, err := h.Repo.GetTimesheet(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Timesheet{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return Timesheet{}, false
+	}
+	return t, true
+}
+
+func writeEntryErr(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "entry is on a submitted or approved timesheet")
+	case errors.Is(err, ErrNoCategory):
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "category not found")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "save failed")
+	}
+}
+
+func readUpload(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	data, err := io.ReadAll(r.Body)
+	if err == nil && len(data) == 0 {
+		err = errors.New("empty body")
+	}
+	return data, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,487 @@
+package hours
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	categories []Category
+	entries    []Entry
+	timesheets []Timesheet
+	rates      []Rate
+	members    map[int64]string // id -> email
+}
+
+func (m *mockRepo) ListCategories(_ context.Context, includeInactive bool) ([]Category, error) {
+	var out []Category
+	for _, c := range m.categories {
+		if c.Active || includeInactive {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetCategory(_ context.Context, id int32) (Category, error) {
+	for _, c := range m.categories {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return Category{}, ErrNotFound
+}
+
+func (m *mockRepo) CreateCategory(_ context.Context, c Category) (Category, error) {
+	for _, other := range m.categories {
+		if strings.EqualFold(other.Name, c.Name) {
+			return Category{}, ErrDuplicate
+		}
+	}
+	c.ID = int32(len(m.categories) + 1)
+	m.categories = append(m.categories, c)
+	return c, nil
+}
+
+func (m *mockRepo) UpdateCategory(_ context.Context, c Category) (Category, error) {
+	for i := range m.categories {
+		if m.categories[i].ID == c.ID {
+			m.categories[i] = c
+			return c, nil
+		}
+	}
+	return Category{}, ErrNotFound
+}
+
+// status fills in the entry's timesheet status as the SQL join does.
+func (m *mockRepo) status(e Entry) Entry {
+	e.Status = StatusOpen
+	if e.TimesheetID != nil {
+		e.Status = m.timesheets[*e.TimesheetID-1].Status
+	}
+	c, _ := m.GetCategory(context.Background(), e.CategoryID)
+	e.Category = c.Name
+	return e
+}
+
+func (m *mockRepo) ListEntries(_ context.Context, f EntryFilters) ([]Entry, error) {
+	var out []Entry
+	for _, e := range m.entries {
+		e = m.status(e)
+		if (f.MemberID != nil && e.MemberID != *f.MemberID) || (f.Status != "" && e.Status != f.Status) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetEntry(_ context.Context, id int64) (Entry, error) {
+	for _, e := range m.entries {
+		if e.ID == id {
+			return m.status(e), nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+func (m *mockRepo) CreateEntries(_ context.Context, entries []Entry) ([]Entry, error) {
+	var out []Entry
+	for _, e := range entries {
+		e.ID = int64(len(m.entries) + 1)
+		m.entries = append(m.entries, e)
+		out = append(out, m.status(e))
+	}
+	return out, nil
+}
+
+func (m *mockRepo) UpdateEntry(ctx context.Context, e Entry) (Entry, error) {
+	for i := range m.entries {
+		if m.entries[i].ID == e.ID {
+			if m.entries[i].TimesheetID != nil {
+				return Entry{}, ErrConflict
+			}
+			cur := &m.entries[i]
+			cur.CategoryID, cur.WorkDate, cur.Hours, cur.Notes = e.CategoryID, e.WorkDate, e.Hours, e.Notes
+			return m.status(*cur), nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+func (m *mockRepo) DeleteEntry(_ context.Context, id int64) error {
+	for i := range m.entries {
+		if m.entries[i].ID == id {
+			if m.entries[i].TimesheetID != nil {
+				return ErrConflict
+			}
+			m.entries = append(m.entries[:i], m.entries[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepo) Submit(ctx context.Context, memberID int64, from, to time.Time) (Timesheet, error) {
+	id := int32(len(m.timesheets) + 1)
+	total := 0.0
+	for i := range m.entries {
+		e := &m.entries[i]
+		if e.MemberID == memberID && e.TimesheetID == nil && !e.WorkDate.Before(from) && !e.WorkDate.After(to) {
+			e.TimesheetID = &id
+			total += e.Hours
+		}
+	}
+	if total == 0 {
+		return Timesheet{}, ErrNoEntries
+	}
+	m.timesheets = append(m.timesheets, Timesheet{ID: id, MemberID: memberID, PeriodStart: from, PeriodEnd: to, Status: StatusSubmitted, TotalHours: total})
+	return m.GetTimesheet(ctx, id)
+}
+
+func (m *mockRepo) ListTimesheets(_ context.Context, f TimesheetFilters) ([]Timesheet, error) {
+	var out []Timesheet
+	for _, t := range m.timesheets {
+		if (f.MemberID == nil || t.MemberID == *f.MemberID) && (f.Status == "" || t.Status == f.Status) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetTimesheet(_ context.Context, id int32) (Timesheet, error) {
+	if id < 1 || int(id) > len(m.timesheets) {
+		return Timesheet{}, ErrNotFound
+	}
+	t := m.timesheets[id-1]
+	for _, e := range m.entries {
+		if e.TimesheetID != nil && *e.TimesheetID == id {
+			t.Entries = append(t.Entries, m.status(e))
+		}
+	}
+	return t, nil
+}
+
+func (m *mockRepo) Review(ctx context.Context, id int32, status string, reviewer int64, note string) (Timesheet, error) {
+	if id < 1 || int(id) > len(m.timesheets) {
+		return Timesheet{}, ErrNotFound
+	}
+	t := &m.timesheets[id-1]
+	if t.Status != StatusSubmitted {
+		return Timesheet{}, ErrConflict
+	}
+	t.Status, t.ReviewedBy, t.ReviewNote = status, &reviewer, note
+	if status == StatusRejected {
+		for i := range m.entries {
+			if m.entries[i].TimesheetID != nil && *m.entries[i].TimesheetID == id {
+				m.entries[i].TimesheetID = nil
+			}
+		}
+	}
+	return m.GetTimesheet(ctx, id)
+}
+
+func (m *mockRepo) ListRates(_ context.Context, memberID *int64) ([]Rate, error) {
+	return m.rates, nil
+}
+
+func (m *mockRepo) SetRate(_ context.Context, r Rate) (Rate, error) {
+	m.rates = append(m.rates, r)
+	return r, nil
+}
+
+func (m *mockRepo) Labor(_ context.Context, from, to time.Time, groupBy string) ([]LaborRow, error) {
+	byMember := map[int64]*LaborRow{}
+	for _, e := range m.entries {
+		e = m.status(e)
+		if e.Status != StatusApproved || e.WorkDate.Before(from) || e.WorkDate.After(to) {
+			continue
+		}
+		row, ok := byMember[e.MemberID]
+		if !ok {
+			id := e.MemberID
+			row = &LaborRow{MemberID: &id, Name: m.members[id]}
+			byMember[id] = row
+		}
+		row.Hours += e.Hours
+		rate, rated := 0.0, false
+		for _, r := range m.rates {
+			if r.MemberID == e.MemberID && !r.EffectiveFrom.After(e.WorkDate) {
+				rate, rated = r.HourlyRate, true
+			}
+		}
+		if rated {
+			row.Cost += round2(e.Hours * rate)
+		} else {
+			row.UnratedHours += e.Hours
+		}
+	}
+	var out []LaborRow
+	for _, row := range byMember {
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Cost > out[j].Cost })
+	return out, nil
+}
+
+func (m *mockRepo) MemberExists(_ context.Context, id int64) (bool, error) {
+	_, ok := m.members[id]
+	return ok, nil
+}
+
+func (m *mockRepo) MemberByEmail(_ context.Context, email string) (*int64, error) {
+	for id, e := range m.members {
+		if strings.EqualFold(e, email) {
+			return &id, nil
+		}
+	}
+	return nil, nil
+}
+
+// ---- Helper functions ----
+
+// Member 1 is an admin, 2 a treasurer, 3 and 4 plain members.
+func setupRouter(h Handlers) *chi.Mux {
+	roles := map[int64]string{1: "admin", 2: "treasurer", 3: "member", 4: "member"}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		return httpmw.Principal{MemberID: id, Role: role}, ok, nil
+	}))
+	Mount(r, h)
+	return r
+}
+
+func newRepo() *mockRepo {
+	return &mockRepo{
+		categories: []Category{
+			{ID: 1, Name: "Bakery", Kind: KindProject, Patronage: true, Active: true},
+			{ID: 2, Name: "Admin", Kind: KindCategory, Patronage: true, Active: true},
+			{ID: 3, Name: "Retired", Kind: KindCategory, Active: false},
+		},
+		members: map[int64]string{1: "root@example.org", 2: "cash@example.org", 3: "ada@example.org", 4: "ben@example.org"},
+	}
+}
+
+func do(r http.Handler, user, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", user)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestParseCSV(t *testing.T) {
+	rows, err := ParseCSV(strings.NewReader("\ufeffdate,category,hours,notes\n2025-05-05,Bakery,7.5,Ovens\n2025-05-06,Admin,0,\n"), false)
+	if err != nil || len(rows) != 1 || rows[0].Hours != 7.5 || rows[0].Category != "Bakery" || rows[0].Notes != "Ovens" || rows[0].Line != 2 {
+		t.Fatalf("unexpected plain rows: %v %+v", err, rows)
+	}
+
+	// Toggl Track detailed export: clock durations, project and email.
+	toggl := "User,Email,Client,Project,Task,Description,Billable,Start date,Start time,End date,End time,Duration,Tags,Amount ()\n" +
+		"Ada,ada@example.org,,Bakery,,Dough prep,No,2025-05-05,08:00:00,2025-05-05,11:45:00,03:45:00,,\n"
+	rows, err = ParseCSV(strings.NewReader(toggl), false)
+	if err != nil || len(rows) != 1 || rows[0].Hours != 3.75 || rows[0].Email != "ada@example.org" || rows[0].Notes != "Dough prep" {
+		t.Fatalf("unexpected toggl rows: %v %+v", err, rows)
+	}
+
+	// Clockify detailed export: US dates and a decimal duration column.
+	clockify := "Project,Client,Description,Task,User,Group,Email,Tags,Billable,Start Date,Start Time,End Date,End Time,Duration (h),Duration (decimal)\n" +
+		"Admin,,Payroll,,Ben,,ben@example.org,,No,05/07/2025,09:00:00,05/07/2025,10:20:00,01:20:00,1.33\n"
+	rows, err = ParseCSV(strings.NewReader(clockify), false)
+	if err != nil || len(rows) != 1 || rows[0].Hours != 1.33 || rows[0].WorkDate.Format("2006-01-02") != "2025-05-07" {
+		t.Fatalf("unexpected clockify rows: %v %+v", err, rows)
+	}
+
+	for name, in := range map[string]string{
+		"no hours column": "date,category\n2025-05-05,Bakery\n",
+		"bad duration":    "date,category,hours\n2025-05-05,Bakery,7:75\n",
+		"too many hours":  "date,category,hours\n2025-05-05,Bakery,25\n",
+		"bad member":      "date,category,hours,member_id\n2025-05-05,Bakery,1,x\n",
+		"no category":     "date,category,hours\n2025-05-05,,1\n",
+	} {
+		if _, err := ParseCSV(strings.NewReader(in), false); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestHandlers_TimesheetLifecycle(t *testing.T) {
+	repo := newRepo()
+	r := setupRouter(Handlers{Repo: repo})
+
+	if rr := do(r, "3", "POST", "/hours/categories", `{"name":"Deliveries"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "POST", "/hours/categories", `{"name":"bakery","kind":"project"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate name, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "POST", "/hours/categories", `{"name":"Deliveries","kind":"shift"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for kind, got %d", rr.Code)
+	}
+	if rr := do(r, "3", "GET", "/hours/categories", ""); rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "Retired") {
+		t.Fatalf("expected active categories, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	for name, body := range map[string]string{
+		"future":   `{"category_id":1,"work_date":"2999-01-01","hours":1}`,
+		"zero":     `{"category_id":1,"work_date":"2025-05-05","hours":0}`,
+		"too long": `{"category_id":1,"work_date":"2025-05-05","hours":24.5}`,
+		"category": `{"category_id":9,"work_date":"2025-05-05","hours":1}`,
+		"inactive": `{"category_id":3,"work_date":"2025-05-05","hours":1}`,
+	} {
+		if rr := do(r, "3", "POST", "/hours/entries", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, rr.Code)
+		}
+	}
+	if rr := do(r, "3", "POST", "/hours/entries", `{"member_id":4,"category_id":1,"work_date":"2025-05-05","hours":1}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 logging for another member, got %d", rr.Code)
+	}
+	rr := do(r, "3", "POST", "/hours/entries", `{"category_id":1,"work_date":"2025-05-05","hours":7.5,"notes":"Ovens"}`)
+	var e Entry
+	_ = json.Unmarshal(rr.Body.Bytes(), &e)
+	if rr.Code != http.StatusCreated || e.MemberID != 3 || e.Status != StatusOpen || e.Category != "Bakery" || e.Source != "manual" {
+		t.Fatalf("unexpected entry: %d %s", rr.Code, rr.Body.String())
+	}
+	do(r, "3", "POST", "/hours/entries", `{"category_id":2,"work_date":"2025-05-06","hours":2}`)
+	do(r, "3", "POST", "/hours/entries", `{"category_id":1,"work_date":"2025-05-20","hours":4}`)
+	if rr := do(r, "4", "PUT", "/hours/entries/1", `{"category_id":1,"work_date":"2025-05-05","hours":8}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 editing another member's entry, got %d", rr.Code)
+	}
+	if rr := do(r, "3", "PUT", "/hours/entries/1", `{"category_id":1,"work_date":"2025-05-05","hours":8}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected open entry edit, got %d", rr.Code)
+	}
+
+	if rr := do(r, "3", "POST", "/hours/timesheets", `{"period_start":"2025-04-01","period_end":"2025-04-30"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty period, got %d", rr.Code)
+	}
+	rr = do(r, "3", "POST", "/hours/timesheets", `{"period_start":"2025-05-05","period_end":"2025-05-11"}`)
+	var ts Timesheet
+	_ = json.Unmarshal(rr.Body.Bytes(), &ts)
+	if rr.Code != http.StatusCreated || ts.Status != StatusSubmitted || ts.TotalHours != 10 || len(ts.Entries) != 2 {
+		t.Fatalf("unexpected timesheet: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "3", "PUT", "/hours/entries/1", `{"category_id":1,"work_date":"2025-05-05","hours":9}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 editing a submitted entry, got %d", rr.Code)
+	}
+	if rr := do(r, "3", "DELETE", "/hours/entries/2", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 deleting a submitted entry, got %d", rr.Code)
+	}
+	if rr := do(r, "4", "GET", "/hours/timesheets/1", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another member's timesheet, got %d", rr.Code)
+	}
+	if rr := do(r, "2", "POST", "/hours/timesheets/1/approve", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for treasurer approval, got %d", rr.Code)
+	}
+
+	// Rejection releases the entries for correction.
+	rr = do(r, "1", "POST", "/hours/timesheets/1/reject", `{"note":"Ovens took 7.5"}`)
+	_ = json.Unmarshal(rr.Body.Bytes(), &ts)
+	if rr.Code != http.StatusOK || ts.Status != StatusRejected || ts.ReviewNote != "Ovens took 7.5" {
+		t.Fatalf("unexpected reject: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "3", "PUT", "/hours/entries/1", `{"category_id":1,"work_date":"2025-05-05","hours":7.5}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected released entry edit, got %d", rr.Code)
+	}
+	do(r, "3", "POST", "/hours/timesheets", `{"period_start":"2025-05-01","period_end":"2025-05-31"}`)
+	rr = do(r, "1", "POST", "/hours/timesheets/2/approve", "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &ts)
+	if rr.Code != http.StatusOK || ts.Status != StatusApproved || ts.TotalHours != 13.5 {
+		t.Fatalf("unexpected approve: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "1", "POST", "/hours/timesheets/2/approve", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 approving twice, got %d", rr.Code)
+	}
+
+	// Admins may not approve their own hours.
+	do(r, "1", "POST", "/hours/entries", `{"category_id":2,"work_date":"2025-05-05","hours":3}`)
+	do(r, "1", "POST", "/hours/timesheets", `{"period_start":"2025-05-01","period_end":"2025-05-31"}`)
+	if rr := do(r, "1", "POST", "/hours/timesheets/3/approve", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 approving own timesheet, got %d", rr.Code)
+	}
+
+	rr = do(r, "3", "GET", "/hours/entries?status=approved", "")
+	var list []Entry
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 3 {
+		t.Fatalf("expected 3 approved entries, got %s", rr.Body.String())
+	}
+	if rr := do(r, "4", "GET", "/hours/timesheets", ""); strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Fatalf("expected member to see only own timesheets, got %s", rr.Body.String())
+	}
+}
+
+func TestHandlers_ImportAndLabor(t *testing.T) {
+	repo := newRepo()
+	r := setupRouter(Handlers{Repo: repo, Currency: "USD"})
+
+	csv := "Email,Project,Start date,Duration,Description\n" +
+		"ada@example.org,Bakery,2025-05-05,08:00:00,Ovens\n" +
+		"BEN@example.org,admin,2025-05-06,02:30:00,Books\n"
+	if rr := do(r, "3", "POST", "/hours/entries/import", csv); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "line 3") {
+		t.Fatalf("expected member import of another member's row to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+	if len(repo.entries) != 0 {
+		t.Fatalf("expected nothing imported, got %d entries", len(repo.entries))
+	}
+	if rr := do(r, "1", "POST", "/hours/entries/import", "date,category,hours\n2025-05-05,Pottery,1\n"); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "unknown category") {
+		t.Fatalf("expected unknown category, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr := do(r, "1", "POST", "/hours/entries/import", csv)
+	if rr.Code != http.StatusCreated || strings.TrimSpace(rr.Body.String()) != `{"imported":2}` {
+		t.Fatalf("unexpected import: %d %s", rr.Code, rr.Body.String())
+	}
+	if repo.entries[1].MemberID != 4 || repo.entries[1].Hours != 2.5 || repo.entries[1].Source != "csv" {
+		t.Fatalf("unexpected imported entry: %+v", repo.entries[1])
+	}
+	// A member's own export needs no member column.
+	if rr := do(r, "3", "POST", "/hours/entries/import", "Date,Project,Hours\n2025-05-07,Bakery,4\n"); rr.Code != http.StatusCreated || repo.entries[2].MemberID != 3 {
+		t.Fatalf("expected own import, got %d", rr.Code)
+	}
+
+	do(r, "3", "POST", "/hours/timesheets", `{"period_start":"2025-05-01","period_end":"2025-05-31"}`)
+	do(r, "1", "POST", "/hours/timesheets", `{"member_id":4,"period_start":"2025-05-01","period_end":"2025-05-31"}`)
+	do(r, "1", "POST", "/hours/timesheets/1/approve", "")
+	do(r, "1", "POST", "/hours/timesheets/2/approve", "")
+
+	if rr := do(r, "1", "PUT", "/hours/rates/3", `{"hourly_rate":-1}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for negative rate, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "PUT", "/hours/rates/9", `{"hourly_rate":20}`); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown member, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "PUT", "/hours/rates/3", `{"hourly_rate":22.5,"effective_from":"2025-01-01"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected rate, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if rr := do(r, "3", "GET", "/hours/reports/labor", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member, got %d", rr.Code)
+	}
+	rr = do(r, "2", "GET", "/hours/reports/labor?from=2025-05-01&to=2025-05-31", "")
+	var rep LaborReport
+	_ = json.Unmarshal(rr.Body.Bytes(), &rep)
+	if rr.Code != http.StatusOK || len(rep.Rows) != 2 || rep.Currency != "USD" || rep.Rows[0].Cost != 270 || rep.Totals.Hours != 14.5 || rep.Totals.UnratedHours != 2.5 {
+		t.Fatalf("unexpected labor report: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(r, "2", "GET", "/hours/reports/labor.csv?from=2025-05-01&to=2025-05-31", "")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 4 || lines[0] != "member_id,name,hours,cost,unrated_hours" || lines[1] != "3,ada@example.org,12.00,270.00,0.00" || lines[3] != ",Total,14.50,270.00,2.50" {
+		t.Fatalf("unexpected csv: %q", lines)
+	}
+	if rr := do(r, "2", "GET", "/hours/reports/labor?group_by=project", ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for group_by, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,53 @@
+-- backend/internal/hours/migrations/0001_init.sql
+-- Categories and projects hours are logged against. patronage=false keeps
+-- a category's hours out of patronage (e.g. paid leave) while still costing it.
+CREATE TABLE IF NOT EXISTS hour_categories (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL,
+  kind TEXT NOT NULL DEFAULT 'category' CHECK (kind IN ('category','project')),
+  patronage BOOLEAN NOT NULL DEFAULT true,
+  active BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS hour_categories_name_key ON hour_categories (lower(name));
+
+-- Hourly labor cost per member, effective from a date until the next row.
+CREATE TABLE IF NOT EXISTS hour_rates (
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  effective_from DATE NOT NULL,
+  hourly_rate DECIMAL(10,2) NOT NULL CHECK (hourly_rate >= 0),
+  PRIMARY KEY (member_id, effective_from)
+);
+
+CREATE TABLE IF NOT EXISTS hour_timesheets (
+  id SERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE RESTRICT,
+  period_start DATE NOT NULL,
+  period_end DATE NOT NULL,
+  status TEXT NOT NULL DEFAULT 'submitted' CHECK (status IN ('submitted','approved','rejected')),
+  total_hours NUMERIC(8,2) NOT NULL DEFAULT 0,
+  submitted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  reviewed_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  reviewed_at TIMESTAMPTZ,
+  review_note TEXT NOT NULL DEFAULT '',
+  CHECK (period_end >= period_start)
+);
+CREATE INDEX IF NOT EXISTS hour_timesheets_member_id_idx ON hour_timesheets (member_id);
+CREATE INDEX IF NOT EXISTS hour_timesheets_status_idx ON hour_timesheets (status);
+
+-- An entry belongs to at most one submitted or approved timesheet; rejecting
+-- a timesheet releases its entries for editing and resubmission.
+CREATE TABLE IF NOT EXISTS hour_entries (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE RESTRICT,
+  category_id INTEGER NOT NULL REFERENCES hour_categories(id) ON DELETE RESTRICT,
+  work_date DATE NOT NULL,
+  hours NUMERIC(5,2) NOT NULL CHECK (hours > 0 AND hours <= 24),
+  notes TEXT NOT NULL DEFAULT '',
+  source TEXT NOT NULL DEFAULT 'manual' CHECK (source IN ('manual','csv')),
+  timesheet_id INTEGER REFERENCES hour_timesheets(id) ON DELETE SET NULL,
+  created_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS hour_entries_member_date_idx ON hour_entries (member_id, work_date);
+CREATE INDEX IF NOT EXISTS hour_entries_timesheet_id_idx ON hour_entries (timesheet_id);
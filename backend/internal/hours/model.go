@@ -0,0 +1,145 @@
+package hours
+
+import (
+	"math"
+	"time"
+)
+
+// Category kinds.
+const (
+	KindCategory = "category"
+	KindProject  = "project"
+)
+
+// Timesheet statuses. Entries not on a timesheet are "open" and editable.
+const (
+	StatusOpen      = "open"
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+)
+
+// MaxDailyHours caps a single entry.
+const MaxDailyHours = 24
+
+// Category is a category or project hours are logged against. Hours in a
+// category with Patronage false are costed but do not count toward
+// patronage.
+type Category struct {
+	ID        int32     `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Patronage bool      `json:"patronage"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Entry is hours one member worked on one day. Status is the status of its
+// timesheet, or "open" while it is on none.
+type Entry struct {
+	ID          int64     `json:"id"`
+	MemberID    int64     `json:"member_id"`
+	CategoryID  int32     `json:"category_id"`
+	Category    string    `json:"category"`
+	WorkDate    time.Time `json:"work_date"`
+	Hours       float64   `json:"hours"`
+	Notes       string    `json:"notes"`
+	Source      string    `json:"source"`
+	TimesheetID *int32    `json:"timesheet_id"`
+	Status      string    `json:"status"`
+	CreatedBy   *int64    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// EntryFilters holds optional constraints for listing entries. From and To
+// are inclusive work dates.
+type EntryFilters struct {
+	MemberID    *int64
+	CategoryID  *int32
+	TimesheetID *int32
+	Status      string
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+	Offset      int
+}
+
+// Timesheet is a member's open entries in a period, submitted together for
+// approval. Approved timesheets feed patronage and labor cost reports.
+type Timesheet struct {
+	ID          int32      `json:"id"`
+	MemberID    int64      `json:"member_id"`
+	DisplayName string     `json:"display_name"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	Status      string     `json:"status"`
+	TotalHours  float64    `json:"total_hours"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	ReviewedBy  *int64     `json:"reviewed_by"`
+	ReviewedAt  *time.Time `json:"reviewed_at"`
+	ReviewNote  string     `json:"review_note"`
+	Entries     []Entry    `json:"entries,omitempty"`
+}
+
+// ValidTimesheetStatus reports whether s is a timesheet status.
+func ValidTimesheetStatus(s string) bool {
+	return s == StatusSubmitted || s == StatusApproved || s == StatusRejected
+}
+
+// TimesheetFilters holds optional constraints for listing timesheets.
+type TimesheetFilters struct {
+	MemberID *int64
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+// Rate is a member's hourly labor cost from EffectiveFrom until their next
+// rate.
+type Rate struct {
+	MemberID      int64     `json:"member_id"`
+	EffectiveFrom time.Time `json:"effective_from"`
+	HourlyRate    float64   `json:"hourly_rate"`
+}
+
+// LaborRow is approved hours and their cost for one member or category.
+// UnratedHours had no rate in effect and are not in Cost.
+type LaborRow struct {
+	MemberID     *int64  `json:"member_id,omitempty"`
+	CategoryID   *int32  `json:"category_id,omitempty"`
+	Name         string  `json:"name"`
+	Hours        float64 `json:"hours"`
+	Cost         float64 `json:"cost"`
+	UnratedHours float64 `json:"unrated_hours"`
+}
+
+// LaborReport is the labor cost of approved hours in a period.
+type LaborReport struct {
+	From     time.Time  `json:"from"`
+	To       time.Time  `json:"to"`
+	GroupBy  string     `json:"group_by"`
+	Currency string     `json:"currency,omitempty"`
+	Rows     []LaborRow `json:"rows"`
+	Totals   LaborRow   `json:"totals"`
+}
+
+// BuildLaborReport totals rows into a report.
+func BuildLaborReport(from, to time.Time, groupBy string, rows []LaborRow) LaborReport {
+	rep := LaborReport{From: from, To: to, GroupBy: groupBy, Rows: rows, Totals: LaborRow{Name: "Total"}}
+	if rep.Rows == nil {
+		rep.Rows = []LaborRow{}
+	}
+	for _, r := range rows {
+		rep.Totals.Hours += r.Hours
+		rep.Totals.Cost += r.Cost
+		rep.Totals.UnratedHours += r.UnratedHours
+	}
+	rep.Totals.Hours = round2(rep.Totals.Hours)
+	rep.Totals.Cost = round2(rep.Totals.Cost)
+	rep.Totals.UnratedHours = round2(rep.Totals.UnratedHours)
+	return rep
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,158 @@
+package hours
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportRow is one timesheet line read from a CSV file. Email and MemberID
+// are empty when the file does not say whose hours they are.
+type ImportRow struct {
+	Line     int
+	WorkDate time.Time
+	Hours    float64
+	Category string
+	Email    string
+	MemberID *int64
+	Notes    string
+}
+
+// CSV header names recognized for each field, lower case and in order of
+// preference. They cover a plain date,category,hours file as well as the
+// detailed exports of Toggl Track, Clockify and Harvest.
+var (
+	csvDate     = []string{"date", "work date", "work_date", "start date", "start_date", "spent date"}
+	csvHours    = []string{"hours", "duration (decimal)", "time (decimal)", "duration (h)", "duration", "hours worked"}
+	csvCategory = []string{"category", "project", "task", "activity"}
+	csvEmail    = []string{"email", "user email", "member email", "member_email"}
+	csvMemberID = []string{"member_id", "member id"}
+	csvNotes    = []string{"notes", "note", "description", "comment"}
+)
+
+// ParseCSV reads a timesheet export with a header row. It needs a date, a
+// category (or project) and an hours (or duration) column. Durations may be
+// decimal hours or H:MM[:SS]. dayFirst selects DD/MM/YYYY over MM/DD/YYYY
+// for slash-separated dates. Rows with no time are skipped.
+func ParseCSV(r io.Reader, dayFirst bool) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, errors.New("no hours found")
+	}
+	header := map[string]int{}
+	for i, h := range rows[0] {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if _, ok := header[h]; !ok {
+			header[h] = i
+		}
+	}
+	col := func(names []string) int {
+		for _, n := range names {
+			if i, ok := header[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	dateCol, hoursCol, catCol := col(csvDate), col(csvHours), col(csvCategory)
+	emailCol, memberCol, notesCol := col(csvEmail), col(csvMemberID), col(csvNotes)
+	if dateCol < 0 || hoursCol < 0 || catCol < 0 {
+		return nil, errors.New("csv header must include date, category (or project) and hours (or duration) columns")
+	}
+
+	var out []ImportRow
+	for n, row := range rows[1:] {
+		field := func(i int) string {
+			if i < 0 || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		if strings.Join(row, "") == "" {
+			continue
+		}
+		lineNo := n + 2
+		d, err := parseCSVDate(field(dateCol), dayFirst)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", lineNo, field(dateCol))
+		}
+		hrs, err := parseDuration(field(hoursCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid hours %q", lineNo, field(hoursCol))
+		}
+		if hrs == 0 {
+			continue
+		}
+		if hrs < 0 || hrs > MaxDailyHours {
+			return nil, fmt.Errorf("line %d: hours must be between 0 and %d", lineNo, MaxDailyHours)
+		}
+		ir := ImportRow{Line: lineNo, WorkDate: d, Hours: hrs, Category: field(catCol), Email: field(emailCol), Notes: field(notesCol)}
+		if ir.Category == "" {
+			return nil, fmt.Errorf("line %d: category required", lineNo)
+		}
+		if s := field(memberCol); s != "" {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, fmt.Errorf("line %d: invalid member_id %q", lineNo, s)
+			}
+			ir.MemberID = &id
+		}
+		out = append(out, ir)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no hours found")
+	}
+	return out, nil
+}
+
+func parseCSVDate(s string, dayFirst bool) (time.Time, error) {
+	layouts := []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "20060102"}
+	if dayFirst {
+		layouts = []string{"2006-01-02", "02/01/2006", "2/1/2006", "02/01/06", "02.01.2006", "20060102"}
+	}
+	for _, l := range layouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// parseDuration reads decimal hours ("7.5") or a clock duration ("7:30" or
+// "07:30:00"), rounded to hundredths of an hour. Empty strings are zero.
+func parseDuration(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if !strings.Contains(s, ":") {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, errors.New("invalid duration")
+		}
+		return round2(v), nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, errors.New("invalid duration")
+	}
+	var secs int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || (i > 0 && v >= 60) {
+			return 0, errors.New("invalid duration")
+		}
+		secs += v * []int{3600, 60, 1}[i]
+	}
+	return round2(float64(secs) / 3600), nil
+}
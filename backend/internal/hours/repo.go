@@ -0,0 +1,520 @@
+package hours
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("invalid state transition")
+	// ErrDuplicate is returned for a category name already in use.
+	ErrDuplicate = errors.New("category already exists")
+	// ErrNoCategory is returned when an entry names a missing category.
+	ErrNoCategory = errors.New("category not found")
+	// ErrNoEntries is returned by Submit when the period has no open entries.
+	ErrNoEntries = errors.New("no open entries in period")
+)
+
+type Repo interface {
+	ListCategories(ctx context.Context, includeInactive bool) ([]Category, error)
+	GetCategory(ctx context.Context, id int32) (Category, error)
+	CreateCategory(ctx context.Context, c Category) (Category, error)
+	UpdateCategory(ctx context.Context, c Category) (Category, error)
+
+	ListEntries(ctx context.Context, f EntryFilters) ([]Entry, error)
+	GetEntry(ctx context.Context, id int64) (Entry, error)
+	// CreateEntries inserts all entries or none.
+	CreateEntries(ctx context.Context, entries []Entry) ([]Entry, error)
+	// UpdateEntry and DeleteEntry only change open entries; ErrConflict
+	// otherwise.
+	UpdateEntry(ctx context.Context, e Entry) (Entry, error)
+	DeleteEntry(ctx context.Context, id int64) error
+
+	// Submit puts the member's open entries dated in [from, to] on a new
+	// submitted timesheet.
+	Submit(ctx context.Context, memberID int64, from, to time.Time) (Timesheet, error)
+	ListTimesheets(ctx context.Context, f TimesheetFilters) ([]Timesheet, error)
+	// GetTimesheet returns the timesheet with its entries.
+	GetTimesheet(ctx context.Context, id int32) (Timesheet, error)
+	// Review approves or rejects a submitted timesheet; rejecting releases
+	// its entries so they can be corrected and resubmitted.
+	Review(ctx context.Context, id int32, status string, reviewer int64, note string) (Timesheet, error)
+
+	ListRates(ctx context.Context, memberID *int64) ([]Rate, error)
+	// SetRate creates or replaces the member's rate from r.EffectiveFrom.
+	SetRate(ctx context.Context, r Rate) (Rate, error)
+
+	// Labor totals approved hours dated in [from, to] and their cost at each
+	// member's rate on the work date, grouped by "member" or "category".
+	Labor(ctx context.Context, from, to time.Time, groupBy string) ([]LaborRow, error)
+
+	MemberExists(ctx context.Context, id int64) (bool, error)
+	// MemberByEmail matches case-insensitively; nil when no member matches.
+	MemberByEmail(ctx context.Context, email string) (*int64, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const categoryColumns = `id, name, kind, patronage, active, created_at`
+
+func (r *PgRepo) ListCategories(ctx context.Context, includeInactive bool) ([]Category, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+categoryColumns+` FROM hour_categories WHERE active OR $1 ORDER BY kind, lower(name)`, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetCategory(ctx context.Context, id int32) (Category, error) {
+	c, err := scanCategory(r.Pool.QueryRow(ctx, `SELECT `+categoryColumns+` FROM hour_categories WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Category{}, ErrNotFound
+	}
+	return c, err
+}
+
+func (r *PgRepo) CreateCategory(ctx context.Context, c Category) (Category, error) {
+	out, err := scanCategory(r.Pool.QueryRow(ctx, `
+INSERT INTO hour_categories (name, kind, patronage, active)
+VALUES ($1,$2,$3,$4)
+RETURNING `+categoryColumns, c.Name, c.Kind, c.Patronage, c.Active))
+	return out, categoryErr(err)
+}
+
+func (r *PgRepo) UpdateCategory(ctx context.Context, c Category) (Category, error) {
+	out, err := scanCategory(r.Pool.QueryRow(ctx, `
+UPDATE hour_categories SET name=$2, kind=$3, patronage=$4, active=$5
+WHERE id=$1
+RETURNING `+categoryColumns, c.ID, c.Name, c.Kind, c.Patronage, c.Active))
+	if err == pgx.ErrNoRows {
+		return Category{}, ErrNotFound
+	}
+	return out, categoryErr(err)
+}
+
+func categoryErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+		return ErrDuplicate
+	}
+	return err
+}
+
+const entrySelect = `
+SELECT e.id, e.member_id, e.category_id, c.name, e.work_date, e.hours::float8, e.notes, e.source,
+       e.timesheet_id, COALESCE(t.status, 'open'), e.created_by, e.created_at
+FROM hour_entries e
+JOIN hour_categories c ON c.id = e.category_id
+LEFT JOIN hour_timesheets t ON t.id = e.timesheet_id`
+
+func (r *PgRepo) ListEntries(ctx context.Context, f EntryFilters) ([]Entry, error) {
+	query := entrySelect + `
+WHERE ($1::bigint IS NULL OR e.member_id=$1)
+  AND ($2::int IS NULL OR e.category_id=$2)
+  AND ($3::int IS NULL OR e.timesheet_id=$3)
+  AND ($4 = '' OR COALESCE(t.status, 'open')=$4)
+  AND ($5::date IS NULL OR e.work_date >= $5)
+  AND ($6::date IS NULL OR e.work_date <= $6)
+ORDER BY e.work_date DESC, e.id DESC`
+	args := []any{f.MemberID, f.CategoryID, f.TimesheetID, f.Status, datePtr(f.From), datePtr(f.To)}
+	if f.Limit > 0 {
+		query += ` LIMIT $7 OFFSET $8`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $7`
+		args = append(args, f.Offset)
+	}
+	return r.queryEntries(ctx, r.Pool, query, args...)
+}
+
+func (r *PgRepo) GetEntry(ctx context.Context, id int64) (Entry, error) {
+	e, err := scanEntry(r.Pool.QueryRow(ctx, entrySelect+` WHERE e.id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Entry{}, ErrNotFound
+	}
+	return e, err
+}
+
+func (r *PgRepo) CreateEntries(ctx context.Context, entries []Entry) ([]Entry, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	ids := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		var id int64
+		if err := tx.QueryRow(ctx, `
+INSERT INTO hour_entries (member_id, category_id, work_date, hours, notes, source, created_by)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+RETURNING id`, e.MemberID, e.CategoryID, pgtype.Date{Time: e.WorkDate, Valid: true}, e.Hours, e.Notes, e.Source, e.CreatedBy).Scan(&id); err != nil {
+			return nil, entryErr(err)
+		}
+		ids = append(ids, id)
+	}
+	out, err := r.queryEntries(ctx, tx, entrySelect+` WHERE e.id = ANY($1) ORDER BY e.id`, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *PgRepo) UpdateEntry(ctx context.Context, e Entry) (Entry, error) {
+	tag, err := r.Pool.Exec(ctx, `
+UPDATE hour_entries SET category_id=$2, work_date=$3, hours=$4, notes=$5
+WHERE id=$1 AND timesheet_id IS NULL`, e.ID, e.CategoryID, pgtype.Date{Time: e.WorkDate, Valid: true}, e.Hours, e.Notes)
+	if err != nil {
+		return Entry{}, entryErr(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return Entry{}, r.entryMissingOrConflict(ctx, e.ID)
+	}
+	return r.GetEntry(ctx, e.ID)
+}
+
+func (r *PgRepo) DeleteEntry(ctx context.Context, id int64) error {
+	tag, err := r.Pool.Exec(ctx, `DELETE FROM hour_entries WHERE id=$1 AND timesheet_id IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return r.entryMissingOrConflict(ctx, id)
+	}
+	return nil
+}
+
+func entryErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" && strings.Contains(pgErr.ConstraintName, "category") { // foreign_key_violation
+		return ErrNoCategory
+	}
+	return err
+}
+
+func (r *PgRepo) entryMissingOrConflict(ctx context.Context, id int64) error {
+	var exists bool
+	if err := r.Pool.QueryRow(ctx, `SELECT true FROM hour_entries WHERE id=$1`, id).Scan(&exists); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return ErrConflict
+}
+
+// querier is satisfied by both the pool and a transaction.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func (r *PgRepo) queryEntries(ctx context.Context, q querier, query string, args ...any) ([]Entry, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+const timesheetSelect = `
+SELECT t.id, t.member_id, m.display_name, t.period_start, t.period_end, t.status, t.total_hours::float8,
+       t.submitted_at, t.reviewed_by, t.reviewed_at, t.review_note
+FROM hour_timesheets t
+JOIN members m ON m.id = t.member_id`
+
+func (r *PgRepo) Submit(ctx context.Context, memberID int64, from, to time.Time) (Timesheet, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Timesheet{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var id int32
+	start, end := pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true}
+	if err := tx.QueryRow(ctx, `
+INSERT INTO hour_timesheets (member_id, period_start, period_end)
+VALUES ($1,$2,$3)
+RETURNING id`, memberID, start, end).Scan(&id); err != nil {
+		return Timesheet{}, err
+	}
+	tag, err := tx.Exec(ctx, `
+UPDATE hour_entries SET timesheet_id=$1
+WHERE member_id=$2 AND timesheet_id IS NULL AND work_date BETWEEN $3 AND $4`, id, memberID, start, end)
+	if err != nil {
+		return Timesheet{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Timesheet{}, ErrNoEntries
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE hour_timesheets SET total_hours=(SELECT SUM(hours) FROM hour_entries WHERE timesheet_id=$1)
+WHERE id=$1`, id); err != nil {
+		return Timesheet{}, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Timesheet{}, err
+	}
+	return r.GetTimesheet(ctx, id)
+}
+
+func (r *PgRepo) ListTimesheets(ctx context.Context, f TimesheetFilters) ([]Timesheet, error) {
+	query := timesheetSelect + `
+WHERE ($1::bigint IS NULL OR t.member_id=$1) AND ($2 = '' OR t.status=$2)
+ORDER BY t.submitted_at DESC, t.id DESC`
+	args := []any{f.MemberID, f.Status}
+	if f.Limit > 0 {
+		query += ` LIMIT $3 OFFSET $4`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $3`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Timesheet
+	for rows.Next() {
+		t, err := scanTimesheet(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetTimesheet(ctx context.Context, id int32) (Timesheet, error) {
+	t, err := scanTimesheet(r.Pool.QueryRow(ctx, timesheetSelect+` WHERE t.id=$1`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return Timesheet{}, ErrNotFound
+		}
+		return Timesheet{}, err
+	}
+	entries, err := r.queryEntries(ctx, r.Pool, entrySelect+` WHERE e.timesheet_id=$1 ORDER BY e.work_date, e.id`, id)
+	if err != nil {
+		return Timesheet{}, err
+	}
+	t.Entries = entries
+	return t, nil
+}
+
+func (r *PgRepo) Review(ctx context.Context, id int32, status string, reviewer int64, note string) (Timesheet, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Timesheet{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+UPDATE hour_timesheets SET status=$2, reviewed_by=$3, reviewed_at=now(), review_note=$4
+WHERE id=$1 AND status='submitted'`, id, status, reviewer, note)
+	if err != nil {
+		return Timesheet{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := tx.QueryRow(ctx, `SELECT true FROM hour_timesheets WHERE id=$1`, id).Scan(&exists); err != nil {
+			if err == pgx.ErrNoRows {
+				return Timesheet{}, ErrNotFound
+			}
+			return Timesheet{}, err
+		}
+		return Timesheet{}, ErrConflict
+	}
+	if status == StatusRejected {
+		if _, err := tx.Exec(ctx, `UPDATE hour_entries SET timesheet_id=NULL WHERE timesheet_id=$1`, id); err != nil {
+			return Timesheet{}, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Timesheet{}, err
+	}
+	return r.GetTimesheet(ctx, id)
+}
+
+func (r *PgRepo) ListRates(ctx context.Context, memberID *int64) ([]Rate, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT member_id, effective_from, hourly_rate::float8 FROM hour_rates
+WHERE $1::bigint IS NULL OR member_id=$1
+ORDER BY member_id, effective_from DESC`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Rate
+	for rows.Next() {
+		var rt Rate
+		var from pgtype.Date
+		if err := rows.Scan(&rt.MemberID, &from, &rt.HourlyRate); err != nil {
+			return nil, err
+		}
+		rt.EffectiveFrom = from.Time
+		out = append(out, rt)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) SetRate(ctx context.Context, rt Rate) (Rate, error) {
+	var from pgtype.Date
+	err := r.Pool.QueryRow(ctx, `
+INSERT INTO hour_rates (member_id, effective_from, hourly_rate)
+VALUES ($1,$2,$3)
+ON CONFLICT (member_id, effective_from) DO UPDATE SET hourly_rate=EXCLUDED.hourly_rate
+RETURNING member_id, effective_from, hourly_rate::float8`, rt.MemberID, pgtype.Date{Time: rt.EffectiveFrom, Valid: true}, rt.HourlyRate).
+		Scan(&rt.MemberID, &from, &rt.HourlyRate)
+	rt.EffectiveFrom = from.Time
+	return rt, err
+}
+
+func (r *PgRepo) Labor(ctx context.Context, from, to time.Time, groupBy string) ([]LaborRow, error) {
+	key, name := `e.member_id, NULL::int`, `m.display_name`
+	if groupBy == "category" {
+		key, name = `NULL::bigint, e.category_id`, `c.name`
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT `+key+`, `+name+`,
+       SUM(e.hours)::float8,
+       COALESCE(SUM(ROUND(e.hours * rt.hourly_rate, 2)), 0)::float8,
+       COALESCE(SUM(e.hours) FILTER (WHERE rt.hourly_rate IS NULL), 0)::float8
+FROM hour_entries e
+JOIN hour_timesheets t ON t.id = e.timesheet_id AND t.status = 'approved'
+JOIN hour_categories c ON c.id = e.category_id
+JOIN members m ON m.id = e.member_id
+LEFT JOIN LATERAL (
+  SELECT hourly_rate FROM hour_rates
+  WHERE member_id = e.member_id AND effective_from <= e.work_date
+  ORDER BY effective_from DESC LIMIT 1
+) rt ON true
+WHERE e.work_date BETWEEN $1 AND $2
+GROUP BY 1, 2, 3
+ORDER BY 5 DESC, 3`, pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []LaborRow
+	for rows.Next() {
+		var lr LaborRow
+		var mid pgtype.Int8
+		var cid pgtype.Int4
+		if err := rows.Scan(&mid, &cid, &lr.Name, &lr.Hours, &lr.Cost, &lr.UnratedHours); err != nil {
+			return nil, err
+		}
+		if mid.Valid {
+			lr.MemberID = &mid.Int64
+		}
+		if cid.Valid {
+			lr.CategoryID = &cid.Int32
+		}
+		out = append(out, lr)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) MemberExists(ctx context.Context, id int64) (bool, error) {
+	var ok bool
+	err := r.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM members WHERE id=$1)`, id).Scan(&ok)
+	return ok, err
+}
+
+func (r *PgRepo) MemberByEmail(ctx context.Context, email string) (*int64, error) {
+	var id int64
+	err := r.Pool.QueryRow(ctx, `SELECT id FROM members WHERE lower(email)=$1 ORDER BY id LIMIT 1`, strings.ToLower(strings.TrimSpace(email))).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func datePtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return pgtype.Date{Time: *t, Valid: true}
+}
+
+func scanCategory(row pgx.Row) (Category, error) {
+	var c Category
+	err := row.Scan(&c.ID, &c.Name, &c.Kind, &c.Patronage, &c.Active, &c.CreatedAt)
+	return c, err
+}
+
+func scanEntry(row pgx.Row) (Entry, error) {
+	var e Entry
+	var workDate pgtype.Date
+	var timesheetID pgtype.Int4
+	var createdBy pgtype.Int8
+	if err := row.Scan(&e.ID, &e.MemberID, &e.CategoryID, &e.Category, &workDate, &e.Hours, &e.Notes, &e.Source,
+		&timesheetID, &e.Status, &createdBy, &e.CreatedAt); err != nil {
+		return Entry{}, err
+	}
+	e.WorkDate = workDate.Time
+	if timesheetID.Valid {
+		e.TimesheetID = &timesheetID.Int32
+	}
+	if createdBy.Valid {
+		e.CreatedBy = &createdBy.Int64
+	}
+	return e, nil
+}
+
+func scanTimesheet(row pgx.Row) (Timesheet, error) {
+	var t Timesheet
+	var start, end pgtype.Date
+	var reviewedBy pgtype.Int8
+	var reviewedAt pgtype.Timestamptz
+	if err := row.Scan(&t.ID, &t.MemberID, &t.DisplayName, &start, &end, &t.Status, &t.TotalHours,
+		&t.SubmittedAt, &reviewedBy, &reviewedAt, &t.ReviewNote); err != nil {
+		return Timesheet{}, err
+	}
+	t.PeriodStart, t.PeriodEnd = start.Time, end.Time
+	if reviewedBy.Valid {
+		t.ReviewedBy = &reviewedBy.Int64
+	}
+	if reviewedAt.Valid {
+		v := reviewedAt.Time
+		t.ReviewedAt = &v
+	}
+	return t, nil
+}
@@ -0,0 +1,32 @@
+package hours
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	admin := httpmw.RequirePermission("hours.manage")
+	finance := httpmw.RequirePermission("hours.reports")
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequireAuth)
+		r.Get("/categories", h.ListCategories)
+		r.With(admin).Post("/categories", h.CreateCategory)
+		r.With(admin).Put("/categories/{id}", h.UpdateCategory)
+		r.Get("/entries", h.ListEntries)
+		r.Post("/entries", h.CreateEntry)
+		r.Post("/entries/import", h.Import)
+		r.Put("/entries/{id}", h.UpdateEntry)
+		r.Delete("/entries/{id}", h.DeleteEntry)
+		r.Get("/timesheets", h.ListTimesheets)
+		r.Post("/timesheets", h.Submit)
+		r.Get("/timesheets/{id}", h.GetTimesheet)
+		r.With(admin).Post("/timesheets/{id}/approve", h.Approve)
+		r.With(admin).Post("/timesheets/{id}/reject", h.Reject)
+		r.With(finance).Get("/rates", h.ListRates)
+		r.With(admin).Put("/rates/{memberID}", h.SetRate)
+		r.With(finance).Get("/reports/labor", h.Labor)
+		r.With(finance).Get("/reports/labor.csv", h.LaborCSV)
+	}
+	r.Route("/hours", route)
+}
@@ -4,57 +4,160 @@ import (
     "context"
     "net/http"
     "strconv"
+    "strings"
 )
 
 // Principal is the authenticated identity attached to a request.
-// Role may be "admin", "member", or "guest" (unauthenticated).
+// Role is the member's base role ("admin", "treasurer", "member"), or
+// "guest" when unauthenticated. Roles adds roles assigned on top of it and
+// Permissions is what they all grant; nil Permissions means the defaults
+// for Role (see Can).
+// Via says how the request authenticated ("session", "token" or "header");
+// SessionID or TokenID is the session or API token it used, if any.
+// Scopes is nil except for API tokens, which are limited to them.
+// Status is the membership status; empty means active or unknown.
 type Principal struct {
-    MemberID int64
-    Role     string
-    Email    string
-    Name     string
+    MemberID    int64
+    Role        string
+    Status      string
+    Email       string
+    Name        string
+    Via         string
+    SessionID   int64
+    TokenID     int64
+    Scopes      []string
+    Roles       []string
+    Permissions []string
 }
 
 // MemberFetcher looks up a member by id and returns a Principal.
 // found=false indicates no such member. error indicates backend failure.
 type MemberFetcher func(ctx context.Context, id int64) (p Principal, found bool, err error)
 
+// SessionResolver turns a session or API token into a Principal. fromCookie
+// reports whether the token came from the session cookie rather than an
+// Authorization header; the resolver may rotate the cookie on w.
+// found=false means the token is unknown, expired or revoked.
+type SessionResolver interface {
+    ResolveSession(w http.ResponseWriter, r *http.Request, token string, fromCookie bool) (p Principal, found bool, err error)
+}
+
+// DefaultSessionCookie is the session cookie name when AuthConfig leaves it empty.
+const DefaultSessionCookie = "coop_session"
+
+// AuthConfig configures WithAuth.
+type AuthConfig struct {
+    // Sessions resolves tokens from the session cookie or an
+    // "Authorization: Bearer" header.
+    Sessions SessionResolver
+    // CookieName defaults to DefaultSessionCookie.
+    CookieName string
+    // TrustedOrigins may send cookie-authenticated writes. Writes from any
+    // other Origin, or marked cross-site by the browser, are refused.
+    TrustedOrigins []string
+    // DevHeader, when set, trusts a raw X-User-Id header. Development and
+    // tests only: anyone can claim any id.
+    DevHeader MemberFetcher
+}
+
 type ctxUserKey struct{}
 
-// WithAuth parses X-User-Id and injects Principal into context.
-// - Missing header -> guest principal
-// - Present but invalid -> 401
-// - Present but not found -> 401
-func WithAuth(fetch MemberFetcher) func(http.Handler) http.Handler {
+// WithAuth resolves the Principal for a request and injects it into context.
+// - Bearer token or session cookie -> its session's member
+// - Unknown or expired bearer token -> 401
+// - Unknown or expired cookie -> guest (the cookie is cleared)
+// - X-User-Id -> that member when DevHeader is set, otherwise 401
+// - No credentials -> guest principal
+func WithAuth(cfg AuthConfig) func(http.Handler) http.Handler {
+    cookieName := cfg.CookieName
+    if cookieName == "" { cookieName = DefaultSessionCookie }
+    trusted := make(map[string]struct{}, len(cfg.TrustedOrigins))
+    for _, o := range cfg.TrustedOrigins { trusted[strings.TrimRight(o, "/")] = struct{}{} }
     return func(next http.Handler) http.Handler {
         return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-            s := r.Header.Get("X-User-Id")
-            if s == "" {
-                // guest
-                ctx := context.WithValue(r.Context(), ctxUserKey{}, Principal{MemberID: 0, Role: "guest"})
+            if token, fromCookie := sessionToken(r, cookieName); token != "" {
+                if cfg.Sessions == nil {
+                    WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+                    return
+                }
+                if fromCookie && !safeMethod(r.Method) && !sameOrigin(r, trusted) {
+                    WriteJSONError(w, http.StatusForbidden, "cross-site request refused")
+                    return
+                }
+                p, found, err := cfg.Sessions.ResolveSession(w, r, token, fromCookie)
+                if err != nil {
+                    WriteJSONError(w, http.StatusInternalServerError, "auth lookup failed")
+                    return
+                }
+                if found {
+                    next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxUserKey{}, p)))
+                    return
+                }
+                if !fromCookie {
+                    WriteJSONError(w, http.StatusUnauthorized, "invalid or expired session")
+                    return
+                }
+            } else if s := r.Header.Get("X-User-Id"); s != "" {
+                if cfg.DevHeader == nil {
+                    WriteJSONError(w, http.StatusUnauthorized, "X-User-Id authentication is disabled")
+                    return
+                }
+                id64, err := strconv.ParseInt(s, 10, 64)
+                if err != nil || id64 <= 0 {
+                    WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+                    return
+                }
+                p, found, err := cfg.DevHeader(r.Context(), id64)
+                if err != nil {
+                    WriteJSONError(w, http.StatusInternalServerError, "auth lookup failed")
+                    return
+                }
+                if !found {
+                    WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+                    return
+                }
+                p.Via = "header"
+                ctx := context.WithValue(r.Context(), ctxUserKey{}, p)
                 next.ServeHTTP(w, r.WithContext(ctx))
                 return
             }
-            id64, err := strconv.ParseInt(s, 10, 64)
-            if err != nil || id64 <= 0 {
-                WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
-                return
-            }
-            p, found, err := fetch(r.Context(), id64)
-            if err != nil {
-                WriteJSONError(w, http.StatusInternalServerError, "auth lookup failed")
-                return
-            }
-            if !found {
-                WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
-                return
-            }
-            ctx := context.WithValue(r.Context(), ctxUserKey{}, p)
+            // guest
+            ctx := context.WithValue(r.Context(), ctxUserKey{}, Principal{MemberID: 0, Role: "guest"})
             next.ServeHTTP(w, r.WithContext(ctx))
         })
     }
 }
 
+// DevHeaderAuth is WithAuth trusting only X-User-Id. Used by handler tests.
+func DevHeaderAuth(fetch MemberFetcher) func(http.Handler) http.Handler {
+    return WithAuth(AuthConfig{DevHeader: fetch})
+}
+
+// sessionToken returns the bearer token, or else the session cookie.
+func sessionToken(r *http.Request, cookieName string) (token string, fromCookie bool) {
+    if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+        return strings.TrimSpace(h[7:]), false
+    }
+    if c, err := r.Cookie(cookieName); err == nil && c.Value != "" {
+        return c.Value, true
+    }
+    return "", false
+}
+
+func safeMethod(m string) bool {
+    return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// sameOrigin guards cookie-authenticated writes against CSRF on top of the
+// SameSite cookie attribute.
+func sameOrigin(r *http.Request, trusted map[string]struct{}) bool {
+    if o := r.Header.Get("Origin"); o != "" {
+        _, ok := trusted[o]
+        return ok
+    }
+    return r.Header.Get("Sec-Fetch-Site") != "cross-site"
+}
+
 // FromContext returns the Principal from context if present.
 func FromContext(ctx context.Context) (Principal, bool) {
     v := ctx.Value(ctxUserKey{})
@@ -77,7 +180,31 @@ func RequireAuth(next http.Handler) http.Handler {
     })
 }
 
-// RequireRole ensures the current principal has one of the roles.
+// Active reports whether p is a member in good standing. Principals
+// loaded without a status (development headers, tests) count as active.
+func (p Principal) Active() bool {
+    return p.MemberID > 0 && p.Role != "guest" && (p.Status == "" || p.Status == "active")
+}
+
+// RequireActive ensures the current principal is an active member:
+// applicants and suspended members are signed in but may not act.
+func RequireActive(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        p, ok := FromContext(r.Context())
+        if !ok || p.Role == "guest" || p.MemberID <= 0 {
+            WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+            return
+        }
+        if !p.Active() {
+            WriteJSONError(w, http.StatusForbidden, "only active members may do this")
+            return
+        }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// RequireRole ensures the current principal has one of the roles, as its
+// base role or an assigned one. Prefer RequirePermission for new routes.
 func RequireRole(roles ...string) func(http.Handler) http.Handler {
     allowed := make(map[string]struct{}, len(roles))
     for _, r := range roles { allowed[r] = struct{}{} }
@@ -88,7 +215,11 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
                 WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
                 return
             }
-            if _, ok := allowed[p.Role]; !ok {
+            held := false
+            for _, role := range p.RoleNames() {
+                if _, ok := allowed[role]; ok { held = true }
+            }
+            if !held {
                 WriteJSONError(w, http.StatusForbidden, "forbidden")
                 return
             }
@@ -0,0 +1,107 @@
+package httpmw
+
+import "net/http"
+
+// Permissions names every action that can be granted, with a short
+// description for role editors. Roles are sets of these; "*" grants all.
+var Permissions = map[string]string{
+    "announcements.publish":  "Publish announcements",
+    "attachments.manage":     "Delete any member's attachments",
+    "audit.read":             "Read the sign-in audit log",
+    "bank.reconcile":         "Import bank statements and reconcile lines",
+    "budgets.manage":         "Create budgets and budget lines",
+    "capital.view":           "View every member's capital account",
+    "capital.manage":         "Record capital plans, purchases, redemptions and adjustments",
+    "dues.manage":            "Manage dues plans, enrollments and assessments",
+    "fx.manage":              "Maintain exchange rates",
+    "hours.manage":           "Manage hour categories, rates and other members' hours; approve timesheets",
+    "hours.reports":          "View every timesheet, labor rates and labor cost reports",
+    "invoices.manage":        "Manage customers and invoices",
+    "ledger.import":          "Import ledger entries",
+    "ledger.accounts":        "Map ledger accounts",
+    "ledger.settle":          "Settle ledger entries",
+    "members.manage":         "Add members and change their membership status",
+    "patronage.manage":       "Run, approve and post patronage allocations",
+    "payments.view":          "View payment events",
+    "proposals.manage":       "Close proposals",
+    "payments.manage":        "Replay and assign payment events",
+    "reimbursements.approve": "Approve, reject, post and pay reimbursements",
+    "reimbursements.limits":  "Set reimbursement approval limits",
+    "roles.manage":           "Manage roles and role assignments",
+    "tokens.manage":          "Mint and revoke API tokens",
+}
+
+// AllPermissions grants every permission, including ones added later.
+const AllPermissions = "*"
+
+// DefaultRolePermissions are the built-in roles' permissions. Principals
+// loaded without permissions (development headers, tests) get these for
+// their Role; the rbac migration seeds the same sets.
+var DefaultRolePermissions = map[string][]string{
+    "admin":     {AllPermissions},
+    "treasurer": {"capital.view", "hours.reports", "invoices.manage", "payments.view", "reimbursements.approve"},
+    "member":    {},
+}
+
+// RoleNames lists every role p holds, the base Role first.
+func (p Principal) RoleNames() []string {
+    if len(p.Roles) > 0 {
+        return p.Roles
+    }
+    return []string{p.Role}
+}
+
+// HasRole reports whether p holds role, as its base role or an assigned one.
+func (p Principal) HasRole(role string) bool {
+    for _, r := range p.RoleNames() {
+        if r == role {
+            return true
+        }
+    }
+    return false
+}
+
+// GrantedPermissions is what p's roles grant: Permissions, or the
+// defaults for Role when they were not loaded.
+func (p Principal) GrantedPermissions() []string {
+    if p.Role == "guest" || p.MemberID <= 0 {
+        return []string{}
+    }
+    if p.Permissions != nil {
+        return p.Permissions
+    }
+    if perms, ok := DefaultRolePermissions[p.Role]; ok {
+        return perms
+    }
+    return []string{}
+}
+
+// Can reports whether p's roles grant perm. Guests can do nothing.
+func (p Principal) Can(perm string) bool {
+    for _, s := range p.GrantedPermissions() {
+        if s == perm || s == AllPermissions {
+            return true
+        }
+    }
+    return false
+}
+
+// RequirePermission ensures the current principal holds one of perms.
+func RequirePermission(perms ...string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p, ok := FromContext(r.Context())
+            if !ok || p.Role == "guest" || p.MemberID <= 0 {
+                WriteJSONError(w, http.StatusUnauthorized, "unauthorized")
+                return
+            }
+            for _, perm := range perms {
+                if p.Can(perm) {
+                    next.ServeHTTP(w, r)
+                    return
+                }
+            }
+            WriteJSONError(w, http.StatusForbidden, "forbidden")
+        })
+    }
+}
@@ -0,0 +1,62 @@
+package httpmw
+
+import (
+    "net/http"
+    "strings"
+)
+
+// HasScope reports whether p may act within scope. Principals without
+// scopes (sessions) may do anything their role allows; API tokens need the
+// scope itself, where "area:write" also grants "area:read".
+func (p Principal) HasScope(scope string) bool {
+    if p.Scopes == nil {
+        return true
+    }
+    area, access, _ := strings.Cut(scope, ":")
+    for _, s := range p.Scopes {
+        if s == scope || (access == "read" && s == area+":write") {
+            return true
+        }
+    }
+    return false
+}
+
+// RequireScope limits API-token requests to tokens granted scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if p, ok := FromContext(r.Context()); ok && !p.HasScope(scope) {
+                WriteJSONError(w, http.StatusForbidden, "token lacks scope "+scope)
+                return
+            }
+            next.ServeHTTP(w, r)
+        })
+    }
+}
+
+// AreaScopes enforces a scope on every route below prefix, so no route can
+// be left out: the first path segment after prefix names the area and the
+// method picks the access, e.g. GET /api/ledger needs "ledger:read" and
+// POST /api/ledger/7/void "ledger:write".
+func AreaScopes(prefix string) func(http.Handler) http.Handler {
+    return func(next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            p, ok := FromContext(r.Context())
+            if !ok || p.Scopes == nil {
+                next.ServeHTTP(w, r)
+                return
+            }
+            RequireScope(RouteScope(prefix, r))(next).ServeHTTP(w, r)
+        })
+    }
+}
+
+// RouteScope is the scope AreaScopes requires for r.
+func RouteScope(prefix string, r *http.Request) string {
+    rest := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+    area, _, _ := strings.Cut(rest, "/")
+    if safeMethod(r.Method) {
+        return area + ":read"
+    }
+    return area + ":write"
+}
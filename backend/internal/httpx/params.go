@@ -3,6 +3,7 @@ package httpx
 import (
     "net/http"
     "strconv"
+    "time"
 )
 
 // QueryString returns the raw query value for key.
@@ -25,3 +26,25 @@ func QueryBoolTrue(r *http.Request, key string) bool {
     return r.URL.Query().Get(key) == "true"
 }
 
+// DateLayout is the calendar date format used in query params and JSON bodies.
+const DateLayout = "2006-01-02"
+
+// QueryDate parses an optional YYYY-MM-DD date from query parameters.
+// Returns (nil, nil) when missing.
+func QueryDate(r *http.Request, key string) (*time.Time, error) {
+    s := r.URL.Query().Get(key)
+    if s == "" { return nil, nil }
+    v, err := time.Parse(DateLayout, s)
+    if err != nil { return nil, err }
+    return &v, nil
+}
+
+// ParseDate parses an optional YYYY-MM-DD date string from a request body.
+// Returns (nil, nil) when empty.
+func ParseDate(s string) (*time.Time, error) {
+    if s == "" { return nil, nil }
+    v, err := time.Parse(DateLayout, s)
+    if err != nil { return nil, err }
+    return &v, nil
+}
+
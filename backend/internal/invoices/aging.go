@@ -0,0 +1,88 @@
+package invoices
+
+import (
+	"sort"
+	"time"
+)
+
+// AgingRow is one debtor's open balance split by how far past due it is.
+// Current is not yet due; the day buckets count days past the due date.
+type AgingRow struct {
+	MemberID   *int64  `json:"member_id,omitempty"`
+	CustomerID *int32  `json:"customer_id,omitempty"`
+	BillTo     string  `json:"bill_to"`
+	Invoices   int     `json:"invoices"`
+	Current    float64 `json:"current"`
+	Days1To30  float64 `json:"days_1_30"`
+	Days31To60 float64 `json:"days_31_60"`
+	Days61To90 float64 `json:"days_61_90"`
+	Over90     float64 `json:"over_90"`
+	Total      float64 `json:"total"`
+}
+
+// AgingReport is the receivables aging for one currency as of a date.
+type AgingReport struct {
+	AsOf     time.Time  `json:"as_of"`
+	Currency string     `json:"currency"`
+	Rows     []AgingRow `json:"rows"`
+	Totals   AgingRow   `json:"totals"`
+}
+
+func (a *AgingRow) add(balance float64, daysPastDue int) {
+	switch {
+	case daysPastDue <= 0:
+		a.Current += balance
+	case daysPastDue <= 30:
+		a.Days1To30 += balance
+	case daysPastDue <= 60:
+		a.Days31To60 += balance
+	case daysPastDue <= 90:
+		a.Days61To90 += balance
+	default:
+		a.Over90 += balance
+	}
+	a.Total += balance
+	a.Invoices++
+}
+
+func (a *AgingRow) round() {
+	a.Current, a.Days1To30, a.Days31To60 = round2(a.Current), round2(a.Days1To30), round2(a.Days31To60)
+	a.Days61To90, a.Over90, a.Total = round2(a.Days61To90), round2(a.Over90), round2(a.Total)
+}
+
+// BuildAging buckets the balances of outstanding invoices by debtor. Rows
+// are ordered by largest total first.
+func BuildAging(outstanding []Invoice, currency string, asOf time.Time) AgingReport {
+	rep := AgingReport{AsOf: asOf, Currency: currency, Rows: []AgingRow{}, Totals: AgingRow{BillTo: "Total"}}
+	type debtor struct {
+		member   int64
+		customer int32
+	}
+	index := map[debtor]int{}
+	for _, inv := range outstanding {
+		if inv.Balance <= 0 {
+			continue
+		}
+		var key debtor
+		if inv.MemberID != nil {
+			key.member = *inv.MemberID
+		} else if inv.CustomerID != nil {
+			key.customer = *inv.CustomerID
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(rep.Rows)
+			index[key] = i
+			rep.Rows = append(rep.Rows, AgingRow{MemberID: inv.MemberID, CustomerID: inv.CustomerID, BillTo: inv.BillTo})
+		}
+		days := int(asOf.Sub(inv.DueDate).Hours() / 24)
+		rep.Rows[i].add(inv.Balance, days)
+		rep.Totals.add(inv.Balance, days)
+	}
+	for i := range rep.Rows {
+		rep.Rows[i].round()
+	}
+	rep.Totals.round()
+	sort.SliceStable(rep.Rows, func(i, j int) bool { return rep.Rows[i].Total > rep.Rows[j].Total })
+	return rep
+}
@@ -0,0 +1,629 @@
+package invoices
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxLines caps the number of line items on one invoice.
+const maxLines = 200
+
+// LedgerPoster is the subset of ledger.Repo used to post payments.
+type LedgerPoster interface {
+	CreateInCurrency(ctx context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+	// Rates converts payments on invoices in a foreign currency; nil
+	// accepts only ledger.BaseCurrency payments.
+	Rates  fx.Lookuper
+	Issuer Issuer
+}
+
+// isBiller reports whether p may issue and manage invoices.
+func isBiller(p httpmw.Principal) bool {
+	return p.Can("invoices.manage")
+}
+
+// List handles GET /api/invoices. Members only see their own issued
+// invoices; billers see all and may filter.
+// Query: status, member_id, customer_id, overdue=true, limit, offset
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	f := ListFilters{Status: r.URL.Query().Get("status"), Overdue: httpx.QueryBoolTrue(r, "overdue")}
+	if f.Status != "" && !ValidStatus(f.Status) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	mid, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	cid, err := httpx.QueryInt64(r, "customer_id")
+	if err != nil || (cid != nil && (*cid <= 0 || *cid > math.MaxInt32)) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid customer_id")
+		return
+	}
+	f.MemberID = mid
+	if cid != nil {
+		c := int32(*cid)
+		f.CustomerID = &c
+	}
+	if !isBiller(p) {
+		f.MemberID, f.CustomerID, f.Issued = &p.MemberID, nil, true
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 200)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.List(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Invoice{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type invoiceInput struct {
+	MemberID   *int64 `json:"member_id"`
+	CustomerID *int32 `json:"customer_id"`
+	Currency   string `json:"currency"`
+	LedgerType string `json:"ledger_type"`
+	IssueDate  string `json:"issue_date"`
+	DueDate    string `json:"due_date"`
+	Notes      string `json:"notes"`
+	Lines      []Line `json:"lines"`
+}
+
+// Create handles POST /api/invoices (admin, treasurer), creating a draft.
+// Body: {"member_id":4,"issue_date":"2025-05-01","due_date":"2025-05-31",
+// "lines":[{"description":"May rent","quantity":1,"unit_price":650}]}
+func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
+	inv, ok := readInvoice(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	inv.CreatedBy = &p.MemberID
+	out, err := h.Repo.Create(r.Context(), inv)
+	if err != nil {
+		if errors.Is(err, ErrNoParty) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "member or customer not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// Get handles GET /api/invoices/{id} for the billed member or a biller.
+func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.visible(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, inv)
+}
+
+// Update handles PUT /api/invoices/{id} (admin, treasurer). Only drafts may
+// change; the body is the same as for Create and replaces all lines.
+func (h Handlers) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return
+	}
+	inv, ok := readInvoice(w, r)
+	if !ok {
+		return
+	}
+	inv.ID = id
+	out, err := h.Repo.Update(r.Context(), inv)
+	writeResult(w, out, err, "invoice is not a draft")
+}
+
+// Send handles POST /api/invoices/{id}/send (admin, treasurer), issuing a
+// draft.
+func (h Handlers) Send(w http.ResponseWriter, r *http.Request) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return
+	}
+	out, err := h.Repo.Send(r.Context(), id)
+	writeResult(w, out, err, "invoice is not a draft")
+}
+
+// Void handles POST /api/invoices/{id}/void (admin, treasurer)
+// Body: {"reason":"Issued twice"}
+func (h Handlers) Void(w http.ResponseWriter, r *http.Request) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+	}
+	out, err := h.Repo.Void(r.Context(), id, strings.TrimSpace(in.Reason))
+	writeResult(w, out, err, "only drafts and unpaid invoices can be voided")
+}
+
+// AddPayment handles POST /api/invoices/{id}/payments (admin, treasurer).
+// The payment is posted to the ledger as the invoice's ledger type in the
+// invoice currency.
+// Body: {"amount":650,"paid_on":"2025-05-03","method":"transfer","reference":"TX-12"}
+// paid_on defaults to today.
+func (h Handlers) AddPayment(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.invoice(w, r)
+	if !ok {
+		return
+	}
+	if !Open(inv.Status) {
+		httpmw.WriteJSONError(w, http.StatusConflict, "invoice is not open for payment")
+		return
+	}
+	var in struct {
+		Amount    float64 `json:"amount"`
+		PaidOn    string  `json:"paid_on"`
+		Method    string  `json:"method"`
+		Reference string  `json:"reference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	in.Amount = round2(in.Amount)
+	if in.Amount <= 0 || math.IsInf(in.Amount, 0) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+	paidOn := today()
+	if in.PaidOn != "" {
+		d, err := httpx.ParseDate(in.PaidOn)
+		if err != nil || d == nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid paid_on")
+			return
+		}
+		paidOn = *d
+	}
+	if paidOn.Before(inv.IssueDate) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "paid_on must not be before issue_date")
+		return
+	}
+	// Look the rate up first so a payment is never recorded without one.
+	rate, ok := h.rate(w, r, inv.Currency, paidOn)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	inv, pay, err := h.Repo.AddPayment(r.Context(), inv.ID, Payment{Amount: in.Amount, PaidOn: paidOn, Method: strings.TrimSpace(in.Method), Reference: strings.TrimSpace(in.Reference), CreatedBy: &p.MemberID})
+	if err != nil {
+		if errors.Is(err, ErrOverpayment) {
+			httpmw.WriteJSONError(w, http.StatusConflict, "payment exceeds balance due")
+			return
+		}
+		writeResult(w, inv, err, "invoice is not open for payment")
+		return
+	}
+	pay, ok = h.post(w, r, inv, pay, rate)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"invoice": inv, "payment": pay})
+}
+
+// PostPayment handles POST /api/invoices/{id}/payments/{paymentID}/post
+// (admin, treasurer). It retries the ledger posting for a payment whose
+// posting failed; posted payments are returned unchanged.
+func (h Handlers) PostPayment(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.invoice(w, r)
+	if !ok {
+		return
+	}
+	pid, err := strconv.ParseInt(chi.URLParam(r, "paymentID"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid payment id")
+		return
+	}
+	pay, err := h.Repo.GetPayment(r.Context(), inv.ID, int32(pid))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	if pay.LedgerEntryID == nil {
+		rate, ok := h.rate(w, r, inv.Currency, pay.PaidOn)
+		if !ok {
+			return
+		}
+		if pay, ok = h.post(w, r, inv, pay, rate); !ok {
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, pay)
+}
+
+// HTML handles GET /api/invoices/{id}/invoice.html, a printable invoice.
+func (h Handlers) HTML(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.visible(w, r)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, inv, h.Issuer); err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "render failed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// PDF handles GET /api/invoices/{id}/invoice.pdf
+func (h Handlers) PDF(w http.ResponseWriter, r *http.Request) {
+	inv, ok := h.visible(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+inv.Number+`.pdf"`)
+	_, _ = w.Write(RenderPDF(inv, h.Issuer))
+}
+
+// Aging handles GET /api/invoices/aging (admin, treasurer)
+// Query: as_of (YYYY-MM-DD, default today), currency (default the ledger
+// base currency)
+func (h Handlers) Aging(w http.ResponseWriter, r *http.Request) {
+	rep, ok := h.aging(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// AgingCSV handles GET /api/invoices/aging.csv
+func (h Handlers) AgingCSV(w http.ResponseWriter, r *http.Request) {
+	rep, ok := h.aging(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="aging.csv"`)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"bill_to", "member_id", "customer_id", "invoices", "current", "days_1_30", "days_31_60", "days_61_90", "over_90", "total"})
+	row := func(a AgingRow) []string {
+		var mid, cid string
+		if a.MemberID != nil {
+			mid = strconv.FormatInt(*a.MemberID, 10)
+		}
+		if a.CustomerID != nil {
+			cid = strconv.Itoa(int(*a.CustomerID))
+		}
+		return []string{a.BillTo, mid, cid, strconv.Itoa(a.Invoices), money(a.Current), money(a.Days1To30), money(a.Days31To60), money(a.Days61To90), money(a.Over90), money(a.Total)}
+	}
+	for _, a := range rep.Rows {
+		_ = cw.Write(row(a))
+	}
+	_ = cw.Write(row(rep.Totals))
+	cw.Flush()
+}
+
+func (h Handlers) aging(w http.ResponseWriter, r *http.Request) (AgingReport, bool) {
+	asOf, err := httpx.QueryDate(r, "as_of")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid as_of")
+		return AgingReport{}, false
+	}
+	if asOf == nil {
+		t := today()
+		asOf = &t
+	}
+	currency := strings.ToUpper(r.URL.Query().Get("currency"))
+	if currency == "" {
+		currency = ledger.BaseCurrency
+	}
+	if !fx.ValidCurrency(currency) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return AgingReport{}, false
+	}
+	items, err := h.Repo.Outstanding(r.Context(), currency, *asOf)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return AgingReport{}, false
+	}
+	return BuildAging(items, currency, *asOf), true
+}
+
+// ListCustomers handles GET /api/invoices/customers (admin, treasurer)
+func (h Handlers) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListCustomers(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Customer{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// CreateCustomer handles POST /api/invoices/customers (admin, treasurer)
+// Body: {"name":"Riverside Food Bank","email":"ap@example.org","address":"12 Mill St\nSpringfield"}
+func (h Handlers) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	c, ok := readCustomer(w, r)
+	if !ok {
+		return
+	}
+	out, err := h.Repo.CreateCustomer(r.Context(), c)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// GetCustomer handles GET /api/invoices/customers/{id} (admin, treasurer)
+func (h Handlers) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return
+	}
+	c, err := h.Repo.GetCustomer(r.Context(), id)
+	writeCustomer(w, c, err)
+}
+
+// UpdateCustomer handles PUT /api/invoices/customers/{id} (admin, treasurer)
+func (h Handlers) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return
+	}
+	c, ok := readCustomer(w, r)
+	if !ok {
+		return
+	}
+	c.ID = id
+	out, err := h.Repo.UpdateCustomer(r.Context(), c)
+	writeCustomer(w, out, err)
+}
+
+func readCustomer(w http.ResponseWriter, r *http.Request) (Customer, bool) {
+	var c Customer
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return Customer{}, false
+	}
+	c.Name, c.Email, c.Address = strings.TrimSpace(c.Name), strings.TrimSpace(c.Email), strings.TrimSpace(c.Address)
+	if c.Name == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name required")
+		return Customer{}, false
+	}
+	return c, true
+}
+
+func writeCustomer(w http.ResponseWriter, c Customer, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, c)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+	}
+}
+
+// readInvoice decodes and validates a draft. Currency defaults to the
+// ledger base currency, ledger_type to income, issue_date to today and
+// due_date to DefaultTermDays after issue.
+func readInvoice(w http.ResponseWriter, r *http.Request) (Invoice, bool) {
+	var in invoiceInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return Invoice{}, false
+	}
+	if (in.MemberID == nil) == (in.CustomerID == nil) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "exactly one of member_id and customer_id required")
+		return Invoice{}, false
+	}
+	inv := Invoice{MemberID: in.MemberID, CustomerID: in.CustomerID, Notes: strings.TrimSpace(in.Notes)}
+	inv.Currency = strings.ToUpper(strings.TrimSpace(in.Currency))
+	if inv.Currency == "" {
+		inv.Currency = ledger.BaseCurrency
+	}
+	if !fx.ValidCurrency(inv.Currency) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return Invoice{}, false
+	}
+	inv.LedgerType = in.LedgerType
+	if inv.LedgerType == "" {
+		inv.LedgerType = "income"
+	}
+	if !ValidLedgerType(inv.LedgerType) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "ledger_type must be 'dues', 'contribution', or 'income'")
+		return Invoice{}, false
+	}
+	issue, err1 := httpx.ParseDate(in.IssueDate)
+	due, err2 := httpx.ParseDate(in.DueDate)
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return Invoice{}, false
+	}
+	inv.IssueDate = today()
+	if issue != nil {
+		inv.IssueDate = *issue
+	}
+	inv.DueDate = inv.IssueDate.AddDate(0, 0, DefaultTermDays)
+	if due != nil {
+		inv.DueDate = *due
+	}
+	if inv.DueDate.Before(inv.IssueDate) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "due_date must not be before issue_date")
+		return Invoice{}, false
+	}
+	if len(in.Lines) == 0 || len(in.Lines) > maxLines {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "between 1 and 200 lines required")
+		return Invoice{}, false
+	}
+	for i, l := range in.Lines {
+		l.Description = strings.TrimSpace(l.Description)
+		if l.Description == "" || l.Quantity <= 0 || math.IsInf(l.Quantity, 0) || math.IsNaN(l.UnitPrice) || math.IsInf(l.UnitPrice, 0) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "line "+strconv.Itoa(i+1)+": description, positive quantity and unit_price required")
+			return Invoice{}, false
+		}
+		in.Lines[i] = l
+	}
+	inv.Lines = in.Lines
+	if inv.Total = Totals(inv.Lines); inv.Total <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "total must be positive")
+		return Invoice{}, false
+	}
+	return inv, true
+}
+
+// post creates the ledger entry for a payment. The idempotency key makes
+// retries return the original entry, with or without a member.
+func (h Handlers) post(w http.ResponseWriter, r *http.Request, inv Invoice, pay Payment, rate float64) (Payment, bool) {
+	var mid *int32
+	if inv.MemberID != nil {
+		m := int32(*inv.MemberID)
+		mid = &m
+	}
+	notes := "Invoice " + inv.Number + " payment #" + strconv.Itoa(int(pay.ID))
+	if pay.Method != "" {
+		notes += " via " + pay.Method
+	}
+	if pay.Reference != "" {
+		notes += " (" + pay.Reference + ")"
+	}
+	entry, _, err := h.Ledger.CreateInCurrency(r.Context(), inv.LedgerType, "Payment for "+inv.Number+" from "+inv.BillTo, pay.Amount, inv.Currency, rate, mid, notes, "invoice-payment:"+strconv.Itoa(int(pay.ID)))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "payment recorded but ledger post failed; retry with POST /api/invoices/"+strconv.Itoa(int(inv.ID))+"/payments/"+strconv.Itoa(int(pay.ID))+"/post")
+		return Payment{}, false
+	}
+	out, err := h.Repo.SetPaymentLedgerEntry(r.Context(), pay.ID, entry.ID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+		return Payment{}, false
+	}
+	return out, true
+}
+
+// rate returns the rate converting currency into the ledger base currency
+// on a date, writing the error response when there is none.
+func (h Handlers) rate(w http.ResponseWriter, r *http.Request, currency string, on time.Time) (float64, bool) {
+	if currency == ledger.BaseCurrency {
+		return 1, true
+	}
+	if h.Rates == nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "only "+ledger.BaseCurrency+" payments are accepted")
+		return 0, false
+	}
+	rate, err := h.Rates.Lookup(r.Context(), currency, on)
+	if err != nil {
+		if errors.Is(err, fx.ErrNoRate) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "no exchange rate for "+currency)
+			return 0, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "rate lookup failed")
+		return 0, false
+	}
+	return rate.Rate, true
+}
+
+// visible loads an invoice the caller may read: billers see every invoice,
+// members their own issued ones. Others get 404 so drafts stay hidden.
+func (h Handlers) visible(w http.ResponseWriter, r *http.Request) (Invoice, bool) {
+	inv, ok := h.invoice(w, r)
+	if !ok {
+		return Invoice{}, false
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if isBiller(p) {
+		return inv, true
+	}
+	if inv.MemberID == nil || *inv.MemberID != p.MemberID || inv.Status == StatusDraft {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+		return Invoice{}, false
+	}
+	return inv, true
+}
+
+func (h Handlers) invoice(w http.ResponseWriter, r *http.Request) (Invoice, bool) {
+	id, ok := invoiceID(w, r)
+	if !ok {
+		return Invoice{}, false
+	}
+	inv, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Invoice{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return Invoice{}, false
+	}
+	return inv, true
+}
+
+func writeResult(w http.ResponseWriter, inv Invoice, err error, conflict string) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, inv)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrNoParty):
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member or customer not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, conflict)
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+	}
+}
+
+func invoiceID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
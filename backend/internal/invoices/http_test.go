@@ -0,0 +1,462 @@
+package invoices
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	invoices  []Invoice
+	customers []Customer
+	payments  []Payment
+	members   map[int64]string
+}
+
+func (m *mockRepo) ListCustomers(_ context.Context) ([]Customer, error) {
+	return m.customers, nil
+}
+
+func (m *mockRepo) GetCustomer(_ context.Context, id int32) (Customer, error) {
+	for _, c := range m.customers {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return Customer{}, ErrNotFound
+}
+
+func (m *mockRepo) CreateCustomer(_ context.Context, c Customer) (Customer, error) {
+	c.ID = int32(len(m.customers) + 1)
+	m.customers = append(m.customers, c)
+	return c, nil
+}
+
+func (m *mockRepo) UpdateCustomer(_ context.Context, c Customer) (Customer, error) {
+	for i := range m.customers {
+		if m.customers[i].ID == c.ID {
+			m.customers[i] = c
+			return c, nil
+		}
+	}
+	return Customer{}, ErrNotFound
+}
+
+func (m *mockRepo) List(_ context.Context, f ListFilters) ([]Invoice, error) {
+	var out []Invoice
+	for _, inv := range m.invoices {
+		if f.MemberID != nil && (inv.MemberID == nil || *inv.MemberID != *f.MemberID) {
+			continue
+		}
+		if (f.Status != "" && inv.Status != f.Status) || (f.Issued && inv.Status == StatusDraft) || (f.Overdue && !inv.Overdue(today())) {
+			continue
+		}
+		out = append(out, inv)
+	}
+	return out, nil
+}
+
+func (m *mockRepo) find(id int32) (*Invoice, error) {
+	for i := range m.invoices {
+		if m.invoices[i].ID == id {
+			return &m.invoices[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *mockRepo) Get(_ context.Context, id int32) (Invoice, error) {
+	inv, err := m.find(id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	out := *inv
+	out.Payments = []Payment{}
+	for _, p := range m.payments {
+		if p.InvoiceID == id {
+			out.Payments = append(out.Payments, p)
+		}
+	}
+	return out, nil
+}
+
+// resolve fills in the billed party the way the SQL joins do.
+func (m *mockRepo) resolve(inv *Invoice) error {
+	if inv.MemberID != nil {
+		name, ok := m.members[*inv.MemberID]
+		if !ok {
+			return ErrNoParty
+		}
+		inv.BillTo = name
+		return nil
+	}
+	c, err := m.GetCustomer(context.Background(), *inv.CustomerID)
+	if err != nil {
+		return ErrNoParty
+	}
+	inv.BillTo, inv.BillToEmail, inv.BillToAddr = c.Name, c.Email, c.Address
+	return nil
+}
+
+func (m *mockRepo) Create(_ context.Context, inv Invoice) (Invoice, error) {
+	if err := m.resolve(&inv); err != nil {
+		return Invoice{}, err
+	}
+	inv.ID = int32(len(m.invoices) + 1)
+	inv.Number = FormatNumber(inv.ID)
+	inv.Status = StatusDraft
+	inv.Total = Totals(inv.Lines)
+	inv.Balance = inv.Total
+	m.invoices = append(m.invoices, inv)
+	return inv, nil
+}
+
+func (m *mockRepo) Update(_ context.Context, in Invoice) (Invoice, error) {
+	inv, err := m.find(in.ID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if inv.Status != StatusDraft {
+		return Invoice{}, ErrConflict
+	}
+	if err := m.resolve(&in); err != nil {
+		return Invoice{}, err
+	}
+	in.Number, in.Status, in.CreatedBy = inv.Number, inv.Status, inv.CreatedBy
+	in.Total = Totals(in.Lines)
+	in.Balance = in.Total
+	*inv = in
+	return in, nil
+}
+
+func (m *mockRepo) Send(ctx context.Context, id int32) (Invoice, error) {
+	inv, err := m.find(id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if inv.Status != StatusDraft {
+		return Invoice{}, ErrConflict
+	}
+	now := time.Now()
+	inv.Status, inv.SentAt = StatusSent, &now
+	return m.Get(ctx, id)
+}
+
+func (m *mockRepo) Void(ctx context.Context, id int32, reason string) (Invoice, error) {
+	inv, err := m.find(id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if (inv.Status != StatusDraft && inv.Status != StatusSent) || inv.AmountPaid != 0 {
+		return Invoice{}, ErrConflict
+	}
+	inv.Status, inv.VoidReason = StatusVoid, reason
+	return m.Get(ctx, id)
+}
+
+func (m *mockRepo) AddPayment(ctx context.Context, id int32, p Payment) (Invoice, Payment, error) {
+	inv, err := m.find(id)
+	if err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	if !Open(inv.Status) {
+		return Invoice{}, Payment{}, ErrConflict
+	}
+	if p.Amount > inv.Balance {
+		return Invoice{}, Payment{}, ErrOverpayment
+	}
+	p.ID, p.InvoiceID = int32(len(m.payments)+1), id
+	m.payments = append(m.payments, p)
+	inv.AmountPaid = round2(inv.AmountPaid + p.Amount)
+	inv.Balance = round2(inv.Total - inv.AmountPaid)
+	inv.Status = StatusPartiallyPaid
+	if inv.Balance == 0 {
+		inv.Status = StatusPaid
+	}
+	out, _ := m.Get(ctx, id)
+	return out, p, nil
+}
+
+func (m *mockRepo) GetPayment(_ context.Context, invoiceID, paymentID int32) (Payment, error) {
+	for _, p := range m.payments {
+		if p.ID == paymentID && p.InvoiceID == invoiceID {
+			return p, nil
+		}
+	}
+	return Payment{}, ErrNotFound
+}
+
+func (m *mockRepo) SetPaymentLedgerEntry(_ context.Context, paymentID, entryID int32) (Payment, error) {
+	for i := range m.payments {
+		if m.payments[i].ID == paymentID {
+			m.payments[i].LedgerEntryID = &entryID
+			return m.payments[i], nil
+		}
+	}
+	return Payment{}, ErrNotFound
+}
+
+func (m *mockRepo) Outstanding(_ context.Context, currency string, asOf time.Time) ([]Invoice, error) {
+	var out []Invoice
+	for _, inv := range m.invoices {
+		if inv.Currency == currency && inv.Status != StatusDraft && inv.Status != StatusVoid && inv.Balance > 0 && !inv.IssueDate.After(asOf) {
+			out = append(out, inv)
+		}
+	}
+	return out, nil
+}
+
+type mockLedger struct {
+	entries []ledger.LedgerEntry
+	fail    bool
+}
+
+func (m *mockLedger) CreateInCurrency(_ context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, key string) (ledger.LedgerEntry, bool, error) {
+	if m.fail {
+		return ledger.LedgerEntry{}, false, errors.New("ledger down")
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 1), Type: entryType, Description: description, Amount: amount, Currency: currency, FxRate: rate, BaseAmount: round2(amount * rate), MemberID: memberID, Notes: notes}
+	m.entries = append(m.entries, e)
+	return e, false, nil
+}
+
+type mockRates map[string]float64
+
+func (m mockRates) Lookup(_ context.Context, currency string, on time.Time) (fx.Rate, error) {
+	rate, ok := m[currency]
+	if !ok {
+		return fx.Rate{}, fx.ErrNoRate
+	}
+	return fx.Rate{Currency: currency, Date: on, Rate: rate}, nil
+}
+
+// ---- Helper functions ----
+
+// Member 1 is an admin, 2 a treasurer, 3 and 4 plain members.
+func setupRouter(h Handlers) *chi.Mux {
+	roles := map[int64]string{1: "admin", 2: "treasurer", 3: "member", 4: "member"}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		return httpmw.Principal{MemberID: id, Role: role}, ok, nil
+	}))
+	Mount(r, h)
+	return r
+}
+
+func do(r http.Handler, user, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", user)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestHandlers_InvoiceLifecycle(t *testing.T) {
+	repo := &mockRepo{members: map[int64]string{3: "Ada", 4: "Ben"}}
+	led := &mockLedger{}
+	r := setupRouter(Handlers{Repo: repo, Ledger: led, Issuer: Issuer{Name: "Maple Housing Co-op", Address: "1 Elm St\nSpringfield"}})
+
+	if rr := do(r, "3", "POST", "/invoices", `{"member_id":3,"lines":[{"description":"Rent","quantity":1,"unit_price":650}]}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member create, got %d", rr.Code)
+	}
+	rr := do(r, "2", "POST", "/invoices", `{"member_id":3,"issue_date":"2025-05-01","ledger_type":"dues",
+		"lines":[{"description":"May rent","quantity":1,"unit_price":650},{"description":"Parking","quantity":2,"unit_price":25.5}]}`)
+	var inv Invoice
+	_ = json.Unmarshal(rr.Body.Bytes(), &inv)
+	if rr.Code != http.StatusCreated || inv.Status != StatusDraft || inv.Total != 701 || inv.Number != "INV-000001" || inv.Currency != ledger.BaseCurrency {
+		t.Fatalf("unexpected create: %d %s", rr.Code, rr.Body.String())
+	}
+	if inv.DueDate.Format("2006-01-02") != "2025-05-31" {
+		t.Fatalf("expected net-30 due date, got %s", inv.DueDate)
+	}
+
+	// Drafts stay hidden from the billed member.
+	if rr := do(r, "3", "GET", "/invoices/1", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for draft, got %d", rr.Code)
+	}
+	if rr := do(r, "3", "GET", "/invoices", ""); strings.TrimSpace(rr.Body.String()) != "[]" {
+		t.Fatalf("expected no visible invoices, got %s", rr.Body.String())
+	}
+	if rr := do(r, "2", "POST", "/invoices/1/payments", `{"amount":10}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 paying a draft, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "PUT", "/invoices/1", `{"member_id":3,"issue_date":"2025-05-01","due_date":"2025-05-15","ledger_type":"dues","lines":[{"description":"May rent","quantity":1,"unit_price":700}]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected draft update, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "2", "POST", "/invoices/1/send", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected send, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "PUT", "/invoices/1", `{"member_id":3,"lines":[{"description":"x","quantity":1,"unit_price":1}]}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 editing a sent invoice, got %d", rr.Code)
+	}
+	if rr := do(r, "3", "GET", "/invoices/1", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected member to see sent invoice, got %d", rr.Code)
+	}
+	if rr := do(r, "4", "GET", "/invoices/1", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another member, got %d", rr.Code)
+	}
+
+	rr = do(r, "2", "POST", "/invoices/1/payments", `{"amount":300,"paid_on":"2025-05-10","method":"transfer","reference":"TX-1"}`)
+	var out struct {
+		Invoice Invoice
+		Payment Payment
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	if rr.Code != http.StatusCreated || out.Invoice.Status != StatusPartiallyPaid || out.Invoice.Balance != 400 || out.Payment.LedgerEntryID == nil {
+		t.Fatalf("unexpected payment: %d %s", rr.Code, rr.Body.String())
+	}
+	e := led.entries[0]
+	if e.Type != "dues" || e.Amount != 300 || e.MemberID == nil || *e.MemberID != 3 || !strings.Contains(e.Notes, "INV-000001") {
+		t.Fatalf("unexpected ledger entry: %+v", e)
+	}
+	if rr := do(r, "2", "POST", "/invoices/1/payments", `{"amount":400.01}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for overpayment, got %d", rr.Code)
+	}
+	if rr := do(r, "2", "POST", "/invoices/1/void", ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 voiding a part-paid invoice, got %d", rr.Code)
+	}
+	rr = do(r, "2", "POST", "/invoices/1/payments", `{"amount":400}`)
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	if out.Invoice.Status != StatusPaid || out.Invoice.Balance != 0 || len(out.Invoice.Payments) != 2 {
+		t.Fatalf("expected paid invoice: %s", rr.Body.String())
+	}
+
+	rr = do(r, "3", "GET", "/invoices/1/invoice.html", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "INV-000001") || !strings.Contains(rr.Body.String(), "Maple Housing Co-op") || !strings.Contains(rr.Body.String(), "700.00") {
+		t.Fatalf("unexpected html: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(r, "3", "GET", "/invoices/1/invoice.pdf", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/pdf" || !strings.HasPrefix(rr.Body.String(), "%PDF-1.4") || !strings.Contains(rr.Body.String(), "(Invoice INV-000001)") {
+		t.Fatalf("unexpected pdf: %d %.80s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandlers_CreateValidation(t *testing.T) {
+	repo := &mockRepo{members: map[int64]string{3: "Ada"}}
+	r := setupRouter(Handlers{Repo: repo, Ledger: &mockLedger{}})
+	for name, body := range map[string]string{
+		"no party":       `{"lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+		"both parties":   `{"member_id":3,"customer_id":1,"lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+		"no lines":       `{"member_id":3,"lines":[]}`,
+		"zero quantity":  `{"member_id":3,"lines":[{"description":"x","quantity":0,"unit_price":1}]}`,
+		"negative total": `{"member_id":3,"lines":[{"description":"Credit","quantity":1,"unit_price":-5}]}`,
+		"due before":     `{"member_id":3,"issue_date":"2025-05-01","due_date":"2025-04-01","lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+		"ledger type":    `{"member_id":3,"ledger_type":"expense","lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+		"unknown member": `{"member_id":9,"lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+		"currency":       `{"member_id":3,"currency":"dollars","lines":[{"description":"x","quantity":1,"unit_price":1}]}`,
+	} {
+		if rr := do(r, "1", "POST", "/invoices", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d %s", name, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestHandlers_CustomerForeignCurrencyPayment(t *testing.T) {
+	repo := &mockRepo{}
+	led := &mockLedger{}
+	rates := mockRates{}
+	r := setupRouter(Handlers{Repo: repo, Ledger: led, Rates: rates})
+
+	rr := do(r, "1", "POST", "/invoices/customers", `{"name":"Riverside Food Bank","email":"ap@example.org"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected customer, got %d", rr.Code)
+	}
+	rr = do(r, "1", "POST", "/invoices", `{"customer_id":1,"currency":"cad","lines":[{"description":"Catering","quantity":4,"unit_price":50}]}`)
+	var inv Invoice
+	_ = json.Unmarshal(rr.Body.Bytes(), &inv)
+	if rr.Code != http.StatusCreated || inv.Currency != "CAD" || inv.BillTo != "Riverside Food Bank" {
+		t.Fatalf("unexpected create: %d %s", rr.Code, rr.Body.String())
+	}
+	do(r, "1", "POST", "/invoices/1/send", "")
+
+	if rr := do(r, "1", "POST", "/invoices/1/payments", `{"amount":200}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a CAD rate, got %d", rr.Code)
+	}
+	if len(repo.payments) != 0 {
+		t.Fatalf("payment recorded without a rate")
+	}
+
+	rates["CAD"] = 0.73
+	led.fail = true
+	if rr := do(r, "1", "POST", "/invoices/1/payments", `{"amount":200}`); rr.Code != http.StatusInternalServerError || !strings.Contains(rr.Body.String(), "/invoices/1/payments/1/post") {
+		t.Fatalf("expected retry hint, got %d %s", rr.Code, rr.Body.String())
+	}
+	led.fail = false
+	rr = do(r, "1", "POST", "/invoices/1/payments/1/post", "")
+	var pay Payment
+	_ = json.Unmarshal(rr.Body.Bytes(), &pay)
+	if rr.Code != http.StatusOK || pay.LedgerEntryID == nil {
+		t.Fatalf("unexpected retry: %d %s", rr.Code, rr.Body.String())
+	}
+	e := led.entries[0]
+	if e.Currency != "CAD" || e.FxRate != 0.73 || e.BaseAmount != 146 || e.MemberID != nil || e.Type != "income" {
+		t.Fatalf("unexpected ledger entry: %+v", e)
+	}
+	if rr := do(r, "1", "POST", "/invoices/1/payments/1/post", ""); rr.Code != http.StatusOK || len(led.entries) != 1 {
+		t.Fatalf("expected posted payment to be returned unchanged, got %d with %d entries", rr.Code, len(led.entries))
+	}
+}
+
+func TestBuildAging(t *testing.T) {
+	asOf := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	m3, m4 := int64(3), int64(4)
+	c1 := int32(1)
+	inv := func(member *int64, customer *int32, name string, due time.Time, balance float64) Invoice {
+		return Invoice{MemberID: member, CustomerID: customer, BillTo: name, Status: StatusSent, DueDate: due, Balance: balance}
+	}
+	rep := BuildAging([]Invoice{
+		inv(&m3, nil, "Ada", asOf.AddDate(0, 0, 5), 100),         // current
+		inv(&m3, nil, "Ada", asOf.AddDate(0, 0, -30), 50),        // 1-30
+		inv(&m4, nil, "Ben", asOf.AddDate(0, 0, -31), 20),        // 31-60
+		inv(nil, &c1, "Food Bank", asOf.AddDate(0, 0, -75), 300), // 61-90
+		inv(nil, &c1, "Food Bank", asOf.AddDate(0, 0, -200), 10), // over 90
+		inv(&m4, nil, "Ben", asOf, 0),                            // settled
+	}, "USD", asOf)
+	if len(rep.Rows) != 3 || rep.Rows[0].BillTo != "Food Bank" || rep.Rows[0].Days61To90 != 300 || rep.Rows[0].Over90 != 10 || rep.Rows[0].Invoices != 2 {
+		t.Fatalf("unexpected rows: %+v", rep.Rows)
+	}
+	if rep.Rows[1].BillTo != "Ada" || rep.Rows[1].Current != 100 || rep.Rows[1].Days1To30 != 50 {
+		t.Fatalf("unexpected Ada row: %+v", rep.Rows[1])
+	}
+	tot := rep.Totals
+	if tot.Total != 480 || tot.Current != 100 || tot.Days1To30 != 50 || tot.Days31To60 != 20 || tot.Days61To90 != 300 || tot.Over90 != 10 || tot.Invoices != 5 {
+		t.Fatalf("unexpected totals: %+v", tot)
+	}
+}
+
+func TestHandlers_Aging(t *testing.T) {
+	m3 := int64(3)
+	repo := &mockRepo{invoices: []Invoice{
+		{ID: 1, MemberID: &m3, BillTo: "Ada", Status: StatusSent, Currency: "USD", DueDate: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), Balance: 80},
+	}}
+	r := setupRouter(Handlers{Repo: repo})
+	if rr := do(r, "3", "GET", "/invoices/aging", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member, got %d", rr.Code)
+	}
+	rr := do(r, "2", "GET", "/invoices/aging?as_of=2025-03-01&currency=USD", "")
+	var rep AgingReport
+	_ = json.Unmarshal(rr.Body.Bytes(), &rep)
+	if rr.Code != http.StatusOK || len(rep.Rows) != 1 || rep.Rows[0].Days31To60 != 80 {
+		t.Fatalf("unexpected aging: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(r, "2", "GET", "/invoices/aging.csv?as_of=2025-03-01", "")
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if len(lines) != 3 || lines[1] != "Ada,3,,1,0.00,0.00,80.00,0.00,0.00,80.00" || !strings.HasPrefix(lines[2], "Total,") {
+		t.Fatalf("unexpected csv: %q", lines)
+	}
+}
@@ -0,0 +1,63 @@
+-- backend/internal/invoices/migrations/0001_init.sql
+-- Customers are billed parties outside the membership.
+CREATE TABLE IF NOT EXISTS invoice_customers (
+  id SERIAL PRIMARY KEY,
+  name TEXT NOT NULL CHECK (name <> ''),
+  email TEXT NOT NULL DEFAULT '',
+  address TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- An invoice bills exactly one member or one customer. total and
+-- amount_paid are maintained with the lines and payments.
+CREATE TABLE IF NOT EXISTS invoices (
+  id SERIAL PRIMARY KEY,
+  member_id BIGINT REFERENCES members(id) ON DELETE RESTRICT,
+  customer_id INTEGER REFERENCES invoice_customers(id) ON DELETE RESTRICT,
+  status TEXT NOT NULL DEFAULT 'draft'
+    CHECK (status IN ('draft','sent','partially_paid','paid','void')),
+  currency TEXT NOT NULL CHECK (currency ~ '^[A-Z]{3}$'),
+  ledger_type TEXT NOT NULL DEFAULT 'income' CHECK (ledger_type IN ('dues','contribution','income')),
+  issue_date DATE NOT NULL,
+  due_date DATE NOT NULL,
+  notes TEXT NOT NULL DEFAULT '',
+  total DECIMAL(12,2) NOT NULL DEFAULT 0,
+  amount_paid DECIMAL(12,2) NOT NULL DEFAULT 0,
+  sent_at TIMESTAMPTZ,
+  voided_at TIMESTAMPTZ,
+  void_reason TEXT NOT NULL DEFAULT '',
+  created_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  CHECK ((member_id IS NULL) <> (customer_id IS NULL)),
+  CHECK (due_date >= issue_date),
+  CHECK (amount_paid >= 0 AND amount_paid <= total)
+);
+CREATE INDEX IF NOT EXISTS invoices_member_idx ON invoices(member_id);
+CREATE INDEX IF NOT EXISTS invoices_customer_idx ON invoices(customer_id);
+CREATE INDEX IF NOT EXISTS invoices_status_due_idx ON invoices(status, due_date);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+  id SERIAL PRIMARY KEY,
+  invoice_id INTEGER NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  description TEXT NOT NULL CHECK (description <> ''),
+  quantity NUMERIC(12,2) NOT NULL CHECK (quantity > 0),
+  unit_price DECIMAL(12,2) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  UNIQUE (invoice_id, position)
+);
+
+-- Each payment is posted to the ledger on its own; ledger_entry_id is set
+-- once posted.
+CREATE TABLE IF NOT EXISTS invoice_payments (
+  id SERIAL PRIMARY KEY,
+  invoice_id INTEGER NOT NULL REFERENCES invoices(id) ON DELETE RESTRICT,
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  paid_on DATE NOT NULL,
+  method TEXT NOT NULL DEFAULT '',
+  reference TEXT NOT NULL DEFAULT '',
+  ledger_entry_id INTEGER REFERENCES ledger_entries(id),
+  created_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS invoice_payments_invoice_idx ON invoice_payments(invoice_id);
@@ -0,0 +1,144 @@
+package invoices
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Invoice statuses. A draft is editable; sending freezes it. Payments move
+// a sent invoice to partially_paid and then paid. Unpaid invoices may be
+// voided.
+const (
+	StatusDraft         = "draft"
+	StatusSent          = "sent"
+	StatusPartiallyPaid = "partially_paid"
+	StatusPaid          = "paid"
+	StatusVoid          = "void"
+)
+
+// ValidStatus reports whether s is a known invoice status.
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusDraft, StatusSent, StatusPartiallyPaid, StatusPaid, StatusVoid:
+		return true
+	}
+	return false
+}
+
+// Open reports whether an invoice in status s is awaiting payment.
+func Open(s string) bool {
+	return s == StatusSent || s == StatusPartiallyPaid
+}
+
+// LedgerTypes are the ledger entry types invoice payments may post as.
+var LedgerTypes = []string{"dues", "contribution", "income"}
+
+// ValidLedgerType reports whether t is one of LedgerTypes.
+func ValidLedgerType(t string) bool {
+	for _, v := range LedgerTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultTermDays is the gap between issue and due date when no due date is
+// given.
+const DefaultTermDays = 30
+
+// Customer is a billed party outside the membership.
+type Customer struct {
+	ID        int32     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Line is one item on an invoice. Amount is Quantity times UnitPrice.
+type Line struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+// Payment is money received against an invoice.
+type Payment struct {
+	ID            int32     `json:"id"`
+	InvoiceID     int32     `json:"invoice_id"`
+	Amount        float64   `json:"amount"`
+	PaidOn        time.Time `json:"paid_on"`
+	Method        string    `json:"method"`
+	Reference     string    `json:"reference"`
+	LedgerEntryID *int32    `json:"ledger_entry_id"`
+	CreatedBy     *int64    `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Invoice bills either a member or a customer. BillTo and BillToEmail are
+// resolved from whichever is set. Lines and Payments are only loaded for a
+// single invoice.
+type Invoice struct {
+	ID          int32      `json:"id"`
+	Number      string     `json:"number"`
+	MemberID    *int64     `json:"member_id"`
+	CustomerID  *int32     `json:"customer_id"`
+	BillTo      string     `json:"bill_to"`
+	BillToEmail string     `json:"bill_to_email"`
+	BillToAddr  string     `json:"bill_to_address"`
+	Status      string     `json:"status"`
+	Currency    string     `json:"currency"`
+	LedgerType  string     `json:"ledger_type"`
+	IssueDate   time.Time  `json:"issue_date"`
+	DueDate     time.Time  `json:"due_date"`
+	Notes       string     `json:"notes"`
+	Total       float64    `json:"total"`
+	AmountPaid  float64    `json:"amount_paid"`
+	Balance     float64    `json:"balance"`
+	SentAt      *time.Time `json:"sent_at"`
+	VoidedAt    *time.Time `json:"voided_at"`
+	VoidReason  string     `json:"void_reason"`
+	CreatedBy   *int64     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Lines       []Line     `json:"lines,omitempty"`
+	Payments    []Payment  `json:"payments,omitempty"`
+}
+
+// Overdue reports whether the invoice is open and past due on asOf.
+func (inv Invoice) Overdue(asOf time.Time) bool {
+	return Open(inv.Status) && inv.DueDate.Before(asOf)
+}
+
+// FormatNumber is the printed invoice number for id.
+func FormatNumber(id int32) string {
+	return fmt.Sprintf("INV-%06d", id)
+}
+
+// Totals fills in each line's amount and returns the invoice total.
+func Totals(lines []Line) float64 {
+	var total float64
+	for i := range lines {
+		lines[i].Amount = round2(lines[i].Quantity * lines[i].UnitPrice)
+		total += lines[i].Amount
+	}
+	return round2(total)
+}
+
+// ListFilters holds optional constraints for listing invoices. Overdue
+// selects open invoices due before today; Issued leaves out drafts.
+type ListFilters struct {
+	MemberID   *int64
+	CustomerID *int32
+	Status     string
+	Overdue    bool
+	Issued     bool
+	Limit      int
+	Offset     int
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,232 @@
+package invoices
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Issuer is the co-op's name and address printed on invoices.
+type Issuer struct {
+	Name    string
+	Address string
+	Email   string
+}
+
+var htmlTmpl = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": money,
+	"date":  func(t interface{ Format(string) string }) string { return t.Format("2006-01-02") },
+	"lines": func(s string) []string { return strings.Split(strings.TrimSpace(s), "\n") },
+	"qty":   func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) },
+	"title": func(s string) string { return strings.ReplaceAll(s, "_", " ") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Inv.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222; max-width: 800px; margin: 2em auto; }
+h1 { font-size: 28px; margin: 0 0 .5em; }
+.parties { display: flex; justify-content: space-between; margin-bottom: 2em; }
+.status { text-transform: uppercase; font-weight: bold; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 6px 4px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; }
+tfoot td { font-weight: bold; border-bottom: none; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Inv.Number}}</h1>
+<div class="parties">
+<div>
+<strong>{{.Issuer.Name}}</strong><br>
+{{range lines .Issuer.Address}}{{.}}<br>{{end}}{{.Issuer.Email}}
+</div>
+<div>
+Bill to:<br>
+<strong>{{.Inv.BillTo}}</strong><br>
+{{range lines .Inv.BillToAddr}}{{.}}<br>{{end}}{{.Inv.BillToEmail}}
+</div>
+<div>
+Issued: {{date .Inv.IssueDate}}<br>
+Due: {{date .Inv.DueDate}}<br>
+Status: <span class="status">{{title .Inv.Status}}</span>
+</div>
+</div>
+<table>
+<thead><tr><th>Description</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Amount</th></tr></thead>
+<tbody>
+{{range .Inv.Lines}}<tr><td>{{.Description}}</td><td class="num">{{qty .Quantity}}</td><td class="num">{{money .UnitPrice}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot>
+<tr><td colspan="3" class="num">Total ({{.Inv.Currency}})</td><td class="num">{{money .Inv.Total}}</td></tr>
+{{if .Inv.AmountPaid}}<tr><td colspan="3" class="num">Paid</td><td class="num">{{money .Inv.AmountPaid}}</td></tr>
+{{end}}<tr><td colspan="3" class="num">Balance due</td><td class="num">{{money .Inv.Balance}}</td></tr>
+</tfoot>
+</table>
+{{if .Inv.Notes}}<p>{{.Inv.Notes}}</p>{{end}}
+</body>
+</html>
+`))
+
+// RenderHTML writes a printable HTML invoice.
+func RenderHTML(w io.Writer, inv Invoice, issuer Issuer) error {
+	return htmlTmpl.Execute(w, struct {
+		Inv    Invoice
+		Issuer Issuer
+	}{inv, issuer})
+}
+
+// RenderPDF returns the invoice as a PDF using the standard Helvetica and
+// Courier fonts, so no font files are embedded.
+func RenderPDF(inv Invoice, issuer Issuer) []byte {
+	d := &pdfDoc{}
+	d.newPage()
+	d.text("Helvetica-Bold", 20, "Invoice "+inv.Number)
+	d.gap(8)
+	d.text("Helvetica-Bold", 11, issuer.Name)
+	for _, l := range strings.Split(strings.TrimSpace(issuer.Address), "\n") {
+		d.text("Helvetica", 10, l)
+	}
+	d.text("Helvetica", 10, issuer.Email)
+	d.gap(10)
+	d.text("Helvetica", 10, "Bill to:")
+	d.text("Helvetica-Bold", 11, inv.BillTo)
+	for _, l := range strings.Split(strings.TrimSpace(inv.BillToAddr), "\n") {
+		d.text("Helvetica", 10, l)
+	}
+	d.text("Helvetica", 10, inv.BillToEmail)
+	d.gap(10)
+	d.text("Helvetica", 10, "Issued: "+inv.IssueDate.Format("2006-01-02")+"    Due: "+inv.DueDate.Format("2006-01-02")+"    Status: "+strings.ToUpper(strings.ReplaceAll(inv.Status, "_", " ")))
+	d.gap(14)
+	row := func(desc, qty, price, amount string) string {
+		if r := []rune(desc); len(r) > 44 {
+			desc = string(r[:43]) + "~"
+		}
+		return fmt.Sprintf("%-44s %8s %12s %12s", desc, qty, price, amount)
+	}
+	d.text("Courier-Bold", 9, row("Description", "Qty", "Unit price", "Amount"))
+	for _, l := range inv.Lines {
+		d.text("Courier", 9, row(l.Description, strconv.FormatFloat(l.Quantity, 'f', -1, 64), money(l.UnitPrice), money(l.Amount)))
+	}
+	d.gap(6)
+	d.text("Courier-Bold", 9, row("", "", "Total "+inv.Currency, money(inv.Total)))
+	if inv.AmountPaid != 0 {
+		d.text("Courier", 9, row("", "", "Paid", money(inv.AmountPaid)))
+	}
+	d.text("Courier-Bold", 9, row("", "", "Balance due", money(inv.Balance)))
+	if inv.Notes != "" {
+		d.gap(14)
+		for _, l := range strings.Split(inv.Notes, "\n") {
+			d.text("Helvetica", 10, l)
+		}
+	}
+	return d.bytes()
+}
+
+func money(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// pdfDoc lays out left-aligned lines of text top to bottom on US Letter
+// pages, starting a new page when one fills up.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+var pdfFonts = []string{"Helvetica", "Helvetica-Bold", "Courier", "Courier-Bold"}
+
+const (
+	pdfWidth, pdfHeight = 612, 792
+	pdfMargin           = 50
+)
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfHeight - pdfMargin
+}
+
+func (d *pdfDoc) gap(h float64) {
+	d.y -= h
+}
+
+func (d *pdfDoc) text(font string, size float64, s string) {
+	lead := size * 1.4
+	if d.y-lead < pdfMargin {
+		d.newPage()
+	}
+	d.y -= lead
+	if s == "" {
+		return
+	}
+	fi := 0
+	for i, f := range pdfFonts {
+		if f == font {
+			fi = i
+		}
+	}
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /F%d %g Tf %d %.2f Td (%s) Tj ET\n", fi+1, size, pdfMargin, d.y, pdfEscape(s))
+}
+
+// pdfEscape escapes a PDF string literal. Characters outside Latin-1 are
+// replaced since the standard fonts use WinAnsiEncoding.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (d *pdfDoc) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+	// Objects: 1 catalog, 2 page tree, fonts, then a page and its content
+	// stream for each page.
+	firstPage := 3 + len(pdfFonts)
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	fonts := make([]string, len(pdfFonts))
+	for i, f := range pdfFonts {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f))
+		fonts[i] = fmt.Sprintf("/F%d %d 0 R", i+1, 3+i)
+	}
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, strings.Join(fonts, " "), firstPage+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
@@ -0,0 +1,444 @@
+package invoices
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound = errors.New("invoice not found")
+	ErrConflict = errors.New("invalid state transition")
+	// ErrOverpayment is returned by AddPayment when the amount exceeds the
+	// balance due.
+	ErrOverpayment = errors.New("payment exceeds balance")
+	// ErrNoParty is returned when the billed member or customer does not
+	// exist.
+	ErrNoParty = errors.New("member or customer not found")
+)
+
+type Repo interface {
+	ListCustomers(ctx context.Context) ([]Customer, error)
+	GetCustomer(ctx context.Context, id int32) (Customer, error)
+	CreateCustomer(ctx context.Context, c Customer) (Customer, error)
+	UpdateCustomer(ctx context.Context, c Customer) (Customer, error)
+
+	List(ctx context.Context, f ListFilters) ([]Invoice, error)
+	// Get returns the invoice with its lines and payments.
+	Get(ctx context.Context, id int32) (Invoice, error)
+	// Create inserts a draft with its lines; the total is computed from them.
+	Create(ctx context.Context, inv Invoice) (Invoice, error)
+	// Update replaces a draft's terms and lines; ErrConflict once sent.
+	Update(ctx context.Context, inv Invoice) (Invoice, error)
+	// Send moves a draft to sent.
+	Send(ctx context.Context, id int32) (Invoice, error)
+	// Void cancels a draft or an unpaid sent invoice.
+	Void(ctx context.Context, id int32, reason string) (Invoice, error)
+	// AddPayment records a payment on an open invoice and moves it to
+	// partially_paid or paid.
+	AddPayment(ctx context.Context, invoiceID int32, p Payment) (Invoice, Payment, error)
+	GetPayment(ctx context.Context, invoiceID, paymentID int32) (Payment, error)
+	// SetPaymentLedgerEntry records the ledger entry posted for a payment.
+	SetPaymentLedgerEntry(ctx context.Context, paymentID, entryID int32) (Payment, error)
+	// Outstanding returns invoices in currency with a balance on asOf,
+	// counting only payments made on or before it.
+	Outstanding(ctx context.Context, currency string, asOf time.Time) ([]Invoice, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const customerColumns = `id, name, email, address, created_at`
+
+func (r *PgRepo) ListCustomers(ctx context.Context) ([]Customer, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+customerColumns+` FROM invoice_customers ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Customer
+	for rows.Next() {
+		var c Customer
+		if err := rows.Scan(&c.ID, &c.Name, &c.Email, &c.Address, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetCustomer(ctx context.Context, id int32) (Customer, error) {
+	var c Customer
+	err := r.Pool.QueryRow(ctx, `SELECT `+customerColumns+` FROM invoice_customers WHERE id=$1`, id).
+		Scan(&c.ID, &c.Name, &c.Email, &c.Address, &c.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return Customer{}, ErrNotFound
+	}
+	return c, err
+}
+
+func (r *PgRepo) CreateCustomer(ctx context.Context, c Customer) (Customer, error) {
+	var out Customer
+	err := r.Pool.QueryRow(ctx, `
+INSERT INTO invoice_customers (name, email, address) VALUES ($1,$2,$3)
+RETURNING `+customerColumns, c.Name, c.Email, c.Address).
+		Scan(&out.ID, &out.Name, &out.Email, &out.Address, &out.CreatedAt)
+	return out, err
+}
+
+func (r *PgRepo) UpdateCustomer(ctx context.Context, c Customer) (Customer, error) {
+	var out Customer
+	err := r.Pool.QueryRow(ctx, `
+UPDATE invoice_customers SET name=$2, email=$3, address=$4 WHERE id=$1
+RETURNING `+customerColumns, c.ID, c.Name, c.Email, c.Address).
+		Scan(&out.ID, &out.Name, &out.Email, &out.Address, &out.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return Customer{}, ErrNotFound
+	}
+	return out, err
+}
+
+// invoiceSelect resolves the billed party; paid is the amount_paid
+// expression so Outstanding can count payments up to a date.
+func invoiceSelect(paid string) string {
+	return `SELECT i.id, i.member_id, i.customer_id,
+       COALESCE(c.name, m.display_name, ''), COALESCE(c.email, m.email, ''), COALESCE(c.address, ''),
+       i.status, i.currency, i.ledger_type, i.issue_date, i.due_date, i.notes,
+       i.total::float8, (` + paid + `)::float8, i.sent_at, i.voided_at, i.void_reason, i.created_by, i.created_at
+FROM invoices i
+LEFT JOIN members m ON m.id = i.member_id
+LEFT JOIN invoice_customers c ON c.id = i.customer_id`
+}
+
+func (r *PgRepo) List(ctx context.Context, f ListFilters) ([]Invoice, error) {
+	query := invoiceSelect("i.amount_paid") + `
+WHERE ($1::bigint IS NULL OR i.member_id=$1) AND ($2::int IS NULL OR i.customer_id=$2)
+  AND ($3 = '' OR i.status=$3)
+  AND (NOT $4 OR (i.status IN ('sent','partially_paid') AND i.due_date < CURRENT_DATE))
+  AND (NOT $5 OR i.status <> 'draft')
+ORDER BY i.issue_date DESC, i.id DESC`
+	args := []any{f.MemberID, f.CustomerID, f.Status, f.Overdue, f.Issued}
+	if f.Limit > 0 {
+		query += ` LIMIT $6 OFFSET $7`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $6`
+		args = append(args, f.Offset)
+	}
+	return queryInvoices(ctx, r.Pool, query, args...)
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int32) (Invoice, error) {
+	return getInvoice(ctx, r.Pool, id, "")
+}
+
+func (r *PgRepo) Create(ctx context.Context, inv Invoice) (Invoice, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback(ctx)
+	if err := checkParty(ctx, tx, inv); err != nil {
+		return Invoice{}, err
+	}
+	var id int32
+	err = tx.QueryRow(ctx, `
+INSERT INTO invoices (member_id, customer_id, currency, ledger_type, issue_date, due_date, notes, total, created_by)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+RETURNING id`, inv.MemberID, inv.CustomerID, inv.Currency, inv.LedgerType, inv.IssueDate, inv.DueDate, inv.Notes, Totals(inv.Lines), inv.CreatedBy).Scan(&id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if err := insertLines(ctx, tx, id, inv.Lines); err != nil {
+		return Invoice{}, err
+	}
+	out, err := getInvoice(ctx, tx, id, "")
+	if err != nil {
+		return Invoice{}, err
+	}
+	return out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) Update(ctx context.Context, inv Invoice) (Invoice, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback(ctx)
+	cur, err := getInvoice(ctx, tx, inv.ID, " FOR UPDATE OF i")
+	if err != nil {
+		return Invoice{}, err
+	}
+	if cur.Status != StatusDraft {
+		return Invoice{}, ErrConflict
+	}
+	if err := checkParty(ctx, tx, inv); err != nil {
+		return Invoice{}, err
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE invoices SET member_id=$2, customer_id=$3, currency=$4, ledger_type=$5, issue_date=$6, due_date=$7, notes=$8, total=$9
+WHERE id=$1`, inv.ID, inv.MemberID, inv.CustomerID, inv.Currency, inv.LedgerType, inv.IssueDate, inv.DueDate, inv.Notes, Totals(inv.Lines)); err != nil {
+		return Invoice{}, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM invoice_lines WHERE invoice_id=$1`, inv.ID); err != nil {
+		return Invoice{}, err
+	}
+	if err := insertLines(ctx, tx, inv.ID, inv.Lines); err != nil {
+		return Invoice{}, err
+	}
+	out, err := getInvoice(ctx, tx, inv.ID, "")
+	if err != nil {
+		return Invoice{}, err
+	}
+	return out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) Send(ctx context.Context, id int32) (Invoice, error) {
+	return r.update(ctx, id, `SET status='sent', sent_at=now() WHERE id=$1 AND status='draft' AND total > 0`)
+}
+
+func (r *PgRepo) Void(ctx context.Context, id int32, reason string) (Invoice, error) {
+	return r.update(ctx, id, `SET status='void', voided_at=now(), void_reason=$2
+WHERE id=$1 AND status IN ('draft','sent') AND amount_paid = 0`, reason)
+}
+
+// update runs a conditional UPDATE and distinguishes a missing invoice from
+// one in the wrong state.
+func (r *PgRepo) update(ctx context.Context, id int32, set string, args ...any) (Invoice, error) {
+	tag, err := r.Pool.Exec(ctx, `UPDATE invoices `+set, append([]any{id}, args...)...)
+	if err != nil {
+		return Invoice{}, err
+	}
+	inv, err := r.Get(ctx, id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return Invoice{}, ErrConflict
+	}
+	return inv, nil
+}
+
+func (r *PgRepo) AddPayment(ctx context.Context, invoiceID int32, p Payment) (Invoice, Payment, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	defer tx.Rollback(ctx)
+	inv, err := getInvoice(ctx, tx, invoiceID, " FOR UPDATE OF i")
+	if err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	if !Open(inv.Status) {
+		return Invoice{}, Payment{}, ErrConflict
+	}
+	if p.Amount > inv.Balance {
+		return Invoice{}, Payment{}, ErrOverpayment
+	}
+	out, err := scanPayment(tx.QueryRow(ctx, `
+INSERT INTO invoice_payments (invoice_id, amount, paid_on, method, reference, created_by)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING `+paymentColumns, invoiceID, p.Amount, p.PaidOn, p.Method, p.Reference, p.CreatedBy))
+	if err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE invoices SET amount_paid = amount_paid + $2,
+       status = CASE WHEN amount_paid + $2 >= total THEN 'paid' ELSE 'partially_paid' END
+WHERE id=$1`, invoiceID, p.Amount); err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	if inv, err = getInvoice(ctx, tx, invoiceID, ""); err != nil {
+		return Invoice{}, Payment{}, err
+	}
+	return inv, out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) GetPayment(ctx context.Context, invoiceID, paymentID int32) (Payment, error) {
+	p, err := scanPayment(r.Pool.QueryRow(ctx, `SELECT `+paymentColumns+` FROM invoice_payments WHERE id=$1 AND invoice_id=$2`, paymentID, invoiceID))
+	if err == pgx.ErrNoRows {
+		return Payment{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *PgRepo) SetPaymentLedgerEntry(ctx context.Context, paymentID, entryID int32) (Payment, error) {
+	p, err := scanPayment(r.Pool.QueryRow(ctx, `UPDATE invoice_payments SET ledger_entry_id=$2 WHERE id=$1 RETURNING `+paymentColumns, paymentID, entryID))
+	if err == pgx.ErrNoRows {
+		return Payment{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *PgRepo) Outstanding(ctx context.Context, currency string, asOf time.Time) ([]Invoice, error) {
+	// Paid invoices are included: they may have been open on asOf.
+	paid := `SELECT COALESCE(SUM(p.amount), 0) FROM invoice_payments p WHERE p.invoice_id = i.id AND p.paid_on <= $2`
+	items, err := queryInvoices(ctx, r.Pool, invoiceSelect(paid)+`
+WHERE i.currency=$1 AND i.status IN ('sent','partially_paid','paid') AND i.issue_date <= $2
+ORDER BY i.due_date, i.id`, currency, asOf)
+	if err != nil {
+		return nil, err
+	}
+	out := items[:0]
+	for _, inv := range items {
+		if inv.Balance > 0 {
+			out = append(out, inv)
+		}
+	}
+	return out, nil
+}
+
+// checkParty returns ErrNoParty when the billed member or customer is
+// missing.
+func checkParty(ctx context.Context, tx pgx.Tx, inv Invoice) error {
+	var ok bool
+	var err error
+	if inv.MemberID != nil {
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM members WHERE id=$1)`, *inv.MemberID).Scan(&ok)
+	} else if inv.CustomerID != nil {
+		err = tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM invoice_customers WHERE id=$1)`, *inv.CustomerID).Scan(&ok)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNoParty
+	}
+	return nil
+}
+
+func insertLines(ctx context.Context, tx pgx.Tx, invoiceID int32, lines []Line) error {
+	for i, l := range lines {
+		if _, err := tx.Exec(ctx, `
+INSERT INTO invoice_lines (invoice_id, position, description, quantity, unit_price, amount)
+VALUES ($1,$2,$3,$4,$5,$6)`, invoiceID, i+1, l.Description, l.Quantity, l.UnitPrice, l.Amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getInvoice(ctx context.Context, q querier, id int32, lock string) (Invoice, error) {
+	inv, err := scanInvoice(q.QueryRow(ctx, invoiceSelect("i.amount_paid")+` WHERE i.id=$1`+lock, id))
+	if err == pgx.ErrNoRows {
+		return Invoice{}, ErrNotFound
+	}
+	if err != nil {
+		return Invoice{}, err
+	}
+	rows, err := q.Query(ctx, `SELECT description, quantity::float8, unit_price::float8, amount::float8 FROM invoice_lines WHERE invoice_id=$1 ORDER BY position`, id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer rows.Close()
+	inv.Lines = []Line{}
+	for rows.Next() {
+		var l Line
+		if err := rows.Scan(&l.Description, &l.Quantity, &l.UnitPrice, &l.Amount); err != nil {
+			return Invoice{}, err
+		}
+		inv.Lines = append(inv.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return Invoice{}, err
+	}
+	prows, err := q.Query(ctx, `SELECT `+paymentColumns+` FROM invoice_payments WHERE invoice_id=$1 ORDER BY paid_on, id`, id)
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer prows.Close()
+	inv.Payments = []Payment{}
+	for prows.Next() {
+		p, err := scanPayment(prows)
+		if err != nil {
+			return Invoice{}, err
+		}
+		inv.Payments = append(inv.Payments, p)
+	}
+	return inv, prows.Err()
+}
+
+func queryInvoices(ctx context.Context, q querier, query string, args ...any) ([]Invoice, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, inv)
+	}
+	return out, rows.Err()
+}
+
+func scanInvoice(row pgx.Row) (Invoice, error) {
+	var inv Invoice
+	var memberID, createdBy pgtype.Int8
+	var customerID pgtype.Int4
+	var issue, due pgtype.Date
+	var sentAt, voidedAt pgtype.Timestamptz
+	if err := row.Scan(&inv.ID, &memberID, &customerID, &inv.BillTo, &inv.BillToEmail, &inv.BillToAddr,
+		&inv.Status, &inv.Currency, &inv.LedgerType, &issue, &due, &inv.Notes,
+		&inv.Total, &inv.AmountPaid, &sentAt, &voidedAt, &inv.VoidReason, &createdBy, &inv.CreatedAt); err != nil {
+		return Invoice{}, err
+	}
+	inv.Number = FormatNumber(inv.ID)
+	inv.IssueDate, inv.DueDate = issue.Time, due.Time
+	inv.Balance = round2(inv.Total - inv.AmountPaid)
+	if memberID.Valid {
+		inv.MemberID = &memberID.Int64
+	}
+	if customerID.Valid {
+		inv.CustomerID = &customerID.Int32
+	}
+	if createdBy.Valid {
+		inv.CreatedBy = &createdBy.Int64
+	}
+	if sentAt.Valid {
+		t := sentAt.Time
+		inv.SentAt = &t
+	}
+	if voidedAt.Valid {
+		t := voidedAt.Time
+		inv.VoidedAt = &t
+	}
+	return inv, nil
+}
+
+const paymentColumns = `id, invoice_id, amount::float8, paid_on, method, reference, ledger_entry_id, created_by, created_at`
+
+func scanPayment(row pgx.Row) (Payment, error) {
+	var p Payment
+	var paidOn pgtype.Date
+	var entryID pgtype.Int4
+	var createdBy pgtype.Int8
+	if err := row.Scan(&p.ID, &p.InvoiceID, &p.Amount, &paidOn, &p.Method, &p.Reference, &entryID, &createdBy, &p.CreatedAt); err != nil {
+		return Payment{}, err
+	}
+	p.PaidOn = paidOn.Time
+	if entryID.Valid {
+		p.LedgerEntryID = &entryID.Int32
+	}
+	if createdBy.Valid {
+		p.CreatedBy = &createdBy.Int64
+	}
+	return p, nil
+}
@@ -0,0 +1,30 @@
+package invoices
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	biller := httpmw.RequirePermission("invoices.manage")
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequireAuth)
+		r.Get("/", h.List)
+		r.With(biller).Post("/", h.Create)
+		r.With(biller).Get("/aging", h.Aging)
+		r.With(biller).Get("/aging.csv", h.AgingCSV)
+		r.With(biller).Get("/customers", h.ListCustomers)
+		r.With(biller).Post("/customers", h.CreateCustomer)
+		r.With(biller).Get("/customers/{id}", h.GetCustomer)
+		r.With(biller).Put("/customers/{id}", h.UpdateCustomer)
+		r.Get("/{id}", h.Get)
+		r.With(biller).Put("/{id}", h.Update)
+		r.With(biller).Post("/{id}/send", h.Send)
+		r.With(biller).Post("/{id}/void", h.Void)
+		r.With(biller).Post("/{id}/payments", h.AddPayment)
+		r.With(biller).Post("/{id}/payments/{paymentID}/post", h.PostPayment)
+		r.Get("/{id}/invoice.html", h.HTML)
+		r.Get("/{id}/invoice.pdf", h.PDF)
+	}
+	r.Route("/invoices", route)
+}
@@ -0,0 +1,146 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultAccounts are used for types without a configured AccountMapping.
+var DefaultAccounts = map[string]string{
+	"dues":         "Membership Dues",
+	"contribution": "Member Contributions",
+	"income":       "Other Income",
+	"expense":      "Expenses",
+	"patronage":    "Patronage Dividends",
+	"capital":      "Member Capital",
+	"fx":           "Foreign Exchange Gain/Loss",
+}
+
+// ExportProfile writes ledger entries in a format an accounting package can
+// import. bankAccount is the cash account the entries move money in and out of.
+// Amounts are written in BaseCurrency.
+type ExportProfile struct {
+	Name        string
+	ContentType string
+	Extension   string
+	Write       func(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, bankAccount string) error
+}
+
+// ExportProfiles lists the supported export formats keyed by name.
+var ExportProfiles = map[string]ExportProfile{
+	"generic": {Name: "generic", ContentType: "text/csv; charset=utf-8", Extension: "csv", Write: writeGenericCSV},
+	"qbo":     {Name: "qbo", ContentType: "text/csv; charset=utf-8", Extension: "csv", Write: writeQBOCSV},
+	"iif":     {Name: "iif", ContentType: "text/plain; charset=utf-8", Extension: "iif", Write: writeIIF},
+	"xero":    {Name: "xero", ContentType: "text/csv; charset=utf-8", Extension: "csv", Write: writeXeroCSV},
+}
+
+// accountFor resolves the account name and code for a ledger type.
+func accountFor(accounts map[string]AccountMapping, ledgerType string) (string, string) {
+	if m, ok := accounts[ledgerType]; ok {
+		return m.Account, m.AccountCode
+	}
+	if a, ok := DefaultAccounts[ledgerType]; ok {
+		return a, ""
+	}
+	return ledgerType, ""
+}
+
+func memberName(e LedgerEntry) string {
+	if e.MemberID == nil {
+		return ""
+	}
+	return "Member " + strconv.FormatInt(int64(*e.MemberID), 10)
+}
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+// writeGenericCSV keeps the original toolkit column set.
+func writeGenericCSV(w io.Writer, entries []LedgerEntry, _ map[string]AccountMapping, _ string) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"Date", "Description", "Type", "Amount", "Member ID", "Notes", "Reference"})
+	for _, e := range entries {
+		memberID := ""
+		if e.MemberID != nil {
+			memberID = strconv.FormatInt(int64(*e.MemberID), 10)
+		}
+		_ = cw.Write([]string{
+			e.CreatedAt.UTC().Format("2006-01-02"),
+			e.Description,
+			e.Type,
+			money(e.Converted()),
+			memberID,
+			e.Notes,
+			strconv.FormatInt(int64(e.ID), 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeQBOCSV writes the QuickBooks Online 3-column bank upload format.
+// Deposits are positive and payments negative.
+func writeQBOCSV(w io.Writer, entries []LedgerEntry, _ map[string]AccountMapping, _ string) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"Date", "Description", "Amount"})
+	for _, e := range entries {
+		desc := e.Description
+		if e.Notes != "" {
+			desc += " - " + e.Notes
+		}
+		_ = cw.Write([]string{e.CreatedAt.UTC().Format("01/02/2006"), desc, money(e.Converted())})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeXeroCSV writes the Xero precoded bank statement format. Account Code
+// lets Xero suggest the matching account on import.
+func writeXeroCSV(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, _ string) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"*Date", "*Amount", "Payee", "Description", "Reference", "Account Code"})
+	for _, e := range entries {
+		_, code := accountFor(accounts, e.Type)
+		_ = cw.Write([]string{
+			e.CreatedAt.UTC().Format("02/01/2006"),
+			money(e.Converted()),
+			memberName(e),
+			e.Description,
+			"LE-" + strconv.FormatInt(int64(e.ID), 10),
+			code,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeIIF writes QuickBooks Desktop IIF transactions. Each entry becomes a
+// balanced transaction: the bank line carries the signed amount and the split
+// line posts the opposite amount to the mapped account.
+func writeIIF(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, bankAccount string) error {
+	var b strings.Builder
+	b.WriteString("!TRNS\tTRNSID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tSPLID\tTRNSTYPE\tDATE\tACCNT\tNAME\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!ENDTRNS\n")
+	for _, e := range entries {
+		trnsType := "DEPOSIT"
+		if e.Converted() < 0 {
+			trnsType = "CHECK"
+		}
+		account, _ := accountFor(accounts, e.Type)
+		date := e.CreatedAt.UTC().Format("01/02/2006")
+		doc := strconv.FormatInt(int64(e.ID), 10)
+		name, memo := iifField(memberName(e)), iifField(e.Description)
+		b.WriteString(strings.Join([]string{"TRNS", "", trnsType, date, iifField(bankAccount), name, money(e.Converted()), doc, memo}, "\t") + "\n")
+		b.WriteString(strings.Join([]string{"SPL", "", trnsType, date, iifField(account), name, money(-e.Converted()), doc, memo}, "\t") + "\n")
+		b.WriteString("ENDTRNS\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// iifField strips characters IIF cannot represent inside a field.
+func iifField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ", "\"", "'").Replace(s)
+}
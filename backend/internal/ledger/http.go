@@ -1,11 +1,15 @@
 package ledger
 
 import (
-    "encoding/csv"
     "encoding/json"
+    "errors"
+    "math"
     "net/http"
     "strconv"
+    "strings"
+    "time"
 
+    "coop.tools/backend/internal/fx"
     "coop.tools/backend/internal/httpmw"
     "coop.tools/backend/internal/httpx"
     "github.com/go-chi/chi/v5"
@@ -13,21 +17,20 @@ import (
 
 type Handlers struct {
 	Repo Repo
+	// Rates converts entries posted in a foreign currency; nil accepts
+	// only BaseCurrency.
+	Rates fx.Lookuper
 }
 
+// List handles GET /api/ledger
+// Query: type (comma-separated), member_id, from, to (YYYY-MM-DD), min_amount,
+// max_amount, q (description/notes search), sort, limit, offset, totals=true
+// With totals=true the response is a ListPage carrying sums by type for the
+// whole filtered set.
 func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
-    filters := &ListFilters{}
-    if t := r.URL.Query().Get("type"); t != "" {
-        filters.Type = t
-    }
-    if mid := r.URL.Query().Get("member_id"); mid != "" {
-        v, err := strconv.ParseInt(mid, 10, 32)
-        if err != nil {
-            httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
-            return
-        }
-        v32 := int32(v)
-        filters.MemberID = &v32
+    filters, ok := listFilters(w, r)
+    if !ok {
+        return
     }
     if lim, off, err := httpx.ParseLimitOffset(r, 200); err != nil {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
@@ -41,8 +44,21 @@ func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
     }
     if filters.Limit > 0 { w.Header().Set("X-Limit", strconv.Itoa(filters.Limit)) }
     if filters.Offset > 0 { w.Header().Set("X-Offset", strconv.Itoa(filters.Offset)) }
+    if !httpx.QueryBoolTrue(r, "totals") {
+        w.Header().Set("Content-Type", "application/json")
+        _ = json.NewEncoder(w).Encode(items)
+        return
+    }
+    totals, err := h.Repo.Totals(r.Context(), filters)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to total")
+        return
+    }
+    if items == nil {
+        items = []LedgerEntry{}
+    }
     w.Header().Set("Content-Type", "application/json")
-    _ = json.NewEncoder(w).Encode(items)
+    _ = json.NewEncoder(w).Encode(ListPage{Entries: items, Totals: totals})
 }
 
 func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
@@ -56,6 +72,7 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
 		Amount      float64 `json:"amount"`
 		Description string  `json:"description"`
 		Notes       string  `json:"notes"`
+		Currency    string  `json:"currency"`
 	}
     if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
@@ -73,9 +90,30 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid type")
         return
     }
+	currency := strings.ToUpper(strings.TrimSpace(in.Currency))
+	if currency == "" {
+		currency = BaseCurrency
+	}
+	if !fx.ValidCurrency(currency) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+		return
+	}
 	idem := r.Header.Get("X-Idempotency-Key")
 	mid := memberID
-    e, replayed, err := h.Repo.Create(r.Context(), in.Type, in.Description, in.Amount, &mid, in.Notes, idem)
+	var (
+		e        LedgerEntry
+		replayed bool
+		err      error
+	)
+	if currency == BaseCurrency {
+		e, replayed, err = h.Repo.Create(r.Context(), in.Type, in.Description, in.Amount, &mid, in.Notes, idem)
+	} else {
+		rate, ok := h.rate(w, r, currency, time.Now())
+		if !ok {
+			return
+		}
+		e, replayed, err = h.Repo.CreateInCurrency(r.Context(), in.Type, in.Description, in.Amount, currency, rate, &mid, in.Notes, idem)
+	}
     if err != nil {
         httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
         return
@@ -110,33 +148,345 @@ func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(e)
 }
 
-// ExportCSV streams all ledger entries as CSV
+// Settle handles POST /api/ledger/{id}/settle, recording the rate a
+// foreign-currency entry actually settled at and posting the realized gain
+// or loss as an "fx" entry.
+// Body: {"settled_on":"YYYY-MM-DD","rate":1.08}; settled_on defaults to
+// today and rate to the stored rate on that date.
+func (h Handlers) Settle(w http.ResponseWriter, r *http.Request) {
+	id, ok := entryID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		SettledOn string   `json:"settled_on"`
+		Rate      *float64 `json:"rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	on := time.Now().UTC().Truncate(24 * time.Hour)
+	if in.SettledOn != "" {
+		t, err := httpx.ParseDate(in.SettledOn)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid settled_on")
+			return
+		}
+		on = *t
+	}
+	e, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	var rate float64
+	if in.Rate != nil {
+		rate = *in.Rate
+		if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "rate must be positive")
+			return
+		}
+	} else {
+		if e.Currency == "" || e.Currency == BaseCurrency {
+			httpmw.WriteJSONError(w, http.StatusConflict, "entry is in the base currency")
+			return
+		}
+		if rate, ok = h.rate(w, r, e.Currency, on); !ok {
+			return
+		}
+	}
+	s, err := h.Repo.Settle(r.Context(), id, on, rate)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, ErrConflict):
+			httpmw.WriteJSONError(w, http.StatusConflict, "entry is in the base currency or already settled")
+		default:
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "settle failed")
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// GetSettlement handles GET /api/ledger/{id}/settlement.
+func (h Handlers) GetSettlement(w http.ResponseWriter, r *http.Request) {
+	id, ok := entryID(w, r)
+	if !ok {
+		return
+	}
+	s, err := h.Repo.GetSettlement(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not settled")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s)
+}
+
+// rate looks up the exchange rate for currency on a date, writing the error
+// response when there is none.
+func (h Handlers) rate(w http.ResponseWriter, r *http.Request, currency string, on time.Time) (float64, bool) {
+	if h.Rates == nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "only "+BaseCurrency+" entries are accepted")
+		return 0, false
+	}
+	rate, err := h.Rates.Lookup(r.Context(), currency, on)
+	if err != nil {
+		if errors.Is(err, fx.ErrNoRate) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "no exchange rate for "+currency)
+			return 0, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "rate lookup failed")
+		return 0, false
+	}
+	return rate.Rate, true
+}
+
+func entryID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// ExportCSV streams ledger entries in the requested export profile.
+// Query: profile=generic|qbo|iif|xero (default generic), from, to (YYYY-MM-DD),
+// type (comma-separated), bank_account (IIF only; default "Checking")
 func (h Handlers) ExportCSV(w http.ResponseWriter, r *http.Request) {
-	items, err := h.Repo.List(r.Context(), &ListFilters{})
+	name := r.URL.Query().Get("profile")
+	if name == "" {
+		name = "generic"
+	}
+	profile, ok := ExportProfiles[name]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "profile must be 'generic', 'qbo', 'iif', or 'xero'")
+		return
+	}
+	h.export(w, r, profile, "Checking")
+}
+
+// ExportJournal streams ledger entries as a plain-text accounting journal.
+// Query: format=ledger|hledger|beancount (default ledger), from, to, type,
+// bank_account (default "Assets:Checking")
+func (h Handlers) ExportJournal(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "ledger"
+	}
+	profile, ok := JournalFormats[name]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "format must be 'ledger', 'hledger', or 'beancount'")
+		return
+	}
+	h.export(w, r, profile, "Assets:Checking")
+}
+
+// ImportBeancount handles POST /api/ledger/import/beancount (admin). The
+// body is a beancount file; see ParseBeancount for how transactions map to
+// entries. With ?dry_run=true nothing is written.
+func (h Handlers) ImportBeancount(w http.ResponseWriter, r *http.Request) {
+	accounts, err := h.accounts(r)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load accounts")
+		return
+	}
+	entries, skips, err := ParseBeancount(http.MaxBytesReader(w, r.Body, 10<<20), accounts)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid beancount file: "+err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []ImportEntry{}
+	}
+	if skips == nil {
+		skips = []ImportSkip{}
+	}
+	out := struct {
+		DryRun     bool          `json:"dry_run"`
+		Parsed     int           `json:"parsed"`
+		Imported   int           `json:"imported"`
+		Duplicates int           `json:"duplicates"`
+		Skipped    []ImportSkip  `json:"skipped"`
+		Entries    []ImportEntry `json:"entries,omitempty"`
+	}{DryRun: httpx.QueryBoolTrue(r, "dry_run"), Parsed: len(entries), Skipped: skips}
+	if out.DryRun {
+		out.Entries = entries
+	} else if len(entries) > 0 {
+		n, err := h.Repo.Import(r.Context(), entries)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusInternalServerError, "import failed")
+			return
+		}
+		out.Imported, out.Duplicates = n, len(entries)-n
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// export applies the List filters and bank_account and writes the entries
+// with profile.
+func (h Handlers) export(w http.ResponseWriter, r *http.Request, profile ExportProfile, defaultBank string) {
+	filters, ok := listFilters(w, r)
+	if !ok {
+		return
+	}
+	bank := r.URL.Query().Get("bank_account")
+	if bank == "" {
+		bank = defaultBank
+	}
+
+	items, err := h.Repo.List(r.Context(), filters)
 	if err != nil {
 		http.Error(w, "failed to list", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
-	w.Header().Set("Content-Disposition", "attachment; filename=ledger.csv")
+	accounts, err := h.accounts(r)
+	if err != nil {
+		http.Error(w, "failed to load accounts", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", profile.ContentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=ledger."+profile.Extension)
+	_ = profile.Write(w, items, accounts, bank)
+}
 
-	cw := csv.NewWriter(w)
-	defer cw.Flush()
+// listFilters parses the filters shared by List and the exports.
+func listFilters(w http.ResponseWriter, r *http.Request) (*ListFilters, bool) {
+	q := r.URL.Query()
+	filters := &ListFilters{Search: strings.TrimSpace(q.Get("q")), Sort: q.Get("sort")}
+	if t := q.Get("type"); t != "" {
+		for _, v := range strings.Split(t, ",") {
+			v = strings.TrimSpace(v)
+			if !ValidType(v) {
+				httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid type")
+				return nil, false
+			}
+			filters.Types = append(filters.Types, v)
+		}
+	}
+	if mid := q.Get("member_id"); mid != "" {
+		v, err := strconv.ParseInt(mid, 10, 32)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+			return nil, false
+		}
+		v32 := int32(v)
+		filters.MemberID = &v32
+	}
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return nil, false
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "to must not be before from")
+		return nil, false
+	}
+	filters.FromDate, filters.ToDate = from, to
+	for key, dst := range map[string]**float64{"min_amount": &filters.MinAmount, "max_amount": &filters.MaxAmount} {
+		if v := q.Get(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid "+key)
+				return nil, false
+			}
+			*dst = &f
+		}
+	}
+	if filters.MinAmount != nil && filters.MaxAmount != nil && *filters.MaxAmount < *filters.MinAmount {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "max_amount must not be below min_amount")
+		return nil, false
+	}
+	if c := q.Get("currency"); c != "" {
+		filters.Currency = strings.ToUpper(strings.TrimSpace(c))
+		if !fx.ValidCurrency(filters.Currency) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid currency")
+			return nil, false
+		}
+	}
+	if filters.Sort != "" {
+		if _, ok := SortOrders[filters.Sort]; !ok {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid sort")
+			return nil, false
+		}
+	}
+	return filters, true
+}
 
-	_ = cw.Write([]string{"Date", "Description", "Type", "Amount", "Member ID", "Notes", "Reference"})
-	for _, e := range items {
-		memberID := ""
-		if e.MemberID != nil {
-			memberID = strconv.FormatInt(int64(*e.MemberID), 10)
+// accounts returns the configured account mappings keyed by ledger type.
+func (h Handlers) accounts(r *http.Request) (map[string]AccountMapping, error) {
+	mappings, err := h.Repo.ListAccounts(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]AccountMapping, len(mappings))
+	for _, m := range mappings {
+		out[m.LedgerType] = m
+	}
+	return out, nil
+}
+
+// ListAccounts handles GET /api/ledger/accounts and returns the account each
+// ledger type maps to on export, falling back to the defaults.
+func (h Handlers) ListAccounts(w http.ResponseWriter, r *http.Request) {
+	byType, err := h.accounts(r)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	out := make([]AccountMapping, 0, len(Types))
+	for _, t := range Types {
+		m, ok := byType[t]
+		if !ok {
+			m = AccountMapping{LedgerType: t, Account: DefaultAccounts[t]}
 		}
-		_ = cw.Write([]string{
-			e.CreatedAt.UTC().Format("2006-01-02"),
-			e.Description,
-			e.Type,
-			strconv.FormatFloat(e.Amount, 'f', 2, 64),
-			memberID,
-			e.Notes,
-			strconv.FormatInt(int64(e.ID), 10),
-		})
+		out = append(out, m)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// SetAccount handles PUT /api/ledger/accounts/{type} (admin)
+func (h Handlers) SetAccount(w http.ResponseWriter, r *http.Request) {
+	ledgerType := chi.URLParam(r, "type")
+	if !ValidType(ledgerType) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid type")
+		return
+	}
+	var in struct {
+		Account     string `json:"account"`
+		AccountCode string `json:"account_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	in.Account, in.AccountCode = strings.TrimSpace(in.Account), strings.TrimSpace(in.AccountCode)
+	if in.Account == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "account required")
+		return
+	}
+	m, err := h.Repo.SetAccount(r.Context(), AccountMapping{LedgerType: ledgerType, Account: in.Account, AccountCode: in.AccountCode})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m)
 }
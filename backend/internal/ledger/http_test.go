@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"coop.tools/backend/internal/fx"
 	"coop.tools/backend/internal/httpmw"
 	"github.com/go-chi/chi/v5"
 )
@@ -16,35 +19,101 @@ import (
 // ---- Mock Repo ----
 
 type mockRepo struct {
-    entries []LedgerEntry
-    nextID  int32
+    entries  []LedgerEntry
+    nextID   int32
+    accounts []AccountMapping
+    keys     map[string]bool
+    settled  map[int32]Settlement
+}
+
+// matches applies filters the same way the SQL WHERE clause does.
+func matches(entry LedgerEntry, filters *ListFilters) bool {
+	if filters == nil {
+		return true
+	}
+	if filters.Type != "" && entry.Type != filters.Type {
+		return false
+	}
+	if filters.Currency != "" && entry.Currency != filters.Currency {
+		return false
+	}
+	if filters.MemberID != nil && (entry.MemberID == nil || *entry.MemberID != *filters.MemberID) {
+		return false
+	}
+	if len(filters.Types) > 0 {
+		match := false
+		for _, t := range filters.Types {
+			if entry.Type == t {
+				match = true
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	if filters.FromDate != nil && entry.CreatedAt.Before(*filters.FromDate) {
+		return false
+	}
+	if filters.ToDate != nil && !entry.CreatedAt.Before(filters.ToDate.AddDate(0, 0, 1)) {
+		return false
+	}
+	if (filters.MinAmount != nil && entry.Amount < *filters.MinAmount) || (filters.MaxAmount != nil && entry.Amount > *filters.MaxAmount) {
+		return false
+	}
+	if q := strings.ToLower(filters.Search); q != "" && !strings.Contains(strings.ToLower(entry.Description), q) && !strings.Contains(strings.ToLower(entry.Notes), q) {
+		return false
+	}
+	return true
 }
 
 func (m *mockRepo) List(_ context.Context, filters *ListFilters) ([]LedgerEntry, error) {
 	// Return a copy to avoid mutation by callers
 	out := make([]LedgerEntry, 0)
-
 	for _, entry := range m.entries {
-		include := true
-
-		// Apply filters
-		if filters != nil {
-			if filters.Type != "" && entry.Type != filters.Type {
-				include = false
-			}
-			if filters.MemberID != nil {
-				if entry.MemberID == nil || *entry.MemberID != *filters.MemberID {
-					include = false
-				}
-			}
-			// Skip date filters in mock for simplicity
-		}
-
-		if include {
+		if matches(entry, filters) {
 			out = append(out, entry)
 		}
 	}
+	if filters != nil {
+		switch filters.Sort {
+		case "amount":
+			sort.SliceStable(out, func(i, j int) bool { return out[i].Amount < out[j].Amount })
+		case "-amount":
+			sort.SliceStable(out, func(i, j int) bool { return out[i].Amount > out[j].Amount })
+		}
+		if filters.Offset > 0 {
+			out = out[min(filters.Offset, len(out)):]
+		}
+		if filters.Limit > 0 {
+			out = out[:min(filters.Limit, len(out))]
+		}
+	}
+	return out, nil
+}
 
+func (m *mockRepo) Totals(_ context.Context, filters *ListFilters) (Totals, error) {
+	out := Totals{ByType: []TypeTotal{}}
+	byType := map[string]int{}
+	for _, entry := range m.entries {
+		if !matches(entry, filters) {
+			continue
+		}
+		i, ok := byType[entry.Type]
+		if !ok {
+			i = len(out.ByType)
+			byType[entry.Type] = i
+			out.ByType = append(out.ByType, TypeTotal{Type: entry.Type})
+		}
+		out.ByType[i].Count++
+		out.ByType[i].Sum += entry.Amount
+		out.Count++
+		out.Sum += entry.Amount
+		if entry.Amount > 0 {
+			out.Inflow += entry.Amount
+		} else {
+			out.Outflow += entry.Amount
+		}
+	}
 	return out, nil
 }
 
@@ -57,7 +126,11 @@ func (m *mockRepo) Get(_ context.Context, id int32) (LedgerEntry, error) {
 	return LedgerEntry{}, ErrNotFound
 }
 
-func (m *mockRepo) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (LedgerEntry, bool, error) {
+func (m *mockRepo) Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (LedgerEntry, bool, error) {
+    return m.CreateInCurrency(ctx, entryType, description, amount, BaseCurrency, 1, memberID, notes, idempotencyKey)
+}
+
+func (m *mockRepo) CreateInCurrency(_ context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, idempotencyKey string) (LedgerEntry, bool, error) {
     if m.nextID == 0 {
         m.nextID = 1
     }
@@ -65,6 +138,9 @@ func (m *mockRepo) Create(_ context.Context, entryType, description string, amou
         ID:          m.nextID,
         Type:        entryType,
         Amount:      amount,
+        Currency:    currency,
+        FxRate:      rate,
+        BaseAmount:  round2(amount * rate),
         Description: description,
         MemberID:    memberID,
         Notes:       notes,
@@ -75,11 +151,71 @@ func (m *mockRepo) Create(_ context.Context, entryType, description string, amou
     return entry, false, nil
 }
 
+func (m *mockRepo) Settle(ctx context.Context, entryID int32, settledOn time.Time, rate float64) (Settlement, error) {
+	e, err := m.Get(ctx, entryID)
+	if err != nil {
+		return Settlement{}, err
+	}
+	if _, ok := m.settled[entryID]; ok || e.Currency == BaseCurrency {
+		return Settlement{}, ErrConflict
+	}
+	s := Settlement{EntryID: entryID, SettledOn: settledOn, Rate: rate, BaseAmount: round2(e.Amount * rate)}
+	s.Difference = round2(s.BaseAmount - e.BaseAmount)
+	if s.Difference != 0 {
+		fxEntry, _, _ := m.Create(ctx, "fx", "Realized FX", s.Difference, nil, "", "")
+		s.FxEntryID = &fxEntry.ID
+	}
+	if m.settled == nil {
+		m.settled = map[int32]Settlement{}
+	}
+	m.settled[entryID] = s
+	return s, nil
+}
+
+func (m *mockRepo) GetSettlement(_ context.Context, entryID int32) (Settlement, error) {
+	s, ok := m.settled[entryID]
+	if !ok {
+		return Settlement{}, ErrNotFound
+	}
+	return s, nil
+}
+
+func (m *mockRepo) ListAccounts(_ context.Context) ([]AccountMapping, error) {
+	return m.accounts, nil
+}
+
+func (m *mockRepo) SetAccount(_ context.Context, in AccountMapping) (AccountMapping, error) {
+	for i, a := range m.accounts {
+		if a.LedgerType == in.LedgerType {
+			m.accounts[i] = in
+			return in, nil
+		}
+	}
+	m.accounts = append(m.accounts, in)
+	return in, nil
+}
+
+func (m *mockRepo) Import(_ context.Context, entries []ImportEntry) (int, error) {
+	if m.keys == nil {
+		m.keys = map[string]bool{}
+	}
+	n := 0
+	for _, e := range entries {
+		if m.keys[e.Key] {
+			continue
+		}
+		m.keys[e.Key] = true
+		m.entries = append(m.entries, LedgerEntry{ID: int32(len(m.entries) + 1), Type: e.Type, Amount: e.Amount, Description: e.Description, MemberID: e.MemberID, Notes: e.Notes, CreatedAt: e.Date})
+		n++
+	}
+	return n, nil
+}
+
 // ---- Helper functions ----
 
 func setupRouter(repo Repo) *chi.Mux {
     r := chi.NewRouter()
-    r.Use(httpmw.WithAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+    r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
         if id <= 0 { return httpmw.Principal{}, false, nil }
         return httpmw.Principal{MemberID: id, Role: "member"}, true, nil
     }))
@@ -142,6 +278,60 @@ func TestHandlers_List(t *testing.T) {
 	}
 }
 
+func TestHandlers_ListFiltersAndTotals(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 12, 0, 0, 0, time.UTC) }
+	repo := &mockRepo{
+		entries: []LedgerEntry{
+			{ID: 1, Type: "dues", Amount: 50, Description: "March dues", CreatedAt: day(1)},
+			{ID: 2, Type: "expense", Amount: -25.5, Description: "Paint", Notes: "for the SHOP", CreatedAt: day(5)},
+			{ID: 3, Type: "expense", Amount: -300, Description: "Rent", CreatedAt: day(10)},
+			{ID: 4, Type: "income", Amount: 120, Description: "Workshop fee", CreatedAt: day(20)},
+		},
+	}
+	r := setupRouter(repo)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", "/ledger?"+query, nil))
+		return rr
+	}
+
+	// search covers notes, case-insensitively
+	var entries []LedgerEntry
+	_ = json.Unmarshal(get("q=shop").Body.Bytes(), &entries)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 matches for q=shop, got %d", len(entries))
+	}
+
+	// multiple types, amount range and sort
+	_ = json.Unmarshal(get("type=expense,income&min_amount=-100&sort=-amount").Body.Bytes(), &entries)
+	if len(entries) != 2 || entries[0].ID != 4 || entries[1].ID != 2 {
+		t.Fatalf("unexpected filtered entries: %+v", entries)
+	}
+
+	// totals cover the whole filtered set, not just the page
+	rr := get("from=2025-03-02&to=2025-03-31&totals=true&limit=1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var page ListPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal("failed to parse json:", err)
+	}
+	if len(page.Entries) != 1 || page.Totals.Count != 3 || page.Totals.Sum != -205.5 || page.Totals.Outflow != -325.5 || len(page.Totals.ByType) != 2 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if bt := page.Totals.ByType[0]; bt.Type != "expense" || bt.Count != 2 || bt.Sum != -325.5 {
+		t.Fatalf("unexpected expense totals: %+v", bt)
+	}
+
+	for _, q := range []string{"type=bogus", "min_amount=abc", "min_amount=10&max_amount=5", "sort=name", "from=2025-03-10&to=2025-03-01"} {
+		if rr := get(q); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
 func TestHandlers_Create(t *testing.T) {
 	repo := &mockRepo{}
 	r := setupRouter(repo)
@@ -314,3 +504,338 @@ func TestHandlers_ExportCSV(t *testing.T) {
 		t.Errorf("expected expense row '%s', got '%s'", expectedExpenseRow, lines[2])
 	}
 }
+
+func exportRepo() *mockRepo {
+	memberID1 := int32(1)
+	return &mockRepo{
+		entries: []LedgerEntry{
+			{ID: 1, Type: "dues", Amount: 50.00, Description: "Monthly dues", MemberID: &memberID1, CreatedAt: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+			{ID: 2, Type: "expense", Amount: -25.50, Description: "Office\tsupplies", Notes: "For new office", CreatedAt: time.Date(2025, 1, 2, 14, 30, 0, 0, time.UTC)},
+			{ID: 3, Type: "contribution", Amount: 100.00, Description: "Annual contribution", CreatedAt: time.Date(2025, 2, 3, 9, 15, 0, 0, time.UTC)},
+		},
+		accounts: []AccountMapping{{LedgerType: "dues", Account: "Income:Dues", AccountCode: "4000"}},
+	}
+}
+
+func TestHandlers_ExportProfiles(t *testing.T) {
+	r := setupRouter(exportRepo())
+
+	tests := []struct {
+		query string
+		ctype string
+		file  string
+		lines int
+		want  []string
+	}{
+		{"profile=qbo&to=2025-01-31", "text/csv", "ledger.csv", 3, []string{"Date,Description,Amount", "01/01/2025,Monthly dues,50.00", "01/02/2025,Office\tsupplies - For new office,-25.50"}},
+		{"profile=xero&type=dues,contribution", "text/csv", "ledger.csv", 3, []string{"*Date,*Amount,Payee,Description,Reference,Account Code", "01/01/2025,50.00,Member 1,Monthly dues,LE-1,4000", "03/02/2025,100.00,,Annual contribution,LE-3,"}},
+		{"profile=iif&from=2025-01-01&to=2025-01-02&bank_account=Operating", "text/plain", "ledger.iif", 9, []string{
+			"TRNS\t\tDEPOSIT\t01/01/2025\tOperating\tMember 1\t50.00\t1\tMonthly dues",
+			"SPL\t\tDEPOSIT\t01/01/2025\tIncome:Dues\tMember 1\t-50.00\t1\tMonthly dues",
+			"SPL\t\tCHECK\t01/02/2025\tExpenses\t\t25.50\t2\tOffice supplies",
+		}},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", "/ledger/.csv?"+tc.query, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tc.query, rr.Code)
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), tc.ctype) {
+			t.Errorf("%s: unexpected content type %s", tc.query, rr.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(rr.Header().Get("Content-Disposition"), tc.file) {
+			t.Errorf("%s: unexpected disposition %s", tc.query, rr.Header().Get("Content-Disposition"))
+		}
+		body := rr.Body.String()
+		if n := len(strings.Split(strings.TrimSpace(body), "\n")); n != tc.lines {
+			t.Errorf("%s: expected %d lines, got %d:\n%s", tc.query, tc.lines, n, body)
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(body, w) {
+				t.Errorf("%s: expected %q in:\n%s", tc.query, w, body)
+			}
+		}
+	}
+
+	for _, q := range []string{"profile=excel", "from=2025-13-01", "type=bogus", "from=2025-02-01&to=2025-01-01"} {
+		req := httptest.NewRequest("GET", "/ledger/.csv?"+q, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestHandlers_Accounts(t *testing.T) {
+	repo := exportRepo()
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role := "member"
+		if id == 1 {
+			role = "admin"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo})
+
+	req := httptest.NewRequest("GET", "/ledger/accounts", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var list []AccountMapping
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal("failed to parse json:", err)
+	}
+	if len(list) != len(Types) || list[0].Account != "Income:Dues" || list[2].Account != "Expenses" {
+		t.Fatalf("unexpected accounts: %+v", list)
+	}
+
+	body := `{"account":"Office Expenses","account_code":"6100"}`
+	req = httptest.NewRequest("PUT", "/ledger/accounts/expense", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "2")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("PUT", "/ledger/accounts/expense", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("PUT", "/ledger/accounts/bogus", strings.NewReader(body))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/ledger/.csv?profile=iif&type=expense", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), "SPL\t\tCHECK\t01/02/2025\tOffice Expenses") {
+		t.Errorf("expected mapped account in iif export:\n%s", rr.Body.String())
+	}
+}
+
+func TestHandlers_ExportJournal(t *testing.T) {
+	r := setupRouter(exportRepo())
+
+	req := httptest.NewRequest("GET", "/ledger/journal?format=beancount&to=2025-01-31", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Disposition"), "ledger.beancount") {
+		t.Fatalf("unexpected response %d %q", rr.Code, rr.Header().Get("Content-Disposition"))
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		"2025-01-01 open Assets:Checking USD",
+		"2025-01-01 open Income:Dues USD",
+		"2025-01-01 open Expenses:General USD",
+		"2025-01-01 * \"Member 1\" \"Monthly dues\"\n  entry_id: 1\n  type: \"dues\"\n  member_id: 1\n  Assets:Checking  50.00 USD\n  Income:Dues  -50.00 USD\n",
+		"  notes: \"For new office\"",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "Annual contribution") {
+		t.Errorf("expected date filter to exclude february entry")
+	}
+
+	req = httptest.NewRequest("GET", "/ledger/journal?format=hledger&type=expense", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if want := "2025-01-02 * (2) Office supplies  ; entry_id:2, type:expense\n    ; For new office\n    Assets:Checking  -25.50 USD\n    Expenses:General  25.50 USD\n"; rr.Body.String() != want+"\n" {
+		t.Errorf("unexpected hledger journal:\n%s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/ledger/journal?type=contribution", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if !strings.HasPrefix(rr.Body.String(), "2025-02-03 * (3) Annual contribution\n    ; entry_id: 3\n    ; type: contribution\n    Assets:Checking  100.00 USD\n    Income:Contributions  -100.00 USD\n") {
+		t.Errorf("unexpected ledger journal:\n%s", rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/ledger/journal?format=gnucash", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+const sampleBeancount = `option "operating_currency" "USD"
+2024-01-01 open Assets:Checking USD
+2024-01-01 open Income:Dues USD
+
+; dues mapped via account_mappings
+2024-03-01 * "Member 7" "March dues" #dues
+  member_id: 7
+  Assets:Checking  40.00 USD
+  Income:Dues
+
+2024-03-02 * "Hardware; bulk order"
+  Expenses:Supplies  120.00 USD ; comment
+  Assets:Checking
+
+2024-03-03 txn "Savings transfer"
+  Assets:Savings  100.00 USD
+  Assets:Checking  -100.00 USD
+
+2024-03-04 * "Grant"
+  type: "income"
+  Assets:Checking  1,000.00 USD
+  Equity:Grants  -1,000.00 USD
+
+2024-03-05 * "Euro donation"
+  Assets:Checking  10.00 EUR
+  Income:Donations
+`
+
+func TestParseBeancount(t *testing.T) {
+	accounts := map[string]AccountMapping{"dues": {LedgerType: "dues", Account: "Income:Dues"}}
+	entries, skips, err := ParseBeancount(strings.NewReader(sampleBeancount), accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || len(skips) != 2 {
+		t.Fatalf("expected 3 entries and 2 skips, got %+v %+v", entries, skips)
+	}
+	if e := entries[0]; e.Type != "dues" || e.Amount != 40 || e.MemberID == nil || *e.MemberID != 7 || e.Description != "March dues" || !e.Date.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected dues entry: %+v", e)
+	}
+	if e := entries[1]; e.Type != "expense" || e.Amount != -120 || e.Description != "Hardware; bulk order" {
+		t.Errorf("unexpected expense entry: %+v", e)
+	}
+	if e := entries[2]; e.Type != "income" || e.Amount != 1000 {
+		t.Errorf("unexpected income entry: %+v", e)
+	}
+	if skips[0].Line != 15 || skips[1].Reason != "unsupported currency EUR" {
+		t.Errorf("unexpected skips: %+v", skips)
+	}
+	if _, _, err := ParseBeancount(strings.NewReader("2024-01-01 * \"x\"\n  not a posting\n"), nil); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestHandlers_ImportBeancount(t *testing.T) {
+	repo := exportRepo()
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		return httpmw.Principal{MemberID: id, Role: "admin"}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo})
+
+	post := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(sampleBeancount))
+		req.Header.Set("X-User-Id", "1")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	var out struct {
+		Parsed, Imported, Duplicates int
+		Entries                      []ImportEntry
+	}
+	rr := post("/ledger/import/beancount?dry_run=true")
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	if rr.Code != http.StatusOK || out.Parsed != 3 || out.Imported != 0 || len(out.Entries) != 3 || len(repo.entries) != 3 {
+		t.Fatalf("unexpected dry run: %d %+v", rr.Code, out)
+	}
+
+	rr = post("/ledger/import/beancount")
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	if out.Imported != 3 || len(repo.entries) != 6 || repo.entries[3].CreatedAt.Year() != 2024 {
+		t.Fatalf("unexpected import: %+v", out)
+	}
+
+	rr = post("/ledger/import/beancount")
+	_ = json.Unmarshal(rr.Body.Bytes(), &out)
+	if out.Imported != 0 || out.Duplicates != 3 {
+		t.Fatalf("expected re-import to be a no-op: %+v", out)
+	}
+}
+
+type mockRates map[string]float64
+
+func (m mockRates) Lookup(_ context.Context, currency string, on time.Time) (fx.Rate, error) {
+	rate, ok := m[currency]
+	if !ok {
+		return fx.Rate{}, fx.ErrNoRate
+	}
+	return fx.Rate{Currency: currency, Date: on, Rate: rate}, nil
+}
+
+func TestHandlers_CurrencyAndSettle(t *testing.T) {
+	repo := &mockRepo{}
+	rates := mockRates{"EUR": 1.10}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		return httpmw.Principal{MemberID: id, Role: "admin"}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Rates: rates})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User-Id", "1")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do("POST", "/ledger", `{"type":"expense","amount":-100,"description":"Conference","currency":"eur"}`)
+	var e LedgerEntry
+	_ = json.Unmarshal(rr.Body.Bytes(), &e)
+	if rr.Code != http.StatusCreated || e.Currency != "EUR" || e.FxRate != 1.10 || e.BaseAmount != -110 {
+		t.Fatalf("unexpected EUR create: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr = do("POST", "/ledger", `{"type":"expense","amount":-5,"description":"Snacks","currency":"GBP"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a GBP rate, got %d", rr.Code)
+	}
+	if rr = do("POST", "/ledger", `{"type":"expense","amount":-5,"description":"Snacks","currency":"euro"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid currency, got %d", rr.Code)
+	}
+	rr = do("POST", "/ledger", `{"type":"income","amount":20,"description":"Sale"}`)
+	var base LedgerEntry
+	_ = json.Unmarshal(rr.Body.Bytes(), &base)
+	if base.Currency != BaseCurrency || base.BaseAmount != 20 {
+		t.Fatalf("expected base currency entry: %s", rr.Body.String())
+	}
+
+	rr = do("GET", "/ledger?currency=EUR", "")
+	var list []LedgerEntry
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != e.ID {
+		t.Fatalf("expected currency filter to match the EUR entry: %s", rr.Body.String())
+	}
+
+	if rr = do("GET", "/ledger/1/settlement", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 before settling, got %d", rr.Code)
+	}
+	rr = do("POST", "/ledger/1/settle", `{"settled_on":"2026-03-01","rate":1.12}`)
+	var s Settlement
+	_ = json.Unmarshal(rr.Body.Bytes(), &s)
+	if rr.Code != http.StatusCreated || s.BaseAmount != -112 || s.Difference != -2 || s.FxEntryID == nil {
+		t.Fatalf("unexpected settlement: %d %s", rr.Code, rr.Body.String())
+	}
+	if fxEntry, _ := repo.Get(context.Background(), *s.FxEntryID); fxEntry.Type != "fx" || fxEntry.Amount != -2 {
+		t.Fatalf("unexpected fx entry: %+v", fxEntry)
+	}
+	if rr = do("POST", "/ledger/1/settle", `{}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 on second settle, got %d", rr.Code)
+	}
+	if rr = do("POST", "/ledger/"+strconv.Itoa(int(base.ID))+"/settle", `{}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a base currency entry, got %d", rr.Code)
+	}
+	if rr = do("GET", "/ledger/1/settlement", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected settlement, got %d", rr.Code)
+	}
+}
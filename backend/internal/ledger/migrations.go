@@ -3,6 +3,7 @@ package ledger
 import (
 	"context"
 	"embed"
+	"fmt"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
@@ -12,7 +13,35 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-// ApplyMigrations applies this domain's SQL files in order.
+// ApplyMigrations applies this domain's SQL files in order, then labels
+// entries that predate currencies with BaseCurrency.
 func ApplyMigrations(ctx context.Context, pool *pgxpool.Pool) error {
-	return migrate.Apply(ctx, pool, migrationsFS, "migrations", "ledger")
+	if err := migrate.Apply(ctx, pool, migrationsFS, "migrations", "ledger"); err != nil {
+		return err
+	}
+	return backfillCurrency(ctx, pool, BaseCurrency)
+}
+
+// backfillCurrency sets the currency of entries written before 0008 to base
+// and makes the column NOT NULL. It does nothing once the column is.
+func backfillCurrency(ctx context.Context, pool *pgxpool.Pool, base string) error {
+	var nullable string
+	err := pool.QueryRow(ctx, `
+SELECT is_nullable FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name = 'ledger_entries' AND column_name = 'currency'`).Scan(&nullable)
+	if err != nil || nullable != "YES" {
+		return err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, `UPDATE ledger_entries SET currency = $1 WHERE currency IS NULL`, base); err != nil {
+		return fmt.Errorf("backfill currency: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `ALTER TABLE ledger_entries ALTER COLUMN currency SET NOT NULL`); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,6 @@
+-- backend/internal/ledger/migrations/0005_patronage_type.sql
+-- Allow patronage dividend allocations to be posted as ledger entries.
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_type_chk;
+ALTER TABLE ledger_entries
+  ADD CONSTRAINT ledger_entries_type_chk
+  CHECK (type IN ('dues', 'contribution', 'expense', 'income', 'patronage'));
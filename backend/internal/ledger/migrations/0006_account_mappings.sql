@@ -0,0 +1,8 @@
+-- backend/internal/ledger/migrations/0006_account_mappings.sql
+-- Map ledger entry types to chart-of-accounts names/codes used by exports.
+CREATE TABLE IF NOT EXISTS ledger_account_mappings (
+  ledger_type TEXT PRIMARY KEY,
+  account TEXT NOT NULL CHECK (length(trim(account)) > 0),
+  account_code TEXT NOT NULL DEFAULT '',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,36 @@
+-- backend/internal/ledger/migrations/0008_currency.sql
+-- Entries carry their currency and the rate used to convert them into the
+-- base currency. Existing entries are in the base currency, which only the
+-- server knows: ApplyMigrations fills in BASE_CURRENCY and then makes the
+-- column NOT NULL. There is no default, so every insert names its currency.
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS currency TEXT;
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS fx_rate NUMERIC(18,8) NOT NULL DEFAULT 1;
+ALTER TABLE ledger_entries ADD COLUMN IF NOT EXISTS base_amount DECIMAL(12,2);
+UPDATE ledger_entries SET base_amount = amount WHERE base_amount IS NULL;
+ALTER TABLE ledger_entries ALTER COLUMN base_amount SET NOT NULL;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname='ledger_entries_currency_chk') THEN
+    ALTER TABLE ledger_entries
+      ADD CONSTRAINT ledger_entries_currency_chk CHECK (currency ~ '^[A-Z]{3}$' AND fx_rate > 0);
+  END IF;
+END$$;
+
+-- Realized exchange differences are posted as 'fx' entries.
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_type_chk;
+ALTER TABLE ledger_entries
+  ADD CONSTRAINT ledger_entries_type_chk
+  CHECK (type IN ('dues', 'contribution', 'expense', 'income', 'patronage', 'capital', 'fx'));
+
+-- One settlement per foreign-currency entry: the rate the money actually
+-- moved at and the gain or loss against the booked base amount.
+CREATE TABLE IF NOT EXISTS ledger_fx_settlements (
+  entry_id INTEGER PRIMARY KEY REFERENCES ledger_entries(id) ON DELETE CASCADE,
+  settled_on DATE NOT NULL,
+  rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+  base_amount DECIMAL(12,2) NOT NULL,
+  difference DECIMAL(12,2) NOT NULL,
+  fx_entry_id INTEGER REFERENCES ledger_entries(id),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
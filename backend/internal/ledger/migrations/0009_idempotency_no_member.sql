@@ -0,0 +1,7 @@
+-- backend/internal/ledger/migrations/0009_idempotency_no_member.sql
+-- NULLs never collide in (member_id, idempotency_key), so entries without a
+-- member (customer invoice payments, bank lines) need their own index to
+-- make a retried post return the original entry.
+CREATE UNIQUE INDEX IF NOT EXISTS ux_ledger_idem_no_member
+  ON ledger_entries (idempotency_key)
+  WHERE member_id IS NULL AND idempotency_key IS NOT NULL;
@@ -10,13 +10,109 @@ type LedgerEntry struct {
 	MemberID    *int32    `json:"member_id"`
 	Notes       string    `json:"notes"`
 	CreatedAt   time.Time `json:"created_at"`
+	Currency    string    `json:"currency"`
+	FxRate      float64   `json:"fx_rate"`
+	BaseAmount  float64   `json:"base_amount"`
+}
+
+// BaseCurrency is the currency reports and exports are converted into. It
+// is set from BASE_CURRENCY at startup.
+var BaseCurrency = "USD"
+
+// Converted returns the entry's amount in BaseCurrency.
+func (e LedgerEntry) Converted() float64 {
+	if e.Currency == "" || e.Currency == BaseCurrency {
+		return e.Amount
+	}
+	return e.BaseAmount
+}
+
+// Settlement records the rate a foreign-currency entry actually settled at.
+// Difference is BaseAmount minus the entry's booked base amount: positive
+// is a realized gain, negative a loss. FxEntryID is the "fx" entry posting
+// it, nil when there was no difference.
+type Settlement struct {
+	EntryID    int32     `json:"entry_id"`
+	SettledOn  time.Time `json:"settled_on"`
+	Rate       float64   `json:"rate"`
+	BaseAmount float64   `json:"base_amount"`
+	Difference float64   `json:"difference"`
+	FxEntryID  *int32    `json:"fx_entry_id"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // ListFilters holds optional constraints for listing entries.
+// FromDate and ToDate are inclusive calendar dates; MinAmount and MaxAmount
+// are inclusive and compare the signed base amount. Search matches description
+// or notes case-insensitively. Sort is a key of SortOrders. Totals are
+// always in BaseCurrency.
 type ListFilters struct {
-    Type     string
-    MemberID *int32
-    // FromDate, ToDate omitted for now in implementation
+    Type      string
+    Types     []string
+    MemberID  *int32
+    FromDate  *time.Time
+    ToDate    *time.Time
+    MinAmount *float64
+    MaxAmount *float64
+    Currency  string
+    Search    string
+    Sort      string
     Limit  int
     Offset int
 }
+
+// SortOrders maps the accepted sort keys to ORDER BY clauses. A leading "-"
+// sorts descending; ties break on id. The default is "-id".
+var SortOrders = map[string]string{
+    "id":      "id ASC",
+    "-id":     "id DESC",
+    "date":    "created_at ASC, id ASC",
+    "-date":   "created_at DESC, id DESC",
+    "amount":  "amount ASC, id ASC",
+    "-amount": "amount DESC, id DESC",
+}
+
+// TypeTotal sums the filtered entries of one type.
+type TypeTotal struct {
+    Type  string  `json:"type"`
+    Count int     `json:"count"`
+    Sum   float64 `json:"sum"`
+}
+
+// Totals summarizes every entry matching a filter, ignoring pagination.
+// Inflow sums positive amounts and Outflow negative ones.
+type Totals struct {
+    Count   int         `json:"count"`
+    Sum     float64     `json:"sum"`
+    Inflow  float64     `json:"inflow"`
+    Outflow float64     `json:"outflow"`
+    ByType  []TypeTotal `json:"by_type"`
+}
+
+// ListPage is the GET /api/ledger response when totals are requested.
+type ListPage struct {
+    Entries []LedgerEntry `json:"entries"`
+    Totals  Totals        `json:"totals"`
+}
+
+// Types lists every entry type allowed by ledger_entries_type_chk.
+var Types = []string{"dues", "contribution", "expense", "income", "patronage", "capital", "fx"}
+
+// ValidType reports whether t is a known ledger entry type.
+func ValidType(t string) bool {
+    for _, v := range Types {
+        if v == t {
+            return true
+        }
+    }
+    return false
+}
+
+// AccountMapping maps a ledger type to the account it lands in when imported
+// into external accounting software.
+type AccountMapping struct {
+    LedgerType  string    `json:"ledger_type"`
+    Account     string    `json:"account"`
+    AccountCode string    `json:"account_code"`
+    UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
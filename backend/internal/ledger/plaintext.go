@@ -0,0 +1,406 @@
+package ledger
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// JournalFormats lists the plain-text accounting export formats.
+var JournalFormats = map[string]ExportProfile{
+	"ledger":    {Name: "ledger", ContentType: "text/plain; charset=utf-8", Extension: "ledger", Write: writeLedgerJournal},
+	"hledger":   {Name: "hledger", ContentType: "text/plain; charset=utf-8", Extension: "journal", Write: writeHledgerJournal},
+	"beancount": {Name: "beancount", ContentType: "text/plain; charset=utf-8", Extension: "beancount", Write: writeBeancount},
+}
+
+// PlainAccounts are the journal accounts used for types without a
+// configured AccountMapping.
+var PlainAccounts = map[string]string{
+	"dues":         "Income:Dues",
+	"contribution": "Income:Contributions",
+	"income":       "Income:Other",
+	"expense":      "Expenses:General",
+	"patronage":    "Equity:Patronage",
+	"capital":      "Equity:Member-Capital",
+	"fx":           "Income:Foreign-Exchange",
+}
+
+// PlainAccount returns the hierarchical account a ledger type posts to in
+// plain-text journals. Mapped accounts that already contain ":" are used as
+// is; other mapped names are placed under Income, Expenses or Equity.
+func PlainAccount(accounts map[string]AccountMapping, ledgerType string) string {
+	m, ok := accounts[ledgerType]
+	if !ok {
+		if a, ok := PlainAccounts[ledgerType]; ok {
+			return a
+		}
+		return "Income:" + ledgerType
+	}
+	if strings.Contains(m.Account, ":") {
+		return m.Account
+	}
+	root := "Income"
+	switch ledgerType {
+	case "expense":
+		root = "Expenses"
+	case "patronage", "capital":
+		root = "Equity"
+	}
+	return root + ":" + m.Account
+}
+
+// BeancountAccount rewrites an account name into beancount's stricter
+// syntax: capitalized components of letters, digits and dashes.
+func BeancountAccount(name string) string {
+	parts := strings.Split(name, ":")
+	for i, p := range parts {
+		var b strings.Builder
+		for _, r := range strings.Join(strings.Fields(p), "-") {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+				b.WriteRune(r)
+			}
+		}
+		c := []rune(b.String())
+		if len(c) == 0 {
+			c = []rune("X")
+		}
+		if !unicode.IsUpper(c[0]) {
+			if unicode.IsLetter(c[0]) {
+				c[0] = unicode.ToUpper(c[0])
+			} else {
+				c = append([]rune("X"), c...)
+			}
+		}
+		parts[i] = string(c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// chronological returns entries oldest first, as journals expect.
+func chronological(entries []LedgerEntry) []LedgerEntry {
+	out := append([]LedgerEntry(nil), entries...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// writeLedgerJournal writes ledger-cli syntax with the entry id as both the
+// transaction code and an "entry_id" metadata tag.
+func writeLedgerJournal(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, bankAccount string) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range chronological(entries) {
+		fmt.Fprintf(bw, "%s * (%d) %s\n", e.CreatedAt.UTC().Format("2006-01-02"), e.ID, oneLine(e.Description))
+		fmt.Fprintf(bw, "    ; entry_id: %d\n    ; type: %s\n", e.ID, e.Type)
+		if e.MemberID != nil {
+			fmt.Fprintf(bw, "    ; member_id: %d\n", *e.MemberID)
+		}
+		if e.Notes != "" {
+			fmt.Fprintf(bw, "    ; notes: %s\n", oneLine(e.Notes))
+		}
+		fmt.Fprintf(bw, "    %s  %s %s\n", bankAccount, money(e.Converted()), BaseCurrency)
+		fmt.Fprintf(bw, "    %s  %s %s\n\n", PlainAccount(accounts, e.Type), money(-e.Converted()), BaseCurrency)
+	}
+	return bw.Flush()
+}
+
+// writeHledgerJournal writes hledger syntax; metadata are transaction tags.
+func writeHledgerJournal(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, bankAccount string) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range chronological(entries) {
+		tags := fmt.Sprintf("entry_id:%d, type:%s", e.ID, e.Type)
+		if e.MemberID != nil {
+			tags += fmt.Sprintf(", member_id:%d", *e.MemberID)
+		}
+		fmt.Fprintf(bw, "%s * (%d) %s  ; %s\n", e.CreatedAt.UTC().Format("2006-01-02"), e.ID, oneLine(strings.ReplaceAll(e.Description, ";", ",")), tags)
+		if e.Notes != "" {
+			fmt.Fprintf(bw, "    ; %s\n", oneLine(e.Notes))
+		}
+		fmt.Fprintf(bw, "    %s  %s %s\n", bankAccount, money(e.Converted()), BaseCurrency)
+		fmt.Fprintf(bw, "    %s  %s %s\n\n", PlainAccount(accounts, e.Type), money(-e.Converted()), BaseCurrency)
+	}
+	return bw.Flush()
+}
+
+// writeBeancount writes a beancount file, opening every account used on the
+// date of the first entry so the output validates with bean-check.
+func writeBeancount(w io.Writer, entries []LedgerEntry, accounts map[string]AccountMapping, bankAccount string) error {
+	bw := bufio.NewWriter(w)
+	sorted := chronological(entries)
+	fmt.Fprintf(bw, "option \"operating_currency\" \"%s\"\n\n", BaseCurrency)
+	if len(sorted) > 0 {
+		opened := map[string]bool{}
+		open := []string{BeancountAccount(bankAccount)}
+		for _, e := range sorted {
+			open = append(open, BeancountAccount(PlainAccount(accounts, e.Type)))
+		}
+		first := sorted[0].CreatedAt.UTC().Format("2006-01-02")
+		for _, a := range open {
+			if !opened[a] {
+				opened[a] = true
+				fmt.Fprintf(bw, "%s open %s %s\n", first, a, BaseCurrency)
+			}
+		}
+		bw.WriteString("\n")
+	}
+	for _, e := range sorted {
+		fmt.Fprintf(bw, "%s * ", e.CreatedAt.UTC().Format("2006-01-02"))
+		if e.MemberID != nil {
+			fmt.Fprintf(bw, "%s ", beanString(fmt.Sprintf("Member %d", *e.MemberID)))
+		}
+		fmt.Fprintf(bw, "%s\n  entry_id: %d\n  type: %s\n", beanString(e.Description), e.ID, beanString(e.Type))
+		if e.MemberID != nil {
+			fmt.Fprintf(bw, "  member_id: %d\n", *e.MemberID)
+		}
+		if e.Notes != "" {
+			fmt.Fprintf(bw, "  notes: %s\n", beanString(e.Notes))
+		}
+		fmt.Fprintf(bw, "  %s  %s %s\n", BeancountAccount(bankAccount), money(e.Converted()), BaseCurrency)
+		fmt.Fprintf(bw, "  %s  %s %s\n\n", BeancountAccount(PlainAccount(accounts, e.Type)), money(-e.Converted()), BaseCurrency)
+	}
+	return bw.Flush()
+}
+
+func beanString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "\r", "").Replace(s) + `"`
+}
+
+// ImportEntry is a historical ledger entry read from another system. Date is
+// kept as the entry's created_at; Key makes re-importing the same file a no-op.
+type ImportEntry struct {
+	Line        int       `json:"line"`
+	Date        time.Time `json:"date"`
+	Type        string    `json:"type"`
+	Amount      float64   `json:"amount"`
+	Description string    `json:"description"`
+	MemberID    *int32    `json:"member_id"`
+	Notes       string    `json:"notes"`
+	Key         string    `json:"key"`
+}
+
+// ImportSkip explains why a transaction in an import file was not used.
+type ImportSkip struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+var (
+	beanTxnRe     = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+(\*|!|txn)(?:\s+(.*))?$`)
+	beanStringRe  = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+	beanMetaRe    = regexp.MustCompile(`^([a-z][A-Za-z0-9_-]*):\s*(.*)$`)
+	beanPostingRe = regexp.MustCompile(`^[*!]?\s*([A-Z][A-Za-z0-9-]*(?::[A-Za-z0-9-]+)+)(?:\s+(-?[0-9][0-9,]*(?:\.[0-9]+)?)\s+([A-Z][A-Z0-9'._-]*))?`)
+)
+
+// beanTxn is a parsed beancount transaction.
+type beanTxn struct {
+	line      int
+	date      time.Time
+	payee     string
+	narration string
+	meta      map[string]string
+	postings  []beanPosting
+}
+
+type beanPosting struct {
+	account  string
+	amount   float64
+	currency string
+	elided   bool
+}
+
+// ParseBeancount converts the transactions in a beancount file into ledger
+// entries. The entry amount is the net of the postings to Assets accounts
+// (the cash movement); the type comes from "type" metadata when present,
+// otherwise from the counter account, matched against the configured
+// account mappings first and then by its Income/Expenses/Equity root.
+// Other directives (open, balance, price, ...) are ignored. Transactions
+// that cannot be represented, such as transfers between asset accounts or
+// postings in another currency, are returned as skips.
+func ParseBeancount(r io.Reader, accounts map[string]AccountMapping) ([]ImportEntry, []ImportSkip, error) {
+	byAccount := map[string]string{}
+	for _, t := range Types {
+		byAccount[BeancountAccount(PlainAccount(accounts, t))] = t
+	}
+
+	var txns []*beanTxn
+	var cur *beanTxn
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	n := 0
+	for sc.Scan() {
+		n++
+		raw := sc.Text()
+		text := strings.TrimSpace(stripComment(raw))
+		if text == "" {
+			continue
+		}
+		indented := raw[0] == ' ' || raw[0] == '\t'
+		if !indented {
+			cur = nil
+			m := beanTxnRe.FindStringSubmatch(text)
+			if m == nil {
+				continue
+			}
+			d, err := time.Parse("2006-01-02", m[1])
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid date %q", n, m[1])
+			}
+			cur = &beanTxn{line: n, date: d, meta: map[string]string{}}
+			strs := beanStringRe.FindAllStringSubmatch(m[3], -1)
+			switch len(strs) {
+			case 0:
+			case 1:
+				cur.narration = unescapeBean(strs[0][1])
+			default:
+				cur.payee, cur.narration = unescapeBean(strs[0][1]), unescapeBean(strs[1][1])
+			}
+			txns = append(txns, cur)
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		if m := beanMetaRe.FindStringSubmatch(text); m != nil {
+			v := strings.TrimSpace(m[2])
+			if s := beanStringRe.FindStringSubmatch(v); s != nil && strings.HasPrefix(v, `"`) {
+				v = unescapeBean(s[1])
+			}
+			cur.meta[m[1]] = v
+			continue
+		}
+		m := beanPostingRe.FindStringSubmatch(text)
+		if m == nil {
+			return nil, nil, fmt.Errorf("line %d: cannot parse %q", n, text)
+		}
+		p := beanPosting{account: m[1], currency: m[3], elided: m[2] == ""}
+		if !p.elided {
+			v, err := strconv.ParseFloat(strings.ReplaceAll(m[2], ",", ""), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: invalid amount %q", n, m[2])
+			}
+			p.amount = v
+		}
+		cur.postings = append(cur.postings, p)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var out []ImportEntry
+	var skips []ImportSkip
+	seen := map[string]int{}
+	for _, t := range txns {
+		e, reason := beanEntry(t, byAccount)
+		if reason != "" {
+			skips = append(skips, ImportSkip{Line: t.line, Reason: reason})
+			continue
+		}
+		base := fmt.Sprintf("%s|%.2f|%s", e.Date.Format("2006-01-02"), e.Amount, e.Description)
+		if id := t.meta["entry_id"]; id != "" {
+			base = "id|" + id
+		}
+		seen[base]++
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s|%d", base, seen[base])))
+		e.Key = "beancount:" + hex.EncodeToString(sum[:8])
+		out = append(out, e)
+	}
+	return out, skips, nil
+}
+
+func beanEntry(t *beanTxn, byAccount map[string]string) (ImportEntry, string) {
+	e := ImportEntry{Line: t.line, Date: t.date, Description: t.narration, Notes: t.meta["notes"]}
+	if e.Description == "" {
+		e.Description = t.payee
+	}
+	if e.Description == "" {
+		return e, "missing narration"
+	}
+	// Fill in a single elided posting so the transaction balances.
+	elided, sum := -1, 0.0
+	for i, p := range t.postings {
+		if p.elided {
+			if elided >= 0 {
+				return e, "more than one posting without an amount"
+			}
+			elided = i
+			continue
+		}
+		if p.currency != BaseCurrency {
+			return e, "unsupported currency " + p.currency
+		}
+		sum += p.amount
+	}
+	if elided >= 0 {
+		t.postings[elided].amount, t.postings[elided].currency = -sum, BaseCurrency
+	}
+	counter := ""
+	for _, p := range t.postings {
+		if strings.HasPrefix(p.account, "Assets:") {
+			e.Amount += p.amount
+		} else if counter == "" {
+			counter = p.account
+		}
+	}
+	e.Amount = math.Round(e.Amount*100) / 100
+	if e.Amount == 0 {
+		return e, "no cash movement in Assets accounts"
+	}
+	if v := t.meta["type"]; ValidType(v) {
+		e.Type = v
+	} else if v, ok := byAccount[counter]; ok {
+		e.Type = v
+	} else {
+		switch strings.SplitN(counter, ":", 2)[0] {
+		case "Income":
+			e.Type = "income"
+		case "Expenses":
+			e.Type = "expense"
+		case "Equity":
+			e.Type = "contribution"
+		default:
+			return e, "cannot determine type for account " + counter
+		}
+	}
+	if v := t.meta["member_id"]; v != "" {
+		id, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return e, "invalid member_id"
+		}
+		id32 := int32(id)
+		e.MemberID = &id32
+	}
+	return e, ""
+}
+
+func stripComment(s string) string {
+	inString := false
+	for i, r := range s {
+		switch {
+		case r == '"' && (i == 0 || s[i-1] != '\\'):
+			inString = !inString
+		case r == ';' && !inString:
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func unescapeBean(s string) string {
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
@@ -3,20 +3,47 @@ package ledger
 import (
 	"context"
 	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var ErrNotFound = errors.New("ledger entry not found")
+var (
+    ErrNotFound = errors.New("ledger entry not found")
+    ErrConflict = errors.New("ledger entry cannot be settled")
+)
 
 type Repo interface {
     List(ctx context.Context, filters *ListFilters) ([]LedgerEntry, error)
+    // Totals summarizes all entries matching filters; Limit and Offset are
+    // ignored.
+    Totals(ctx context.Context, filters *ListFilters) (Totals, error)
     Get(ctx context.Context, id int32) (LedgerEntry, error)
     // Create inserts a new ledger entry. If idempotencyKey is provided and a prior
     // matching record exists for the member, it returns that record with replayed=true.
     Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (entry LedgerEntry, replayed bool, err error)
+    // CreateInCurrency is Create for an amount in currency, recording rate
+    // and the converted base amount. Create uses BaseCurrency at rate 1.
+    CreateInCurrency(ctx context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, idempotencyKey string) (entry LedgerEntry, replayed bool, err error)
+    // Settle records that a foreign-currency entry settled at rate on
+    // settledOn and posts the realized difference as an "fx" entry.
+    // ErrConflict when the entry is in the base currency or already settled.
+    Settle(ctx context.Context, entryID int32, settledOn time.Time, rate float64) (Settlement, error)
+    // GetSettlement returns ErrNotFound when the entry is unsettled.
+    GetSettlement(ctx context.Context, entryID int32) (Settlement, error)
+    // ListAccounts returns the configured export account mappings.
+    ListAccounts(ctx context.Context) ([]AccountMapping, error)
+    // SetAccount creates or replaces the mapping for m.LedgerType.
+    SetAccount(ctx context.Context, m AccountMapping) (AccountMapping, error)
+    // Import inserts historical entries with their original dates in one
+    // transaction, skipping entries whose Key was imported before. It returns
+    // the number inserted.
+    Import(ctx context.Context, entries []ImportEntry) (int, error)
 }
 
 type PgRepo struct {
@@ -28,45 +55,25 @@ func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
 }
 
 func (r *PgRepo) List(ctx context.Context, filters *ListFilters) ([]LedgerEntry, error) {
+    where, args := listWhere(filters)
     query := `
-SELECT id, type, amount, description, member_id, COALESCE(notes,''), created_at
-FROM ledger_entries`
-    args := []any{}
-    where := ""
+SELECT ` + entryColumns + `
+FROM ledger_entries` + where
     if filters != nil {
-        argPos := 0
-        if filters.Type != "" {
-            argPos++
-            if where == "" {
-                where = " WHERE"
-            } else {
-                where += " AND"
-            }
-            where += " type=$" + itoa(argPos)
-            args = append(args, filters.Type)
-        }
-        if filters.MemberID != nil {
-            argPos++
-            if where == "" {
-                where = " WHERE"
-            } else {
-                where += " AND"
-            }
-            where += " member_id=$" + itoa(argPos)
-            args = append(args, *filters.MemberID)
+        order, ok := SortOrders[filters.Sort]
+        if !ok {
+            order = SortOrders["-id"]
         }
-        query += where + " ORDER BY id DESC"
+        query += " ORDER BY " + order
 
         // Pagination
         if filters.Limit > 0 {
-            argPos++
-            query += " LIMIT $" + itoa(argPos)
             args = append(args, filters.Limit)
+            query += " LIMIT $" + itoa(len(args))
         }
         if filters.Offset > 0 {
-            argPos++
-            query += " OFFSET $" + itoa(argPos)
             args = append(args, filters.Offset)
+            query += " OFFSET $" + itoa(len(args))
         }
     } else {
         query += " ORDER BY id DESC"
@@ -80,94 +87,221 @@ FROM ledger_entries`
 
 	var out []LedgerEntry
 	for rows.Next() {
-		var e LedgerEntry
-		var memberID pgtype.Int4
-		var ts pgtype.Timestamptz
-		if err := rows.Scan(&e.ID, &e.Type, &e.Amount, &e.Description, &memberID, &e.Notes, &ts); err != nil {
+		e, err := scanEntry(rows)
+		if err != nil {
 			return nil, err
 		}
-		if memberID.Valid {
-			e.MemberID = &memberID.Int32
-		}
-		e.CreatedAt = ts.Time
 		out = append(out, e)
 	}
 	return out, rows.Err()
 }
 
-func (r *PgRepo) Get(ctx context.Context, id int32) (LedgerEntry, error) {
-	var e LedgerEntry
-	var memberID pgtype.Int4
-	err := r.Pool.QueryRow(ctx, `
-SELECT id, type, amount, description, member_id, COALESCE(notes,''), created_at
-FROM ledger_entries
-WHERE id=$1`, id).Scan(&e.ID, &e.Type, &e.Amount, &e.Description, &memberID, &e.Notes, &e.CreatedAt)
+func (r *PgRepo) Totals(ctx context.Context, filters *ListFilters) (Totals, error) {
+	where, args := listWhere(filters)
+	rows, err := r.Pool.Query(ctx, `
+SELECT type, COUNT(*), COALESCE(SUM(base_amount),0)::float8,
+  COALESCE(SUM(base_amount) FILTER (WHERE base_amount > 0),0)::float8,
+  COALESCE(SUM(base_amount) FILTER (WHERE base_amount < 0),0)::float8
+FROM ledger_entries`+where+`
+GROUP BY type
+ORDER BY type`, args...)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return LedgerEntry{}, ErrNotFound
+		return Totals{}, err
+	}
+	defer rows.Close()
+
+	out := Totals{ByType: []TypeTotal{}}
+	for rows.Next() {
+		var t TypeTotal
+		var inflow, outflow float64
+		if err := rows.Scan(&t.Type, &t.Count, &t.Sum, &inflow, &outflow); err != nil {
+			return Totals{}, err
 		}
-		return LedgerEntry{}, err
+		out.Count += t.Count
+		out.Sum += t.Sum
+		out.Inflow += inflow
+		out.Outflow += outflow
+		out.ByType = append(out.ByType, t)
 	}
-	if memberID.Valid {
-		e.MemberID = &memberID.Int32
+	out.Sum, out.Inflow, out.Outflow = round2(out.Sum), round2(out.Inflow), round2(out.Outflow)
+	return out, rows.Err()
+}
+
+// listWhere builds the WHERE clause shared by List and Totals.
+func listWhere(filters *ListFilters) (string, []any) {
+	args := []any{}
+	where := ""
+	// addCond appends cond with each "$" placeholder numbered for arg.
+	addCond := func(cond string, arg any) {
+		args = append(args, arg)
+		if where == "" {
+			where = " WHERE"
+		} else {
+			where += " AND"
+		}
+		where += " " + strings.ReplaceAll(cond, "$", "$"+itoa(len(args)))
 	}
-	return e, nil
+	if filters == nil {
+		return where, args
+	}
+	if filters.Type != "" {
+		addCond("type=$", filters.Type)
+	}
+	if len(filters.Types) > 0 {
+		addCond("type = ANY($)", filters.Types)
+	}
+	if filters.MemberID != nil {
+		addCond("member_id=$", *filters.MemberID)
+	}
+	if filters.FromDate != nil {
+		addCond("created_at >= $", *filters.FromDate)
+	}
+	if filters.ToDate != nil {
+		addCond("created_at < $", filters.ToDate.AddDate(0, 0, 1))
+	}
+	if filters.Currency != "" {
+		addCond("currency=$", filters.Currency)
+	}
+	if filters.MinAmount != nil {
+		addCond("base_amount >= $", *filters.MinAmount)
+	}
+	if filters.MaxAmount != nil {
+		addCond("base_amount <= $", *filters.MaxAmount)
+	}
+	if filters.Search != "" {
+		addCond(`(description ILIKE $ ESCAPE '\' OR notes ILIKE $ ESCAPE '\')`, "%"+likeEscaper.Replace(filters.Search)+"%")
+	}
+	return where, args
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (r *PgRepo) Get(ctx context.Context, id int32) (LedgerEntry, error) {
+	e, err := scanEntry(r.Pool.QueryRow(ctx, `SELECT `+entryColumns+` FROM ledger_entries WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return LedgerEntry{}, ErrNotFound
+	}
+	return e, err
 }
 
 func (r *PgRepo) Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (LedgerEntry, bool, error) {
-    var e LedgerEntry
+    return r.CreateInCurrency(ctx, entryType, description, amount, BaseCurrency, 1, memberID, notes, idempotencyKey)
+}
+
+func (r *PgRepo) CreateInCurrency(ctx context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, idempotencyKey string) (LedgerEntry, bool, error) {
     var memberIDParam pgtype.Int4
     if memberID != nil {
         memberIDParam.Int32 = *memberID
         memberIDParam.Valid = true
     }
+    baseAmount := round2(amount * rate)
 
-    if idempotencyKey != "" && memberIDParam.Valid {
-        // Try insert; if duplicate, select existing by (member_id, idempotency_key)
-        err := r.Pool.QueryRow(ctx, `
-INSERT INTO ledger_entries (type, amount, description, member_id, notes, idempotency_key)
-VALUES ($1,$2,$3,$4,$5,$6)
-RETURNING id, type, amount, description, member_id, COALESCE(notes,''), created_at
-`, entryType, amount, description, memberIDParam, notes, idempotencyKey).Scan(&e.ID, &e.Type, &e.Amount, &e.Description, &memberIDParam, &e.Notes, &e.CreatedAt)
+    if idempotencyKey != "" {
+        // Try insert; if duplicate, select existing by (member_id, idempotency_key).
+        // Entries without a member are unique by key (ux_ledger_idem_no_member).
+        e, err := scanEntry(r.Pool.QueryRow(ctx, `
+INSERT INTO ledger_entries (type, amount, description, member_id, notes, idempotency_key, currency, fx_rate, base_amount)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+RETURNING `+entryColumns, entryType, amount, description, memberIDParam, notes, idempotencyKey, currency, rate, baseAmount))
         if err != nil {
             // On any insert error, attempt to fetch existing idempotent record
-            var existing LedgerEntry
-            var mid pgtype.Int4
-            var ts pgtype.Timestamptz
-            err2 := r.Pool.QueryRow(ctx, `
-SELECT id, type, amount, description, member_id, COALESCE(notes,''), created_at
+            existing, err2 := scanEntry(r.Pool.QueryRow(ctx, `
+SELECT `+entryColumns+`
 FROM ledger_entries
-WHERE member_id=$1 AND idempotency_key=$2
-LIMIT 1`, memberIDParam, idempotencyKey).Scan(&existing.ID, &existing.Type, &existing.Amount, &existing.Description, &mid, &existing.Notes, &ts)
+WHERE member_id IS NOT DISTINCT FROM $1 AND idempotency_key=$2
+LIMIT 1`, memberIDParam, idempotencyKey))
             if err2 != nil {
                 return LedgerEntry{}, false, err
             }
-            if mid.Valid {
-                existing.MemberID = &mid.Int32
-            }
-            existing.CreatedAt = ts.Time
             return existing, true, nil
         }
-        if memberIDParam.Valid {
-            e.MemberID = &memberIDParam.Int32
-        }
         return e, false, nil
     }
 
-    err := r.Pool.QueryRow(ctx, `
-INSERT INTO ledger_entries (type, amount, description, member_id, notes)
-VALUES ($1,$2,$3,$4,$5)
-RETURNING id, type, amount, description, member_id, COALESCE(notes,''), created_at
-`, entryType, amount, description, memberIDParam, notes).Scan(&e.ID, &e.Type, &e.Amount, &e.Description, &memberIDParam, &e.Notes, &e.CreatedAt)
+    e, err := scanEntry(r.Pool.QueryRow(ctx, `
+INSERT INTO ledger_entries (type, amount, description, member_id, notes, currency, fx_rate, base_amount)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+RETURNING `+entryColumns, entryType, amount, description, memberIDParam, notes, currency, rate, baseAmount))
     if err != nil {
         return LedgerEntry{}, false, err
     }
-    if memberIDParam.Valid {
-        e.MemberID = &memberIDParam.Int32
-    }
     return e, false, nil
 }
 
+func (r *PgRepo) ListAccounts(ctx context.Context) ([]AccountMapping, error) {
+    rows, err := r.Pool.Query(ctx, `
+SELECT ledger_type, account, account_code, updated_at
+FROM ledger_account_mappings
+ORDER BY ledger_type`)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var out []AccountMapping
+    for rows.Next() {
+        var m AccountMapping
+        if err := rows.Scan(&m.LedgerType, &m.Account, &m.AccountCode, &m.UpdatedAt); err != nil {
+            return nil, err
+        }
+        out = append(out, m)
+    }
+    return out, rows.Err()
+}
+
+func (r *PgRepo) SetAccount(ctx context.Context, m AccountMapping) (AccountMapping, error) {
+    var out AccountMapping
+    err := r.Pool.QueryRow(ctx, `
+INSERT INTO ledger_account_mappings (ledger_type, account, account_code)
+VALUES ($1,$2,$3)
+ON CONFLICT (ledger_type) DO UPDATE
+SET account=EXCLUDED.account, account_code=EXCLUDED.account_code, updated_at=now()
+RETURNING ledger_type, account, account_code, updated_at
+`, m.LedgerType, m.Account, m.AccountCode).Scan(&out.LedgerType, &out.Account, &out.AccountCode, &out.UpdatedAt)
+    return out, err
+}
+
+func (r *PgRepo) Import(ctx context.Context, entries []ImportEntry) (int, error) {
+    tx, err := r.Pool.Begin(ctx)
+    if err != nil {
+        return 0, err
+    }
+    defer func() { _ = tx.Rollback(ctx) }()
+
+    inserted := 0
+    for _, e := range entries {
+        tag, err := tx.Exec(ctx, `
+INSERT INTO ledger_entries (type, amount, description, member_id, notes, idempotency_key, created_at, currency, base_amount)
+SELECT $1::text, $2::numeric, $3::text, $4::int, $5::text, $6::text, $7::timestamptz, $8::text, $2::numeric
+WHERE NOT EXISTS (SELECT 1 FROM ledger_entries WHERE idempotency_key=$6)`,
+            e.Type, e.Amount, e.Description, e.MemberID, e.Notes, e.Key, e.Date, BaseCurrency)
+        if err != nil {
+            return 0, err
+        }
+        inserted += int(tag.RowsAffected())
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return 0, err
+    }
+    return inserted, nil
+}
+
+const entryColumns = `id, type, amount, description, member_id, COALESCE(notes,''), created_at, currency, fx_rate::float8, base_amount::float8`
+
+func scanEntry(row pgx.Row) (LedgerEntry, error) {
+	var e LedgerEntry
+	var memberID pgtype.Int4
+	var ts pgtype.Timestamptz
+	if err := row.Scan(&e.ID, &e.Type, &e.Amount, &e.Description, &memberID, &e.Notes, &ts, &e.Currency, &e.FxRate, &e.BaseAmount); err != nil {
+		return LedgerEntry{}, err
+	}
+	if memberID.Valid {
+		e.MemberID = &memberID.Int32
+	}
+	e.CreatedAt = ts.Time
+	return e, nil
+}
+
 func itoa(v int) string {
 	const digits = "0123456789"
 	if v == 0 {
@@ -181,3 +315,74 @@ func itoa(v int) string {
 	}
 	return string(buf)
 }
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func (r *PgRepo) Settle(ctx context.Context, entryID int32, settledOn time.Time, rate float64) (Settlement, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return Settlement{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	e, err := scanEntry(tx.QueryRow(ctx, `SELECT `+entryColumns+` FROM ledger_entries WHERE id=$1 FOR UPDATE`, entryID))
+	if err == pgx.ErrNoRows {
+		return Settlement{}, ErrNotFound
+	}
+	if err != nil {
+		return Settlement{}, err
+	}
+	var settled bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM ledger_fx_settlements WHERE entry_id=$1)`, entryID).Scan(&settled); err != nil {
+		return Settlement{}, err
+	}
+	if settled || e.Currency == BaseCurrency {
+		return Settlement{}, ErrConflict
+	}
+
+	s := Settlement{EntryID: entryID, SettledOn: settledOn, Rate: rate, BaseAmount: round2(e.Amount * rate)}
+	s.Difference = round2(s.BaseAmount - e.BaseAmount)
+	if s.Difference != 0 {
+		var id int32
+		err := tx.QueryRow(ctx, `
+INSERT INTO ledger_entries (type, amount, description, member_id, notes, created_at, currency, base_amount)
+VALUES ('fx', $1, $2, $3, $4, $5, $6, $1)
+RETURNING id`, s.Difference, "Realized FX difference on entry #"+itoa(int(entryID)), e.MemberID,
+			e.Currency+" "+strconv.FormatFloat(e.Amount, 'f', 2, 64)+" booked at "+strconv.FormatFloat(e.FxRate, 'f', -1, 64)+", settled at "+strconv.FormatFloat(rate, 'f', -1, 64),
+			settledOn, BaseCurrency).Scan(&id)
+		if err != nil {
+			return Settlement{}, err
+		}
+		s.FxEntryID = &id
+	}
+	err = tx.QueryRow(ctx, `
+INSERT INTO ledger_fx_settlements (entry_id, settled_on, rate, base_amount, difference, fx_entry_id)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING created_at`, s.EntryID, s.SettledOn, s.Rate, s.BaseAmount, s.Difference, s.FxEntryID).Scan(&s.CreatedAt)
+	if err != nil {
+		return Settlement{}, err
+	}
+	return s, tx.Commit(ctx)
+}
+
+func (r *PgRepo) GetSettlement(ctx context.Context, entryID int32) (Settlement, error) {
+	s := Settlement{EntryID: entryID}
+	var on pgtype.Date
+	var fxID pgtype.Int4
+	err := r.Pool.QueryRow(ctx, `
+SELECT settled_on, rate::float8, base_amount::float8, difference::float8, fx_entry_id, created_at
+FROM ledger_fx_settlements WHERE entry_id=$1`, entryID).Scan(&on, &s.Rate, &s.BaseAmount, &s.Difference, &fxID, &s.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return Settlement{}, ErrNotFound
+	}
+	if err != nil {
+		return Settlement{}, err
+	}
+	s.SettledOn = on.Time
+	if fxID.Valid {
+		s.FxEntryID = &fxID.Int32
+	}
+	return s, nil
+}
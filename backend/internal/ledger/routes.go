@@ -10,7 +10,13 @@ func Mount(r chi.Router, h Handlers) {
         r.Get("/", h.List)
         r.Get("/.csv", h.ExportCSV)
         r.With(httpmw.RequireAuth).Post("/", h.Create)
+        r.Get("/journal", h.ExportJournal)
+        r.With(httpmw.RequirePermission("ledger.import")).Post("/import/beancount", h.ImportBeancount)
+        r.Get("/accounts", h.ListAccounts)
+        r.With(httpmw.RequirePermission("ledger.accounts")).Put("/accounts/{type}", h.SetAccount)
         r.Get("/{id}", h.Get)
+        r.Get("/{id}/settlement", h.GetSettlement)
+        r.With(httpmw.RequirePermission("ledger.settle")).Post("/{id}/settle", h.Settle)
     }
 	r.Route("/ledger", route)
 }
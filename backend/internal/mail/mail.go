@@ -0,0 +1,95 @@
+// Package mail sends plain-text email through a pluggable Mailer: SMTP in
+// production, and a file or log mailer for development and tests.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message is one plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Format renders m as an RFC 5322 message from the given address.
+func Format(from string, m Message, now time.Time) []byte {
+	var b bytes.Buffer
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = strings.Trim(from[i+1:], "> ")
+	}
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// File writes each message to Dir as an .eml file, for development and
+// tests.
+type File struct {
+	Dir  string
+	From string
+	seq  atomic.Int64
+}
+
+func (f *File) Send(_ context.Context, m Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%03d-%s.eml", now.UTC().Format("20060102T150405"), f.seq.Add(1), sanitize(m.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), Format(f.From, m, now), 0o600)
+}
+
+// Log writes messages to the standard logger instead of sending them. Link
+// queries and fragments carry sign-in and confirmation tokens, so they are
+// redacted; use File to follow the links in development.
+type Log struct{}
+
+func (Log) Send(_ context.Context, m Message) error {
+	log.Printf("mail to %s: %s\n%s", m.To, m.Subject, redact(m.Text))
+	return nil
+}
+
+var linkQuery = regexp.MustCompile(`(https?://[^\s?#]+)[?#]\S*`)
+
+// redact replaces the query and fragment of every link in text.
+func redact(text string) string {
+	return linkQuery.ReplaceAllString(text, "$1?[redacted]")
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '@' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
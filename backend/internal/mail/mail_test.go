@@ -0,0 +1,102 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	raw := string(Format("Coop <noreply@coop.example>", Message{
+		To:      "ana@example.com",
+		Subject: "Café hours",
+		Text:    "line one\nline two\r\nline three",
+	}, now))
+	head, body, ok := strings.Cut(raw, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no blank line between headers and body:\n%q", raw)
+	}
+	for _, want := range []string{
+		"From: Coop <noreply@coop.example>",
+		"To: ana@example.com",
+		"Subject: =?utf-8?q?Caf=C3=A9_hours?=",
+		"Date: Mon, 02 Mar 2026 09:30:00 +0000",
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	} {
+		if !strings.Contains(head+"\r\n", want+"\r\n") {
+			t.Errorf("missing header %q in:\n%s", want, head)
+		}
+	}
+	if !strings.Contains(head, "Message-ID: <") || !strings.Contains(head, "@coop.example>") {
+		t.Errorf("expected a Message-ID at the sender's domain:\n%s", head)
+	}
+	if body != "line one\r\nline two\r\nline three" {
+		t.Errorf("expected CRLF line endings, got %q", body)
+	}
+	if strings.Contains(strings.ReplaceAll(raw, "\r\n", ""), "\n") {
+		t.Errorf("bare LF in message: %q", raw)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	f := &File{Dir: dir, From: "noreply@coop.example"}
+	for _, to := range []string{"ana@example.com", "../bo@example.com"} {
+		if err := f.Send(context.Background(), Message{To: to, Subject: "Hi", Text: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".eml") || strings.Contains(e.Name(), "/") || strings.HasPrefix(e.Name(), ".") {
+			t.Errorf("unexpected file name %q", e.Name())
+		}
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Errorf("%s: expected mode 0600, got %v", e.Name(), info.Mode().Perm())
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("To: ana@example.com\r\n")) || !bytes.HasSuffix(data, []byte("\r\n\r\nhello")) {
+		t.Errorf("unexpected message:\n%s", data)
+	}
+}
+
+func TestLog_RedactsLinks(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	text := "Sign in: https://coop.example/login/verify?token=secret123\nOr http://localhost:5173/account/email#token=abc."
+	if err := (Log{}).Send(context.Background(), Message{To: "ana@example.com", Subject: "Sign in", Text: text}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret123") || strings.Contains(out, "abc") {
+		t.Errorf("token leaked to the log: %s", out)
+	}
+	for _, want := range []string{"https://coop.example/login/verify?[redacted]", "http://localhost:5173/account/email?[redacted]", "mail to ana@example.com"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in log: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP sends through a mail server, upgrading to TLS with STARTTLS when the
+// server offers it. Credentials are optional.
+type SMTP struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTP) Send(_ context.Context, m Message) error {
+	if strings.ContainsAny(m.To, "\r\n") {
+		return errors.New("invalid recipient")
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, address(s.From), []string{m.To}, Format(s.From, m, time.Now()))
+}
+
+// address returns the bare address of "Name <addr>".
+func address(from string) string {
+	if i, j := strings.LastIndex(from, "<"), strings.LastIndex(from, ">"); i >= 0 && j > i {
+		return from[i+1 : j]
+	}
+	return from
+}
@@ -0,0 +1,207 @@
+package members
+
+import (
+    "encoding/csv"
+    "errors"
+    "fmt"
+    "io"
+    "strings"
+)
+
+// CSVFields are the columns of a member CSV, in export order. Imports need
+// email and display_name; the rest are optional. Skills and committees
+// hold several values separated by semicolons.
+var CSVFields = []string{"email", "display_name", "role", "status", "phone", "pronouns", "unit", "skills", "committees"}
+
+// csvAliases lists the header names recognized for each field, lower case
+// and in order of preference, so exports from spreadsheets and mailing
+// list tools map without help.
+var csvAliases = map[string][]string{
+    "email":        {"email", "e-mail", "email address", "e-mail address", "member email"},
+    "display_name": {"display_name", "display name", "name", "full name", "member name"},
+    "role":         {"role"},
+    "status":       {"status", "membership status"},
+    "phone":        {"phone", "phone number", "mobile", "telephone"},
+    "pronouns":     {"pronouns"},
+    "unit":         {"unit", "household", "apartment"},
+    "skills":       {"skills"},
+    "committees":   {"committees", "committee"},
+}
+
+// ImportRow is one member read from a CSV file. Line is the row's line in
+// the file, counting the header as line 1.
+type ImportRow struct {
+    Line        int      `json:"line"`
+    Email       string   `json:"email"`
+    DisplayName string   `json:"display_name"`
+    Role        string   `json:"role"`
+    Status      string   `json:"status"`
+    Phone       string   `json:"phone,omitempty"`
+    Pronouns    string   `json:"pronouns,omitempty"`
+    Unit        string   `json:"unit,omitempty"`
+    Skills      []string `json:"skills,omitempty"`
+    Committees  []string `json:"committees,omitempty"`
+}
+
+// ImportResult reports on one imported row: the member created, or what
+// is wrong with the row.
+type ImportResult struct {
+    ImportRow
+    ID     int64    `json:"id,omitempty"`
+    Errors []string `json:"errors,omitempty"`
+}
+
+// ImportReport is the outcome of an import or dry run. Nothing is written
+// unless every row is valid.
+type ImportReport struct {
+    DryRun   bool              `json:"dry_run"`
+    Mapping  map[string]string `json:"mapping"`
+    Unmapped []string          `json:"unmapped"`
+    Total    int               `json:"total"`
+    Valid    int               `json:"valid"`
+    Invalid  int               `json:"invalid"`
+    Created  int               `json:"created"`
+    Rows     []ImportResult    `json:"rows"`
+    Error    string            `json:"error,omitempty"`
+}
+
+// CSVImport is a parsed member CSV: its header, the column chosen for each
+// field, the headers left unused, and the rows.
+type CSVImport struct {
+    Headers  []string          `json:"headers"`
+    Mapping  map[string]string `json:"mapping"`
+    Unmapped []string          `json:"unmapped"`
+    Rows     []ImportRow       `json:"rows"`
+}
+
+// ParseCSV reads a member CSV with a header row. Columns map to fields by
+// header name (see csvAliases); overrides maps a field to the header to use
+// instead, matched case-insensitively. Blank rows are skipped.
+func ParseCSV(r io.Reader, overrides map[string]string) (CSVImport, error) {
+    cr := csv.NewReader(r)
+    cr.FieldsPerRecord = -1
+    cr.TrimLeadingSpace = true
+    head, err := cr.Read()
+    if err == io.EOF {
+        return CSVImport{}, errors.New("csv header required")
+    }
+    if err != nil {
+        return CSVImport{}, err
+    }
+    out := CSVImport{Headers: head, Mapping: map[string]string{}, Unmapped: []string{}, Rows: []ImportRow{}}
+    header := map[string]int{}
+    for i, h := range out.Headers {
+        h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+        out.Headers[i] = h
+        if _, ok := header[strings.ToLower(h)]; !ok {
+            header[strings.ToLower(h)] = i
+        }
+    }
+    cols := map[string]int{}
+    used := map[int]bool{}
+    for field, name := range overrides {
+        if _, ok := csvAliases[field]; !ok {
+            return CSVImport{}, fmt.Errorf("unknown field %q; fields are %s", field, strings.Join(CSVFields, ", "))
+        }
+        i, ok := header[strings.ToLower(strings.TrimSpace(name))]
+        if !ok {
+            return CSVImport{}, fmt.Errorf("no column named %q for %s", name, field)
+        }
+        cols[field], used[i] = i, true
+    }
+    for _, field := range CSVFields {
+        if _, ok := cols[field]; ok { continue }
+        for _, alias := range csvAliases[field] {
+            if i, ok := header[alias]; ok && !used[i] {
+                cols[field], used[i] = i, true
+                break
+            }
+        }
+    }
+    for _, field := range []string{"email", "display_name"} {
+        if _, ok := cols[field]; !ok {
+            return CSVImport{}, fmt.Errorf("no column for %s; choose one with map=%s=<column>", field, field)
+        }
+    }
+    for field, i := range cols {
+        out.Mapping[field] = out.Headers[i]
+    }
+    for i, h := range out.Headers {
+        if !used[i] { out.Unmapped = append(out.Unmapped, h) }
+    }
+
+    for {
+        rec, err := cr.Read()
+        if err == io.EOF { break }
+        if err != nil {
+            return CSVImport{}, err
+        }
+        if strings.TrimSpace(strings.Join(rec, "")) == "" { continue }
+        line, _ := cr.FieldPos(0)
+        field := func(name string) string {
+            i, ok := cols[name]
+            if !ok || i >= len(rec) { return "" }
+            return csvUnescape(strings.TrimSpace(rec[i]))
+        }
+        out.Rows = append(out.Rows, ImportRow{
+            Line:        line,
+            Email:       field("email"),
+            DisplayName: field("display_name"),
+            Role:        strings.ToLower(field("role")),
+            Status:      strings.ToLower(field("status")),
+            Phone:       field("phone"),
+            Pronouns:    field("pronouns"),
+            Unit:        field("unit"),
+            Skills:      splitList(field("skills")),
+            Committees:  splitList(field("committees")),
+        })
+    }
+    return out, nil
+}
+
+// splitList reads a semicolon-separated cell, dropping empty entries.
+func splitList(s string) []string {
+    var out []string
+    for _, v := range strings.Split(s, ";") {
+        if v = strings.TrimSpace(v); v != "" { out = append(out, v) }
+    }
+    return out
+}
+
+// csvEscape keeps spreadsheets from running a cell as a formula by
+// prefixing cells that start with =, +, - or @ with a quote; csvUnescape
+// removes it again on import.
+func csvEscape(s string) string {
+    if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+        return "'" + s
+    }
+    return s
+}
+
+func csvUnescape(s string) string {
+    if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@", rune(s[1])) {
+        return s[1:]
+    }
+    return s
+}
+
+// WriteCSV writes profiles in the CSVFields layout, which ParseCSV reads
+// back.
+func WriteCSV(w io.Writer, items []Profile) error {
+    cw := csv.NewWriter(w)
+    if err := cw.Write(CSVFields); err != nil {
+        return err
+    }
+    for _, p := range items {
+        row := []string{p.Email, p.DisplayName, p.Role, p.Status, p.Phone, p.Pronouns, p.Unit,
+            strings.Join(p.Skills, "; "), strings.Join(p.Committees, "; ")}
+        for i := range row {
+            row[i] = csvEscape(row[i])
+        }
+        if err := cw.Write(row); err != nil {
+            return err
+        }
+    }
+    cw.Flush()
+    return cw.Error()
+}
@@ -1,17 +1,155 @@
 package members
 
 import (
+    "context"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
     "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
     "net/http"
+    "net/mail"
+    "net/url"
     "strconv"
+    "strings"
+    "time"
 
     "coop.tools/backend/internal/httpmw"
+    "coop.tools/backend/internal/httpx"
+    mailer "coop.tools/backend/internal/mail"
     "github.com/go-chi/chi/v5"
 )
 
-type Handlers struct{ Repo Repo }
+// DefaultEmailChangeTTL is how long an email confirmation link works.
+const DefaultEmailChangeTTL = 24 * time.Hour
 
-// GetByID handles GET /api/members/{id}
+type Handlers struct {
+    Repo Repo
+    // ApprovalVote makes approving an application (pending to active)
+    // require a passed proposal. New members then start as applicants.
+    ApprovalVote bool
+    // ProposalPassed reports whether a closed proposal passed and which
+    // member it is about (nil for none). It checks any proposal_id given
+    // with a status change, which must be about that member.
+    ProposalPassed func(ctx context.Context, id int32) (passed bool, memberID *int64, err error)
+    // Now is the clock for effective dates; nil means time.Now.
+    Now func() time.Time
+    // Mailer sends email change confirmations to ConfirmURL, with the
+    // token added as ?token=. Email changes are refused without it.
+    Mailer     mailer.Mailer
+    ConfirmURL string
+    // EmailChangeTTL is how long confirmation links work; zero means
+    // DefaultEmailChangeTTL.
+    EmailChangeTTL time.Duration
+    // Forget, when set, runs after a member is deleted to remove what
+    // other packages keep about them, such as sessions and passkeys.
+    Forget func(ctx context.Context, memberID int64) error
+}
+
+func (h Handlers) now() time.Time {
+    if h.Now != nil {
+        return h.Now()
+    }
+    return time.Now()
+}
+
+// canGrant reports whether p may give a member base role, or take it
+// away: role managers hand out roles, and only full admins make or
+// unmake admins.
+func canGrant(p httpmw.Principal, role string) bool {
+    if role == "member" { return true }
+    return p.Can("roles.manage") && (role != "admin" || p.Can(httpmw.AllPermissions))
+}
+
+// sees reports whether the caller may see every field of member id's
+// profile: their own, or anyone's with members.manage.
+func sees(p httpmw.Principal, id int64) bool {
+    return p.MemberID == id || p.Can("members.manage")
+}
+
+// List handles GET /api/members: the directory, or with ?email= an exact
+// lookup for members.manage. The directory is for active members.
+// Query: q (name), role, committee, skill, status (default active; "all"
+// for every status), limit (max 200), offset.
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+    p, _ := httpmw.FromContext(r.Context())
+    if r.URL.Query().Has("email") {
+        if !p.Can("members.manage") {
+            httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+            return
+        }
+        h.FindByEmail(w, r)
+        return
+    }
+    f, ok := directoryFilters(w, r)
+    if !ok { return }
+    limit, offset, err := httpx.ParseLimitOffset(r, 200)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+        return
+    }
+    f.Limit, f.Offset = limit, offset
+    items, err := h.Repo.Directory(r.Context(), f)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    items = visible(p, items)
+    if limit > 0 { w.Header().Set("X-Limit", strconv.Itoa(limit)) }
+    if offset > 0 { w.Header().Set("X-Offset", strconv.Itoa(offset)) }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(items)
+}
+
+// directoryFilters reads the directory query for the caller, who must be
+// active or hold members.manage; it writes the error when ok is false.
+func directoryFilters(w http.ResponseWriter, r *http.Request) (DirectoryFilters, bool) {
+    p, _ := httpmw.FromContext(r.Context())
+    if !p.Active() && !p.Can("members.manage") {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "only active members may browse the directory")
+        return DirectoryFilters{}, false
+    }
+    f := DirectoryFilters{
+        Query:     strings.TrimSpace(httpx.QueryString(r, "q")),
+        Role:      httpx.QueryString(r, "role"),
+        Committee: httpx.QueryString(r, "committee"),
+        Skill:     strings.TrimSpace(httpx.QueryString(r, "skill")),
+        Status:    httpx.QueryString(r, "status"),
+        AllFields: p.Can("members.manage"),
+    }
+    switch f.Status {
+    case "":
+        f.Status = StatusActive
+    case "all":
+        f.Status = ""
+    default:
+        if !ValidStatus(f.Status) {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+            return DirectoryFilters{}, false
+        }
+    }
+    return f, true
+}
+
+// visible redacts directory entries for p: their own and, for
+// members.manage, everyone's stay complete.
+func visible(p httpmw.Principal, items []Profile) []Profile {
+    for i, m := range items {
+        if sees(p, m.ID) {
+            items[i] = m.withDefaults()
+        } else {
+            items[i] = m.Redacted()
+        }
+    }
+    return items
+}
+
+// GetByID handles GET /api/members/{id}: the member's profile. Members see
+// their own in full, including visibility settings; other active members
+// see the fields shared with them.
 func (h Handlers) GetByID(w http.ResponseWriter, r *http.Request) {
     idStr := chi.URLParam(r, "id")
     id, err := strconv.ParseInt(idStr, 10, 64)
@@ -19,7 +157,12 @@ func (h Handlers) GetByID(w http.ResponseWriter, r *http.Request) {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
         return
     }
-    m, err := h.Repo.GetByID(r.Context(), id)
+    p, _ := httpmw.FromContext(r.Context())
+    if !sees(p, id) && !p.Active() {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+        return
+    }
+    m, err := h.Repo.GetProfile(r.Context(), id)
     if err != nil {
         if err == ErrNotFound {
             httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
@@ -28,11 +171,16 @@ func (h Handlers) GetByID(w http.ResponseWriter, r *http.Request) {
         httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
         return
     }
+    if sees(p, id) {
+        m = m.withDefaults()
+    } else {
+        m = m.Redacted()
+    }
     w.Header().Set("Content-Type", "application/json")
     _ = json.NewEncoder(w).Encode(m)
 }
 
-// FindByEmail handles GET /api/members?email=
+// FindByEmail handles GET /api/members?email= for members.manage.
 func (h Handlers) FindByEmail(w http.ResponseWriter, r *http.Request) {
     email := r.URL.Query().Get("email")
     if email == "" {
@@ -52,28 +200,58 @@ func (h Handlers) FindByEmail(w http.ResponseWriter, r *http.Request) {
     _ = json.NewEncoder(w).Encode(m)
 }
 
-// Create handles POST /api/members
+// initialStatus returns the status a new member starts in, or why the
+// requested one is not allowed. Members start as applicants, awaiting
+// approval, or (unless approval takes a vote) already active.
+func (h Handlers) initialStatus(status string) (string, string) {
+    switch {
+    case status == "" && h.ApprovalVote:
+        return StatusApplicant, ""
+    case status == "":
+        return StatusActive, ""
+    case status == StatusActive && h.ApprovalVote:
+        return "", "new members need a board vote; create them as applicants"
+    case status != StatusApplicant && status != StatusPending && status != StatusActive:
+        return "", "status must be applicant, pending or active"
+    }
+    return status, ""
+}
+
+// Create handles POST /api/members (members.manage)
 func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
     var in struct {
         Email       string `json:"email"`
         DisplayName string `json:"display_name"`
         Role        string `json:"role"`
+        Status      string `json:"status"`
     }
     if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
         return
     }
+    status, msg := h.initialStatus(in.Status)
+    if msg != "" {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, msg)
+        return
+    }
     if in.Email == "" || in.DisplayName == "" {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "email and display_name required")
         return
     }
     role := in.Role
     if role == "" { role = "member" }
-    if role != "admin" && role != "member" {
+    if !ValidRole(role) {
         httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid role")
         return
     }
-    m, err := h.Repo.Create(r.Context(), in.Email, in.DisplayName, role)
+    // Base roles carry permissions: only role managers hand them out, and
+    // only full admins create admins.
+    p, _ := httpmw.FromContext(r.Context())
+    if !canGrant(p, role) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "you may not grant the "+role+" role")
+        return
+    }
+    m, err := h.Repo.Create(r.Context(), in.Email, in.DisplayName, role, status)
     if err != nil {
         if err == ErrConflict {
             httpmw.WriteJSONError(w, http.StatusConflict, "email already exists")
@@ -87,3 +265,758 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
     _ = json.NewEncoder(w).Encode(m)
 }
 
+
+// ChangeStatus handles POST /api/members/{id}/status (members.manage).
+// Body: {"status":"active","reason":"Approved at the March board meeting","effective_at":"2026-03-12T18:00:00Z","proposal_id":14}
+// effective_at defaults to now and may be backdated but not future-dated.
+// Suspension and withdrawal need a reason; approval needs a passed
+// proposal about the member when ApprovalVote is set, and a proposal
+// backs one change only. Only callers who could take away a member's
+// role may change their status.
+func (h Handlers) ChangeStatus(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    var in struct {
+        Status      string     `json:"status"`
+        Reason      string     `json:"reason"`
+        EffectiveAt *time.Time `json:"effective_at"`
+        ProposalID  *int32     `json:"proposal_id"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    if !ValidStatus(in.Status) {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+        return
+    }
+    now := h.now()
+    c := StatusChange{MemberID: id, ToStatus: in.Status, EffectiveAt: now, Reason: strings.TrimSpace(in.Reason), ProposalID: in.ProposalID}
+    if in.EffectiveAt != nil {
+        if in.EffectiveAt.After(now) {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "effective_at cannot be in the future")
+            return
+        }
+        c.EffectiveAt = *in.EffectiveAt
+    }
+    if c.Reason == "" && (c.ToStatus == StatusSuspended || c.ToStatus == StatusWithdrawn) {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "reason required")
+        return
+    }
+    cur, err := h.Repo.GetByID(r.Context(), id)
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    if cur.DeletedAt != nil {
+        httpmw.WriteJSONError(w, http.StatusConflict, "member has been deleted")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if !canGrant(p, cur.Role) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "you may not change the status of a member with the "+cur.Role+" role")
+        return
+    }
+    if !CanTransition(cur.Status, c.ToStatus) {
+        httpmw.WriteJSONError(w, http.StatusConflict, "cannot change status from "+cur.Status+" to "+c.ToStatus)
+        return
+    }
+    approval := cur.Status == StatusPending && c.ToStatus == StatusActive
+    if approval && h.ApprovalVote && c.ProposalID == nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "approval needs the proposal_id of a passed board vote")
+        return
+    }
+    if c.ProposalID != nil {
+        if h.ProposalPassed == nil {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "proposal checks are not configured")
+            return
+        }
+        passed, about, err := h.ProposalPassed(r.Context(), *c.ProposalID)
+        if err != nil {
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to check proposal")
+            return
+        }
+        if about == nil || *about != id {
+            httpmw.WriteJSONError(w, http.StatusConflict, "proposal is not about this member")
+            return
+        }
+        if !passed {
+            httpmw.WriteJSONError(w, http.StatusConflict, "proposal has not passed")
+            return
+        }
+    }
+    if p.MemberID > 0 {
+        by := p.MemberID
+        c.ChangedBy = &by
+    }
+    m, change, err := h.Repo.ChangeStatus(r.Context(), c)
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+        case ErrTransition:
+            httpmw.WriteJSONError(w, http.StatusConflict, "status changed concurrently; reload and retry")
+        case ErrEffectiveOrder:
+            httpmw.WriteJSONError(w, http.StatusConflict, "effective_at is before the member's latest status change")
+        case ErrProposalUsed:
+            httpmw.WriteJSONError(w, http.StatusConflict, "proposal has already been used for a status change")
+        case ErrDeleted:
+            httpmw.WriteJSONError(w, http.StatusConflict, "member has been deleted")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "status change failed")
+        }
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(struct {
+        Member Member       `json:"member"`
+        Change StatusChange `json:"change"`
+    }{m, change})
+}
+
+// StatusHistory handles GET /api/members/{id}/status. Members see their
+// own history; members.manage sees everyone's.
+func (h Handlers) StatusHistory(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if p.MemberID != id && !p.Can("members.manage") {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+        return
+    }
+    if _, err := h.Repo.GetByID(r.Context(), id); err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    items, err := h.Repo.StatusHistory(r.Context(), id)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(items)
+}
+
+// Profile field limits, in bytes after trimming. Skills and committees
+// hold up to maxListItems entries of up to maxListItem bytes.
+const (
+    maxPhone     = 40
+    maxPronouns  = 40
+    maxUnit      = 100
+    maxBio       = 2000
+    maxListItems = 30
+    maxListItem  = 50
+)
+
+// UpdateProfile handles PUT /api/members/{id}/profile. Members edit their
+// own profile and visibility; committees need members.manage.
+// Body: {"phone":"555-0100","pronouns":"she/her","unit":"4B","skills":["plumbing"],"bio":"...","photo_attachment_id":31,"visibility":{"phone":"members"},"committees":["finance"]}
+// Omitted fields keep their values; an empty string or list clears them,
+// and photo_attachment_id 0 removes the photo.
+func (h Handlers) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if !sees(p, id) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+        return
+    }
+    var in struct {
+        Phone      *string           `json:"phone"`
+        Pronouns   *string           `json:"pronouns"`
+        Unit       *string           `json:"unit"`
+        Skills     *[]string         `json:"skills"`
+        Bio        *string           `json:"bio"`
+        PhotoID    *int64            `json:"photo_attachment_id"`
+        Visibility map[string]string `json:"visibility"`
+        Committees *[]string         `json:"committees"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    if in.Committees != nil && !p.Can("members.manage") {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "committees are set by members.manage")
+        return
+    }
+    if !ValidVisibility(in.Visibility) {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "visibility maps email, phone, unit, pronouns, skills, bio or photo to members or private")
+        return
+    }
+    cur, err := h.Repo.GetProfile(r.Context(), id)
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    text := func(dst *string, v *string, max int, name string) bool {
+        if v == nil { return true }
+        t := strings.TrimSpace(*v)
+        if len(t) > max {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, name+" is too long")
+            return false
+        }
+        *dst = t
+        return true
+    }
+    list := func(dst *[]string, v *[]string, name string) bool {
+        if v == nil { return true }
+        out := []string{}
+        for _, s := range *v {
+            s = strings.TrimSpace(s)
+            if s == "" { continue }
+            if len(s) > maxListItem {
+                httpmw.WriteJSONError(w, http.StatusBadRequest, name+" entries are limited to "+strconv.Itoa(maxListItem)+" characters")
+                return false
+            }
+            out = append(out, s)
+        }
+        if len(out) > maxListItems {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "too many "+name)
+            return false
+        }
+        *dst = out
+        return true
+    }
+    if !text(&cur.Phone, in.Phone, maxPhone, "phone") || !text(&cur.Pronouns, in.Pronouns, maxPronouns, "pronouns") ||
+        !text(&cur.Unit, in.Unit, maxUnit, "unit") || !text(&cur.Bio, in.Bio, maxBio, "bio") ||
+        !list(&cur.Skills, in.Skills, "skills") || !list(&cur.Committees, in.Committees, "committees") {
+        return
+    }
+    if in.PhotoID != nil {
+        cur.PhotoID = in.PhotoID
+        if *in.PhotoID == 0 { cur.PhotoID = nil }
+    }
+    if cur.Visibility == nil { cur.Visibility = map[string]string{} }
+    for field, level := range in.Visibility {
+        cur.Visibility[field] = level
+    }
+    out, err := h.Repo.UpdateProfile(r.Context(), cur)
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+        case ErrPhoto:
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "photo must be an image uploaded with owner_type=member_photo for this member")
+        case ErrDeleted:
+            httpmw.WriteJSONError(w, http.StatusConflict, "member has been deleted")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+        }
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(out.withDefaults())
+}
+
+// Update handles PATCH /api/members/{id}. Members rename themselves;
+// members.manage renames anyone and changes base roles, by the same rules
+// as Create. Status and email have their own endpoints.
+// Body: {"display_name":"Ana Ruiz","role":"treasurer"}
+func (h Handlers) Update(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if !sees(p, id) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+        return
+    }
+    var in struct {
+        DisplayName *string `json:"display_name"`
+        Role        *string `json:"role"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    if in.DisplayName == nil && in.Role == nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "nothing to update")
+        return
+    }
+    u := Update{Role: in.Role}
+    if in.DisplayName != nil {
+        name := strings.TrimSpace(*in.DisplayName)
+        if name == "" || len(name) > 100 {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "display_name must be 1 to 100 characters")
+            return
+        }
+        u.DisplayName = &name
+    }
+    cur, err := h.Repo.GetByID(r.Context(), id)
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    if in.Role != nil && *in.Role != cur.Role {
+        switch {
+        case !p.Can("members.manage"):
+            httpmw.WriteJSONError(w, http.StatusForbidden, "changing roles needs members.manage")
+            return
+        case p.MemberID == id:
+            httpmw.WriteJSONError(w, http.StatusForbidden, "you cannot change your own role")
+            return
+        case !ValidRole(*in.Role):
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid role")
+            return
+        case !canGrant(p, *in.Role):
+            httpmw.WriteJSONError(w, http.StatusForbidden, "you may not grant the "+*in.Role+" role")
+            return
+        case !canGrant(p, cur.Role):
+            httpmw.WriteJSONError(w, http.StatusForbidden, "you may not take away the "+cur.Role+" role")
+            return
+        }
+    }
+    m, err := h.Repo.Update(r.Context(), id, u)
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+        case ErrDeleted:
+            httpmw.WriteJSONError(w, http.StatusConflict, "member has been deleted")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+        }
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(m)
+}
+
+// newEmailToken returns a random confirmation token and the hash stored
+// for it.
+func newEmailToken() (string, []byte, error) {
+    b := make([]byte, 32)
+    if _, err := rand.Read(b); err != nil {
+        return "", nil, err
+    }
+    token := base64.RawURLEncoding.EncodeToString(b)
+    return token, hashEmailToken(token), nil
+}
+
+func hashEmailToken(token string) []byte {
+    sum := sha256.Sum256([]byte(token))
+    return sum[:]
+}
+
+// validEmail reports whether s is a bare address such as ana@example.com.
+func validEmail(s string) bool {
+    a, err := mail.ParseAddress(s)
+    return err == nil && a.Address == s && a.Name == ""
+}
+
+// RequestEmailChange handles POST /api/members/{id}/email. Members change
+// their own address and members.manage anyone's. Nothing changes until the
+// link mailed to the new address is opened; the old address is told.
+// Body: {"email":"ana@new.example"}
+func (h Handlers) RequestEmailChange(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if !sees(p, id) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+        return
+    }
+    var in struct {
+        Email string `json:"email"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    email := strings.TrimSpace(in.Email)
+    if !validEmail(email) {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid email")
+        return
+    }
+    if h.Mailer == nil || h.ConfirmURL == "" {
+        httpmw.WriteJSONError(w, http.StatusServiceUnavailable, "email is not configured")
+        return
+    }
+    cur, err := h.Repo.GetByID(r.Context(), id)
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    if strings.EqualFold(cur.Email, email) {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "that is already the member's email")
+        return
+    }
+    token, hash, err := newEmailToken()
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to create confirmation link")
+        return
+    }
+    ttl := h.EmailChangeTTL
+    if ttl <= 0 { ttl = DefaultEmailChangeTTL }
+    c := EmailChange{MemberID: id, NewEmail: email, ExpiresAt: h.now().Add(ttl)}
+    if p.MemberID > 0 {
+        by := p.MemberID
+        c.RequestedBy = &by
+    }
+    out, err := h.Repo.RequestEmailChange(r.Context(), c, hash)
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+        case ErrConflict:
+            httpmw.WriteJSONError(w, http.StatusConflict, "email already in use")
+        case ErrDeleted:
+            httpmw.WriteJSONError(w, http.StatusConflict, "member has been deleted")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to save email change")
+        }
+        return
+    }
+    sep := "?"
+    if strings.Contains(h.ConfirmURL, "?") { sep = "&" }
+    link := h.ConfirmURL + sep + "token=" + url.QueryEscape(token)
+    if err := h.Mailer.Send(r.Context(), mailer.Message{
+        To:      email,
+        Subject: "Confirm your new email address",
+        Text: fmt.Sprintf("Open this link to use this address for your membership account:\n\n%s\n\nIt works once and expires in %d hours. If you did not ask for this, you can ignore this email.\n",
+            link, int(ttl.Hours())),
+    }); err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to send confirmation link")
+        return
+    }
+    // The old address hears about the change so a hijacked session cannot
+    // move the account quietly.
+    if err := h.Mailer.Send(r.Context(), mailer.Message{
+        To:      cur.Email,
+        Subject: "Your email address is being changed",
+        Text:    fmt.Sprintf("Someone asked to change your membership account's email address to %s. It changes once the link sent there is opened. If this was not you, contact an administrator.\n", email),
+    }); err != nil {
+        log.Printf("members: notify %d of email change: %v", id, err)
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusAccepted)
+    _ = json.NewEncoder(w).Encode(out)
+}
+
+// ConfirmEmailChange handles POST /api/members/email/confirm. The token
+// from the emailed link is the only credential, so the link works in any
+// browser; it works once.
+// Body: {"token":"..."}
+func (h Handlers) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        Token string `json:"token"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.Token == "" {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "token required")
+        return
+    }
+    m, err := h.Repo.ConfirmEmailChange(r.Context(), hashEmailToken(in.Token), h.now())
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid or expired confirmation link")
+        case ErrConflict:
+            httpmw.WriteJSONError(w, http.StatusConflict, "email already in use")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to confirm email")
+        }
+        return
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(m)
+}
+
+// Delete handles DELETE /api/members/{id} (members.manage). The member is
+// anonymized rather than removed, so votes, ledger entries and other
+// records keep pointing at the row; members still in the co-op are
+// withdrawn first. Body, optional: {"reason":"Asked to be forgotten"}
+func (h Handlers) Delete(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+    if err != nil || id <= 0 {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+        return
+    }
+    var in struct {
+        Reason string `json:"reason"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil && err != io.EOF {
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    if p.MemberID == id {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "you cannot delete your own account")
+        return
+    }
+    cur, err := h.Repo.GetByID(r.Context(), id)
+    if err != nil {
+        if err == ErrNotFound {
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    if !canGrant(p, cur.Role) {
+        httpmw.WriteJSONError(w, http.StatusForbidden, "you may not take away the "+cur.Role+" role")
+        return
+    }
+    c := StatusChange{MemberID: id, ToStatus: StatusWithdrawn, EffectiveAt: h.now(), Reason: strings.TrimSpace(in.Reason)}
+    if c.Reason == "" { c.Reason = "Member record deleted" }
+    if p.MemberID > 0 {
+        by := p.MemberID
+        c.ChangedBy = &by
+    }
+    m, err := h.Repo.Delete(r.Context(), c)
+    if err != nil {
+        switch err {
+        case ErrNotFound:
+            httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+        case ErrDeleted:
+            httpmw.WriteJSONError(w, http.StatusConflict, "member has already been deleted")
+        default:
+            httpmw.WriteJSONError(w, http.StatusInternalServerError, "delete failed")
+        }
+        return
+    }
+    // The member can no longer sign in either way; Forget clears what is
+    // left of their credentials.
+    if h.Forget != nil {
+        if err := h.Forget(r.Context(), id); err != nil {
+            log.Printf("members: forget %d: %v", id, err)
+        }
+    }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(m)
+}
+
+// maxImportBytes caps the size of an imported member file, and
+// maxImportRows the members in it.
+const (
+    maxImportBytes = 5 << 20
+    maxImportRows  = 5000
+)
+
+// readImport parses the uploaded CSV, the request body or the "file" field
+// of a multipart form, with the columns chosen by ?map=field=column. It
+// writes the error when ok is false.
+func readImport(w http.ResponseWriter, r *http.Request) (CSVImport, bool) {
+    overrides := map[string]string{}
+    for _, m := range r.URL.Query()["map"] {
+        field, col, ok := strings.Cut(m, "=")
+        if !ok || strings.TrimSpace(col) == "" {
+            httpmw.WriteJSONError(w, http.StatusBadRequest, "map takes field=column")
+            return CSVImport{}, false
+        }
+        overrides[strings.TrimSpace(field)] = col
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+    fail := func(err error) {
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            httpmw.WriteJSONError(w, http.StatusRequestEntityTooLarge, "file too large")
+            return
+        }
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid csv: "+err.Error())
+    }
+    var src io.Reader = r.Body
+    if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+        f, _, err := r.FormFile("file")
+        if err != nil {
+            fail(err)
+            return CSVImport{}, false
+        }
+        defer f.Close()
+        src = f
+    }
+    in, err := ParseCSV(src, overrides)
+    if err != nil {
+        fail(err)
+        return CSVImport{}, false
+    }
+    switch {
+    case len(in.Rows) == 0:
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "no members found")
+        return CSVImport{}, false
+    case len(in.Rows) > maxImportRows:
+        httpmw.WriteJSONError(w, http.StatusBadRequest, "at most "+strconv.Itoa(maxImportRows)+" members per file")
+        return CSVImport{}, false
+    }
+    return in, true
+}
+
+// PreviewImport handles POST /api/members/import/preview (members.manage):
+// how the file's columns map to member fields, and its first rows as they
+// would be read. Adjust the mapping with ?map=field=column.
+func (h Handlers) PreviewImport(w http.ResponseWriter, r *http.Request) {
+    in, ok := readImport(w, r)
+    if !ok { return }
+    total := len(in.Rows)
+    if len(in.Rows) > 10 { in.Rows = in.Rows[:10] }
+    w.Header().Set("Content-Type", "application/json")
+    _ = json.NewEncoder(w).Encode(struct {
+        CSVImport
+        Total int `json:"total"`
+    }{in, total})
+}
+
+// checkImportRow validates row the way Create and UpdateProfile would for
+// the caller, filling in the default role and status, and returns what is
+// wrong with it.
+func (h Handlers) checkImportRow(p httpmw.Principal, row *ImportRow) []string {
+    var errs []string
+    switch {
+    case row.Email == "":
+        errs = append(errs, "email required")
+    case !validEmail(row.Email):
+        errs = append(errs, "invalid email")
+    }
+    switch {
+    case row.DisplayName == "":
+        errs = append(errs, "display_name required")
+    case len(row.DisplayName) > 100:
+        errs = append(errs, "display_name is too long")
+    }
+    if row.Role == "" { row.Role = "member" }
+    switch {
+    case !ValidRole(row.Role):
+        errs = append(errs, fmt.Sprintf("invalid role %q", row.Role))
+    case !canGrant(p, row.Role):
+        errs = append(errs, "you may not grant the "+row.Role+" role")
+    }
+    if status, msg := h.initialStatus(row.Status); msg != "" {
+        errs = append(errs, msg)
+    } else {
+        row.Status = status
+    }
+    for _, f := range []struct {
+        name, v string
+        max     int
+    }{{"phone", row.Phone, maxPhone}, {"pronouns", row.Pronouns, maxPronouns}, {"unit", row.Unit, maxUnit}} {
+        if len(f.v) > f.max { errs = append(errs, f.name+" is too long") }
+    }
+    for _, l := range []struct {
+        name string
+        list []string
+    }{{"skills", row.Skills}, {"committees", row.Committees}} {
+        if len(l.list) > maxListItems { errs = append(errs, "too many "+l.name) }
+        for _, v := range l.list {
+            if len(v) > maxListItem {
+                errs = append(errs, l.name+" entries are limited to "+strconv.Itoa(maxListItem)+" characters")
+                break
+            }
+        }
+    }
+    return errs
+}
+
+// Import handles POST /api/members/import (members.manage). The CSV is the
+// request body or the "file" field of a multipart form; see ParseCSV for
+// columns. Every row is validated, including against existing members, and
+// the report lists each row's problems. Members are created in one
+// transaction, only when every row is valid; with ?dry_run=true nothing is
+// written. Query: dry_run, map=field=column (repeatable).
+func (h Handlers) Import(w http.ResponseWriter, r *http.Request) {
+    in, ok := readImport(w, r)
+    if !ok { return }
+    p, _ := httpmw.FromContext(r.Context())
+    rep := ImportReport{DryRun: httpx.QueryBoolTrue(r, "dry_run"), Mapping: in.Mapping, Unmapped: in.Unmapped,
+        Total: len(in.Rows), Rows: make([]ImportResult, len(in.Rows))}
+    seen := map[string]int{} // email -> first line
+    var valid []ImportRow
+    var index []int // rep.Rows index of each valid row
+    for i, row := range in.Rows {
+        res := ImportResult{ImportRow: row}
+        res.Errors = h.checkImportRow(p, &res.ImportRow)
+        if key := strings.ToLower(row.Email); key != "" {
+            if line, dup := seen[key]; dup {
+                res.Errors = append(res.Errors, fmt.Sprintf("email is also on line %d", line))
+            } else {
+                seen[key] = row.Line
+            }
+        }
+        rep.Rows[i] = res
+        if len(res.Errors) == 0 {
+            valid = append(valid, res.ImportRow)
+            index = append(index, i)
+        }
+    }
+    commit := !rep.DryRun && len(valid) == len(in.Rows)
+    created, errs, err := h.Repo.Import(r.Context(), valid, commit)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "import failed")
+        return
+    }
+    for j, i := range index {
+        switch {
+        case errs[j] == ErrConflict:
+            rep.Rows[i].Errors = append(rep.Rows[i].Errors, "email already belongs to a member")
+        case errs[j] != nil:
+            rep.Rows[i].Errors = append(rep.Rows[i].Errors, errs[j].Error())
+        }
+    }
+    for _, res := range rep.Rows {
+        if len(res.Errors) > 0 { rep.Invalid++ }
+    }
+    rep.Valid = rep.Total - rep.Invalid
+    status := http.StatusOK
+    switch {
+    case rep.Invalid > 0:
+        rep.Error = fmt.Sprintf("%d of %d rows are invalid; nothing was imported", rep.Invalid, rep.Total)
+        if !rep.DryRun { status = http.StatusBadRequest }
+    case commit:
+        for j, i := range index {
+            rep.Rows[i].ID = created[j].ID
+        }
+        rep.Created = len(created)
+        status = http.StatusCreated
+    }
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(rep)
+}
+
+// ExportCSV handles GET /api/members/export.csv: the directory with List's
+// filters and privacy, in the layout Import reads.
+func (h Handlers) ExportCSV(w http.ResponseWriter, r *http.Request) {
+    f, ok := directoryFilters(w, r)
+    if !ok { return }
+    items, err := h.Repo.Directory(r.Context(), f)
+    if err != nil {
+        httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+        return
+    }
+    p, _ := httpmw.FromContext(r.Context())
+    w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+    w.Header().Set("Content-Disposition", "attachment; filename=members.csv")
+    _ = WriteCSV(w, visible(p, items))
+}
@@ -8,7 +8,10 @@ import (
     "strconv"
     "strings"
     "testing"
+    "time"
 
+    "coop.tools/backend/internal/httpmw"
+    "coop.tools/backend/internal/mail"
     "github.com/go-chi/chi/v5"
 )
 
@@ -16,21 +19,179 @@ import (
 type mockRepo struct{
     byID map[int64]Member
     byEmail map[string]Member
+    history []StatusChange
+    profiles map[int64]Profile
+    photos map[int64]int64 // attachment id -> member id
+    emailChanges map[string]EmailChange // token hash -> change
     nextID int64
 }
 
-func (m *mockRepo) Create(_ context.Context, email, displayName, role string) (Member, error) {
+func (m *mockRepo) Create(_ context.Context, email, displayName, role, status string) (Member, error) {
     if m.byEmail == nil { m.byEmail = map[string]Member{} }
     if m.byID == nil { m.byID = map[int64]Member{} }
     if _, ok := m.byEmail[email]; ok { return Member{}, ErrConflict }
     if role == "" { role = "member" }
+    if status == "" { status = StatusActive }
     m.nextID++
-    mem := Member{ID: m.nextID, Email: email, DisplayName: displayName, Role: role}
+    mem := Member{ID: m.nextID, Email: email, DisplayName: displayName, Role: role, Status: status, CreatedAt: time.Now()}
     m.byEmail[email] = mem
     m.byID[mem.ID] = mem
+    m.history = append(m.history, StatusChange{MemberID: mem.ID, ToStatus: status, EffectiveAt: mem.CreatedAt})
     return mem, nil
 }
 
+func (m *mockRepo) ChangeStatus(_ context.Context, c StatusChange) (Member, StatusChange, error) {
+    mem, ok := m.byID[c.MemberID]
+    if !ok { return Member{}, StatusChange{}, ErrNotFound }
+    if !CanTransition(mem.Status, c.ToStatus) { return Member{}, StatusChange{}, ErrTransition }
+    for _, h := range m.history {
+        if h.MemberID == c.MemberID && c.EffectiveAt.Before(h.EffectiveAt) {
+            return Member{}, StatusChange{}, ErrEffectiveOrder
+        }
+        if c.ProposalID != nil && h.ProposalID != nil && *h.ProposalID == *c.ProposalID {
+            return Member{}, StatusChange{}, ErrProposalUsed
+        }
+    }
+    from := mem.Status
+    c.ID = int64(len(m.history) + 1)
+    c.FromStatus = &from
+    mem.Status = c.ToStatus
+    m.byID[mem.ID] = mem
+    m.byEmail[mem.Email] = mem
+    m.history = append(m.history, c)
+    return mem, c, nil
+}
+
+func (m *mockRepo) GetProfile(_ context.Context, id int64) (Profile, error) {
+    mem, ok := m.byID[id]
+    if !ok { return Profile{}, ErrNotFound }
+    p := m.profiles[id]
+    p.ID, p.DisplayName, p.Role, p.Status, p.Email, p.CreatedAt = mem.ID, mem.DisplayName, mem.Role, mem.Status, mem.Email, mem.CreatedAt
+    return p, nil
+}
+
+func (m *mockRepo) Directory(ctx context.Context, f DirectoryFilters) ([]Profile, error) {
+    out := []Profile{}
+    for id := int64(1); id <= m.nextID; id++ {
+        p, err := m.GetProfile(ctx, id)
+        if err != nil { continue }
+        if f.Query != "" && !strings.Contains(strings.ToLower(p.DisplayName), strings.ToLower(f.Query)) { continue }
+        if f.Status != "" && p.Status != f.Status { continue }
+        if f.Role != "" && p.Role != f.Role { continue }
+        if f.Committee != "" && !contains(p.Committees, f.Committee) { continue }
+        if f.Skill != "" && (!contains(p.Skills, f.Skill) || (!f.AllFields && p.Visible("skills") != VisibleToMembers)) { continue }
+        out = append(out, p)
+    }
+    return out, nil
+}
+
+func (m *mockRepo) UpdateProfile(ctx context.Context, p Profile) (Profile, error) {
+    mem, ok := m.byID[p.ID]
+    if !ok { return Profile{}, ErrNotFound }
+    if mem.DeletedAt != nil { return Profile{}, ErrDeleted }
+    if p.PhotoID != nil && m.photos[*p.PhotoID] != p.ID { return Profile{}, ErrPhoto }
+    if m.profiles == nil { m.profiles = map[int64]Profile{} }
+    m.profiles[p.ID] = p
+    return m.GetProfile(ctx, p.ID)
+}
+
+func (m *mockRepo) put(mem Member, oldEmail string) {
+    delete(m.byEmail, oldEmail)
+    m.byID[mem.ID] = mem
+    m.byEmail[mem.Email] = mem
+}
+
+func (m *mockRepo) Update(_ context.Context, id int64, u Update) (Member, error) {
+    mem, ok := m.byID[id]
+    if !ok { return Member{}, ErrNotFound }
+    if mem.DeletedAt != nil { return Member{}, ErrDeleted }
+    if u.DisplayName != nil { mem.DisplayName = *u.DisplayName }
+    if u.Role != nil { mem.Role = *u.Role }
+    m.put(mem, mem.Email)
+    return mem, nil
+}
+
+func (m *mockRepo) RequestEmailChange(_ context.Context, c EmailChange, tokenHash []byte) (EmailChange, error) {
+    mem, ok := m.byID[c.MemberID]
+    if !ok { return EmailChange{}, ErrNotFound }
+    if mem.DeletedAt != nil { return EmailChange{}, ErrDeleted }
+    if _, taken := m.byEmail[c.NewEmail]; taken { return EmailChange{}, ErrConflict }
+    if m.emailChanges == nil { m.emailChanges = map[string]EmailChange{} }
+    for k, v := range m.emailChanges {
+        if v.MemberID == c.MemberID && v.ConfirmedAt == nil { delete(m.emailChanges, k) }
+    }
+    c.ID = int64(len(m.emailChanges) + 1)
+    m.emailChanges[string(tokenHash)] = c
+    return c, nil
+}
+
+func (m *mockRepo) ConfirmEmailChange(_ context.Context, tokenHash []byte, now time.Time) (Member, error) {
+    c, ok := m.emailChanges[string(tokenHash)]
+    if !ok || c.ConfirmedAt != nil || !now.Before(c.ExpiresAt) { return Member{}, ErrNotFound }
+    if _, taken := m.byEmail[c.NewEmail]; taken { return Member{}, ErrConflict }
+    c.ConfirmedAt = &now
+    m.emailChanges[string(tokenHash)] = c
+    mem := m.byID[c.MemberID]
+    old := mem.Email
+    mem.Email = c.NewEmail
+    m.put(mem, old)
+    return mem, nil
+}
+
+func (m *mockRepo) Delete(_ context.Context, c StatusChange) (Member, error) {
+    mem, ok := m.byID[c.MemberID]
+    if !ok { return Member{}, ErrNotFound }
+    if mem.DeletedAt != nil { return Member{}, ErrDeleted }
+    if mem.Status != StatusWithdrawn && mem.Status != StatusDeceased {
+        from := mem.Status
+        c.FromStatus = &from
+        m.history = append(m.history, c)
+        mem.Status = StatusWithdrawn
+    }
+    old := mem.Email
+    mem.Email, mem.DisplayName = Anonymized(mem.ID)
+    mem.Role = "member"
+    mem.DeletedAt = &c.EffectiveAt
+    m.put(mem, old)
+    delete(m.profiles, mem.ID)
+    return mem, nil
+}
+
+func (m *mockRepo) Import(ctx context.Context, rows []ImportRow, commit bool) ([]Member, []error, error) {
+    created := make([]Member, len(rows))
+    errs := make([]error, len(rows))
+    failed := false
+    for i, row := range rows {
+        for email := range m.byEmail {
+            if strings.EqualFold(email, row.Email) { errs[i], failed = ErrConflict, true }
+        }
+        if errs[i] != nil { continue }
+        created[i] = Member{ID: m.nextID + int64(i) + 1, Email: row.Email}
+    }
+    if !commit || failed { return created, errs, nil }
+    for i, row := range rows {
+        created[i], _ = m.Create(ctx, row.Email, row.DisplayName, row.Role, row.Status)
+        if m.profiles == nil { m.profiles = map[int64]Profile{} }
+        m.profiles[created[i].ID] = Profile{Phone: row.Phone, Pronouns: row.Pronouns, Unit: row.Unit, Skills: row.Skills, Committees: row.Committees}
+    }
+    return created, errs, nil
+}
+
+func contains(list []string, v string) bool {
+    for _, s := range list {
+        if s == v { return true }
+    }
+    return false
+}
+
+func (m *mockRepo) StatusHistory(_ context.Context, memberID int64) ([]StatusChange, error) {
+    out := []StatusChange{}
+    for _, h := range m.history {
+        if h.MemberID == memberID { out = append(out, h) }
+    }
+    return out, nil
+}
+
 func (m *mockRepo) GetByID(_ context.Context, id int64) (Member, error) {
     if v, ok := m.byID[id]; ok { return v, nil }
     return Member{}, ErrNotFound
@@ -41,8 +202,14 @@ func (m *mockRepo) GetByEmail(_ context.Context, email string) (Member, error) {
     return Member{}, ErrNotFound
 }
 
+// Member 1 is an admin, 2 a treasurer, 3 a member.
 func setupRouter(repo Repo) *chi.Mux {
+    roles := map[int64]string{1: "admin", 2: "treasurer", 3: "member"}
     r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        role, ok := roles[id]
+        return httpmw.Principal{MemberID: id, Role: role}, ok, nil
+    }))
     h := Handlers{Repo: repo}
     Mount(r, h)
     return r
@@ -54,6 +221,7 @@ func TestMembers_Create_ValidAndDuplicate(t *testing.T) {
 
     // valid create default role
     req := httptest.NewRequest("POST", "/members", strings.NewReader(`{"email":"a@ex.com","display_name":"A"}`))
+    req.Header.Set("X-User-Id", "1")
     req.Header.Set("Content-Type", "application/json")
     rr := httptest.NewRecorder()
     r.ServeHTTP(rr, req)
@@ -64,6 +232,7 @@ func TestMembers_Create_ValidAndDuplicate(t *testing.T) {
 
     // duplicate
     req = httptest.NewRequest("POST", "/members", strings.NewReader(`{"email":"a@ex.com","display_name":"A"}`))
+    req.Header.Set("X-User-Id", "1")
     req.Header.Set("Content-Type", "application/json")
     rr = httptest.NewRecorder()
     r.ServeHTTP(rr, req)
@@ -71,6 +240,7 @@ func TestMembers_Create_ValidAndDuplicate(t *testing.T) {
 
     // admin create
     req = httptest.NewRequest("POST", "/members", strings.NewReader(`{"email":"admin@ex.com","display_name":"Admin","role":"admin"}`))
+    req.Header.Set("X-User-Id", "1")
     req.Header.Set("Content-Type", "application/json")
     rr = httptest.NewRecorder()
     r.ServeHTTP(rr, req)
@@ -82,19 +252,568 @@ func TestMembers_Create_ValidAndDuplicate(t *testing.T) {
 func TestMembers_GetByID_And_FindByEmail(t *testing.T) {
     repo := &mockRepo{}
     // seed
-    m, _ := repo.Create(context.Background(), "x@ex.com", "X", "member")
+    m, _ := repo.Create(context.Background(), "x@ex.com", "X", "member", "")
     r := setupRouter(repo)
 
-    // by id
-    req := httptest.NewRequest("GET", "/members/"+strconv.FormatInt(m.ID,10), nil)
-    rr := httptest.NewRecorder()
-    r.ServeHTTP(rr, req)
-    if rr.Code != http.StatusOK { t.Fatalf("expected 200, got %d", rr.Code) }
+    get := func(path, user string) int {
+        req := httptest.NewRequest("GET", path, nil)
+        if user != "" { req.Header.Set("X-User-Id", user) }
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr.Code
+    }
 
-    // by email
-    req = httptest.NewRequest("GET", "/members?email=x@ex.com", nil)
-    rr = httptest.NewRecorder()
-    r.ServeHTTP(rr, req)
-    if rr.Code != http.StatusOK { t.Fatalf("expected 200, got %d", rr.Code) }
+    // by id: members only
+    if code := get("/members/"+strconv.FormatInt(m.ID,10), "3"); code != http.StatusOK { t.Fatalf("expected 200, got %d", code) }
+    if code := get("/members/"+strconv.FormatInt(m.ID,10), ""); code != http.StatusUnauthorized { t.Fatalf("expected 401, got %d", code) }
+
+    // by email: an exact lookup for members.manage, so nobody else can
+    // probe which addresses belong to members
+    if code := get("/members?email=x@ex.com", "1"); code != http.StatusOK { t.Fatalf("expected 200, got %d", code) }
+    if code := get("/members?email=x@ex.com", "3"); code != http.StatusForbidden { t.Fatalf("expected 403, got %d", code) }
+    if code := get("/members?email=x@ex.com", ""); code != http.StatusUnauthorized { t.Fatalf("expected 401, got %d", code) }
 }
 
+func TestMembers_Create_RequiresPermission(t *testing.T) {
+    repo := &mockRepo{}
+    r := setupRouter(repo)
+    create := func(user, body string) int {
+        req := httptest.NewRequest("POST", "/members", strings.NewReader(body))
+        if user != "" { req.Header.Set("X-User-Id", user) }
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr.Code
+    }
+
+    // anonymous callers can no longer create anyone, let alone admins
+    if code := create("", `{"email":"x@ex.com","display_name":"X","role":"admin"}`); code != http.StatusUnauthorized {
+        t.Fatalf("expected 401, got %d", code)
+    }
+    if code := create("3", `{"email":"x@ex.com","display_name":"X"}`); code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", code)
+    }
+    if len(repo.byID) != 0 { t.Fatalf("member created without permission") }
+
+    // a role manager without every permission cannot create admins
+    repo2 := &mockRepo{}
+    r2 := chi.NewRouter()
+    r2.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        return httpmw.Principal{MemberID: id, Role: "member", Permissions: []string{"members.manage", "roles.manage"}}, true, nil
+    }))
+    Mount(r2, Handlers{Repo: repo2})
+    for body, want := range map[string]int{
+        `{"email":"a@ex.com","display_name":"A","role":"admin"}`:     http.StatusForbidden,
+        `{"email":"t@ex.com","display_name":"T","role":"treasurer"}`: http.StatusCreated,
+    } {
+        req := httptest.NewRequest("POST", "/members", strings.NewReader(body))
+        req.Header.Set("X-User-Id", "7")
+        rr := httptest.NewRecorder()
+        r2.ServeHTTP(rr, req)
+        if rr.Code != want { t.Fatalf("%s: expected %d, got %d", body, want, rr.Code) }
+    }
+}
+
+func TestMembers_Lifecycle(t *testing.T) {
+    repo := &mockRepo{}
+    // Proposals 14 and 15 are about the applicant created below, 16 about
+    // someone else.
+    passed := map[int32]bool{14: true, 15: false, 16: true}
+    var applicant int64
+    // The mock stamps members with the real clock; run an hour ahead of it.
+    now := time.Now().Add(time.Hour)
+    future := now.Add(24 * time.Hour).UTC().Format(time.RFC3339)
+    past := now.AddDate(0, -1, 0).UTC().Format(time.RFC3339)
+    roles := map[int64]string{1: "admin", 3: "member"}
+    r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        role, ok := roles[id]
+        if !ok { role, ok = "member", id > 1 && id < 10 }
+        p := httpmw.Principal{MemberID: id, Role: role}
+        if id == 5 { p.Permissions = []string{"members.manage"} }
+        return p, ok, nil
+    }))
+    Mount(r, Handlers{
+        Repo:         repo,
+        ApprovalVote: true,
+        ProposalPassed: func(_ context.Context, id int32) (bool, *int64, error) {
+            about := applicant
+            if id == 16 { about = 99 }
+            return passed[id], &about, nil
+        },
+        Now:          func() time.Time { return now },
+    })
+    call := func(method, path, user, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-User-Id", user)
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // with board approval on, new members start as applicants
+    if rr := call("POST", "/members", "1", `{"email":"a@ex.com","display_name":"A","status":"active"}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected 400 creating an active member, got %d", rr.Code)
+    }
+    rr := call("POST", "/members", "1", `{"email":"a@ex.com","display_name":"A"}`)
+    var m Member
+    _ = json.Unmarshal(rr.Body.Bytes(), &m)
+    if rr.Code != http.StatusCreated || m.Status != StatusApplicant {
+        t.Fatalf("expected applicant, got %d %+v", rr.Code, m)
+    }
+    applicant = m.ID
+    path := "/members/" + strconv.FormatInt(m.ID, 10) + "/status"
+
+    steps := []struct {
+        user, body string
+        want       int
+    }{
+        {"3", `{"status":"pending"}`, http.StatusForbidden},
+        {"1", `{"status":"active"}`, http.StatusConflict}, // applicants are not approved directly
+        {"1", `{"status":"pending"}`, http.StatusOK},
+        {"1", `{"status":"active"}`, http.StatusBadRequest},                  // no proposal
+        {"1", `{"status":"active","proposal_id":15}`, http.StatusConflict},   // failed vote
+        {"1", `{"status":"active","proposal_id":16}`, http.StatusConflict},   // vote about someone else
+        {"1", `{"status":"active","proposal_id":14,"effective_at":"` + future + `"}`, http.StatusBadRequest},
+        {"1", `{"status":"active","proposal_id":14,"reason":"Approved at the March board meeting"}`, http.StatusOK},
+        {"1", `{"status":"suspended"}`, http.StatusBadRequest}, // reason required
+        {"1", `{"status":"suspended","reason":"Unpaid dues","effective_at":"` + past + `"}`, http.StatusConflict}, // before approval
+        {"1", `{"status":"suspended","reason":"Unpaid dues"}`, http.StatusOK},
+        {"1", `{"status":"active","proposal_id":14}`, http.StatusConflict}, // proposal already used
+        {"1", `{"status":"deceased"}`, http.StatusOK},
+        {"1", `{"status":"active"}`, http.StatusConflict}, // deceased is final
+        {"1", `{"status":"dormant"}`, http.StatusBadRequest},
+    }
+    for i, s := range steps {
+        if rr := call("POST", path, s.user, s.body); rr.Code != s.want {
+            t.Fatalf("step %d %s: expected %d, got %d (%s)", i, s.body, s.want, rr.Code, rr.Body.String())
+        }
+    }
+
+    // the history is visible to the member and to members.manage only
+    if rr := call("GET", path, "3", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+    rr = call("GET", path, "1", "")
+    var history []StatusChange
+    _ = json.Unmarshal(rr.Body.Bytes(), &history)
+    got := []string{}
+    for _, c := range history { got = append(got, c.ToStatus) }
+    if strings.Join(got, ",") != "applicant,pending,active,suspended,deceased" {
+        t.Fatalf("unexpected history %v", got)
+    }
+    if history[2].ProposalID == nil || *history[2].ProposalID != 14 || history[2].ChangedBy == nil || *history[2].ChangedBy != 1 {
+        t.Fatalf("approval not recorded: %+v", history[2])
+    }
+
+    // members.manage alone cannot suspend an admin
+    admin, _ := repo.Create(context.Background(), "root@ex.com", "Root", "admin", StatusActive)
+    adminPath := "/members/" + strconv.FormatInt(admin.ID, 10) + "/status"
+    if rr := call("POST", adminPath, "5", `{"status":"suspended","reason":"Lockout"}`); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403 suspending an admin, got %d (%s)", rr.Code, rr.Body.String())
+    }
+    bo, _ := repo.Create(context.Background(), "bo@ex.com", "Bo", "member", StatusActive)
+    if rr := call("POST", "/members/"+strconv.FormatInt(bo.ID, 10)+"/status", "5", `{"status":"suspended","reason":"Unpaid dues"}`); rr.Code != http.StatusOK {
+        t.Fatalf("expected members.manage to suspend a member, got %d (%s)", rr.Code, rr.Body.String())
+    }
+}
+
+func TestActiveAt(t *testing.T) {
+    at := func(s string) time.Time { v, _ := time.Parse("2006-01-02", s); return v }
+    history := []StatusChange{
+        {ToStatus: StatusApplicant, EffectiveAt: at("2025-01-01")},
+        {ToStatus: StatusActive, EffectiveAt: at("2025-02-01")},
+        {ToStatus: StatusSuspended, EffectiveAt: at("2025-05-01")},
+    }
+    for day, want := range map[string]bool{"2024-12-01": false, "2025-01-15": false, "2025-02-01": true, "2025-04-30": true, "2025-06-01": false} {
+        if got := ActiveAt(history, at(day)); got != want {
+            t.Errorf("%s: expected %v, got %v", day, want, got)
+        }
+    }
+    if !ActiveAt(nil, at("2020-01-01")) {
+        t.Errorf("members without history count as active")
+    }
+}
+
+func TestMembers_DirectoryAndPrivacy(t *testing.T) {
+    repo := &mockRepo{photos: map[int64]int64{31: 2, 32: 3}}
+    ctx := context.Background()
+    repo.Create(ctx, "admin@ex.com", "Admin", "admin", "")
+    repo.Create(ctx, "ana@ex.com", "Ana Ruiz", "member", "")
+    repo.Create(ctx, "ben@ex.com", "Ben Ito", "treasurer", "")
+    repo.Create(ctx, "cy@ex.com", "Cy Applicant", "member", StatusApplicant)
+    r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        m, ok := repo.byID[id]
+        return httpmw.Principal{MemberID: id, Role: m.Role, Status: m.Status}, ok, nil
+    }))
+    Mount(r, Handlers{Repo: repo})
+    call := func(method, path, user, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("X-User-Id", user)
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // Ana fills in her profile and shares her phone but not her unit
+    rr := call("PUT", "/members/2/profile", "2", `{"phone":" 555-0100 ","unit":"4B","pronouns":"she/her","skills":["plumbing","bookkeeping"],"photo_attachment_id":31,"visibility":{"phone":"members","skills":"private"}}`)
+    if rr.Code != http.StatusOK {
+        t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+    }
+    var own Profile
+    _ = json.Unmarshal(rr.Body.Bytes(), &own)
+    if own.Phone != "555-0100" || own.Unit != "4B" || own.Visibility["unit"] != VisibleToNobody || own.Visibility["phone"] != VisibleToMembers {
+        t.Fatalf("unexpected own profile %+v", own)
+    }
+    for body, want := range map[string]int{
+        `{"visibility":{"phone":"public"}}`:  http.StatusBadRequest,
+        `{"visibility":{"salary":"members"}}`: http.StatusBadRequest,
+        `{"photo_attachment_id":32}`:          http.StatusBadRequest, // Ben's photo
+        `{"committees":["finance"]}`:          http.StatusForbidden,
+    } {
+        if rr := call("PUT", "/members/2/profile", "2", body); rr.Code != want {
+            t.Fatalf("%s: expected %d, got %d", body, want, rr.Code)
+        }
+    }
+    if rr := call("PUT", "/members/2/profile", "3", `{"phone":""}`); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403 editing someone else's profile, got %d", rr.Code)
+    }
+    if rr := call("PUT", "/members/2/profile", "1", `{"committees":["finance"]}`); rr.Code != http.StatusOK {
+        t.Fatalf("expected 200 setting committees, got %d", rr.Code)
+    }
+
+    // Ben sees what Ana shares and nothing else
+    var seen Profile
+    _ = json.Unmarshal(call("GET", "/members/2", "3", "").Body.Bytes(), &seen)
+    if seen.Phone != "555-0100" || seen.Pronouns != "she/her" || seen.PhotoID == nil || seen.Unit != "" || seen.Email != "" || seen.Skills != nil || seen.Visibility != nil {
+        t.Fatalf("unexpected redaction %+v", seen)
+    }
+    if len(seen.Committees) != 1 { t.Fatalf("committees are always listed, got %+v", seen.Committees) }
+
+    names := func(rr *httptest.ResponseRecorder) string {
+        var items []Profile
+        _ = json.Unmarshal(rr.Body.Bytes(), &items)
+        var out []string
+        for _, p := range items { out = append(out, p.DisplayName) }
+        return strings.Join(out, ",")
+    }
+    for query, want := range map[string]string{
+        "":                     "Admin,Ana Ruiz,Ben Ito",
+        "?q=ben":               "Ben Ito",
+        "?role=treasurer":      "Ben Ito",
+        "?committee=finance":   "Ana Ruiz",
+        "?skill=plumbing":      "", // Ana keeps her skills private
+        "?status=applicant":    "Cy Applicant",
+        "?status=all&limit=10": "Admin,Ana Ruiz,Ben Ito,Cy Applicant",
+    } {
+        rr := call("GET", "/members"+query, "3", "")
+        if rr.Code != http.StatusOK || names(rr) != want {
+            t.Fatalf("%q: expected %q, got %d %q", query, want, rr.Code, names(rr))
+        }
+    }
+    if got := names(call("GET", "/members?skill=plumbing", "1", "")); got != "Ana Ruiz" {
+        t.Fatalf("members.manage searches every skill, got %q", got)
+    }
+    if rr := call("GET", "/members?status=dormant", "3", ""); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected 400, got %d", rr.Code)
+    }
+
+    // applicants cannot browse, but can read their own profile
+    if rr := call("GET", "/members", "4", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+    if rr := call("GET", "/members/2", "4", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+    if rr := call("GET", "/members/4", "4", ""); rr.Code != http.StatusOK {
+        t.Fatalf("expected 200, got %d", rr.Code)
+    }
+}
+
+// outbox records sent mail.
+type outbox struct{ sent []mail.Message }
+
+func (o *outbox) Send(_ context.Context, m mail.Message) error {
+    o.sent = append(o.sent, m)
+    return nil
+}
+
+func TestMembers_AccountEdits(t *testing.T) {
+    repo := &mockRepo{}
+    ctx := context.Background()
+    repo.Create(ctx, "admin@ex.com", "Admin", "admin", "")
+    repo.Create(ctx, "tess@ex.com", "Tess", "treasurer", "")
+    repo.Create(ctx, "ana@ex.com", "Ana", "member", "")
+    repo.Create(ctx, "ben@ex.com", "Ben", "member", "")
+    // member 5 manages members but holds no roles.manage
+    repo.Create(ctx, "sec@ex.com", "Secretary", "member", "")
+    now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+    box := &outbox{}
+    r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        m, ok := repo.byID[id]
+        p := httpmw.Principal{MemberID: id, Role: m.Role, Status: m.Status}
+        if id == 5 { p.Permissions = []string{"members.manage"} }
+        return p, ok && m.DeletedAt == nil, nil
+    }))
+    var forgotten []int64
+    Mount(r, Handlers{Repo: repo, Now: func() time.Time { return now }, Mailer: box, ConfirmURL: "https://coop.example/account/email",
+        Forget: func(_ context.Context, id int64) error { forgotten = append(forgotten, id); return nil }})
+    call := func(method, path, user, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        if user != "" { req.Header.Set("X-User-Id", user) }
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr
+    }
+
+    // members rename themselves, not each other, and cannot promote themselves
+    if rr := call("PATCH", "/members/3", "3", `{"display_name":"  Ana Ruiz "}`); rr.Code != http.StatusOK || repo.byID[3].DisplayName != "Ana Ruiz" {
+        t.Fatalf("expected rename, got %d %s", rr.Code, rr.Body.String())
+    }
+    for _, tc := range []struct {
+        user, body string
+        want int
+    }{
+        {"4", `{"display_name":"Mallory"}`, http.StatusForbidden},
+        {"3", `{"role":"admin"}`, http.StatusForbidden},
+        {"3", `{"display_name":"   "}`, http.StatusBadRequest},
+        {"3", `{}`, http.StatusBadRequest},
+        {"", `{"display_name":"Anon"}`, http.StatusUnauthorized},
+    } {
+        if rr := call("PATCH", "/members/3", tc.user, tc.body); rr.Code != tc.want {
+            t.Fatalf("%s as %q: expected %d, got %d", tc.body, tc.user, tc.want, rr.Code)
+        }
+    }
+
+    // role changes follow the rules for creating members
+    for _, tc := range []struct {
+        user, id, role string
+        want int
+    }{
+        {"5", "3", "treasurer", http.StatusForbidden}, // granting needs roles.manage
+        {"5", "2", "member", http.StatusForbidden},    // so does taking away
+        {"1", "1", "member", http.StatusForbidden},    // nobody demotes themselves
+        {"1", "3", "owner", http.StatusBadRequest},
+        {"1", "3", "treasurer", http.StatusOK},
+        {"1", "2", "member", http.StatusOK},
+    } {
+        if rr := call("PATCH", "/members/"+tc.id, tc.user, `{"role":"`+tc.role+`"}`); rr.Code != tc.want {
+            t.Fatalf("%s sets %s to %s: expected %d, got %d", tc.user, tc.id, tc.role, tc.want, rr.Code)
+        }
+    }
+    if repo.byID[3].Role != "treasurer" || repo.byID[2].Role != "member" {
+        t.Fatalf("roles not saved: %+v %+v", repo.byID[3], repo.byID[2])
+    }
+
+    // email changes wait for the new address to confirm
+    if rr := call("POST", "/members/4/email", "4", `{"email":"ana@ex.com"}`); rr.Code != http.StatusConflict {
+        t.Fatalf("expected 409 for a taken address, got %d", rr.Code)
+    }
+    for _, bad := range []string{`{"email":"not-an-email"}`, `{"email":"Ben <ben@new.example>"}`, `{"email":"ben@ex.com"}`} {
+        if rr := call("POST", "/members/4/email", "4", bad); rr.Code != http.StatusBadRequest {
+            t.Fatalf("%s: expected 400, got %d", bad, rr.Code)
+        }
+    }
+    if rr := call("POST", "/members/4/email", "3", `{"email":"ben@new.example"}`); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+    rr := call("POST", "/members/4/email", "4", `{"email":"ben@new.example"}`)
+    if rr.Code != http.StatusAccepted || len(box.sent) != 2 {
+        t.Fatalf("expected 202 and two emails, got %d %d", rr.Code, len(box.sent))
+    }
+    if box.sent[0].To != "ben@new.example" || box.sent[1].To != "ben@ex.com" || repo.byID[4].Email != "ben@ex.com" {
+        t.Fatalf("unexpected mail or early change: %+v", box.sent)
+    }
+    token := func(m mail.Message) string {
+        i := strings.Index(m.Text, "token=")
+        return strings.Fields(m.Text[i+len("token="):])[0]
+    }
+    first := token(box.sent[0])
+    // asking again replaces the first link
+    call("POST", "/members/4/email", "4", `{"email":"ben@other.example"}`)
+    if rr := call("POST", "/members/email/confirm", "", `{"token":"`+first+`"}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected the replaced link to fail, got %d", rr.Code)
+    }
+    second := token(box.sent[2])
+    now = now.Add(25 * time.Hour)
+    if rr := call("POST", "/members/email/confirm", "", `{"token":"`+second+`"}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected an expired link to fail, got %d", rr.Code)
+    }
+    call("POST", "/members/4/email", "4", `{"email":"ben@other.example"}`)
+    third := token(box.sent[4])
+    if rr := call("POST", "/members/email/confirm", "", `{"token":"`+third+`"}`); rr.Code != http.StatusOK || repo.byID[4].Email != "ben@other.example" {
+        t.Fatalf("expected confirmation, got %d %s", rr.Code, rr.Body.String())
+    }
+    if rr := call("POST", "/members/email/confirm", "", `{"token":"`+third+`"}`); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected a used link to fail, got %d", rr.Code)
+    }
+
+    // deletion anonymizes the member and withdraws them
+    repo.UpdateProfile(ctx, Profile{ID: 4, Phone: "555-0100"})
+    if rr := call("DELETE", "/members/4", "3", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+    if rr := call("DELETE", "/members/1", "1", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403 deleting yourself, got %d", rr.Code)
+    }
+    if rr := call("DELETE", "/members/1", "5", ""); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403 deleting an admin without *, got %d", rr.Code)
+    }
+    rr = call("DELETE", "/members/4", "1", `{"reason":"Asked to be forgotten"}`)
+    if rr.Code != http.StatusOK {
+        t.Fatalf("expected 200, got %d %s", rr.Code, rr.Body.String())
+    }
+    var gone Member
+    _ = json.Unmarshal(rr.Body.Bytes(), &gone)
+    if gone.Email != "deleted-4@members.invalid" || gone.DisplayName != "Former member 4" || gone.Status != StatusWithdrawn || gone.DeletedAt == nil {
+        t.Fatalf("unexpected deleted member %+v", gone)
+    }
+    if _, ok := repo.byEmail["ben@other.example"]; ok || repo.profiles[4].Phone != "" {
+        t.Fatal("personal data kept after deletion")
+    }
+    last := repo.history[len(repo.history)-1]
+    if last.MemberID != 4 || last.ToStatus != StatusWithdrawn || last.Reason != "Asked to be forgotten" {
+        t.Fatalf("unexpected status change %+v", last)
+    }
+    if len(forgotten) != 1 || forgotten[0] != 4 {
+        t.Fatalf("expected Forget(4), got %v", forgotten)
+    }
+    for _, tc := range []struct{ method, path, body string }{
+        {"DELETE", "/members/4", ""},
+        {"PATCH", "/members/4", `{"display_name":"Ben"}`},
+        {"PUT", "/members/4/profile", `{"phone":"555-0100"}`},
+        {"POST", "/members/4/email", `{"email":"ben@again.example"}`},
+        {"POST", "/members/4/status", `{"status":"applicant"}`},
+    } {
+        if rr := call(tc.method, tc.path, "1", tc.body); rr.Code != http.StatusConflict {
+            t.Fatalf("%s %s on a deleted member: expected 409, got %d", tc.method, tc.path, rr.Code)
+        }
+    }
+}
+
+func TestMembers_ImportExport(t *testing.T) {
+    repo := &mockRepo{}
+    ctx := context.Background()
+    repo.Create(ctx, "admin@ex.com", "Admin", "admin", "")
+    repo.Create(ctx, "taken@ex.com", "Existing", "member", "")
+    repo.Create(ctx, "sec@ex.com", "Secretary", "member", "")
+    r := chi.NewRouter()
+    r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+        m, ok := repo.byID[id]
+        p := httpmw.Principal{MemberID: id, Role: m.Role, Status: m.Status}
+        // member 3 may manage members but not hand out roles
+        if id == 3 { p.Permissions = []string{"members.manage"} }
+        return p, ok, nil
+    }))
+    Mount(r, Handlers{Repo: repo})
+    call := func(method, path, user, body string) *httptest.ResponseRecorder {
+        req := httptest.NewRequest(method, path, strings.NewReader(body))
+        req.Header.Set("Content-Type", "text/csv")
+        if user != "" { req.Header.Set("X-User-Id", user) }
+        rr := httptest.NewRecorder()
+        r.ServeHTTP(rr, req)
+        return rr
+    }
+    report := func(rr *httptest.ResponseRecorder) ImportReport {
+        var rep ImportReport
+        if err := json.Unmarshal(rr.Body.Bytes(), &rep); err != nil { t.Fatalf("bad report %s", rr.Body.String()) }
+        return rep
+    }
+
+    // a mailing-list export: headers map by name, or by ?map= when they don't
+    file := "\ufeffE-mail Address,Member,Phone Number,Committee,Notes\n" +
+        "ana@ex.com,Ana Ruiz,555-0100,finance; garden,first\n" +
+        "\n" +
+        "ben@ex.com,Ben Ito,,,\n"
+    rr := call("POST", "/members/import/preview", "1", file)
+    if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "map=display_name") {
+        t.Fatalf("expected the missing name column to be reported, got %d %s", rr.Code, rr.Body.String())
+    }
+    rr = call("POST", "/members/import/preview?map=display_name=member", "1", file)
+    var preview struct {
+        CSVImport
+        Total int `json:"total"`
+    }
+    _ = json.Unmarshal(rr.Body.Bytes(), &preview)
+    if rr.Code != http.StatusOK || preview.Total != 2 || preview.Mapping["email"] != "E-mail Address" || preview.Mapping["display_name"] != "Member" ||
+        strings.Join(preview.Unmapped, ",") != "Notes" || preview.Rows[0].Phone != "555-0100" || len(preview.Rows[0].Committees) != 2 || preview.Rows[1].Line != 4 {
+        t.Fatalf("unexpected preview %d %+v", rr.Code, preview)
+    }
+    if rr := call("POST", "/members/import/preview?map=salary=Notes", "1", file); rr.Code != http.StatusBadRequest {
+        t.Fatalf("expected 400 for an unknown field, got %d", rr.Code)
+    }
+    if rr := call("POST", "/members/import?map=display_name=member", "2", file); rr.Code != http.StatusForbidden {
+        t.Fatalf("expected 403, got %d", rr.Code)
+    }
+
+    // every problem is reported per row and nothing is written
+    bad := "email,display_name,role,status\n" +
+        "new@ex.com,New Person,,\n" +
+        "TAKEN@ex.com,Dup In Db,,\n" +
+        "new@EX.com,Dup In File,,\n" +
+        "nope,,owner,dormant\n" +
+        "tess@ex.com,Tess,treasurer,\n"
+    rr = call("POST", "/members/import", "3", bad)
+    rep := report(rr)
+    if rr.Code != http.StatusBadRequest || rep.Total != 5 || rep.Valid != 1 || rep.Invalid != 4 || rep.Created != 0 || rep.Error == "" {
+        t.Fatalf("unexpected report %d %+v", rr.Code, rep)
+    }
+    want := []string{
+        "",
+        "email already belongs to a member",
+        "email is also on line 2",
+        `invalid email; display_name required; invalid role "owner"; status must be applicant, pending or active`,
+        "you may not grant the treasurer role",
+    }
+    for i, w := range want {
+        if got := strings.Join(rep.Rows[i].Errors, "; "); got != w {
+            t.Fatalf("row %d: expected %q, got %q", i, w, got)
+        }
+    }
+    if len(repo.byID) != 3 { t.Fatalf("nothing should be imported, have %d members", len(repo.byID)) }
+
+    // a dry run reports without writing; the real run creates everyone
+    good := "email,display_name,role,status,phone,skills\n" +
+        "ana@ex.com,Ana Ruiz,,,'+1 555 0100,plumbing; bookkeeping\n" +
+        "ben@ex.com,Ben Ito,treasurer,pending,,\n"
+    rr = call("POST", "/members/import?dry_run=true", "1", good)
+    if rep := report(rr); rr.Code != http.StatusOK || !rep.DryRun || rep.Valid != 2 || rep.Created != 0 || rep.Rows[0].ID != 0 || len(repo.byID) != 3 {
+        t.Fatalf("unexpected dry run %d %+v", rr.Code, rep)
+    }
+    rr = call("POST", "/members/import", "1", good)
+    rep = report(rr)
+    if rr.Code != http.StatusCreated || rep.Created != 2 || rep.Rows[0].ID != 4 || rep.Rows[1].ID != 5 {
+        t.Fatalf("unexpected import %d %+v", rr.Code, rep)
+    }
+    if ana, ben := repo.byID[4], repo.byID[5]; ana.Status != StatusActive || ana.Role != "member" || ben.Status != StatusPending || ben.Role != "treasurer" {
+        t.Fatalf("unexpected members %+v %+v", ana, ben)
+    }
+    if p := repo.profiles[4]; p.Phone != "+1 555 0100" || strings.Join(p.Skills, ",") != "plumbing,bookkeeping" {
+        t.Fatalf("unexpected profile %+v", p)
+    }
+
+    // the export reads back in, and keeps spreadsheet formulas inert
+    rr = call("GET", "/members/export.csv?status=all", "1", "")
+    if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+        t.Fatalf("unexpected export %d", rr.Code)
+    }
+    lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+    if lines[0] != "email,display_name,role,status,phone,pronouns,unit,skills,committees" || len(lines) != 6 ||
+        !contains(lines, "ana@ex.com,Ana Ruiz,member,active,'+1 555 0100,,,plumbing; bookkeeping,") {
+        t.Fatalf("unexpected export:\n%s", rr.Body.String())
+    }
+    back, err := ParseCSV(strings.NewReader(rr.Body.String()), nil)
+    if err != nil || len(back.Rows) != 5 || back.Rows[3].Phone != "+1 555 0100" || len(back.Rows[3].Skills) != 2 {
+        t.Fatalf("export does not read back: %v %+v", err, back.Rows)
+    }
+    // members get the directory with the same privacy as List: Ana sees
+    // her own phone but nobody else's email
+    rr = call("GET", "/members/export.csv", "4", "")
+    if strings.Contains(rr.Body.String(), "taken@ex.com") || !strings.Contains(rr.Body.String(), "Existing") || !strings.Contains(rr.Body.String(), "'+1 555 0100") {
+        t.Fatalf("export leaks private fields:\n%s", rr.Body.String())
+    }
+    if rr := call("GET", "/members/export.csv", "", ""); rr.Code != http.StatusUnauthorized {
+        t.Fatalf("expected 401, got %d", rr.Code)
+    }
+}
@@ -0,0 +1,5 @@
+-- backend/internal/members/migrations/0002_treasurer_role.sql
+-- Allow the treasurer role used for reimbursement approvals.
+ALTER TABLE members DROP CONSTRAINT IF EXISTS members_role_chk;
+ALTER TABLE members
+  ADD CONSTRAINT members_role_chk CHECK (role IN ('admin','treasurer','member'));
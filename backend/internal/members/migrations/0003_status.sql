@@ -0,0 +1,35 @@
+-- backend/internal/members/migrations/0003_status.sql
+-- Membership lifecycle. members.status is the current status; every change
+-- is kept in member_status_changes with the date it took effect, which is
+-- what dues and eligibility look back on.
+ALTER TABLE members ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+
+DO $$
+BEGIN
+  IF NOT EXISTS (
+    SELECT 1 FROM pg_constraint WHERE conname='members_status_chk'
+  ) THEN
+    ALTER TABLE members
+      ADD CONSTRAINT members_status_chk
+      CHECK (status IN ('applicant','pending','active','suspended','withdrawn','deceased'));
+  END IF;
+END$$;
+
+CREATE TABLE IF NOT EXISTS member_status_changes (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  from_status TEXT,
+  to_status TEXT NOT NULL,
+  effective_at TIMESTAMPTZ NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  proposal_id INTEGER,
+  changed_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS member_status_changes_member_idx ON member_status_changes(member_id, effective_at);
+
+-- Everyone who existed before the lifecycle has been active since joining.
+INSERT INTO member_status_changes (member_id, to_status, effective_at, reason)
+SELECT m.id, 'active', m.created_at, 'existing member'
+FROM members m
+WHERE NOT EXISTS (SELECT 1 FROM member_status_changes c WHERE c.member_id=m.id);
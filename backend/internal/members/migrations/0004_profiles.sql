@@ -0,0 +1,20 @@
+-- backend/internal/members/migrations/0004_profiles.sql
+-- Directory profiles. Each member chooses who sees each optional field:
+-- visibility maps a field name to 'members' or 'private'; fields left out
+-- use the defaults in members.DefaultVisibility.
+CREATE TABLE IF NOT EXISTS member_profiles (
+  member_id BIGINT PRIMARY KEY REFERENCES members(id) ON DELETE CASCADE,
+  phone TEXT NOT NULL DEFAULT '',
+  pronouns TEXT NOT NULL DEFAULT '',
+  unit TEXT NOT NULL DEFAULT '',
+  skills TEXT[] NOT NULL DEFAULT '{}',
+  bio TEXT NOT NULL DEFAULT '',
+  -- An attachments row with owner_type 'member_photo'; attachments are
+  -- migrated after members, so there is no foreign key.
+  photo_attachment_id BIGINT,
+  committees TEXT[] NOT NULL DEFAULT '{}',
+  visibility JSONB NOT NULL DEFAULT '{}',
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS member_profiles_committees_idx ON member_profiles USING GIN (committees);
+CREATE INDEX IF NOT EXISTS members_display_name_idx ON members (lower(display_name));
@@ -0,0 +1,19 @@
+-- backend/internal/members/migrations/0005_account.sql
+-- Account changes. Deleting a member anonymizes the row instead of
+-- removing it, so votes, ledger entries and announcement reads keep their
+-- member_id; deleted_at marks it.
+ALTER TABLE members ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Email changes wait here until the new address is confirmed from the
+-- link sent to it. Only the token's SHA-256 hash is stored.
+CREATE TABLE IF NOT EXISTS member_email_changes (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  new_email TEXT NOT NULL,
+  token_hash BYTEA NOT NULL UNIQUE,
+  requested_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  confirmed_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS member_email_changes_member_idx ON member_email_changes (member_id);
@@ -1,15 +1,237 @@
 package members
 
-import "time"
+import (
+    "fmt"
+    "time"
+)
 
 // Member represents a cooperative member/user.
 // ID uses BIGINT in DB to allow growth; we expose as int64 here.
 type Member struct {
+    ID          int64      `json:"id"`
+    Email       string     `json:"email"`
+    DisplayName string     `json:"display_name"`
+    Role        string     `json:"role"`
+    Status      string     `json:"status"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+    // DeletedAt is set once the member has been deleted and anonymized.
+    DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Roles lists every base role allowed by members_role_chk. Other roles,
+// such as secretary, are assigned on top through internal/rbac.
+var Roles = []string{"admin", "treasurer", "member"}
+
+// ValidRole reports whether r is a known member role.
+func ValidRole(r string) bool {
+    for _, v := range Roles {
+        if v == r {
+            return true
+        }
+    }
+    return false
+}
+
+// Membership statuses. A member applies, waits for approval, becomes
+// active, and may later be suspended, withdraw or die.
+const (
+    StatusApplicant = "applicant"
+    StatusPending   = "pending"
+    StatusActive    = "active"
+    StatusSuspended = "suspended"
+    StatusWithdrawn = "withdrawn"
+    StatusDeceased  = "deceased"
+)
+
+// Transitions lists the statuses each status may move to. Withdrawn
+// members can apply again; deceased is final.
+var Transitions = map[string][]string{
+    StatusApplicant: {StatusPending, StatusWithdrawn},
+    StatusPending:   {StatusActive, StatusApplicant, StatusWithdrawn},
+    StatusActive:    {StatusSuspended, StatusWithdrawn, StatusDeceased},
+    StatusSuspended: {StatusActive, StatusWithdrawn, StatusDeceased},
+    StatusWithdrawn: {StatusApplicant},
+    StatusDeceased:  {},
+}
+
+// ValidStatus reports whether s is a known membership status.
+func ValidStatus(s string) bool {
+    _, ok := Transitions[s]
+    return ok
+}
+
+// CanTransition reports whether a member may move from one status to another.
+func CanTransition(from, to string) bool {
+    for _, v := range Transitions[from] {
+        if v == to {
+            return true
+        }
+    }
+    return false
+}
+
+// CanSignIn reports whether a member with status s may hold a session.
+// Applicants and suspended members still sign in to follow their
+// application or standing; former members do not.
+func CanSignIn(s string) bool {
+    return s != StatusWithdrawn && s != StatusDeceased
+}
+
+// StatusChange records one move in a member's lifecycle. ProposalID links
+// the board vote that approved it, when there was one.
+type StatusChange struct {
     ID          int64     `json:"id"`
-    Email       string    `json:"email"`
-    DisplayName string    `json:"display_name"`
-    Role        string    `json:"role"`
+    MemberID    int64     `json:"member_id"`
+    FromStatus  *string   `json:"from_status"`
+    ToStatus    string    `json:"to_status"`
+    EffectiveAt time.Time `json:"effective_at"`
+    Reason      string    `json:"reason"`
+    ProposalID  *int32    `json:"proposal_id,omitempty"`
+    ChangedBy   *int64    `json:"changed_by,omitempty"`
     CreatedAt   time.Time `json:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ActiveAt reports whether a member whose history is changes (oldest
+// first) was active at t. Before the first change they were not a member
+// at all; members with no history predate the lifecycle and count as
+// active throughout.
+func ActiveAt(changes []StatusChange, t time.Time) bool {
+    if len(changes) == 0 {
+        return true
+    }
+    status := ""
+    for _, c := range changes {
+        if c.EffectiveAt.After(t) {
+            break
+        }
+        status = c.ToStatus
+    }
+    return status == StatusActive
+}
+
+// Profile visibility levels: "members" shows a field to every active
+// member; "private" only to the member and to members.manage.
+const (
+    VisibleToMembers = "members"
+    VisibleToNobody  = "private"
+)
+
+// DefaultVisibility is who sees each optional profile field until the
+// member chooses otherwise. Contact details start private.
+var DefaultVisibility = map[string]string{
+    "email":    VisibleToNobody,
+    "phone":    VisibleToNobody,
+    "unit":     VisibleToNobody,
+    "pronouns": VisibleToMembers,
+    "skills":   VisibleToMembers,
+    "bio":      VisibleToMembers,
+    "photo":    VisibleToMembers,
+}
+
+// Profile is a member's directory entry. Name, role, status and
+// committees are always shown to members; every other field follows
+// Visibility. Unit is the member's housing unit or household.
+type Profile struct {
+    ID          int64             `json:"id"`
+    DisplayName string            `json:"display_name"`
+    Role        string            `json:"role"`
+    Status      string            `json:"status"`
+    Committees  []string          `json:"committees"`
+    Email       string            `json:"email,omitempty"`
+    Phone       string            `json:"phone,omitempty"`
+    Pronouns    string            `json:"pronouns,omitempty"`
+    Unit        string            `json:"unit,omitempty"`
+    Skills      []string          `json:"skills,omitempty"`
+    Bio         string            `json:"bio,omitempty"`
+    PhotoID     *int64            `json:"photo_attachment_id,omitempty"`
+    Visibility  map[string]string `json:"visibility,omitempty"`
+    CreatedAt   time.Time         `json:"created_at"`
+}
+
+// Visible reports who sees field: the member's choice or the default.
+func (p Profile) Visible(field string) string {
+    if v, ok := p.Visibility[field]; ok {
+        return v
+    }
+    return DefaultVisibility[field]
+}
+
+// Redacted is p as other members see it: private fields and the
+// visibility settings themselves are left out.
+func (p Profile) Redacted() Profile {
+    hide := func(field string) bool { return p.Visible(field) != VisibleToMembers }
+    if hide("email") { p.Email = "" }
+    if hide("phone") { p.Phone = "" }
+    if hide("pronouns") { p.Pronouns = "" }
+    if hide("unit") { p.Unit = "" }
+    if hide("skills") { p.Skills = nil }
+    if hide("bio") { p.Bio = "" }
+    if hide("photo") { p.PhotoID = nil }
+    p.Visibility = nil
+    return p
+}
+
+// withDefaults fills in the default for every field the member has not
+// set, so owners see the full picture.
+func (p Profile) withDefaults() Profile {
+    v := make(map[string]string, len(DefaultVisibility))
+    for field := range DefaultVisibility {
+        v[field] = p.Visible(field)
+    }
+    p.Visibility = v
+    return p
+}
+
+// ValidVisibility reports whether every entry names a profile field and
+// a visibility level.
+func ValidVisibility(v map[string]string) bool {
+    for field, level := range v {
+        if _, ok := DefaultVisibility[field]; !ok {
+            return false
+        }
+        if level != VisibleToMembers && level != VisibleToNobody {
+            return false
+        }
+    }
+    return true
+}
+
+// DirectoryFilters narrows the member directory. Role matches base and
+// assigned roles; Skill only matches members who show their skills,
+// unless AllFields is set for members.manage.
+type DirectoryFilters struct {
+    Query     string
+    Role      string
+    Committee string
+    Status    string
+    Skill     string
+    AllFields bool
+    Limit     int
+    Offset    int
+}
+
+// Update changes a member's account. Nil fields are kept.
+type Update struct {
+    DisplayName *string
+    Role        *string
+}
+
+// EmailChange is a request to move a member to a new email address. It
+// takes effect when the link sent to NewEmail is opened before ExpiresAt.
+type EmailChange struct {
+    ID          int64      `json:"id"`
+    MemberID    int64      `json:"member_id"`
+    NewEmail    string     `json:"new_email"`
+    RequestedBy *int64     `json:"requested_by,omitempty"`
+    ExpiresAt   time.Time  `json:"expires_at"`
+    ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Anonymized returns the email and display name a deleted member's row
+// keeps. The address uses the reserved .invalid domain, so it can never
+// receive mail or sign in.
+func Anonymized(id int64) (email, displayName string) {
+    return fmt.Sprintf("deleted-%d@members.invalid", id), fmt.Sprintf("Former member %d", id)
+}
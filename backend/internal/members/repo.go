@@ -3,6 +3,9 @@ package members
 import (
     "context"
     "errors"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgconn"
@@ -13,29 +16,90 @@ import (
 var (
     ErrNotFound = errors.New("member not found")
     ErrConflict = errors.New("member conflict")
+    // ErrTransition means the member's current status cannot move to the
+    // requested one.
+    ErrTransition = errors.New("status change not allowed")
+    // ErrEffectiveOrder means a change would take effect before the
+    // member's latest recorded change.
+    ErrEffectiveOrder = errors.New("status change predates the latest change")
+    // ErrProposalUsed means the proposal already backs a recorded status
+    // change.
+    ErrProposalUsed = errors.New("proposal already used")
+    // ErrPhoto means the photo is not an image attached to the member as
+    // a member_photo.
+    ErrPhoto = errors.New("invalid profile photo")
+    // ErrDeleted means the member has been deleted and anonymized, so the
+    // account can no longer change.
+    ErrDeleted = errors.New("member deleted")
 )
 
 type Repo interface {
-    Create(ctx context.Context, email, displayName, role string) (Member, error)
+    Create(ctx context.Context, email, displayName, role, status string) (Member, error)
     GetByID(ctx context.Context, id int64) (Member, error)
     GetByEmail(ctx context.Context, email string) (Member, error)
+    // ChangeStatus moves a member to c.ToStatus as of c.EffectiveAt and
+    // records the change. A c.ProposalID already on a recorded change
+    // returns ErrProposalUsed.
+    ChangeStatus(ctx context.Context, c StatusChange) (Member, StatusChange, error)
+    StatusHistory(ctx context.Context, memberID int64) ([]StatusChange, error)
+    // Directory lists member profiles by name. Results are unredacted.
+    Directory(ctx context.Context, f DirectoryFilters) ([]Profile, error)
+    GetProfile(ctx context.Context, id int64) (Profile, error)
+    // UpdateProfile saves p's optional fields, committees and visibility.
+    UpdateProfile(ctx context.Context, p Profile) (Profile, error)
+    Update(ctx context.Context, id int64, u Update) (Member, error)
+    // RequestEmailChange stores c, replacing any unconfirmed change for
+    // the member, until the token hashing to tokenHash confirms it.
+    RequestEmailChange(ctx context.Context, c EmailChange, tokenHash []byte) (EmailChange, error)
+    // ConfirmEmailChange applies the unexpired, unconfirmed change for
+    // tokenHash and returns the updated member. Unknown, used and expired
+    // tokens return ErrNotFound.
+    ConfirmEmailChange(ctx context.Context, tokenHash []byte, now time.Time) (Member, error)
+    // Delete anonymizes a member: it clears their name, email and profile,
+    // and withdraws them if they are still a member, recording c.Reason.
+    // The row stays so records that reference it keep their member_id.
+    Delete(ctx context.Context, c StatusChange) (Member, error)
+    // Import creates rows in one transaction, each with its first status
+    // change and any profile fields. errs holds one entry per row: nil, or
+    // ErrConflict when the email is taken. The transaction commits only
+    // when commit is set and every row succeeded; otherwise nothing is
+    // written.
+    Import(ctx context.Context, rows []ImportRow, commit bool) (created []Member, errs []error, err error)
 }
 
 type PgRepo struct{ Pool *pgxpool.Pool }
 
 func NewPgRepo(pool *pgxpool.Pool) *PgRepo { return &PgRepo{Pool: pool} }
 
-func (r *PgRepo) Create(ctx context.Context, email, displayName, role string) (Member, error) {
-    if role == "" { role = "member" }
+const memberCols = `id, email, display_name, role, status, created_at, updated_at, deleted_at`
+
+func scanMember(row pgx.Row) (Member, error) {
     var m Member
-    var createdAt, updatedAt pgtype.Timestamptz
-    err := r.Pool.QueryRow(ctx, `
-INSERT INTO members (email, display_name, role)
-VALUES ($1,$2,$3)
-RETURNING id, email, display_name, role, created_at, updated_at
-`, email, displayName, role).Scan(
-        &m.ID, &m.Email, &m.DisplayName, &m.Role, &createdAt, &updatedAt,
-    )
+    var createdAt, updatedAt, deletedAt pgtype.Timestamptz
+    if err := row.Scan(&m.ID, &m.Email, &m.DisplayName, &m.Role, &m.Status, &createdAt, &updatedAt, &deletedAt); err != nil {
+        if err == pgx.ErrNoRows { return Member{}, ErrNotFound }
+        return Member{}, err
+    }
+    m.CreatedAt = createdAt.Time
+    m.UpdatedAt = updatedAt.Time
+    if deletedAt.Valid { m.DeletedAt = &deletedAt.Time }
+    return m, nil
+}
+
+// Create adds a member with the given status (active when empty) and
+// records it as the member's first status change.
+func (r *PgRepo) Create(ctx context.Context, email, displayName, role, status string) (Member, error) {
+    if role == "" { role = "member" }
+    if status == "" { status = StatusActive }
+    tx, err := r.Pool.Begin(ctx)
+    if err != nil {
+        return Member{}, err
+    }
+    defer tx.Rollback(ctx)
+    m, err := scanMember(tx.QueryRow(ctx, `
+INSERT INTO members (email, display_name, role, status)
+VALUES ($1,$2,$3,$4)
+RETURNING `+memberCols, email, displayName, role, status))
     if err != nil {
         var pgErr *pgconn.PgError
         if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
@@ -43,40 +107,428 @@ RETURNING id, email, display_name, role, created_at, updated_at
         }
         return Member{}, err
     }
-    m.CreatedAt = createdAt.Time
-    m.UpdatedAt = updatedAt.Time
-    return m, nil
+    if _, err := tx.Exec(ctx, `
+INSERT INTO member_status_changes (member_id, to_status, effective_at)
+VALUES ($1,$2,$3)`, m.ID, status, m.CreatedAt); err != nil {
+        return Member{}, err
+    }
+    return m, tx.Commit(ctx)
 }
 
 func (r *PgRepo) GetByID(ctx context.Context, id int64) (Member, error) {
-    var m Member
-    var createdAt, updatedAt pgtype.Timestamptz
-    err := r.Pool.QueryRow(ctx, `
-SELECT id, email, display_name, role, created_at, updated_at
-FROM members WHERE id=$1
-`, id).Scan(&m.ID, &m.Email, &m.DisplayName, &m.Role, &createdAt, &updatedAt)
+    return scanMember(r.Pool.QueryRow(ctx, `SELECT `+memberCols+` FROM members WHERE id=$1`, id))
+}
+
+func (r *PgRepo) GetByEmail(ctx context.Context, email string) (Member, error) {
+    return scanMember(r.Pool.QueryRow(ctx, `SELECT `+memberCols+` FROM members WHERE email=$1`, email))
+}
+
+func (r *PgRepo) ChangeStatus(ctx context.Context, c StatusChange) (Member, StatusChange, error) {
+    tx, err := r.Pool.Begin(ctx)
+    if err != nil {
+        return Member{}, StatusChange{}, err
+    }
+    defer tx.Rollback(ctx)
+    var from string
+    var deleted bool
+    if err := tx.QueryRow(ctx, `SELECT status, deleted_at IS NOT NULL FROM members WHERE id=$1 FOR UPDATE`, c.MemberID).Scan(&from, &deleted); err != nil {
+        if err == pgx.ErrNoRows { return Member{}, StatusChange{}, ErrNotFound }
+        return Member{}, StatusChange{}, err
+    }
+    if deleted {
+        return Member{}, StatusChange{}, ErrDeleted
+    }
+    if !CanTransition(from, c.ToStatus) {
+        return Member{}, StatusChange{}, ErrTransition
+    }
+    var latest pgtype.Timestamptz
+    if err := tx.QueryRow(ctx, `SELECT max(effective_at) FROM member_status_changes WHERE member_id=$1`, c.MemberID).Scan(&latest); err != nil {
+        return Member{}, StatusChange{}, err
+    }
+    if latest.Valid && c.EffectiveAt.Before(latest.Time) {
+        return Member{}, StatusChange{}, ErrEffectiveOrder
+    }
+    if c.ProposalID != nil {
+        var used bool
+        if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM member_status_changes WHERE proposal_id=$1)`, *c.ProposalID).Scan(&used); err != nil {
+            return Member{}, StatusChange{}, err
+        }
+        if used {
+            return Member{}, StatusChange{}, ErrProposalUsed
+        }
+    }
+    m, err := scanMember(tx.QueryRow(ctx, `UPDATE members SET status=$2 WHERE id=$1 RETURNING `+memberCols, c.MemberID, c.ToStatus))
+    if err != nil {
+        return Member{}, StatusChange{}, err
+    }
+    out, err := scanChange(tx.QueryRow(ctx, `
+INSERT INTO member_status_changes (member_id, from_status, to_status, effective_at, reason, proposal_id, changed_by)
+VALUES ($1,$2,$3,$4,$5,$6,$7)
+RETURNING `+changeCols, c.MemberID, from, c.ToStatus, c.EffectiveAt, c.Reason, c.ProposalID, c.ChangedBy))
+    if err != nil {
+        return Member{}, StatusChange{}, err
+    }
+    return m, out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) StatusHistory(ctx context.Context, memberID int64) ([]StatusChange, error) {
+    rows, err := r.Pool.Query(ctx, `
+SELECT `+changeCols+`
+FROM member_status_changes
+WHERE member_id=$1
+ORDER BY effective_at, id`, memberID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    out := []StatusChange{}
+    for rows.Next() {
+        c, err := scanChange(rows)
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, c)
+    }
+    return out, rows.Err()
+}
+
+const changeCols = `id, member_id, from_status, to_status, effective_at, reason, proposal_id, changed_by, created_at`
+
+func scanChange(row pgx.Row) (StatusChange, error) {
+    var c StatusChange
+    var from pgtype.Text
+    var proposalID pgtype.Int4
+    var changedBy pgtype.Int8
+    var effectiveAt, createdAt pgtype.Timestamptz
+    if err := row.Scan(&c.ID, &c.MemberID, &from, &c.ToStatus, &effectiveAt, &c.Reason, &proposalID, &changedBy, &createdAt); err != nil {
+        return StatusChange{}, err
+    }
+    if from.Valid { c.FromStatus = &from.String }
+    if proposalID.Valid { c.ProposalID = &proposalID.Int32 }
+    if changedBy.Valid { c.ChangedBy = &changedBy.Int64 }
+    c.EffectiveAt = effectiveAt.Time
+    c.CreatedAt = createdAt.Time
+    return c, nil
+}
+
+const profileSelect = `
+SELECT m.id, m.display_name, m.role, m.status, COALESCE(p.committees,'{}'), m.email,
+       COALESCE(p.phone,''), COALESCE(p.pronouns,''), COALESCE(p.unit,''), COALESCE(p.skills,'{}'),
+       COALESCE(p.bio,''), p.photo_attachment_id, COALESCE(p.visibility,'{}'), m.created_at
+FROM members m
+LEFT JOIN member_profiles p ON p.member_id=m.id`
+
+func scanProfile(row pgx.Row) (Profile, error) {
+    var p Profile
+    var photoID pgtype.Int8
+    var createdAt pgtype.Timestamptz
+    err := row.Scan(&p.ID, &p.DisplayName, &p.Role, &p.Status, &p.Committees, &p.Email,
+        &p.Phone, &p.Pronouns, &p.Unit, &p.Skills, &p.Bio, &photoID, &p.Visibility, &createdAt)
+    if err != nil {
+        if err == pgx.ErrNoRows { return Profile{}, ErrNotFound }
+        return Profile{}, err
+    }
+    if photoID.Valid { p.PhotoID = &photoID.Int64 }
+    p.CreatedAt = createdAt.Time
+    return p, nil
+}
+
+// likeEscape quotes LIKE wildcards so q matches literally.
+func likeEscape(q string) string {
+    return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+}
+
+func (r *PgRepo) Directory(ctx context.Context, f DirectoryFilters) ([]Profile, error) {
+    var where []string
+    var args []any
+    arg := func(v any) string {
+        args = append(args, v)
+        return "$" + strconv.Itoa(len(args))
+    }
+    if f.Query != "" {
+        where = append(where, `m.display_name ILIKE '%' || `+arg(likeEscape(f.Query))+` || '%'`)
+    }
+    if f.Status != "" {
+        where = append(where, `m.status=`+arg(f.Status))
+    }
+    if f.Role != "" {
+        n := arg(f.Role)
+        where = append(where, `(m.role=`+n+` OR EXISTS (
+  SELECT 1 FROM rbac_role_assignments a JOIN rbac_roles ro ON ro.id=a.role_id
+  WHERE a.member_id=m.id AND ro.name=`+n+` AND a.revoked_at IS NULL
+    AND a.starts_at<=now() AND (a.ends_at IS NULL OR a.ends_at>now())))`)
+    }
+    if f.Committee != "" {
+        where = append(where, arg(f.Committee)+`=ANY(p.committees)`)
+    }
+    if f.Skill != "" {
+        cond := `EXISTS (SELECT 1 FROM unnest(p.skills) s WHERE lower(s)=lower(` + arg(f.Skill) + `))`
+        if !f.AllFields {
+            cond += ` AND COALESCE(p.visibility->>'skills',` + arg(DefaultVisibility["skills"]) + `)='members'`
+        }
+        where = append(where, cond)
+    }
+    where = append(where, `m.deleted_at IS NULL`)
+    query := profileSelect + "\nWHERE " + strings.Join(where, "\n  AND ")
+    query += "\nORDER BY lower(m.display_name), m.id"
+    if f.Limit > 0 { query += " LIMIT " + arg(f.Limit) }
+    if f.Offset > 0 { query += " OFFSET " + arg(f.Offset) }
+    rows, err := r.Pool.Query(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    out := []Profile{}
+    for rows.Next() {
+        p, err := scanProfile(rows)
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, p)
+    }
+    return out, rows.Err()
+}
+
+func (r *PgRepo) GetProfile(ctx context.Context, id int64) (Profile, error) {
+    return scanProfile(r.Pool.QueryRow(ctx, profileSelect+` WHERE m.id=$1`, id))
+}
+
+func (r *PgRepo) UpdateProfile(ctx context.Context, p Profile) (Profile, error) {
+    var deleted bool
+    if err := r.Pool.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM members WHERE id=$1`, p.ID).Scan(&deleted); err != nil {
+        if err == pgx.ErrNoRows { return Profile{}, ErrNotFound }
+        return Profile{}, err
+    }
+    if deleted { return Profile{}, ErrDeleted }
+    if p.PhotoID != nil {
+        var ok bool
+        err := r.Pool.QueryRow(ctx, `
+SELECT true FROM attachments
+WHERE id=$1 AND owner_type='member_photo' AND owner_id=$2 AND content_type LIKE 'image/%'`, *p.PhotoID, p.ID).Scan(&ok)
+        if err == pgx.ErrNoRows { return Profile{}, ErrPhoto }
+        if err != nil { return Profile{}, err }
+    }
+    if p.Skills == nil { p.Skills = []string{} }
+    if p.Committees == nil { p.Committees = []string{} }
+    if p.Visibility == nil { p.Visibility = map[string]string{} }
+    _, err := r.Pool.Exec(ctx, `
+INSERT INTO member_profiles (member_id, phone, pronouns, unit, skills, bio, photo_attachment_id, committees, visibility)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+ON CONFLICT (member_id) DO UPDATE
+SET phone=EXCLUDED.phone, pronouns=EXCLUDED.pronouns, unit=EXCLUDED.unit, skills=EXCLUDED.skills,
+    bio=EXCLUDED.bio, photo_attachment_id=EXCLUDED.photo_attachment_id, committees=EXCLUDED.committees,
+    visibility=EXCLUDED.visibility, updated_at=now()`,
+        p.ID, p.Phone, p.Pronouns, p.Unit, p.Skills, p.Bio, p.PhotoID, p.Committees, p.Visibility)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation
+            return Profile{}, ErrNotFound
+        }
+        return Profile{}, err
+    }
+    return r.GetProfile(ctx, p.ID)
+}
+
+func (r *PgRepo) Update(ctx context.Context, id int64, u Update) (Member, error) {
+    m, err := scanMember(r.Pool.QueryRow(ctx, `
+UPDATE members SET display_name=COALESCE($2, display_name), role=COALESCE($3, role)
+WHERE id=$1 AND deleted_at IS NULL
+RETURNING `+memberCols, id, u.DisplayName, u.Role))
+    if err == ErrNotFound {
+        if _, err := r.GetByID(ctx, id); err != nil {
+            return Member{}, err
+        }
+        return Member{}, ErrDeleted
+    }
+    return m, err
+}
+
+const emailChangeCols = `id, member_id, new_email, requested_by, expires_at, confirmed_at, created_at`
+
+func scanEmailChange(row pgx.Row) (EmailChange, error) {
+    var c EmailChange
+    var requestedBy pgtype.Int8
+    var expiresAt, confirmedAt, createdAt pgtype.Timestamptz
+    if err := row.Scan(&c.ID, &c.MemberID, &c.NewEmail, &requestedBy, &expiresAt, &confirmedAt, &createdAt); err != nil {
+        if err == pgx.ErrNoRows { return EmailChange{}, ErrNotFound }
+        return EmailChange{}, err
+    }
+    if requestedBy.Valid { c.RequestedBy = &requestedBy.Int64 }
+    if confirmedAt.Valid { c.ConfirmedAt = &confirmedAt.Time }
+    c.ExpiresAt = expiresAt.Time
+    c.CreatedAt = createdAt.Time
+    return c, nil
+}
+
+func (r *PgRepo) RequestEmailChange(ctx context.Context, c EmailChange, tokenHash []byte) (EmailChange, error) {
+    tx, err := r.Pool.Begin(ctx)
+    if err != nil {
+        return EmailChange{}, err
+    }
+    defer tx.Rollback(ctx)
+    var deleted bool
+    if err := tx.QueryRow(ctx, `SELECT deleted_at IS NOT NULL FROM members WHERE id=$1 FOR UPDATE`, c.MemberID).Scan(&deleted); err != nil {
+        if err == pgx.ErrNoRows { return EmailChange{}, ErrNotFound }
+        return EmailChange{}, err
+    }
+    if deleted {
+        return EmailChange{}, ErrDeleted
+    }
+    var taken bool
+    if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM members WHERE lower(email)=lower($1))`, c.NewEmail).Scan(&taken); err != nil {
+        return EmailChange{}, err
+    }
+    if taken {
+        return EmailChange{}, ErrConflict
+    }
+    if _, err := tx.Exec(ctx, `DELETE FROM member_email_changes WHERE member_id=$1 AND confirmed_at IS NULL`, c.MemberID); err != nil {
+        return EmailChange{}, err
+    }
+    out, err := scanEmailChange(tx.QueryRow(ctx, `
+INSERT INTO member_email_changes (member_id, new_email, token_hash, requested_by, expires_at)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING `+emailChangeCols, c.MemberID, c.NewEmail, tokenHash, c.RequestedBy, c.ExpiresAt))
+    if err != nil {
+        return EmailChange{}, err
+    }
+    return out, tx.Commit(ctx)
+}
+
+func (r *PgRepo) ConfirmEmailChange(ctx context.Context, tokenHash []byte, now time.Time) (Member, error) {
+    tx, err := r.Pool.Begin(ctx)
     if err != nil {
-        if err == pgx.ErrNoRows { return Member{}, ErrNotFound }
         return Member{}, err
     }
-    m.CreatedAt = createdAt.Time
-    m.UpdatedAt = updatedAt.Time
-    return m, nil
+    defer tx.Rollback(ctx)
+    c, err := scanEmailChange(tx.QueryRow(ctx, `
+UPDATE member_email_changes SET confirmed_at=$2
+WHERE token_hash=$1 AND confirmed_at IS NULL AND expires_at>$2
+RETURNING `+emailChangeCols, tokenHash, now))
+    if err != nil {
+        return Member{}, err
+    }
+    m, err := scanMember(tx.QueryRow(ctx, `
+UPDATE members SET email=$2 WHERE id=$1 AND deleted_at IS NULL
+RETURNING `+memberCols, c.MemberID, c.NewEmail))
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+            return Member{}, ErrConflict
+        }
+        return Member{}, err
+    }
+    return m, tx.Commit(ctx)
 }
 
-func (r *PgRepo) GetByEmail(ctx context.Context, email string) (Member, error) {
-    var m Member
-    var createdAt, updatedAt pgtype.Timestamptz
-    err := r.Pool.QueryRow(ctx, `
-SELECT id, email, display_name, role, created_at, updated_at
-FROM members WHERE email=$1
-`, email).Scan(&m.ID, &m.Email, &m.DisplayName, &m.Role, &createdAt, &updatedAt)
+func (r *PgRepo) Delete(ctx context.Context, c StatusChange) (Member, error) {
+    tx, err := r.Pool.Begin(ctx)
     if err != nil {
+        return Member{}, err
+    }
+    defer tx.Rollback(ctx)
+    var from string
+    var deleted bool
+    if err := tx.QueryRow(ctx, `SELECT status, deleted_at IS NOT NULL FROM members WHERE id=$1 FOR UPDATE`, c.MemberID).Scan(&from, &deleted); err != nil {
         if err == pgx.ErrNoRows { return Member{}, ErrNotFound }
         return Member{}, err
     }
-    m.CreatedAt = createdAt.Time
-    m.UpdatedAt = updatedAt.Time
-    return m, nil
+    if deleted {
+        return Member{}, ErrDeleted
+    }
+    status := from
+    if from != StatusWithdrawn && from != StatusDeceased {
+        status = StatusWithdrawn
+        // Withdrawal is recorded at deletion time, after any backdated
+        // change, so the history stays in order.
+        var latest pgtype.Timestamptz
+        if err := tx.QueryRow(ctx, `SELECT max(effective_at) FROM member_status_changes WHERE member_id=$1`, c.MemberID).Scan(&latest); err != nil {
+            return Member{}, err
+        }
+        if latest.Valid && c.EffectiveAt.Before(latest.Time) { c.EffectiveAt = latest.Time }
+        if _, err := tx.Exec(ctx, `
+INSERT INTO member_status_changes (member_id, from_status, to_status, effective_at, reason, changed_by)
+VALUES ($1,$2,$3,$4,$5,$6)`, c.MemberID, from, status, c.EffectiveAt, c.Reason, c.ChangedBy); err != nil {
+            return Member{}, err
+        }
+    }
+    email, name := Anonymized(c.MemberID)
+    m, err := scanMember(tx.QueryRow(ctx, `
+UPDATE members SET email=$2, display_name=$3, role='member', status=$4, deleted_at=$5
+WHERE id=$1
+RETURNING `+memberCols, c.MemberID, email, name, status, c.EffectiveAt))
+    if err != nil {
+        return Member{}, err
+    }
+    if _, err := tx.Exec(ctx, `DELETE FROM member_profiles WHERE member_id=$1`, c.MemberID); err != nil {
+        return Member{}, err
+    }
+    if _, err := tx.Exec(ctx, `DELETE FROM member_email_changes WHERE member_id=$1`, c.MemberID); err != nil {
+        return Member{}, err
+    }
+    return m, tx.Commit(ctx)
 }
 
+func (r *PgRepo) Import(ctx context.Context, rows []ImportRow, commit bool) ([]Member, []error, error) {
+    tx, err := r.Pool.Begin(ctx)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer tx.Rollback(ctx)
+    created := make([]Member, len(rows))
+    errs := make([]error, len(rows))
+    failed := false
+    for i, row := range rows {
+        // Each row runs in a savepoint, so one taken email is reported
+        // without aborting the rest of the check.
+        sp, err := tx.Begin(ctx)
+        if err != nil {
+            return nil, nil, err
+        }
+        // Addresses differing only in case belong to the same person.
+        var taken bool
+        if err := sp.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM members WHERE lower(email)=lower($1))`, row.Email).Scan(&taken); err != nil {
+            return nil, nil, err
+        }
+        if taken {
+            _ = sp.Rollback(ctx)
+            errs[i], failed = ErrConflict, true
+            continue
+        }
+        m, err := scanMember(sp.QueryRow(ctx, `
+INSERT INTO members (email, display_name, role, status)
+VALUES ($1,$2,$3,$4)
+RETURNING `+memberCols, row.Email, row.DisplayName, row.Role, row.Status))
+        if err != nil {
+            _ = sp.Rollback(ctx)
+            var pgErr *pgconn.PgError
+            if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique_violation
+                errs[i], failed = ErrConflict, true
+                continue
+            }
+            return nil, nil, err
+        }
+        if _, err := sp.Exec(ctx, `
+INSERT INTO member_status_changes (member_id, to_status, effective_at, reason)
+VALUES ($1,$2,$3,'Imported')`, m.ID, row.Status, m.CreatedAt); err != nil {
+            return nil, nil, err
+        }
+        if row.Phone != "" || row.Pronouns != "" || row.Unit != "" || len(row.Skills) > 0 || len(row.Committees) > 0 {
+            skills, committees := row.Skills, row.Committees
+            if skills == nil { skills = []string{} }
+            if committees == nil { committees = []string{} }
+            if _, err := sp.Exec(ctx, `
+INSERT INTO member_profiles (member_id, phone, pronouns, unit, skills, committees)
+VALUES ($1,$2,$3,$4,$5,$6)`, m.ID, row.Phone, row.Pronouns, row.Unit, skills, committees); err != nil {
+                return nil, nil, err
+            }
+        }
+        if err := sp.Commit(ctx); err != nil {
+            return nil, nil, err
+        }
+        created[i] = m
+    }
+    if !commit || failed {
+        return created, errs, nil
+    }
+    return created, errs, tx.Commit(ctx)
+}
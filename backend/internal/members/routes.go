@@ -1,12 +1,26 @@
 package members
 
-import "github.com/go-chi/chi/v5"
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
 
 func Mount(r chi.Router, h Handlers) {
     r.Route("/members", func(r chi.Router) {
-        r.Get("/", h.FindByEmail) // expects ?email=
-        r.Post("/", h.Create)
-        r.Get("/{id}", h.GetByID)
+        r.With(httpmw.RequireAuth).Get("/", h.List)
+        r.With(httpmw.RequirePermission("members.manage")).Post("/", h.Create)
+        r.With(httpmw.RequireAuth).Get("/export.csv", h.ExportCSV)
+        r.With(httpmw.RequirePermission("members.manage")).Post("/import", h.Import)
+        r.With(httpmw.RequirePermission("members.manage")).Post("/import/preview", h.PreviewImport)
+        // Confirmation links carry their own token, so no session is needed.
+        r.Post("/email/confirm", h.ConfirmEmailChange)
+        r.With(httpmw.RequireAuth).Get("/{id}", h.GetByID)
+        r.With(httpmw.RequireAuth).Patch("/{id}", h.Update)
+        r.With(httpmw.RequirePermission("members.manage")).Delete("/{id}", h.Delete)
+        r.With(httpmw.RequireAuth).Post("/{id}/email", h.RequestEmailChange)
+        r.With(httpmw.RequireAuth).Put("/{id}/profile", h.UpdateProfile)
+        r.With(httpmw.RequireAuth).Get("/{id}/status", h.StatusHistory)
+        r.With(httpmw.RequirePermission("members.manage")).Post("/{id}/status", h.ChangeStatus)
     })
 }
 
@@ -0,0 +1,125 @@
+package patronage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+
+	"coop.tools/backend/internal/ledger"
+)
+
+// LedgerPoster is the subset of ledger.Repo used to post approved allocations.
+type LedgerPoster interface {
+	Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+// ValidSource reports whether s is a supported patronage basis.
+func ValidSource(s string) bool {
+	return s == "ledger" || s == "hours"
+}
+
+// Allocate splits surplus across members in proportion to their weighted
+// patronage. Each rule's totals are normalized to shares first, so rules with
+// different units (dollars, hours) combine through their weights alone.
+// Amounts are computed in cents with largest-remainder rounding so the
+// allocations always sum exactly to the surplus.
+func Allocate(surplus, cashPercent float64, rules []Rule, totals []map[int64]float64) []Allocation {
+	shares := map[int64]float64{}
+	weightSum := 0.0
+	for i, rule := range rules {
+		sum := 0.0
+		for _, v := range totals[i] {
+			if v > 0 {
+				sum += v
+			}
+		}
+		if sum == 0 || rule.Weight <= 0 {
+			continue
+		}
+		weightSum += rule.Weight
+		for m, v := range totals[i] {
+			if v > 0 {
+				shares[m] += rule.Weight * v / sum
+			}
+		}
+	}
+	if weightSum == 0 {
+		return []Allocation{}
+	}
+
+	members := make([]int64, 0, len(shares))
+	for m := range shares {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i] < members[j] })
+
+	totalCents := int64(math.Round(surplus * 100))
+	out := make([]Allocation, len(members))
+	remainders := make([]float64, len(members))
+	var assigned int64
+	for i, m := range members {
+		share := shares[m] / weightSum
+		exact := float64(totalCents) * share
+		cents := int64(math.Floor(exact))
+		remainders[i] = exact - float64(cents)
+		assigned += cents
+		out[i] = Allocation{MemberID: m, Patronage: share, Amount: float64(cents)}
+	}
+	order := make([]int, len(members))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for k := 0; assigned < totalCents; k++ {
+		out[order[k%len(order)]].Amount++
+		assigned++
+	}
+
+	for i := range out {
+		cents := int64(out[i].Amount)
+		cash := int64(math.Round(float64(cents) * cashPercent / 100))
+		out[i].Amount = float64(cents) / 100
+		out[i].Cash = float64(cash) / 100
+		out[i].Retained = float64(cents-cash) / 100
+	}
+	return out
+}
+
+// Calculate gathers patronage for each rule over the run period and returns
+// the resulting allocation table.
+func Calculate(ctx context.Context, repo Repo, run Run) ([]Allocation, error) {
+	totals := make([]map[int64]float64, len(run.Rules))
+	for i, rule := range run.Rules {
+		t, err := repo.Patronage(ctx, rule, run.PeriodStart, run.PeriodEnd)
+		if err != nil {
+			return nil, err
+		}
+		totals[i] = t
+	}
+	return Allocate(run.NetSurplus, run.CashPercent, run.Rules, totals), nil
+}
+
+// Post writes the cash portion of each allocation to the ledger as a
+// "patronage" entry. Amounts are negative because they pay surplus out. The
+// retained portion moves no cash: it stays in the cooperative as the
+// member's capital (see capital's retained import), so it is not posted.
+// Idempotency keys make a retried post safe.
+func Post(ctx context.Context, l LedgerPoster, run Run, allocs []Allocation) ([]Allocation, error) {
+	period := run.PeriodStart.Format("2006-01-02") + " to " + run.PeriodEnd.Format("2006-01-02")
+	key := "patronage:" + strconv.Itoa(int(run.ID))
+	out := make([]Allocation, len(allocs))
+	for i, a := range allocs {
+		mid := int32(a.MemberID)
+		if a.Cash != 0 {
+			e, _, err := l.Create(ctx, "patronage", "Patronage dividend (cash) "+period, -a.Cash, &mid, "", key+":cash")
+			if err != nil {
+				return nil, err
+			}
+			id := e.ID
+			a.CashEntryID = &id
+		}
+		out[i] = a
+	}
+	return out, nil
+}
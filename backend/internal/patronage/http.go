@@ -0,0 +1,208 @@
+package patronage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+// ListRuns handles GET /api/patronage/runs
+func (h Handlers) ListRuns(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListRuns(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Run{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// CreateRun handles POST /api/patronage/runs. It calculates allocations for
+// the period and stores them as a draft for review.
+func (h Handlers) CreateRun(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		PeriodStart string  `json:"period_start"`
+		PeriodEnd   string  `json:"period_end"`
+		NetSurplus  float64 `json:"net_surplus"`
+		CashPercent float64 `json:"cash_percent"`
+		Rules       []Rule  `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	start, err1 := httpx.ParseDate(in.PeriodStart)
+	end, err2 := httpx.ParseDate(in.PeriodEnd)
+	if err1 != nil || err2 != nil || start == nil || end == nil || end.Before(*start) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "valid period_start and period_end required")
+		return
+	}
+	if in.NetSurplus <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "net_surplus must be positive")
+		return
+	}
+	if in.CashPercent < 0 || in.CashPercent > 100 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "cash_percent must be between 0 and 100")
+		return
+	}
+	if len(in.Rules) == 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "at least one rule required")
+		return
+	}
+	for _, rule := range in.Rules {
+		if !ValidSource(rule.Source) || rule.Weight <= 0 || (rule.Source == "ledger" && (rule.LedgerType == "" || rule.CategoryID != nil)) {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid rule")
+			return
+		}
+	}
+	run := Run{PeriodStart: *start, PeriodEnd: *end, NetSurplus: in.NetSurplus, CashPercent: in.CashPercent, Rules: in.Rules}
+	allocs, err := Calculate(r.Context(), h.Repo, run)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "calculation failed")
+		return
+	}
+	if len(allocs) == 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "no patronage recorded for period")
+		return
+	}
+	out, err := h.Repo.CreateRun(r.Context(), run, allocs)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// GetRun handles GET /api/patronage/runs/{id}
+func (h Handlers) GetRun(w http.ResponseWriter, r *http.Request) {
+	id, ok := runID(w, r)
+	if !ok {
+		return
+	}
+	run, err := h.Repo.GetRun(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(run)
+}
+
+// ExportCSV streams a run's allocation table as CSV
+func (h Handlers) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	id, ok := runID(w, r)
+	if !ok {
+		return
+	}
+	run, err := h.Repo.GetRun(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		http.Error(w, "failed to list", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=patronage-"+strconv.Itoa(int(id))+".csv")
+
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	_ = cw.Write([]string{"member_id", "patronage_share", "amount", "cash", "retained"})
+	for _, a := range run.Allocations {
+		_ = cw.Write([]string{
+			strconv.FormatInt(a.MemberID, 10),
+			strconv.FormatFloat(a.Patronage, 'f', 6, 64),
+			strconv.FormatFloat(a.Amount, 'f', 2, 64),
+			strconv.FormatFloat(a.Cash, 'f', 2, 64),
+			strconv.FormatFloat(a.Retained, 'f', 2, 64),
+		})
+	}
+}
+
+// Approve handles POST /api/patronage/runs/{id}/approve
+func (h Handlers) Approve(w http.ResponseWriter, r *http.Request) {
+	id, ok := runID(w, r)
+	if !ok {
+		return
+	}
+	run, err := h.Repo.Approve(r.Context(), id)
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(run)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "run not in draft")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "approve failed")
+	}
+}
+
+// PostToLedger handles POST /api/patronage/runs/{id}/post. Only approved runs
+// are posted.
+func (h Handlers) PostToLedger(w http.ResponseWriter, r *http.Request) {
+	id, ok := runID(w, r)
+	if !ok {
+		return
+	}
+	run, err := h.Repo.GetRun(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return
+	}
+	if run.Status != "approved" {
+		httpmw.WriteJSONError(w, http.StatusConflict, "run not approved")
+		return
+	}
+	allocs, err := Post(r.Context(), h.Ledger, run.Run, run.Allocations)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "ledger post failed")
+		return
+	}
+	out, err := h.Repo.MarkPosted(r.Context(), id, allocs)
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, "run not approved")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "post failed")
+	}
+}
+
+func runID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
@@ -0,0 +1,257 @@
+package patronage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	patronage map[string]map[int64]float64 // ledger type or "hours" -> member -> total
+	runs      []RunWithAllocations
+}
+
+func (m *mockRepo) Patronage(_ context.Context, rule Rule, _, _ time.Time) (map[int64]float64, error) {
+	if rule.Source == "hours" {
+		return m.patronage["hours"], nil
+	}
+	return m.patronage[rule.LedgerType], nil
+}
+
+func (m *mockRepo) CreateRun(_ context.Context, run Run, allocs []Allocation) (RunWithAllocations, error) {
+	run.ID = int32(len(m.runs) + 1)
+	run.Status = "draft"
+	for i := range allocs {
+		allocs[i].RunID = run.ID
+	}
+	out := RunWithAllocations{Run: run, Allocations: allocs}
+	m.runs = append(m.runs, out)
+	return out, nil
+}
+
+func (m *mockRepo) ListRuns(_ context.Context) ([]Run, error) {
+	var out []Run
+	for _, r := range m.runs {
+		out = append(out, r.Run)
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetRun(_ context.Context, id int32) (RunWithAllocations, error) {
+	for _, r := range m.runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return RunWithAllocations{}, ErrNotFound
+}
+
+func (m *mockRepo) Approve(_ context.Context, id int32) (Run, error) {
+	for i, r := range m.runs {
+		if r.ID == id {
+			if r.Status != "draft" {
+				return Run{}, ErrConflict
+			}
+			m.runs[i].Status = "approved"
+			return m.runs[i].Run, nil
+		}
+	}
+	return Run{}, ErrNotFound
+}
+
+func (m *mockRepo) MarkPosted(_ context.Context, id int32, allocs []Allocation) (RunWithAllocations, error) {
+	for i, r := range m.runs {
+		if r.ID == id {
+			if r.Status != "approved" {
+				return RunWithAllocations{}, ErrConflict
+			}
+			m.runs[i].Status = "posted"
+			m.runs[i].Allocations = allocs
+			return m.runs[i], nil
+		}
+	}
+	return RunWithAllocations{}, ErrNotFound
+}
+
+type mockLedger struct {
+	entries []ledger.LedgerEntry
+}
+
+func (m *mockLedger) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error) {
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 1), Type: entryType, Amount: amount, Description: description, MemberID: memberID}
+	m.entries = append(m.entries, e)
+	return e, false, nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo, l LedgerPoster) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		if id <= 0 {
+			return httpmw.Principal{}, false, nil
+		}
+		return httpmw.Principal{MemberID: id, Role: "admin"}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Ledger: l})
+	return r
+}
+
+// ---- Tests ----
+
+func TestAllocate(t *testing.T) {
+	rules := []Rule{{Source: "ledger", LedgerType: "contribution", Weight: 3}, {Source: "ledger", LedgerType: "dues", Weight: 1}}
+	totals := []map[int64]float64{
+		{1: 100, 2: 200},
+		{1: 50, 3: 50},
+	}
+	allocs := Allocate(1000, 20, rules, totals)
+	if len(allocs) != 3 {
+		t.Fatalf("expected 3 allocations, got %d", len(allocs))
+	}
+	// member 1: 3*(1/3) + 1*(1/2) = 1.5 of 4 -> 375.00
+	want := map[int64]float64{1: 375, 2: 500, 3: 125}
+	sum := 0.0
+	for _, a := range allocs {
+		if a.Amount != want[a.MemberID] {
+			t.Errorf("member %d: expected %.2f, got %.2f", a.MemberID, want[a.MemberID], a.Amount)
+		}
+		if a.Cash+a.Retained != a.Amount {
+			t.Errorf("member %d: cash+retained != amount", a.MemberID)
+		}
+		sum += a.Amount
+	}
+	if sum != 1000 {
+		t.Fatalf("expected allocations to sum to 1000, got %.2f", sum)
+	}
+
+	// rounding remainder is distributed so totals stay exact
+	thirds := Allocate(100, 0, []Rule{{Source: "ledger", LedgerType: "x", Weight: 1}}, []map[int64]float64{{1: 1, 2: 1, 3: 1}})
+	cents := 0.0
+	for _, a := range thirds {
+		cents += a.Amount * 100
+	}
+	if int(cents+0.5) != 10000 {
+		t.Fatalf("expected 10000 cents, got %f", cents)
+	}
+}
+
+func TestHandlers_RunLifecycle(t *testing.T) {
+	repo := &mockRepo{patronage: map[string]map[int64]float64{"contribution": {1: 300, 2: 100}}}
+	l := &mockLedger{}
+	r := setupRouter(repo, l)
+
+	// invalid rule
+	req := httptest.NewRequest("POST", "/patronage/runs", strings.NewReader(`{"period_start":"2024-01-01","period_end":"2024-12-31","net_surplus":1000,"cash_percent":20,"rules":[{"source":"pos","weight":1}]}`))
+	req.Header.Set("X-User-Id", "1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/patronage/runs", strings.NewReader(`{"period_start":"2024-01-01","period_end":"2024-12-31","net_surplus":1000,"cash_percent":20,"rules":[{"source":"ledger","ledger_type":"contribution","weight":1}]}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var run RunWithAllocations
+	_ = json.Unmarshal(rr.Body.Bytes(), &run)
+	if run.Status != "draft" || len(run.Allocations) != 2 {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+
+	// posting a draft is rejected
+	req = httptest.NewRequest("POST", "/patronage/runs/1/post", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/patronage/runs/1/approve", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/patronage/runs/1/post", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &run)
+	if run.Status != "posted" || run.Allocations[0].CashEntryID == nil {
+		t.Fatalf("unexpected posted run: %+v", run)
+	}
+	// one cash entry per member; retained portions are not posted
+	if len(l.entries) != 2 || l.entries[0].Type != "patronage" || l.entries[0].Amount >= 0 {
+		t.Fatalf("unexpected ledger entries: %+v", l.entries)
+	}
+
+	// CSV export
+	req = httptest.NewRequest("GET", "/patronage/runs/1/allocations.csv", nil)
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "member_id,patronage_share,amount,cash,retained") {
+		t.Fatalf("unexpected csv: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandlers_HoursRule(t *testing.T) {
+	repo := &mockRepo{patronage: map[string]map[int64]float64{"hours": {1: 1500, 2: 500}, "dues": {2: 100}}}
+	r := setupRouter(repo, &mockLedger{})
+
+	req := httptest.NewRequest("POST", "/patronage/runs", strings.NewReader(`{"period_start":"2024-01-01","period_end":"2024-12-31","net_surplus":1000,"cash_percent":0,"rules":[{"source":"ledger","ledger_type":"dues","category_id":1,"weight":1}]}`))
+	req.Header.Set("X-User-Id", "1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for category_id on a ledger rule, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/patronage/runs", strings.NewReader(`{"period_start":"2024-01-01","period_end":"2024-12-31","net_surplus":1000,"cash_percent":0,"rules":[{"source":"hours","weight":3},{"source":"ledger","ledger_type":"dues","weight":1}]}`))
+	req.Header.Set("X-User-Id", "1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var run RunWithAllocations
+	_ = json.Unmarshal(rr.Body.Bytes(), &run)
+	// member 1: 3*0.75 = 2.25 of 4 -> 562.50; member 2: 3*0.25 + 1 = 1.75 of 4 -> 437.50
+	want := map[int64]float64{1: 562.5, 2: 437.5}
+	for _, a := range run.Allocations {
+		if a.Amount != want[a.MemberID] {
+			t.Errorf("member %d: expected %.2f, got %.2f", a.MemberID, want[a.MemberID], a.Amount)
+		}
+	}
+}
+
+func TestHandlers_RequiresAdmin(t *testing.T) {
+	r := setupRouter(&mockRepo{}, &mockLedger{})
+	req := httptest.NewRequest("GET", "/patronage/runs", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,28 @@
+-- backend/internal/patronage/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS patronage_runs (
+  id SERIAL PRIMARY KEY,
+  period_start DATE NOT NULL,
+  period_end DATE NOT NULL,
+  net_surplus DECIMAL(12,2) NOT NULL CHECK (net_surplus > 0),
+  cash_percent DECIMAL(5,2) NOT NULL CHECK (cash_percent BETWEEN 0 AND 100),
+  rules JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft','approved','posted')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  approved_at TIMESTAMPTZ,
+  posted_at TIMESTAMPTZ,
+  CHECK (period_end >= period_start)
+);
+
+CREATE TABLE IF NOT EXISTS patronage_allocations (
+  run_id INTEGER NOT NULL REFERENCES patronage_runs(id) ON DELETE CASCADE,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE RESTRICT,
+  patronage DOUBLE PRECISION NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  cash DECIMAL(12,2) NOT NULL,
+  retained DECIMAL(12,2) NOT NULL,
+  cash_entry_id INTEGER REFERENCES ledger_entries(id),
+  retained_entry_id INTEGER REFERENCES ledger_entries(id),
+  PRIMARY KEY (run_id, member_id)
+);
+
+CREATE INDEX IF NOT EXISTS patronage_allocations_member_id_idx ON patronage_allocations (member_id);
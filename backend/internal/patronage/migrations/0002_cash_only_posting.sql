@@ -0,0 +1,5 @@
+-- backend/internal/patronage/migrations/0002_cash_only_posting.sql
+-- Only the cash portion of an allocation moves money, so only it is posted
+-- to the ledger. The retained portion is equity, credited to the member's
+-- capital account through the capital retained import.
+ALTER TABLE patronage_allocations DROP COLUMN IF EXISTS retained_entry_id;
@@ -0,0 +1,46 @@
+package patronage
+
+import "time"
+
+// Rule weights one patronage basis in a calculation run.
+// Source "ledger" sums each member's ledger entries of LedgerType in the period.
+// Source "hours" sums each member's approved hours worked in the period, in
+// CategoryID only when set and otherwise in categories counted for patronage.
+type Rule struct {
+	Source     string  `json:"source"`
+	LedgerType string  `json:"ledger_type,omitempty"`
+	CategoryID *int32  `json:"category_id,omitempty"`
+	Weight     float64 `json:"weight"`
+}
+
+// Run is one patronage dividend calculation for a fiscal period.
+// Status moves draft -> approved -> posted.
+type Run struct {
+	ID          int32      `json:"id"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	NetSurplus  float64    `json:"net_surplus"`
+	CashPercent float64    `json:"cash_percent"`
+	Rules       []Rule     `json:"rules"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ApprovedAt  *time.Time `json:"approved_at"`
+	PostedAt    *time.Time `json:"posted_at"`
+}
+
+// Allocation is one member's share of a run's net surplus.
+type Allocation struct {
+	RunID       int32   `json:"run_id"`
+	MemberID    int64   `json:"member_id"`
+	Patronage   float64 `json:"patronage"` // weighted patronage share, 0..1
+	Amount      float64 `json:"amount"`
+	Cash        float64 `json:"cash"`
+	Retained    float64 `json:"retained"`
+	CashEntryID *int32  `json:"cash_entry_id,omitempty"`
+}
+
+// RunWithAllocations is the reviewable allocation table for a run.
+type RunWithAllocations struct {
+	Run
+	Allocations []Allocation `json:"allocations"`
+}
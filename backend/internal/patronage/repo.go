@@ -0,0 +1,242 @@
+package patronage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound = errors.New("patronage run not found")
+	ErrConflict = errors.New("invalid state transition")
+)
+
+type Repo interface {
+	// Patronage returns each member's patronage total for one rule over the
+	// inclusive date range.
+	Patronage(ctx context.Context, rule Rule, from, to time.Time) (map[int64]float64, error)
+	CreateRun(ctx context.Context, run Run, allocs []Allocation) (RunWithAllocations, error)
+	ListRuns(ctx context.Context) ([]Run, error)
+	GetRun(ctx context.Context, id int32) (RunWithAllocations, error)
+	// Approve moves a draft run to approved; ErrConflict otherwise.
+	Approve(ctx context.Context, id int32) (Run, error)
+	// MarkPosted records ledger entry ids and moves an approved run to posted.
+	MarkPosted(ctx context.Context, id int32, allocs []Allocation) (RunWithAllocations, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const runColumns = `id, period_start, period_end, net_surplus, cash_percent, rules, status, created_at, approved_at, posted_at`
+
+func (r *PgRepo) Patronage(ctx context.Context, rule Rule, from, to time.Time) (map[int64]float64, error) {
+	out := map[int64]float64{}
+	var rows pgx.Rows
+	var err error
+	switch rule.Source {
+	case "ledger":
+		rows, err = r.Pool.Query(ctx, `
+SELECT member_id, SUM(ABS(base_amount))::float8
+FROM ledger_entries
+WHERE type=$1 AND member_id IS NOT NULL
+  AND created_at >= $2 AND created_at < $3
+GROUP BY member_id`, rule.LedgerType, from, to.AddDate(0, 0, 1))
+	case "hours":
+		rows, err = r.Pool.Query(ctx, `
+SELECT e.member_id, SUM(e.hours)::float8
+FROM hour_entries e
+JOIN hour_timesheets t ON t.id = e.timesheet_id AND t.status = 'approved'
+JOIN hour_categories c ON c.id = e.category_id
+WHERE e.work_date BETWEEN $1 AND $2
+  AND (($3::int IS NULL AND c.patronage) OR e.category_id = $3)
+GROUP BY e.member_id`, pgtype.Date{Time: from, Valid: true}, pgtype.Date{Time: to, Valid: true}, rule.CategoryID)
+	default:
+		return out, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m int64
+		var v float64
+		if err := rows.Scan(&m, &v); err != nil {
+			return nil, err
+		}
+		out[m] = v
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) CreateRun(ctx context.Context, run Run, allocs []Allocation) (RunWithAllocations, error) {
+	rules, err := json.Marshal(run.Rules)
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	created, err := scanRun(tx.QueryRow(ctx, `
+INSERT INTO patronage_runs (period_start, period_end, net_surplus, cash_percent, rules)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING `+runColumns,
+		pgtype.Date{Time: run.PeriodStart, Valid: true}, pgtype.Date{Time: run.PeriodEnd, Valid: true},
+		run.NetSurplus, run.CashPercent, rules))
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	out := RunWithAllocations{Run: created, Allocations: make([]Allocation, 0, len(allocs))}
+	for _, a := range allocs {
+		a.RunID = created.ID
+		if _, err := tx.Exec(ctx, `
+INSERT INTO patronage_allocations (run_id, member_id, patronage, amount, cash, retained)
+VALUES ($1,$2,$3,$4,$5,$6)`, a.RunID, a.MemberID, a.Patronage, a.Amount, a.Cash, a.Retained); err != nil {
+			return RunWithAllocations{}, err
+		}
+		out.Allocations = append(out.Allocations, a)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return RunWithAllocations{}, err
+	}
+	return out, nil
+}
+
+func (r *PgRepo) ListRuns(ctx context.Context) ([]Run, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+runColumns+` FROM patronage_runs ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetRun(ctx context.Context, id int32) (RunWithAllocations, error) {
+	run, err := scanRun(r.Pool.QueryRow(ctx, `SELECT `+runColumns+` FROM patronage_runs WHERE id=$1`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return RunWithAllocations{}, ErrNotFound
+		}
+		return RunWithAllocations{}, err
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT run_id, member_id, patronage, amount, cash, retained, cash_entry_id
+FROM patronage_allocations
+WHERE run_id=$1
+ORDER BY amount DESC, member_id`, id)
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	defer rows.Close()
+
+	out := RunWithAllocations{Run: run, Allocations: []Allocation{}}
+	for rows.Next() {
+		var a Allocation
+		var cashID pgtype.Int4
+		if err := rows.Scan(&a.RunID, &a.MemberID, &a.Patronage, &a.Amount, &a.Cash, &a.Retained, &cashID); err != nil {
+			return RunWithAllocations{}, err
+		}
+		if cashID.Valid {
+			a.CashEntryID = &cashID.Int32
+		}
+		out.Allocations = append(out.Allocations, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Approve(ctx context.Context, id int32) (Run, error) {
+	run, err := scanRun(r.Pool.QueryRow(ctx, `
+UPDATE patronage_runs
+SET status='approved', approved_at=now()
+WHERE id=$1 AND status='draft'
+RETURNING `+runColumns, id))
+	if err == pgx.ErrNoRows {
+		return Run{}, r.missingOrConflict(ctx, id)
+	}
+	return run, err
+}
+
+func (r *PgRepo) MarkPosted(ctx context.Context, id int32, allocs []Allocation) (RunWithAllocations, error) {
+	tx, err := r.Pool.Begin(ctx)
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `UPDATE patronage_runs SET status='posted', posted_at=now() WHERE id=$1 AND status='approved'`, id)
+	if err != nil {
+		return RunWithAllocations{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return RunWithAllocations{}, r.missingOrConflict(ctx, id)
+	}
+	for _, a := range allocs {
+		if _, err := tx.Exec(ctx, `
+UPDATE patronage_allocations
+SET cash_entry_id=$3
+WHERE run_id=$1 AND member_id=$2`, id, a.MemberID, a.CashEntryID); err != nil {
+			return RunWithAllocations{}, err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return RunWithAllocations{}, err
+	}
+	return r.GetRun(ctx, id)
+}
+
+func (r *PgRepo) missingOrConflict(ctx context.Context, id int32) error {
+	var exists bool
+	if err := r.Pool.QueryRow(ctx, `SELECT true FROM patronage_runs WHERE id=$1`, id).Scan(&exists); err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return ErrConflict
+}
+
+func scanRun(row pgx.Row) (Run, error) {
+	var run Run
+	var start, end pgtype.Date
+	var rules []byte
+	var createdAt, approvedAt, postedAt pgtype.Timestamptz
+	if err := row.Scan(&run.ID, &start, &end, &run.NetSurplus, &run.CashPercent, &rules, &run.Status, &createdAt, &approvedAt, &postedAt); err != nil {
+		return Run{}, err
+	}
+	if err := json.Unmarshal(rules, &run.Rules); err != nil {
+		return Run{}, err
+	}
+	run.PeriodStart = start.Time
+	run.PeriodEnd = end.Time
+	run.CreatedAt = createdAt.Time
+	if approvedAt.Valid {
+		t := approvedAt.Time
+		run.ApprovedAt = &t
+	}
+	if postedAt.Valid {
+		t := postedAt.Time
+		run.PostedAt = &t
+	}
+	return run, nil
+}
@@ -0,0 +1,19 @@
+package patronage
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequirePermission("patronage.manage"))
+		r.Get("/runs", h.ListRuns)
+		r.Post("/runs", h.CreateRun)
+		r.Get("/runs/{id}", h.GetRun)
+		r.Get("/runs/{id}/allocations.csv", h.ExportCSV)
+		r.Post("/runs/{id}/approve", h.Approve)
+		r.Post("/runs/{id}/post", h.PostToLedger)
+	}
+	r.Route("/patronage", route)
+}
@@ -0,0 +1,312 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxBody caps the size of a webhook delivery.
+const maxBody = 1 << 20
+
+// LedgerPoster is the subset of ledger.Repo used to post payments.
+type LedgerPoster interface {
+	CreateInCurrency(ctx context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+	// Rates converts payments in a foreign currency; nil leaves them
+	// failed until replayed.
+	Rates fx.Lookuper
+	// Providers maps the {provider} path segment to its adapter; only
+	// configured providers accept deliveries.
+	Providers map[string]Provider
+	// Now is the clock used for signature windows; nil means time.Now.
+	Now func() time.Time
+}
+
+func (h Handlers) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// Webhook handles POST /api/payments/webhooks/{provider}. The signature is
+// checked before anything is stored. Deliveries are logged once per
+// provider event id; a redelivery of an event already settled returns it
+// unchanged, while received or failed ones are processed again.
+// Responds 500 when the payment could not be posted so the processor
+// retries.
+func (h Handlers) Webhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	prov, ok := h.Providers[name]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "unknown provider")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusRequestEntityTooLarge, "payload too large")
+		return
+	}
+	if err := prov.Verify(r.Header, body, h.now()); err != nil {
+		httpmw.WriteJSONError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	id, typ, pay, err := prov.Parse(body)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ev, _, err := h.Repo.Record(r.Context(), Event{Provider: name, EventID: id, Type: typ, Payload: body})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to record event")
+		return
+	}
+	if ev.Status != StatusReceived && ev.Status != StatusFailed {
+		ev.Payload = nil
+		writeJSON(w, http.StatusOK, ev)
+		return
+	}
+	h.respond(w, r, ev, pay)
+}
+
+// List handles GET /api/payments/events (admin, treasurer).
+// Query: provider, status, limit, offset
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	f := ListFilters{Provider: r.URL.Query().Get("provider"), Status: r.URL.Query().Get("status")}
+	if f.Status != "" && !ValidStatus(f.Status) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 200)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.List(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Event{}
+	}
+	for i := range items {
+		items[i].Payload = nil
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Get handles GET /api/payments/events/{id} (admin, treasurer), including
+// the raw payload.
+func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	ev, ok := h.event(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, ev)
+}
+
+// Replay handles POST /api/payments/events/{id}/replay (admin), processing
+// the stored payload again. Posted events are returned unchanged, and the
+// ledger idempotency key keeps a replay from posting twice.
+func (h Handlers) Replay(w http.ResponseWriter, r *http.Request) {
+	ev, ok := h.event(w, r)
+	if !ok {
+		return
+	}
+	if ev.Status == StatusPosted {
+		writeJSON(w, http.StatusOK, ev)
+		return
+	}
+	prov, ok := h.Providers[ev.Provider]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusConflict, "provider "+ev.Provider+" is not configured")
+		return
+	}
+	_, _, pay, err := prov.Parse(ev.Payload)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusConflict, "stored payload no longer parses")
+		return
+	}
+	h.respond(w, r, ev, pay)
+}
+
+// Assign handles POST /api/payments/events/{id}/assign (admin), matching an
+// unmatched or failed payment to a member by hand and posting it.
+// Body: {"member_id":4}
+func (h Handlers) Assign(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		MemberID int64 `json:"member_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.MemberID <= 0 || in.MemberID > math.MaxInt32 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member_id required")
+		return
+	}
+	ev, ok := h.event(w, r)
+	if !ok {
+		return
+	}
+	if ev.Status != StatusUnmatched && ev.Status != StatusFailed {
+		httpmw.WriteJSONError(w, http.StatusConflict, "only unmatched or failed events can be assigned")
+		return
+	}
+	exists, err := h.Repo.MemberExists(r.Context(), in.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return
+	}
+	if !exists {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member not found")
+		return
+	}
+	prov, ok := h.Providers[ev.Provider]
+	if !ok {
+		httpmw.WriteJSONError(w, http.StatusConflict, "provider "+ev.Provider+" is not configured")
+		return
+	}
+	_, _, pay, err := prov.Parse(ev.Payload)
+	if err != nil || pay == nil {
+		httpmw.WriteJSONError(w, http.StatusConflict, "event is not a payment")
+		return
+	}
+	ev.MemberID = &in.MemberID
+	h.respond(w, r, ev, pay)
+}
+
+// respond processes ev and writes the stored result.
+func (h Handlers) respond(w http.ResponseWriter, r *http.Request, ev Event, pay *Payment) {
+	out, err := h.process(r.Context(), ev, pay)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to process event")
+		return
+	}
+	out.Payload = nil
+	writeJSON(w, http.StatusOK, out)
+}
+
+// process matches pay to a member, posts it to the ledger as dues keyed on
+// the provider event id and stores the outcome. A member already assigned
+// to ev wins over the one in the payment, which wins over an email match.
+// The error is non-nil when the outcome could not be stored or the ledger
+// post failed; in the latter case the event is stored as failed first.
+func (h Handlers) process(ctx context.Context, ev Event, pay *Payment) (Event, error) {
+	if pay == nil {
+		ev.Status, ev.Error = StatusIgnored, ""
+		return h.Repo.SetResult(ctx, ev)
+	}
+	amount := pay.Amount
+	ev.Amount, ev.Currency, ev.Email, ev.Reference = &amount, pay.Currency, pay.Email, pay.Reference
+	if ev.MemberID == nil && pay.MemberID != nil && *pay.MemberID <= math.MaxInt32 {
+		ok, err := h.Repo.MemberExists(ctx, *pay.MemberID)
+		if err != nil {
+			return Event{}, err
+		}
+		if ok {
+			ev.MemberID = pay.MemberID
+		}
+	}
+	if ev.MemberID == nil && pay.Email != "" {
+		id, err := h.Repo.MemberByEmail(ctx, pay.Email)
+		if err != nil {
+			return Event{}, err
+		}
+		if id != nil && *id <= math.MaxInt32 {
+			ev.MemberID = id
+		}
+	}
+	if ev.MemberID == nil {
+		ev.Status, ev.Error = StatusUnmatched, "no member matches this payment"
+		return h.Repo.SetResult(ctx, ev)
+	}
+	rate, err := h.rate(ctx, pay.Currency, ev.ReceivedAt)
+	if err != nil {
+		if !errors.Is(err, fx.ErrNoRate) {
+			return Event{}, err
+		}
+		ev.Status, ev.Error = StatusFailed, "no exchange rate for "+pay.Currency
+		return h.Repo.SetResult(ctx, ev)
+	}
+	desc := pay.Description
+	if desc == "" {
+		desc = "Dues payment via " + ev.Provider
+	}
+	notes := fmt.Sprintf("Payment event #%d", ev.ID)
+	if pay.Reference != "" {
+		notes += " (" + pay.Reference + ")"
+	}
+	key := pay.Key
+	if key == "" {
+		key = ev.EventID
+	}
+	mid := int32(*ev.MemberID)
+	entry, _, postErr := h.Ledger.CreateInCurrency(ctx, "dues", desc, pay.Amount, pay.Currency, rate, &mid, notes, ev.Provider+":"+key)
+	if postErr != nil {
+		ev.Status, ev.Error = StatusFailed, "ledger post failed"
+		if _, err := h.Repo.SetResult(ctx, ev); err != nil {
+			return Event{}, err
+		}
+		return Event{}, postErr
+	}
+	ev.Status, ev.Error, ev.LedgerEntryID = StatusPosted, "", &entry.ID
+	return h.Repo.SetResult(ctx, ev)
+}
+
+// rate returns the rate converting currency into the ledger base currency
+// on a date; without Rates only base currency payments convert.
+func (h Handlers) rate(ctx context.Context, currency string, on time.Time) (float64, error) {
+	if currency == ledger.BaseCurrency {
+		return 1, nil
+	}
+	if h.Rates == nil {
+		return 0, fx.ErrNoRate
+	}
+	rate, err := h.Rates.Lookup(ctx, currency, on)
+	if err != nil {
+		return 0, err
+	}
+	return rate.Rate, nil
+}
+
+// event loads the event named by the {id} path parameter, writing the
+// error response when it cannot.
+func (h Handlers) event(w http.ResponseWriter, r *http.Request) (Event, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return Event{}, false
+	}
+	ev, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Event{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "lookup failed")
+		return Event{}, false
+	}
+	return ev, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
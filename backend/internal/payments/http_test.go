@@ -0,0 +1,365 @@
+package payments
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/fx"
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	events  []Event
+	members map[int64]string // id -> email
+}
+
+func (m *mockRepo) Record(_ context.Context, e Event) (Event, bool, error) {
+	for _, ev := range m.events {
+		if ev.Provider == e.Provider && ev.EventID == e.EventID {
+			return ev, false, nil
+		}
+	}
+	e.ID, e.Status, e.ReceivedAt = int64(len(m.events)+1), StatusReceived, time.Now()
+	m.events = append(m.events, e)
+	return e, true, nil
+}
+
+func (m *mockRepo) Get(_ context.Context, id int64) (Event, error) {
+	for _, ev := range m.events {
+		if ev.ID == id {
+			return ev, nil
+		}
+	}
+	return Event{}, ErrNotFound
+}
+
+func (m *mockRepo) List(_ context.Context, f ListFilters) ([]Event, error) {
+	var out []Event
+	for _, ev := range m.events {
+		if (f.Provider == "" || ev.Provider == f.Provider) && (f.Status == "" || ev.Status == f.Status) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) SetResult(_ context.Context, e Event) (Event, error) {
+	for i := range m.events {
+		if m.events[i].ID == e.ID {
+			now := time.Now()
+			e.Payload, e.Attempts, e.ProcessedAt = m.events[i].Payload, m.events[i].Attempts+1, &now
+			m.events[i] = e
+			return e, nil
+		}
+	}
+	return Event{}, ErrNotFound
+}
+
+func (m *mockRepo) MemberExists(_ context.Context, id int64) (bool, error) {
+	_, ok := m.members[id]
+	return ok, nil
+}
+
+func (m *mockRepo) MemberByEmail(_ context.Context, email string) (*int64, error) {
+	for id, e := range m.members {
+		if strings.EqualFold(e, email) {
+			return &id, nil
+		}
+	}
+	return nil, nil
+}
+
+// mockLedger dedupes on the idempotency key like the ledger does for
+// member-linked entries.
+type mockLedger struct {
+	entries []ledger.LedgerEntry
+	keys    map[string]int
+	fail    bool
+}
+
+func (m *mockLedger) CreateInCurrency(_ context.Context, entryType, description string, amount float64, currency string, rate float64, memberID *int32, notes string, key string) (ledger.LedgerEntry, bool, error) {
+	if m.fail {
+		return ledger.LedgerEntry{}, false, errors.New("ledger down")
+	}
+	if i, ok := m.keys[key]; ok {
+		return m.entries[i], true, nil
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 1), Type: entryType, Description: description, Amount: amount, Currency: currency, FxRate: rate, MemberID: memberID, Notes: notes}
+	if m.keys == nil {
+		m.keys = map[string]int{}
+	}
+	m.keys[key] = len(m.entries)
+	m.entries = append(m.entries, e)
+	return e, false, nil
+}
+
+type mockRates map[string]float64
+
+func (m mockRates) Lookup(_ context.Context, currency string, on time.Time) (fx.Rate, error) {
+	rate, ok := m[currency]
+	if !ok {
+		return fx.Rate{}, fx.ErrNoRate
+	}
+	return fx.Rate{Currency: currency, Date: on, Rate: rate}, nil
+}
+
+// ---- Helper functions ----
+
+const secret = "whsec_test"
+
+var now = time.Date(2025, 5, 10, 12, 0, 0, 0, time.UTC)
+
+// Member 1 is an admin, 2 a treasurer, 3 a plain member.
+func setupRouter(h Handlers) *chi.Mux {
+	roles := map[int64]string{1: "admin", 2: "treasurer", 3: "member"}
+	h.Now = func() time.Time { return now }
+	if h.Providers == nil {
+		h.Providers = map[string]Provider{"stripe": Stripe{Secret: secret}, "hmac": HMACJSON{Secret: secret}}
+	}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		return httpmw.Principal{MemberID: id, Role: role}, ok, nil
+	}))
+	Mount(r, h)
+	return r
+}
+
+func do(r http.Handler, user, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", user)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func stripeHeader(body string, at time.Time) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	h := http.Header{}
+	h.Set("Stripe-Signature", "t="+ts+",v1="+hex.EncodeToString(sign(secret, []byte(ts+"."+body))))
+	return h
+}
+
+func hmacHeader(body string, at time.Time) http.Header {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	h := http.Header{}
+	h.Set("X-Timestamp", ts)
+	h.Set("X-Signature", "sha256="+hex.EncodeToString(sign(secret, []byte(ts+"."+body))))
+	return h
+}
+
+func deliver(r http.Handler, provider, body string, h http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/payments/webhooks/"+provider, strings.NewReader(body))
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestProviders_Verify(t *testing.T) {
+	body := `{"id":"evt_1"}`
+	for name, c := range map[string]struct {
+		p    Provider
+		h    http.Header
+		want error
+	}{
+		"stripe valid":   {Stripe{Secret: secret}, stripeHeader(body, now), nil},
+		"stripe stale":   {Stripe{Secret: secret}, stripeHeader(body, now.Add(-6*time.Minute)), ErrSignature},
+		"stripe wrong":   {Stripe{Secret: "other"}, stripeHeader(body, now), ErrSignature},
+		"stripe missing": {Stripe{Secret: secret}, http.Header{}, ErrSignature},
+		"hmac valid":     {HMACJSON{Secret: secret}, hmacHeader(body, now), nil},
+		"hmac future":    {HMACJSON{Secret: secret}, hmacHeader(body, now.Add(6*time.Minute)), ErrSignature},
+		"hmac wrong":     {HMACJSON{Secret: "other"}, hmacHeader(body, now), ErrSignature},
+		"hmac no prefix": {HMACJSON{Secret: secret}, http.Header{"X-Signature": {"abc"}, "X-Timestamp": {"1"}}, ErrSignature},
+	} {
+		if err := c.p.Verify(c.h, []byte(body), now); err != c.want {
+			t.Errorf("%s: expected %v, got %v", name, c.want, err)
+		}
+	}
+	if err := (Stripe{Secret: secret}).Verify(stripeHeader(body, now), []byte(body+" "), now); err != ErrSignature {
+		t.Errorf("expected a tampered body to fail, got %v", err)
+	}
+}
+
+func TestStripe_Parse(t *testing.T) {
+	id, typ, p, err := Stripe{}.Parse([]byte(`{"id":"evt_1","type":"charge.succeeded","data":{"object":{"id":"ch_1","amount":2550,"currency":"usd",
+		"metadata":{"member_id":"4"},"billing_details":{"email":"ada@example.org"}}}}`))
+	if err != nil || id != "evt_1" || typ != "charge.succeeded" || p.Amount != 25.5 || p.Currency != "USD" || *p.MemberID != 4 || p.Email != "ada@example.org" || p.Reference != "ch_1" {
+		t.Fatalf("unexpected charge: %v %+v", err, p)
+	}
+	if p.Key != "ch_1" {
+		t.Fatalf("expected a charge without a payment intent to be keyed on itself, got %q", p.Key)
+	}
+	_, _, p, _ = Stripe{}.Parse([]byte(`{"id":"evt_2","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount_received":3000,"currency":"jpy"}}}`))
+	if p.Amount != 3000 || p.Currency != "JPY" || p.MemberID != nil || p.Key != "pi_1" {
+		t.Fatalf("expected zero-decimal yen, got %+v", p)
+	}
+	_, _, p, err = Stripe{}.Parse([]byte(`{"id":"evt_3","type":"checkout.session.completed","data":{"object":{"payment_status":"unpaid","amount_total":100,"currency":"usd"}}}`))
+	if err != nil || p != nil {
+		t.Fatalf("expected unpaid session to carry no payment, got %v %+v", err, p)
+	}
+	if _, _, _, err := (Stripe{}).Parse([]byte(`{"type":"charge.succeeded"}`)); err != ErrPayload {
+		t.Fatalf("expected ErrPayload without id, got %v", err)
+	}
+}
+
+func TestHandlers_StripePostsOncePerPaymentIntent(t *testing.T) {
+	repo := &mockRepo{members: map[int64]string{4: "ada@example.org"}}
+	led := &mockLedger{}
+	r := setupRouter(Handlers{Repo: repo, Ledger: led})
+
+	var posted []int32
+	for _, body := range []string{
+		`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{"id":"cs_1","payment_intent":"pi_1","payment_status":"paid","amount_total":2500,"currency":"usd","client_reference_id":"4"}}}`,
+		`{"id":"evt_2","type":"charge.succeeded","data":{"object":{"id":"ch_1","payment_intent":"pi_1","amount":2500,"currency":"usd","metadata":{"member_id":"4"}}}}`,
+		`{"id":"evt_3","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount_received":2500,"currency":"usd","metadata":{"member_id":"4"}}}}`,
+	} {
+		rr := deliver(r, "stripe", body, stripeHeader(body, now))
+		var ev Event
+		_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+		if rr.Code != http.StatusOK || ev.Status != StatusPosted || ev.LedgerEntryID == nil {
+			t.Fatalf("unexpected webhook: %d %s", rr.Code, rr.Body.String())
+		}
+		posted = append(posted, *ev.LedgerEntryID)
+	}
+	if len(led.entries) != 1 || posted[0] != posted[1] || posted[1] != posted[2] {
+		t.Fatalf("expected one ledger entry for one payment, got %d (%v)", len(led.entries), posted)
+	}
+}
+
+func TestHandlers_WebhookPostsDues(t *testing.T) {
+	repo := &mockRepo{members: map[int64]string{4: "ada@example.org"}}
+	led := &mockLedger{}
+	r := setupRouter(Handlers{Repo: repo, Ledger: led})
+
+	body := `{"id":"evt_1","type":"charge.succeeded","data":{"object":{"id":"ch_1","amount":2500,"currency":"usd","description":"May dues","metadata":{"member_id":"4"}}}}`
+	if rr := deliver(r, "stripe", body, stripeHeader(body, now.Add(-time.Hour))); rr.Code != http.StatusUnauthorized || len(repo.events) != 0 {
+		t.Fatalf("expected 401 without logging, got %d", rr.Code)
+	}
+	if rr := deliver(r, "paypal", body, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown provider, got %d", rr.Code)
+	}
+	rr := deliver(r, "stripe", body, stripeHeader(body, now))
+	var ev Event
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if rr.Code != http.StatusOK || ev.Status != StatusPosted || ev.LedgerEntryID == nil || *ev.MemberID != 4 || *ev.Amount != 25 {
+		t.Fatalf("unexpected webhook: %d %s", rr.Code, rr.Body.String())
+	}
+	e := led.entries[0]
+	if e.Type != "dues" || e.Amount != 25 || e.Description != "May dues" || *e.MemberID != 4 || !strings.Contains(e.Notes, "ch_1") {
+		t.Fatalf("unexpected ledger entry: %+v", e)
+	}
+
+	// Redelivery is acknowledged without posting again.
+	rr = deliver(r, "stripe", body, stripeHeader(body, now))
+	if rr.Code != http.StatusOK || len(led.entries) != 1 || repo.events[0].Attempts != 1 {
+		t.Fatalf("expected duplicate to be acknowledged, got %d with %d entries", rr.Code, len(led.entries))
+	}
+
+	// Events that are not payments are logged and ignored.
+	other := `{"id":"evt_2","type":"customer.created","data":{"object":{}}}`
+	rr = deliver(r, "stripe", other, stripeHeader(other, now))
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if ev.Status != StatusIgnored || len(led.entries) != 1 {
+		t.Fatalf("expected ignored event, got %s", rr.Body.String())
+	}
+
+	if rr := do(r, "3", "GET", "/payments/events", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for member, got %d", rr.Code)
+	}
+	rr = do(r, "2", "GET", "/payments/events?status=posted", "")
+	var list []Event
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list) != 1 || list[0].Payload != nil {
+		t.Fatalf("unexpected list: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = do(r, "2", "GET", "/payments/events/1", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"payload":{"id":"evt_1"`) {
+		t.Fatalf("expected raw payload, got %s", rr.Body.String())
+	}
+}
+
+func TestHandlers_UnmatchedAssignAndReplay(t *testing.T) {
+	repo := &mockRepo{members: map[int64]string{3: "ben@example.org", 4: "ada@example.org"}}
+	led := &mockLedger{}
+	rates := mockRates{}
+	r := setupRouter(Handlers{Repo: repo, Ledger: led, Rates: rates})
+
+	// Matched by email, case-insensitively.
+	body := `{"id":"p-1","type":"payment.succeeded","amount":30,"currency":"USD","email":"ADA@example.org"}`
+	rr := deliver(r, "hmac", body, hmacHeader(body, now))
+	var ev Event
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if ev.Status != StatusPosted || *ev.MemberID != 4 {
+		t.Fatalf("expected email match, got %s", rr.Body.String())
+	}
+
+	body = `{"id":"p-2","type":"payment.succeeded","amount":12.5,"currency":"USD","email":"stranger@example.org","member_id":99}`
+	rr = deliver(r, "hmac", body, hmacHeader(body, now))
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if rr.Code != http.StatusOK || ev.Status != StatusUnmatched || len(led.entries) != 1 {
+		t.Fatalf("expected unmatched event, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "2", "POST", "/payments/events/2/assign", `{"member_id":3}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for treasurer assign, got %d", rr.Code)
+	}
+	if rr := do(r, "1", "POST", "/payments/events/2/assign", `{"member_id":7}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown member, got %d", rr.Code)
+	}
+	rr = do(r, "1", "POST", "/payments/events/2/assign", `{"member_id":3}`)
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if rr.Code != http.StatusOK || ev.Status != StatusPosted || *ev.MemberID != 3 || led.entries[1].Amount != 12.5 {
+		t.Fatalf("unexpected assign: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, "1", "POST", "/payments/events/2/assign", `{"member_id":4}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 reassigning a posted event, got %d", rr.Code)
+	}
+
+	// A foreign currency payment fails until a rate exists, then replays.
+	body = `{"id":"p-3","type":"payment.succeeded","amount":40,"currency":"CAD","member_id":3}`
+	rr = deliver(r, "hmac", body, hmacHeader(body, now))
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if ev.Status != StatusFailed || !strings.Contains(ev.Error, "CAD") {
+		t.Fatalf("expected failed event, got %s", rr.Body.String())
+	}
+	rates["CAD"] = 0.75
+	rr = do(r, "1", "POST", "/payments/events/3/replay", "")
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if rr.Code != http.StatusOK || ev.Status != StatusPosted || ev.Attempts != 2 || led.entries[2].FxRate != 0.75 || led.entries[2].Currency != "CAD" {
+		t.Fatalf("unexpected replay: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// A ledger outage answers 500 so the processor redelivers; the retry
+	// posts once.
+	led.fail = true
+	body = `{"id":"p-4","type":"payment.succeeded","amount":5,"currency":"USD","member_id":4}`
+	if rr := deliver(r, "hmac", body, hmacHeader(body, now)); rr.Code != http.StatusInternalServerError || repo.events[3].Status != StatusFailed {
+		t.Fatalf("expected 500 and a failed event, got %d", rr.Code)
+	}
+	led.fail = false
+	rr = deliver(r, "hmac", body, hmacHeader(body, now))
+	_ = json.Unmarshal(rr.Body.Bytes(), &ev)
+	if ev.Status != StatusPosted || len(led.entries) != 4 {
+		t.Fatalf("expected redelivery to post, got %s", rr.Body.String())
+	}
+	// Replaying a posted event changes nothing.
+	if rr := do(r, "1", "POST", "/payments/events/4/replay", ""); rr.Code != http.StatusOK || len(led.entries) != 4 {
+		t.Fatalf("expected idempotent replay, got %d with %d entries", rr.Code, len(led.entries))
+	}
+}
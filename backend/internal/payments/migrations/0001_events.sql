@@ -0,0 +1,24 @@
+-- backend/internal/payments/migrations/0001_events.sql
+-- Every verified webhook delivery, keyed by the processor's event id so
+-- redeliveries are recognised. payload keeps the raw body for replays.
+CREATE TABLE IF NOT EXISTS payment_events (
+  id BIGSERIAL PRIMARY KEY,
+  provider TEXT NOT NULL,
+  event_id TEXT NOT NULL,
+  event_type TEXT NOT NULL DEFAULT '',
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'received'
+    CHECK (status IN ('received','posted','ignored','unmatched','failed')),
+  member_id BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  amount DECIMAL(12,2),
+  currency TEXT NOT NULL DEFAULT '',
+  email TEXT NOT NULL DEFAULT '',
+  reference TEXT NOT NULL DEFAULT '',
+  ledger_entry_id INTEGER REFERENCES ledger_entries(id),
+  error TEXT NOT NULL DEFAULT '',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  processed_at TIMESTAMPTZ,
+  UNIQUE (provider, event_id)
+);
+CREATE INDEX IF NOT EXISTS payment_events_status_idx ON payment_events(status, received_at);
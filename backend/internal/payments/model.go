@@ -0,0 +1,70 @@
+package payments
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event statuses. A received event is processed into one of the others:
+// posted to the ledger, ignored (not a successful payment), unmatched (no
+// member found) or failed (posting error; replayable).
+const (
+	StatusReceived  = "received"
+	StatusPosted    = "posted"
+	StatusIgnored   = "ignored"
+	StatusUnmatched = "unmatched"
+	StatusFailed    = "failed"
+)
+
+// ValidStatus reports whether s is a known event status.
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusReceived, StatusPosted, StatusIgnored, StatusUnmatched, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// Event is one webhook delivery as logged. Amount, Currency, Email and
+// Reference are filled in from the parsed payment once processed.
+type Event struct {
+	ID            int64           `json:"id"`
+	Provider      string          `json:"provider"`
+	EventID       string          `json:"event_id"`
+	Type          string          `json:"type"`
+	Payload       json.RawMessage `json:"payload,omitempty"`
+	Status        string          `json:"status"`
+	MemberID      *int64          `json:"member_id"`
+	Amount        *float64        `json:"amount"`
+	Currency      string          `json:"currency"`
+	Email         string          `json:"email"`
+	Reference     string          `json:"reference"`
+	LedgerEntryID *int32          `json:"ledger_entry_id"`
+	Error         string          `json:"error"`
+	Attempts      int             `json:"attempts"`
+	ReceivedAt    time.Time       `json:"received_at"`
+	ProcessedAt   *time.Time      `json:"processed_at"`
+}
+
+// Payment is a successful payment extracted from a provider event.
+// MemberID is set when the processor carried it in metadata; Email is the
+// payer's address otherwise used to find the member. Key identifies the
+// underlying payment when a processor reports it in several events; it
+// defaults to the event id.
+type Payment struct {
+	Amount      float64
+	Currency    string
+	MemberID    *int64
+	Email       string
+	Reference   string
+	Description string
+	Key         string
+}
+
+// ListFilters holds optional constraints for listing events.
+type ListFilters struct {
+	Provider string
+	Status   string
+	Limit    int
+	Offset   int
+}
@@ -0,0 +1,218 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSignature is returned by Verify for a missing, malformed or
+	// mismatched signature, or one outside the replay window.
+	ErrSignature = errors.New("invalid signature")
+	// ErrPayload is returned by Parse for a body the provider would not
+	// send.
+	ErrPayload = errors.New("invalid payload")
+)
+
+// Provider adapts one processor's webhook format.
+type Provider interface {
+	// Verify checks the request signature over the raw body.
+	Verify(h http.Header, body []byte, now time.Time) error
+	// Parse returns the event's id and type, and the payment when the event
+	// reports a successful one (nil otherwise).
+	Parse(body []byte) (id, eventType string, p *Payment, err error)
+}
+
+// SignatureTolerance is how old a signed timestamp may be.
+const SignatureTolerance = 5 * time.Minute
+
+func sign(secret string, msg []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	return mac.Sum(nil)
+}
+
+// Stripe verifies Stripe-Signature headers ("t=<unix>,v1=<hex>" signing
+// "<t>.<body>") and reads charge, payment intent and checkout session
+// events. The member is taken from metadata.member_id or
+// client_reference_id, else matched by the receipt or customer email.
+// One payment raises a charge, a payment intent and often a checkout
+// session event, so payments are keyed on the payment intent.
+type Stripe struct {
+	Secret string
+}
+
+func (s Stripe) Verify(h http.Header, body []byte, now time.Time) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(h.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return ErrSignature
+	}
+	want := sign(s.Secret, append([]byte(ts+"."), body...))
+	for _, sig := range sigs {
+		if hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+	return ErrSignature
+}
+
+// zeroDecimal lists currencies Stripe amounts are not given in cents for.
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+func (s Stripe) Parse(body []byte) (string, string, *Payment, error) {
+	var ev struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ID                string            `json:"id"`
+				PaymentIntent     string            `json:"payment_intent"`
+				Amount            int64             `json:"amount"`
+				AmountReceived    int64             `json:"amount_received"`
+				AmountTotal       int64             `json:"amount_total"`
+				Currency          string            `json:"currency"`
+				Status            string            `json:"status"`
+				PaymentStatus     string            `json:"payment_status"`
+				Description       string            `json:"description"`
+				ReceiptEmail      string            `json:"receipt_email"`
+				ClientReferenceID string            `json:"client_reference_id"`
+				Metadata          map[string]string `json:"metadata"`
+				BillingDetails    struct {
+					Email string `json:"email"`
+				} `json:"billing_details"`
+				CustomerDetails struct {
+					Email string `json:"email"`
+				} `json:"customer_details"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil || ev.ID == "" || ev.Type == "" {
+		return "", "", nil, ErrPayload
+	}
+	o := ev.Data.Object
+	var minor int64
+	switch ev.Type {
+	case "charge.succeeded":
+		minor = o.Amount
+	case "payment_intent.succeeded":
+		minor = o.AmountReceived
+	case "checkout.session.completed":
+		if o.PaymentStatus != "paid" {
+			return ev.ID, ev.Type, nil, nil
+		}
+		minor = o.AmountTotal
+	default:
+		return ev.ID, ev.Type, nil, nil
+	}
+	if minor <= 0 || o.Currency == "" {
+		return "", "", nil, ErrPayload
+	}
+	p := &Payment{Currency: strings.ToUpper(o.Currency), Reference: o.ID, Description: o.Description, Key: o.PaymentIntent}
+	if p.Key == "" {
+		p.Key = o.ID
+	}
+	p.Amount = float64(minor)
+	if !zeroDecimal[p.Currency] {
+		p.Amount = float64(minor) / 100
+	}
+	ref := o.Metadata["member_id"]
+	if ref == "" {
+		ref = o.ClientReferenceID
+	}
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil && id > 0 {
+		p.MemberID = &id
+	}
+	for _, e := range []string{o.Metadata["email"], o.ReceiptEmail, o.BillingDetails.Email, o.CustomerDetails.Email} {
+		if e != "" {
+			p.Email = e
+			break
+		}
+	}
+	return ev.ID, ev.Type, p, nil
+}
+
+// HMACJSON is the generic format for processors without an adapter: an
+// X-Signature header of "sha256=<hex>" HMAC-SHA256 over
+// "<X-Timestamp>.<body>", and a flat JSON body. Only "payment.succeeded"
+// events are posted.
+//
+//	{"id":"evt-1","type":"payment.succeeded","amount":25.00,"currency":"USD",
+//	 "member_id":4,"email":"ada@example.org","reference":"ch_1","description":"May dues"}
+type HMACJSON struct {
+	Secret string
+}
+
+func (g HMACJSON) Verify(h http.Header, body []byte, now time.Time) error {
+	hexSig, ok := strings.CutPrefix(h.Get("X-Signature"), "sha256=")
+	if !ok {
+		return ErrSignature
+	}
+	sig, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return ErrSignature
+	}
+	ts := h.Get("X-Timestamp")
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > SignatureTolerance || d < -SignatureTolerance {
+		return ErrSignature
+	}
+	if !hmac.Equal(sig, sign(g.Secret, append([]byte(ts+"."), body...))) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func (g HMACJSON) Parse(body []byte) (string, string, *Payment, error) {
+	var ev struct {
+		ID          string  `json:"id"`
+		Type        string  `json:"type"`
+		Amount      float64 `json:"amount"`
+		Currency    string  `json:"currency"`
+		MemberID    *int64  `json:"member_id"`
+		Email       string  `json:"email"`
+		Reference   string  `json:"reference"`
+		Description string  `json:"description"`
+	}
+	if err := json.Unmarshal(body, &ev); err != nil || ev.ID == "" || ev.Type == "" {
+		return "", "", nil, ErrPayload
+	}
+	if ev.Type != "payment.succeeded" {
+		return ev.ID, ev.Type, nil, nil
+	}
+	if ev.Amount <= 0 || math.IsInf(ev.Amount, 0) || ev.Currency == "" {
+		return "", "", nil, fmt.Errorf("%w: amount and currency required", ErrPayload)
+	}
+	return ev.ID, ev.Type, &Payment{Amount: math.Round(ev.Amount*100) / 100, Currency: strings.ToUpper(ev.Currency),
+		MemberID: ev.MemberID, Email: ev.Email, Reference: ev.Reference, Description: ev.Description}, nil
+}
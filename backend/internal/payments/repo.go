@@ -0,0 +1,142 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("payment event not found")
+
+type Repo interface {
+	// Record logs a delivery. created is false when the provider already
+	// sent this event id; the logged event is returned unchanged.
+	Record(ctx context.Context, e Event) (out Event, created bool, err error)
+	Get(ctx context.Context, id int64) (Event, error)
+	List(ctx context.Context, f ListFilters) ([]Event, error)
+	// SetResult stores the outcome of processing e and counts the attempt.
+	SetResult(ctx context.Context, e Event) (Event, error)
+	// MemberExists and MemberByEmail match payments to members; the email
+	// match is case-insensitive and nil unless exactly one member has it.
+	MemberExists(ctx context.Context, id int64) (bool, error)
+	MemberByEmail(ctx context.Context, email string) (*int64, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const columns = `id, provider, event_id, event_type, payload, status, member_id, amount::float8, currency, email, reference, ledger_entry_id, error, attempts, received_at, processed_at`
+
+func (r *PgRepo) Record(ctx context.Context, e Event) (Event, bool, error) {
+	out, err := scanEvent(r.Pool.QueryRow(ctx, `
+INSERT INTO payment_events (provider, event_id, event_type, payload)
+VALUES ($1,$2,$3,$4)
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING `+columns, e.Provider, e.EventID, e.Type, string(e.Payload)))
+	if err == pgx.ErrNoRows {
+		out, err = scanEvent(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM payment_events WHERE provider=$1 AND event_id=$2`, e.Provider, e.EventID))
+		return out, false, err
+	}
+	return out, err == nil, err
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int64) (Event, error) {
+	e, err := scanEvent(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM payment_events WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Event{}, ErrNotFound
+	}
+	return e, err
+}
+
+func (r *PgRepo) List(ctx context.Context, f ListFilters) ([]Event, error) {
+	query := `SELECT ` + columns + ` FROM payment_events
+WHERE ($1 = '' OR provider=$1) AND ($2 = '' OR status=$2)
+ORDER BY received_at DESC, id DESC`
+	args := []any{f.Provider, f.Status}
+	if f.Limit > 0 {
+		query += ` LIMIT $3 OFFSET $4`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $3`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) SetResult(ctx context.Context, e Event) (Event, error) {
+	out, err := scanEvent(r.Pool.QueryRow(ctx, `
+UPDATE payment_events SET status=$2, member_id=$3, amount=$4, currency=$5, email=$6, reference=$7,
+       ledger_entry_id=$8, error=$9, attempts=attempts+1, processed_at=now()
+WHERE id=$1
+RETURNING `+columns, e.ID, e.Status, e.MemberID, e.Amount, e.Currency, e.Email, e.Reference, e.LedgerEntryID, e.Error))
+	if err == pgx.ErrNoRows {
+		return Event{}, ErrNotFound
+	}
+	return out, err
+}
+
+func (r *PgRepo) MemberExists(ctx context.Context, id int64) (bool, error) {
+	var ok bool
+	err := r.Pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM members WHERE id=$1)`, id).Scan(&ok)
+	return ok, err
+}
+
+func (r *PgRepo) MemberByEmail(ctx context.Context, email string) (*int64, error) {
+	var id pgtype.Int8
+	var n int
+	err := r.Pool.QueryRow(ctx, `SELECT min(id), count(*) FROM members WHERE lower(email)=$1`, strings.ToLower(strings.TrimSpace(email))).Scan(&id, &n)
+	if err != nil || n != 1 {
+		return nil, err
+	}
+	return &id.Int64, nil
+}
+
+func scanEvent(row pgx.Row) (Event, error) {
+	var e Event
+	var payload string
+	var memberID pgtype.Int8
+	var amount pgtype.Float8
+	var entryID pgtype.Int4
+	var processedAt pgtype.Timestamptz
+	if err := row.Scan(&e.ID, &e.Provider, &e.EventID, &e.Type, &payload, &e.Status, &memberID, &amount, &e.Currency, &e.Email,
+		&e.Reference, &entryID, &e.Error, &e.Attempts, &e.ReceivedAt, &processedAt); err != nil {
+		return Event{}, err
+	}
+	e.Payload = []byte(payload)
+	if memberID.Valid {
+		e.MemberID = &memberID.Int64
+	}
+	if amount.Valid {
+		e.Amount = &amount.Float64
+	}
+	if entryID.Valid {
+		e.LedgerEntryID = &entryID.Int32
+	}
+	if processedAt.Valid {
+		t := processedAt.Time
+		e.ProcessedAt = &t
+	}
+	return e, nil
+}
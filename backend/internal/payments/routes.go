@@ -0,0 +1,22 @@
+package payments
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		// Processors authenticate with the body signature, not a member.
+		r.Post("/webhooks/{provider}", h.Webhook)
+		r.Group(func(r chi.Router) {
+			r.Use(httpmw.RequireAuth)
+			r.Use(httpmw.RequirePermission("payments.view", "payments.manage"))
+			r.Get("/events", h.List)
+			r.Get("/events/{id}", h.Get)
+			r.With(httpmw.RequirePermission("payments.manage")).Post("/events/{id}/replay", h.Replay)
+			r.With(httpmw.RequirePermission("payments.manage")).Post("/events/{id}/assign", h.Assign)
+		})
+	}
+	r.Route("/payments", route)
+}
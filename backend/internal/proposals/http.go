@@ -36,8 +36,9 @@ func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
 
 func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
 	var in struct {
-		Title string `json:"title"`
-		Body  string `json:"body"`
+		Title    string `json:"title"`
+		Body     string `json:"body"`
+		MemberID *int64 `json:"member_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
 		http.Error(w, "invalid json", http.StatusBadRequest)
@@ -47,7 +48,11 @@ func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "title required", http.StatusBadRequest)
 		return
 	}
-	p, err := h.Repo.Create(r.Context(), in.Title, in.Body)
+	if in.MemberID != nil && *in.MemberID <= 0 {
+		http.Error(w, "invalid member_id", http.StatusBadRequest)
+		return
+	}
+	p, err := h.Repo.Create(r.Context(), in.Title, in.Body, in.MemberID)
 	if err != nil {
 		http.Error(w, "insert failed", http.StatusInternalServerError)
 		return
@@ -78,7 +83,7 @@ func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 // Close transitions a proposal from open to closed.
-// POST /api/proposals/{id}/close
+// POST /api/proposals/{id}/close (proposals.manage)
 func (h Handlers) Close(w http.ResponseWriter, r *http.Request) {
     idStr := chi.URLParam(r, "id")
     id64, err := strconv.ParseInt(idStr, 10, 32)
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 
+	"coop.tools/backend/internal/httpmw"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -44,15 +45,16 @@ func (m *mockRepo) Get(_ context.Context, id int32) (Proposal, error) {
 	return Proposal{}, ErrNotFound
 }
 
-func (m *mockRepo) Create(_ context.Context, title, body string) (Proposal, error) {
+func (m *mockRepo) Create(_ context.Context, title, body string, memberID *int64) (Proposal, error) {
 	if m.nextID == 0 {
 		m.nextID = 1
 	}
 	p := Proposal{
-		ID:     m.nextID,
-		Title:  title,
-		Body:   body,
-		Status: "open",
+		ID:       m.nextID,
+		Title:    title,
+		Body:     body,
+		Status:   "open",
+		MemberID: memberID,
 		// CreatedAt left zero; handler tests don't assert it
 	}
 	m.nextID++
@@ -77,8 +79,14 @@ func (m *mockRepo) Close(_ context.Context, id int32) (Proposal, error) {
 
 // ---- Test Router Setup ----
 
+// Member 1 is an admin, 3 a member.
 func testRouter(repo Repo) http.Handler {
+	roles := map[int64]string{1: "admin", 3: "member"}
 	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := roles[id]
+		return httpmw.Principal{MemberID: id, Role: role}, ok, nil
+	}))
 	h := Handlers{Repo: repo}
 	r.Route("/api", func(api chi.Router) {
 		Mount(api, h)
@@ -113,6 +121,7 @@ func TestCreateRequiresTitle(t *testing.T) {
 	r := testRouter(repo)
 
 	req := httptest.NewRequest("POST", "/api/proposals", strings.NewReader(`{"body":"hello"}`))
+	req.Header.Set("X-User-Id", "1")
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
@@ -128,6 +137,7 @@ func TestCreateAndList(t *testing.T) {
 
 	body := `{"title":"Demo","body":"Hello"}`
 	req := httptest.NewRequest("POST", "/api/proposals", bytes.NewBufferString(body))
+	req.Header.Set("X-User-Id", "1")
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
@@ -161,6 +171,28 @@ func TestCreateAndList(t *testing.T) {
 	}
 }
 
+func TestCreateMembershipProposal(t *testing.T) {
+	repo := &mockRepo{}
+	r := testRouter(repo)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/proposals", strings.NewReader(body))
+		req.Header.Set("X-User-Id", "1")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := post(`{"title":"Admit Ada","member_id":0}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid member_id, got %d", rr.Code)
+	}
+	rr := post(`{"title":"Admit Ada","member_id":12}`)
+	var created Proposal
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+	if rr.Code != http.StatusCreated || created.MemberID == nil || *created.MemberID != 12 {
+		t.Fatalf("expected member_id 12, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestGetNotFound(t *testing.T) {
 	repo := &mockRepo{}
 	r := testRouter(repo)
@@ -180,6 +212,7 @@ func TestCloseHappyPath(t *testing.T) {
 
 	// Create open proposal
 	reqC := httptest.NewRequest("POST", "/api/proposals", strings.NewReader(`{"title":"Close me"}`))
+	reqC.Header.Set("X-User-Id", "1")
 	reqC.Header.Set("Content-Type", "application/json")
 	rrC := httptest.NewRecorder()
 	r.ServeHTTP(rrC, reqC)
@@ -191,6 +224,7 @@ func TestCloseHappyPath(t *testing.T) {
 
 	// Close it
 	req := httptest.NewRequest("POST", "/api/proposals/"+itoa(created.ID)+"/close", nil)
+	req.Header.Set("X-User-Id", "1")
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
 	if rr.Code != http.StatusOK {
@@ -209,6 +243,7 @@ func TestCloseAlreadyClosed(t *testing.T) {
 
 	// Create
 	reqC := httptest.NewRequest("POST", "/api/proposals", strings.NewReader(`{"title":"Twice"}`))
+	reqC.Header.Set("X-User-Id", "1")
 	reqC.Header.Set("Content-Type", "application/json")
 	rrC := httptest.NewRecorder()
 	r.ServeHTTP(rrC, reqC)
@@ -217,6 +252,7 @@ func TestCloseAlreadyClosed(t *testing.T) {
 
 	// Close once
 	req1 := httptest.NewRequest("POST", "/api/proposals/"+itoa(created.ID)+"/close", nil)
+	req1.Header.Set("X-User-Id", "1")
 	rr1 := httptest.NewRecorder()
 	r.ServeHTTP(rr1, req1)
 	if rr1.Code != http.StatusOK {
@@ -225,6 +261,7 @@ func TestCloseAlreadyClosed(t *testing.T) {
 
 	// Close again -> 409
 	req2 := httptest.NewRequest("POST", "/api/proposals/"+itoa(created.ID)+"/close", nil)
+	req2.Header.Set("X-User-Id", "1")
 	rr2 := httptest.NewRecorder()
 	r.ServeHTTP(rr2, req2)
 	if rr2.Code != http.StatusConflict {
@@ -239,6 +276,7 @@ func TestExportCSV(t *testing.T) {
 	// Seed two proposals
 	for _, ttl := range []string{"CSV One", "CSV Two"} {
 		req := httptest.NewRequest("POST", "/api/proposals", strings.NewReader(`{"title":"`+ttl+`"}`))
+		req.Header.Set("X-User-Id", "1")
 		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 		r.ServeHTTP(rr, req)
@@ -275,3 +313,33 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func TestCreateAndCloseRequireAuthorization(t *testing.T) {
+	repo := &mockRepo{}
+	r := testRouter(repo)
+	send := func(path, user string) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"title":"Anonymous"}`))
+		if user != "" {
+			req.Header.Set("X-User-Id", user)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := send("/api/proposals", ""); code != http.StatusUnauthorized {
+		t.Fatalf("guest create: expected 401, got %d", code)
+	}
+	if code := send("/api/proposals", "3"); code != http.StatusCreated {
+		t.Fatalf("member create: expected 201, got %d", code)
+	}
+	if code := send("/api/proposals/1/close", ""); code != http.StatusUnauthorized {
+		t.Fatalf("guest close: expected 401, got %d", code)
+	}
+	if code := send("/api/proposals/1/close", "3"); code != http.StatusForbidden {
+		t.Fatalf("member close: expected 403, got %d", code)
+	}
+	if repo.items[0].Status != "open" {
+		t.Fatalf("proposal closed without permission")
+	}
+}
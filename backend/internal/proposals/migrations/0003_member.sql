@@ -0,0 +1,4 @@
+-- backend/internal/proposals/migrations/0003_member.sql
+-- The member a membership proposal is about, so a passed vote approves
+-- that applicant and no other.
+ALTER TABLE proposals ADD COLUMN IF NOT EXISTS member_id BIGINT;
@@ -2,10 +2,13 @@ package proposals
 
 import "time"
 
+// Proposal is a motion put to a vote. MemberID is set on membership
+// proposals: the member whose status the vote decides.
 type Proposal struct {
 	ID        int32     `json:"id"`
 	Title     string    `json:"title"`
 	Body      string    `json:"body"`
 	Status    string    `json:"status"`
+	MemberID  *int64    `json:"member_id"`
 	CreatedAt time.Time `json:"created_at"`
 }
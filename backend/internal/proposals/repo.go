@@ -15,7 +15,8 @@ var ErrConflict = errors.New("invalid state transition")
 type Repo interface {
     List(ctx context.Context, limit, offset int) ([]Proposal, error)
     Get(ctx context.Context, id int32) (Proposal, error)
-    Create(ctx context.Context, title, body string) (Proposal, error)
+    // Create opens a proposal; memberID is the member it is about, if any.
+    Create(ctx context.Context, title, body string, memberID *int64) (Proposal, error)
     Close(ctx context.Context, id int32) (Proposal, error)
 }
 
@@ -29,7 +30,7 @@ func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
 
 func (r *PgRepo) List(ctx context.Context, limit, offset int) ([]Proposal, error) {
     query := `
-SELECT id, title, COALESCE(body,''), COALESCE(status,'open'), created_at
+SELECT id, title, COALESCE(body,''), COALESCE(status,'open'), member_id, created_at
 FROM proposals
 ORDER BY id DESC`
     args := []any{}
@@ -55,7 +56,7 @@ ORDER BY id DESC`
 	for rows.Next() {
 		var p Proposal
 		var ts pgtype.Timestamptz
-		if err := rows.Scan(&p.ID, &p.Title, &p.Body, &p.Status, &ts); err != nil {
+		if err := rows.Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.MemberID, &ts); err != nil {
 			return nil, err
 		}
 		p.CreatedAt = ts.Time
@@ -67,9 +68,9 @@ ORDER BY id DESC`
 func (r *PgRepo) Get(ctx context.Context, id int32) (Proposal, error) {
 	var p Proposal
 	err := r.Pool.QueryRow(ctx, `
-SELECT id, title, COALESCE(body,''), COALESCE(status,'open'), created_at
+SELECT id, title, COALESCE(body,''), COALESCE(status,'open'), member_id, created_at
 FROM proposals
-WHERE id=$1`, id).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.CreatedAt)
+WHERE id=$1`, id).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.MemberID, &p.CreatedAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return Proposal{}, ErrNotFound
@@ -79,13 +80,13 @@ WHERE id=$1`, id).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.CreatedAt)
 	return p, nil
 }
 
-func (r *PgRepo) Create(ctx context.Context, title, body string) (Proposal, error) {
+func (r *PgRepo) Create(ctx context.Context, title, body string, memberID *int64) (Proposal, error) {
 	var p Proposal
 	err := r.Pool.QueryRow(ctx, `
-INSERT INTO proposals (title, body, status)
-VALUES ($1,$2,'open')
-RETURNING id, title, COALESCE(body,''), status, created_at
-`, title, body).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.CreatedAt)
+INSERT INTO proposals (title, body, status, member_id)
+VALUES ($1,$2,'open',$3)
+RETURNING id, title, COALESCE(body,''), status, member_id, created_at
+`, title, body, memberID).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.MemberID, &p.CreatedAt)
 	if err != nil {
 		return Proposal{}, err
 	}
@@ -111,8 +112,8 @@ func (r *PgRepo) Close(ctx context.Context, id int32) (Proposal, error) {
 UPDATE proposals
 SET status='closed'
 WHERE id=$1
-RETURNING id, title, COALESCE(body,''), status, created_at
-`, id).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.CreatedAt); err != nil {
+RETURNING id, title, COALESCE(body,''), status, member_id, created_at
+`, id).Scan(&p.ID, &p.Title, &p.Body, &p.Status, &p.MemberID, &p.CreatedAt); err != nil {
 		return Proposal{}, err
 	}
 	return p, nil
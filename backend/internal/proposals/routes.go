@@ -1,14 +1,17 @@
 package proposals
 
-import "github.com/go-chi/chi/v5"
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
 
 func Mount(r chi.Router, h Handlers) {
 	route := func(r chi.Router) {
 		r.Get("/", h.List)
 		r.Get("/.csv", h.ExportCSV)
-		r.Post("/", h.Create)
+		r.With(httpmw.RequireActive).Post("/", h.Create)
 		r.Get("/{id}", h.Get)
-		r.Post("/{id}/close", h.Close)
+		r.With(httpmw.RequirePermission("proposals.manage")).Post("/{id}/close", h.Close)
 	}
 	r.Route("/proposals", route)
 }
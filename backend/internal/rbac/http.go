@@ -0,0 +1,395 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"github.com/go-chi/chi/v5"
+)
+
+// Handlers manage roles and role assignments. Managers need roles.manage
+// and can only grant, change or take away permissions they hold
+// themselves, so no one can raise their own access.
+type Handlers struct {
+	Repo Repo
+	// Now is the clock for assignment periods; nil means time.Now.
+	Now func() time.Time
+}
+
+func (h Handlers) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
+
+// lacking returns the first of perms p does not hold, or "".
+func lacking(p httpmw.Principal, perms []string) string {
+	for _, perm := range perms {
+		if !p.Can(perm) {
+			return perm
+		}
+	}
+	return ""
+}
+
+// checkGrant writes 403 unless the caller holds every one of perms.
+func checkGrant(w http.ResponseWriter, r *http.Request, perms ...[]string) bool {
+	p, _ := httpmw.FromContext(r.Context())
+	for _, set := range perms {
+		if perm := lacking(p, set); perm != "" {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "you do not hold permission "+strconv.Quote(perm))
+			return false
+		}
+	}
+	return true
+}
+
+func pathID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// ListPermissions handles GET /api/rbac/permissions.
+func (h Handlers) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, Catalog())
+}
+
+// ListRoles handles GET /api/rbac/roles: system roles first, then by name.
+func (h Handlers) ListRoles(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListRoles(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list roles")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// GetRole handles GET /api/rbac/roles/{id}.
+func (h Handlers) GetRole(w http.ResponseWriter, r *http.Request) {
+	if role, ok := h.role(w, r); ok {
+		writeJSON(w, http.StatusOK, role)
+	}
+}
+
+func (h Handlers) role(w http.ResponseWriter, r *http.Request) (Role, bool) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return Role{}, false
+	}
+	role, err := h.Repo.GetRole(r.Context(), id)
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "role not found")
+		return Role{}, false
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load role")
+		return Role{}, false
+	}
+	return role, true
+}
+
+type roleReq struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// decodeRole reads and validates a role body.
+func decodeRole(w http.ResponseWriter, r *http.Request) (Role, bool) {
+	var req roleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return Role{}, false
+	}
+	role := Role{Name: strings.TrimSpace(req.Name), Description: strings.TrimSpace(req.Description)}
+	if !ValidName(role.Name) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "name must be 2 to 40 lower-case letters, digits, '-' or '_', starting with a letter")
+		return Role{}, false
+	}
+	if len(role.Description) > 200 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "description must be at most 200 characters")
+		return Role{}, false
+	}
+	perms, bad := normalizePermissions(req.Permissions)
+	if bad != "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "unknown permission "+strconv.Quote(bad))
+		return Role{}, false
+	}
+	role.Permissions = perms
+	return role, true
+}
+
+// CreateRole handles POST /api/rbac/roles.
+// Body: {"name":"secretary","description":"Keeps the minutes","permissions":["announcements.publish"]}
+func (h Handlers) CreateRole(w http.ResponseWriter, r *http.Request) {
+	role, ok := decodeRole(w, r)
+	if !ok || !checkGrant(w, r, role.Permissions) {
+		return
+	}
+	out, err := h.Repo.CreateRole(r.Context(), role)
+	if err == ErrNameTaken {
+		httpmw.WriteJSONError(w, http.StatusConflict, "role name taken")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to create role")
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// UpdateRole handles PUT /api/rbac/roles/{id}, replacing the name,
+// description and permissions. System roles keep their names, and admin
+// keeps every permission. Changes apply to holders on their next request.
+func (h Handlers) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	cur, ok := h.role(w, r)
+	if !ok {
+		return
+	}
+	role, ok := decodeRole(w, r)
+	if !ok {
+		return
+	}
+	if cur.System && role.Name != cur.Name {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "system roles cannot be renamed")
+		return
+	}
+	if cur.Name == "admin" && (len(role.Permissions) != 1 || role.Permissions[0] != httpmw.AllPermissions) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "the admin role always has every permission")
+		return
+	}
+	if !checkGrant(w, r, cur.Permissions, role.Permissions) {
+		return
+	}
+	role.ID = cur.ID
+	out, err := h.Repo.UpdateRole(r.Context(), role)
+	if err == ErrNameTaken {
+		httpmw.WriteJSONError(w, http.StatusConflict, "role name taken")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to update role")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// DeleteRole handles DELETE /api/rbac/roles/{id}. System roles cannot be
+// deleted; other roles only once no assignment is active or pending.
+func (h Handlers) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role, ok := h.role(w, r)
+	if !ok {
+		return
+	}
+	if role.System {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "system roles cannot be deleted")
+		return
+	}
+	if !checkGrant(w, r, role.Permissions) {
+		return
+	}
+	switch err := h.Repo.DeleteRole(r.Context(), role.ID, h.now()); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrInUse:
+		httpmw.WriteJSONError(w, http.StatusConflict, "role is still assigned; revoke its assignments first")
+	case ErrNotFound:
+		httpmw.WriteJSONError(w, http.StatusNotFound, "role not found")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to delete role")
+	}
+}
+
+// ListAssignments handles GET /api/rbac/assignments: assignments that are
+// active or yet to start. Filters: member_id, role_id,
+// include_inactive=true (adds ended and revoked ones).
+func (h Handlers) ListAssignments(w http.ResponseWriter, r *http.Request) {
+	f := AssignmentFilters{IncludeInactive: httpx.QueryBoolTrue(r, "include_inactive"), Now: h.now()}
+	var err error
+	if f.MemberID, err = httpx.QueryInt64(r, "member_id"); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	if f.RoleID, err = httpx.QueryInt64(r, "role_id"); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid role_id")
+		return
+	}
+	items, err := h.Repo.ListAssignments(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list assignments")
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+type assignReq struct {
+	MemberID int64      `json:"member_id"`
+	RoleID   int64      `json:"role_id"`
+	Role     string     `json:"role"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Note     string     `json:"note"`
+}
+
+// CreateAssignment handles POST /api/rbac/assignments. The role is given
+// by role_id or role (its name). starts_at defaults to now; without ends_at
+// the role is held until revoked.
+// Body: {"member_id":3,"role":"secretary","starts_at":"2026-01-01T00:00:00Z","ends_at":"2027-01-01T00:00:00Z","note":"Elected at the 2025 AGM"}
+func (h Handlers) CreateAssignment(w http.ResponseWriter, r *http.Request) {
+	var req assignReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	ctx, now := r.Context(), h.now()
+	a := Assignment{MemberID: req.MemberID, StartsAt: now, EndsAt: req.EndsAt, Note: strings.TrimSpace(req.Note)}
+	if req.StartsAt != nil {
+		a.StartsAt = *req.StartsAt
+	}
+	if a.EndsAt != nil && (!a.EndsAt.After(a.StartsAt) || !a.EndsAt.After(now)) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "ends_at must be after starts_at and in the future")
+		return
+	}
+	if len(a.Note) > 500 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "note must be at most 500 characters")
+		return
+	}
+	var role Role
+	var err error
+	switch {
+	case req.RoleID > 0:
+		role, err = h.Repo.GetRole(ctx, req.RoleID)
+	case req.Role != "":
+		role, err = h.Repo.RoleByName(ctx, req.Role)
+	default:
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "role_id or role required")
+		return
+	}
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "role not found")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load role")
+		return
+	}
+	base, found, err := h.Repo.MemberRole(ctx, a.MemberID)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load member")
+		return
+	}
+	if !found {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "member not found")
+		return
+	}
+	if base == role.Name {
+		httpmw.WriteJSONError(w, http.StatusConflict, "that is the member's base role")
+		return
+	}
+	if !checkGrant(w, r, role.Permissions) {
+		return
+	}
+	held, err := h.Repo.ListAssignments(ctx, AssignmentFilters{MemberID: &a.MemberID, RoleID: &role.ID, Now: now})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to check assignments")
+		return
+	}
+	for _, x := range held {
+		if x.overlaps(a.StartsAt, a.EndsAt) {
+			httpmw.WriteJSONError(w, http.StatusConflict, "member already holds that role during this period")
+			return
+		}
+	}
+	p, _ := httpmw.FromContext(ctx)
+	a.RoleID, a.GrantedBy = role.ID, &p.MemberID
+	out, err := h.Repo.CreateAssignment(ctx, a)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to assign role")
+		return
+	}
+	writeJSON(w, http.StatusCreated, out)
+}
+
+// RevokeAssignment handles DELETE /api/rbac/assignments/{id}, ending the
+// assignment at once.
+func (h Handlers) RevokeAssignment(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	a, err := h.Repo.GetAssignment(ctx, id)
+	var role Role
+	if err == nil {
+		role, err = h.Repo.GetRole(ctx, a.RoleID)
+	}
+	if err == ErrNotFound {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "assignment not found")
+		return
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to load assignment")
+		return
+	}
+	if !checkGrant(w, r, role.Permissions) {
+		return
+	}
+	p, _ := httpmw.FromContext(ctx)
+	switch err := h.Repo.RevokeAssignment(ctx, id, p.MemberID, h.now()); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrNotFound:
+		httpmw.WriteJSONError(w, http.StatusNotFound, "assignment not found")
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to revoke assignment")
+	}
+}
+
+// MemberAccess handles GET /api/rbac/members/{id}: the member's roles and
+// permissions now, or at ?at=RFC3339.
+func (h Handlers) MemberAccess(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	at := h.now()
+	if s := r.URL.Query().Get("at"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid at")
+			return
+		}
+		at = t
+	}
+	ctx := r.Context()
+	base, found, err := h.Repo.MemberRole(ctx, id)
+	if err == nil && !found {
+		httpmw.WriteJSONError(w, http.StatusNotFound, "member not found")
+		return
+	}
+	var e Effective
+	if err == nil {
+		e, err = h.Repo.Effective(ctx, id, base, at)
+	}
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to resolve access")
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
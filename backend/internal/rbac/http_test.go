@@ -0,0 +1,387 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	roles       []*Role
+	assignments []*Assignment
+	members     map[int64]string
+}
+
+func newRepo() *mockRepo {
+	m := &mockRepo{members: map[int64]string{1: "admin", 2: "treasurer", 3: "member", 4: "member"}}
+	for name, perms := range httpmw.DefaultRolePermissions {
+		m.roles = append(m.roles, &Role{Name: name, Permissions: perms, System: true})
+	}
+	sort.Slice(m.roles, func(i, j int) bool { return m.roles[i].Name < m.roles[j].Name })
+	for i, r := range m.roles {
+		r.ID = int64(i + 1)
+	}
+	return m
+}
+
+func (m *mockRepo) ListRoles(_ context.Context) ([]Role, error) {
+	out := []Role{}
+	for _, r := range m.roles {
+		out = append(out, *r)
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetRole(_ context.Context, id int64) (Role, error) {
+	for _, r := range m.roles {
+		if r.ID == id {
+			return *r, nil
+		}
+	}
+	return Role{}, ErrNotFound
+}
+
+func (m *mockRepo) RoleByName(_ context.Context, name string) (Role, error) {
+	for _, r := range m.roles {
+		if r.Name == name {
+			return *r, nil
+		}
+	}
+	return Role{}, ErrNotFound
+}
+
+func (m *mockRepo) CreateRole(_ context.Context, r Role) (Role, error) {
+	if _, err := m.RoleByName(context.Background(), r.Name); err == nil {
+		return Role{}, ErrNameTaken
+	}
+	r.ID = int64(len(m.roles) + 1)
+	m.roles = append(m.roles, &r)
+	return r, nil
+}
+
+func (m *mockRepo) UpdateRole(_ context.Context, r Role) (Role, error) {
+	for _, x := range m.roles {
+		if x.Name == r.Name && x.ID != r.ID {
+			return Role{}, ErrNameTaken
+		}
+	}
+	for _, x := range m.roles {
+		if x.ID == r.ID {
+			r.System = x.System
+			*x = r
+			return r, nil
+		}
+	}
+	return Role{}, ErrNotFound
+}
+
+func (m *mockRepo) DeleteRole(_ context.Context, id int64, now time.Time) error {
+	for _, a := range m.assignments {
+		if a.RoleID == id && a.RevokedAt == nil && (a.EndsAt == nil || a.EndsAt.After(now)) {
+			return ErrInUse
+		}
+	}
+	for i, r := range m.roles {
+		if r.ID == id && !r.System {
+			m.roles = append(m.roles[:i], m.roles[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepo) ListAssignments(_ context.Context, f AssignmentFilters) ([]Assignment, error) {
+	out := []Assignment{}
+	for _, a := range m.assignments {
+		if f.MemberID != nil && a.MemberID != *f.MemberID || f.RoleID != nil && a.RoleID != *f.RoleID {
+			continue
+		}
+		if !f.IncludeInactive && (a.RevokedAt != nil || (a.EndsAt != nil && !a.EndsAt.After(f.Now))) {
+			continue
+		}
+		out = append(out, *a)
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetAssignment(_ context.Context, id int64) (Assignment, error) {
+	for _, a := range m.assignments {
+		if a.ID == id {
+			return *a, nil
+		}
+	}
+	return Assignment{}, ErrNotFound
+}
+
+func (m *mockRepo) CreateAssignment(ctx context.Context, a Assignment) (Assignment, error) {
+	role, _ := m.GetRole(ctx, a.RoleID)
+	a.ID, a.Role = int64(len(m.assignments)+1), role.Name
+	m.assignments = append(m.assignments, &a)
+	return a, nil
+}
+
+func (m *mockRepo) RevokeAssignment(_ context.Context, id, by int64, at time.Time) error {
+	for _, a := range m.assignments {
+		if a.ID == id && a.RevokedAt == nil {
+			a.RevokedAt, a.RevokedBy = &at, &by
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *mockRepo) MemberRole(_ context.Context, id int64) (string, bool, error) {
+	role, ok := m.members[id]
+	return role, ok, nil
+}
+
+func (m *mockRepo) Effective(ctx context.Context, memberID int64, baseRole string, t time.Time) (Effective, error) {
+	var held []Role
+	if r, err := m.RoleByName(ctx, baseRole); err == nil {
+		held = append(held, r)
+	}
+	for _, a := range m.assignments {
+		if a.MemberID == memberID && a.Active(t) {
+			r, _ := m.GetRole(ctx, a.RoleID)
+			held = append(held, r)
+		}
+	}
+	return resolve(memberID, baseRole, t, held), nil
+}
+
+// ---- Helpers ----
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// setupRouter resolves principals the way the server does, through
+// Effective, and adds a route guarded by announcements.publish.
+func setupRouter(repo *mockRepo) (*chi.Mux, *clock) {
+	clk := &clock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role, ok := repo.members[id]
+		if !ok {
+			return httpmw.Principal{}, false, nil
+		}
+		e, err := repo.Effective(ctx, id, role, clk.now())
+		return httpmw.Principal{MemberID: id, Role: role, Roles: e.Roles, Permissions: e.Permissions}, true, err
+	}))
+	Mount(r, Handlers{Repo: repo, Now: clk.now})
+	r.With(httpmw.RequirePermission("announcements.publish")).Post("/announcements", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	return r, clk
+}
+
+func do(r http.Handler, user int64, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-Id", strconv.FormatInt(user, 10))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+// ---- Tests ----
+
+func TestPrincipal_DefaultsAndRequireRole(t *testing.T) {
+	admin := httpmw.Principal{MemberID: 1, Role: "admin"}
+	treasurer := httpmw.Principal{MemberID: 2, Role: "treasurer"}
+	member := httpmw.Principal{MemberID: 3, Role: "member", Roles: []string{"member", "secretary"}, Permissions: []string{"announcements.publish"}}
+	guest := httpmw.Principal{Role: "guest"}
+	if !admin.Can("roles.manage") || !treasurer.Can("payments.view") || treasurer.Can("payments.manage") {
+		t.Fatalf("default role permissions wrong")
+	}
+	if !member.Can("announcements.publish") || member.Can("budgets.manage") || guest.Can("announcements.publish") {
+		t.Fatalf("loaded permissions wrong")
+	}
+	if !member.HasRole("secretary") || !member.HasRole("member") || admin.HasRole("secretary") {
+		t.Fatalf("HasRole wrong")
+	}
+
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(_ context.Context, id int64) (httpmw.Principal, bool, error) {
+		return member, id == 3, nil
+	}))
+	r.With(httpmw.RequireRole("secretary")).Get("/minutes", func(w http.ResponseWriter, r *http.Request) {})
+	if rr := do(r, 3, "GET", "/minutes", ""); rr.Code != http.StatusOK {
+		t.Fatalf("assigned role refused by RequireRole: %d", rr.Code)
+	}
+}
+
+func TestRoles_CreateUpdateDelete(t *testing.T) {
+	repo := newRepo()
+	r, _ := setupRouter(repo)
+
+	if rr := do(r, 2, "GET", "/rbac/roles", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("treasurer listed roles: %d", rr.Code)
+	}
+	rr := do(r, 1, "GET", "/rbac/permissions", "")
+	var catalog []Permission
+	_ = json.Unmarshal(rr.Body.Bytes(), &catalog)
+	if rr.Code != http.StatusOK || len(catalog) != len(httpmw.Permissions) || catalog[0].Name != "announcements.publish" {
+		t.Fatalf("permissions: %d %s", rr.Code, rr.Body.String())
+	}
+
+	for _, body := range []string{
+		`{"name":"Secretary","permissions":[]}`,
+		`{"name":"guest","permissions":[]}`,
+		`{"name":"secretary","permissions":["minutes.write"]}`,
+	} {
+		if rr := do(r, 1, "POST", "/rbac/roles", body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+	rr = do(r, 1, "POST", "/rbac/roles", `{"name":"secretary","description":"Keeps the minutes","permissions":["announcements.publish","announcements.publish","audit.read"]}`)
+	var sec Role
+	_ = json.Unmarshal(rr.Body.Bytes(), &sec)
+	if rr.Code != http.StatusCreated || strings.Join(sec.Permissions, ",") != "announcements.publish,audit.read" || sec.System {
+		t.Fatalf("create: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, 1, "POST", "/rbac/roles", `{"name":"secretary"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate: %d", rr.Code)
+	}
+	secPath := "/rbac/roles/" + strconv.FormatInt(sec.ID, 10)
+	if rr := do(r, 1, "PUT", secPath, `{"name":"clerk","permissions":["announcements.publish"]}`); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"clerk"`) {
+		t.Fatalf("update: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// System roles keep their names, and admin keeps everything.
+	admin, _ := repo.RoleByName(context.Background(), "admin")
+	adminPath := "/rbac/roles/" + strconv.FormatInt(admin.ID, 10)
+	if rr := do(r, 1, "PUT", adminPath, `{"name":"root","permissions":["*"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("renamed admin: %d", rr.Code)
+	}
+	if rr := do(r, 1, "PUT", adminPath, `{"name":"admin","permissions":["audit.read"]}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("narrowed admin: %d", rr.Code)
+	}
+	treasurer, _ := repo.RoleByName(context.Background(), "treasurer")
+	if rr := do(r, 1, "PUT", "/rbac/roles/"+strconv.FormatInt(treasurer.ID, 10), `{"name":"treasurer","permissions":["payments.view","payments.manage"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("edit treasurer: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, 1, "DELETE", adminPath, ""); rr.Code != http.StatusBadRequest {
+		t.Fatalf("deleted system role: %d", rr.Code)
+	}
+
+	// Roles in use cannot be deleted until their assignments are revoked.
+	rr = do(r, 1, "POST", "/rbac/assignments", `{"member_id":3,"role":"clerk"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("assign: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, 1, "DELETE", secPath, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("deleted role in use: %d", rr.Code)
+	}
+	if rr := do(r, 1, "DELETE", "/rbac/assignments/1", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", rr.Code)
+	}
+	if rr := do(r, 1, "DELETE", secPath, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAssignments_TimeBoundedAccess(t *testing.T) {
+	repo := newRepo()
+	r, clk := setupRouter(repo)
+	do(r, 1, "POST", "/rbac/roles", `{"name":"secretary","permissions":["announcements.publish"]}`)
+
+	if rr := do(r, 3, "POST", "/announcements", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("member published: %d", rr.Code)
+	}
+	for _, body := range []string{
+		`{"member_id":3}`,
+		`{"member_id":3,"role":"chair"}`,
+		`{"member_id":99,"role":"secretary"}`,
+		`{"member_id":3,"role":"secretary","starts_at":"2026-04-01T00:00:00Z","ends_at":"2026-03-15T00:00:00Z"}`,
+		`{"member_id":3,"role":"secretary","ends_at":"2026-02-01T00:00:00Z"}`,
+	} {
+		if rr := do(r, 1, "POST", "/rbac/assignments", body); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := do(r, 1, "POST", "/rbac/assignments", `{"member_id":2,"role":"treasurer"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("assigned base role: %d", rr.Code)
+	}
+
+	// A term from next week for a month.
+	rr := do(r, 1, "POST", "/rbac/assignments", `{"member_id":3,"role":"secretary","starts_at":"2026-03-08T00:00:00Z","ends_at":"2026-04-08T00:00:00Z","note":"Elected at the AGM"}`)
+	var term Assignment
+	_ = json.Unmarshal(rr.Body.Bytes(), &term)
+	if rr.Code != http.StatusCreated || term.Role != "secretary" || term.GrantedBy == nil || *term.GrantedBy != 1 {
+		t.Fatalf("assign: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, 1, "POST", "/rbac/assignments", `{"member_id":3,"role":"secretary","starts_at":"2026-04-01T00:00:00Z"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("overlapping assignment: %d", rr.Code)
+	}
+	if rr := do(r, 3, "POST", "/announcements", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("published before the term: %d", rr.Code)
+	}
+	rr = do(r, 1, "GET", "/rbac/members/3?at=2026-03-10T00:00:00Z", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"roles":["member","secretary"],"permissions":["announcements.publish"]`) {
+		t.Fatalf("access during term: %d %s", rr.Code, rr.Body.String())
+	}
+
+	clk.t = time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	if rr := do(r, 3, "POST", "/announcements", ""); rr.Code != http.StatusCreated {
+		t.Fatalf("secretary refused during term: %d", rr.Code)
+	}
+	clk.t = time.Date(2026, 4, 8, 0, 0, 0, 0, time.UTC)
+	if rr := do(r, 3, "POST", "/announcements", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("published after the term: %d", rr.Code)
+	}
+	if rr := do(r, 1, "GET", "/rbac/assignments?member_id=3", ""); rr.Body.String() != "[]\n" {
+		t.Fatalf("ended assignment listed: %s", rr.Body.String())
+	}
+	if rr := do(r, 1, "GET", "/rbac/assignments?member_id=3&include_inactive=true", ""); !strings.Contains(rr.Body.String(), "Elected at the AGM") {
+		t.Fatalf("include_inactive: %s", rr.Body.String())
+	}
+
+	// Revocation takes effect on the next request.
+	rr = do(r, 1, "POST", "/rbac/assignments", `{"member_id":4,"role":"secretary"}`)
+	_ = json.Unmarshal(rr.Body.Bytes(), &term)
+	if rr := do(r, 4, "POST", "/announcements", ""); rr.Code != http.StatusCreated {
+		t.Fatalf("open-ended assignment: %d", rr.Code)
+	}
+	if rr := do(r, 1, "DELETE", "/rbac/assignments/"+strconv.FormatInt(term.ID, 10), ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d", rr.Code)
+	}
+	if rr := do(r, 4, "POST", "/announcements", ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("revoked assignment still works: %d", rr.Code)
+	}
+}
+
+func TestAssignments_NoEscalation(t *testing.T) {
+	repo := newRepo()
+	r, _ := setupRouter(repo)
+	do(r, 1, "POST", "/rbac/roles", `{"name":"membership","permissions":["roles.manage","announcements.publish"]}`)
+	do(r, 1, "POST", "/rbac/assignments", `{"member_id":3,"role":"membership"}`)
+
+	// Member 3 manages roles but cannot grant what they do not hold.
+	if rr := do(r, 3, "POST", "/rbac/roles", `{"name":"superuser","permissions":["*"]}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("created wildcard role: %d", rr.Code)
+	}
+	if rr := do(r, 3, "POST", "/rbac/assignments", `{"member_id":3,"role":"admin"}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("self-assigned admin: %d", rr.Code)
+	}
+	treasurer, _ := repo.RoleByName(context.Background(), "treasurer")
+	if rr := do(r, 3, "PUT", "/rbac/roles/"+strconv.FormatInt(treasurer.ID, 10), `{"name":"treasurer","permissions":[]}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("stripped treasurer: %d", rr.Code)
+	}
+	if rr := do(r, 3, "POST", "/rbac/roles", `{"name":"comms","permissions":["announcements.publish"]}`); rr.Code != http.StatusCreated {
+		t.Fatalf("create within own permissions: %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(r, 3, "POST", "/rbac/assignments", `{"member_id":4,"role":"comms"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("assign within own permissions: %d %s", rr.Code, rr.Body.String())
+	}
+}
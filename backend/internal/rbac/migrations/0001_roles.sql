@@ -0,0 +1,36 @@
+-- backend/internal/rbac/migrations/0001_roles.sql
+-- Roles are named permission sets. members.role stays each member's base
+-- role (admin, treasurer or member); further roles, such as secretary or
+-- a committee chair, are assigned on top of it, optionally for a period.
+CREATE TABLE IF NOT EXISTS rbac_roles (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  description TEXT NOT NULL DEFAULT '',
+  permissions TEXT[] NOT NULL DEFAULT '{}',
+  system BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- The base roles, matching httpmw.DefaultRolePermissions.
+INSERT INTO rbac_roles (name, description, permissions, system) VALUES
+  ('admin', 'Full access', '{*}', true),
+  ('treasurer', 'Finance officer', '{capital.view,hours.reports,invoices.manage,payments.view,reimbursements.approve}', true),
+  ('member', 'Every member', '{}', true)
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS rbac_role_assignments (
+  id BIGSERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id) ON DELETE CASCADE,
+  role_id BIGINT NOT NULL REFERENCES rbac_roles(id) ON DELETE CASCADE,
+  starts_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  ends_at TIMESTAMPTZ,
+  note TEXT NOT NULL DEFAULT '',
+  granted_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at TIMESTAMPTZ,
+  revoked_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  CONSTRAINT rbac_role_assignments_period_chk CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS rbac_role_assignments_member_idx ON rbac_role_assignments(member_id) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS rbac_role_assignments_role_idx ON rbac_role_assignments(role_id);
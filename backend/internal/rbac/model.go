@@ -0,0 +1,140 @@
+package rbac
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+)
+
+// Role is a named set of permissions. System roles are the base roles
+// members.role allows; they cannot be renamed or deleted, and admin always
+// holds every permission.
+type Role struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	System      bool      `json:"system"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Assignment grants a role to a member from StartsAt until EndsAt, or
+// until revoked when EndsAt is nil.
+type Assignment struct {
+	ID        int64      `json:"id"`
+	MemberID  int64      `json:"member_id"`
+	RoleID    int64      `json:"role_id"`
+	Role      string     `json:"role"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    *time.Time `json:"ends_at"`
+	Note      string     `json:"note"`
+	GrantedBy *int64     `json:"granted_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	RevokedBy *int64     `json:"revoked_by"`
+}
+
+// Active reports whether a grants its role at t.
+func (a Assignment) Active(t time.Time) bool {
+	return a.RevokedAt == nil && !t.Before(a.StartsAt) && (a.EndsAt == nil || t.Before(*a.EndsAt))
+}
+
+// overlaps reports whether a covers any part of [start, end); a nil end is
+// open-ended.
+func (a Assignment) overlaps(start time.Time, end *time.Time) bool {
+	if a.RevokedAt != nil {
+		return false
+	}
+	return (a.EndsAt == nil || start.Before(*a.EndsAt)) && (end == nil || a.StartsAt.Before(*end))
+}
+
+// AssignmentFilters holds optional constraints for listing assignments.
+// Without IncludeInactive only assignments active or starting later are
+// listed.
+type AssignmentFilters struct {
+	MemberID        *int64
+	RoleID          *int64
+	IncludeInactive bool
+	Now             time.Time
+}
+
+// Effective is what a member may do at a point in time: their base role,
+// every role they hold and the union of those roles' permissions.
+type Effective struct {
+	MemberID    int64     `json:"member_id"`
+	Role        string    `json:"role"`
+	Roles       []string  `json:"roles"`
+	Permissions []string  `json:"permissions"`
+	At          time.Time `json:"at"`
+}
+
+// Permission describes one grantable permission.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Catalog lists httpmw.Permissions sorted by name.
+func Catalog() []Permission {
+	out := make([]Permission, 0, len(httpmw.Permissions))
+	for name, desc := range httpmw.Permissions {
+		out = append(out, Permission{Name: name, Description: desc})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+var roleName = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,39}$`)
+
+// ValidName reports whether s is a usable role name: 2 to 40 lower-case
+// letters, digits, '-' or '_', starting with a letter.
+func ValidName(s string) bool {
+	return roleName.MatchString(s) && s != "guest"
+}
+
+// normalizePermissions sorts and dedupes perms; bad is the first unknown
+// permission, if any. "*" absorbs everything else.
+func normalizePermissions(perms []string) (out []string, bad string) {
+	set := map[string]bool{}
+	for _, p := range perms {
+		if _, ok := httpmw.Permissions[p]; !ok && p != httpmw.AllPermissions {
+			return nil, p
+		}
+		set[p] = true
+	}
+	if set[httpmw.AllPermissions] {
+		return []string{httpmw.AllPermissions}, ""
+	}
+	out = []string{}
+	for p := range set {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out, ""
+}
+
+// resolve combines the base role and the roles held on top of it. The
+// base role comes first even when it has no rbac_roles row. Permissions no
+// longer in the catalog are ignored.
+func resolve(memberID int64, baseRole string, t time.Time, held []Role) Effective {
+	e := Effective{MemberID: memberID, Role: baseRole, Roles: []string{baseRole}, Permissions: []string{}, At: t}
+	seenRole := map[string]bool{baseRole: true}
+	var perms []string
+	for _, role := range held {
+		if !seenRole[role.Name] {
+			seenRole[role.Name] = true
+			e.Roles = append(e.Roles, role.Name)
+		}
+		for _, p := range role.Permissions {
+			if _, ok := httpmw.Permissions[p]; ok || p == httpmw.AllPermissions {
+				perms = append(perms, p)
+			}
+		}
+	}
+	e.Permissions, _ = normalizePermissions(perms)
+	sort.Strings(e.Roles[1:])
+	return e
+}
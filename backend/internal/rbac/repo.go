@@ -0,0 +1,234 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrNameTaken = errors.New("role name taken")
+	ErrInUse     = errors.New("role still assigned")
+)
+
+type Repo interface {
+	ListRoles(ctx context.Context) ([]Role, error)
+	GetRole(ctx context.Context, id int64) (Role, error)
+	RoleByName(ctx context.Context, name string) (Role, error)
+	// CreateRole and UpdateRole return ErrNameTaken for a duplicate name.
+	CreateRole(ctx context.Context, r Role) (Role, error)
+	UpdateRole(ctx context.Context, r Role) (Role, error)
+	// DeleteRole returns ErrInUse while the role has assignments that are
+	// active or yet to start; past assignments are deleted with it.
+	DeleteRole(ctx context.Context, id int64, now time.Time) error
+
+	ListAssignments(ctx context.Context, f AssignmentFilters) ([]Assignment, error)
+	GetAssignment(ctx context.Context, id int64) (Assignment, error)
+	CreateAssignment(ctx context.Context, a Assignment) (Assignment, error)
+	// RevokeAssignment returns ErrNotFound if the assignment is unknown or
+	// already revoked.
+	RevokeAssignment(ctx context.Context, id, by int64, at time.Time) error
+
+	// MemberRole returns a member's base role; found=false for no member.
+	MemberRole(ctx context.Context, memberID int64) (role string, found bool, err error)
+	// Effective resolves the roles and permissions memberID holds at t on
+	// top of baseRole.
+	Effective(ctx context.Context, memberID int64, baseRole string, t time.Time) (Effective, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const roleColumns = `id, name, description, permissions, system, created_at, updated_at`
+
+func scanRole(row pgx.Row) (Role, error) {
+	var r Role
+	err := row.Scan(&r.ID, &r.Name, &r.Description, &r.Permissions, &r.System, &r.CreatedAt, &r.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return Role{}, ErrNotFound
+	}
+	return r, err
+}
+
+// uniqueViolation maps a duplicate role name to ErrNameTaken.
+func uniqueViolation(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrNameTaken
+	}
+	return err
+}
+
+func (r *PgRepo) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT `+roleColumns+` FROM rbac_roles ORDER BY system DESC, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, role)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetRole(ctx context.Context, id int64) (Role, error) {
+	return scanRole(r.Pool.QueryRow(ctx, `SELECT `+roleColumns+` FROM rbac_roles WHERE id=$1`, id))
+}
+
+func (r *PgRepo) RoleByName(ctx context.Context, name string) (Role, error) {
+	return scanRole(r.Pool.QueryRow(ctx, `SELECT `+roleColumns+` FROM rbac_roles WHERE name=$1`, name))
+}
+
+func (r *PgRepo) CreateRole(ctx context.Context, role Role) (Role, error) {
+	out, err := scanRole(r.Pool.QueryRow(ctx, `
+INSERT INTO rbac_roles (name, description, permissions)
+VALUES ($1,$2,$3)
+RETURNING `+roleColumns, role.Name, role.Description, role.Permissions))
+	return out, uniqueViolation(err)
+}
+
+func (r *PgRepo) UpdateRole(ctx context.Context, role Role) (Role, error) {
+	out, err := scanRole(r.Pool.QueryRow(ctx, `
+UPDATE rbac_roles SET name=$2, description=$3, permissions=$4, updated_at=now()
+WHERE id=$1
+RETURNING `+roleColumns, role.ID, role.Name, role.Description, role.Permissions))
+	return out, uniqueViolation(err)
+}
+
+func (r *PgRepo) DeleteRole(ctx context.Context, id int64, now time.Time) error {
+	var inUse bool
+	if err := r.Pool.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM rbac_role_assignments
+WHERE role_id=$1 AND revoked_at IS NULL AND (ends_at IS NULL OR ends_at > $2))`, id, now).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+	tag, err := r.Pool.Exec(ctx, `DELETE FROM rbac_roles WHERE id=$1 AND NOT system`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const assignmentColumns = `a.id, a.member_id, a.role_id, r.name, a.starts_at, a.ends_at, a.note, a.granted_by, a.created_at, a.revoked_at, a.revoked_by`
+
+func scanAssignment(row pgx.Row) (Assignment, error) {
+	var a Assignment
+	err := row.Scan(&a.ID, &a.MemberID, &a.RoleID, &a.Role, &a.StartsAt, &a.EndsAt, &a.Note, &a.GrantedBy, &a.CreatedAt, &a.RevokedAt, &a.RevokedBy)
+	if err == pgx.ErrNoRows {
+		return Assignment{}, ErrNotFound
+	}
+	return a, err
+}
+
+func (r *PgRepo) ListAssignments(ctx context.Context, f AssignmentFilters) ([]Assignment, error) {
+	where := []string{"($1::bigint IS NULL OR a.member_id=$1)", "($2::bigint IS NULL OR a.role_id=$2)"}
+	args := []any{f.MemberID, f.RoleID}
+	if !f.IncludeInactive {
+		args = append(args, f.Now)
+		where = append(where, "a.revoked_at IS NULL", "(a.ends_at IS NULL OR a.ends_at > $"+strconv.Itoa(len(args))+")")
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT `+assignmentColumns+`
+FROM rbac_role_assignments a JOIN rbac_roles r ON r.id=a.role_id
+WHERE `+strings.Join(where, " AND ")+`
+ORDER BY a.member_id, a.starts_at, a.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Assignment{}
+	for rows.Next() {
+		a, err := scanAssignment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetAssignment(ctx context.Context, id int64) (Assignment, error) {
+	return scanAssignment(r.Pool.QueryRow(ctx, `
+SELECT `+assignmentColumns+`
+FROM rbac_role_assignments a JOIN rbac_roles r ON r.id=a.role_id
+WHERE a.id=$1`, id))
+}
+
+func (r *PgRepo) CreateAssignment(ctx context.Context, a Assignment) (Assignment, error) {
+	var id int64
+	if err := r.Pool.QueryRow(ctx, `
+INSERT INTO rbac_role_assignments (member_id, role_id, starts_at, ends_at, note, granted_by)
+VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id`, a.MemberID, a.RoleID, a.StartsAt, a.EndsAt, a.Note, a.GrantedBy).Scan(&id); err != nil {
+		return Assignment{}, err
+	}
+	return r.GetAssignment(ctx, id)
+}
+
+func (r *PgRepo) RevokeAssignment(ctx context.Context, id, by int64, at time.Time) error {
+	tag, err := r.Pool.Exec(ctx, `UPDATE rbac_role_assignments SET revoked_at=$3, revoked_by=$2 WHERE id=$1 AND revoked_at IS NULL`, id, by, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *PgRepo) MemberRole(ctx context.Context, memberID int64) (string, bool, error) {
+	var role string
+	err := r.Pool.QueryRow(ctx, `SELECT role FROM members WHERE id=$1`, memberID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", false, nil
+	}
+	return role, err == nil, err
+}
+
+func (r *PgRepo) Effective(ctx context.Context, memberID int64, baseRole string, t time.Time) (Effective, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT name, permissions FROM rbac_roles WHERE name=$2
+UNION ALL
+SELECT r.name, r.permissions
+FROM rbac_role_assignments a JOIN rbac_roles r ON r.id=a.role_id
+WHERE a.member_id=$1 AND a.revoked_at IS NULL AND a.starts_at <= $3 AND (a.ends_at IS NULL OR a.ends_at > $3)`, memberID, baseRole, t)
+	if err != nil {
+		return Effective{}, err
+	}
+	defer rows.Close()
+	var roles []Role
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role.Name, &role.Permissions); err != nil {
+			return Effective{}, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return Effective{}, err
+	}
+	return resolve(memberID, baseRole, t, roles), nil
+}
@@ -0,0 +1,23 @@
+package rbac
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequirePermission("roles.manage"))
+		r.Get("/permissions", h.ListPermissions)
+		r.Get("/roles", h.ListRoles)
+		r.Post("/roles", h.CreateRole)
+		r.Get("/roles/{id}", h.GetRole)
+		r.Put("/roles/{id}", h.UpdateRole)
+		r.Delete("/roles/{id}", h.DeleteRole)
+		r.Get("/assignments", h.ListAssignments)
+		r.Post("/assignments", h.CreateAssignment)
+		r.Delete("/assignments/{id}", h.RevokeAssignment)
+		r.Get("/members/{id}", h.MemberAccess)
+	}
+	r.Route("/rbac", route)
+}
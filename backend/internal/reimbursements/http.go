@@ -0,0 +1,371 @@
+package reimbursements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// LedgerPoster is the subset of ledger.Repo used to post approved expenses.
+type LedgerPoster interface {
+	Create(ctx context.Context, entryType, description string, amount float64, memberID *int32, notes string, idempotencyKey string) (ledger.LedgerEntry, bool, error)
+}
+
+type Handlers struct {
+	Repo   Repo
+	Ledger LedgerPoster
+}
+
+// isApprover reports whether p may review other members' requests.
+func isApprover(p httpmw.Principal) bool {
+	return p.Can("reimbursements.approve")
+}
+
+// List handles GET /api/reimbursements. Members only see their own
+// requests; approvers see all and may filter by member_id.
+// Query: status, member_id, limit, offset
+func (h Handlers) List(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	f := ListFilters{Status: r.URL.Query().Get("status")}
+	if f.Status != "" && !ValidStatus(f.Status) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	mid, err := httpx.QueryInt64(r, "member_id")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid member_id")
+		return
+	}
+	f.MemberID = mid
+	if !isApprover(p) {
+		f.MemberID = &p.MemberID
+	}
+	lim, off, err := httpx.ParseLimitOffset(r, 200)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid pagination")
+		return
+	}
+	f.Limit, f.Offset = lim, off
+	items, err := h.Repo.List(r.Context(), f)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Request{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Create handles POST /api/reimbursements
+// Body: {"amount":42.50,"description":"Paint for the shop","category":"supplies","incurred_on":"2025-03-01"}
+func (h Handlers) Create(w http.ResponseWriter, r *http.Request) {
+	p, _ := httpmw.FromContext(r.Context())
+	var in struct {
+		Amount      float64 `json:"amount"`
+		Description string  `json:"description"`
+		Category    string  `json:"category"`
+		IncurredOn  string  `json:"incurred_on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	in.Description = strings.TrimSpace(in.Description)
+	if in.Description == "" || in.IncurredOn == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "description and incurred_on required")
+		return
+	}
+	if in.Amount <= 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "amount must be positive")
+		return
+	}
+	incurred, err := httpx.ParseDate(in.IncurredOn)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid incurred_on")
+		return
+	}
+	if incurred.After(time.Now().UTC()) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "incurred_on must not be in the future")
+		return
+	}
+	req, err := h.Repo.Create(r.Context(), Request{MemberID: p.MemberID, Amount: in.Amount, Description: in.Description, Category: strings.TrimSpace(in.Category), IncurredOn: *incurred})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "insert failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// Get handles GET /api/reimbursements/{id} for the requester or an approver.
+func (h Handlers) Get(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.request(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if req.MemberID != p.MemberID && !isApprover(p) {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+// Cancel handles POST /api/reimbursements/{id}/cancel. Only the requester
+// may withdraw a request, and only before it is decided.
+func (h Handlers) Cancel(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.request(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if req.MemberID != p.MemberID {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	out, err := h.Repo.Cancel(r.Context(), req.ID)
+	writeResult(w, out, err, "request not submitted")
+}
+
+// Reject handles POST /api/reimbursements/{id}/reject (admin, treasurer)
+// Body: {"note":"Not a co-op expense"}
+func (h Handlers) Reject(w http.ResponseWriter, r *http.Request) {
+	req, note, ok := h.decision(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	out, err := h.Repo.Reject(r.Context(), req.ID, p.MemberID, note)
+	writeResult(w, out, err, "request not submitted")
+}
+
+// Approve handles POST /api/reimbursements/{id}/approve
+// (reimbursements.approve). Approvers other than admins may only approve up
+// to the highest limit among their roles. Approval posts the expense to the
+// ledger against the requester.
+// Body: {"note":"optional"}
+func (h Handlers) Approve(w http.ResponseWriter, r *http.Request) {
+	req, note, ok := h.decision(w, r)
+	if !ok {
+		return
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if !p.HasRole("admin") {
+		allowed := false
+		for _, role := range p.RoleNames() {
+			limit, found, err := h.Repo.GetLimit(r.Context(), role)
+			if err != nil {
+				httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+				return
+			}
+			if found && (limit.MaxAmount == nil || req.Amount <= *limit.MaxAmount) {
+				allowed = true
+			}
+		}
+		if !allowed {
+			httpmw.WriteJSONError(w, http.StatusForbidden, "amount exceeds approval limit")
+			return
+		}
+	}
+	approved, err := h.Repo.Approve(r.Context(), req.ID, p.MemberID, note)
+	if err != nil {
+		writeResult(w, approved, err, "request not submitted")
+		return
+	}
+	h.post(w, r, approved)
+}
+
+// PostToLedger handles POST /api/reimbursements/{id}/post (admin,
+// treasurer). It retries the ledger posting for an approved request whose
+// posting failed; posted requests are returned unchanged.
+func (h Handlers) PostToLedger(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.request(w, r)
+	if !ok {
+		return
+	}
+	if req.Status != StatusApproved && req.Status != StatusPaid {
+		httpmw.WriteJSONError(w, http.StatusConflict, "request not approved")
+		return
+	}
+	if req.LedgerEntryID != nil {
+		writeJSON(w, http.StatusOK, req)
+		return
+	}
+	h.post(w, r, req)
+}
+
+// Pay handles POST /api/reimbursements/{id}/pay (admin, treasurer)
+// Body: {"method":"bank_transfer","reference":"TX-991","paid_on":"2025-03-05"}
+// paid_on defaults to now.
+func (h Handlers) Pay(w http.ResponseWriter, r *http.Request) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return
+	}
+	var in struct {
+		Method    string `json:"method"`
+		Reference string `json:"reference"`
+		PaidOn    string `json:"paid_on"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	in.Method = strings.TrimSpace(in.Method)
+	if in.Method == "" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "method required")
+		return
+	}
+	paidAt := time.Now().UTC()
+	if in.PaidOn != "" {
+		d, err := httpx.ParseDate(in.PaidOn)
+		if err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid paid_on")
+			return
+		}
+		paidAt = *d
+	}
+	out, err := h.Repo.MarkPaid(r.Context(), id, paidAt, in.Method, strings.TrimSpace(in.Reference))
+	writeResult(w, out, err, "request not approved and posted")
+}
+
+// ListLimits handles GET /api/reimbursements/limits (admin, treasurer)
+func (h Handlers) ListLimits(w http.ResponseWriter, r *http.Request) {
+	items, err := h.Repo.ListLimits(r.Context())
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "failed to list")
+		return
+	}
+	if items == nil {
+		items = []Limit{}
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// SetLimit handles PUT /api/reimbursements/limits/{role}
+// (reimbursements.limits). Any approving role may have a limit, e.g.
+// treasurer or a custom finance role; admins are never limited.
+// Body: {"max_amount":500} or {"max_amount":null} for unlimited
+func (h Handlers) SetLimit(w http.ResponseWriter, r *http.Request) {
+	role := chi.URLParam(r, "role")
+	if role == "admin" || role == "member" || role == "guest" {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "limits apply to approving roles other than admin")
+		return
+	}
+	var in struct {
+		MaxAmount *float64 `json:"max_amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if in.MaxAmount != nil && *in.MaxAmount < 0 {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "max_amount must not be negative")
+		return
+	}
+	out, err := h.Repo.SetLimit(r.Context(), Limit{Role: role, MaxAmount: in.MaxAmount})
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// post creates the ledger expense for an approved request. The idempotency
+// key makes retries return the original entry.
+func (h Handlers) post(w http.ResponseWriter, r *http.Request, req Request) {
+	mid := int32(req.MemberID)
+	notes := "Reimbursement #" + strconv.Itoa(int(req.ID))
+	if req.Category != "" {
+		notes += " (" + req.Category + ")"
+	}
+	entry, _, err := h.Ledger.Create(r.Context(), "expense", req.Description, -req.Amount, &mid, notes, "reimbursement:"+strconv.Itoa(int(req.ID)))
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "approved but ledger post failed; retry with POST /api/reimbursements/"+strconv.Itoa(int(req.ID))+"/post")
+		return
+	}
+	out, err := h.Repo.SetLedgerEntry(r.Context(), req.ID, entry.ID)
+	writeResult(w, out, err, "request not approved")
+}
+
+// decision loads a submitted request for an approver and reads the optional
+// note. Approvers may not decide their own requests.
+func (h Handlers) decision(w http.ResponseWriter, r *http.Request) (Request, string, bool) {
+	req, ok := h.request(w, r)
+	if !ok {
+		return Request{}, "", false
+	}
+	var in struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid json")
+			return Request{}, "", false
+		}
+	}
+	p, _ := httpmw.FromContext(r.Context())
+	if req.MemberID == p.MemberID {
+		httpmw.WriteJSONError(w, http.StatusForbidden, "cannot decide your own request")
+		return Request{}, "", false
+	}
+	if req.Status != StatusSubmitted {
+		httpmw.WriteJSONError(w, http.StatusConflict, "request not submitted")
+		return Request{}, "", false
+	}
+	return req, strings.TrimSpace(in.Note), true
+}
+
+func (h Handlers) request(w http.ResponseWriter, r *http.Request) (Request, bool) {
+	id, ok := requestID(w, r)
+	if !ok {
+		return Request{}, false
+	}
+	req, err := h.Repo.Get(r.Context(), id)
+	if err != nil {
+		if err == ErrNotFound {
+			httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+			return Request{}, false
+		}
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "query failed")
+		return Request{}, false
+	}
+	return req, true
+}
+
+func writeResult(w http.ResponseWriter, req Request, err error, conflict string) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, req)
+	case errors.Is(err, ErrNotFound):
+		httpmw.WriteJSONError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, ErrConflict):
+		httpmw.WriteJSONError(w, http.StatusConflict, conflict)
+	default:
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "update failed")
+	}
+}
+
+func requestID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id64, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid id")
+		return 0, false
+	}
+	return int32(id64), true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
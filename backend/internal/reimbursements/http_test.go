@@ -0,0 +1,315 @@
+package reimbursements
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/ledger"
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type mockRepo struct {
+	items  []Request
+	limits map[string]*float64
+}
+
+func (m *mockRepo) List(_ context.Context, f ListFilters) ([]Request, error) {
+	var out []Request
+	for _, r := range m.items {
+		if (f.MemberID == nil || r.MemberID == *f.MemberID) && (f.Status == "" || r.Status == f.Status) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *mockRepo) Get(_ context.Context, id int32) (Request, error) {
+	if id < 1 || int(id) > len(m.items) {
+		return Request{}, ErrNotFound
+	}
+	return m.items[id-1], nil
+}
+
+func (m *mockRepo) Create(_ context.Context, r Request) (Request, error) {
+	r.ID = int32(len(m.items) + 1)
+	r.Status = StatusSubmitted
+	r.CreatedAt = time.Now()
+	m.items = append(m.items, r)
+	return r, nil
+}
+
+func (m *mockRepo) transition(id int32, from []string, apply func(*Request)) (Request, error) {
+	if id < 1 || int(id) > len(m.items) {
+		return Request{}, ErrNotFound
+	}
+	r := &m.items[id-1]
+	for _, s := range from {
+		if r.Status == s {
+			apply(r)
+			return *r, nil
+		}
+	}
+	return Request{}, ErrConflict
+}
+
+func (m *mockRepo) Cancel(_ context.Context, id int32) (Request, error) {
+	return m.transition(id, []string{StatusSubmitted}, func(r *Request) { r.Status = StatusCancelled })
+}
+
+func (m *mockRepo) Reject(_ context.Context, id int32, by int64, note string) (Request, error) {
+	return m.transition(id, []string{StatusSubmitted}, func(r *Request) {
+		r.Status, r.DecidedBy, r.DecisionNote = StatusRejected, &by, note
+	})
+}
+
+func (m *mockRepo) Approve(_ context.Context, id int32, by int64, note string) (Request, error) {
+	return m.transition(id, []string{StatusSubmitted}, func(r *Request) {
+		r.Status, r.DecidedBy, r.DecisionNote = StatusApproved, &by, note
+	})
+}
+
+func (m *mockRepo) SetLedgerEntry(_ context.Context, id int32, entryID int32) (Request, error) {
+	return m.transition(id, []string{StatusApproved, StatusPaid}, func(r *Request) { r.LedgerEntryID = &entryID })
+}
+
+func (m *mockRepo) MarkPaid(_ context.Context, id int32, paidAt time.Time, method, reference string) (Request, error) {
+	if id >= 1 && int(id) <= len(m.items) && m.items[id-1].LedgerEntryID == nil {
+		return Request{}, ErrConflict
+	}
+	return m.transition(id, []string{StatusApproved}, func(r *Request) {
+		r.Status, r.PaidAt, r.PayoutMethod, r.PayoutReference = StatusPaid, &paidAt, method, reference
+	})
+}
+
+func (m *mockRepo) ListLimits(_ context.Context) ([]Limit, error) {
+	var out []Limit
+	for role, max := range m.limits {
+		out = append(out, Limit{Role: role, MaxAmount: max})
+	}
+	return out, nil
+}
+
+func (m *mockRepo) GetLimit(_ context.Context, role string) (Limit, bool, error) {
+	max, ok := m.limits[role]
+	return Limit{Role: role, MaxAmount: max}, ok, nil
+}
+
+func (m *mockRepo) SetLimit(_ context.Context, l Limit) (Limit, error) {
+	m.limits[l.Role] = l.MaxAmount
+	return l, nil
+}
+
+type mockLedger struct {
+	entries map[string]ledger.LedgerEntry
+	fail    bool
+}
+
+func (m *mockLedger) Create(_ context.Context, entryType, description string, amount float64, memberID *int32, notes string, key string) (ledger.LedgerEntry, bool, error) {
+	if m.fail {
+		return ledger.LedgerEntry{}, false, errors.New("db down")
+	}
+	if e, ok := m.entries[key]; ok {
+		return e, false, nil
+	}
+	e := ledger.LedgerEntry{ID: int32(len(m.entries) + 100), Type: entryType, Description: description, Amount: amount, MemberID: memberID, Notes: notes}
+	m.entries[key] = e
+	return e, true, nil
+}
+
+// ---- Helper functions ----
+
+// Member 1 is an admin, 2 a treasurer, everyone else a member.
+func setupRouter(repo *mockRepo, led *mockLedger) *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+		role := "member"
+		switch id {
+		case 1:
+			role = "admin"
+		case 2:
+			role = "treasurer"
+		}
+		return httpmw.Principal{MemberID: id, Role: role}, true, nil
+	}))
+	Mount(r, Handlers{Repo: repo, Ledger: led})
+	return r
+}
+
+func newMocks() (*mockRepo, *mockLedger) {
+	max := 500.0
+	return &mockRepo{limits: map[string]*float64{"treasurer": &max}}, &mockLedger{entries: map[string]ledger.LedgerEntry{}}
+}
+
+func do(r http.Handler, method, path string, user int64, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if user != 0 {
+		req.Header.Set("X-User-Id", strconv.FormatInt(user, 10))
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func submit(t *testing.T, r http.Handler, user int64, amount string) Request {
+	t.Helper()
+	rr := do(r, "POST", "/reimbursements", user, `{"amount":`+amount+`,"description":"Paint","category":"supplies","incurred_on":"2025-03-01"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var req Request
+	_ = json.Unmarshal(rr.Body.Bytes(), &req)
+	return req
+}
+
+// ---- Tests ----
+
+func TestHandlers_CreateValidation(t *testing.T) {
+	repo, led := newMocks()
+	r := setupRouter(repo, led)
+
+	if rr := do(r, "POST", "/reimbursements", 0, `{}`); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", rr.Code)
+	}
+	for _, body := range []string{
+		`{"amount":0,"description":"x","incurred_on":"2025-03-01"}`,
+		`{"amount":10,"description":" ","incurred_on":"2025-03-01"}`,
+		`{"amount":10,"description":"x","incurred_on":"03/01/2025"}`,
+		`{"amount":10,"description":"x","incurred_on":"2999-01-01"}`,
+	} {
+		if rr := do(r, "POST", "/reimbursements", 5, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rr.Code)
+		}
+	}
+}
+
+func TestHandlers_ApproveAndPay(t *testing.T) {
+	repo, led := newMocks()
+	r := setupRouter(repo, led)
+	req := submit(t, r, 5, "42.50")
+
+	// other members can't see or decide it
+	if rr := do(r, "GET", "/reimbursements/1", 6, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/reimbursements/1/approve", 6, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	// list is scoped to the caller for members
+	var list []Request
+	_ = json.Unmarshal(do(r, "GET", "/reimbursements", 6, "").Body.Bytes(), &list)
+	if len(list) != 0 {
+		t.Fatalf("expected empty list, got %d", len(list))
+	}
+
+	// paying before approval conflicts
+	if rr := do(r, "POST", "/reimbursements/1/pay", 2, `{"method":"bank_transfer"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	rr := do(r, "POST", "/reimbursements/1/approve", 2, `{"note":"ok"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &req)
+	if req.Status != StatusApproved || req.LedgerEntryID == nil || *req.DecidedBy != 2 {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	e := led.entries["reimbursement:1"]
+	if e.Amount != -42.5 || e.Type != "expense" || *e.MemberID != 5 {
+		t.Fatalf("unexpected ledger entry: %+v", e)
+	}
+
+	// approving twice conflicts
+	if rr := do(r, "POST", "/reimbursements/1/approve", 1, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	rr = do(r, "POST", "/reimbursements/1/pay", 2, `{"method":"bank_transfer","reference":"TX-1","paid_on":"2025-03-05"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &req)
+	if req.Status != StatusPaid || req.PayoutReference != "TX-1" || req.PaidAt.Format("2006-01-02") != "2025-03-05" {
+		t.Fatalf("unexpected paid request: %+v", req)
+	}
+	if rr := do(r, "GET", "/reimbursements/1", 5, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected requester to read, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_ApprovalLimits(t *testing.T) {
+	repo, led := newMocks()
+	r := setupRouter(repo, led)
+	submit(t, r, 5, "750")
+	submit(t, r, 2, "20")
+
+	// over the treasurer limit
+	if rr := do(r, "POST", "/reimbursements/1/approve", 2, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	// own request
+	if rr := do(r, "POST", "/reimbursements/2/approve", 2, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	// only admins set limits, and only for treasurers
+	if rr := do(r, "PUT", "/reimbursements/limits/treasurer", 2, `{"max_amount":null}`); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rr.Code)
+	}
+	if rr := do(r, "PUT", "/reimbursements/limits/member", 1, `{"max_amount":10}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+	if rr := do(r, "PUT", "/reimbursements/limits/treasurer", 1, `{"max_amount":1000}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/reimbursements/1/approve", 2, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 after raising limit, got %d", rr.Code)
+	}
+	// admins are not limited
+	if rr := do(r, "POST", "/reimbursements/2/approve", 1, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestHandlers_LedgerRetryAndCancel(t *testing.T) {
+	repo, led := newMocks()
+	r := setupRouter(repo, led)
+	submit(t, r, 5, "10")
+	submit(t, r, 5, "15")
+
+	led.fail = true
+	if rr := do(r, "POST", "/reimbursements/1/approve", 1, ""); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rr.Code)
+	}
+	if repo.items[0].Status != StatusApproved || repo.items[0].LedgerEntryID != nil {
+		t.Fatalf("expected approved without entry: %+v", repo.items[0])
+	}
+	led.fail = false
+	rr := do(r, "POST", "/reimbursements/1/post", 1, "")
+	if rr.Code != http.StatusOK || repo.items[0].LedgerEntryID == nil {
+		t.Fatalf("expected retry to post, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/reimbursements/2/post", 1, ""); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for unapproved, got %d", rr.Code)
+	}
+
+	if rr := do(r, "POST", "/reimbursements/2/cancel", 1, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-owner, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/reimbursements/2/cancel", 5, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	if rr := do(r, "POST", "/reimbursements/2/reject", 1, `{"note":"late"}`); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+}
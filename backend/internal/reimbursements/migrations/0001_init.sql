@@ -0,0 +1,32 @@
+-- backend/internal/reimbursements/migrations/0001_init.sql
+CREATE TABLE IF NOT EXISTS reimbursements (
+  id SERIAL PRIMARY KEY,
+  member_id BIGINT NOT NULL REFERENCES members(id),
+  amount DECIMAL(12,2) NOT NULL CHECK (amount > 0),
+  description TEXT NOT NULL,
+  category TEXT NOT NULL DEFAULT '',
+  incurred_on DATE NOT NULL,
+  status TEXT NOT NULL DEFAULT 'submitted'
+    CHECK (status IN ('submitted','approved','rejected','cancelled','paid')),
+  decided_by BIGINT REFERENCES members(id) ON DELETE SET NULL,
+  decided_at TIMESTAMPTZ,
+  decision_note TEXT NOT NULL DEFAULT '',
+  ledger_entry_id INTEGER REFERENCES ledger_entries(id),
+  paid_at TIMESTAMPTZ,
+  payout_method TEXT NOT NULL DEFAULT '',
+  payout_reference TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS reimbursements_member_id_idx ON reimbursements (member_id);
+CREATE INDEX IF NOT EXISTS reimbursements_status_idx ON reimbursements (status);
+
+-- Per-role approval limits; admins are never limited. NULL max_amount means
+-- unlimited. Roles without a row cannot approve.
+CREATE TABLE IF NOT EXISTS reimbursement_limits (
+  role TEXT PRIMARY KEY,
+  max_amount DECIMAL(12,2) CHECK (max_amount IS NULL OR max_amount >= 0)
+);
+
+INSERT INTO reimbursement_limits (role, max_amount) VALUES ('treasurer', 500.00)
+ON CONFLICT (role) DO NOTHING;
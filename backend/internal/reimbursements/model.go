@@ -0,0 +1,56 @@
+package reimbursements
+
+import "time"
+
+// Request statuses. A request starts submitted and is either cancelled by
+// its requester, rejected, or approved and later paid.
+const (
+	StatusSubmitted = "submitted"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusPaid      = "paid"
+)
+
+// ValidStatus reports whether s is a known request status.
+func ValidStatus(s string) bool {
+	switch s {
+	case StatusSubmitted, StatusApproved, StatusRejected, StatusCancelled, StatusPaid:
+		return true
+	}
+	return false
+}
+
+// Request is a member's claim to be paid back for a co-op expense.
+type Request struct {
+	ID              int32      `json:"id"`
+	MemberID        int64      `json:"member_id"`
+	Amount          float64    `json:"amount"`
+	Description     string     `json:"description"`
+	Category        string     `json:"category"`
+	IncurredOn      time.Time  `json:"incurred_on"`
+	Status          string     `json:"status"`
+	DecidedBy       *int64     `json:"decided_by"`
+	DecidedAt       *time.Time `json:"decided_at"`
+	DecisionNote    string     `json:"decision_note"`
+	LedgerEntryID   *int32     `json:"ledger_entry_id"`
+	PaidAt          *time.Time `json:"paid_at"`
+	PayoutMethod    string     `json:"payout_method"`
+	PayoutReference string     `json:"payout_reference"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ListFilters holds optional constraints for listing requests.
+type ListFilters struct {
+	MemberID *int64
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+// Limit is the largest request an approver role may approve. A nil
+// MaxAmount means no limit.
+type Limit struct {
+	Role      string   `json:"role"`
+	MaxAmount *float64 `json:"max_amount"`
+}
@@ -0,0 +1,191 @@
+package reimbursements
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrNotFound = errors.New("reimbursement not found")
+	ErrConflict = errors.New("invalid state transition")
+)
+
+type Repo interface {
+	List(ctx context.Context, f ListFilters) ([]Request, error)
+	Get(ctx context.Context, id int32) (Request, error)
+	Create(ctx context.Context, req Request) (Request, error)
+	// Cancel, Reject and Approve move a submitted request on; ErrConflict
+	// otherwise.
+	Cancel(ctx context.Context, id int32) (Request, error)
+	Reject(ctx context.Context, id int32, by int64, note string) (Request, error)
+	Approve(ctx context.Context, id int32, by int64, note string) (Request, error)
+	// SetLedgerEntry records the expense posted for an approved request.
+	SetLedgerEntry(ctx context.Context, id int32, entryID int32) (Request, error)
+	// MarkPaid moves an approved, posted request to paid.
+	MarkPaid(ctx context.Context, id int32, paidAt time.Time, method, reference string) (Request, error)
+	ListLimits(ctx context.Context) ([]Limit, error)
+	// GetLimit returns the limit for role; found=false when the role may not
+	// approve at all.
+	GetLimit(ctx context.Context, role string) (l Limit, found bool, err error)
+	SetLimit(ctx context.Context, l Limit) (Limit, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+const columns = `id, member_id, amount, description, category, incurred_on, status, decided_by, decided_at, decision_note, ledger_entry_id, paid_at, payout_method, payout_reference, created_at`
+
+func (r *PgRepo) List(ctx context.Context, f ListFilters) ([]Request, error) {
+	query := `SELECT ` + columns + ` FROM reimbursements
+WHERE ($1::bigint IS NULL OR member_id=$1) AND ($2 = '' OR status=$2)
+ORDER BY created_at DESC, id DESC`
+	args := []any{f.MemberID, f.Status}
+	if f.Limit > 0 {
+		query += ` LIMIT $3 OFFSET $4`
+		args = append(args, f.Limit, f.Offset)
+	} else if f.Offset > 0 {
+		query += ` OFFSET $3`
+		args = append(args, f.Offset)
+	}
+	rows, err := r.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Request
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, req)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Get(ctx context.Context, id int32) (Request, error) {
+	req, err := scanRequest(r.Pool.QueryRow(ctx, `SELECT `+columns+` FROM reimbursements WHERE id=$1`, id))
+	if err == pgx.ErrNoRows {
+		return Request{}, ErrNotFound
+	}
+	return req, err
+}
+
+func (r *PgRepo) Create(ctx context.Context, req Request) (Request, error) {
+	return scanRequest(r.Pool.QueryRow(ctx, `
+INSERT INTO reimbursements (member_id, amount, description, category, incurred_on)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING `+columns, req.MemberID, req.Amount, req.Description, req.Category, req.IncurredOn))
+}
+
+func (r *PgRepo) Cancel(ctx context.Context, id int32) (Request, error) {
+	return r.update(ctx, id, `SET status='cancelled' WHERE id=$1 AND status='submitted'`)
+}
+
+func (r *PgRepo) Reject(ctx context.Context, id int32, by int64, note string) (Request, error) {
+	return r.update(ctx, id, `SET status='rejected', decided_by=$2, decided_at=now(), decision_note=$3
+WHERE id=$1 AND status='submitted'`, by, note)
+}
+
+func (r *PgRepo) Approve(ctx context.Context, id int32, by int64, note string) (Request, error) {
+	return r.update(ctx, id, `SET status='approved', decided_by=$2, decided_at=now(), decision_note=$3
+WHERE id=$1 AND status='submitted'`, by, note)
+}
+
+func (r *PgRepo) SetLedgerEntry(ctx context.Context, id int32, entryID int32) (Request, error) {
+	return r.update(ctx, id, `SET ledger_entry_id=$2 WHERE id=$1 AND status IN ('approved','paid')`, entryID)
+}
+
+func (r *PgRepo) MarkPaid(ctx context.Context, id int32, paidAt time.Time, method, reference string) (Request, error) {
+	return r.update(ctx, id, `SET status='paid', paid_at=$2, payout_method=$3, payout_reference=$4
+WHERE id=$1 AND status='approved' AND ledger_entry_id IS NOT NULL`, paidAt, method, reference)
+}
+
+// update runs a conditional UPDATE and distinguishes a missing request from
+// one in the wrong state.
+func (r *PgRepo) update(ctx context.Context, id int32, set string, args ...any) (Request, error) {
+	req, err := scanRequest(r.Pool.QueryRow(ctx, `UPDATE reimbursements `+set+` RETURNING `+columns, append([]any{id}, args...)...))
+	if err == pgx.ErrNoRows {
+		if _, err := r.Get(ctx, id); err != nil {
+			return Request{}, err
+		}
+		return Request{}, ErrConflict
+	}
+	return req, err
+}
+
+func (r *PgRepo) ListLimits(ctx context.Context) ([]Limit, error) {
+	rows, err := r.Pool.Query(ctx, `SELECT role, max_amount::float8 FROM reimbursement_limits ORDER BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Limit
+	for rows.Next() {
+		var l Limit
+		if err := rows.Scan(&l.Role, &l.MaxAmount); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) GetLimit(ctx context.Context, role string) (Limit, bool, error) {
+	l := Limit{Role: role}
+	err := r.Pool.QueryRow(ctx, `SELECT max_amount::float8 FROM reimbursement_limits WHERE role=$1`, role).Scan(&l.MaxAmount)
+	if err == pgx.ErrNoRows {
+		return Limit{}, false, nil
+	}
+	if err != nil {
+		return Limit{}, false, err
+	}
+	return l, true, nil
+}
+
+func (r *PgRepo) SetLimit(ctx context.Context, l Limit) (Limit, error) {
+	var out Limit
+	err := r.Pool.QueryRow(ctx, `
+INSERT INTO reimbursement_limits (role, max_amount) VALUES ($1,$2)
+ON CONFLICT (role) DO UPDATE SET max_amount=EXCLUDED.max_amount
+RETURNING role, max_amount::float8`, l.Role, l.MaxAmount).Scan(&out.Role, &out.MaxAmount)
+	return out, err
+}
+
+func scanRequest(row pgx.Row) (Request, error) {
+	var req Request
+	var incurred pgtype.Date
+	var decidedBy pgtype.Int8
+	var entryID pgtype.Int4
+	var decidedAt, paidAt pgtype.Timestamptz
+	if err := row.Scan(&req.ID, &req.MemberID, &req.Amount, &req.Description, &req.Category, &incurred, &req.Status,
+		&decidedBy, &decidedAt, &req.DecisionNote, &entryID, &paidAt, &req.PayoutMethod, &req.PayoutReference, &req.CreatedAt); err != nil {
+		return Request{}, err
+	}
+	req.IncurredOn = incurred.Time
+	if decidedBy.Valid {
+		req.DecidedBy = &decidedBy.Int64
+	}
+	if decidedAt.Valid {
+		t := decidedAt.Time
+		req.DecidedAt = &t
+	}
+	if entryID.Valid {
+		req.LedgerEntryID = &entryID.Int32
+	}
+	if paidAt.Valid {
+		t := paidAt.Time
+		req.PaidAt = &t
+	}
+	return req, nil
+}
@@ -0,0 +1,24 @@
+package reimbursements
+
+import (
+	"coop.tools/backend/internal/httpmw"
+	"github.com/go-chi/chi/v5"
+)
+
+func Mount(r chi.Router, h Handlers) {
+	approver := httpmw.RequirePermission("reimbursements.approve")
+	route := func(r chi.Router) {
+		r.Use(httpmw.RequireAuth)
+		r.Get("/", h.List)
+		r.Post("/", h.Create)
+		r.With(approver).Get("/limits", h.ListLimits)
+		r.With(httpmw.RequirePermission("reimbursements.limits")).Put("/limits/{role}", h.SetLimit)
+		r.Get("/{id}", h.Get)
+		r.Post("/{id}/cancel", h.Cancel)
+		r.With(approver).Post("/{id}/approve", h.Approve)
+		r.With(approver).Post("/{id}/reject", h.Reject)
+		r.With(approver).Post("/{id}/post", h.PostToLedger)
+		r.With(approver).Post("/{id}/pay", h.Pay)
+	}
+	r.Route("/reimbursements", route)
+}
@@ -0,0 +1,236 @@
+package reports
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Group classifies a ledger type for statement subtotals.
+func Group(ledgerType string) string {
+	switch ledgerType {
+	case "dues", "contribution", "income":
+		return "revenue"
+	case "expense":
+		return "expense"
+	case "patronage":
+		return "distribution"
+	case "capital":
+		return "equity"
+	}
+	return "other"
+}
+
+// ComparePeriod returns the period p is compared against:
+//   - "previous": the range of equal length ending the day before p.From
+//   - "mom": the same dates one month earlier
+//   - "yoy": the same dates one year earlier
+//
+// Month-end dates stay month-ends (see addMonths).
+func ComparePeriod(p Period, mode string) (Period, bool) {
+	switch mode {
+	case "previous":
+		days := int(p.To.Sub(p.From).Hours()/24) + 1
+		return Period{From: p.From.AddDate(0, 0, -days), To: p.From.AddDate(0, 0, -1)}, true
+	case "mom":
+		return Period{From: addMonths(p.From, -1), To: addMonths(p.To, -1)}, true
+	case "yoy":
+		return Period{From: addMonths(p.From, -12), To: addMonths(p.To, -12)}, true
+	}
+	return Period{}, false
+}
+
+// addMonths moves t by n calendar months. Unlike time.AddDate it does not
+// overflow into the following month: a day past the end of the target
+// month is clamped to its last day, and the last day of a month maps to
+// the last day of the target month, so Mar 31 becomes Feb 28 and Feb 29
+// a year back becomes Feb 28.
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	if d > last || t.AddDate(0, 0, 1).Day() == 1 {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// ValidInterval reports whether i is a supported cash flow bucket size.
+func ValidInterval(i string) bool {
+	return i == "month" || i == "quarter" || i == "year"
+}
+
+// BuildIncomeStatement totals each ledger type over p and, when compare is
+// set, over the comparison period as well. Amounts keep the ledger's sign, so
+// Net is simply the sum of all lines. Member capital is equity, not income,
+// and is left out.
+func BuildIncomeStatement(ctx context.Context, repo Repo, p Period, compare *Period) (IncomeStatement, error) {
+	cur, err := repo.Totals(ctx, &p.From, p.To)
+	if err != nil {
+		return IncomeStatement{}, err
+	}
+	var prev []TypeTotal
+	if compare != nil {
+		if prev, err = repo.Totals(ctx, &compare.From, compare.To); err != nil {
+			return IncomeStatement{}, err
+		}
+	}
+	cur, prev = withoutEquity(cur), withoutEquity(prev)
+	st := IncomeStatement{Period: p, Compare: compare, Lines: mergeLines(cur, prev, compare != nil)}
+	for _, l := range st.Lines {
+		switch l.Group {
+		case "revenue":
+			st.Revenue += l.Amount
+		case "expense":
+			st.Expenses += l.Amount
+		case "distribution":
+			st.Distributions += l.Amount
+		}
+		st.Net += l.Amount
+	}
+	st.Revenue, st.Expenses, st.Distributions, st.Net = round2(st.Revenue), round2(st.Expenses), round2(st.Distributions), round2(st.Net)
+	if compare != nil {
+		v := round2(sumAmounts(prev))
+		st.CompareNet = &v
+	}
+	return st, nil
+}
+
+// BuildBalanceSummary totals each ledger type from inception to asOf.
+func BuildBalanceSummary(ctx context.Context, repo Repo, asOf time.Time, compareAsOf *time.Time) (BalanceSummary, error) {
+	cur, err := repo.Totals(ctx, nil, asOf)
+	if err != nil {
+		return BalanceSummary{}, err
+	}
+	var prev []TypeTotal
+	if compareAsOf != nil {
+		if prev, err = repo.Totals(ctx, nil, *compareAsOf); err != nil {
+			return BalanceSummary{}, err
+		}
+	}
+	bs := BalanceSummary{AsOf: asOf, CompareAsOf: compareAsOf, Lines: mergeLines(cur, prev, compareAsOf != nil)}
+	bs.Balance = round2(sumAmounts(cur))
+	if compareAsOf != nil {
+		v := round2(sumAmounts(prev))
+		bs.CompareBalance = &v
+	}
+	return bs, nil
+}
+
+// BuildCashFlow reports inflows and outflows per interval over p, starting
+// from the balance carried in before p.From. Intervals with no activity are
+// included with zero flows so the series is continuous.
+func BuildCashFlow(ctx context.Context, repo Repo, p Period, interval string) (CashFlow, error) {
+	before, err := repo.Totals(ctx, nil, p.From.AddDate(0, 0, -1))
+	if err != nil {
+		return CashFlow{}, err
+	}
+	flows, err := repo.Flows(ctx, p.From, p.To, interval)
+	if err != nil {
+		return CashFlow{}, err
+	}
+	byStart := map[time.Time]FlowPeriod{}
+	for _, f := range flows {
+		byStart[f.PeriodStart] = f
+	}
+
+	cf := CashFlow{Period: p, Interval: interval, OpeningBalance: round2(sumAmounts(before)), Periods: []FlowPeriod{}}
+	balance := cf.OpeningBalance
+	for start := bucketStart(p.From, interval); !start.After(p.To); start = nextBucket(start, interval) {
+		f := byStart[start]
+		f.PeriodStart = start
+		f.Net = round2(f.Inflow + f.Outflow)
+		balance = round2(balance + f.Net)
+		f.ClosingBalance = balance
+		cf.Periods = append(cf.Periods, f)
+		cf.Inflow += f.Inflow
+		cf.Outflow += f.Outflow
+	}
+	cf.Inflow, cf.Outflow = round2(cf.Inflow), round2(cf.Outflow)
+	cf.Net = round2(cf.Inflow + cf.Outflow)
+	cf.ClosingBalance = balance
+	return cf, nil
+}
+
+func withoutEquity(ts []TypeTotal) []TypeTotal {
+	var out []TypeTotal
+	for _, t := range ts {
+		if Group(t.Type) != "equity" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func mergeLines(cur, prev []TypeTotal, comparing bool) []Line {
+	byType := map[string]*Line{}
+	for _, t := range cur {
+		byType[t.Type] = &Line{Type: t.Type, Group: Group(t.Type), Amount: round2(t.Amount), Count: t.Count}
+	}
+	if comparing {
+		for _, t := range prev {
+			if _, ok := byType[t.Type]; !ok {
+				byType[t.Type] = &Line{Type: t.Type, Group: Group(t.Type)}
+			}
+			v := round2(t.Amount)
+			byType[t.Type].CompareAmount = &v
+		}
+	}
+	out := make([]Line, 0, len(byType))
+	for _, l := range byType {
+		if comparing {
+			if l.CompareAmount == nil {
+				zero := 0.0
+				l.CompareAmount = &zero
+			}
+			change := round2(l.Amount - *l.CompareAmount)
+			l.Change = &change
+			if *l.CompareAmount != 0 {
+				pct := round2(change / math.Abs(*l.CompareAmount) * 100)
+				l.ChangePercent = &pct
+			}
+		}
+		out = append(out, *l)
+	}
+	order := map[string]int{"revenue": 0, "expense": 1, "distribution": 2, "equity": 3, "other": 4}
+	sort.Slice(out, func(i, j int) bool {
+		if order[out[i].Group] != order[out[j].Group] {
+			return order[out[i].Group] < order[out[j].Group]
+		}
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+func bucketStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case "quarter":
+		return time.Date(t.Year(), time.Month((int(t.Month())-1)/3*3+1), 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextBucket(t time.Time, interval string) time.Time {
+	switch interval {
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+func sumAmounts(ts []TypeTotal) float64 {
+	sum := 0.0
+	for _, t := range ts {
+		sum += t.Amount
+	}
+	return sum
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,223 @@
+package reports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"coop.tools/backend/internal/httpmw"
+	"coop.tools/backend/internal/httpx"
+)
+
+type Handlers struct {
+	Repo Repo
+	// Currency labels report amounts, which are ledger base amounts.
+	Currency string
+}
+
+// IncomeStatement handles GET /api/reports/income-statement
+// Query: from, to (YYYY-MM-DD; default year to date), compare=previous|mom|yoy
+func (h Handlers) IncomeStatement(w http.ResponseWriter, r *http.Request) {
+	st, ok := h.incomeStatement(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, st)
+}
+
+// IncomeStatementCSV streams the income statement as CSV
+func (h Handlers) IncomeStatementCSV(w http.ResponseWriter, r *http.Request) {
+	st, ok := h.incomeStatement(w, r)
+	if !ok {
+		return
+	}
+	cw := csvWriter(w, "income-statement.csv")
+	defer cw.Flush()
+	writeLines(cw, st.Lines)
+	_ = cw.Write([]string{"revenue", "", money(st.Revenue), "", "", "", ""})
+	_ = cw.Write([]string{"expenses", "", money(st.Expenses), "", "", "", ""})
+	_ = cw.Write([]string{"distributions", "", money(st.Distributions), "", "", "", ""})
+	_ = cw.Write([]string{"net", "", money(st.Net), "", optMoney(st.CompareNet), "", ""})
+}
+
+// BalanceSummary handles GET /api/reports/balance-summary
+// Query: as_of (default today), compare=mom|yoy
+func (h Handlers) BalanceSummary(w http.ResponseWriter, r *http.Request) {
+	bs, ok := h.balanceSummary(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, bs)
+}
+
+// BalanceSummaryCSV streams the balance summary as CSV
+func (h Handlers) BalanceSummaryCSV(w http.ResponseWriter, r *http.Request) {
+	bs, ok := h.balanceSummary(w, r)
+	if !ok {
+		return
+	}
+	cw := csvWriter(w, "balance-summary.csv")
+	defer cw.Flush()
+	writeLines(cw, bs.Lines)
+	_ = cw.Write([]string{"balance", "", money(bs.Balance), "", optMoney(bs.CompareBalance), "", ""})
+}
+
+// CashFlow handles GET /api/reports/cash-flow
+// Query: from, to (default year to date), interval=month|quarter|year
+func (h Handlers) CashFlow(w http.ResponseWriter, r *http.Request) {
+	cf, ok := h.cashFlow(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, cf)
+}
+
+// CashFlowCSV streams the cash flow report as CSV
+func (h Handlers) CashFlowCSV(w http.ResponseWriter, r *http.Request) {
+	cf, ok := h.cashFlow(w, r)
+	if !ok {
+		return
+	}
+	cw := csvWriter(w, "cash-flow.csv")
+	defer cw.Flush()
+	_ = cw.Write([]string{"period_start", "inflow", "outflow", "net", "closing_balance"})
+	_ = cw.Write([]string{"opening", "", "", "", money(cf.OpeningBalance)})
+	for _, p := range cf.Periods {
+		_ = cw.Write([]string{p.PeriodStart.Format(httpx.DateLayout), money(p.Inflow), money(p.Outflow), money(p.Net), money(p.ClosingBalance)})
+	}
+	_ = cw.Write([]string{"total", money(cf.Inflow), money(cf.Outflow), money(cf.Net), money(cf.ClosingBalance)})
+}
+
+func (h Handlers) incomeStatement(w http.ResponseWriter, r *http.Request) (IncomeStatement, bool) {
+	p, ok := parsePeriod(w, r)
+	if !ok {
+		return IncomeStatement{}, false
+	}
+	var compare *Period
+	if mode := r.URL.Query().Get("compare"); mode != "" {
+		cp, ok := ComparePeriod(p, mode)
+		if !ok {
+			httpmw.WriteJSONError(w, http.StatusBadRequest, "compare must be 'previous', 'mom', or 'yoy'")
+			return IncomeStatement{}, false
+		}
+		compare = &cp
+	}
+	st, err := BuildIncomeStatement(r.Context(), h.Repo, p, compare)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return IncomeStatement{}, false
+	}
+	st.Currency = h.Currency
+	return st, true
+}
+
+func (h Handlers) balanceSummary(w http.ResponseWriter, r *http.Request) (BalanceSummary, bool) {
+	asOf, err := httpx.QueryDate(r, "as_of")
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid as_of")
+		return BalanceSummary{}, false
+	}
+	if asOf == nil {
+		t := today()
+		asOf = &t
+	}
+	var compareAsOf *time.Time
+	switch r.URL.Query().Get("compare") {
+	case "":
+	case "mom":
+		t := addMonths(*asOf, -1)
+		compareAsOf = &t
+	case "yoy":
+		t := addMonths(*asOf, -12)
+		compareAsOf = &t
+	default:
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "compare must be 'mom' or 'yoy'")
+		return BalanceSummary{}, false
+	}
+	bs, err := BuildBalanceSummary(r.Context(), h.Repo, *asOf, compareAsOf)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return BalanceSummary{}, false
+	}
+	bs.Currency = h.Currency
+	return bs, true
+}
+
+func (h Handlers) cashFlow(w http.ResponseWriter, r *http.Request) (CashFlow, bool) {
+	p, ok := parsePeriod(w, r)
+	if !ok {
+		return CashFlow{}, false
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if !ValidInterval(interval) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "interval must be 'month', 'quarter', or 'year'")
+		return CashFlow{}, false
+	}
+	cf, err := BuildCashFlow(r.Context(), h.Repo, p, interval)
+	if err != nil {
+		httpmw.WriteJSONError(w, http.StatusInternalServerError, "report failed")
+		return CashFlow{}, false
+	}
+	cf.Currency = h.Currency
+	return cf, true
+}
+
+// parsePeriod reads from/to, defaulting to the current year to date.
+func parsePeriod(w http.ResponseWriter, r *http.Request) (Period, bool) {
+	from, err1 := httpx.QueryDate(r, "from")
+	to, err2 := httpx.QueryDate(r, "to")
+	if err1 != nil || err2 != nil {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "invalid date")
+		return Period{}, false
+	}
+	if to == nil {
+		t := today()
+		to = &t
+	}
+	if from == nil {
+		t := time.Date(to.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		from = &t
+	}
+	if to.Before(*from) {
+		httpmw.WriteJSONError(w, http.StatusBadRequest, "to must not be before from")
+		return Period{}, false
+	}
+	return Period{From: *from, To: *to}, true
+}
+
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func csvWriter(w http.ResponseWriter, filename string) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	return csv.NewWriter(w)
+}
+
+func writeLines(cw *csv.Writer, lines []Line) {
+	_ = cw.Write([]string{"type", "group", "amount", "count", "compare_amount", "change", "change_percent"})
+	for _, l := range lines {
+		_ = cw.Write([]string{l.Type, l.Group, money(l.Amount), strconv.Itoa(l.Count), optMoney(l.CompareAmount), optMoney(l.Change), optMoney(l.ChangePercent)})
+	}
+}
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func optMoney(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return money(*v)
+}
@@ -0,0 +1,275 @@
+package reports
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ---- Mock Repo ----
+
+type entry struct {
+	Type   string
+	Amount float64
+	At     time.Time
+}
+
+// mockRepo aggregates in-memory entries the same way the SQL does.
+type mockRepo struct {
+	entries []entry
+}
+
+func (m *mockRepo) Totals(_ context.Context, from *time.Time, to time.Time) ([]TypeTotal, error) {
+	byType := map[string]*TypeTotal{}
+	for _, e := range m.entries {
+		if (from != nil && e.At.Before(*from)) || !e.At.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		t := byType[e.Type]
+		if t == nil {
+			t = &TypeTotal{Type: e.Type}
+			byType[e.Type] = t
+		}
+		t.Amount += e.Amount
+		if e.Amount > 0 {
+			t.Inflow += e.Amount
+		} else {
+			t.Outflow += e.Amount
+		}
+		t.Count++
+	}
+	var out []TypeTotal
+	for _, t := range byType {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+	return out, nil
+}
+
+func (m *mockRepo) Flows(_ context.Context, from, to time.Time, interval string) ([]FlowPeriod, error) {
+	byStart := map[time.Time]*FlowPeriod{}
+	for _, e := range m.entries {
+		if e.At.Before(from) || !e.At.Before(to.AddDate(0, 0, 1)) {
+			continue
+		}
+		s := bucketStart(e.At, interval)
+		if byStart[s] == nil {
+			byStart[s] = &FlowPeriod{PeriodStart: s}
+		}
+		if e.Amount > 0 {
+			byStart[s].Inflow += e.Amount
+		} else {
+			byStart[s].Outflow += e.Amount
+		}
+	}
+	var out []FlowPeriod
+	for _, f := range byStart {
+		out = append(out, *f)
+	}
+	return out, nil
+}
+
+// ---- Helper functions ----
+
+func setupRouter(repo Repo) *chi.Mux {
+	r := chi.NewRouter()
+	Mount(r, Handlers{Repo: repo})
+	return r
+}
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+}
+
+func seed() *mockRepo {
+	return &mockRepo{entries: []entry{
+		{"dues", 100, day(2024, 3, 1)},
+		{"expense", -40, day(2024, 3, 5)},
+		{"dues", 100, day(2025, 1, 1)},
+		{"dues", 100, day(2025, 2, 1)},
+		{"income", 250, day(2025, 2, 10)},
+		{"expense", -80, day(2025, 3, 5)},
+		{"patronage", -20, day(2025, 3, 20)},
+	}}
+}
+
+// ---- Tests ----
+
+func TestComparePeriod(t *testing.T) {
+	p := Period{From: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)}
+	prev, _ := ComparePeriod(p, "previous")
+	if !prev.From.Equal(time.Date(2025, 1, 29, 0, 0, 0, 0, time.UTC)) || !prev.To.Equal(time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected previous period: %+v", prev)
+	}
+	yoy, _ := ComparePeriod(p, "yoy")
+	if yoy.From.Year() != 2024 || yoy.From.Month() != 3 {
+		t.Errorf("unexpected yoy period: %+v", yoy)
+	}
+	if _, ok := ComparePeriod(p, "weekly"); ok {
+		t.Errorf("expected unknown mode to be rejected")
+	}
+}
+
+func TestComparePeriod_MonthEnds(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	for _, c := range []struct {
+		mode    string
+		p, want Period
+	}{
+		{"mom", Period{From: day(2025, 3, 1), To: day(2025, 3, 31)}, Period{From: day(2025, 2, 1), To: day(2025, 2, 28)}},
+		{"mom", Period{From: day(2025, 5, 1), To: day(2025, 5, 31)}, Period{From: day(2025, 4, 1), To: day(2025, 4, 30)}},
+		{"mom", Period{From: day(2025, 4, 1), To: day(2025, 4, 30)}, Period{From: day(2025, 3, 1), To: day(2025, 3, 31)}},
+		{"mom", Period{From: day(2025, 3, 10), To: day(2025, 3, 20)}, Period{From: day(2025, 2, 10), To: day(2025, 2, 20)}},
+		{"yoy", Period{From: day(2024, 2, 1), To: day(2024, 2, 29)}, Period{From: day(2023, 2, 1), To: day(2023, 2, 28)}},
+		{"yoy", Period{From: day(2025, 1, 1), To: day(2025, 3, 31)}, Period{From: day(2024, 1, 1), To: day(2024, 3, 31)}},
+	} {
+		got, _ := ComparePeriod(c.p, c.mode)
+		if !got.From.Equal(c.want.From) || !got.To.Equal(c.want.To) {
+			t.Errorf("%s of %s..%s: got %s..%s, want %s..%s", c.mode, c.p.From.Format(time.DateOnly), c.p.To.Format(time.DateOnly),
+				got.From.Format(time.DateOnly), got.To.Format(time.DateOnly), c.want.From.Format(time.DateOnly), c.want.To.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestHandlers_IncomeStatement(t *testing.T) {
+	r := setupRouter(seed())
+
+	req := httptest.NewRequest("GET", "/reports/income-statement?from=2025-01-01&to=2025-03-31&compare=yoy", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d (%s)", rr.Code, rr.Body.String())
+	}
+	var st IncomeStatement
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatal("failed to parse json:", err)
+	}
+	if st.Revenue != 450 || st.Expenses != -80 || st.Distributions != -20 || st.Net != 350 {
+		t.Fatalf("unexpected totals: %+v", st)
+	}
+	if st.CompareNet == nil || *st.CompareNet != 60 {
+		t.Fatalf("expected compare_net=60, got %v", st.CompareNet)
+	}
+	if st.Lines[0].Type != "dues" || st.Lines[0].Group != "revenue" || *st.Lines[0].Change != 100 || *st.Lines[0].ChangePercent != 100 {
+		t.Fatalf("unexpected first line: %+v", st.Lines[0])
+	}
+
+	// CSV
+	req = httptest.NewRequest("GET", "/reports/income-statement.csv?from=2025-01-01&to=2025-03-31", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("unexpected csv response %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body := rr.Body.String()
+	if !strings.HasPrefix(body, "type,group,amount,count,compare_amount,change,change_percent") || !strings.Contains(body, "net,,350.00") {
+		t.Fatalf("unexpected csv:\n%s", body)
+	}
+
+	// bad compare and reversed range
+	for _, q := range []string{"compare=weekly", "from=2025-03-01&to=2025-01-01", "from=yesterday"} {
+		req = httptest.NewRequest("GET", "/reports/income-statement?"+q, nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
+
+func TestHandlers_BalanceSummary(t *testing.T) {
+	r := setupRouter(seed())
+
+	req := httptest.NewRequest("GET", "/reports/balance-summary?as_of=2025-02-28&compare=yoy", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var bs BalanceSummary
+	_ = json.Unmarshal(rr.Body.Bytes(), &bs)
+	if bs.Balance != 510 {
+		t.Fatalf("expected balance=510, got %.2f", bs.Balance)
+	}
+	if bs.CompareBalance == nil || *bs.CompareBalance != 0 {
+		t.Fatalf("expected compare_balance=0, got %v", bs.CompareBalance)
+	}
+
+	// A month-end compares against the previous month's end, not the 3rd.
+	req = httptest.NewRequest("GET", "/reports/balance-summary?as_of=2025-03-31&compare=mom", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	bs = BalanceSummary{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &bs)
+	if rr.Code != http.StatusOK || bs.CompareAsOf == nil || bs.CompareAsOf.Format(time.DateOnly) != "2025-02-28" {
+		t.Fatalf("expected compare_as_of=2025-02-28, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandlers_CashFlow(t *testing.T) {
+	r := setupRouter(seed())
+
+	req := httptest.NewRequest("GET", "/reports/cash-flow?from=2025-01-01&to=2025-04-30", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	var cf CashFlow
+	_ = json.Unmarshal(rr.Body.Bytes(), &cf)
+	if cf.OpeningBalance != 60 {
+		t.Fatalf("expected opening balance 60, got %.2f", cf.OpeningBalance)
+	}
+	// Jan..Apr, April has no activity but is still reported
+	if len(cf.Periods) != 4 {
+		t.Fatalf("expected 4 periods, got %d", len(cf.Periods))
+	}
+	if p := cf.Periods[1]; p.Inflow != 350 || p.ClosingBalance != 510 {
+		t.Errorf("unexpected february: %+v", p)
+	}
+	if p := cf.Periods[3]; p.Net != 0 || p.ClosingBalance != 410 {
+		t.Errorf("unexpected april: %+v", p)
+	}
+	if cf.Inflow != 450 || cf.Outflow != -100 || cf.ClosingBalance != 410 {
+		t.Errorf("unexpected totals: %+v", cf)
+	}
+
+	req = httptest.NewRequest("GET", "/reports/cash-flow?from=2025-01-01&to=2025-12-31&interval=quarter", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	_ = json.Unmarshal(rr.Body.Bytes(), &cf)
+	if len(cf.Periods) != 4 || cf.Periods[0].Net != 350 {
+		t.Errorf("unexpected quarterly flow: %+v", cf.Periods)
+	}
+
+	req = httptest.NewRequest("GET", "/reports/cash-flow?interval=week", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestBuildIncomeStatement_ExcludesEquity(t *testing.T) {
+	repo := seed()
+	repo.entries = append(repo.entries, entry{"capital", 500, day(2025, 2, 15)})
+	p := Period{From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)}
+	st, err := BuildIncomeStatement(context.Background(), repo, p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Net != 350 || len(st.Lines) != 4 {
+		t.Fatalf("expected capital to be left out: %+v", st)
+	}
+	bs, _ := BuildBalanceSummary(context.Background(), repo, p.To, nil)
+	if bs.Balance != 910 || bs.Lines[len(bs.Lines)-1].Group != "equity" {
+		t.Fatalf("expected capital in balance: %+v", bs)
+	}
+}
@@ -0,0 +1,76 @@
+package reports
+
+import "time"
+
+// TypeTotal aggregates ledger entries of one type. Amount is the signed sum;
+// Inflow and Outflow split it by sign (Outflow is negative or zero).
+type TypeTotal struct {
+	Type    string  `json:"type"`
+	Amount  float64 `json:"amount"`
+	Inflow  float64 `json:"inflow"`
+	Outflow float64 `json:"outflow"`
+	Count   int     `json:"count"`
+}
+
+// Line is one ledger type in a statement, optionally compared with another
+// period. Change is Amount minus CompareAmount.
+type Line struct {
+	Type          string   `json:"type"`
+	Group         string   `json:"group"` // "revenue", "expense", "distribution", "other"
+	Amount        float64  `json:"amount"`
+	Count         int      `json:"count"`
+	CompareAmount *float64 `json:"compare_amount,omitempty"`
+	Change        *float64 `json:"change,omitempty"`
+	ChangePercent *float64 `json:"change_percent,omitempty"`
+}
+
+// Period is an inclusive date range.
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// IncomeStatement summarizes revenue, expenses and distributions for a period.
+type IncomeStatement struct {
+	Period        Period   `json:"period"`
+	Compare       *Period  `json:"compare,omitempty"`
+	Lines         []Line   `json:"lines"`
+	Revenue       float64  `json:"revenue"`
+	Expenses      float64  `json:"expenses"`
+	Distributions float64  `json:"distributions"`
+	Net           float64  `json:"net"`
+	CompareNet    *float64 `json:"compare_net,omitempty"`
+	Currency      string   `json:"currency,omitempty"`
+}
+
+// BalanceSummary is the cumulative position by type from inception to AsOf.
+type BalanceSummary struct {
+	AsOf           time.Time  `json:"as_of"`
+	CompareAsOf    *time.Time `json:"compare_as_of,omitempty"`
+	Lines          []Line     `json:"lines"`
+	Balance        float64    `json:"balance"`
+	CompareBalance *float64   `json:"compare_balance,omitempty"`
+	Currency       string     `json:"currency,omitempty"`
+}
+
+// FlowPeriod is one bucket of a cash flow report.
+type FlowPeriod struct {
+	PeriodStart    time.Time `json:"period_start"`
+	Inflow         float64   `json:"inflow"`
+	Outflow        float64   `json:"outflow"`
+	Net            float64   `json:"net"`
+	ClosingBalance float64   `json:"closing_balance"`
+}
+
+// CashFlow reports inflows and outflows per interval with running balances.
+type CashFlow struct {
+	Period         Period       `json:"period"`
+	Interval       string       `json:"interval"` // "month", "quarter", "year"
+	OpeningBalance float64      `json:"opening_balance"`
+	Periods        []FlowPeriod `json:"periods"`
+	Inflow         float64      `json:"inflow"`
+	Outflow        float64      `json:"outflow"`
+	Net            float64      `json:"net"`
+	ClosingBalance float64      `json:"closing_balance"`
+	Currency       string       `json:"currency,omitempty"`
+}
@@ -0,0 +1,84 @@
+package reports
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Repo interface {
+	// Totals aggregates ledger entries by type over the inclusive date range.
+	// A nil from means since inception.
+	Totals(ctx context.Context, from *time.Time, to time.Time) ([]TypeTotal, error)
+	// Flows buckets inflows and outflows by interval ("month", "quarter",
+	// "year") over the inclusive date range. Empty buckets are omitted.
+	Flows(ctx context.Context, from, to time.Time, interval string) ([]FlowPeriod, error)
+}
+
+type PgRepo struct {
+	Pool *pgxpool.Pool
+}
+
+func NewPgRepo(pool *pgxpool.Pool) *PgRepo {
+	return &PgRepo{Pool: pool}
+}
+
+func (r *PgRepo) Totals(ctx context.Context, from *time.Time, to time.Time) ([]TypeTotal, error) {
+	var fromParam pgtype.Timestamptz
+	if from != nil {
+		fromParam = pgtype.Timestamptz{Time: *from, Valid: true}
+	}
+	rows, err := r.Pool.Query(ctx, `
+SELECT type,
+       COALESCE(SUM(base_amount), 0)::float8,
+       COALESCE(SUM(base_amount) FILTER (WHERE base_amount > 0), 0)::float8,
+       COALESCE(SUM(base_amount) FILTER (WHERE base_amount < 0), 0)::float8,
+       COUNT(*)
+FROM ledger_entries
+WHERE ($1::timestamptz IS NULL OR created_at >= $1) AND created_at < $2
+GROUP BY type
+ORDER BY type`, fromParam, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []TypeTotal
+	for rows.Next() {
+		var t TypeTotal
+		if err := rows.Scan(&t.Type, &t.Amount, &t.Inflow, &t.Outflow, &t.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (r *PgRepo) Flows(ctx context.Context, from, to time.Time, interval string) ([]FlowPeriod, error) {
+	rows, err := r.Pool.Query(ctx, `
+SELECT date_trunc($3, created_at AT TIME ZONE 'UTC')::date AS bucket,
+       COALESCE(SUM(base_amount) FILTER (WHERE base_amount > 0), 0)::float8,
+       COALESCE(SUM(base_amount) FILTER (WHERE base_amount < 0), 0)::float8
+FROM ledger_entries
+WHERE created_at >= $1 AND created_at < $2
+GROUP BY bucket
+ORDER BY bucket`, from, to.AddDate(0, 0, 1), interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []FlowPeriod
+	for rows.Next() {
+		var p FlowPeriod
+		var bucket pgtype.Date
+		if err := rows.Scan(&bucket, &p.Inflow, &p.Outflow); err != nil {
+			return nil, err
+		}
+		p.PeriodStart = bucket.Time
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,15 @@
+package reports
+
+import "github.com/go-chi/chi/v5"
+
+func Mount(r chi.Router, h Handlers) {
+	route := func(r chi.Router) {
+		r.Get("/income-statement", h.IncomeStatement)
+		r.Get("/income-statement.csv", h.IncomeStatementCSV)
+		r.Get("/balance-summary", h.BalanceSummary)
+		r.Get("/balance-summary.csv", h.BalanceSummaryCSV)
+		r.Get("/cash-flow", h.CashFlow)
+		r.Get("/cash-flow.csv", h.CashFlowCSV)
+	}
+	r.Route("/reports", route)
+}
@@ -131,9 +131,13 @@ func (m *mockRepo) GetTally(_ context.Context, proposalID int32) (Tally, error)
 
 func testRouter(repo Repo) http.Handler {
     r := chi.NewRouter()
-    r.Use(httpmw.WithAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
+    r.Use(httpmw.DevHeaderAuth(func(ctx context.Context, id int64) (httpmw.Principal, bool, error) {
         if id <= 0 { return httpmw.Principal{}, false, nil }
-        return httpmw.Principal{MemberID: id, Role: "member"}, true, nil
+        p := httpmw.Principal{MemberID: id, Role: "member"}
+        // Members 90 and up are applicants or suspended.
+        if id == 90 { p.Status = "applicant" }
+        if id == 91 { p.Status = "suspended" }
+        return p, true, nil
     }))
     h := Handlers{Repo: repo}
     r.Route("/api", func(api chi.Router) { Mount(api, h) })
@@ -253,3 +257,22 @@ func TestVotes_UnauthorizedMissingHeader(t *testing.T) {
 		t.Fatalf("unauth: want 401 got %d", rr.Code)
 	}
 }
+
+func TestVotes_OnlyActiveMembersVote(t *testing.T) {
+	repo := &mockRepo{}
+	r := testRouter(repo)
+	for _, user := range []string{"90", "91"} {
+		for _, method := range []string{"POST", "PUT"} {
+			req := httptest.NewRequest(method, "/api/proposals/1/votes", strings.NewReader(`{"choice":"for"}`))
+			req.Header.Set("X-User-Id", user)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusForbidden {
+				t.Fatalf("%s by member %s: want 403 got %d", method, user, rr.Code)
+			}
+		}
+	}
+	if len(repo.votes) != 0 {
+		t.Fatalf("inactive members voted: %+v", repo.votes)
+	}
+}
@@ -159,8 +159,12 @@ func (r *PgRepo) GetTally(ctx context.Context, proposalID int32) (Tally, error)
 		return Tally{}, err
 	}
 
-	// For now, assume 10 eligible members (in real system, this would come from members table)
-	totalEligible := 10
+	// Every active member may vote; applicants, suspended and former
+	// members do not count towards quorum.
+	var totalEligible int
+	if err := r.Pool.QueryRow(ctx, `SELECT count(*) FROM members WHERE status='active'`).Scan(&totalEligible); err != nil {
+		return Tally{}, err
+	}
 
 	// Count votes by choice
 	rows, err := r.Pool.Query(ctx, `
@@ -8,8 +8,9 @@ import (
 func Mount(r chi.Router, h Handlers) {
     route := func(r chi.Router) {
         r.Get("/", h.List)
-        r.With(httpmw.RequireAuth).Post("/", h.Create)
-        r.With(httpmw.RequireAuth).Put("/", h.Update)
+        // Only active members vote; applicants and suspended members may not.
+        r.With(httpmw.RequireActive).Post("/", h.Create)
+        r.With(httpmw.RequireActive).Put("/", h.Update)
         r.Get("/tally", h.GetTally)
     }
 	r.Route("/proposals/{proposal_id}/votes", route)
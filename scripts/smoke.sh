@@ -8,20 +8,18 @@ echo "== Smoke: Health =="
 curl -fsS "$BASE/healthz" && echo "ok" || (echo "health failed" && exit 1)
 echo
 
-echo "== Auth: Create admin member =="
+echo "== Auth: Find admin member =="
 if [ -z "$USER" ]; then
-  # Try create; on 409 fetch existing by email
-  RESP_CODE=$(curl -s -o /tmp/member.json -w '%{http_code}' -X POST "$BASE/api/members" \
-    -H 'Content-Type: application/json' \
-    -d '{"email":"admin@example.com","display_name":"Admin","role":"admin"}')
-  if [ "$RESP_CODE" = "201" ]; then
-    USER=$(jq -r '.id' </tmp/member.json)
-  else
-    # Fallback to lookup
-    USER=$(curl -fsS "$BASE/api/members?email=admin@example.com" | jq -r '.id')
-  fi
+  # The server creates ADMIN_EMAIL as an admin on startup (make run sets it),
+  # so on a fresh database it is member 1. Looking members up by email needs
+  # members.manage, so ask as that member.
+  USER=$(curl -fsS -H 'X-User-Id: 1' "$BASE/api/members?email=${ADMIN_EMAIL:-admin@example.com}" | jq -r '.id')
 fi
 echo "Using member id=$USER"
+# Needs the server started with AUTH_DEV_HEADER=true for the dev login.
+TOKEN=$(curl -fsS -X POST "$BASE/api/auth/dev/login" \
+  -H 'Content-Type: application/json' \
+  -d "{\"member_id\":$USER}" | jq -r '.token')
 echo
 
 echo "== Smoke: List (JSON array) =="
@@ -30,13 +28,14 @@ echo
 
 echo "== Smoke: Create =="
 ID=$(curl -fsS -X POST "$BASE/api/proposals" \
+  -H "Authorization: Bearer $TOKEN" \
   -H 'Content-Type: application/json' \
   -d '{"title":"Smoke run","body":"from script"}' | jq -r '.id')
 echo "Created id=$ID"
 echo
 
 echo "== Smoke: Close =="
-curl -fsS -X POST "$BASE/api/proposals/$ID/close" | jq -r '.status'
+curl -fsS -X POST "$BASE/api/proposals/$ID/close" -H "Authorization: Bearer $TOKEN" | jq -r '.status'
 echo
 
 echo "== Smoke: Get =="
@@ -53,14 +52,14 @@ echo
 
 echo "== Ledger Smoke: Create (idempotent) =="
 LEDGER_ID=$(curl -fsS -X POST "$BASE/api/ledger" \
-  -H "X-User-Id: $USER" \
+  -H "Authorization: Bearer $TOKEN" \
   -H "X-Idempotency-Key: abc123" \
   -H 'Content-Type: application/json' \
   -d '{"type":"dues","amount":50.00,"description":"Smoke test dues"}' | jq -r '.id')
 echo "Created/returned ledger entry id=$LEDGER_ID"
 # Replay idempotent request
 curl -fsS -X POST "$BASE/api/ledger" \
-  -H "X-User-Id: $USER" \
+  -H "Authorization: Bearer $TOKEN" \
   -H "X-Idempotency-Key: abc123" \
   -H 'Content-Type: application/json' \
   -d '{"type":"dues","amount":50.00,"description":"Smoke test dues"}' | jq '{id,type,amount,description}'
@@ -91,7 +90,7 @@ echo
 
 echo "== Announcements Smoke: Create (admin required) =="
 ANNOUNCEMENT_ID=$(curl -fsS -X POST "$BASE/api/announcements" \
-  -H "X-User-Id: $USER" \
+  -H "Authorization: Bearer $TOKEN" \
   -H 'Content-Type: application/json' \
   -d '{"title":"Smoke test announcement","body":"This is a smoke test announcement","priority":"normal"}' | jq -r '.id')
 echo "Created announcement id=$ANNOUNCEMENT_ID"
@@ -103,7 +102,7 @@ echo
 
 echo "== Announcements Smoke: Mark as Read =="
 curl -fsS -X POST "$BASE/api/announcements/$ANNOUNCEMENT_ID/read" \
-  -H "X-User-Id: $USER" | jq '{id,is_read}'
+  -H "Authorization: Bearer $TOKEN" | jq '{id,is_read}'
 echo
 
 echo "== Announcements Smoke: Unread Count =="
@@ -112,11 +111,12 @@ echo
 
 echo "== Votes Smoke: Cast and Tally =="
 PROP_ID=$(curl -fsS -X POST "$BASE/api/proposals" \
+  -H "Authorization: Bearer $TOKEN" \
   -H 'Content-Type: application/json' \
   -d '{"title":"Smoke vote","body":"test"}' | jq -r '.id')
 # cast a vote
 curl -fsS -X POST "$BASE/api/proposals/$PROP_ID/votes" \
-  -H "X-User-Id: $USER" \
+  -H "Authorization: Bearer $TOKEN" \
   -H 'Content-Type: application/json' \
   -d '{"choice":"for"}' | jq '{id,choice}'
 # read tally